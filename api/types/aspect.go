@@ -164,6 +164,14 @@ type OnDestroyAspect interface {
 	OnDestroy(chainCtx NodeCtx)
 }
 
+// ReloadingCtx is implemented by the chain context passed to OnDestroyAspect.
+// ReloadingCtx 传递给OnDestroyAspect的规则链上下文实现该接口
+type ReloadingCtx interface {
+	// Reloading returns true if OnDestroy is triggered by reloading the rule chain, the resources reused by OnReload can be kept.
+	// Reloading 是否是规则链更新触发的OnDestroy，如果是可以保留OnReload复用的资源
+	Reloading() bool
+}
+
 type AspectList []Aspect
 
 // GetNodeAspects 获取节点执行类型增强点切面列表
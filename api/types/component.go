@@ -47,6 +47,18 @@ type DescGetter interface {
 	Desc() string
 }
 
+// StatsGetter 该接口是可选的，组件可以实现该接口，提供运行时计数，例如：每个分支路由的消息数量，
+// 可以通过 RuleEngine.NodeStats 获取
+type StatsGetter interface {
+	Stats() map[string]int64
+}
+
+// ComponentFormFieldsCustomizer 该接口是可选的，组件可以实现该接口，自定义通过反射获取的配置字段，
+// 例如：配置字段是动态的，或者需要补充字段的可选值。与 ComponentDefGetter 不同，不需要重新定义所有字段
+type ComponentFormFieldsCustomizer interface {
+	CustomizeFields(fields ComponentFormFieldList) ComponentFormFieldList
+}
+
 // ComponentFormList 组件表单列表
 type ComponentFormList map[string]ComponentForm
 
@@ -114,6 +126,19 @@ func (c ComponentFormFieldList) GetField(name string) (ComponentFormField, bool)
 	return ComponentFormField{}, false
 }
 
+// DefaultConfiguration 使用字段默认值生成组件配置，嵌套字段生成嵌套的配置
+func (c ComponentFormFieldList) DefaultConfiguration() Configuration {
+	var configuration = make(Configuration)
+	for _, field := range c {
+		if len(field.Fields) > 0 {
+			configuration[field.Name] = field.Fields.DefaultConfiguration()
+		} else if field.DefaultValue != nil {
+			configuration[field.Name] = field.DefaultValue
+		}
+	}
+	return configuration
+}
+
 // ComponentForm 组件表单，用于可视化加载组件表单
 type ComponentForm struct {
 	//Type 组件类型
@@ -169,6 +194,10 @@ type ComponentFormField struct {
 	Component map[string]interface{} `json:"component"`
 	//是否必填，通过tag:required获取
 	Required bool `json:"required"`
+	//Enum 可选值列表，通过tag:enum获取，多个值与`,`隔开
+	Enum []string `json:"enum"`
+	//Secret 是否是敏感字段，例如：密码，界面需要隐藏显示，通过tag:secret获取
+	Secret bool `json:"secret"`
 }
 
 // SafeComponentSlice 安全的组件列表切片
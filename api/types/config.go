@@ -42,6 +42,10 @@ type Config struct {
 	OnEnd func(msg RuleMsg, err error)
 	// ScriptMaxExecutionTime is the maximum execution time for scripts, defaulting to 2000 milliseconds.
 	ScriptMaxExecutionTime time.Duration
+	// ScriptWarmUp indicates whether script nodes run their script once against a synthetic empty message during Init,
+	// so that the first messages after a rule chain (re)load do not pay the VM initialization cost.
+	// Warm-up errors are logged and do not fail the initialization. Scripts with side effects should not enable it.
+	ScriptWarmUp bool
 	// Pool is the interface for a coroutine pool. If not configured, the go func method is used by default.
 	// The default implementation is `pool.WorkerPool`. It is compatible with ants coroutine pool and can be implemented using ants.
 	// Example:
@@ -71,12 +75,52 @@ type Config struct {
 	//True: During the component's Init phase, the client connection is established. If the client initialization fails, the rule chain initialization fails.
 	//False: During the component's OnMsg phase, the client connection is established.
 	NodeClientInitNow bool
+	// NodeClientInitPolicy is the shared resource initialization policy of a node: InitPolicyEager, InitPolicyLazy or InitPolicyBackground.
+	// It is set per node by the rule engine from the node configuration key "initPolicy".
+	// Empty means the policy is derived from NodeClientInitNow.
+	NodeClientInitPolicy string
 	// AllowCycle indicates whether nodes in the rule chain are allowed to form cycles.
 	AllowCycle bool
+	// DocRequiredNodeCount logs a lint warning when a rule chain has more nodes than this value but no documentation.
+	// 0 disables the check.
+	DocRequiredNodeCount int
 	// Cache is a global cache instance shared across all rule chains in the pool, used for storing runtime shared data.
 	Cache Cache
+	// OnDeadLetter is called when the engine aborts a message, such as exceeding the rule chain guardrails.
+	// - ruleChainId: The ID of the rule chain.
+	// - nodeId: The ID of the node that caused the abort.
+	// - msg: The aborted message.
+	// - err: The reason, such as *GuardrailError.
+	OnDeadLetter func(ruleChainId string, nodeId string, msg RuleMsg, err error)
+	// EventBus receives lifecycle events, such as rule chain loaded and endpoint started. If not configured, no events are published.
+	// The default implementation is `engine.NewEventBus()`.
+	EventBus EventBus
+	// HealthRegistry collects the health of shared resources, endpoints and rule chains, served by the rest endpoint /healthz and /readyz.
+	// If not configured, no health is reported. The default implementation is `engine.NewHealthRegistry(policy)`.
+	HealthRegistry HealthRegistry
+	// NodeQueueShutdownPolicy decides what happens to the messages left in node input queues when the rule chain is destroyed:
+	// NodeQueueShutdownDrain (default) processes them before the node is destroyed,
+	// NodeQueueShutdownDeadLetter passes them to OnDeadLetter so that they can be persisted and redelivered.
+	NodeQueueShutdownPolicy string
+	// NodeQueueDrainTimeout is the maximum time to wait for a node input queue to drain on shutdown.
+	// The messages left after the timeout are passed to OnDeadLetter. 0 means no limit.
+	NodeQueueDrainTimeout time.Duration
+	// SpillThreshold is the msg data size in bytes above which the data is spilled to a temp file in SpillDir,
+	// checked when the message enters the rule chain and after each node. 0 disables spilling.
+	// Spilled data is read transparently by RuleMsg.GetData, or streamed by RuleMsg.GetDataReader.
+	// The temp file is deleted when the message's execution completes.
+	SpillThreshold int
+	// SpillDir is the directory of spill files. Empty means os.TempDir().
+	// Spill files left by crashed processes are deleted when the first rule engine using the directory is created.
+	SpillDir string
 }
 
+// Shutdown policies of node input queues, see Config.NodeQueueShutdownPolicy.
+const (
+	NodeQueueShutdownDrain      = "drain"
+	NodeQueueShutdownDeadLetter = "deadLetter"
+)
+
 // RegisterUdf registers a custom function. Function names can be repeated for different script types.
 func (c *Config) RegisterUdf(name string, value interface{}) {
 	if c.Udf == nil {
@@ -48,6 +48,18 @@ const (
 	NodeConfigurationKeySelfDefinition = "$selfDefinition"
 	//NodeConfigurationKeyRuleChainDefinition 获取规则链定义，应用于动态endpoint的初始化。value类型: *RuleChain
 	NodeConfigurationKeyRuleChainDefinition = "$ruleChainDefinition"
+	// NodeConfigurationKeyInitPolicy 节点配置中指定共享资源初始化策略的key，覆盖全局 Config.NodeClientInitNow
+	NodeConfigurationKeyInitPolicy = "initPolicy"
+)
+
+// 共享资源初始化策略，见 Config.NodeClientInitPolicy
+const (
+	// InitPolicyEager 在节点Init阶段初始化资源，初始化失败则规则链加载失败
+	InitPolicyEager = "eager"
+	// InitPolicyLazy 在节点第一次获取资源时初始化
+	InitPolicyLazy = "lazy"
+	// InitPolicyBackground 在后台异步初始化资源，失败按退避间隔重试，资源就绪前获取资源立即失败
+	InitPolicyBackground = "background"
 )
 
 var (
@@ -37,6 +37,9 @@ type RuleChainBaseInfo struct {
 	Root bool `json:"root"`
 	// Disabled indicates whether the rule chain is disabled.
 	Disabled bool `json:"disabled"`
+	// Documentation is the human-readable documentation of the rule chain in markdown, such as purpose, owners,
+	// expected inputs and runbook links. It is preserved verbatim.
+	Documentation string `json:"documentation,omitempty"`
 	// Configuration contains the configuration information of the rule chain.
 	Configuration Configuration `json:"configuration,omitempty"`
 	// AdditionalInfo is an extension field.
@@ -93,6 +96,37 @@ type RuleNode struct {
 	// For example, a JS filter node might have a `jsScript` field defining the filtering logic,
 	// while a REST API call node might have a `restEndpointUrlPattern` field defining the URL to call.
 	Configuration Configuration `json:"configuration"`
+	// QueueSize is the capacity of the optional input queue of the node. If greater than 0, messages told to the node
+	// are buffered in the queue and processed in order by a dedicated worker, decoupling upstream nodes from the node's OnMsg execution.
+	QueueSize int `json:"queueSize,omitempty"`
+	// OverflowPolicy decides what to do when the input queue is full: OverflowPolicyBlock (default), OverflowPolicyDropOldest,
+	// OverflowPolicyDropNew or OverflowPolicyFailure. Only used when QueueSize is greater than 0.
+	OverflowPolicy string `json:"overflowPolicy,omitempty"`
+}
+
+// Overflow policies of the node input queue, see RuleNode.OverflowPolicy.
+const (
+	// OverflowPolicyBlock blocks the upstream node until the queue has space.
+	OverflowPolicyBlock = "block"
+	// OverflowPolicyDropOldest drops the oldest queued message to make room for the new one.
+	// The dropped message is passed to Config.OnDeadLetter and the end callbacks.
+	OverflowPolicyDropOldest = "dropOldest"
+	// OverflowPolicyDropNew drops the new message.
+	// The dropped message is passed to Config.OnDeadLetter and the end callbacks.
+	OverflowPolicyDropNew = "dropNew"
+	// OverflowPolicyFailure routes the new message to the Failure relation of the node.
+	OverflowPolicyFailure = "failure"
+)
+
+// NodeAdditionalInfoKeyDescription is the additionalInfo key of the node description in markdown.
+const NodeAdditionalInfoKeyDescription = "description"
+
+// Description returns the node description in markdown stored in additionalInfo.description.
+func (r RuleNode) Description() string {
+	if v, ok := r.AdditionalInfo[NodeAdditionalInfoKeyDescription].(string); ok {
+		return v
+	}
+	return ""
 }
 
 // NodeAdditionalInfo is used for visualization position information (reserved field).
@@ -167,6 +201,8 @@ type EndpointDsl struct {
 	// Processors is the list of global processors for the endpoint.
 	// Using processors registered in builtin/processor#Builtins xx by name.
 	Processors []string `json:"processors"`
+	// ProcessorDefs is the list of global processors with a condition or an error policy, executed after Processors.
+	ProcessorDefs []ProcessorDsl `json:"processorDefs,omitempty"`
 	// Routers is the list of routers.
 	Routers []*RouterDsl `json:"routers"`
 }
@@ -195,6 +231,23 @@ type FromDsl struct {
 	// Processors is the list of processors for the source.
 	// Using processors registered in builtin/processor#Builtins xx by name.
 	Processors []string `json:"processors"`
+	// ProcessorDefs is the list of processors for the source with a condition or an error policy, executed after Processors.
+	ProcessorDefs []ProcessorDsl `json:"processorDefs,omitempty"`
+}
+
+// ProcessorDsl defines a processor of the endpoint DSL with an optional condition and error policy, such as:
+//
+//	{"name": "auth", "condition": "!(path startsWith '/public/')", "continueOnError": false}
+type ProcessorDsl struct {
+	// Name is the name of the processor registered in builtin/processor#Builtins.
+	Name string `json:"name"`
+	// Condition is an optional expr expression, the processor runs only if it evaluates to true.
+	// Available variables: headers (request headers, first value of each key), metadata (msg metadata),
+	// from (message origin, such as the request URL or MQTT topic) and path (from without the query string).
+	Condition string `json:"condition,omitempty"`
+	// ContinueOnError indicates whether the exchange proceeds when the processor fails (returns false).
+	// By default, a failing processor aborts the exchange.
+	ContinueOnError bool `json:"continueOnError,omitempty"`
 }
 
 // ToDsl defines the destination for an endpoint router.
@@ -209,4 +262,6 @@ type ToDsl struct {
 	// Processors is the list of processors for the destination.
 	// Using processors registered in builtin/processor#Builtins xx by name.
 	Processors []string `json:"processors"`
+	// ProcessorDefs is the list of processors for the destination with a condition or an error policy, executed after Processors.
+	ProcessorDefs []ProcessorDsl `json:"processorDefs,omitempty"`
 }
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// Metadata keys used to inject the authenticated principal into the message metadata.
+const (
+	// PrincipalIdKey is the metadata key of the principal id.
+	PrincipalIdKey = "principalId"
+	// PrincipalTenantKey is the metadata key of the principal tenant.
+	PrincipalTenantKey = "principalTenant"
+	// PrincipalRolesKey is the metadata key of the principal roles, joined by comma.
+	PrincipalRolesKey = "principalRoles"
+)
+
+// Transport metadata keys passed to TokenValidator.Validate.
+const (
+	// TransportKey is the transport type, such as http, ws or mqtt.
+	TransportKey = "transport"
+	// TransportRemoteAddrKey is the remote address of the client.
+	TransportRemoteAddrKey = "remoteAddr"
+	// TransportPathKey is the request path or topic.
+	TransportPathKey = "path"
+	// TransportMethodKey is the request method.
+	TransportMethodKey = "method"
+)
+
+// ErrUnauthorized is returned when the token is missing or invalid.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Principal is the identity resolved from a token.
+type Principal struct {
+	// Id is the unique identifier of the principal, such as the JWT subject.
+	Id string `json:"id"`
+	// Tenant is the tenant the principal belongs to.
+	Tenant string `json:"tenant"`
+	// Roles is the roles granted to the principal.
+	Roles []string `json:"roles"`
+}
+
+// PutToMetadata injects the principal into the message metadata.
+func (p Principal) PutToMetadata(metadata *types.Metadata) {
+	if metadata == nil {
+		return
+	}
+	metadata.PutValue(PrincipalIdKey, p.Id)
+	if p.Tenant != "" {
+		metadata.PutValue(PrincipalTenantKey, p.Tenant)
+	}
+	if len(p.Roles) > 0 {
+		metadata.PutValue(PrincipalRolesKey, strings.Join(p.Roles, ","))
+	}
+}
+
+// TokenValidator validates a token presented by a client and resolves the principal.
+// It is shared by the rest, websocket and MQTT endpoints.
+// transportMeta carries transport information such as remote address and path, see TransportKey.
+type TokenValidator interface {
+	Validate(token string, transportMeta map[string]string) (Principal, error)
+}
+
+// TokenValidatorFunc is an adapter to allow the use of ordinary functions as TokenValidator.
+type TokenValidatorFunc func(token string, transportMeta map[string]string) (Principal, error)
+
+// Validate calls f(token, transportMeta).
+func (f TokenValidatorFunc) Validate(token string, transportMeta map[string]string) (Principal, error) {
+	return f(token, transportMeta)
+}
+
+// TokenValidatorSetter is implemented by endpoints that support token authentication.
+type TokenValidatorSetter interface {
+	SetTokenValidator(validator TokenValidator)
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"sync"
+	"time"
+)
+
+// SessionInfo is the snapshot of a connected session, such as a websocket connection, passed to the broadcast filter.
+type SessionInfo struct {
+	// Id is the session id, the same as the origin connection id.
+	Id string
+	// RemoteAddr is the remote address of the client.
+	RemoteAddr string
+	// Path is the request path the session connected to.
+	Path string
+	// ConnectedAt is the time the session connected.
+	ConnectedAt time.Time
+	// Tags are the server-side tags of the session, such as deviceId set by an interceptor.
+	Tags map[string]string
+}
+
+// Broadcaster is implemented by endpoints that can push a message to their connected sessions.
+type Broadcaster interface {
+	// Broadcast pushes the data as a text message to the sessions accepted by the filter, nil filter accepts all sessions.
+	// It does not wait for slow sessions and returns the number of sessions the data is queued to.
+	Broadcast(data []byte, filter func(SessionInfo) bool) int
+	// BroadcastBinary is the same as Broadcast but pushes the data as a binary message.
+	BroadcastBinary(data []byte, filter func(SessionInfo) bool) int
+}
+
+// broadcasters holds the registered broadcasters, keyed by server id.
+var broadcasters = struct {
+	sync.RWMutex
+	items map[string][]Broadcaster
+}{items: make(map[string][]Broadcaster)}
+
+// RegisterBroadcaster registers the broadcaster with the server id, such as the websocket endpoint server address.
+// More than one broadcaster can be registered with the same server id.
+func RegisterBroadcaster(serverId string, broadcaster Broadcaster) {
+	broadcasters.Lock()
+	defer broadcasters.Unlock()
+	for _, item := range broadcasters.items[serverId] {
+		if item == broadcaster {
+			return
+		}
+	}
+	broadcasters.items[serverId] = append(broadcasters.items[serverId], broadcaster)
+}
+
+// UnregisterBroadcaster removes the broadcaster registered with the server id.
+func UnregisterBroadcaster(serverId string, broadcaster Broadcaster) {
+	broadcasters.Lock()
+	defer broadcasters.Unlock()
+	items := broadcasters.items[serverId]
+	for i, item := range items {
+		if item == broadcaster {
+			items = append(items[:i:i], items[i+1:]...)
+			break
+		}
+	}
+	if len(items) == 0 {
+		delete(broadcasters.items, serverId)
+	} else {
+		broadcasters.items[serverId] = items
+	}
+}
+
+// GetBroadcasters returns the broadcasters registered with the server id.
+func GetBroadcasters(serverId string) []Broadcaster {
+	broadcasters.RLock()
+	defer broadcasters.RUnlock()
+	return append([]Broadcaster(nil), broadcasters.items[serverId]...)
+}
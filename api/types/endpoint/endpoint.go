@@ -36,6 +36,12 @@ const (
 	EventInitServer = "InitServer"
 	// EventCompletedServer represents an event for a completed server.
 	EventCompletedServer = "completedServer"
+	// EventReloadRouters represents a reload that only updates the routers in place, the live connections are kept.
+	// Params: endpoint id, added, removed and modified router ids.
+	EventReloadRouters = "ReloadRouters"
+	// EventReloadRestart represents a reload that restarts the endpoint because its listener-level definition changed.
+	// Params: endpoint id.
+	EventReloadRestart = "ReloadRestart"
 )
 
 // OnEvent is a function type that listens to named events with optional parameters.
@@ -125,6 +131,34 @@ type Exchange struct {
 	// Context provides a context for the exchange.
 	Context context.Context
 	sync.RWMutex
+	// aborted indicates whether the exchange is short-circuited by Abort.
+	aborted bool
+}
+
+// Abort short-circuits the exchange with a response, such as 401 with a JSON error document.
+// It sets the status code (if greater than 0) and the body (if not nil) on the outbound message and returns false,
+// so that an interceptor can `return exchange.Abort(...)` to skip the subsequent interceptors and the router.
+// Endpoints check IsAborted to flush the response instead of treating the exchange as dropped.
+func (e *Exchange) Abort(statusCode int, body []byte) bool {
+	e.Lock()
+	e.aborted = true
+	e.Unlock()
+	if e.Out != nil {
+		if statusCode > 0 {
+			e.Out.SetStatusCode(statusCode)
+		}
+		if body != nil {
+			e.Out.SetBody(body)
+		}
+	}
+	return false
+}
+
+// IsAborted returns whether the exchange is short-circuited by Abort.
+func (e *Exchange) IsAborted() bool {
+	e.RLock()
+	defer e.RUnlock()
+	return e.aborted
 }
 
 // From is an interface representing the source of data in a routing operation.
@@ -202,9 +236,18 @@ type Router interface {
 	GetParams() []interface{}
 	// Err returns the error associated with the router initialization.
 	Err() error
+	// AddInterceptor adds a router-level interceptor, which is executed after the global interceptors.
+	// Interceptors are executed in ascending order, and those with the same order are executed in registration order.
+	// If an interceptor with the same name exists, it will be replaced.
+	AddInterceptor(name string, interceptor Process, order int) Router
+	// RemoveInterceptor removes the router-level interceptor by name, returns false if it does not exist.
+	RemoveInterceptor(name string) bool
+	// Interceptors returns a copy of the router-level interceptors in execution order.
+	Interceptors() []Process
 }
 
 // Process is a function type defining a processing operation in a routing context.
+// Returning false stops the subsequent processing, use Exchange.Abort to respond before stopping.
 type Process func(router Router, exchange *Exchange) bool
 
 // OptionsSetter is an interface for setting various options for routing components.
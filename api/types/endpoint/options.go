@@ -133,3 +133,14 @@ func (d dynamicEndpointOptions) WithRuleChain(ruleChain *types.RuleChain) Dynami
 		return nil
 	}
 }
+
+// WithTokenValidator sets the token validator for the dynamic endpoint.
+// It takes effect if the dynamic endpoint implements TokenValidatorSetter.
+func (d dynamicEndpointOptions) WithTokenValidator(validator TokenValidator) DynamicEndpointOption {
+	return func(re DynamicEndpoint) error {
+		if setter, ok := re.(TokenValidatorSetter); ok {
+			setter.SetTokenValidator(validator)
+		}
+		return nil
+	}
+}
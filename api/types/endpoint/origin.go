@@ -0,0 +1,121 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rulego/rulego/api/types"
+)
+
+// Metadata keys of the message origin stamped by endpoints, used to send a reply back to the origin.
+const (
+	// OriginTypeKey is the type of the endpoint that received the message, such as endpoint/http, endpoint/ws or endpoint/mqtt.
+	OriginTypeKey = "originType"
+	// OriginIdKey is the id of the Replier registered by the endpoint, see RegisterReplier.
+	OriginIdKey = "originId"
+	// OriginConnectionKey is the id of the websocket connection that sent the message.
+	OriginConnectionKey = "originConnection"
+	// OriginReplyTopicKey is the MQTT topic to publish the reply to.
+	OriginReplyTopicKey = "originReplyTopic"
+	// OriginReplyUrlKey is the HTTP callback URL to post the reply to.
+	OriginReplyUrlKey = "originReplyUrl"
+)
+
+// ErrOriginGone is returned when the origin of the message no longer exists,
+// such as a stopped endpoint or a closed websocket connection.
+var ErrOriginGone = errors.New("origin is gone")
+
+// Origin is where a message came from, stamped into the message metadata by endpoints.
+type Origin struct {
+	// Type is the endpoint type.
+	Type string
+	// Id is the origin id of the endpoint replier.
+	Id string
+	// Connection is the websocket connection id.
+	Connection string
+	// ReplyTopic is the MQTT reply topic.
+	ReplyTopic string
+	// ReplyUrl is the HTTP callback URL.
+	ReplyUrl string
+}
+
+// PutToMetadata stamps the origin into the message metadata, empty fields are skipped.
+func (o Origin) PutToMetadata(metadata *types.Metadata) {
+	if metadata == nil {
+		return
+	}
+	for key, value := range map[string]string{
+		OriginTypeKey:       o.Type,
+		OriginIdKey:         o.Id,
+		OriginConnectionKey: o.Connection,
+		OriginReplyTopicKey: o.ReplyTopic,
+		OriginReplyUrlKey:   o.ReplyUrl,
+	} {
+		if value != "" {
+			metadata.PutValue(key, value)
+		}
+	}
+}
+
+// OriginFromMetadata reads the origin stamped by PutToMetadata.
+func OriginFromMetadata(metadata *types.Metadata) Origin {
+	if metadata == nil {
+		return Origin{}
+	}
+	return Origin{
+		Type:       metadata.GetValue(OriginTypeKey),
+		Id:         metadata.GetValue(OriginIdKey),
+		Connection: metadata.GetValue(OriginConnectionKey),
+		ReplyTopic: metadata.GetValue(OriginReplyTopicKey),
+		ReplyUrl:   metadata.GetValue(OriginReplyUrlKey),
+	}
+}
+
+// Replier is implemented by endpoints that can send a message back to its origin.
+// The origin is read from the message metadata stamped by the endpoint.
+type Replier interface {
+	// Reply sends the message data back to the origin of the message.
+	// It returns an error wrapping ErrOriginGone if the origin no longer exists.
+	Reply(msg types.RuleMsg) error
+}
+
+// repliers holds the registered repliers, keyed by origin id.
+var repliers sync.Map
+
+// RegisterReplier registers the replier and returns the origin id that endpoints stamp with OriginIdKey.
+func RegisterReplier(replier Replier) string {
+	id, _ := uuid.NewV4()
+	originId := id.String()
+	repliers.Store(originId, replier)
+	return originId
+}
+
+// UnregisterReplier removes the replier, the messages of the origin can no longer be replied.
+func UnregisterReplier(originId string) {
+	repliers.Delete(originId)
+}
+
+// GetReplier returns the replier registered with the origin id.
+func GetReplier(originId string) (Replier, bool) {
+	if v, ok := repliers.Load(originId); ok {
+		return v.(Replier), true
+	}
+	return nil, false
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStreamClosed is returned when writing to a closed stream.
+var ErrStreamClosed = errors.New("stream is closed")
+
+// Streamer streams the response incrementally to the caller, such as the rest endpoint ResponseMessage.
+// Once a chunk is written, the endpoint keeps the request open until Close is called or the request context is cancelled.
+type Streamer interface {
+	// WriteChunk writes and flushes a chunk of the response body.
+	WriteChunk(chunk []byte) error
+	// SetSSE writes and flushes a Server-Sent Event, the event name is omitted if it is empty.
+	SetSSE(event, data string) error
+	// Close ends the stream.
+	Close()
+}
+
+type streamerKey struct{}
+
+// WithStreamer returns a context carrying the streamer of the response, used by the endpoints.
+func WithStreamer(ctx context.Context, streamer Streamer) context.Context {
+	return context.WithValue(ctx, streamerKey{}, streamer)
+}
+
+// StreamerFromContext returns the streamer of the response the message came from,
+// used by the nodes that push incremental results back to the caller:
+//
+//	if streamer, ok := endpoint.StreamerFromContext(ctx.GetContext()); ok {
+//		_ = streamer.SetSSE("token", token)
+//	}
+func StreamerFromContext(ctx context.Context) (Streamer, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	streamer, ok := ctx.Value(streamerKey{}).(Streamer)
+	return streamer, ok
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import "time"
+
+// Lifecycle event types published to Config.EventBus.
+const (
+	// EventChainLoaded a rule chain is created. Subject is the rule chain ID.
+	EventChainLoaded = "chain.loaded"
+	// EventChainReloaded a rule chain or one of its nodes is reloaded. Subject is the rule chain ID, data contains nodeId.
+	EventChainReloaded = "chain.reloaded"
+	// EventChainRemoved a rule chain is stopped, such as deleted from the pool. Subject is the rule chain ID.
+	EventChainRemoved = "chain.removed"
+	// EventEndpointStarted an endpoint is started. Subject is the endpoint ID, data contains type.
+	EventEndpointStarted = "endpoint.started"
+	// EventEndpointStopped an endpoint is stopped. Subject is the endpoint ID, data contains type.
+	EventEndpointStopped = "endpoint.stopped"
+	// EventEndpointReloaded an endpoint definition is reloaded. Subject is the endpoint ID,
+	// data contains type, restart (whether the listener is restarted) and the added, removed and modified router ids.
+	EventEndpointReloaded = "endpoint.reloaded"
+	// EventEndpointFrameTooLarge an endpoint receives a frame larger than its max frame size and closes the connection.
+	// Subject is the endpoint ID, data contains type, remoteAddr and error.
+	EventEndpointFrameTooLarge = "endpoint.frameTooLarge"
+	// EventResourceUnhealthy a shared resource, such as a client connection, becomes unavailable.
+	// Subject is the resource address, data contains type and error.
+	EventResourceUnhealthy = "resource.unhealthy"
+	// EventResourceRecovered a shared resource becomes available again. Subject is the resource address, data contains type.
+	EventResourceRecovered = "resource.recovered"
+	// EventBulkProgress a rule chain of a bulk job is processed. Subject is the job ID,
+	// data contains op, chainId, result, error and the done, failed, skipped and total counts.
+	EventBulkProgress = "bulk.progress"
+	// EventBulkCompleted a bulk job is completed. Subject is the job ID, data contains op, aborted and the counts.
+	EventBulkCompleted = "bulk.completed"
+	// EventMsgStuck a message exceeds the maxProcessingTime of the rule chain. Subject is the rule chain ID,
+	// data contains msgId, nodeId (the last node reached), elapsed and maxProcessingTime in milliseconds, and action.
+	EventMsgStuck = "msg.stuck"
+)
+
+// DefaultEventBufferSize is the default buffer size of an event subscription.
+const DefaultEventBufferSize = 128
+
+// Event is a lifecycle notification.
+type Event struct {
+	// Type is the event type, such as chain.loaded
+	Type string `json:"type"`
+	// Subject is the ID of the object the event is about, such as the rule chain ID.
+	// Events of the same subject are delivered to each subscriber in publication order.
+	Subject string `json:"subject"`
+	// Ts is the event timestamp in milliseconds
+	Ts int64 `json:"ts"`
+	// Data is the event details
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// NewEvent creates an event with the current timestamp.
+func NewEvent(eventType, subject string, data map[string]interface{}) Event {
+	return Event{Type: eventType, Subject: subject, Ts: time.Now().UnixMilli(), Data: data}
+}
+
+// EventBus publishes lifecycle events to subscribers.
+// Publish never blocks: each subscription has a bounded buffer, events are dropped for a subscriber whose buffer is full.
+type EventBus interface {
+	// Publish publishes an event to all subscriptions whose pattern matches the event type.
+	Publish(event Event)
+	// Subscribe subscribes to events whose type matches pattern and returns the subscription,
+	// read events from EventSubscription.C. The pattern syntax is path.Match, such as "*", "chain.*" or "chain.loaded".
+	// bufferSize<=0 means DefaultEventBufferSize.
+	Subscribe(pattern string, bufferSize int) (EventSubscription, error)
+	// SubscribeFunc subscribes to events whose type matches pattern, handler is called sequentially in a dedicated goroutine.
+	SubscribeFunc(pattern string, bufferSize int, handler func(event Event)) (EventSubscription, error)
+}
+
+// EventSubscription is a subscription of EventBus.
+type EventSubscription interface {
+	// C returns the event channel, it is closed after Unsubscribe.
+	C() <-chan Event
+	// Dropped returns the number of events dropped because the buffer was full.
+	Dropped() int64
+	// Unsubscribe cancels the subscription.
+	Unsubscribe()
+}
+
+// PublishEvent publishes an event to the EventBus, does nothing if the EventBus is not configured.
+func (c Config) PublishEvent(eventType, subject string, data map[string]interface{}) {
+	if c.EventBus != nil {
+		c.EventBus.Publish(NewEvent(eventType, subject, data))
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Rule chain configuration keys of the execution guardrails.
+// Guardrails are checked after each node completes, 0 or absent means no limit.
+//
+// Example:
+//
+//	"ruleChain": {
+//	  "id": "rule01",
+//	  "configuration": {
+//	    "maxMsgBytes": 1048576,
+//	    "maxMetadataEntries": 100,
+//	    "maxMetadataBytes": 65536
+//	  }
+//	}
+const (
+	// MaxMsgBytesKey is the maximum length of msg data.
+	MaxMsgBytesKey = "maxMsgBytes"
+	// MaxMetadataEntriesKey is the maximum number of metadata entries.
+	MaxMetadataEntriesKey = "maxMetadataEntries"
+	// MaxMetadataBytesKey is the maximum total length of metadata keys and values.
+	MaxMetadataBytesKey = "maxMetadataBytes"
+)
+
+// Metadata keys added to the OnDebug msg when guardrails are enabled.
+const (
+	// DebugMsgBytesKey is the current length of msg data.
+	DebugMsgBytesKey = "_msgBytes"
+	// DebugMetadataEntriesKey is the current number of metadata entries.
+	DebugMetadataEntriesKey = "_metadataEntries"
+	// DebugMetadataBytesKey is the current total length of metadata.
+	DebugMetadataBytesKey = "_metadataBytes"
+)
+
+// ErrGuardrailExceeded is the sentinel error wrapped by GuardrailError, use errors.Is to check it.
+var ErrGuardrailExceeded = errors.New("guardrail exceeded")
+
+// GuardrailError is returned when a message exceeds a guardrail of the rule chain.
+// The message is aborted and passed to Config.OnDeadLetter and the end callbacks.
+type GuardrailError struct {
+	// RuleChainId is the id of the rule chain.
+	RuleChainId string
+	// NodeId is the id of the node whose output exceeded the limit.
+	NodeId string
+	// Limit is the exceeded guardrail key, such as MaxMsgBytesKey.
+	Limit string
+	// Actual is the actual size.
+	Actual int
+	// Max is the configured limit.
+	Max int
+}
+
+func (e *GuardrailError) Error() string {
+	return fmt.Sprintf("%s: chain=%s node=%s %s=%d actual=%d", ErrGuardrailExceeded.Error(), e.RuleChainId, e.NodeId, e.Limit, e.Max, e.Actual)
+}
+
+// Unwrap returns ErrGuardrailExceeded.
+func (e *GuardrailError) Unwrap() error {
+	return ErrGuardrailExceeded
+}
+
+// Guardrails defines the execution limits of a rule chain.
+type Guardrails struct {
+	// MaxMsgBytes is the maximum length of msg data, 0 means no limit.
+	MaxMsgBytes int
+	// MaxMetadataEntries is the maximum number of metadata entries, 0 means no limit.
+	MaxMetadataEntries int
+	// MaxMetadataBytes is the maximum total length of metadata keys and values, 0 means no limit.
+	MaxMetadataBytes int
+}
+
+// Enabled returns whether any limit is configured.
+func (g Guardrails) Enabled() bool {
+	return g.MaxMsgBytes > 0 || g.MaxMetadataEntries > 0 || g.MaxMetadataBytes > 0
+}
+
+// Check checks the msg against the limits and returns a *GuardrailError if any limit is exceeded.
+// The sizes are tracked incrementally, so the check is O(1).
+func (g Guardrails) Check(ruleChainId, nodeId string, msg RuleMsg) error {
+	if g.MaxMsgBytes > 0 {
+		if size := msg.GetDataSize(); size > g.MaxMsgBytes {
+			return &GuardrailError{RuleChainId: ruleChainId, NodeId: nodeId, Limit: MaxMsgBytesKey, Actual: size, Max: g.MaxMsgBytes}
+		}
+	}
+	if msg.Metadata == nil {
+		return nil
+	}
+	if g.MaxMetadataEntries > 0 {
+		if size := msg.Metadata.Len(); size > g.MaxMetadataEntries {
+			return &GuardrailError{RuleChainId: ruleChainId, NodeId: nodeId, Limit: MaxMetadataEntriesKey, Actual: size, Max: g.MaxMetadataEntries}
+		}
+	}
+	if g.MaxMetadataBytes > 0 {
+		if size := msg.Metadata.Bytes(); size > g.MaxMetadataBytes {
+			return &GuardrailError{RuleChainId: ruleChainId, NodeId: nodeId, Limit: MaxMetadataBytesKey, Actual: size, Max: g.MaxMetadataBytes}
+		}
+	}
+	return nil
+}
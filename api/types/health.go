@@ -0,0 +1,114 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import "time"
+
+// HealthStatus is the health status of a component.
+type HealthStatus string
+
+const (
+	// HealthHealthy the component is usable.
+	HealthHealthy HealthStatus = "healthy"
+	// HealthDegraded the component is usable with reduced capability, it does not affect readiness.
+	HealthDegraded HealthStatus = "degraded"
+	// HealthUnhealthy the component is not usable.
+	HealthUnhealthy HealthStatus = "unhealthy"
+)
+
+// Name prefixes of the health checks reported by the engine, endpoints and shared resources.
+const (
+	// HealthResourcePrefix shared resources, such as client connections. The name is the prefix followed by the resource address.
+	HealthResourcePrefix = "resource:"
+	// HealthEndpointPrefix endpoints. The name is the prefix followed by the endpoint ID.
+	HealthEndpointPrefix = "endpoint:"
+	// HealthChainPrefix rule chains, a disabled rule chain is unhealthy. The name is the prefix followed by the rule chain ID.
+	HealthChainPrefix = "chain:"
+)
+
+// HealthChecker checks the health of a component when the health is queried, returns the status and the reason.
+type HealthChecker func() (HealthStatus, string)
+
+// HealthCheck is the health of a component.
+type HealthCheck struct {
+	// Name is the component name, such as resource:tcp://127.0.0.1:1883
+	Name string `json:"name"`
+	// Status is the health status
+	Status HealthStatus `json:"status"`
+	// Reason is the reason of a degraded or unhealthy status
+	Reason string `json:"reason,omitempty"`
+	// CheckedAt is the last time the status was reported or checked
+	CheckedAt time.Time `json:"checkedAt"`
+	// Required indicates whether the component affects readiness, see HealthPolicy
+	Required bool `json:"required"`
+}
+
+// HealthReport is the aggregated health of all components.
+type HealthReport struct {
+	// Status is healthy if all components are healthy, unhealthy if not ready, otherwise degraded.
+	Status HealthStatus `json:"status"`
+	// Live is false if a liveness component is unhealthy, the process should be restarted.
+	Live bool `json:"live"`
+	// Ready is false if a required component is unhealthy, the process should not receive traffic.
+	Ready bool `json:"ready"`
+	// Checks are the health of all components, sorted by name
+	Checks []HealthCheck `json:"checks"`
+}
+
+// HealthPolicy decides how the health of components is aggregated.
+// A pattern ending with * matches the names with its prefix, such as "chain:*" or "resource:tcp://*",
+// other patterns use the path.Match syntax.
+type HealthPolicy struct {
+	// Optional are the components that do not affect readiness, they only degrade the status. Other components are required.
+	Optional []string `json:"optional"`
+	// Liveness are the components whose unhealthy status fails liveness. Empty means liveness is always true.
+	Liveness []string `json:"liveness"`
+}
+
+// HealthRegistry collects the health of shared resources, endpoints and rule chains.
+// The default implementation is `engine.NewHealthRegistry(policy)`.
+type HealthRegistry interface {
+	// Report reports the health status of a component.
+	Report(name string, status HealthStatus, reason string)
+	// Register registers a checker called each time the health is queried, it replaces the reported status of the component.
+	Register(name string, checker HealthChecker)
+	// Remove removes a component, such as when the resource is released.
+	Remove(name string)
+	// Health returns the aggregated health.
+	Health() HealthReport
+}
+
+// ReportHealth reports the health status of a component to the HealthRegistry, does nothing if the HealthRegistry is not configured.
+func (c Config) ReportHealth(name string, status HealthStatus, reason string) {
+	if c.HealthRegistry != nil {
+		c.HealthRegistry.Report(name, status, reason)
+	}
+}
+
+// RegisterHealth registers a health checker to the HealthRegistry, does nothing if the HealthRegistry is not configured.
+func (c Config) RegisterHealth(name string, checker HealthChecker) {
+	if c.HealthRegistry != nil {
+		c.HealthRegistry.Register(name, checker)
+	}
+}
+
+// RemoveHealth removes a component from the HealthRegistry, does nothing if the HealthRegistry is not configured.
+func (c Config) RemoveHealth(name string) {
+	if c.HealthRegistry != nil {
+		c.HealthRegistry.Remove(name)
+	}
+}
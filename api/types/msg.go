@@ -17,11 +17,15 @@
 package types
 
 import (
-	"encoding/json"
+	"errors"
+	"io"
+	"strings"
 	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/gofrs/uuid/v5"
+	"github.com/rulego/rulego/utils/json"
 )
 
 // DataType defines the type of data contained in a message.
@@ -38,6 +42,8 @@ const (
 const (
 	IdKey       = "id"       // Key for the message id.
 	TsKey       = "ts"       // Key for the message ts.
+	EventTsKey  = "eventTs"  // Key for the message event time.
+	IngestTsKey = "ingestTs" // Key for the message ingest time.
 	DataKey     = "data"     // Key for the message content.
 	MsgKey      = "msg"      // Key for the message content object.
 	MetadataKey = "metadata" // Key for the message metadata.
@@ -46,6 +52,28 @@ const (
 	DataTypeKey = "dataType" // Key for the data type of the message.
 )
 
+// Timestamp sources that nodes can select with RuleMsg.GetTsBy.
+const (
+	// TsSourceIngest selects the time the message entered the rule engine.
+	TsSourceIngest = "ingest"
+	// TsSourceEvent selects the time the event happened, as reported by the device.
+	TsSourceEvent = "event"
+)
+
+// MetadataKeyEventTsFallback is set when the event time could not be extracted or was rejected
+// and the ingest time is used instead. The value is the reason, see EventTsFallbackMissing.
+const MetadataKeyEventTsFallback = "eventTsFallback"
+
+// Reasons for MetadataKeyEventTsFallback.
+const (
+	// EventTsFallbackMissing means the message has no event time.
+	EventTsFallbackMissing = "missing"
+	// EventTsFallbackInvalid means the event time could not be parsed.
+	EventTsFallbackInvalid = "invalid"
+	// EventTsFallbackSkewed means the event time is too far from the ingest time.
+	EventTsFallbackSkewed = "skewed"
+)
+
 // Properties is a simple map type for storing key-value pairs as metadata.
 // It provides basic operations for metadata management without Copy-on-Write optimization.
 // This type is suitable for scenarios where performance is not critical or when
@@ -115,6 +143,8 @@ type Metadata struct {
 	data map[string]string
 	// shared indicates if this metadata is shared with other instances
 	shared bool
+	// bytes is the total length of all keys and values, tracked incrementally on modification
+	bytes int
 	// mu protects the shared flag and data during copy operations
 	mu sync.RWMutex
 }
@@ -140,6 +170,7 @@ func BuildMetadata(data map[string]string) *Metadata {
 	return &Metadata{
 		data:   metadata,
 		shared: false,
+		bytes:  mapBytes(metadata),
 	}
 }
 
@@ -164,6 +195,7 @@ func (md *Metadata) Copy() *Metadata {
 	return &Metadata{
 		data:   md.data,
 		shared: true,
+		bytes:  md.bytes,
 		// mu is automatically initialized as zero value (ready to use)
 	}
 }
@@ -172,7 +204,11 @@ func (md *Metadata) Copy() *Metadata {
 func (md *Metadata) ensureUnique() {
 	md.mu.Lock()
 	defer md.mu.Unlock()
+	md.ensureUniqueLocked()
+}
 
+// ensureUniqueLocked is the same as ensureUnique, the caller must hold the write lock.
+func (md *Metadata) ensureUniqueLocked() {
 	if md.shared {
 		// Create a new copy of the data
 		newData := make(map[string]string, len(md.data))
@@ -207,6 +243,7 @@ func (md *Metadata) UnmarshalJSON(data []byte) error {
 	}
 
 	md.data = m
+	md.bytes = mapBytes(m)
 	return nil
 }
 
@@ -236,16 +273,13 @@ func (md *Metadata) PutValue(key, value string) {
 	defer md.mu.Unlock()
 
 	// Ensure unique copy within the same lock
-	if md.shared {
-		// Create a new copy of the data
-		newData := make(map[string]string, len(md.data))
-		for k, v := range md.data {
-			newData[k] = v
-		}
-		md.data = newData
-		md.shared = false
-	}
+	md.ensureUniqueLocked()
 
+	if old, ok := md.data[key]; ok {
+		md.bytes += len(value) - len(old)
+	} else {
+		md.bytes += len(key) + len(value)
+	}
 	md.data[key] = value
 }
 
@@ -277,6 +311,7 @@ func (md *Metadata) ReplaceAll(newData map[string]string) {
 	for k, v := range newData {
 		md.data[k] = v
 	}
+	md.bytes = mapBytes(md.data)
 }
 
 // Clear clears all metadata.
@@ -292,6 +327,7 @@ func (md *Metadata) Clear() {
 
 	// Create new empty data map
 	md.data = make(map[string]string)
+	md.bytes = 0
 }
 
 // Len returns the number of key-value pairs in the metadata.
@@ -301,6 +337,144 @@ func (md *Metadata) Len() int {
 	return len(md.data)
 }
 
+// Bytes returns the total length of all keys and values in the metadata.
+// The size is tracked incrementally, so the call is O(1).
+func (md *Metadata) Bytes() int {
+	md.mu.RLock()
+	defer md.mu.RUnlock()
+	return md.bytes
+}
+
+// Delete removes the key from the metadata.
+func (md *Metadata) Delete(key string) {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	old, ok := md.data[key]
+	if !ok {
+		return
+	}
+	md.ensureUniqueLocked()
+	delete(md.data, key)
+	md.bytes -= len(key) + len(old)
+}
+
+// DeletePrefix removes all keys under the namespace and returns the number of removed keys.
+// See Sub for the namespace format.
+func (md *Metadata) DeletePrefix(namespace string) int {
+	prefix := MetadataNamespacePrefix(namespace)
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	var keys []string
+	for k := range md.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return 0
+	}
+	md.ensureUniqueLocked()
+	for _, k := range keys {
+		md.bytes -= len(k) + len(md.data[k])
+		delete(md.data, k)
+	}
+	return len(keys)
+}
+
+// ValuesWithPrefix returns a copy of all key-value pairs under the namespace, with the namespace prefix stripped from the keys.
+// See Sub for the namespace format.
+func (md *Metadata) ValuesWithPrefix(namespace string) map[string]string {
+	prefix := MetadataNamespacePrefix(namespace)
+	md.mu.RLock()
+	defer md.mu.RUnlock()
+	result := make(map[string]string)
+	for k, v := range md.data {
+		if strings.HasPrefix(k, prefix) {
+			result[k[len(prefix):]] = v
+		}
+	}
+	return result
+}
+
+// Sub returns a namespaced view of the metadata whose keys are automatically prefixed with the namespace
+// and MetadataNamespaceSeparator, e.g. Sub("respHeader").PutValue("Location", v) stores the key "respHeader.Location".
+// The view writes through to the metadata, so it follows the copy-on-write semantics of the metadata.
+// Templates can read namespaced keys as nested paths, such as ${metadata.respHeader.Location}.
+func (md *Metadata) Sub(namespace string) *MetadataView {
+	return &MetadataView{metadata: md, prefix: MetadataNamespacePrefix(namespace)}
+}
+
+// MetadataNamespaceSeparator separates the namespace and the key of namespaced metadata keys.
+const MetadataNamespaceSeparator = "."
+
+// MetadataNamespacePrefix returns the key prefix of the namespace, e.g. "respHeader" -> "respHeader.".
+// The namespace is returned as is if it is empty or already ends with MetadataNamespaceSeparator.
+func MetadataNamespacePrefix(namespace string) string {
+	if namespace == "" || strings.HasSuffix(namespace, MetadataNamespaceSeparator) {
+		return namespace
+	}
+	return namespace + MetadataNamespaceSeparator
+}
+
+// MetadataView is a namespaced view of Metadata created by Metadata.Sub.
+// All keys are relative to the namespace.
+type MetadataView struct {
+	metadata *Metadata
+	prefix   string
+}
+
+// Prefix returns the key prefix of the view, including the trailing separator.
+func (v *MetadataView) Prefix() string {
+	return v.prefix
+}
+
+// Has checks if the key exists in the namespace.
+func (v *MetadataView) Has(key string) bool {
+	return v.metadata.Has(v.prefix + key)
+}
+
+// GetValue retrieves the value of the key in the namespace.
+func (v *MetadataView) GetValue(key string) string {
+	return v.metadata.GetValue(v.prefix + key)
+}
+
+// PutValue sets the value of the key in the namespace.
+func (v *MetadataView) PutValue(key, value string) {
+	if key == "" {
+		return
+	}
+	v.metadata.PutValue(v.prefix+key, value)
+}
+
+// Delete removes the key from the namespace.
+func (v *MetadataView) Delete(key string) {
+	v.metadata.Delete(v.prefix + key)
+}
+
+// Values returns a copy of all key-value pairs in the namespace, with the namespace prefix stripped.
+func (v *MetadataView) Values() map[string]string {
+	return v.metadata.ValuesWithPrefix(v.prefix)
+}
+
+// Clear removes all keys in the namespace and returns the number of removed keys.
+func (v *MetadataView) Clear() int {
+	return v.metadata.DeletePrefix(v.prefix)
+}
+
+// Sub returns a nested namespaced view, e.g. Sub("a").Sub("b") stores keys as "a.b.key".
+func (v *MetadataView) Sub(namespace string) *MetadataView {
+	return &MetadataView{metadata: v.metadata, prefix: v.prefix + MetadataNamespacePrefix(namespace)}
+}
+
+// mapBytes returns the total length of all keys and values in the map.
+func mapBytes(data map[string]string) int {
+	size := 0
+	for k, v := range data {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
 // RuleMsg represents a message within the rule engine system.
 // It encapsulates all the information needed for message processing, including
 // the message content, metadata, type information, and timing details.
@@ -308,8 +482,14 @@ func (md *Metadata) Len() int {
 type RuleMsg struct {
 	// Ts is the message timestamp in milliseconds since Unix epoch.
 	// This field is automatically set when creating a new message if not provided.
+	// It is the ingest time of the message, see GetIngestTs.
 	Ts int64 `json:"ts"`
 
+	// EventTs is the time the event happened in milliseconds since Unix epoch,
+	// usually reported by the device and extracted by the endpoint.
+	// 0 means unknown, in which case GetEventTs returns the ingest time.
+	EventTs int64 `json:"eventTs,omitempty"`
+
 	// Id is the unique identifier for the message as it flows through the rule engine.
 	// Each message gets a UUID when created, ensuring uniqueness across the system.
 	Id string `json:"id"`
@@ -332,9 +512,6 @@ type RuleMsg struct {
 	// Metadata contains additional key-value pairs associated with the message.
 	// This field uses Copy-on-Write optimization for better performance in multi-node scenarios.
 	Metadata *Metadata `json:"metadata"`
-
-	// parsedData caches the parsed JSON data to avoid repeated unmarshaling
-	parsedData map[string]interface{} `json:"-"`
 }
 
 // NewMsg creates a new message instance and generates a message ID using UUID.
@@ -343,6 +520,21 @@ func NewMsg(ts int64, msgType string, dataType DataType, metaData *Metadata, dat
 	return newMsg(uuId.String(), ts, msgType, dataType, metaData, data)
 }
 
+// NewMsgFromBytes creates a new message with the data bytes without copying them, such as binary payloads.
+// The caller must not modify data after the call, otherwise the message data changes too.
+func NewMsgFromBytes(ts int64, msgType string, dataType DataType, metaData *Metadata, data []byte) RuleMsg {
+	uuId, _ := uuid.NewV4()
+	return newMsg(uuId.String(), ts, msgType, dataType, metaData, bytesToString(data))
+}
+
+// bytesToString converts bytes to string without copying, the bytes must not be modified afterwards.
+func bytesToString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return *(*string)(unsafe.Pointer(&b))
+}
+
 func NewMsgWithJsonData(data string) RuleMsg {
 	uuId, _ := uuid.NewV4()
 	return newMsg(uuId.String(), 0, "", JSON, NewMetadata(), data)
@@ -388,10 +580,6 @@ func (m *RuleMsg) SetData(data string) {
 	} else {
 		m.Data.Set(data)
 	}
-	// Always set the callback to ensure it points to the correct message instance
-	m.Data.onDataChanged = func() {
-		m.parsedData = nil
-	}
 }
 
 // GetData returns the message data.
@@ -402,38 +590,115 @@ func (m *RuleMsg) GetData() string {
 	return m.Data.Get()
 }
 
+// GetDataE returns the message data and the error of reading spilled data, see SharedData.GetE.
+func (m *RuleMsg) GetDataE() (string, error) {
+	if m.Data == nil {
+		return "", nil
+	}
+	return m.Data.GetE()
+}
+
+// GetBytes returns the message data as bytes. Spilled data is read from the spill file.
+func (m *RuleMsg) GetBytes() []byte {
+	return []byte(m.GetData())
+}
+
+// GetDataSize returns the length of the message data in bytes, without reading spilled data.
+func (m *RuleMsg) GetDataSize() int {
+	if m.Data == nil {
+		return 0
+	}
+	return m.Data.Size()
+}
+
+// GetDataReader returns a reader of the message data. Spilled data is streamed from the spill file
+// instead of being loaded into memory, components that can stream should prefer it to GetData.
+func (m *RuleMsg) GetDataReader() (io.ReadCloser, error) {
+	if m.Data == nil {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	return m.Data.Reader()
+}
+
+// IsSpilled returns true if the message data is spilled to disk, see Config.SpillThreshold.
+func (m *RuleMsg) IsSpilled() bool {
+	return m.Data != nil && m.Data.SpillFile() != nil
+}
+
 // GetDataAsJson returns the message data parsed as JSON with caching.
 // If the data has already been parsed, returns cached result.
+// The cache is kept in Data, so it is shared by all values of the same message
+// and dropped when the data is replaced by SetData.
 // If the data is not valid JSON, it returns an error.
 func (m *RuleMsg) GetDataAsJson() (map[string]interface{}, error) {
-	data := m.GetData()
-	if data == "" {
+	if m.Data == nil {
 		return make(map[string]interface{}), nil
 	}
+	return m.Data.getJson()
+}
 
-	// Check if we have cached data
-	if m.parsedData != nil {
-		return m.parsedData, nil
+// GetDataPath returns the value at path in the JSON data and whether it exists.
+// path is a dotted path such as "a.b[0]" or a RFC 6901 JSON pointer such as "/a/b/0", see json.Path.
+func (m *RuleMsg) GetDataPath(path string) (interface{}, bool) {
+	p, err := json.CompilePath(path)
+	if err != nil {
+		return nil, false
 	}
-
-	// Parse the JSON data
-	var result map[string]interface{}
-	err := json.Unmarshal([]byte(data), &result)
+	data, err := m.GetDataAsJson()
 	if err != nil {
-		return nil, err
+		return nil, false
 	}
+	return p.Get(data)
+}
 
-	// Cache the parsed data
-	m.parsedData = result
+// SetDataPath sets the value at path in the JSON data, creating missing intermediate objects and arrays.
+// "items[-]" or "/items/-" appends to the array.
+// The data is not serialized until it is read as a string, so several SetDataPath calls cost one serialization.
+func (m *RuleMsg) SetDataPath(path string, value interface{}) error {
+	p, err := json.CompilePath(path)
+	if err != nil {
+		return err
+	}
+	//提前检查是否可以序列化，防止读取时才失败
+	if _, err := json.Marshal(value); err != nil {
+		return err
+	}
+	return m.updateJson(func(data map[string]interface{}) (interface{}, error) {
+		return p.Set(data, value)
+	})
+}
 
-	// Set callback to clear cache when data changes (if not already set)
-	if m.Data != nil && m.Data.onDataChanged == nil {
-		m.Data.onDataChanged = func() {
-			m.parsedData = nil
-		}
+// DeleteDataPath removes the value at path in the JSON data.
+// Deleting a path that does not exist is not an error.
+func (m *RuleMsg) DeleteDataPath(path string) error {
+	p, err := json.CompilePath(path)
+	if err != nil {
+		return err
 	}
+	return m.updateJson(func(data map[string]interface{}) (interface{}, error) {
+		return p.Delete(data)
+	})
+}
 
-	return result, nil
+// updateJson modifies the parsed JSON data in place and marks the string form as stale.
+func (m *RuleMsg) updateJson(update func(data map[string]interface{}) (interface{}, error)) error {
+	if m.Data == nil {
+		m.Data = NewSharedData("")
+	}
+	data, err := m.Data.getJson()
+	if err != nil {
+		return err
+	}
+	root, err := update(data)
+	if err != nil {
+		return err
+	}
+	result, ok := root.(map[string]interface{})
+	if !ok {
+		return errors.New("data root must be a JSON object")
+	}
+	m.Data.setJson(result)
+	return nil
 }
 
 // Copy creates a deep copy of the message.
@@ -457,6 +722,7 @@ func (m *RuleMsg) Copy() RuleMsg {
 
 	copiedMsg := RuleMsg{
 		Ts:       m.Ts,
+		EventTs:  m.EventTs,
 		Id:       m.Id,
 		Type:     m.Type,
 		DataType: m.DataType,
@@ -480,6 +746,38 @@ func (m *RuleMsg) SetTs(ts int64) {
 	m.Ts = ts
 }
 
+// GetIngestTs returns the time the message entered the rule engine. It is an alias of Ts.
+func (m *RuleMsg) GetIngestTs() int64 {
+	return m.Ts
+}
+
+// SetIngestTs sets the time the message entered the rule engine. It is an alias of SetTs.
+func (m *RuleMsg) SetIngestTs(ts int64) {
+	m.Ts = ts
+}
+
+// GetEventTs returns the time the event happened, or the ingest time if it is unknown.
+func (m *RuleMsg) GetEventTs() int64 {
+	if m.EventTs > 0 {
+		return m.EventTs
+	}
+	return m.Ts
+}
+
+// SetEventTs sets the time the event happened.
+func (m *RuleMsg) SetEventTs(ts int64) {
+	m.EventTs = ts
+}
+
+// GetTsBy returns the timestamp selected by source, TsSourceEvent or TsSourceIngest.
+// An empty or unknown source selects the ingest time.
+func (m *RuleMsg) GetTsBy(source string) int64 {
+	if source == TsSourceEvent {
+		return m.GetEventTs()
+	}
+	return m.Ts
+}
+
 // GetId returns the unique identifier of the message.
 func (m *RuleMsg) GetId() string {
 	return m.Id
@@ -545,12 +843,19 @@ type WrapperMsg struct {
 // SharedData represents a copy-on-write string data structure for message payload.
 // This optimization allows multiple message copies to share the same underlying data
 // until one of them needs to modify it, reducing memory usage and improving performance.
+//
+// SharedData also caches the data parsed as a JSON object. Changes made through
+// RuleMsg.SetDataPath are applied to the cache and serialized lazily on the next Get.
 type SharedData struct {
 	data   string
 	shared bool
 	mu     sync.RWMutex
-	// onDataChanged callback to notify when data changes
-	onDataChanged func()
+	// parsed caches the data parsed as a JSON object
+	parsed map[string]interface{}
+	// dirty means parsed has been modified and data is stale
+	dirty bool
+	// spill holds the data spilled to disk, data is empty if set
+	spill *SpillFile
 }
 
 // NewSharedData creates a new SharedData instance.
@@ -565,32 +870,52 @@ func NewSharedData(data string) *SharedData {
 func (sd *SharedData) Copy() *SharedData {
 	sd.mu.Lock()
 	defer sd.mu.Unlock()
+	sd.serializeLocked()
 
 	// Mark current instance as shared
 	sd.shared = true
 
-	// Return a new instance that shares the same data initially
+	// Return a new instance that shares the same data initially.
+	// The parsed cache is mutable, so it is not shared.
 	return &SharedData{
 		data:   sd.data,
+		spill:  sd.spill,
 		shared: true,
 		// mu is automatically initialized as zero value (ready to use)
-		// onDataChanged will be set by the new owner
 	}
 }
 
-// Get returns the data value.
+// Get returns the data value. Spilled data is read from the spill file,
+// it returns an empty string if the spill file cannot be read, use GetE to get the error.
 func (sd *SharedData) Get() string {
+	data, _ := sd.GetE()
+	return data
+}
+
+// GetE returns the data value. Spilled data is read from the spill file, and the read error is returned,
+// for example if the spill file has been deleted because the data is used after the message execution completed.
+func (sd *SharedData) GetE() (string, error) {
 	sd.mu.RLock()
-	defer sd.mu.RUnlock()
-	return sd.data
+	if sd.spill != nil {
+		spill := sd.spill
+		sd.mu.RUnlock()
+		return spill.read()
+	}
+	if !sd.dirty {
+		defer sd.mu.RUnlock()
+		return sd.data, nil
+	}
+	sd.mu.RUnlock()
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.serializeLocked()
+	return sd.data, nil
 }
 
 // String implements the fmt.Stringer interface for SharedData.
 // This allows SharedData to be used directly as a string in contexts where string conversion is needed.
 func (sd *SharedData) String() string {
-	sd.mu.RLock()
-	defer sd.mu.RUnlock()
-	return sd.data
+	return sd.Get()
 }
 
 // Set sets the data value, ensuring copy-on-write semantics.
@@ -604,18 +929,75 @@ func (sd *SharedData) Set(data string) {
 	}
 
 	sd.data = data
+	sd.parsed = nil
+	sd.dirty = false
+	sd.spill = nil
+}
 
-	// Notify data change if callback is set
-	if sd.onDataChanged != nil {
-		sd.onDataChanged()
+// Size returns the length of the data in bytes, without reading spilled data.
+func (sd *SharedData) Size() int {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.spill != nil {
+		return int(sd.spill.Size())
 	}
+	sd.serializeLocked()
+	return len(sd.data)
 }
 
-// MarshalJSON implements the json.Marshaler interface for SharedData
-func (sd *SharedData) MarshalJSON() ([]byte, error) {
+// Spill writes the data to a spill file in dir and releases it from memory.
+// The returned file has no reference, the holder must call Retain. Already spilled data returns the existing file.
+func (sd *SharedData) Spill(dir string) (*SpillFile, error) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.spill != nil {
+		return sd.spill, nil
+	}
+	sd.serializeLocked()
+	spill, err := NewSpillFile(dir, sd.data)
+	if err != nil {
+		return nil, err
+	}
+	sd.spill = spill
+	sd.data = ""
+	sd.parsed = nil
+	return spill, nil
+}
+
+// SpillFile returns the spill file, nil if the data is in memory.
+func (sd *SharedData) SpillFile() *SpillFile {
 	sd.mu.RLock()
 	defer sd.mu.RUnlock()
-	return json.Marshal(sd.data)
+	return sd.spill
+}
+
+// Load reads spilled data back into memory, so that it stays readable after the spill file is deleted.
+func (sd *SharedData) Load() error {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.spill == nil {
+		return nil
+	}
+	data, err := sd.spill.read()
+	if err != nil {
+		return err
+	}
+	sd.data = data
+	sd.spill = nil
+	return nil
+}
+
+// Reader returns a reader of the data, streaming spilled data from the spill file.
+func (sd *SharedData) Reader() (io.ReadCloser, error) {
+	if spill := sd.SpillFile(); spill != nil {
+		return spill.Open()
+	}
+	return io.NopCloser(strings.NewReader(sd.Get())), nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for SharedData
+func (sd *SharedData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sd.Get())
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for SharedData
@@ -633,5 +1015,69 @@ func (sd *SharedData) UnmarshalJSON(data []byte) error {
 	}
 
 	sd.data = s
+	sd.parsed = nil
+	sd.dirty = false
+	sd.spill = nil
 	return nil
 }
+
+// getJson returns the data parsed as a JSON object, parsing it on first use.
+func (sd *SharedData) getJson() (map[string]interface{}, error) {
+	sd.mu.RLock()
+	parsed := sd.parsed
+	sd.mu.RUnlock()
+	if parsed != nil {
+		return parsed, nil
+	}
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.parsed != nil {
+		return sd.parsed, nil
+	}
+	if sd.spill != nil {
+		data, err := sd.spill.read()
+		if err != nil {
+			return nil, err
+		}
+		//解析后的JSON缓存在内存中，数据也加载回内存
+		sd.data = data
+		sd.spill = nil
+	}
+	if sd.data == "" {
+		sd.parsed = make(map[string]interface{})
+		return sd.parsed, nil
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(sd.data), &result); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		//data is "null"
+		result = make(map[string]interface{})
+	}
+	sd.parsed = result
+	return result, nil
+}
+
+// setJson replaces the parsed JSON object and marks the string data as stale.
+func (sd *SharedData) setJson(parsed map[string]interface{}) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if sd.shared {
+		sd.shared = false
+	}
+	sd.parsed = parsed
+	sd.dirty = true
+	sd.spill = nil
+}
+
+// serializeLocked writes the modified JSON object back to data. The caller must hold the write lock.
+func (sd *SharedData) serializeLocked() {
+	if !sd.dirty {
+		return
+	}
+	if b, err := json.Marshal(sd.parsed); err == nil {
+		sd.data = string(b)
+	}
+	sd.dirty = false
+}
@@ -223,3 +223,23 @@ func BenchmarkSharedDataOperations(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkNewMsgFromBytes 基准测试：使用1MB字节创建消息，对比转换成字符串的复制
+func BenchmarkNewMsgFromBytes(b *testing.B) {
+	data := make([]byte, 1024*1024)
+	b.Run("NewMsg", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			_ = NewMsg(0, "TEST", BINARY, nil, string(data))
+		}
+	})
+
+	b.Run("NewMsgFromBytes", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			_ = NewMsgFromBytes(0, "TEST", BINARY, nil, data)
+		}
+	})
+}
@@ -765,3 +765,191 @@ func TestRuleMsgJSONRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+// TestMetadataNamespace 测试Metadata命名空间操作
+func TestMetadataNamespace(t *testing.T) {
+	md := BuildMetadata(map[string]string{"id": "1"})
+	header := md.Sub("respHeader")
+	header.PutValue("Location", "/items/1")
+	header.PutValue("Etag", "v1")
+	if md.GetValue("respHeader.Location") != "/items/1" || header.GetValue("Location") != "/items/1" {
+		t.Errorf("Expected namespaced key, got %v", md.Values())
+	}
+	if header.Prefix() != "respHeader." || MetadataNamespacePrefix("respHeader.") != "respHeader." {
+		t.Errorf("Unexpected prefix %s", header.Prefix())
+	}
+	values := md.ValuesWithPrefix("respHeader")
+	if len(values) != 2 || values["Etag"] != "v1" {
+		t.Errorf("Expected stripped values, got %v", values)
+	}
+	nested := md.Sub("a").Sub("b")
+	nested.PutValue("c", "abc")
+	if md.GetValue("a.b.c") != "abc" {
+		t.Errorf("Expected nested key, got %v", md.Values())
+	}
+
+	// 写时复制：删除命名空间不影响副本
+	copyMd := md.Copy()
+	if n := md.DeletePrefix("respHeader"); n != 2 {
+		t.Errorf("Expected 2 deleted keys, got %d", n)
+	}
+	if md.Has("respHeader.Location") || !copyMd.Has("respHeader.Location") {
+		t.Error("DeletePrefix should not affect the copy")
+	}
+	if md.Bytes() != len("id1")+len("a.b.cabc") {
+		t.Errorf("Unexpected bytes %d", md.Bytes())
+	}
+	copyMd.Sub("respHeader").Delete("Etag")
+	if copyMd.Has("respHeader.Etag") || copyMd.Sub("respHeader").Clear() != 1 {
+		t.Errorf("Unexpected values %v", copyMd.Values())
+	}
+	if md.DeletePrefix("notExist") != 0 {
+		t.Error("Expected no deleted keys")
+	}
+}
+
+// TestRuleMsgDataPath 测试按照路径读写消息数据
+func TestRuleMsgDataPath(t *testing.T) {
+	msg := NewMsg(0, "TEST", JSON, nil, `{"a":{"b":1},"x/y":2,"items":[]}`)
+
+	if v, ok := msg.GetDataPath("a.b"); !ok || v != float64(1) {
+		t.Errorf("Expected a.b to be 1, got %v", v)
+	}
+	if v, ok := msg.GetDataPath("/x~1y"); !ok || v != float64(2) {
+		t.Errorf("Expected /x~1y to be 2, got %v", v)
+	}
+	if _, ok := msg.GetDataPath("a.c"); ok {
+		t.Error("Expected a.c not found")
+	}
+
+	// 复制的消息不受后续修改影响
+	copied := msg.Copy()
+	// 值传递的消息共享同一份数据
+	passed := msg
+
+	if err := msg.SetDataPath("a.c.d", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.SetDataPath("items[-]", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.DeleteDataPath("/x~1y"); err != nil {
+		t.Fatal(err)
+	}
+	// 修改后读取字符串前不序列化
+	if !msg.Data.dirty {
+		t.Error("Expected data to be serialized lazily")
+	}
+	if v, ok := passed.GetDataPath("a.c.d"); !ok || v != "new" {
+		t.Errorf("Expected a.c.d to be new, got %v", v)
+	}
+
+	expected := `{"a":{"b":1,"c":{"d":"new"}},"items":[1]}`
+	if passed.GetData() != expected {
+		t.Errorf("Expected %s, got %s", expected, passed.GetData())
+	}
+	if msg.Data.dirty {
+		t.Error("Expected data to be serialized after GetData")
+	}
+	if copied.GetData() != `{"a":{"b":1},"x/y":2,"items":[]}` {
+		t.Errorf("Expected copied data to be unchanged, got %s", copied.GetData())
+	}
+
+	// 修改后复制，复制的消息包含修改
+	if err := msg.SetDataPath("a.b", 2); err != nil {
+		t.Fatal(err)
+	}
+	copied = msg.Copy()
+	if v, _ := copied.GetDataPath("a.b"); v != float64(2) {
+		t.Errorf("Expected copied a.b to be 2, got %v", v)
+	}
+
+	// SetData丢弃缓存
+	msg.SetData(`{"z":1}`)
+	if _, ok := msg.GetDataPath("a"); ok {
+		t.Error("Expected parsed cache to be dropped by SetData")
+	}
+
+	// JSON序列化包含未序列化的修改
+	if err := msg.SetDataPath("z", 3); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"data":"{\"z\":3}"`) {
+		t.Errorf("Expected marshaled data to contain modification, got %s", string(b))
+	}
+
+	// 非对象数据和无法序列化的值返回错误
+	textMsg := NewMsg(0, "TEST", JSON, nil, `[1,2]`)
+	if err := textMsg.SetDataPath("a", 1); err == nil {
+		t.Error("Expected error for array data")
+	}
+	if err := msg.SetDataPath("ch", make(chan int)); err == nil {
+		t.Error("Expected error for unserializable value")
+	}
+	if err := msg.SetDataPath("", "root"); err == nil {
+		t.Error("Expected error for replacing root with non object")
+	}
+	if msg.GetData() != `{"z":3}` {
+		t.Errorf("Expected data unchanged after errors, got %s", msg.GetData())
+	}
+}
+
+func TestRuleMsgEventTs(t *testing.T) {
+	msg := NewMsg(1000, "TEST", JSON, NewMetadata(), `{}`)
+	if msg.GetIngestTs() != 1000 || msg.GetEventTs() != 1000 {
+		t.Errorf("未设置事件时间时应该使用接收时间: %d %d", msg.GetIngestTs(), msg.GetEventTs())
+	}
+	jsonData, _ := json.Marshal(msg)
+	if strings.Contains(string(jsonData), EventTsKey) {
+		t.Errorf("未设置事件时间时不应该序列化eventTs: %s", jsonData)
+	}
+
+	msg.SetEventTs(500)
+	if msg.GetTsBy(TsSourceEvent) != 500 || msg.GetTsBy(TsSourceIngest) != 1000 || msg.GetTsBy("") != 1000 {
+		t.Errorf("GetTsBy 错误")
+	}
+	copied := msg.Copy()
+	if copied.EventTs != 500 {
+		t.Errorf("复制消息丢失事件时间: %d", copied.EventTs)
+	}
+
+	//JSON往返
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("JSON序列化失败: %v", err)
+	}
+	if !strings.Contains(string(jsonData), `"ts":1000`) || !strings.Contains(string(jsonData), `"eventTs":500`) {
+		t.Errorf("JSON缺少时间字段: %s", jsonData)
+	}
+	var deserializedMsg RuleMsg
+	if err = json.Unmarshal(jsonData, &deserializedMsg); err != nil {
+		t.Fatalf("JSON反序列化失败: %v", err)
+	}
+	if deserializedMsg.GetIngestTs() != 1000 || deserializedMsg.GetEventTs() != 500 {
+		t.Errorf("JSON往返后时间不一致: %d %d", deserializedMsg.GetIngestTs(), deserializedMsg.GetEventTs())
+	}
+}
+
+func TestNewMsgFromBytes(t *testing.T) {
+	data := []byte{0x08, 0x96, 0x01, 0x00, 0xff}
+	msg := NewMsgFromBytes(0, "TEST", BINARY, nil, data)
+	if msg.DataType != BINARY || msg.GetData() != string(data) || msg.GetDataSize() != len(data) {
+		t.Errorf("二进制数据不一致: %v", msg.GetBytes())
+	}
+	if msg.Id == "" || msg.Ts <= 0 || msg.Metadata == nil {
+		t.Errorf("消息字段没有初始化")
+	}
+	//复制和修改数据不影响原始字节
+	copied := msg.Copy()
+	copied.SetData("new")
+	if msg.GetData() != string(data) || data[0] != 0x08 {
+		t.Errorf("修改复制的消息影响了原始数据")
+	}
+	if empty := NewMsgFromBytes(0, "TEST", BINARY, nil, nil); empty.GetData() != "" {
+		t.Errorf("空数据应该为空字符串")
+	}
+}
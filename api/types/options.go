@@ -75,6 +75,14 @@ func WithScriptMaxExecutionTime(scriptMaxExecutionTime time.Duration) Option {
 	}
 }
 
+// WithScriptWarmUp is an option that enables running scripts once during node initialization.
+func WithScriptWarmUp(warmUp bool) Option {
+	return func(c *Config) error {
+		c.ScriptWarmUp = warmUp
+		return nil
+	}
+}
+
 // WithParser is an option that sets the parser of the Config.
 func WithParser(parser Parser) Option {
 	return func(c *Config) error {
@@ -114,3 +122,45 @@ func WithCache(cache Cache) Option {
 		return nil
 	}
 }
+
+// WithOnDeadLetter is an option that sets the callback function for messages aborted by the engine.
+func WithOnDeadLetter(onDeadLetter func(ruleChainId string, nodeId string, msg RuleMsg, err error)) Option {
+	return func(c *Config) error {
+		c.OnDeadLetter = onDeadLetter
+		return nil
+	}
+}
+
+// WithNodeQueueShutdown is an option that sets the shutdown policy and drain timeout of node input queues.
+func WithNodeQueueShutdown(policy string, drainTimeout time.Duration) Option {
+	return func(c *Config) error {
+		c.NodeQueueShutdownPolicy = policy
+		c.NodeQueueDrainTimeout = drainTimeout
+		return nil
+	}
+}
+
+// WithSpill is an option that enables spilling msg data larger than threshold bytes to temp files in dir.
+func WithSpill(threshold int, dir string) Option {
+	return func(c *Config) error {
+		c.SpillThreshold = threshold
+		c.SpillDir = dir
+		return nil
+	}
+}
+
+// WithEventBus is an option that sets the lifecycle event bus of the Config.
+func WithEventBus(eventBus EventBus) Option {
+	return func(c *Config) error {
+		c.EventBus = eventBus
+		return nil
+	}
+}
+
+// WithHealthRegistry is an option that sets the health registry of the Config.
+func WithHealthRegistry(healthRegistry HealthRegistry) Option {
+	return func(c *Config) error {
+		c.HealthRegistry = healthRegistry
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// SpillFilePrefix is the name prefix of spill files, followed by the id of the process that created the file.
+const SpillFilePrefix = "rulego-spill-"
+
+// SpillFile is a temp file holding a msg payload spilled to disk, see Config.SpillThreshold.
+// The file is immutable and reference counted: it is deleted when the last holder releases it.
+type SpillFile struct {
+	path string
+	size int64
+	refs int32
+}
+
+// NewSpillFile writes data to a new spill file in dir. Empty dir means os.TempDir().
+// The returned file has no reference, the holder must call Retain.
+func NewSpillFile(dir string, data string) (*SpillFile, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	f, err := os.CreateTemp(dir, fmt.Sprintf("%s%d-*", SpillFilePrefix, os.Getpid()))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.WriteString(f, data); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return &SpillFile{path: f.Name(), size: int64(len(data))}, nil
+}
+
+// Path returns the path of the file.
+func (f *SpillFile) Path() string {
+	return f.path
+}
+
+// Size returns the size of the payload in bytes.
+func (f *SpillFile) Size() int64 {
+	return f.size
+}
+
+// Retain adds a reference.
+func (f *SpillFile) Retain() {
+	atomic.AddInt32(&f.refs, 1)
+}
+
+// Release removes a reference, and deletes the file when there are no more references.
+func (f *SpillFile) Release() {
+	if atomic.AddInt32(&f.refs, -1) == 0 {
+		_ = os.Remove(f.path)
+	}
+}
+
+// Open opens the file for streaming reads.
+func (f *SpillFile) Open() (io.ReadCloser, error) {
+	return os.Open(f.path)
+}
+
+// read reads the whole payload.
+func (f *SpillFile) read() (string, error) {
+	b, err := os.ReadFile(f.path)
+	return string(b), err
+}
+
+// SweepSpillFiles deletes the spill files in dir left by processes that are no longer running, such as after a crash.
+// Empty dir means os.TempDir(). It returns the number of deleted files.
+func SweepSpillFiles(dir string) (int, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, SpillFilePrefix) {
+			continue
+		}
+		pidStr := strings.TrimPrefix(name, SpillFilePrefix)
+		if i := strings.Index(pidStr, "-"); i > 0 {
+			pidStr = pidStr[:i]
+		}
+		if pid, err := strconv.Atoi(pidStr); err == nil && processAlive(pid) {
+			continue
+		}
+		if os.Remove(filepath.Join(dir, name)) == nil {
+			count++
+		}
+	}
+	return count, nil
+}
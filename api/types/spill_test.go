@@ -0,0 +1,107 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestSharedDataSpill(t *testing.T) {
+	dir := t.TempDir()
+	msg := NewMsg(0, "TEST", JSON, NewMetadata(), `{"temperature":41}`)
+	size := msg.GetDataSize()
+	file, err := msg.Data.Spill(dir)
+	assert.Nil(t, err)
+	file.Retain()
+	assert.True(t, msg.IsSpilled())
+	assert.Equal(t, int64(size), file.Size())
+	assert.Equal(t, size, msg.GetDataSize())
+	assert.Equal(t, `{"temperature":41}`, msg.GetData())
+
+	//副本共享落盘文件
+	msgCopy := msg.Copy()
+	assert.True(t, msgCopy.IsSpilled())
+	reader, err := msgCopy.GetDataReader()
+	assert.Nil(t, err)
+	b, err := io.ReadAll(reader)
+	_ = reader.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"temperature":41}`, string(b))
+
+	//修改数据后不再落盘
+	msgCopy.SetData("small")
+	assert.False(t, msgCopy.IsSpilled())
+	assert.True(t, msg.IsSpilled())
+
+	//解析JSON加载回内存
+	dataMap, err := msg.GetDataAsJson()
+	assert.Nil(t, err)
+	assert.Equal(t, float64(41), dataMap["temperature"])
+	assert.False(t, msg.IsSpilled())
+
+	other := NewMsg(0, "TEST", TEXT, NewMetadata(), "aa")
+	otherFile, err := other.Data.Spill(dir)
+	assert.Nil(t, err)
+	otherFile.Retain()
+	assert.Nil(t, other.Data.Load())
+	assert.False(t, other.IsSpilled())
+
+	//释放后删除文件，已加载的数据仍然可读
+	file.Release()
+	otherFile.Release()
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(entries))
+	assert.Equal(t, "aa", other.GetData())
+
+	//文件删除后读取数据返回错误
+	_, err = msg.GetDataE()
+	assert.Nil(t, err)
+	lost := NewMsg(0, "TEST", TEXT, NewMetadata(), "lost")
+	lostFile, err := lost.Data.Spill(dir)
+	assert.Nil(t, err)
+	lostFile.Retain()
+	lostFile.Release()
+	_, err = lost.GetDataE()
+	assert.NotNil(t, err)
+	assert.Equal(t, "", lost.GetData())
+}
+
+func TestSweepSpillFiles(t *testing.T) {
+	dir := t.TempDir()
+	orphan := filepath.Join(dir, SpillFilePrefix+"2147483646-1")
+	own := filepath.Join(dir, fmt.Sprintf("%s%d-1", SpillFilePrefix, os.Getpid()))
+	other := filepath.Join(dir, "other")
+	for _, file := range []string{orphan, own, other} {
+		assert.Nil(t, os.WriteFile(file, []byte("x"), 0600))
+	}
+	count, err := SweepSpillFiles(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	_, err = os.Stat(orphan)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(own)
+	assert.Nil(t, err)
+	_, err = os.Stat(other)
+	assert.Nil(t, err)
+}
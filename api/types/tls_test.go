@@ -0,0 +1,199 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/test/cert"
+)
+
+// newTestCert 生成自签名证书，返回PEM格式的证书和私钥
+func newTestCert(t *testing.T, commonName string, notBefore, notAfter time.Time) (string, string) {
+	c := cert.NewWithValidity(t, commonName, nil, x509.ExtKeyUsageAny, notBefore, notAfter)
+	return string(c.CertPem), string(c.KeyPem)
+}
+
+func TestTLSConfig(t *testing.T) {
+	now := time.Now()
+	certPem, keyPem := newTestCert(t, "localhost", now.Add(-time.Hour), now.Add(time.Hour))
+
+	t.Run("Empty", func(t *testing.T) {
+		config, err := TLSConfig{}.NewTLSConfig()
+		assert.Nil(t, err)
+		assert.Nil(t, config)
+	})
+
+	t.Run("InlinePem", func(t *testing.T) {
+		config, err := TLSConfig{CA: certPem, Cert: certPem, Key: keyPem, ServerName: "localhost", MinVersion: "1.2"}.NewTLSConfig()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(config.Certificates))
+		assert.NotNil(t, config.RootCAs)
+		assert.Equal(t, "localhost", config.ServerName)
+		assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		assert.Nil(t, os.WriteFile(certFile, []byte(certPem), 0600))
+		assert.Nil(t, os.WriteFile(keyFile, []byte(keyPem), 0600))
+		//兼容旧的文件配置
+		config, err := TLSConfig{}.Fallback(certFile, certFile, keyFile).NewTLSConfig()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(config.Certificates))
+		assert.NotNil(t, config.RootCAs)
+
+		_, err = TLSConfig{CA: filepath.Join(dir, "notFound.pem")}.NewTLSConfig()
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := TLSConfig{MinVersion: "2.0"}.NewTLSConfig()
+		assert.Equal(t, "unsupported tls minVersion:2.0", err.Error())
+		_, err = TLSConfig{Cert: certPem}.NewTLSConfig()
+		assert.Equal(t, "tls cert and key must be configured together", err.Error())
+		_, err = TLSConfig{CA: "-----BEGIN CERTIFICATE-----\nxx\n-----END CERTIFICATE-----"}.NewTLSConfig()
+		assert.Equal(t, "no valid tls ca certificate found", err.Error())
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		expiredCert, expiredKey := newTestCert(t, "localhost", now.Add(-time.Hour*2), now.Add(-time.Hour))
+		_, err := TLSConfig{Cert: expiredCert, Key: expiredKey}.NewTLSConfig()
+		assert.True(t, strings.HasPrefix(err.Error(), "tls certificate expired at"))
+	})
+
+	t.Run("Rotated", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		assert.Nil(t, os.WriteFile(certFile, []byte(certPem), 0600))
+		assert.Nil(t, os.WriteFile(keyFile, []byte(keyPem), 0600))
+		config, err := TLSConfig{Cert: certFile, Key: keyFile, Watch: true}.NewTLSConfig()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(config.Certificates))
+		cert, err := config.GetCertificate(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "localhost", cert.Leaf.Subject.CommonName)
+
+		//轮换证书
+		rotatedCert, rotatedKey := newTestCert(t, "rotated", now.Add(-time.Hour), now.Add(time.Hour))
+		assert.Nil(t, os.WriteFile(certFile, []byte(rotatedCert), 0600))
+		assert.Nil(t, os.WriteFile(keyFile, []byte(rotatedKey), 0600))
+		modTime := now.Add(time.Minute)
+		assert.Nil(t, os.Chtimes(certFile, modTime, modTime))
+		assert.Nil(t, os.Chtimes(keyFile, modTime, modTime))
+		cert, err = config.GetClientCertificate(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "rotated", cert.Leaf.Subject.CommonName)
+
+		//轮换为过期证书，继续使用原来的证书
+		expiredCert, expiredKey := newTestCert(t, "expired", now.Add(-time.Hour*2), now.Add(-time.Hour))
+		assert.Nil(t, os.WriteFile(certFile, []byte(expiredCert), 0600))
+		assert.Nil(t, os.WriteFile(keyFile, []byte(expiredKey), 0600))
+		modTime = now.Add(time.Minute * 2)
+		assert.Nil(t, os.Chtimes(certFile, modTime, modTime))
+		assert.Nil(t, os.Chtimes(keyFile, modTime, modTime))
+		cert, err = config.GetCertificate(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "rotated", cert.Leaf.Subject.CommonName)
+	})
+
+	t.Run("Reloader", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		writeCert := func(cert, key string, modTime time.Time) {
+			assert.Nil(t, os.WriteFile(certFile, []byte(cert), 0600))
+			assert.Nil(t, os.WriteFile(keyFile, []byte(key), 0600))
+			assert.Nil(t, os.Chtimes(certFile, modTime, modTime))
+			assert.Nil(t, os.Chtimes(keyFile, modTime, modTime))
+		}
+		writeCert(certPem, keyPem, now)
+		var results []error
+		reloader, err := TLSConfig{Cert: certFile, Key: keyFile}.NewCertReloader(func(err error) {
+			results = append(results, err)
+		})
+		assert.Nil(t, err)
+		rotatedCert, rotatedKey := newTestCert(t, "rotated", now.Add(-time.Hour), now.Add(time.Hour))
+		writeCert(rotatedCert, rotatedKey, now.Add(time.Minute))
+		//没有开启Watch，调用Reload后才重新加载
+		cert, _ := reloader.GetCertificate(nil)
+		assert.Equal(t, "localhost", cert.Leaf.Subject.CommonName)
+		assert.Nil(t, reloader.Reload())
+		cert, _ = reloader.GetCertificate(nil)
+		assert.Equal(t, "rotated", cert.Leaf.Subject.CommonName)
+		expiredCert, expiredKey := newTestCert(t, "expired", now.Add(-time.Hour*2), now.Add(-time.Hour))
+		writeCert(expiredCert, expiredKey, now.Add(time.Minute*2))
+		assert.NotNil(t, reloader.Reload())
+		cert, _ = reloader.GetCertificate(nil)
+		assert.Equal(t, "rotated", cert.Leaf.Subject.CommonName)
+		assert.Equal(t, 2, len(results))
+		assert.Nil(t, results[0])
+		assert.NotNil(t, results[1])
+
+		//开启Watch，文件修改后自动重新加载，每次修改失败只通知一次
+		results = nil
+		reloader, err = TLSConfig{Cert: certFile, Key: keyFile, Watch: true}.NewCertReloader(func(err error) {
+			results = append(results, err)
+		})
+		assert.NotNil(t, err)
+		writeCert(certPem, keyPem, now.Add(time.Minute*3))
+		reloader, err = TLSConfig{Cert: certFile, Key: keyFile, Watch: true}.NewCertReloader(func(err error) {
+			results = append(results, err)
+		})
+		assert.Nil(t, err)
+		writeCert(expiredCert, expiredKey, now.Add(time.Minute*4))
+		_, _ = reloader.GetCertificate(nil)
+		cert, _ = reloader.GetCertificate(nil)
+		assert.Equal(t, "localhost", cert.Leaf.Subject.CommonName)
+		writeCert(rotatedCert, rotatedKey, now.Add(time.Minute*5))
+		cert, _ = reloader.GetCertificate(nil)
+		assert.Equal(t, "rotated", cert.Leaf.Subject.CommonName)
+		assert.Equal(t, 2, len(results))
+		assert.NotNil(t, results[0])
+		assert.Nil(t, results[1])
+	})
+
+	t.Run("Handshake", func(t *testing.T) {
+		serverConfig, err := TLSConfig{Cert: certPem, Key: keyPem}.NewTLSConfig()
+		assert.Nil(t, err)
+		ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+		assert.Nil(t, err)
+		defer ln.Close()
+		go func() {
+			if conn, err := ln.Accept(); err == nil {
+				_, _ = conn.Write([]byte("ok"))
+				_ = conn.Close()
+			}
+		}()
+		clientConfig, err := TLSConfig{CA: certPem, ServerName: "localhost"}.NewTLSConfig()
+		assert.Nil(t, err)
+		conn, err := tls.Dial("tcp", ln.Addr().String(), clientConfig)
+		assert.Nil(t, err)
+		defer conn.Close()
+		buf := make([]byte, 2)
+		_, err = conn.Read(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, "ok", string(buf))
+	})
+}
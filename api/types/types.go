@@ -173,7 +173,9 @@ type RuleContext interface {
 	// ruleChainId: The ID of the rule chain.
 	// onEndFunc: Callback for when a branch of the sub-rule chain completes, returning the result of that chain. If multiple branches are triggered, it will be called multiple times.
 	// onAllNodeCompleted: Callback for when all nodes have completed, with no result returned.
-	// If the rule chain is not found, the message is sent to the next node via the 'Failure' relationship.
+	// If the rule chain is not found and endFunc or onAllNodeCompleted is set, endFunc is called with the error and the 'Failure' relationship,
+	// followed by onAllNodeCompleted, the same as TellNode when the node is not found.
+	// Otherwise, the message is sent to the next node via the 'Failure' relationship.
 	TellFlow(ctx context.Context, ruleChainId string, msg RuleMsg, endFunc OnEndFunc, onAllNodeCompleted func())
 	// TellNode starts execution from a specified node. If skipTellNext=true, only the current node is executed without notifying the next node.
 	// onEnd is used to view the final execution result.
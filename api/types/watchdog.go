@@ -0,0 +1,108 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Rule chain configuration keys of the watchdog, which detects the messages that never complete.
+// The watchdog is disabled if maxProcessingTime is 0 or absent.
+//
+// Example:
+//
+//	"ruleChain": {
+//	  "id": "rule01",
+//	  "configuration": {
+//	    "maxProcessingTime": "30s",
+//	    "watchdogAction": "fail"
+//	  }
+//	}
+const (
+	// MaxProcessingTimeKey is the maximum processing time of a message, a duration string such as 30s, or milliseconds.
+	MaxProcessingTimeKey = "maxProcessingTime"
+	// WatchdogActionKey is the action applied to the messages exceeding maxProcessingTime, default WatchdogActionLog.
+	WatchdogActionKey = "watchdogAction"
+)
+
+// Watchdog actions.
+const (
+	// WatchdogActionLog only logs and publishes EventMsgStuck, the message keeps running.
+	WatchdogActionLog = "log"
+	// WatchdogActionFail ends the message with ProcessingTimeoutError and passes it to Config.OnDeadLetter.
+	// The nodes still running are not interrupted, but their outputs are discarded.
+	WatchdogActionFail = "fail"
+	// WatchdogActionCancel cancels the context of the message, the nodes that observe ctx.GetContext().Done() stop.
+	WatchdogActionCancel = "cancel"
+)
+
+// ErrProcessingTimeout is the sentinel error wrapped by ProcessingTimeoutError, use errors.Is to check it.
+var ErrProcessingTimeout = errors.New("message processing timeout")
+
+// ProcessingTimeoutError is returned when a message exceeds the maxProcessingTime of the rule chain.
+type ProcessingTimeoutError struct {
+	// RuleChainId is the id of the rule chain.
+	RuleChainId string
+	// NodeId is the id of the last node reached by the message.
+	NodeId string
+	// Elapsed is the processing time of the message.
+	Elapsed time.Duration
+	// MaxProcessingTime is the configured limit, including the extensions.
+	MaxProcessingTime time.Duration
+}
+
+func (e *ProcessingTimeoutError) Error() string {
+	return fmt.Sprintf("%s: chain=%s node=%s elapsed=%s max=%s", ErrProcessingTimeout.Error(), e.RuleChainId, e.NodeId, e.Elapsed, e.MaxProcessingTime)
+}
+
+// Unwrap returns ErrProcessingTimeout.
+func (e *ProcessingTimeoutError) Unwrap() error {
+	return ErrProcessingTimeout
+}
+
+// DeadlineExtender extends the processing deadline of a message watched by the watchdog.
+type DeadlineExtender interface {
+	// ExtendDeadline extends the deadline by d.
+	ExtendDeadline(d time.Duration)
+}
+
+type deadlineExtenderKey struct{}
+
+// WithDeadlineExtender returns a context carrying the deadline extender of the message, used by the engine.
+func WithDeadlineExtender(ctx context.Context, extender DeadlineExtender) context.Context {
+	return context.WithValue(ctx, deadlineExtenderKey{}, extender)
+}
+
+// ExtendDeadline extends the processing deadline of the message by d, used by the nodes that legitimately wait,
+// such as the delay node, to avoid being reported by the watchdog:
+//
+//	types.ExtendDeadline(ctx.GetContext(), delay)
+//
+// It returns false if the message is not watched.
+func ExtendDeadline(ctx context.Context, d time.Duration) bool {
+	if ctx == nil {
+		return false
+	}
+	if extender, ok := ctx.Value(deadlineExtenderKey{}).(DeadlineExtender); ok {
+		extender.ExtendDeadline(d)
+		return true
+	}
+	return false
+}
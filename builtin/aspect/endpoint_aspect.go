@@ -81,6 +81,10 @@ func (aspect *EndpointAspect) OnReload(_ types.NodeCtx, ctx types.NodeCtx) error
 	return nil
 }
 func (aspect *EndpointAspect) OnDestroy(ctx types.NodeCtx) {
+	//规则链更新时保留endpoint，由OnReload对比新旧定义后更新，避免断开已有连接
+	if reloadingCtx, ok := ctx.(types.ReloadingCtx); ok && reloadingCtx.Reloading() {
+		return
+	}
 	if aspect.ruleChainEndpoint != nil {
 		aspect.ruleChainEndpoint.Destroy()
 	}
@@ -111,6 +115,8 @@ func NewRuleChainEndpoint(ruleEngineId string, config types.Config, endpointPool
 		if err := ruleChainEndpoint.AddEndpointAndStart(item, endpoint.DynamicEndpointOptions.WithConfig(config),
 			endpoint.DynamicEndpointOptions.WithRouterOpts(endpoint.RouterOptions.WithRuleGo(ruleGoPool)),
 			endpoint.DynamicEndpointOptions.WithRuleChain(ruleChain)); err != nil {
+			//停止已经启动的endpoint
+			ruleChainEndpoint.Destroy()
 			return nil, err
 		}
 	}
@@ -128,42 +134,51 @@ func (e *RuleChainEndpoint) Start() error {
 	return nil
 }
 
+// Reload 对比新旧endpoint定义：新增的启动，删除的销毁，修改的在原实例上重新加载，
+// 只有监听相关的配置变化才会重启服务，否则只更新路由并保留已有连接
 func (e *RuleChainEndpoint) Reload(ruleChain *types.RuleChain, newDefs []*types.EndpointDsl) error {
 	var oldDefs []*types.EndpointDsl
 	endpoints := e.GetEndpoints()
 	for _, ep := range endpoints {
 		tmp := ep.Definition()
+		oldDefs = append(oldDefs, &tmp)
+	}
+	for _, item := range newDefs {
 		if ruleChain != nil {
-			tmp.Configuration = dsl.ProcessVariables(e.config, *ruleChain, tmp.Configuration)
+			item.Configuration = dsl.ProcessVariables(e.config, *ruleChain, item.Configuration)
 		}
-		oldDefs = append(oldDefs, &tmp)
+		e.bindTo(item, e.ruleEngineId)
 	}
 	added, removed, modified := e.checkEndpointChanges(oldDefs, newDefs)
 	for _, item := range removed {
 		e.RemoveEndpoint(item.Id)
 	}
 	for _, item := range added {
-		e.bindTo(item, e.ruleEngineId)
-		if err := e.AddEndpointAndStart(item, endpoint.DynamicEndpointOptions.WithConfig(e.config),
-			endpoint.DynamicEndpointOptions.WithRouterOpts(endpoint.RouterOptions.WithRuleGo(e.ruleGoPool)),
-			endpoint.DynamicEndpointOptions.WithRuleChain(ruleChain),
-		); err != nil {
+		if err := e.AddEndpointAndStart(item, e.endpointOptions(ruleChain)...); err != nil {
 			return err
 		}
 	}
 	for _, item := range modified {
-		e.bindTo(item, e.ruleEngineId)
-		e.RemoveEndpoint(item.Id)
-		if err := e.AddEndpointAndStart(item, endpoint.DynamicEndpointOptions.WithConfig(e.config),
-			endpoint.DynamicEndpointOptions.WithRouterOpts(endpoint.RouterOptions.WithRuleGo(e.ruleGoPool)),
-			endpoint.DynamicEndpointOptions.WithRuleChain(ruleChain),
-		); err != nil {
+		ep, ok := e.GetEndpoint(item.Id)
+		if !ok {
+			continue
+		}
+		if err := ep.ReloadFromDef(*item, e.endpointOptions(ruleChain)...); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// endpointOptions 创建或者重新加载endpoint的选项
+func (e *RuleChainEndpoint) endpointOptions(ruleChain *types.RuleChain) []endpoint.DynamicEndpointOption {
+	return []endpoint.DynamicEndpointOption{
+		endpoint.DynamicEndpointOptions.WithConfig(e.config),
+		endpoint.DynamicEndpointOptions.WithRouterOpts(endpoint.RouterOptions.WithRuleGo(e.ruleGoPool)),
+		endpoint.DynamicEndpointOptions.WithRuleChain(ruleChain),
+	}
+}
+
 func (e *RuleChainEndpoint) AddEndpointAndStart(def *types.EndpointDsl, opts ...endpoint.DynamicEndpointOption) error {
 	ep, err := e.endpointPool.Factory().NewFromDef(*def, opts...)
 	if err != nil {
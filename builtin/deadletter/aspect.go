@@ -0,0 +1,108 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadletter
+
+import (
+	"sync"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+var (
+	_ types.StartAspect     = (*CaptureAspect)(nil)
+	_ types.EndAspect       = (*CaptureAspect)(nil)
+	_ types.CompletedAspect = (*CaptureAspect)(nil)
+)
+
+// CaptureAspect 死信捕获切面
+// 规则链处理消息时记录原始消息，任意分支以失败结束，则在所有分支结束后把原始消息保存为死信
+// 重新投递的消息不会再次捕获，由投递器更新投递次数
+// 使用方式：
+//
+//	worker := deadletter.NewWorker(store, pool, deadletter.Config{})
+//	rulego.New(id, def, types.WithAspects(worker.Aspect()))
+type CaptureAspect struct {
+	worker *Worker
+	//消息ID->处理中的消息
+	pending sync.Map
+}
+
+// captureItem 处理中的消息
+type captureItem struct {
+	mu     sync.Mutex
+	msg    types.RuleMsg
+	nodeId string
+	err    error
+}
+
+// Aspect 创建死信捕获切面
+func (w *Worker) Aspect() *CaptureAspect {
+	return &CaptureAspect{worker: w}
+}
+
+func (a *CaptureAspect) Order() int {
+	return 900
+}
+
+func (a *CaptureAspect) New() types.Aspect {
+	return &CaptureAspect{worker: a.worker}
+}
+
+func (a *CaptureAspect) PointCut(ctx types.RuleContext, msg types.RuleMsg, relationType string) bool {
+	return msg.Metadata == nil || !msg.Metadata.Has(KeyDeadLetterId)
+}
+
+func (a *CaptureAspect) Start(ctx types.RuleContext, msg types.RuleMsg) (types.RuleMsg, error) {
+	a.pending.Store(msg.Id, &captureItem{msg: msg.Copy()})
+	return msg, nil
+}
+
+func (a *CaptureAspect) End(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) types.RuleMsg {
+	if err == nil {
+		return msg
+	}
+	if v, ok := a.pending.Load(msg.Id); ok {
+		item := v.(*captureItem)
+		item.mu.Lock()
+		if item.err == nil {
+			item.err = err
+			if ctx != nil && ctx.Self() != nil {
+				item.nodeId = ctx.Self().GetNodeId().Id
+			}
+		}
+		item.mu.Unlock()
+	}
+	return msg
+}
+
+func (a *CaptureAspect) Completed(ctx types.RuleContext, msg types.RuleMsg) types.RuleMsg {
+	v, ok := a.pending.LoadAndDelete(msg.Id)
+	if !ok {
+		return msg
+	}
+	item := v.(*captureItem)
+	item.mu.Lock()
+	defer item.mu.Unlock()
+	if item.err != nil {
+		var chainId string
+		if ctx != nil && ctx.RuleChain() != nil {
+			chainId = ctx.RuleChain().GetNodeId().Id
+		}
+		a.worker.Capture(chainId, item.nodeId, item.msg, item.err)
+	}
+	return msg
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadletter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+)
+
+var flakyBroken int32
+
+// 收到的重新投递消息的元数据
+var flakyReceived sync.Map
+
+// flakyNode 测试节点，flakyBroken=1时处理失败
+type flakyNode struct {
+}
+
+func (n *flakyNode) Type() string {
+	return "test/deadLetterFlaky"
+}
+
+func (n *flakyNode) New() types.Node {
+	return &flakyNode{}
+}
+
+func (n *flakyNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return nil
+}
+
+func (n *flakyNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	if atomic.LoadInt32(&flakyBroken) == 1 {
+		ctx.TellFailure(msg, errors.New("downstream unavailable"))
+		return
+	}
+	if msg.Metadata.Has(KeyDeadLetterId) {
+		flakyReceived.Store(msg.GetData(), msg.Metadata.Copy())
+	}
+	ctx.TellSuccess(msg)
+}
+
+func (n *flakyNode) Destroy() {
+}
+
+func init() {
+	_ = engine.Registry.Register(&flakyNode{})
+}
+
+const flakyChain = `{
+  "ruleChain": {"id": "%s", "configuration": {%s}},
+  "metadata": {
+    "nodes": [{"id": "s1", "type": "test/deadLetterFlaky"}]
+  }
+}`
+
+func newFlakyChain(t *testing.T, pool *engine.Pool, id string, configuration string, opts ...types.RuleEngineOption) types.RuleEngine {
+	def := []byte(fmt.Sprintf(flakyChain, id, configuration))
+	ruleEngine, err := pool.New(id, def, opts...)
+	assert.Nil(t, err)
+	return ruleEngine
+}
+
+func sendMsgs(ruleEngine types.RuleEngine, count int) {
+	for i := 0; i < count; i++ {
+		metadata := types.NewMetadata()
+		metadata.PutValue("index", string(rune('a'+i)))
+		ruleEngine.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, metadata, "msg-"+string(rune('a'+i))))
+	}
+}
+
+func TestRedelivery(t *testing.T) {
+	pool := engine.NewPool()
+	defer pool.Stop()
+	store := NewMemoryStore()
+	worker := NewWorker(store, pool, Config{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond * 10, Jitter: -1, PollInterval: time.Millisecond * 10})
+	assert.Equal(t, 0.2, worker.config.Jitter)
+	worker.config.Jitter = 0
+
+	ruleEngine := newFlakyChain(t, pool, "dlChain", "", types.WithAspects(worker.Aspect()))
+
+	atomic.StoreInt32(&flakyBroken, 1)
+	sendMsgs(ruleEngine, 3)
+
+	entries, _ := store.List()
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "dlChain", entries[0].ChainId)
+	assert.Equal(t, "s1", entries[0].NodeId)
+	assert.Equal(t, "downstream unavailable", entries[0].Error)
+	assert.Equal(t, StatusPending, entries[0].Status)
+	assert.Equal(t, 0, entries[0].Attempts)
+
+	//下游仍然不可用，投递失败，记录投递次数
+	time.Sleep(time.Millisecond * 5)
+	assert.Equal(t, 3, worker.RedeliverDue())
+	entries, _ = store.List()
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, 1, entries[0].Attempts)
+	assert.Equal(t, StatusPending, entries[0].Status)
+	stats := worker.Stats()
+	assert.Equal(t, 3, stats.Pending)
+	assert.Equal(t, int64(3), stats.Failed)
+	assert.True(t, stats.OldestPendingAgeMs > 0)
+
+	//下游恢复，后台投递成功
+	atomic.StoreInt32(&flakyBroken, 0)
+	worker.Start()
+	defer worker.Stop()
+	waitFor(t, func() bool {
+		entries, _ := store.List()
+		return len(entries) == 0
+	})
+	stats = worker.Stats()
+	assert.Equal(t, 0, stats.Pending)
+	assert.Equal(t, int64(3), stats.Succeeded)
+	assert.Equal(t, int64(6), stats.Redelivered)
+
+	v, ok := flakyReceived.Load("msg-a")
+	assert.True(t, ok)
+	metadata := v.(*types.Metadata)
+	assert.Equal(t, "2", metadata.GetValue(KeyRedeliveryAttempt))
+	assert.Equal(t, "downstream unavailable", metadata.GetValue(KeyDeadLetterError))
+	assert.Equal(t, "s1", metadata.GetValue(KeyDeadLetterNodeId))
+	assert.Equal(t, "a", metadata.GetValue("index"))
+}
+
+func TestPark(t *testing.T) {
+	pool := engine.NewPool()
+	defer pool.Stop()
+	store := NewMemoryStore()
+	worker := NewWorker(store, pool, Config{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	worker.config.Jitter = 0
+
+	newFlakyChain(t, pool, "dlParkChain", "")
+	atomic.StoreInt32(&flakyBroken, 1)
+	defer atomic.StoreInt32(&flakyBroken, 0)
+
+	//作为OnDeadLetter回调使用
+	worker.Capture("dlParkChain", "s1", types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "park"), errors.New("first"))
+	worker.Capture("notFoundChain", "s1", types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "lost"), errors.New("first"))
+	//重新投递的消息不再捕获
+	redelivered := types.NewMetadata()
+	redelivered.PutValue(KeyDeadLetterId, "x")
+	worker.Capture("dlParkChain", "s1", types.NewMsg(0, "TEST", types.JSON, redelivered, "ignored"), errors.New("first"))
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Millisecond * 3)
+		worker.RedeliverDue()
+	}
+	entries, _ := store.List()
+	assert.Equal(t, 2, len(entries))
+	reasons := make(map[string]string)
+	for _, entry := range entries {
+		assert.Equal(t, StatusParked, entry.Status)
+		assert.Equal(t, 2, entry.Attempts)
+		reasons[entry.Msg.GetData()] = entry.ParkReason
+	}
+	assert.Equal(t, "max attempts 2 exceeded, last error: downstream unavailable", reasons["park"])
+	assert.Equal(t, "max attempts 2 exceeded, last error: rule chain not found", reasons["lost"])
+	assert.Equal(t, 2, worker.Stats().Parked)
+}
+
+func TestRedeliveryDisabled(t *testing.T) {
+	pool := engine.NewPool()
+	defer pool.Stop()
+	store := NewMemoryStore()
+	worker := NewWorker(store, pool, Config{InitialBackoff: time.Millisecond})
+	worker.config.Jitter = 0
+	newFlakyChain(t, pool, "dlDisabledChain", `"deadLetterRedelivery": false`)
+
+	worker.Capture("dlDisabledChain", "s1", types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "keep"), errors.New("first"))
+	time.Sleep(time.Millisecond * 3)
+	assert.Equal(t, 0, worker.RedeliverDue())
+	entries, _ := store.List()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, 0, entries[0].Attempts)
+}
+
+func TestCaptureSpilled(t *testing.T) {
+	dir := t.TempDir()
+	store := NewMemoryStore()
+	worker := NewWorker(store, engine.NewPool(), Config{})
+	payload := strings.Repeat("a", 100)
+	msg := types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), payload)
+	file, err := msg.Data.Spill(dir)
+	assert.Nil(t, err)
+	file.Retain()
+	worker.Capture("dlSpillChain", "s1", msg, errors.New("first"))
+	//规则链执行结束，删除落盘文件，死信仍然可以读取数据
+	file.Release()
+	entries, _ := store.List()
+	assert.Equal(t, 1, len(entries))
+	assert.False(t, entries[0].Msg.IsSpilled())
+	assert.Equal(t, payload, entries[0].Msg.GetData())
+	assert.Equal(t, StatusPending, entries[0].Status)
+
+	//落盘文件已经删除，无法重新投递，直接搁置
+	worker.Capture("dlSpillChain", "s1", msg, errors.New("second"))
+	entries, _ = store.List()
+	assert.Equal(t, 2, len(entries))
+	//两条死信可能在同一毫秒记录，按照错误信息查找
+	for _, entry := range entries {
+		if entry.Error == "second" {
+			assert.Equal(t, StatusParked, entry.Status)
+			assert.True(t, strings.HasPrefix(entry.ParkReason, "load spilled data error"))
+		} else {
+			assert.Equal(t, StatusPending, entry.Status)
+		}
+	}
+}
+
+func TestFileStoreRestart(t *testing.T) {
+	dir := t.TempDir()
+	pool := engine.NewPool()
+	defer pool.Stop()
+	newFlakyChain(t, pool, "dlFileChain", "")
+
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	worker := NewWorker(store, pool, Config{InitialBackoff: time.Millisecond, MaxBackoff: time.Hour, Multiplier: 1000})
+	worker.config.Jitter = 0
+	atomic.StoreInt32(&flakyBroken, 1)
+	worker.Capture("dlFileChain", "s1", types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "restart"), errors.New("first"))
+	time.Sleep(time.Millisecond * 3)
+	assert.Equal(t, 1, worker.RedeliverDue())
+	atomic.StoreInt32(&flakyBroken, 0)
+
+	//模拟重启，投递次数和下次投递时间从文件恢复，未到期不投递
+	store, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	worker = NewWorker(store, pool, Config{})
+	entries, _ := store.List()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, 1, entries[0].Attempts)
+	assert.Equal(t, "downstream unavailable", entries[0].Error)
+	assert.Equal(t, "restart", entries[0].Msg.GetData())
+	assert.Equal(t, 0, worker.RedeliverDue())
+
+	//到期后投递成功并删除文件
+	entries[0].NextAttemptAt = 0
+	assert.Nil(t, store.Save(entries[0]))
+	assert.Equal(t, 1, worker.RedeliverDue())
+	store, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	entries, _ = store.List()
+	assert.Equal(t, 0, len(entries))
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timeout")
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package deadletter provides a dead-letter store and a redelivery worker for the RuleGo rule engine.
+//
+// Failed messages are captured into a Store by the capture aspect, or by Worker.Capture which can be used as
+// types.Config.OnDeadLetter. The Worker redelivers them into the original rule chain with exponential backoff
+// and jitter, and parks them permanently after the maximum number of attempts.
+// The redelivery schedule of each message is kept in the store, so a FileStore backed worker resumes after restarts.
+package deadletter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+const (
+	// StatusPending 等待重新投递
+	StatusPending = "pending"
+	// StatusParked 超过最大投递次数，永久搁置，不再投递
+	StatusParked = "parked"
+)
+
+// Entry 死信记录
+type Entry struct {
+	// Id 死信ID
+	Id string `json:"id"`
+	// ChainId 原规则链ID，重新投递到该规则链
+	ChainId string `json:"chainId"`
+	// NodeId 失败的节点ID
+	NodeId string `json:"nodeId"`
+	// Msg 原始消息
+	Msg types.RuleMsg `json:"msg"`
+	// Error 最近一次失败的错误信息
+	Error string `json:"error"`
+	// Attempts 已经重新投递的次数
+	Attempts int `json:"attempts"`
+	// Status 状态：pending/parked
+	Status string `json:"status"`
+	// ParkReason 搁置原因
+	ParkReason string `json:"parkReason,omitempty"`
+	// CreatedAt 记录时间，单位毫秒
+	CreatedAt int64 `json:"createdAt"`
+	// NextAttemptAt 下次投递时间，单位毫秒
+	NextAttemptAt int64 `json:"nextAttemptAt"`
+}
+
+// Store 死信存储
+type Store interface {
+	// Save 保存死信，存在则覆盖
+	Save(entry Entry) error
+	// Delete 删除死信
+	Delete(id string) error
+	// List 获取所有死信，按照记录时间排序
+	List() ([]Entry, error)
+}
+
+// MemoryStore 内存死信存储，重启后丢失
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]Entry
+}
+
+// NewMemoryStore 创建内存死信存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry)}
+}
+
+func (s *MemoryStore) Save(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.Id] = copyEntry(entry)
+	return nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+	return nil
+}
+
+func (s *MemoryStore) List() ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, copyEntry(entry))
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// FileStore 文件死信存储，每条死信保存为目录下的一个JSON文件，重启后恢复
+type FileStore struct {
+	mu      sync.RWMutex
+	dir     string
+	entries map[string]Entry
+}
+
+// NewFileStore 创建文件死信存储，并加载目录下已有的死信
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{dir: dir, entries: make(map[string]Entry)}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, err
+		}
+		s.entries[entry.Id] = entry
+	}
+	return s, nil
+}
+
+func (s *FileStore) Save(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	//先写临时文件再重命名，防止写入过程中退出导致文件损坏
+	path := s.path(entry.Id)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	s.entries[entry.Id] = copyEntry(entry)
+	return nil
+}
+
+func (s *FileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(s.entries, id)
+	return nil
+}
+
+func (s *FileStore) List() ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, copyEntry(entry))
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
+
+// copyEntry 拷贝消息，防止调用方修改存储中的消息
+func copyEntry(entry Entry) Entry {
+	entry.Msg = entry.Msg.Copy()
+	return entry
+}
+
+func sortEntries(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].CreatedAt == entries[j].CreatedAt {
+			return entries[i].Id < entries[j].Id
+		}
+		return entries[i].CreatedAt < entries[j].CreatedAt
+	})
+}
@@ -0,0 +1,330 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadletter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/cast"
+)
+
+const (
+	// KeyDeadLetterId 重新投递消息的元数据：死信ID
+	KeyDeadLetterId = "_deadLetterId"
+	// KeyRedeliveryAttempt 重新投递消息的元数据：第几次投递，从1开始
+	KeyRedeliveryAttempt = "_redeliveryAttempt"
+	// KeyDeadLetterError 重新投递消息的元数据：上一次失败的错误信息
+	KeyDeadLetterError = "_deadLetterError"
+	// KeyDeadLetterNodeId 重新投递消息的元数据：失败的节点ID
+	KeyDeadLetterNodeId = "_deadLetterNodeId"
+)
+
+// KeyRedeliveryEnabled 规则链配置：是否允许重新投递该规则链的死信，默认true
+// 例如："ruleChain": {"configuration": {"deadLetterRedelivery": false}}
+const KeyRedeliveryEnabled = "deadLetterRedelivery"
+
+// ErrChainNotFound 规则链不存在
+var ErrChainNotFound = errors.New("rule chain not found")
+
+// Config 重新投递配置
+type Config struct {
+	// MaxAttempts 最大投递次数，超过后搁置，默认5
+	MaxAttempts int
+	// InitialBackoff 首次投递的等待时间，默认1秒
+	InitialBackoff time.Duration
+	// MaxBackoff 最大等待时间，默认5分钟
+	MaxBackoff time.Duration
+	// Multiplier 每次失败后等待时间的倍数，默认2
+	Multiplier float64
+	// Jitter 等待时间的随机抖动比例，取值[0,1]，默认0.2，即±20%，防止大量死信同时投递
+	Jitter float64
+	// PollInterval 检查到期死信的间隔，默认1秒
+	PollInterval time.Duration
+	// BatchSize 每次检查最多投递的死信数量，默认100
+	BatchSize int
+}
+
+// Stats 死信队列指标
+type Stats struct {
+	// Pending 等待投递的死信数量
+	Pending int `json:"pending"`
+	// Parked 已经搁置的死信数量
+	Parked int `json:"parked"`
+	// OldestPendingAgeMs 最早的等待投递死信的时长，单位毫秒
+	OldestPendingAgeMs int64 `json:"oldestPendingAgeMs"`
+	// AvgPendingAgeMs 等待投递死信的平均时长，单位毫秒
+	AvgPendingAgeMs int64 `json:"avgPendingAgeMs"`
+	// Redelivered 投递次数
+	Redelivered int64 `json:"redelivered"`
+	// Succeeded 投递成功次数
+	Succeeded int64 `json:"succeeded"`
+	// Failed 投递失败次数
+	Failed int64 `json:"failed"`
+}
+
+// Worker 死信重新投递器
+// 定时把到期的死信投递到原规则链，投递失败则按照指数退避计算下次投递时间，超过最大投递次数后搁置
+// 每条死信的投递次数和下次投递时间保存在存储中，投递前先保存，重启后从存储中恢复
+type Worker struct {
+	store  Store
+	pool   types.RuleEnginePool
+	config Config
+
+	mu      sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+	running bool
+
+	redelivered int64
+	succeeded   int64
+	failed      int64
+}
+
+// NewWorker 创建死信重新投递器，pool 为原规则链所在的规则引擎池
+func NewWorker(store Store, pool types.RuleEnginePool, config Config) *Worker {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = time.Minute * 5
+	}
+	if config.Multiplier < 1 {
+		config.Multiplier = 2
+	}
+	if config.Jitter < 0 || config.Jitter > 1 {
+		config.Jitter = 0.2
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	return &Worker{store: store, pool: pool, config: config}
+}
+
+// Store 死信存储
+func (w *Worker) Store() Store {
+	return w.store
+}
+
+// Start 启动后台投递
+func (w *Worker) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running {
+		return
+	}
+	w.running = true
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.run(w.stop, w.done)
+}
+
+// Stop 停止后台投递，等待正在进行的投递结束
+func (w *Worker) Stop() {
+	w.mu.Lock()
+	if !w.running {
+		w.mu.Unlock()
+		return
+	}
+	w.running = false
+	close(w.stop)
+	done := w.done
+	w.mu.Unlock()
+	<-done
+}
+
+// Capture 记录死信，签名和 types.Config.OnDeadLetter 一致，可以直接作为死信回调
+// 如果消息是重新投递的消息，则忽略，由投递器处理
+func (w *Worker) Capture(ruleChainId string, nodeId string, msg types.RuleMsg, err error) {
+	if msg.Metadata != nil && msg.Metadata.Has(KeyDeadLetterId) {
+		return
+	}
+	uuId, _ := uuid.NewV4()
+	now := time.Now()
+	entry := Entry{
+		Id:            uuId.String(),
+		ChainId:       ruleChainId,
+		NodeId:        nodeId,
+		Msg:           msg.Copy(),
+		Status:        StatusPending,
+		CreatedAt:     now.UnixMilli(),
+		NextAttemptAt: now.Add(w.backoff(0)).UnixMilli(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	//消息执行结束后溢出到磁盘的数据会被删除，先读回内存
+	if entry.Msg.IsSpilled() {
+		if loadErr := entry.Msg.Data.Load(); loadErr != nil {
+			entry.Status = StatusParked
+			entry.ParkReason = "load spilled data error: " + loadErr.Error()
+		}
+	}
+	_ = w.store.Save(entry)
+}
+
+// Stats 获取死信队列指标
+func (w *Worker) Stats() Stats {
+	stats := Stats{
+		Redelivered: atomic.LoadInt64(&w.redelivered),
+		Succeeded:   atomic.LoadInt64(&w.succeeded),
+		Failed:      atomic.LoadInt64(&w.failed),
+	}
+	entries, err := w.store.List()
+	if err != nil {
+		return stats
+	}
+	now := time.Now().UnixMilli()
+	var totalAge int64
+	for _, entry := range entries {
+		if entry.Status == StatusParked {
+			stats.Parked++
+			continue
+		}
+		stats.Pending++
+		age := now - entry.CreatedAt
+		totalAge += age
+		if age > stats.OldestPendingAgeMs {
+			stats.OldestPendingAgeMs = age
+		}
+	}
+	if stats.Pending > 0 {
+		stats.AvgPendingAgeMs = totalAge / int64(stats.Pending)
+	}
+	return stats
+}
+
+// RedeliverDue 投递所有到期的死信，返回投递数量
+func (w *Worker) RedeliverDue() int {
+	entries, err := w.store.List()
+	if err != nil {
+		return 0
+	}
+	now := time.Now().UnixMilli()
+	count := 0
+	for _, entry := range entries {
+		if count >= w.config.BatchSize {
+			break
+		}
+		if entry.Status != StatusPending || entry.NextAttemptAt > now {
+			continue
+		}
+		if w.redeliver(entry) {
+			count++
+		}
+	}
+	return count
+}
+
+func (w *Worker) run(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.RedeliverDue()
+		}
+	}
+}
+
+// redeliver 投递一条死信，返回是否进行了投递
+func (w *Worker) redeliver(entry Entry) bool {
+	ruleEngine, ok := w.pool.Get(entry.ChainId)
+	if ok && !redeliveryEnabled(ruleEngine.Definition()) {
+		//规则链关闭了重新投递，保留死信
+		return false
+	}
+	entry.Attempts++
+	//投递前先保存下次投递时间，投递过程中退出也不会立即重复投递
+	entry.NextAttemptAt = time.Now().Add(w.backoff(entry.Attempts)).UnixMilli()
+	if err := w.store.Save(entry); err != nil {
+		return false
+	}
+	atomic.AddInt64(&w.redelivered, 1)
+
+	var deliverErr error
+	if !ok {
+		deliverErr = ErrChainNotFound
+	} else {
+		msg := entry.Msg.Copy()
+		msg.Metadata.PutValue(KeyDeadLetterId, entry.Id)
+		msg.Metadata.PutValue(KeyRedeliveryAttempt, strconv.Itoa(entry.Attempts))
+		msg.Metadata.PutValue(KeyDeadLetterError, entry.Error)
+		msg.Metadata.PutValue(KeyDeadLetterNodeId, entry.NodeId)
+		var mu sync.Mutex
+		ruleEngine.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			if err != nil {
+				mu.Lock()
+				if deliverErr == nil {
+					deliverErr = err
+				}
+				mu.Unlock()
+			}
+		}))
+	}
+
+	if deliverErr == nil {
+		atomic.AddInt64(&w.succeeded, 1)
+		_ = w.store.Delete(entry.Id)
+		return true
+	}
+	atomic.AddInt64(&w.failed, 1)
+	entry.Error = deliverErr.Error()
+	if entry.Attempts >= w.config.MaxAttempts {
+		entry.Status = StatusParked
+		entry.ParkReason = fmt.Sprintf("max attempts %d exceeded, last error: %s", w.config.MaxAttempts, entry.Error)
+	}
+	_ = w.store.Save(entry)
+	return true
+}
+
+// backoff 第attempts次失败后的等待时间，加上随机抖动
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := float64(w.config.InitialBackoff) * math.Pow(w.config.Multiplier, float64(attempts))
+	if d > float64(w.config.MaxBackoff) {
+		d = float64(w.config.MaxBackoff)
+	}
+	if w.config.Jitter > 0 {
+		d = d * (1 + w.config.Jitter*(rand.Float64()*2-1))
+	}
+	return time.Duration(d)
+}
+
+// redeliveryEnabled 规则链是否允许重新投递
+func redeliveryEnabled(def types.RuleChain) bool {
+	if v, ok := def.RuleChain.Configuration[KeyRedeliveryEnabled]; ok {
+		return cast.ToBool(v)
+	}
+	return true
+}
@@ -34,9 +34,13 @@ package processor
 
 import (
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"strings"
 	"sync"
 
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/api/types/endpoint"
 )
@@ -172,3 +176,91 @@ func (b *builtins) Names() []string {
 	}
 	return keys
 }
+
+// Build creates the processor of the DSL entry, wrapping the registered processor with the condition and error policy.
+// The condition is compiled here, so an invalid expression is reported when the router is added.
+func (b *builtins) Build(def types.ProcessorDsl) (endpoint.Process, error) {
+	p, ok := b.Get(def.Name)
+	if !ok {
+		return nil, errors.New("processor not found: " + def.Name)
+	}
+	return NewConditional(p, def.Condition, def.ContinueOnError)
+}
+
+// NewConditional wraps the processor so that it runs only if the condition evaluates to true,
+// and a failure does not abort the exchange if continueOnError is true.
+// The condition is an expr expression over the variables: headers, metadata, from and path. An empty condition always runs.
+func NewConditional(p endpoint.Process, condition string, continueOnError bool) (endpoint.Process, error) {
+	condition = strings.TrimSpace(condition)
+	if condition == "" && !continueOnError {
+		return p, nil
+	}
+	var program *vm.Program
+	if condition != "" {
+		var err error
+		if program, err = expr.Compile(condition, expr.AllowUndefinedVariables(), expr.AsBool()); err != nil {
+			return nil, fmt.Errorf("invalid processor condition %q: %w", condition, err)
+		}
+	}
+	return func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		if program != nil {
+			out, err := vm.Run(program, conditionEnv(exchange))
+			if err != nil {
+				//条件无法计算时按处理器失败处理，防止跳过鉴权等处理器
+				return continueOnError
+			}
+			if out != true {
+				return true
+			}
+		}
+		var errBefore error
+		if exchange.Out != nil {
+			errBefore = exchange.Out.GetError()
+		}
+		if p(router, exchange) {
+			return true
+		}
+		if continueOnError {
+			//恢复处理器设置的错误
+			if exchange.Out != nil && exchange.Out.GetError() != errBefore {
+				exchange.Out.SetError(errBefore)
+			}
+			return true
+		}
+		return false
+	}, nil
+}
+
+// conditionEnv 条件表达式变量
+func conditionEnv(exchange *endpoint.Exchange) map[string]interface{} {
+	env := make(map[string]interface{}, 4)
+	headers := make(map[string]string)
+	metadata := make(map[string]string)
+	var from string
+	if exchange.In != nil {
+		for k := range exchange.In.Headers() {
+			headers[k] = exchange.In.Headers().Get(k)
+		}
+		from = exchange.In.From()
+	}
+	//out端处理器使用规则链输出消息的元数据
+	var msg *types.RuleMsg
+	if exchange.Out != nil {
+		msg = exchange.Out.GetMsg()
+	}
+	if msg == nil && exchange.In != nil {
+		msg = exchange.In.GetMsg()
+	}
+	if msg != nil && msg.Metadata != nil {
+		metadata = msg.Metadata.Values()
+	}
+	path := from
+	if index := strings.IndexByte(path, '?'); index >= 0 {
+		path = path[:index]
+	}
+	env["headers"] = headers
+	env["metadata"] = metadata
+	env["from"] = from
+	env["path"] = path
+	return env
+}
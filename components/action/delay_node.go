@@ -36,6 +36,7 @@ import (
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var DelayNodeMsgType = "DELAY_NODE_MSG_TYPE"
@@ -112,8 +113,16 @@ func (x *DelayNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 		} else {
 			ctx.TellFailure(msg, fmt.Errorf("msg not found"))
 		}
-
-	} else if oldMsgId := x.LastPendingMsgId.Load().(string); oldMsgId != "" {
+		return
+	}
+	//延迟期间消息的执行可能已经结束，例如被看门狗终止或者被覆盖，溢出到磁盘的数据会被删除，需要先读回内存
+	if msg.IsSpilled() {
+		if err := msg.Data.Load(); err != nil {
+			ctx.TellFailure(msg, err)
+			return
+		}
+	}
+	if oldMsgId := x.LastPendingMsgId.Load().(string); oldMsgId != "" {
 		//如果是覆盖模式，替换队列里的消息
 		x.mu.Lock()
 		defer x.mu.Unlock()
@@ -146,6 +155,8 @@ func (x *DelayNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 
 			ackMsg := msg.Copy()
 			ackMsg.Type = DelayNodeMsgType
+			//延迟期间不计入规则链的最大处理时间
+			types.ExtendDeadline(ctx.GetContext(), time.Duration(periodInSeconds)*time.Second)
 			ctx.TellSelf(ackMsg, int64(periodInSeconds*1000))
 		} else {
 			ctx.TellFailure(msg, fmt.Errorf("max limit of pending messages"))
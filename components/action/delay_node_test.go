@@ -135,6 +135,25 @@ func TestDelayNode(t *testing.T) {
 	})
 
 	//覆盖模式
+	t.Run("Spilled", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"periodInSeconds": 1,
+		}, Registry)
+		assert.Nil(t, err)
+		result := make(chan string, 1)
+		ctx := test.NewRuleContextFull(types.NewConfig(), node, nil, func(msg types.RuleMsg, relationType string, err error) {
+			result <- relationType + ":" + msg.GetData()
+		})
+		msg := ctx.NewMsg("TEST", types.NewMetadata(), "AA")
+		file, err := msg.Data.Spill(t.TempDir())
+		assert.Nil(t, err)
+		file.Retain()
+		node.OnMsg(ctx, msg)
+		//延迟期间消息的执行已经结束，落盘文件被删除
+		file.Release()
+		assert.Equal(t, types.Success+":AA", <-result)
+	})
+
 	t.Run("Overlay", func(t *testing.T) {
 		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
 			"periodInSeconds": 5,
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/aggregate"
 	"github.com/rulego/rulego/utils/maps"
 	"github.com/rulego/rulego/utils/str"
 )
@@ -45,6 +46,9 @@ type GroupActionNodeConfiguration struct {
 	NodeIds interface{}
 	//Timeout 执行超时，单位秒，默认0：代表不限制。
 	Timeout int
+	//Aggregations 聚合组内节点输出消息数据的数值字段，结果写入合并消息的元数据，只聚合执行成功的节点输出，按照 NodeIds 顺序计算first和last
+	//例如：[{"path":"score","funcs":["min","max","avg"]}]，结果写入元数据score_min、score_max、score_avg，非数值或者缺失的数量写入score_invalid
+	Aggregations []aggregate.Aggregation
 }
 
 // GroupActionNode 把多个节点组成一个分组,异步执行所有节点，等待所有节点执行完成后，把所有节点结果合并，发送到下一个节点
@@ -95,7 +99,10 @@ func (x *GroupActionNode) Init(ruleConfig types.Config, configuration types.Conf
 		x.Config.MatchNum = len(x.NodeIdList)
 	}
 	x.Length = int32(len(x.NodeIdList))
-	return err
+	if err != nil {
+		return err
+	}
+	return aggregate.InitAll(x.Config.Aggregations)
 }
 
 // OnMsg 处理消息
@@ -153,12 +160,14 @@ func (x *GroupActionNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 					if atomic.CompareAndSwapInt32(&completed, 0, 1) {
 					wrapperMsg.SetData(str.ToString(filterEmptyAndRemoveMeta(msgs)))
 					mergeMetadata(msgs, &wrapperMsg)
+					x.aggregate(msgs, &wrapperMsg)
 					c <- true
 				}
 				} else if atomic.LoadInt32(&endCount) >= x.Length {
 					if atomic.CompareAndSwapInt32(&completed, 0, 1) {
 					wrapperMsg.SetData(str.ToString(filterEmptyAndRemoveMeta(msgs)))
 					mergeMetadata(msgs, &wrapperMsg)
+					x.aggregate(msgs, &wrapperMsg)
 					c <- false
 				}
 				}
@@ -185,6 +194,20 @@ func (x *GroupActionNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 func (x *GroupActionNode) Destroy() {
 }
 
+// aggregate 聚合执行成功的节点输出，结果写入合并消息的元数据
+func (x *GroupActionNode) aggregate(msgs []types.WrapperMsg, wrapperMsg *types.RuleMsg) {
+	if len(x.Config.Aggregations) == 0 {
+		return
+	}
+	var outputs []types.RuleMsg
+	for _, msg := range msgs {
+		if msg.NodeId != "" && msg.Err == "" {
+			outputs = append(outputs, msg.Msg)
+		}
+	}
+	aggregate.ApplyAll(x.Config.Aggregations, outputs, wrapperMsg.Metadata)
+}
+
 // 过滤空值，返回新的数组
 func filterEmptyAndRemoveMeta(msgs []types.WrapperMsg) []types.WrapperMsg {
 	var result []types.WrapperMsg
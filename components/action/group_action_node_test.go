@@ -250,4 +250,60 @@ func TestGroupFilterNode(t *testing.T) {
 		time.Sleep(time.Millisecond * 20)
 
 	})
+
+	t.Run("Aggregations", func(t *testing.T) {
+		_, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"nodeIds":      "score1,score2",
+			"aggregations": []interface{}{map[string]interface{}{"path": "score", "funcs": "median"}},
+		}, Registry)
+		assert.NotNil(t, err)
+
+		for name, data := range map[string]string{"groupActionScore1": `{"score":70}`, "groupActionScore2": `{"score":90.5}`, "groupActionScore3": `{"score":"n/a"}`} {
+			output := data
+			Functions.Register(name, func(ctx types.RuleContext, msg types.RuleMsg) {
+				ctx.TellSuccess(types.NewMsg(0, msg.Type, types.JSON, types.NewMetadata(), output))
+			})
+		}
+		childrenNodes := map[string]types.Node{}
+		for _, nodeId := range []string{"score1", "score2", "score3"} {
+			node, _ := test.CreateAndInitNode("functions", types.Configuration{
+				"functionName": "groupActionScore" + nodeId[len(nodeId)-1:],
+			}, Registry)
+			childrenNodes[nodeId] = node
+		}
+		childrenNodes["failure"], _ = test.CreateAndInitNode("functions", types.Configuration{
+			"functionName": "groupActionTestFailure",
+		}, Registry)
+
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"nodeIds": "score1,score2,score3,failure",
+			"aggregations": []interface{}{
+				map[string]interface{}{"path": "score", "funcs": "min,max,avg,sum,count,first,last"},
+				map[string]interface{}{"path": "weight", "funcs": []string{"sum"}, "as": "w"},
+			},
+		}, Registry)
+		assert.Nil(t, err)
+		msgList := []test.Msg{
+			{
+				MetaData:   types.NewMetadata(),
+				MsgType:    "ACTIVITY_EVENT1",
+				Data:       "{}",
+				AfterSleep: time.Millisecond * 200,
+			},
+		}
+		test.NodeOnMsgWithChildren(t, node, msgList, childrenNodes, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Failure, relationType)
+			//失败节点的输出不参与聚合
+			assert.Equal(t, "70", msg.Metadata.GetValue("score_min"))
+			assert.Equal(t, "90.5", msg.Metadata.GetValue("score_max"))
+			assert.Equal(t, "80.25", msg.Metadata.GetValue("score_avg"))
+			assert.Equal(t, "160.5", msg.Metadata.GetValue("score_sum"))
+			assert.Equal(t, "2", msg.Metadata.GetValue("score_count"))
+			assert.Equal(t, "70", msg.Metadata.GetValue("score_first"))
+			assert.Equal(t, "90.5", msg.Metadata.GetValue("score_last"))
+			assert.Equal(t, "1", msg.Metadata.GetValue("score_invalid"))
+			assert.False(t, msg.Metadata.Has("w_sum"))
+			assert.Equal(t, "3", msg.Metadata.GetValue("w_invalid"))
+		})
+	})
 }
@@ -88,6 +88,10 @@ func (x *LogNode) Init(ruleConfig types.Config, configuration types.Configuratio
 	if err == nil {
 		jsScript := fmt.Sprintf("function ToString(msg, metadata, msgType) { %s }", x.Config.JsScript)
 		x.jsEngine, err = js.NewGojaJsEngine(ruleConfig, jsScript, base.NodeUtils.GetVars(configuration))
+		if err == nil {
+			//预热：使用空消息执行一次脚本
+			js.WarmUp(ruleConfig, x.jsEngine, "ToString", map[string]interface{}{}, map[string]string{}, "")
+		}
 	}
 	x.logger = ruleConfig.Logger
 	return err
@@ -0,0 +1,354 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+// Example of rule chain node configuration:
+//{
+//	"id": "s1",
+//	"type": "mapReduce",
+//	"name": "MapReduce",
+//	"configuration": {
+//		"path": "msg.items",
+//		"targetId": "sub_chain_01",
+//		"concurrency": 4,
+//		"reduce": "collect",
+//		"errorPolicy": "failFast"
+//	}
+//}
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/js"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/str"
+)
+
+const (
+	// KeyMapReduceErrors is the metadata key of the per-element errors, format: [{"index":1,"error":"..."}]
+	KeyMapReduceErrors = "_mapReduceErrors"
+)
+
+const (
+	// ReduceCollect collects the outputs of all elements into an array, preserving input order.
+	ReduceCollect = "collect"
+	// ReduceMerge merges the object outputs of all elements into one object, later elements override earlier ones.
+	ReduceMerge = "merge"
+	// ReduceJs reduces the outputs with a custom js script.
+	ReduceJs = "js"
+)
+
+const (
+	// ErrorPolicyFailFast stops dispatching remaining elements on the first error and sends the msg to the `Failure` chain.
+	ErrorPolicyFailFast = "failFast"
+	// ErrorPolicyContinue processes all elements, reports per-element errors in metadata and sends the msg to the `Success` chain.
+	ErrorPolicyContinue = "continue"
+)
+
+const (
+	// MapReduceJsFuncTemplate js reduce function template
+	MapReduceJsFuncTemplate = "function Reduce(results, metadata, msgType) { %s }"
+	// MapReduceJsFuncName js reduce function name
+	MapReduceJsFuncName = "Reduce"
+)
+
+func init() {
+	Registry.Add(&MapReduceNode{})
+}
+
+// MapReduceNodeConfiguration defines the configuration for the MapReduceNode.
+type MapReduceNodeConfiguration struct {
+	// Path is the expr expression of the array to map over, e.g., msg.items.
+	// If empty, the msg payload is used.
+	Path string
+	// TargetId is the sub-rule chain id that processes each element.
+	TargetId string `required:"true"`
+	// Concurrency is the maximum number of elements processed concurrently, default 4.
+	Concurrency int
+	// Reduce is the reduce strategy: collect, merge or js. Default collect.
+	Reduce string
+	// JsScript is the js reduce script body, used when Reduce is js.
+	// It is wrapped as: function Reduce(results, metadata, msgType) { ${JsScript} }
+	// results is the outputs of all elements in input order, the return value is used as msg payload.
+	JsScript string
+	// ErrorPolicy is the error policy: failFast or continue. Default failFast.
+	ErrorPolicy string
+}
+
+// mapReduceError is the error of an element.
+type mapReduceError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// MapReduceNode fans each element of an array into a sub-rule chain and combines the outputs into one message.
+// Each element is sent to the sub-rule chain as the msg payload, use metadata._loopIndex to get the index of the element.
+// The terminal msgs of each element are gathered preserving input order: a single terminal msg is used as the
+// element output, multiple terminal msgs are combined into an array.
+// If the context is canceled, remaining elements are not dispatched and the msg is sent to the `Failure` chain.
+type MapReduceNode struct {
+	//节点配置
+	Config   MapReduceNodeConfiguration
+	program  *vm.Program
+	jsEngine types.JsEngine
+}
+
+// Type 组件类型
+func (x *MapReduceNode) Type() string {
+	return "mapReduce"
+}
+
+func (x *MapReduceNode) New() types.Node {
+	return &MapReduceNode{Config: MapReduceNodeConfiguration{
+		Path:        "msg.items",
+		Concurrency: 4,
+		Reduce:      ReduceCollect,
+		ErrorPolicy: ErrorPolicyFailFast,
+	}}
+}
+
+// Init 初始化
+func (x *MapReduceNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	if err := maps.Map2Struct(configuration, &x.Config); err != nil {
+		return err
+	}
+	x.Config.TargetId = strings.TrimSpace(x.Config.TargetId)
+	if x.Config.TargetId == "" {
+		return errors.New("targetId is empty")
+	}
+	x.Config.Path = strings.TrimSpace(x.Config.Path)
+	if x.Config.Path != "" {
+		if program, err := expr.Compile(x.Config.Path, expr.AllowUndefinedVariables()); err != nil {
+			return err
+		} else {
+			x.program = program
+		}
+	}
+	if x.Config.Concurrency <= 0 {
+		x.Config.Concurrency = 4
+	}
+	switch x.Config.ErrorPolicy {
+	case "":
+		x.Config.ErrorPolicy = ErrorPolicyFailFast
+	case ErrorPolicyFailFast, ErrorPolicyContinue:
+	default:
+		return fmt.Errorf("unsupported error policy: %s", x.Config.ErrorPolicy)
+	}
+	switch x.Config.Reduce {
+	case "":
+		x.Config.Reduce = ReduceCollect
+	case ReduceCollect, ReduceMerge:
+	case ReduceJs:
+		if strings.TrimSpace(x.Config.JsScript) == "" {
+			return errors.New("jsScript is empty")
+		}
+		jsEngine, err := js.NewGojaJsEngine(ruleConfig, fmt.Sprintf(MapReduceJsFuncTemplate, x.Config.JsScript), base.NodeUtils.GetVars(configuration))
+		if err != nil {
+			return err
+		}
+		x.jsEngine = jsEngine
+	default:
+		return fmt.Errorf("unsupported reduce: %s", x.Config.Reduce)
+	}
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *MapReduceNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	items, err := x.getItems(ctx, msg)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	results, itemErrors, err := x.mapItems(ctx, msg, items)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	if len(itemErrors) > 0 {
+		msg.Metadata.PutValue(KeyMapReduceErrors, str.ToString(itemErrors))
+		if x.Config.ErrorPolicy == ErrorPolicyFailFast {
+			ctx.TellFailure(msg, fmt.Errorf("element %d failed: %s", itemErrors[0].Index, itemErrors[0].Error))
+			return
+		}
+	}
+	out, err := x.reduce(ctx, msg, results)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	msg.DataType = types.JSON
+	msg.SetData(out)
+	ctx.TellSuccess(msg)
+}
+
+// Destroy 销毁
+func (x *MapReduceNode) Destroy() {
+	if x.jsEngine != nil {
+		x.jsEngine.Stop()
+	}
+}
+
+// getItems 获取需要遍历的数组
+func (x *MapReduceNode) getItems(ctx types.RuleContext, msg types.RuleMsg) ([]interface{}, error) {
+	var data interface{}
+	if x.program != nil {
+		out, err := vm.Run(x.program, base.NodeUtils.GetEvn(ctx, msg))
+		if err != nil {
+			return nil, err
+		}
+		data = out
+	} else if err := json.Unmarshal([]byte(msg.GetData()), &data); err != nil {
+		return nil, err
+	}
+	switch v := data.(type) {
+	case []interface{}:
+		return v, nil
+	case []int:
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, errors.New("must array type")
+	}
+}
+
+// mapItems 把每个元素发送到子规则链处理，返回按输入顺序排列的输出
+func (x *MapReduceNode) mapItems(ctx types.RuleContext, msg types.RuleMsg, items []interface{}) ([]interface{}, []mapReduceError, error) {
+	parentCtx := ctx.GetContext()
+	ctxWithCancel, cancel := context.WithCancel(parentCtx)
+	defer cancel()
+
+	results := make([]interface{}, len(items))
+	var itemErrors []mapReduceError
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, x.Config.Concurrency)
+
+dispatch:
+	for index, item := range items {
+		select {
+		case <-ctxWithCancel.Done():
+			break dispatch
+		case sem <- struct{}{}:
+		}
+		//获取令牌后再检查一次，防止失败或者取消后继续分发
+		if ctxWithCancel.Err() != nil {
+			<-sem
+			break
+		}
+		itemMsg := msg.Copy()
+		itemMsg.SetData(str.ToString(item))
+		itemMsg.Metadata.PutValue(KeyLoopIndex, strconv.Itoa(index))
+		i := index
+		var outputs []string
+		var itemErr error
+		wg.Add(1)
+		ctx.TellFlow(ctxWithCancel, x.Config.TargetId, itemMsg, func(_ types.RuleContext, onEndMsg types.RuleMsg, err error, relationType string) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if itemErr == nil {
+					itemErr = err
+				}
+			} else {
+				outputs = append(outputs, onEndMsg.GetData())
+			}
+		}, func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			mu.Lock()
+			defer mu.Unlock()
+			if itemErr != nil {
+				itemErrors = append(itemErrors, mapReduceError{Index: i, Error: itemErr.Error()})
+				if x.Config.ErrorPolicy == ErrorPolicyFailFast {
+					cancel()
+				}
+				return
+			}
+			if len(outputs) == 1 {
+				results[i] = toJsonValue(outputs[0])
+			} else {
+				var values []interface{}
+				for _, output := range outputs {
+					values = append(values, toJsonValue(output))
+				}
+				results[i] = values
+			}
+		})
+	}
+	wg.Wait()
+	if err := parentCtx.Err(); err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(itemErrors, func(i, j int) bool {
+		return itemErrors[i].Index < itemErrors[j].Index
+	})
+	return results, itemErrors, nil
+}
+
+// reduce 合并所有元素的输出
+func (x *MapReduceNode) reduce(ctx types.RuleContext, msg types.RuleMsg, results []interface{}) (string, error) {
+	switch x.Config.Reduce {
+	case ReduceMerge:
+		merged := make(map[string]interface{})
+		for index, result := range results {
+			if result == nil {
+				continue
+			}
+			if v, ok := result.(map[string]interface{}); ok {
+				for key, value := range v {
+					merged[key] = value
+				}
+			} else {
+				return "", fmt.Errorf("element %d output is not an object", index)
+			}
+		}
+		return str.ToString(merged), nil
+	case ReduceJs:
+		out, err := x.jsEngine.Execute(ctx, MapReduceJsFuncName, results, msg.Metadata.Values(), msg.Type)
+		if err != nil {
+			return "", err
+		}
+		return str.ToStringMaybeErr(out)
+	default:
+		return str.ToString(results), nil
+	}
+}
+
+// toJsonValue 如果是JSON则解析，否则返回原字符串
+func toJsonValue(data string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err == nil {
+		return v
+	}
+	return data
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/json"
+)
+
+// mapReduceTestContext 模拟子规则链：把元素乘以10，元素为"bad"时失败
+type mapReduceTestContext struct {
+	types.RuleContext
+	context    context.Context
+	dispatched int32
+	running    int32
+	maxRunning int32
+}
+
+func (ctx *mapReduceTestContext) GetContext() context.Context {
+	return ctx.context
+}
+
+func (ctx *mapReduceTestContext) TellFlow(chainCtx context.Context, chainId string, msg types.RuleMsg, endFunc types.OnEndFunc, onAllNodeCompleted func()) {
+	atomic.AddInt32(&ctx.dispatched, 1)
+	running := atomic.AddInt32(&ctx.running, 1)
+	for {
+		maxRunning := atomic.LoadInt32(&ctx.maxRunning)
+		if running <= maxRunning || atomic.CompareAndSwapInt32(&ctx.maxRunning, maxRunning, running) {
+			break
+		}
+	}
+	go func() {
+		//倒序完成，验证结果保持输入顺序
+		index, _ := strconv.Atoi(msg.Metadata.GetValue(KeyLoopIndex))
+		time.Sleep(time.Millisecond * time.Duration(20-index))
+		atomic.AddInt32(&ctx.running, -1)
+		if chainCtx.Err() != nil {
+			endFunc(ctx, msg, chainCtx.Err(), types.Failure)
+		} else if msg.GetData() == "bad" {
+			endFunc(ctx, msg, errors.New("bad element"), types.Failure)
+		} else if msg.GetData() == "multi" {
+			endFunc(ctx, msg, nil, types.Success)
+			endFunc(ctx, msg, nil, types.Success)
+		} else if v, err := strconv.Atoi(msg.GetData()); err == nil {
+			msg.SetData(strconv.Itoa(v * 10))
+			endFunc(ctx, msg, nil, types.Success)
+		} else {
+			endFunc(ctx, msg, nil, types.Success)
+		}
+		onAllNodeCompleted()
+	}()
+}
+
+func newMapReduceTestContext(c context.Context, callback func(msg types.RuleMsg, relationType string, err error)) *mapReduceTestContext {
+	return &mapReduceTestContext{
+		RuleContext: test.NewRuleContext(types.NewConfig(), callback),
+		context:     c,
+	}
+}
+
+func onMapReduceMsg(t *testing.T, node types.Node, c context.Context, data string, callback func(msg types.RuleMsg, relationType string, err error)) *mapReduceTestContext {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	ctx := newMapReduceTestContext(c, func(msg types.RuleMsg, relationType string, err error) {
+		defer wg.Done()
+		callback(msg, relationType, err)
+	})
+	node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), data))
+	wg.Wait()
+	return ctx
+}
+
+func TestMapReduceNode(t *testing.T) {
+	var targetNodeType = "mapReduce"
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &MapReduceNode{}, types.Configuration{
+			"path":        "msg.items",
+			"concurrency": 4,
+			"reduce":      ReduceCollect,
+			"errorPolicy": ErrorPolicyFailFast,
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		_, err := test.CreateAndInitNode(targetNodeType, types.Configuration{}, Registry)
+		assert.Equal(t, "targetId is empty", err.Error())
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"targetId": "sub", "reduce": "xx"}, Registry)
+		assert.NotNil(t, err)
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"targetId": "sub", "errorPolicy": "xx"}, Registry)
+		assert.NotNil(t, err)
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"targetId": "sub", "reduce": ReduceJs}, Registry)
+		assert.Equal(t, "jsScript is empty", err.Error())
+	})
+
+	t.Run("Collect", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"targetId":    "sub",
+			"concurrency": 2,
+		}, Registry)
+		assert.Nil(t, err)
+		ctx := onMapReduceMsg(t, node, context.Background(), `{"items":[1,2,3,4,5,"multi"]}`, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Success, relationType)
+			assert.Equal(t, `[10,20,30,40,50,["multi","multi"]]`, msg.GetData())
+		})
+		assert.True(t, atomic.LoadInt32(&ctx.maxRunning) <= 2)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"path":     "",
+			"targetId": "sub",
+			"reduce":   ReduceMerge,
+		}, Registry)
+		assert.Nil(t, err)
+		onMapReduceMsg(t, node, context.Background(), `[{"a":1},{"b":2},{"a":3}]`, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Success, relationType)
+			assert.Equal(t, `{"a":3,"b":2}`, msg.GetData())
+		})
+	})
+
+	t.Run("Js", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"targetId": "sub",
+			"reduce":   ReduceJs,
+			"jsScript": "var sum=0; for (var i=0;i<results.length;i++){sum+=results[i];} return {'sum':sum,'type':msgType};",
+		}, Registry)
+		assert.Nil(t, err)
+		onMapReduceMsg(t, node, context.Background(), `{"items":[1,2,3]}`, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Success, relationType)
+			assert.Equal(t, `{"sum":60,"type":"TEST"}`, msg.GetData())
+		})
+	})
+
+	t.Run("FailFast", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"targetId":    "sub",
+			"concurrency": 1,
+			"errorPolicy": ErrorPolicyFailFast,
+		}, Registry)
+		assert.Nil(t, err)
+		ctx := onMapReduceMsg(t, node, context.Background(), `{"items":[1,"bad",3,4]}`, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Failure, relationType)
+			assert.Equal(t, "element 1 failed: bad element", err.Error())
+			var itemErrors []mapReduceError
+			_ = json.Unmarshal([]byte(msg.Metadata.GetValue(KeyMapReduceErrors)), &itemErrors)
+			assert.Equal(t, 1, len(itemErrors))
+			assert.Equal(t, 1, itemErrors[0].Index)
+		})
+		//失败后不再分发剩余的元素
+		assert.Equal(t, int32(2), atomic.LoadInt32(&ctx.dispatched))
+	})
+
+	t.Run("Continue", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"targetId":    "sub",
+			"errorPolicy": ErrorPolicyContinue,
+		}, Registry)
+		assert.Nil(t, err)
+		ctx := onMapReduceMsg(t, node, context.Background(), `{"items":[1,"bad",3]}`, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Success, relationType)
+			assert.Equal(t, `[10,null,30]`, msg.GetData())
+			assert.Equal(t, `[{"index":1,"error":"bad element"}]`, msg.Metadata.GetValue(KeyMapReduceErrors))
+		})
+		assert.Equal(t, int32(3), atomic.LoadInt32(&ctx.dispatched))
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"targetId":    "sub",
+			"concurrency": 1,
+		}, Registry)
+		assert.Nil(t, err)
+		c, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(time.Millisecond*30, cancel)
+		ctx := onMapReduceMsg(t, node, c, `{"items":[1,2,3,4,5,6,7,8,9,10]}`, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Failure, relationType)
+			assert.True(t, strings.Contains(err.Error(), "canceled"))
+		})
+		assert.True(t, atomic.LoadInt32(&ctx.dispatched) < 10)
+	})
+
+	t.Run("NotArray", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"targetId": "sub",
+		}, Registry)
+		assert.Nil(t, err)
+		onMapReduceMsg(t, node, context.Background(), `{"items":"a"}`, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Failure, relationType)
+		})
+	})
+}
@@ -21,6 +21,8 @@ import (
 	"errors"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rulego/rulego/api/types"
 )
@@ -28,6 +30,15 @@ import (
 var (
 	ErrNetPoolNil    = errors.New("node pool is nil")
 	ErrClientNotInit = errors.New("client not init")
+	// ErrResourceInitializing 后台初始化策略下，资源还没有就绪
+	ErrResourceInitializing = errors.New("resource initializing")
+)
+
+const (
+	// DefaultInitRetryInterval 后台初始化默认首次重试间隔
+	DefaultInitRetryInterval = time.Second
+	// DefaultInitMaxRetryInterval 后台初始化默认最大重试间隔
+	DefaultInitMaxRetryInterval = time.Second * 30
 )
 
 var NodeUtils = &nodeUtils{}
@@ -112,25 +123,42 @@ type SharedNode[T any] struct {
 	InstanceId string
 	//初始化实例资源函数
 	InitInstanceFunc func() (T, error)
+	// InitRetryInterval 后台初始化首次重试间隔，每次失败后翻倍，默认 DefaultInitRetryInterval
+	InitRetryInterval time.Duration
+	// InitMaxRetryInterval 后台初始化最大重试间隔，默认 DefaultInitMaxRetryInterval
+	InitMaxRetryInterval time.Duration
 	////初始化资源资源，防止并发初始化
 	//lock int32
 	//是否从资源池获取
 	isFromPool bool
 	Locker     sync.Mutex
+	//后台初始化中，1:初始化中
+	initializing int32
+	//停止后台初始化
+	stopInit     chan struct{}
+	stopInitOnce sync.Once
+	//后台初始化的资源路径，用于报告健康状态
+	resourcePath string
 }
 
 // Init 初始化，如果 resourcePath 为 ref:// 开头，则从网络资源池获取，否则调用 initInstanceFunc 初始化
-// initNow=true，会在立刻初始化，否则在 GetInstance() 时候初始化
+// 初始化策略由 ruleConfig.NodeClientInitPolicy 指定，如果没指定：initNow=true，会在立刻初始化，否则在 GetInstance() 时候初始化
+// 策略为 types.InitPolicyBackground 时，在后台按退避间隔重试初始化，就绪前 Get 返回 ErrResourceInitializing，
+// 每次初始化失败发布 types.EventResourceUnhealthy 事件，失败后初始化成功发布 types.EventResourceRecovered 事件，
+// 同时向 types.Config.HealthRegistry 报告资源的健康状态
 func (x *SharedNode[T]) Init(ruleConfig types.Config, nodeType, resourcePath string, initNow bool, initInstanceFunc func() (T, error)) error {
 	x.RuleConfig = ruleConfig
 	x.NodeType = nodeType
 
 	if instanceId := NodeUtils.GetInstanceId(ruleConfig, resourcePath); instanceId == "" {
 		x.InitInstanceFunc = initInstanceFunc
-		if initNow {
+		switch initPolicy(ruleConfig, initNow) {
+		case types.InitPolicyEager:
 			//非资源池方式，初始化
 			_, err := x.InitInstanceFunc()
 			return err
+		case types.InitPolicyBackground:
+			x.startBackgroundInit(resourcePath)
 		}
 	} else {
 		x.isFromPool = true
@@ -139,6 +167,80 @@ func (x *SharedNode[T]) Init(ruleConfig types.Config, nodeType, resourcePath str
 	return nil
 }
 
+// initPolicy 获取初始化策略，节点没有指定则根据 initNow 决定
+func initPolicy(ruleConfig types.Config, initNow bool) string {
+	if ruleConfig.NodeClientInitPolicy != "" {
+		return ruleConfig.NodeClientInitPolicy
+	}
+	if initNow {
+		return types.InitPolicyEager
+	}
+	return types.InitPolicyLazy
+}
+
+// startBackgroundInit 启动后台初始化协程
+func (x *SharedNode[T]) startBackgroundInit(resourcePath string) {
+	atomic.StoreInt32(&x.initializing, 1)
+	x.stopInit = make(chan struct{})
+	interval := x.InitRetryInterval
+	if interval <= 0 {
+		interval = DefaultInitRetryInterval
+	}
+	maxInterval := x.InitMaxRetryInterval
+	if maxInterval <= 0 {
+		maxInterval = DefaultInitMaxRetryInterval
+	}
+	x.resourcePath = resourcePath
+	go func(initInstanceFunc func() (T, error), stop chan struct{}) {
+		for attempt := 1; ; attempt++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if _, err := initInstanceFunc(); err == nil {
+				atomic.StoreInt32(&x.initializing, 0)
+				x.RuleConfig.ReportHealth(types.HealthResourcePrefix+resourcePath, types.HealthHealthy, "")
+				if attempt > 1 {
+					x.RuleConfig.PublishEvent(types.EventResourceRecovered, resourcePath, map[string]interface{}{"type": x.NodeType})
+				}
+				return
+			} else {
+				x.RuleConfig.PublishEvent(types.EventResourceUnhealthy, resourcePath, map[string]interface{}{
+					"type": x.NodeType, "error": err.Error(), "attempt": attempt,
+				})
+				x.RuleConfig.ReportHealth(types.HealthResourcePrefix+resourcePath, types.HealthUnhealthy, err.Error())
+				if x.RuleConfig.Logger != nil {
+					x.RuleConfig.Logger.Printf("init %s resource: %s error: %s, retry after %s", x.NodeType, resourcePath, err.Error(), interval)
+				}
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+			if interval *= 2; interval > maxInterval {
+				interval = maxInterval
+			}
+		}
+	}(x.InitInstanceFunc, x.stopInit)
+}
+
+// StopBackgroundInit 停止后台初始化，并从健康检查中移除资源，节点 Destroy 时调用
+func (x *SharedNode[T]) StopBackgroundInit() {
+	x.stopInitOnce.Do(func() {
+		if x.stopInit != nil {
+			close(x.stopInit)
+			x.RuleConfig.RemoveHealth(types.HealthResourcePrefix + x.resourcePath)
+		}
+	})
+}
+
+// IsInitializing 是否正在后台初始化
+func (x *SharedNode[T]) IsInitializing() bool {
+	return atomic.LoadInt32(&x.initializing) == 1
+}
+
 // IsInit 是否初始化过
 func (x *SharedNode[T]) IsInit() bool {
 	return x.NodeType != ""
@@ -161,6 +263,8 @@ func (x *SharedNode[T]) Get() (T, error) {
 		} else {
 			return zeroValue[T](), err
 		}
+	} else if x.IsInitializing() {
+		return zeroValue[T](), ErrResourceInitializing
 	} else if x.InitInstanceFunc != nil {
 		//根据当前组件配置初始化一个客户端
 		return x.InitInstanceFunc()
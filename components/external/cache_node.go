@@ -164,16 +164,18 @@ func (x *CacheGetNode) outputResult(ctx types.RuleContext, msg types.RuleMsg, va
 		ctx.TellSuccess(msg)
 	} else if x.Config.OutputMode == CacheOutputModeMergeToMsg {
 		if msg.DataType == types.JSON {
-			var dataMap map[string]interface{}
-			if err := json.Unmarshal([]byte(msg.GetData()), &dataMap); err == nil {
-				for key, value := range values {
-					dataMap[key] = value
-				}
-				msg.SetData(str.ToString(dataMap))
-				ctx.TellSuccess(msg)
-			} else {
+			if _, err := msg.GetDataAsJson(); err != nil {
 				ctx.TellFailure(msg, errors.New("data must be able to be serialized into a map structure"))
+				return
+			}
+			for key, value := range values {
+				//key作为普通字段名，不解析为嵌套路径
+				if err := msg.SetDataPath("/"+json.EscapePointer(key), value); err != nil {
+					ctx.TellFailure(msg, err)
+					return
+				}
 			}
+			ctx.TellSuccess(msg)
 		} else {
 			ctx.TellFailure(msg, errors.New("data type must be JSON type"))
 		}
@@ -18,16 +18,20 @@ package external
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
 	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/components/base"
 	"github.com/rulego/rulego/utils/el"
 	"github.com/rulego/rulego/utils/maps"
 	"github.com/rulego/rulego/utils/str"
-	"strings"
 )
 
 // 注册节点
@@ -44,6 +48,28 @@ const (
 const (
 	rowsAffectedKey = "rowsAffected"
 	lastInsertIdKey = "lastInsertId"
+	// batchErrorsKey 批量写入模式下，跳过的行错误列表，JSON数组格式：[{"index":1,"error":"..."}]
+	batchErrorsKey = "batchErrors"
+)
+
+const (
+	// BatchErrorPolicyAbort 批量写入任意一行失败，回滚整个事务，消息发送到Failure链
+	BatchErrorPolicyAbort = "abort"
+	// BatchErrorPolicySkip 批量写入跳过失败的行并收集错误，其余行正常提交，消息发送到Success链
+	BatchErrorPolicySkip = "skip"
+	// defaultBatchSize 默认每条INSERT语句最多包含的行数
+	defaultBatchSize = 100
+	// maxPlaceholders 单条语句最多允许的占位符数量(mysql 和 postgres 协议限制)
+	maxPlaceholders = 65535
+)
+
+var (
+	// batchValuesRegexp 匹配INSERT语句中的VALUES关键字
+	batchValuesRegexp = regexp.MustCompile(`(?i)\bvalues\s*\(`)
+	// batchCopyRegexp 匹配可以使用COPY批量写入的INSERT语句前缀，例如：INSERT INTO table (a,b) VALUES
+	batchCopyRegexp = regexp.MustCompile(`(?is)^\s*insert\s+into\s+([\w."]+)\s*\(([^)]*)\)\s*values\s*$`)
+	// dollarPlaceholderRegexp 匹配postgres风格占位符
+	dollarPlaceholderRegexp = regexp.MustCompile(`\$(\d+)`)
 )
 
 // DbClientNodeConfiguration 节点配置
@@ -60,6 +86,17 @@ type DbClientNodeConfiguration struct {
 	Params []interface{}
 	// GetOne 是否只返回一条记录，true:返回结构不是数组结构，false：返回数据是数组结构
 	GetOne bool
+	// BatchMode 批量写入模式，仅支持INSERT语句。开启后msg data需要是JSON数组(例如聚合节点的输出)，
+	// 数组每个元素通过 Params 生成一行参数(${msg.key} 读取当前元素的字段)，
+	// 合并成多行INSERT语句在同一个事务中执行
+	BatchMode bool
+	// BatchSize 批量模式下每条INSERT语句最多包含的行数，超过则拆分成多条语句执行，默认100
+	BatchSize int
+	// MaxBatchRows 批量模式下单条消息允许的最大行数，超过则直接失败，防止超大数组占用过多内存。0表示不限制
+	MaxBatchRows int
+	// BatchErrorPolicy 批量模式下的错误处理策略
+	// abort:任意一行失败，整个事务回滚；skip:跳过失败的行并收集错误到元数据 batchErrors，其余行正常提交
+	BatchErrorPolicy string
 }
 
 type DbClientNode struct {
@@ -76,6 +113,8 @@ type DbClientNode struct {
 	//参数是否有变量
 	paramsHasVar   bool
 	paramsTemplate []el.Template
+	//批量写入语句模板
+	batchSql *batchInsertSql
 }
 
 // Type 返回组件类型
@@ -85,9 +124,12 @@ func (x *DbClientNode) Type() string {
 
 func (x *DbClientNode) New() types.Node {
 	return &DbClientNode{Config: DbClientNodeConfiguration{
-		Sql:        "select * from test",
-		DriverName: "mysql",
-		Dsn:        "root:root@tcp(127.0.0.1:3306)/test",
+		Sql:              "select * from test",
+		DriverName:       "mysql",
+		Dsn:              "root:root@tcp(127.0.0.1:3306)/test",
+		BatchSize:        defaultBatchSize,
+		MaxBatchRows:     10000,
+		BatchErrorPolicy: BatchErrorPolicyAbort,
 	}}
 }
 
@@ -128,7 +170,11 @@ func (x *DbClientNode) Init(ruleConfig types.Config, configuration types.Configu
 				}
 			}
 		}
-
+		if x.Config.BatchMode {
+			if err = x.initBatch(); err != nil {
+				return err
+			}
+		}
 	}
 	//初始化客户端
 	return x.SharedNode.Init(ruleConfig, x.Type(), x.Config.Dsn, ruleConfig.NodeClientInitNow, func() (*sql.DB, error) {
@@ -138,6 +184,10 @@ func (x *DbClientNode) Init(ruleConfig types.Config, configuration types.Configu
 
 // OnMsg 处理消息
 func (x *DbClientNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	if x.batchSql != nil {
+		x.onBatchMsg(ctx, msg)
+		return
+	}
 	var data interface{}
 	var err error
 	var rowsAffected int64
@@ -318,6 +368,7 @@ func (x *DbClientNode) delete(client *sql.DB, sqlStr string, params []interface{
 
 // Destroy 销毁组件
 func (x *DbClientNode) Destroy() {
+	x.SharedNode.StopBackgroundInit()
 	if x.client != nil {
 		_ = x.client.Close()
 	}
@@ -363,3 +414,366 @@ func (x *DbClientNode) checkOpType(opType string, sql string) error {
 		return fmt.Errorf("unsupported sql statement: %s", sql)
 	}
 }
+
+// initBatch 初始化批量写入模式，解析INSERT语句的VALUES部分
+func (x *DbClientNode) initBatch() error {
+	if x.sqlHasVar {
+		return errors.New("batch mode does not support sql variables")
+	}
+	if x.opType != INSERT {
+		return fmt.Errorf("batch mode only supports INSERT statement: %s", x.Config.Sql)
+	}
+	if x.Config.BatchSize <= 0 {
+		x.Config.BatchSize = defaultBatchSize
+	}
+	switch x.Config.BatchErrorPolicy {
+	case "":
+		x.Config.BatchErrorPolicy = BatchErrorPolicyAbort
+	case BatchErrorPolicyAbort, BatchErrorPolicySkip:
+	default:
+		return fmt.Errorf("unsupported batch error policy: %s", x.Config.BatchErrorPolicy)
+	}
+	batchSql, err := parseBatchInsertSql(x.Config.Sql, len(x.paramsTemplate))
+	if err != nil {
+		return err
+	}
+	//单条语句占位符数量不能超过数据库限制
+	if len(x.paramsTemplate) > 0 && x.Config.BatchSize*len(x.paramsTemplate) > maxPlaceholders {
+		x.Config.BatchSize = maxPlaceholders / len(x.paramsTemplate)
+	}
+	x.batchSql = batchSql
+	return nil
+}
+
+// batchRowError 批量写入失败的行
+type batchRowError struct {
+	// Index 行在msg数组中的下标
+	Index int `json:"index"`
+	// Error 错误信息
+	Error string `json:"error"`
+}
+
+// onBatchMsg 批量写入处理消息
+func (x *DbClientNode) onBatchMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	rows, err := x.parseBatchRows(msg.GetData())
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	client, err := x.SharedNode.Get()
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	evn := base.NodeUtils.GetEvnAndMetadata(ctx, msg)
+	var rowsAffected int64
+	var rowErrors []batchRowError
+	if x.batchSql.canCopy() && x.Config.DriverName == "postgres" && x.Config.BatchErrorPolicy == BatchErrorPolicyAbort {
+		rowsAffected, err = x.copyIn(client, rows, evn)
+	} else {
+		rowsAffected, rowErrors, err = x.batchInsert(client, rows, evn)
+	}
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	msg.Metadata.PutValue(rowsAffectedKey, str.ToString(rowsAffected))
+	if len(rowErrors) > 0 {
+		msg.Metadata.PutValue(batchErrorsKey, str.ToString(rowErrors))
+	}
+	ctx.TellSuccess(msg)
+}
+
+// parseBatchRows 解析批量写入的数据，如果不是JSON数组，则作为单行处理
+func (x *DbClientNode) parseBatchRows(data string) ([]interface{}, error) {
+	var rows []interface{}
+	if trimmed := strings.TrimSpace(data); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal([]byte(trimmed), &rows); err != nil {
+			return nil, err
+		}
+	} else {
+		var row interface{}
+		if err := json.Unmarshal([]byte(trimmed), &row); err != nil {
+			return nil, err
+		}
+		rows = []interface{}{row}
+	}
+	if x.Config.MaxBatchRows > 0 && len(rows) > x.Config.MaxBatchRows {
+		return nil, fmt.Errorf("batch rows %d exceeds the limit of %d", len(rows), x.Config.MaxBatchRows)
+	}
+	return rows, nil
+}
+
+// rowParams 根据当前行生成SQL参数，${msg.key} 读取当前行的字段
+func (x *DbClientNode) rowParams(evn map[string]interface{}, row interface{}, params []interface{}) ([]interface{}, error) {
+	evn[types.MsgKey] = row
+	for _, item := range x.paramsTemplate {
+		param, err := item.Execute(evn)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// batchInsert 把数据按 BatchSize 拆分成多条多行INSERT语句，在同一个事务中执行
+// skip 策略下，通过保存点回滚失败的语句，并逐行重试以收集失败的行
+func (x *DbClientNode) batchInsert(client *sql.DB, rows []interface{}, evn map[string]interface{}) (int64, []batchRowError, error) {
+	tx, err := client.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	skip := x.Config.BatchErrorPolicy == BatchErrorPolicySkip
+	var rowsAffected int64
+	var rowErrors []batchRowError
+	for start := 0; start < len(rows); start += x.Config.BatchSize {
+		end := start + x.Config.BatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		//只保留当前批次的参数，避免超大数组一次性占用过多内存
+		params := make([]interface{}, 0, (end-start)*len(x.paramsTemplate))
+		var paramErr error
+		for i := start; i < end; i++ {
+			if params, paramErr = x.rowParams(evn, rows[i], params); paramErr != nil {
+				break
+			}
+		}
+		if paramErr == nil {
+			var affected int64
+			if skip {
+				affected, err = x.execWithSavepoint(tx, x.batchSql.build(end-start, x.Config.DriverName), params)
+			} else {
+				affected, err = x.execTx(tx, x.batchSql.build(end-start, x.Config.DriverName), params)
+			}
+			if err == nil {
+				rowsAffected += affected
+				continue
+			}
+		} else {
+			err = paramErr
+		}
+		if !skip {
+			_ = tx.Rollback()
+			return 0, nil, fmt.Errorf("batch insert rows [%d,%d) failed: %w", start, end, err)
+		}
+		//逐行重试，定位失败的行
+		for i := start; i < end; i++ {
+			rowParams, err := x.rowParams(evn, rows[i], nil)
+			if err == nil {
+				var affected int64
+				if affected, err = x.execWithSavepoint(tx, x.batchSql.build(1, x.Config.DriverName), rowParams); err == nil {
+					rowsAffected += affected
+					continue
+				}
+			}
+			rowErrors = append(rowErrors, batchRowError{Index: i, Error: err.Error()})
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+	return rowsAffected, rowErrors, nil
+}
+
+// execTx 在事务中执行语句并返回影响行数
+func (x *DbClientNode) execTx(tx *sql.Tx, sqlStr string, params []interface{}) (int64, error) {
+	result, err := tx.Exec(sqlStr, params...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// execWithSavepoint 通过保存点执行语句，失败则回滚到保存点，不影响事务中其他已经执行的语句
+func (x *DbClientNode) execWithSavepoint(tx *sql.Tx, sqlStr string, params []interface{}) (int64, error) {
+	if _, err := tx.Exec("SAVEPOINT rulego_batch"); err != nil {
+		return 0, err
+	}
+	affected, err := x.execTx(tx, sqlStr, params)
+	if err != nil {
+		if _, rollbackErr := tx.Exec("ROLLBACK TO SAVEPOINT rulego_batch"); rollbackErr != nil {
+			return 0, rollbackErr
+		}
+		return 0, err
+	}
+	_, err = tx.Exec("RELEASE SAVEPOINT rulego_batch")
+	return affected, err
+}
+
+// copyIn 使用postgres COPY协议批量写入，全部成功或者全部回滚
+func (x *DbClientNode) copyIn(client *sql.DB, rows []interface{}, evn map[string]interface{}) (int64, error) {
+	tx, err := client.Begin()
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(x.batchSql.copyInSql())
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	params := make([]interface{}, 0, len(x.paramsTemplate))
+	for i, row := range rows {
+		if params, err = x.rowParams(evn, row, params[:0]); err == nil {
+			_, err = stmt.Exec(params...)
+		}
+		if err != nil {
+			_ = stmt.Close()
+			_ = tx.Rollback()
+			return 0, fmt.Errorf("batch copy row %d failed: %w", i, err)
+		}
+	}
+	if _, err = stmt.Exec(); err != nil {
+		_ = stmt.Close()
+		_ = tx.Rollback()
+		return 0, err
+	}
+	if err = stmt.Close(); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(rows)), nil
+}
+
+// batchInsertSql 批量INSERT语句模板，把 VALUES 后的单行占位符扩展成多行
+type batchInsertSql struct {
+	//VALUES 以及之前的部分，例如：INSERT INTO users (id,name) VALUES
+	prefix string
+	//单行占位符，例如：(?,?)
+	row string
+	//单行之后的部分，例如：ON CONFLICT DO NOTHING
+	suffix string
+	//每行占位符数量
+	placeholders int
+	//表名，用于COPY
+	table string
+	//列名，用于COPY
+	columns []string
+}
+
+// parseBatchInsertSql 解析INSERT语句，要求VALUES后只有一行，而且占位符数量和参数数量一致
+func parseBatchInsertSql(sqlStr string, paramsLen int) (*batchInsertSql, error) {
+	loc := batchValuesRegexp.FindStringIndex(sqlStr)
+	if loc == nil {
+		return nil, fmt.Errorf("batch mode requires INSERT ... VALUES (...) statement: %s", sqlStr)
+	}
+	rowStart := loc[1] - 1
+	rowEnd := -1
+	depth := 0
+	inQuote := false
+	for i := rowStart; i < len(sqlStr) && rowEnd < 0; i++ {
+		switch sqlStr[i] {
+		case '\'':
+			inQuote = !inQuote
+		case '(':
+			if !inQuote {
+				depth++
+			}
+		case ')':
+			if !inQuote {
+				depth--
+				if depth == 0 {
+					rowEnd = i + 1
+				}
+			}
+		}
+	}
+	if rowEnd < 0 {
+		return nil, fmt.Errorf("batch mode values is not closed: %s", sqlStr)
+	}
+	b := &batchInsertSql{
+		prefix: sqlStr[:rowStart],
+		row:    sqlStr[rowStart:rowEnd],
+		suffix: sqlStr[rowEnd:],
+	}
+	b.placeholders = countPlaceholders(b.row)
+	if countPlaceholders(b.prefix) > 0 || countPlaceholders(b.suffix) > 0 {
+		return nil, errors.New("batch mode only supports placeholders in the values row")
+	}
+	if b.placeholders != paramsLen {
+		return nil, fmt.Errorf("batch mode placeholders %d not match params %d", b.placeholders, paramsLen)
+	}
+	if matches := batchCopyRegexp.FindStringSubmatch(b.prefix); matches != nil &&
+		strings.Trim(strings.TrimSpace(b.suffix), ";") == "" && onlyPlaceholders(b.row) {
+		b.table = strings.ReplaceAll(matches[1], `"`, "")
+		for _, column := range strings.Split(matches[2], ",") {
+			b.columns = append(b.columns, strings.Trim(strings.TrimSpace(column), `"`))
+		}
+	}
+	return b, nil
+}
+
+// build 生成包含rows行的INSERT语句，postgres风格占位符会按行重新编号
+func (b *batchInsertSql) build(rows int, driverName string) string {
+	var builder strings.Builder
+	builder.Grow(len(b.prefix) + (len(b.row)+2)*rows + len(b.suffix))
+	builder.WriteString(b.prefix)
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		if driverName == "postgres" && i > 0 {
+			offset := i * b.placeholders
+			builder.WriteString(dollarPlaceholderRegexp.ReplaceAllStringFunc(b.row, func(s string) string {
+				n, _ := strconv.Atoi(s[1:])
+				return "$" + strconv.Itoa(n+offset)
+			}))
+		} else {
+			builder.WriteString(b.row)
+		}
+	}
+	builder.WriteString(b.suffix)
+	return builder.String()
+}
+
+// canCopy 是否可以使用COPY批量写入
+func (b *batchInsertSql) canCopy() bool {
+	return b.table != "" && len(b.columns) > 0
+}
+
+// copyInSql 生成COPY语句
+func (b *batchInsertSql) copyInSql() string {
+	if index := strings.LastIndex(b.table, "."); index > 0 {
+		return pq.CopyInSchema(b.table[:index], b.table[index+1:], b.columns...)
+	}
+	return pq.CopyIn(b.table, b.columns...)
+}
+
+// countPlaceholders 统计占位符数量，忽略引号内的字符
+func countPlaceholders(s string) int {
+	count := 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			inQuote = !inQuote
+		case '?':
+			if !inQuote {
+				count++
+			}
+		case '$':
+			if !inQuote && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9' {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// onlyPlaceholders 单行是否只包含按列顺序排列的占位符，例如：(?,?,?) 或者 ($1,$2)
+// COPY按列顺序传入参数，($2,$1) 这种调整了顺序的占位符不能使用COPY
+func onlyPlaceholders(row string) bool {
+	row = strings.TrimSpace(row)
+	row = strings.TrimSuffix(strings.TrimPrefix(row, "("), ")")
+	for i, item := range strings.Split(row, ",") {
+		item = strings.TrimSpace(item)
+		if item != "?" && item != "$"+strconv.Itoa(i+1) {
+			return false
+		}
+	}
+	return true
+}
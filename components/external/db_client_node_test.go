@@ -17,10 +17,17 @@
 package external
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/test"
 	"github.com/rulego/rulego/test/assert"
 	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/str"
 	"net"
 	"testing"
 	"time"
@@ -480,3 +487,240 @@ type testUser struct {
 	Name string `json:"name"`
 	Age  int    `json:"age"`
 }
+
+func TestDbClientNodeBatchSql(t *testing.T) {
+	t.Run("Mysql", func(t *testing.T) {
+		b, err := parseBatchInsertSql("insert into users (id,name) values (?, ?) on duplicate key update name=values(name)", 2)
+		assert.Nil(t, err)
+		assert.Equal(t, "insert into users (id,name) values (?, ?), (?, ?), (?, ?) on duplicate key update name=values(name)", b.build(3, "mysql"))
+		assert.False(t, b.canCopy())
+	})
+	t.Run("Postgres", func(t *testing.T) {
+		b, err := parseBatchInsertSql("INSERT INTO public.users (id, name) VALUES ($1, $2)", 2)
+		assert.Nil(t, err)
+		assert.Equal(t, "INSERT INTO public.users (id, name) VALUES ($1, $2), ($3, $4), ($5, $6)", b.build(3, "postgres"))
+		assert.True(t, b.canCopy())
+		assert.Equal(t, `COPY "public"."users" ("id", "name") FROM STDIN`, b.copyInSql())
+		//调整了顺序的占位符使用多行INSERT，COPY按列顺序传参会交换列的值
+		b, err = parseBatchInsertSql("INSERT INTO users (id, name) VALUES ($2, $1)", 2)
+		assert.Nil(t, err)
+		assert.Equal(t, "INSERT INTO users (id, name) VALUES ($2, $1), ($4, $3)", b.build(2, "postgres"))
+		assert.False(t, b.canCopy())
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := parseBatchInsertSql("insert into users (id,name) values (?,?)", 3)
+		assert.NotNil(t, err)
+		_, err = parseBatchInsertSql("insert into users select * from t where id=?", 1)
+		assert.NotNil(t, err)
+		_, err = parseBatchInsertSql("insert into users (id,name) values (?,'a)'", 1)
+		assert.NotNil(t, err)
+	})
+	t.Run("InitError", func(t *testing.T) {
+		_, err := test.CreateAndInitNode("dbClient", types.Configuration{
+			"sql":        "update users set age = ? where id = ?",
+			"params":     []interface{}{"${msg.age}", "${msg.id}"},
+			"driverName": "mysql",
+			"batchMode":  true,
+		}, Registry)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestDbClientNodeBatchMode(t *testing.T) {
+	sql.Register(batchTestDriverName, &batchTestDriver{})
+	data := `[{"id":1,"name":"a"},{"id":2,"name":"bad"},{"id":3,"name":"c"}]`
+
+	t.Run("Abort", func(t *testing.T) {
+		recorder := resetBatchTestRecorder()
+		node := createBatchTestNode(t, BatchErrorPolicyAbort)
+		testBatchNodeOnMsg(t, node, data, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Failure, relationType)
+			assert.True(t, strings.Contains(err.Error(), "rows [0,2)"))
+		})
+		assert.Equal(t, 0, recorder.commits)
+		assert.Equal(t, 1, recorder.rollbacks)
+	})
+	t.Run("Skip", func(t *testing.T) {
+		recorder := resetBatchTestRecorder()
+		node := createBatchTestNode(t, BatchErrorPolicySkip)
+		testBatchNodeOnMsg(t, node, data, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Success, relationType)
+			assert.Equal(t, "2", msg.Metadata.GetValue(rowsAffectedKey))
+			var rowErrors []batchRowError
+			_ = json.Unmarshal([]byte(msg.Metadata.GetValue(batchErrorsKey)), &rowErrors)
+			assert.Equal(t, 1, len(rowErrors))
+			assert.Equal(t, 1, rowErrors[0].Index)
+		})
+		assert.Equal(t, 1, recorder.commits)
+		assert.Equal(t, "insert into users (id,name) values (?,?), (?,?)", recorder.queries[1])
+	})
+	t.Run("Success", func(t *testing.T) {
+		recorder := resetBatchTestRecorder()
+		node := createBatchTestNode(t, BatchErrorPolicyAbort)
+		testBatchNodeOnMsg(t, node, `[{"id":1,"name":"a"},{"id":2,"name":"b"},{"id":3,"name":"c"}]`, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Success, relationType)
+			assert.Equal(t, "3", msg.Metadata.GetValue(rowsAffectedKey))
+			assert.Equal(t, "", msg.Metadata.GetValue(batchErrorsKey))
+		})
+		assert.Equal(t, 1, recorder.commits)
+		assert.Equal(t, 2, len(recorder.queries))
+	})
+	t.Run("MaxBatchRows", func(t *testing.T) {
+		resetBatchTestRecorder()
+		node := createBatchTestNode(t, BatchErrorPolicyAbort)
+		node.(*DbClientNode).Config.MaxBatchRows = 2
+		testBatchNodeOnMsg(t, node, data, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Failure, relationType)
+		})
+	})
+}
+
+func createBatchTestNode(t *testing.T, policy string) types.Node {
+	node, err := test.CreateAndInitNode("dbClient", types.Configuration{
+		"sql":              "insert into users (id,name) values (?,?)",
+		"params":           []interface{}{"${msg.id}", "${msg.name}"},
+		"driverName":       batchTestDriverName,
+		"dsn":              policy,
+		"batchMode":        true,
+		"batchSize":        2,
+		"batchErrorPolicy": policy,
+	}, Registry)
+	assert.Nil(t, err)
+	return node
+}
+
+func testBatchNodeOnMsg(t *testing.T, node types.Node, data string, callback func(msg types.RuleMsg, relationType string, err error)) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		defer wg.Done()
+		callback(msg, relationType, err)
+	})
+	node.OnMsg(ctx, ctx.NewMsg("TEST_MSG_TYPE", types.NewMetadata(), data))
+	wg.Wait()
+}
+
+func BenchmarkDbClientBatchInsert(b *testing.B) {
+	benchmarkDbClientInsert(b, true)
+}
+
+func BenchmarkDbClientLoopInsert(b *testing.B) {
+	benchmarkDbClientInsert(b, false)
+}
+
+// benchmarkDbClientInsert 对比批量写入和逐条写入100行数据的性能，需要本地mysql
+func benchmarkDbClientInsert(b *testing.B, batchMode bool) {
+	node, err := test.CreateAndInitNode("dbClient", types.Configuration{
+		"sql":        "insert into users (id,name,age) values (?,?,?)",
+		"params":     []interface{}{"${msg.id}", "${msg.name}", 18},
+		"driverName": "mysql",
+		"dsn":        "root:root@tcp(127.0.0.1:3306)/test",
+		"batchMode":  batchMode,
+	}, Registry)
+	if err != nil {
+		b.Skip(err)
+	}
+	if _, err = node.(*DbClientNode).SharedNode.Get(); err != nil {
+		b.Skip(err)
+	}
+	var rows []string
+	for i := 0; i < 100; i++ {
+		rows = append(rows, `{"id":`+str.ToString(i)+`,"name":"test"}`)
+	}
+	batchData := "[" + strings.Join(rows, ",") + "]"
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if batchMode {
+			node.OnMsg(ctx, ctx.NewMsg("TEST_MSG_TYPE", types.NewMetadata(), batchData))
+		} else {
+			for _, row := range rows {
+				node.OnMsg(ctx, ctx.NewMsg("TEST_MSG_TYPE", types.NewMetadata(), row))
+			}
+		}
+	}
+}
+
+const batchTestDriverName = "batchTest"
+
+// batchTestRecorder 记录测试驱动执行的语句和事务结果
+type batchTestRecorder struct {
+	sync.Mutex
+	queries   []string
+	commits   int
+	rollbacks int
+}
+
+var batchRecorder = &batchTestRecorder{}
+
+func resetBatchTestRecorder() *batchTestRecorder {
+	batchRecorder.Lock()
+	defer batchRecorder.Unlock()
+	batchRecorder.queries = nil
+	batchRecorder.commits = 0
+	batchRecorder.rollbacks = 0
+	return batchRecorder
+}
+
+// batchTestDriver 测试驱动，参数包含"bad"时执行失败，不执行BEGIN/COMMIT等语句
+type batchTestDriver struct{}
+
+func (d *batchTestDriver) Open(name string) (driver.Conn, error) {
+	return &batchTestConn{}, nil
+}
+
+type batchTestConn struct{}
+
+func (c *batchTestConn) Prepare(query string) (driver.Stmt, error) {
+	return &batchTestStmt{query: query}, nil
+}
+
+func (c *batchTestConn) Close() error {
+	return nil
+}
+
+func (c *batchTestConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *batchTestConn) Commit() error {
+	batchRecorder.Lock()
+	defer batchRecorder.Unlock()
+	batchRecorder.commits++
+	return nil
+}
+
+func (c *batchTestConn) Rollback() error {
+	batchRecorder.Lock()
+	defer batchRecorder.Unlock()
+	batchRecorder.rollbacks++
+	return nil
+}
+
+type batchTestStmt struct {
+	query string
+}
+
+func (s *batchTestStmt) Close() error {
+	return nil
+}
+
+func (s *batchTestStmt) NumInput() int {
+	return -1
+}
+
+func (s *batchTestStmt) Exec(args []driver.Value) (driver.Result, error) {
+	batchRecorder.Lock()
+	batchRecorder.queries = append(batchRecorder.queries, s.query)
+	batchRecorder.Unlock()
+	for _, arg := range args {
+		if arg == "bad" {
+			return nil, errors.New("bad value")
+		}
+	}
+	return driver.RowsAffected(len(args) / 2), nil
+}
+
+func (s *batchTestStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
@@ -20,6 +20,8 @@
 // - MqttClientNode: Connects to MQTT brokers and publishes messages
 // - RestApiCallNode: Performs HTTP requests to external APIs
 // - DbClientNode: Connects to databases and performs SQL operations
+// - ReplyToNode: Sends the message back to the endpoint it came from
+// - WsPushNode: Pushes the message to the connected sessions of a websocket endpoint
 // Each component is registered with the Registry, allowing them to be used
 // within rule chains. These components enable the rule engine to interact
 // with external systems, expanding its capabilities for data input, output,
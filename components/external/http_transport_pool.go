@@ -0,0 +1,340 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// DefaultIdleConnTimeout 默认空闲连接超时时间，单位秒
+const DefaultIdleConnTimeout = 90
+
+// HttpTransportStats 出站连接池指标
+type HttpTransportStats struct {
+	// Requests 请求数
+	Requests int64 `json:"requests"`
+	// NewConns 使用新建连接的请求数
+	NewConns int64 `json:"newConns"`
+	// ReusedConns 复用空闲连接的请求数
+	ReusedConns int64 `json:"reusedConns"`
+	// ReuseRatio 连接复用率：ReusedConns/(NewConns+ReusedConns)
+	ReuseRatio float64 `json:"reuseRatio"`
+	// OpenConns 当前打开的连接数
+	OpenConns int64 `json:"openConns"`
+	// ClosedConns 已经关闭的连接数
+	ClosedConns int64 `json:"closedConns"`
+	// IdleSweeps 清理空闲连接的次数
+	IdleSweeps int64 `json:"idleSweeps"`
+	// DNS DNS解析耗时
+	DNS TimingStats `json:"dns"`
+	// Connect 建立TCP连接耗时
+	Connect TimingStats `json:"connect"`
+	// TLS TLS握手耗时
+	TLS TimingStats `json:"tls"`
+}
+
+// TimingStats 耗时汇总
+type TimingStats struct {
+	// Count 次数
+	Count int64 `json:"count"`
+	// AvgMs 平均耗时，单位毫秒
+	AvgMs float64 `json:"avgMs"`
+	// MaxMs 最大耗时，单位毫秒
+	MaxMs float64 `json:"maxMs"`
+}
+
+// timing 耗时计数器
+type timing struct {
+	count   int64
+	totalNs int64
+	maxNs   int64
+}
+
+func (t *timing) observe(d time.Duration) {
+	atomic.AddInt64(&t.count, 1)
+	atomic.AddInt64(&t.totalNs, int64(d))
+	for {
+		current := atomic.LoadInt64(&t.maxNs)
+		if int64(d) <= current || atomic.CompareAndSwapInt64(&t.maxNs, current, int64(d)) {
+			return
+		}
+	}
+}
+
+func (t *timing) snapshot() TimingStats {
+	stats := TimingStats{
+		Count: atomic.LoadInt64(&t.count),
+		MaxMs: float64(atomic.LoadInt64(&t.maxNs)) / float64(time.Millisecond),
+	}
+	if stats.Count > 0 {
+		stats.AvgMs = float64(atomic.LoadInt64(&t.totalNs)) / float64(stats.Count) / float64(time.Millisecond)
+	}
+	return stats
+}
+
+// httpTransportKey 相同配置的节点共享同一个http.Transport
+type httpTransportKey struct {
+	tls                 types.TLSConfig
+	maxConnsPerHost     int
+	maxIdleConnsPerHost int
+	maxIdleConns        int
+	idleConnTimeout     int
+	enableProxy         bool
+	useSystemProxy      bool
+	proxyScheme         string
+	proxyHost           string
+	proxyPort           int
+	proxyUser           string
+	proxyPassword       string
+	proxyURL            string
+}
+
+// sharedHttpTransport 共享的http.Transport，使用引用计数，没有节点使用时关闭所有空闲连接
+type sharedHttpTransport struct {
+	key       httpTransportKey
+	transport *http.Transport
+	refs      int
+	// 正在处理的请求数
+	inflight int64
+	// 最后一次请求结束的时间，单位纳秒
+	lastUsed    int64
+	idleTimeout time.Duration
+	stop        chan struct{}
+
+	requests    int64
+	newConns    int64
+	reusedConns int64
+	openConns   int64
+	closedConns int64
+	idleSweeps  int64
+	dns         timing
+	connect     timing
+	tls         timing
+}
+
+var httpTransportPool = struct {
+	sync.Mutex
+	items map[httpTransportKey]*sharedHttpTransport
+}{items: make(map[httpTransportKey]*sharedHttpTransport)}
+
+// acquireHttpTransport 获取相同配置的共享http.Transport，如果不存在则创建
+func acquireHttpTransport(config RestApiCallNodeConfiguration) *sharedHttpTransport {
+	key := newHttpTransportKey(config)
+	httpTransportPool.Lock()
+	defer httpTransportPool.Unlock()
+	t, ok := httpTransportPool.items[key]
+	if !ok {
+		t = newSharedHttpTransport(key, config)
+		httpTransportPool.items[key] = t
+	}
+	t.refs++
+	return t
+}
+
+// release 减少引用计数，没有节点使用时停止清理并关闭空闲连接
+func (t *sharedHttpTransport) release() {
+	httpTransportPool.Lock()
+	t.refs--
+	closed := t.refs <= 0
+	if closed {
+		delete(httpTransportPool.items, t.key)
+	}
+	httpTransportPool.Unlock()
+	if closed {
+		close(t.stop)
+		t.transport.CloseIdleConnections()
+	}
+}
+
+func newHttpTransportKey(config RestApiCallNodeConfiguration) httpTransportKey {
+	key := httpTransportKey{
+		tls:                 config.tlsConfig(),
+		maxConnsPerHost:     config.MaxConnsPerHost,
+		maxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+		maxIdleConns:        config.MaxIdleConns,
+		idleConnTimeout:     config.IdleConnTimeout,
+	}
+	if key.maxConnsPerHost <= 0 {
+		key.maxConnsPerHost = config.MaxParallelRequestsCount
+	}
+	if key.idleConnTimeout <= 0 {
+		key.idleConnTimeout = DefaultIdleConnTimeout
+	}
+	if config.ProxyURL != "" {
+		key.proxyURL = config.ProxyURL
+	} else if config.EnableProxy {
+		key.enableProxy = true
+		key.useSystemProxy = config.UseSystemProxyProperties
+		if !key.useSystemProxy {
+			key.proxyScheme = config.ProxyScheme
+			key.proxyHost = config.ProxyHost
+			key.proxyPort = config.ProxyPort
+			key.proxyUser = config.ProxyUser
+			key.proxyPassword = config.ProxyPassword
+		}
+	}
+	return key
+}
+
+func newSharedHttpTransport(key httpTransportKey, config RestApiCallNodeConfiguration) *sharedHttpTransport {
+	t := &sharedHttpTransport{
+		key:         key,
+		idleTimeout: time.Duration(key.idleConnTimeout) * time.Second,
+		stop:        make(chan struct{}),
+		lastUsed:    time.Now().UnixNano(),
+	}
+	transport := newHttpTransport(key, config)
+	dial := transport.DialContext
+	//统计打开的连接数
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&t.openConns, 1)
+		return &countingConn{Conn: conn, transport: t}, nil
+	}
+	t.transport = transport
+	go t.sweep()
+	return t
+}
+
+// sweep 定时清理空闲连接，连接池空闲超过idleTimeout后关闭所有空闲连接
+func (t *sharedHttpTransport) sweep() {
+	interval := t.idleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			if atomic.LoadInt64(&t.inflight) == 0 &&
+				time.Since(time.Unix(0, atomic.LoadInt64(&t.lastUsed))) >= t.idleTimeout &&
+				atomic.LoadInt64(&t.openConns) > 0 {
+				t.transport.CloseIdleConnections()
+				atomic.AddInt64(&t.idleSweeps, 1)
+			}
+		}
+	}
+}
+
+// do 发送请求，统计连接复用和DNS、建立连接、TLS握手耗时
+func (t *sharedHttpTransport) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.requests, 1)
+	atomic.AddInt64(&t.inflight, 1)
+	defer func() {
+		atomic.StoreInt64(&t.lastUsed, time.Now().UnixNano())
+		atomic.AddInt64(&t.inflight, -1)
+	}()
+	return client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), t.clientTrace())))
+}
+
+func (t *sharedHttpTransport) clientTrace() *httptrace.ClientTrace {
+	var mu sync.Mutex
+	var dnsStart, tlsStart time.Time
+	connectStart := make(map[string]time.Time)
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = time.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			mu.Lock()
+			t.dns.observe(time.Since(dnsStart))
+			mu.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			connectStart[addr] = time.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			if start, ok := connectStart[addr]; ok && err == nil {
+				t.connect.observe(time.Since(start))
+			}
+			mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsStart = time.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mu.Lock()
+			if err == nil {
+				t.tls.observe(time.Since(tlsStart))
+			}
+			mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&t.reusedConns, 1)
+			} else {
+				atomic.AddInt64(&t.newConns, 1)
+			}
+		},
+	}
+}
+
+// stats 获取连接池指标
+func (t *sharedHttpTransport) stats() HttpTransportStats {
+	stats := HttpTransportStats{
+		Requests:    atomic.LoadInt64(&t.requests),
+		NewConns:    atomic.LoadInt64(&t.newConns),
+		ReusedConns: atomic.LoadInt64(&t.reusedConns),
+		OpenConns:   atomic.LoadInt64(&t.openConns),
+		ClosedConns: atomic.LoadInt64(&t.closedConns),
+		IdleSweeps:  atomic.LoadInt64(&t.idleSweeps),
+		DNS:         t.dns.snapshot(),
+		Connect:     t.connect.snapshot(),
+		TLS:         t.tls.snapshot(),
+	}
+	if total := stats.NewConns + stats.ReusedConns; total > 0 {
+		stats.ReuseRatio = float64(stats.ReusedConns) / float64(total)
+	}
+	return stats
+}
+
+// countingConn 关闭时更新打开的连接数
+type countingConn struct {
+	net.Conn
+	transport *sharedHttpTransport
+	once      sync.Once
+}
+
+func (c *countingConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.transport.openConns, -1)
+		atomic.AddInt64(&c.transport.closedConns, 1)
+	})
+	return c.Conn.Close()
+}
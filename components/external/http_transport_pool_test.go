@@ -0,0 +1,120 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// openFds 当前进程打开的文件描述符数量，不支持的系统返回-1
+func openFds() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+func onRestApiCallMsg(node types.Node, metadata *types.Metadata) (relationType string, err error) {
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, r string, e error) {
+		relationType = r
+		err = e
+	})
+	node.OnMsg(ctx, ctx.NewMsg("TEST", metadata, "{}"))
+	return
+}
+
+func TestHttpTransportPool(t *testing.T) {
+	const hosts = 200
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})}
+	defer server.Close()
+	var addrs []string
+	for i := 0; i < hosts; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		addrs = append(addrs, l.Addr().String())
+		go server.Serve(l)
+	}
+
+	config := types.Configuration{
+		"restEndpointUrlPattern": "http://${metadata.addr}/ok",
+		"requestMethod":          "GET",
+		"withoutRequestBody":     true,
+		"idleConnTimeout":        1,
+		"maxIdleConnsPerHost":    2,
+		"maxIdleConns":           0,
+	}
+	node1, err := test.CreateAndInitNode("restApiCall", config, Registry)
+	assert.Nil(t, err)
+	node2, err := test.CreateAndInitNode("restApiCall", config, Registry)
+	assert.Nil(t, err)
+	//相同配置的节点共享连接池
+	assert.True(t, node1.(*RestApiCallNode).transport == node2.(*RestApiCallNode).transport)
+	defer node2.Destroy()
+
+	fdsBefore := openFds()
+	for round := 0; round < 2; round++ {
+		for _, addr := range addrs {
+			metadata := types.NewMetadata()
+			metadata.PutValue("addr", addr)
+			relationType, err := onRestApiCallMsg(node1, metadata)
+			assert.Nil(t, err)
+			assert.Equal(t, types.Success, relationType)
+		}
+	}
+	stats := node1.(*RestApiCallNode).Stats()
+	assert.Equal(t, int64(hosts*2), stats.Requests)
+	assert.Equal(t, int64(hosts), stats.NewConns)
+	assert.Equal(t, int64(hosts), stats.ReusedConns)
+	assert.Equal(t, 0.5, stats.ReuseRatio)
+	assert.Equal(t, int64(hosts), stats.OpenConns)
+	assert.Equal(t, int64(hosts), stats.Connect.Count)
+
+	//空闲超时后，所有连接被关闭，文件描述符不会泄漏
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) && node1.(*RestApiCallNode).Stats().OpenConns > 0 {
+		time.Sleep(time.Millisecond * 100)
+	}
+	stats = node1.(*RestApiCallNode).Stats()
+	assert.Equal(t, int64(0), stats.OpenConns)
+	assert.Equal(t, int64(hosts), stats.ClosedConns)
+	if fdsBefore > 0 {
+		//服务端连接关闭需要一点时间
+		deadline = time.Now().Add(time.Second * 3)
+		for time.Now().Before(deadline) && openFds() > fdsBefore+10 {
+			time.Sleep(time.Millisecond * 100)
+		}
+		assert.True(t, openFds() <= fdsBefore+10)
+	}
+
+	//仍然被node2引用，不会关闭
+	transport := node2.(*RestApiCallNode).transport
+	node1.Destroy()
+	httpTransportPool.Lock()
+	assert.True(t, httpTransportPool.items[transport.key] == transport)
+	httpTransportPool.Unlock()
+}
@@ -0,0 +1,468 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/el"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/kv"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+// 注册节点
+func init() {
+	Registry.Add(&KvPutNode{})
+	Registry.Add(&KvGetNode{})
+	Registry.Add(&KvScanNode{})
+}
+
+const (
+	// DefaultKvStorePath 默认存储文件路径
+	DefaultKvStorePath = "./data/rulego.kv"
+	// DefaultKvBucket 无法获取规则链ID时使用的默认桶
+	DefaultKvBucket = "default"
+	// KvScanOutputModeArray 扫描结果转成JSON数组，覆盖原消息负荷输出
+	KvScanOutputModeArray = 0
+	// KvScanOutputModeIterator 每条结果作为一条消息，通过True关系输出，遍历结束后原消息通过Success关系输出
+	KvScanOutputModeIterator = 1
+	// KeyKvKey 元数据key：迭代输出时当前条目的key
+	KeyKvKey = "kvKey"
+	// KeyKvCount 元数据key：扫描结果数量
+	KeyKvCount = "kvCount"
+)
+
+// KvStoreConfiguration kv存储公共配置
+type KvStoreConfiguration struct {
+	// Path 存储文件路径，相同路径的节点共享同一个存储实例，最后一个使用该存储的节点销毁时关闭
+	// 也可以使用 ref://{resourceId} 引用资源池中的共享节点
+	Path string `json:"path"`
+	// Bucket 桶，默认当前规则链ID，不同规则链的数据互相隔离
+	// 可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
+	Bucket string `json:"bucket"`
+	// SyncWrites 每次写入后是否同步到磁盘，防止操作系统崩溃丢失数据，会降低写入性能
+	// 同一个存储文件以第一个打开的节点配置为准
+	SyncWrites bool `json:"syncWrites"`
+}
+
+// kvStorePool 按文件路径共享的存储实例，使用引用计数
+var kvStorePool = struct {
+	sync.Mutex
+	items map[string]*sharedKvStore
+}{items: make(map[string]*sharedKvStore)}
+
+type sharedKvStore struct {
+	db   *kv.DB
+	refs int
+}
+
+// acquireKvStore 获取路径对应的共享存储实例，如果不存在则打开
+func acquireKvStore(path string, syncWrites bool) (string, *kv.DB, error) {
+	key := path
+	if abs, err := filepath.Abs(path); err == nil {
+		key = abs
+	}
+	kvStorePool.Lock()
+	defer kvStorePool.Unlock()
+	s, ok := kvStorePool.items[key]
+	if !ok {
+		db, err := kv.OpenWithOptions(key, kv.Options{SyncWrites: syncWrites})
+		if err != nil {
+			return "", nil, err
+		}
+		s = &sharedKvStore{db: db}
+		kvStorePool.items[key] = s
+	}
+	s.refs++
+	return key, s.db, nil
+}
+
+// releaseKvStore 减少引用计数，没有节点使用时关闭存储
+func releaseKvStore(key string) {
+	kvStorePool.Lock()
+	defer kvStorePool.Unlock()
+	s, ok := kvStorePool.items[key]
+	if !ok {
+		return
+	}
+	s.refs--
+	if s.refs <= 0 {
+		delete(kvStorePool.items, key)
+		_ = s.db.Close()
+	}
+}
+
+// kvStoreNode kv存储节点公共部分
+type kvStoreNode struct {
+	base.SharedNode[*kv.DB]
+	storeConfig KvStoreConfiguration
+	//共享存储的key，空表示没有获取
+	storeKey       string
+	db             *kv.DB
+	bucketTemplate *el.MixedTemplate
+}
+
+// initStore 初始化桶模板和存储实例
+func (x *kvStoreNode) initStore(ruleConfig types.Config, nodeType string, config KvStoreConfiguration, configuration types.Configuration) error {
+	x.storeConfig = config
+	if x.storeConfig.Path == "" {
+		x.storeConfig.Path = DefaultKvStorePath
+	}
+	bucket := x.storeConfig.Bucket
+	if bucket == "" {
+		bucket = DefaultKvBucket
+		if chainCtx := base.NodeUtils.GetChainCtx(configuration); chainCtx != nil && chainCtx.GetNodeId().Id != "" {
+			bucket = chainCtx.GetNodeId().Id
+		}
+	}
+	var err error
+	if x.bucketTemplate, err = el.NewMixedTemplate(bucket); err != nil {
+		return err
+	}
+	return x.SharedNode.Init(ruleConfig, nodeType, x.storeConfig.Path, ruleConfig.NodeClientInitNow, func() (*kv.DB, error) {
+		return x.initClient()
+	})
+}
+
+// initClient 获取共享存储实例
+func (x *kvStoreNode) initClient() (*kv.DB, error) {
+	if x.db != nil {
+		return x.db, nil
+	}
+	x.Locker.Lock()
+	defer x.Locker.Unlock()
+	if x.db != nil {
+		return x.db, nil
+	}
+	key, db, err := acquireKvStore(x.storeConfig.Path, x.storeConfig.SyncWrites)
+	if err != nil {
+		return nil, err
+	}
+	x.storeKey = key
+	x.db = db
+	return db, nil
+}
+
+// bucket 获取桶名称
+func (x *kvStoreNode) bucket(env map[string]interface{}) string {
+	return x.bucketTemplate.ExecuteAsString(env)
+}
+
+// Destroy 释放共享存储实例
+func (x *kvStoreNode) Destroy() {
+	x.SharedNode.StopBackgroundInit()
+	x.Locker.Lock()
+	defer x.Locker.Unlock()
+	if x.storeKey != "" {
+		releaseKvStore(x.storeKey)
+		x.storeKey = ""
+		x.db = nil
+	}
+}
+
+// KvPutNodeConfiguration kv写入节点配置
+type KvPutNodeConfiguration struct {
+	// Path 存储文件路径，相同路径的节点共享同一个存储实例，见 KvStoreConfiguration
+	Path string `json:"path"`
+	// Bucket 桶，默认当前规则链ID，支持变量
+	Bucket string `json:"bucket"`
+	// SyncWrites 每次写入后是否同步到磁盘
+	SyncWrites bool `json:"syncWrites"`
+	// Key 键，可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
+	Key string `json:"key"`
+	// Value 值，为空则使用消息负荷，可以使用 ${metadata.key} 或者 ${msg.key} 变量
+	Value string `json:"value"`
+	// Ttl 过期时间，例如：10m、1h，为空表示不过期
+	Ttl string `json:"ttl"`
+}
+
+func (c KvPutNodeConfiguration) storeConfiguration() KvStoreConfiguration {
+	return KvStoreConfiguration{Path: c.Path, Bucket: c.Bucket, SyncWrites: c.SyncWrites}
+}
+
+// KvPutNode 把键值写入嵌入式kv存储，适用于没有Redis的边缘场景持久化设备注册表、阈值等查找表
+// 写入成功，把原消息发送到`Success`链，否则发送到`Failure`链
+type KvPutNode struct {
+	kvStoreNode
+	//节点配置
+	Config        KvPutNodeConfiguration
+	keyTemplate   *el.MixedTemplate
+	valueTemplate *el.MixedTemplate
+	ttl           time.Duration
+}
+
+// Type 组件类型
+func (x *KvPutNode) Type() string {
+	return "kvPut"
+}
+
+func (x *KvPutNode) New() types.Node {
+	return &KvPutNode{Config: KvPutNodeConfiguration{
+		Path: DefaultKvStorePath,
+		Key:  "${metadata.key}",
+	}}
+}
+
+// Init 初始化
+func (x *KvPutNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	if x.Config.Key == "" {
+		return errors.New("key can not be empty")
+	}
+	if x.keyTemplate, err = el.NewMixedTemplate(x.Config.Key); err != nil {
+		return err
+	}
+	if x.Config.Value != "" {
+		if x.valueTemplate, err = el.NewMixedTemplate(x.Config.Value); err != nil {
+			return err
+		}
+	}
+	if x.Config.Ttl != "" {
+		if x.ttl, err = time.ParseDuration(x.Config.Ttl); err != nil {
+			return err
+		}
+	}
+	return x.initStore(ruleConfig, x.Type(), x.Config.storeConfiguration(), configuration)
+}
+
+// OnMsg 处理消息
+func (x *KvPutNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	db, err := x.SharedNode.Get()
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	env := base.NodeUtils.GetEvnAndMetadata(ctx, msg)
+	value := msg.GetData()
+	if x.valueTemplate != nil {
+		value = x.valueTemplate.ExecuteAsString(env)
+	}
+	if err = db.Put(x.bucket(env), x.keyTemplate.ExecuteAsString(env), []byte(value), x.ttl); err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	ctx.TellSuccess(msg)
+}
+
+// KvGetNodeConfiguration kv查询节点配置
+type KvGetNodeConfiguration struct {
+	// Path 存储文件路径，相同路径的节点共享同一个存储实例，见 KvStoreConfiguration
+	Path string `json:"path"`
+	// Bucket 桶，默认当前规则链ID，支持变量
+	Bucket string `json:"bucket"`
+	// SyncWrites 每次写入后是否同步到磁盘
+	SyncWrites bool `json:"syncWrites"`
+	// Key 键，可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
+	Key string `json:"key"`
+	// OutputMode 输出模式
+	// 0:查询结果，以key为字段名合并到当前消息元数据
+	// 1:查询结果，以key为字段名合并到当前消息负荷，值是JSON则按照JSON合并。要求输入消息负荷`DataType`必须是JSON类型
+	// 2:查询结果，覆盖原消息负荷输出
+	OutputMode int `json:"outputMode"`
+}
+
+func (c KvGetNodeConfiguration) storeConfiguration() KvStoreConfiguration {
+	return KvStoreConfiguration{Path: c.Path, Bucket: c.Bucket, SyncWrites: c.SyncWrites}
+}
+
+// KvGetNode 从嵌入式kv存储查询键值
+// 查询成功，把消息发送到`Success`链；key不存在或者已经过期，把原消息发送到`Failure`链
+type KvGetNode struct {
+	kvStoreNode
+	//节点配置
+	Config      KvGetNodeConfiguration
+	keyTemplate *el.MixedTemplate
+}
+
+// Type 组件类型
+func (x *KvGetNode) Type() string {
+	return "kvGet"
+}
+
+func (x *KvGetNode) New() types.Node {
+	return &KvGetNode{Config: KvGetNodeConfiguration{
+		Path:       DefaultKvStorePath,
+		Key:        "${metadata.key}",
+		OutputMode: CacheOutputModeNewMsg,
+	}}
+}
+
+// Init 初始化
+func (x *KvGetNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	if x.Config.Key == "" {
+		return errors.New("key can not be empty")
+	}
+	if x.keyTemplate, err = el.NewMixedTemplate(x.Config.Key); err != nil {
+		return err
+	}
+	return x.initStore(ruleConfig, x.Type(), x.Config.storeConfiguration(), configuration)
+}
+
+// OnMsg 处理消息
+func (x *KvGetNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	db, err := x.SharedNode.Get()
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	env := base.NodeUtils.GetEvnAndMetadata(ctx, msg)
+	key := x.keyTemplate.ExecuteAsString(env)
+	value, err := db.Get(x.bucket(env), key)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	switch x.Config.OutputMode {
+	case CacheOutputModeMergeToMetadata:
+		msg.Metadata.PutValue(key, string(value))
+	case CacheOutputModeMergeToMsg:
+		if msg.DataType != types.JSON {
+			ctx.TellFailure(msg, errors.New("data type must be JSON type"))
+			return
+		}
+		if err = msg.SetDataPath("/"+json.EscapePointer(key), kvValue(value)); err != nil {
+			ctx.TellFailure(msg, err)
+			return
+		}
+	default:
+		msg.SetData(string(value))
+	}
+	ctx.TellSuccess(msg)
+}
+
+// KvScanNodeConfiguration kv扫描节点配置
+type KvScanNodeConfiguration struct {
+	// Path 存储文件路径，相同路径的节点共享同一个存储实例，见 KvStoreConfiguration
+	Path string `json:"path"`
+	// Bucket 桶，默认当前规则链ID，支持变量
+	Bucket string `json:"bucket"`
+	// SyncWrites 每次写入后是否同步到磁盘
+	SyncWrites bool `json:"syncWrites"`
+	// Prefix key前缀，为空表示扫描整个桶
+	// 可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
+	Prefix string `json:"prefix"`
+	// Limit 最多返回的条目数，按key升序，<=0表示不限制
+	Limit int `json:"limit"`
+	// OutputMode 输出模式
+	// 0:扫描结果转成JSON数组 [{"key":"","value":...,"expireAt":0}]，覆盖原消息负荷，通过`Success`链输出
+	// 1:迭代模式，每个条目的值作为消息负荷，key写入元数据kvKey，通过`True`链输出，遍历结束后原消息通过`Success`链输出
+	OutputMode int `json:"outputMode"`
+}
+
+func (c KvScanNodeConfiguration) storeConfiguration() KvStoreConfiguration {
+	return KvStoreConfiguration{Path: c.Path, Bucket: c.Bucket, SyncWrites: c.SyncWrites}
+}
+
+// KvScanNode 按前缀扫描嵌入式kv存储
+// 元数据kvCount为扫描结果数量
+type KvScanNode struct {
+	kvStoreNode
+	//节点配置
+	Config         KvScanNodeConfiguration
+	prefixTemplate *el.MixedTemplate
+}
+
+// Type 组件类型
+func (x *KvScanNode) Type() string {
+	return "kvScan"
+}
+
+func (x *KvScanNode) New() types.Node {
+	return &KvScanNode{Config: KvScanNodeConfiguration{
+		Path:       DefaultKvStorePath,
+		Limit:      100,
+		OutputMode: KvScanOutputModeArray,
+	}}
+}
+
+// Init 初始化
+func (x *KvScanNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	if x.prefixTemplate, err = el.NewMixedTemplate(x.Config.Prefix); err != nil {
+		return err
+	}
+	return x.initStore(ruleConfig, x.Type(), x.Config.storeConfiguration(), configuration)
+}
+
+// OnMsg 处理消息
+func (x *KvScanNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	db, err := x.SharedNode.Get()
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	env := base.NodeUtils.GetEvnAndMetadata(ctx, msg)
+	entries, err := db.Scan(x.bucket(env), x.prefixTemplate.ExecuteAsString(env), x.Config.Limit)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	if x.Config.OutputMode == KvScanOutputModeIterator {
+		for _, entry := range entries {
+			itemMsg := msg.Copy()
+			itemMsg.Metadata.PutValue(KeyKvKey, entry.Key)
+			itemMsg.SetData(string(entry.Value))
+			ctx.TellNext(itemMsg, types.True)
+		}
+		msg.Metadata.PutValue(KeyKvCount, strconv.Itoa(len(entries)))
+		ctx.TellSuccess(msg)
+		return
+	}
+	items := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		items = append(items, map[string]interface{}{
+			"key":      entry.Key,
+			"value":    kvValue(entry.Value),
+			"expireAt": entry.ExpireAt,
+		})
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	msg.Metadata.PutValue(KeyKvCount, strconv.Itoa(len(entries)))
+	msg.DataType = types.JSON
+	msg.SetData(string(data))
+	ctx.TellSuccess(msg)
+}
+
+// kvValue 值是JSON则解析为JSON，否则作为字符串
+func kvValue(value []byte) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(value, &v); err == nil {
+		return v
+	}
+	return string(value)
+}
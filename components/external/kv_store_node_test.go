@@ -0,0 +1,186 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/kv"
+)
+
+type kvResult struct {
+	msg          types.RuleMsg
+	relationType string
+	err          error
+}
+
+// kvOnMsg 同步执行节点，返回所有输出
+func kvOnMsg(node types.Node, msg types.RuleMsg) []kvResult {
+	var results []kvResult
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		results = append(results, kvResult{msg: msg, relationType: relationType, err: err})
+	})
+	node.OnMsg(ctx, msg)
+	return results
+}
+
+func TestKvStoreNode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes.kv")
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, "kvPut", &KvPutNode{}, types.Configuration{
+			"path": DefaultKvStorePath,
+			"key":  "${metadata.key}",
+		}, Registry)
+		test.NodeNew(t, "kvScan", &KvScanNode{}, types.Configuration{
+			"limit":      100,
+			"outputMode": KvScanOutputModeArray,
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		_, err := test.CreateAndInitNode("kvPut", types.Configuration{"path": path, "key": ""}, Registry)
+		assert.NotNil(t, err)
+		_, err = test.CreateAndInitNode("kvPut", types.Configuration{"path": path, "key": "a", "ttl": "abc"}, Registry)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("OnMsg", func(t *testing.T) {
+		putNode, err := test.CreateAndInitNode("kvPut", types.Configuration{
+			"path":   path,
+			"bucket": "devices",
+			"key":    "${metadata.deviceId}",
+		}, Registry)
+		assert.Nil(t, err)
+		defer putNode.Destroy()
+		ttlNode, err := test.CreateAndInitNode("kvPut", types.Configuration{
+			"path":   path,
+			"bucket": "devices",
+			"key":    "tmp-${metadata.deviceId}",
+			"value":  "${msg.name}",
+			"ttl":    "20ms",
+		}, Registry)
+		assert.Nil(t, err)
+		defer ttlNode.Destroy()
+
+		for _, id := range []string{"dev-2", "dev-1", "gw-1"} {
+			metadata := types.NewMetadata()
+			metadata.PutValue("deviceId", id)
+			results := kvOnMsg(putNode, types.NewMsg(0, "TEST", types.JSON, metadata, `{"name":"`+id+`","threshold":30}`))
+			assert.Equal(t, types.Success, results[0].relationType)
+			results = kvOnMsg(ttlNode, types.NewMsg(0, "TEST", types.JSON, metadata, `{"name":"`+id+`"}`))
+			assert.Equal(t, types.Success, results[0].relationType)
+		}
+
+		//合并到元数据
+		getNode, err := test.CreateAndInitNode("kvGet", types.Configuration{
+			"path":       path,
+			"bucket":     "${metadata.bucket}",
+			"key":        "${metadata.deviceId}",
+			"outputMode": CacheOutputModeMergeToMetadata,
+		}, Registry)
+		assert.Nil(t, err)
+		defer getNode.Destroy()
+		metadata := types.NewMetadata()
+		metadata.PutValue("bucket", "devices")
+		metadata.PutValue("deviceId", "dev-1")
+		results := kvOnMsg(getNode, types.NewMsg(0, "TEST", types.JSON, metadata, `{}`))
+		assert.Equal(t, types.Success, results[0].relationType)
+		assert.Equal(t, `{"name":"dev-1","threshold":30}`, results[0].msg.Metadata.GetValue("dev-1"))
+
+		//合并到消息负荷
+		mergeNode, err := test.CreateAndInitNode("kvGet", types.Configuration{
+			"path":       path,
+			"bucket":     "devices",
+			"key":        "tmp-${metadata.deviceId}",
+			"outputMode": CacheOutputModeMergeToMsg,
+		}, Registry)
+		assert.Nil(t, err)
+		defer mergeNode.Destroy()
+		results = kvOnMsg(mergeNode, types.NewMsg(0, "TEST", types.JSON, metadata, `{"a":1}`))
+		assert.Equal(t, `{"a":1,"tmp-dev-1":"dev-1"}`, results[0].msg.GetData())
+
+		//key不存在
+		metadata.PutValue("deviceId", "notFound")
+		results = kvOnMsg(getNode, types.NewMsg(0, "TEST", types.JSON, metadata, `{}`))
+		assert.Equal(t, types.Failure, results[0].relationType)
+		assert.Equal(t, kv.ErrNotFound, results[0].err)
+
+		//扫描为JSON数组
+		scanNode, err := test.CreateAndInitNode("kvScan", types.Configuration{
+			"path":   path,
+			"bucket": "devices",
+			"prefix": "${metadata.prefix}",
+			"limit":  2,
+		}, Registry)
+		assert.Nil(t, err)
+		defer scanNode.Destroy()
+		metadata = types.NewMetadata()
+		metadata.PutValue("prefix", "")
+		results = kvOnMsg(scanNode, types.NewMsg(0, "TEST", types.JSON, metadata, `{}`))
+		assert.Equal(t, types.Success, results[0].relationType)
+		assert.Equal(t, "2", results[0].msg.Metadata.GetValue(KeyKvCount))
+		assert.Equal(t, `[{"expireAt":0,"key":"dev-1","value":{"name":"dev-1","threshold":30}},{"expireAt":0,"key":"dev-2","value":{"name":"dev-2","threshold":30}}]`, results[0].msg.GetData())
+
+		//迭代模式，过期的key不输出
+		iteratorNode, err := test.CreateAndInitNode("kvScan", types.Configuration{
+			"path":       path,
+			"bucket":     "devices",
+			"prefix":     "${metadata.prefix}",
+			"limit":      0,
+			"outputMode": KvScanOutputModeIterator,
+		}, Registry)
+		assert.Nil(t, err)
+		defer iteratorNode.Destroy()
+		results = kvOnMsg(iteratorNode, types.NewMsg(0, "TEST", types.JSON, metadata, `{}`))
+		assert.Equal(t, 7, len(results))
+		time.Sleep(time.Millisecond * 30)
+		results = kvOnMsg(iteratorNode, types.NewMsg(0, "TEST", types.JSON, metadata, `{}`))
+		assert.Equal(t, 4, len(results))
+		assert.Equal(t, types.True, results[0].relationType)
+		assert.Equal(t, "dev-1", results[0].msg.Metadata.GetValue(KeyKvKey))
+		assert.Equal(t, `{"name":"dev-1","threshold":30}`, results[0].msg.GetData())
+		assert.Equal(t, "gw-1", results[2].msg.Metadata.GetValue(KeyKvKey))
+		assert.Equal(t, types.Success, results[3].relationType)
+		assert.Equal(t, "3", results[3].msg.Metadata.GetValue(KeyKvCount))
+		assert.Equal(t, `{}`, results[3].msg.GetData())
+
+		//相同路径的节点共享同一个存储实例
+		absPath, _ := filepath.Abs(path)
+		kvStorePool.Lock()
+		assert.Equal(t, 6, kvStorePool.items[absPath].refs)
+		kvStorePool.Unlock()
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		//所有节点销毁后存储被关闭，数据持久化到文件
+		kvStorePool.Lock()
+		assert.Equal(t, 0, len(kvStorePool.items))
+		kvStorePool.Unlock()
+		db, err := kv.Open(path)
+		assert.Nil(t, err)
+		defer db.Close()
+		v, err := db.Get("devices", "gw-1")
+		assert.Nil(t, err)
+		assert.Equal(t, `{"name":"gw-1","threshold":30}`, string(v))
+	})
+}
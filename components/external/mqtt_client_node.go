@@ -18,6 +18,8 @@ package external
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -38,10 +40,22 @@ import (
 //	       "debugMode": false,
 //	       "configuration": {
 //	         "Server": "127.0.0.1:1883",
-//	         "Topic": "/device/msg"
+//	         "Topic": "/device/msg",
+//	         "Retained": false
 //	       }
 //	     }
 
+const (
+	// KeyMqttTopic 元数据key：消息的发布主题，优先于节点配置的 Topic
+	KeyMqttTopic = "mqttTopic"
+	// KeyMqttQos 元数据key：消息的发布QoS，取值0、1、2，优先于节点配置的 QOS
+	KeyMqttQos = "mqttQos"
+	// KeyMqttPacketId 元数据key：QoS 1/2发布报文的标识符
+	KeyMqttPacketId = "mqttPacketId"
+	// KeyMqttPublishLatency 元数据key：QoS 1/2从发布到收到broker确认的耗时，单位毫秒
+	KeyMqttPublishLatency = "mqttPublishLatency"
+)
+
 func init() {
 	Registry.Add(&MqttClientNode{})
 }
@@ -49,17 +63,46 @@ func init() {
 type MqttClientNodeConfiguration struct {
 	Server   string
 	Username string
-	Password string
+	Password string `secret:"true"`
 	// Topic 发布主题 可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
+	// 消息元数据 KeyMqttTopic 不为空时使用该主题发布，例如：设备下发的指令携带了目标主题
 	Topic string
+	// Retained 是否发布保留消息，broker保留该主题的最后一条消息，发送给之后订阅的客户端
+	Retained bool
 	//MaxReconnectInterval 重连间隔 单位秒
 	MaxReconnectInterval int
 	QOS                  uint8
 	CleanSession         bool
 	ClientID             string
-	CAFile               string
-	CertFile             string
-	CertKeyFile          string
+	// PublishTimeout 发布超时，单位为秒，QoS 1/2等待broker确认(PUBACK/PUBCOMP)，超时没有确认则发送到Failure链
+	// 如果<=0 则一直等待，默认10。消息元数据 KeyMqttQos 不为空时使用该QoS代替 QOS
+	PublishTimeout int
+	// KeepAlive 心跳间隔，单位为秒，如果<=0 则默认30
+	KeepAlive int
+	// WillTopic 遗嘱消息主题，为空不设置遗嘱消息，客户端异常断开时broker发布遗嘱消息，用于网关在线状态
+	WillTopic string
+	// WillPayload 遗嘱消息内容
+	WillPayload string
+	// WillQos 遗嘱消息QoS
+	WillQos uint8
+	// WillRetained 遗嘱消息是否保留
+	WillRetained bool
+	// InitialReconnectInterval 首次重连间隔，单位为秒，之后每次失败翻倍直到 MaxReconnectInterval，如果<=0 则默认1
+	InitialReconnectInterval int
+	// ReconnectJitter 重连间隔的随机抖动比例，取值0~1，例如：0.2表示在间隔的80%~120%之间随机
+	ReconnectJitter float64
+	// Payload 发布数据的模板，为空发布消息负荷原始数据，二进制消息不使用模板
+	// 可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换，例如：{"deviceId":"${metadata.deviceId}","payload":${msg}}
+	// 变量不存在时发送到Failure链
+	Payload string
+	// CAFile、CertFile、CertKeyFile 证书文件，兼容旧配置，推荐使用 TLS
+	CAFile      string
+	CertFile    string
+	CertKeyFile string
+	// TLS 配置，证书支持文件路径或者PEM内容
+	TLS types.TLSConfig
+	// ProtocolVersion 协议版本：3（MQTT 3.1）、4（MQTT 3.1.1），为0时先使用3.1.1连接，失败再使用3.1。不支持MQTT 5
+	ProtocolVersion uint
 }
 
 func (x *MqttClientNodeConfiguration) ToMqttConfig() mqtt.Config {
@@ -77,6 +120,16 @@ func (x *MqttClientNodeConfiguration) ToMqttConfig() mqtt.Config {
 		CAFile:               x.CAFile,
 		CertFile:             x.CertFile,
 		CertKeyFile:          x.CertKeyFile,
+		TLS:                  x.TLS,
+		KeepAlive:            time.Duration(x.KeepAlive) * time.Second,
+		WillTopic:            x.WillTopic,
+		WillPayload:          x.WillPayload,
+		WillQos:              x.WillQos,
+		WillRetained:         x.WillRetained,
+
+		InitialReconnectInterval: time.Duration(x.InitialReconnectInterval) * time.Second,
+		ReconnectJitter:          x.ReconnectJitter,
+		ProtocolVersion:          x.ProtocolVersion,
 	}
 }
 
@@ -88,6 +141,9 @@ type MqttClientNode struct {
 	topicTemplate str.Template
 	client        *mqtt.Client
 	clientMutex   sync.RWMutex // Add mutex for thread safety
+	//连接失败次数和下次连接时间，退避期间直接返回 mqtt.ErrNotConnected
+	dialAttempts int
+	nextDial     time.Time
 }
 
 // Type 组件类型
@@ -101,6 +157,7 @@ func (x *MqttClientNode) New() types.Node {
 		Server:               "127.0.0.1:1883",
 		QOS:                  0,
 		MaxReconnectInterval: 60,
+		PublishTimeout:       10,
 	}}
 }
 
@@ -108,9 +165,16 @@ func (x *MqttClientNode) New() types.Node {
 func (x *MqttClientNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
 	err := maps.Map2Struct(configuration, &x.Config)
 	if err == nil {
-		_ = x.SharedNode.Init(ruleConfig, x.Type(), x.Config.Server, ruleConfig.NodeClientInitNow, func() (*mqtt.Client, error) {
+		if err = mqtt.CheckProtocolVersion(x.Config.ProtocolVersion); err != nil {
+			return err
+		}
+		initErr := x.SharedNode.Init(ruleConfig, x.Type(), x.Config.Server, ruleConfig.NodeClientInitNow, func() (*mqtt.Client, error) {
 			return x.initClient()
 		})
+		//节点显式指定立即初始化，初始化失败则规则链加载失败
+		if initErr != nil && ruleConfig.NodeClientInitPolicy == types.InitPolicyEager {
+			return initErr
+		}
 		x.topicTemplate = str.NewTemplate(x.Config.Topic)
 	}
 	return err
@@ -118,13 +182,35 @@ func (x *MqttClientNode) Init(ruleConfig types.Config, configuration types.Confi
 
 // OnMsg 处理消息
 func (x *MqttClientNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
-	topic := x.topicTemplate.ExecuteFn(func() map[string]any {
-		return base.NodeUtils.GetEvnAndMetadata(ctx, msg)
-	})
+	topic := msg.Metadata.GetValue(KeyMqttTopic)
+	if topic == "" {
+		topic = x.topicTemplate.ExecuteFn(func() map[string]any {
+			return base.NodeUtils.GetEvnAndMetadata(ctx, msg)
+		})
+	}
+	qos, err := x.qos(msg)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	payload, err := x.payload(ctx, msg)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
 	if client, err := x.SharedNode.Get(); err != nil {
 		ctx.TellFailure(msg, err)
+	} else if !client.IsConnected() {
+		//正在重连，不等待发布超时
+		ctx.TellFailure(msg, mqtt.ErrNotConnected)
 	} else {
-		if err := client.Publish(topic, x.Config.QOS, []byte(msg.GetData())); err != nil {
+		packetId, latency, err := client.PublishAndWait(topic, qos, x.Config.Retained, payload,
+			time.Duration(x.Config.PublishTimeout)*time.Second)
+		if qos > 0 {
+			msg.Metadata.PutValue(KeyMqttPacketId, strconv.Itoa(int(packetId)))
+			msg.Metadata.PutValue(KeyMqttPublishLatency, strconv.FormatInt(latency.Milliseconds(), 10))
+		}
+		if err != nil {
 			ctx.TellFailure(msg, err)
 		} else {
 			ctx.TellSuccess(msg)
@@ -132,8 +218,34 @@ func (x *MqttClientNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 	}
 }
 
+// payload 获取发布的数据，配置了 Payload 模板时使用模板替换，二进制消息不使用模板，避免数据损坏
+func (x *MqttClientNode) payload(ctx types.RuleContext, msg types.RuleMsg) ([]byte, error) {
+	if x.Config.Payload == "" || msg.DataType == types.BINARY {
+		return msg.GetBytes(), nil
+	}
+	payload, err := str.ExecuteTemplateStrict(x.Config.Payload, base.NodeUtils.GetEvnAndMetadata(ctx, msg))
+	if err != nil {
+		return nil, fmt.Errorf("payload %w", err)
+	}
+	return []byte(payload), nil
+}
+
+// qos 获取消息的发布QoS，元数据 KeyMqttQos 为空使用节点配置
+func (x *MqttClientNode) qos(msg types.RuleMsg) (byte, error) {
+	value := msg.Metadata.GetValue(KeyMqttQos)
+	if value == "" {
+		return x.Config.QOS, nil
+	}
+	qos, err := strconv.Atoi(value)
+	if err != nil || qos < 0 || qos > 2 {
+		return 0, fmt.Errorf("invalid %s: %s", KeyMqttQos, value)
+	}
+	return byte(qos), nil
+}
+
 // Destroy 销毁
 func (x *MqttClientNode) Destroy() {
+	x.SharedNode.StopBackgroundInit()
 	x.clientMutex.RLock()
 	client := x.client
 	x.clientMutex.RUnlock()
@@ -145,25 +257,53 @@ func (x *MqttClientNode) Destroy() {
 
 // initClient 初始化客户端
 func (x *MqttClientNode) initClient() (*mqtt.Client, error) {
+	if client := x.currentClient(); client != nil {
+		return client, nil
+	}
 	x.Locker.Lock()
 	defer x.Locker.Unlock()
-
-	x.clientMutex.RLock()
-	if x.client != nil {
-		existingClient := x.client
-		x.clientMutex.RUnlock()
-		return existingClient, nil
+	if client := x.currentClient(); client != nil {
+		return client, nil
+	}
+	//上次连接失败，退避期间直接返回
+	if time.Now().Before(x.nextDial) {
+		return nil, fmt.Errorf("%w: %s", mqtt.ErrNotConnected, x.Config.Server)
 	}
-	x.clientMutex.RUnlock()
 
 	ctx, cancel := context.WithTimeout(context.TODO(), 4*time.Second)
 	defer cancel()
 
-	client, err := mqtt.NewClient(ctx, x.Config.ToMqttConfig())
+	config := x.Config.ToMqttConfig()
+	client, err := mqtt.NewClient(ctx, config)
 	if err == nil {
+		x.dialAttempts = 0
+		x.nextDial = time.Time{}
+		client.AddStateListener(x.onStateChange)
 		x.clientMutex.Lock()
 		x.client = client
 		x.clientMutex.Unlock()
+	} else {
+		x.dialAttempts++
+		x.nextDial = time.Now().Add(config.ReconnectDelay(x.dialAttempts))
 	}
 	return client, err
 }
+
+func (x *MqttClientNode) currentClient() *mqtt.Client {
+	x.clientMutex.RLock()
+	defer x.clientMutex.RUnlock()
+	return x.client
+}
+
+// onStateChange 连接断开发布 types.EventResourceUnhealthy 事件，重连成功发布 types.EventResourceRecovered 事件
+func (x *MqttClientNode) onStateChange(connected bool, err error) {
+	if connected {
+		x.RuleConfig.PublishEvent(types.EventResourceRecovered, x.Config.Server, map[string]interface{}{"type": x.Type()})
+		return
+	}
+	data := map[string]interface{}{"type": x.Type()}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	x.RuleConfig.PublishEvent(types.EventResourceUnhealthy, x.Config.Server, data)
+}
@@ -17,11 +17,20 @@
 package external
 
 import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/test"
 	"github.com/rulego/rulego/test/assert"
-	"testing"
-	"time"
+	"github.com/rulego/rulego/utils/mqtt"
 )
 
 func TestMqttClientNode(t *testing.T) {
@@ -64,6 +73,24 @@ func TestMqttClientNode(t *testing.T) {
 		}, Registry)
 	})
 
+	t.Run("ProtocolVersion", func(t *testing.T) {
+		//不支持MQTT 5，初始化失败
+		_, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"topic":           "/device/msg",
+			"server":          "127.0.0.1:1883",
+			"protocolVersion": 5,
+		}, Registry)
+		assert.True(t, errors.Is(err, mqtt.ErrProtocolVersionNotSupported))
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"topic":           "/device/msg",
+			"server":          "127.0.0.1:1883",
+			"protocolVersion": 4,
+		}, Registry)
+		assert.Nil(t, err)
+		assert.Equal(t, uint(4), node.(*MqttClientNode).Config.ToMqttConfig().ProtocolVersion)
+		node.Destroy()
+	})
+
 	t.Run("OnMsg", func(t *testing.T) {
 		node1, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
 			"topic":                "/device/msg",
@@ -131,3 +158,341 @@ func TestMqttClientNode(t *testing.T) {
 		time.Sleep(time.Second * 2)
 	})
 }
+
+func TestMqttClientNodeRetainedAndTopic(t *testing.T) {
+	broker := newBrokerStub(t)
+	defer broker.Close()
+
+	node, err := test.CreateAndInitNode("mqttClient", types.Configuration{
+		"server":   broker.Addr().String(),
+		"topic":    "/device/${metadata.productType}",
+		"retained": true,
+		"qOS":      uint8(1),
+	}, Registry)
+	assert.Nil(t, err)
+	defer node.Destroy()
+	assert.True(t, node.(*MqttClientNode).Config.Retained)
+
+	metaData := types.BuildMetadata(map[string]string{"productType": "test"})
+	commandMetaData := types.BuildMetadata(map[string]string{"productType": "test", KeyMqttTopic: "/device/d01/command"})
+	msgList := []test.Msg{
+		{MetaData: metaData, MsgType: "TELEMETRY", Data: "AA"},
+		{MetaData: commandMetaData, MsgType: "COMMAND", Data: "BB"},
+	}
+	test.NodeOnMsgWithChildren(t, node, msgList, nil, func(msg types.RuleMsg, relationType string, err error) {
+		assert.Equal(t, types.Success, relationType)
+	})
+	published := map[string]brokerPublish{}
+	for i := 0; i < len(msgList); i++ {
+		select {
+		case item := <-broker.published:
+			published[item.payload] = item
+		case <-time.After(time.Second * 5):
+			t.Fatal("publish timeout")
+		}
+	}
+	assert.Equal(t, brokerPublish{topic: "/device/test", payload: "AA", retained: true}, published["AA"])
+	//元数据的主题优先于节点配置
+	assert.Equal(t, brokerPublish{topic: "/device/d01/command", payload: "BB", retained: true}, published["BB"])
+
+	//默认不保留
+	node2, err := test.CreateAndInitNode("mqttClient", types.Configuration{
+		"server": broker.Addr().String(),
+		"topic":  "/device/msg",
+	}, Registry)
+	assert.Nil(t, err)
+	defer node2.Destroy()
+	test.NodeOnMsgWithChildren(t, node2, msgList[:1], nil, func(msg types.RuleMsg, relationType string, err error) {
+		assert.Equal(t, types.Success, relationType)
+	})
+	select {
+	case item := <-broker.published:
+		assert.Equal(t, brokerPublish{topic: "/device/msg", payload: "AA"}, item)
+	case <-time.After(time.Second * 5):
+		t.Fatal("publish timeout")
+	}
+}
+
+func TestMqttClientNodeQosAndPublishTimeout(t *testing.T) {
+	broker := newBrokerStub(t)
+	defer broker.Close()
+
+	node, err := test.CreateAndInitNode("mqttClient", types.Configuration{
+		"server":         broker.Addr().String(),
+		"topic":          "/device/msg",
+		"publishTimeout": 1,
+	}, Registry)
+	assert.Nil(t, err)
+	defer node.Destroy()
+
+	publish := func(qos string) (types.RuleMsg, string, error) {
+		metaData := types.NewMetadata()
+		if qos != "" {
+			metaData.PutValue(KeyMqttQos, qos)
+		}
+		type result struct {
+			msg      types.RuleMsg
+			relation string
+			err      error
+		}
+		done := make(chan result, 1)
+		test.NodeOnMsgWithChildren(t, node, []test.Msg{{MetaData: metaData, MsgType: "COMMAND", Data: "AA"}}, nil, func(msg types.RuleMsg, relationType string, err error) {
+			done <- result{msg: msg, relation: relationType, err: err}
+		})
+		select {
+		case r := <-done:
+			return r.msg, r.relation, r.err
+		case <-time.After(time.Second * 5):
+			t.Fatal("publish timeout")
+			return types.RuleMsg{}, "", nil
+		}
+	}
+	//没有指定使用节点配置的QoS 0，不记录报文标识符
+	msg, relation, _ := publish("")
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, "", msg.Metadata.GetValue(KeyMqttPacketId))
+	<-broker.published
+
+	for _, qos := range []string{"1", "2"} {
+		msg, relation, _ = publish(qos)
+		assert.Equal(t, types.Success, relation)
+		assert.True(t, msg.Metadata.GetValue(KeyMqttPacketId) != "" && msg.Metadata.GetValue(KeyMqttPacketId) != "0")
+		assert.True(t, msg.Metadata.GetValue(KeyMqttPublishLatency) != "")
+		<-broker.published
+	}
+
+	//无效的QoS
+	_, relation, err = publish("3")
+	assert.Equal(t, types.Failure, relation)
+	assert.NotNil(t, err)
+
+	//超时没有收到确认
+	atomic.StoreInt32(&broker.noAck, 1)
+	msg, relation, err = publish("1")
+	assert.Equal(t, types.Failure, relation)
+	assert.Equal(t, mqtt.ErrPublishTimeout, err)
+	assert.True(t, msg.Metadata.GetValue(KeyMqttPacketId) != "")
+}
+
+func TestMqttClientNodeWillAndKeepAlive(t *testing.T) {
+	node, err := test.CreateAndInitNode("mqttClient", types.Configuration{
+		"server":       "127.0.0.1:1883",
+		"keepAlive":    15,
+		"willTopic":    "/gateway/status",
+		"willPayload":  "offline",
+		"willQos":      uint8(1),
+		"willRetained": true,
+	}, Registry)
+	assert.Nil(t, err)
+	opts, err := mqtt.NewClientOptions(node.(*MqttClientNode).Config.ToMqttConfig())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15), opts.KeepAlive)
+	assert.True(t, opts.WillEnabled)
+	assert.Equal(t, "/gateway/status", opts.WillTopic)
+	assert.Equal(t, "offline", string(opts.WillPayload))
+	assert.Equal(t, byte(1), opts.WillQos)
+	assert.True(t, opts.WillRetained)
+}
+
+func TestMqttClientNodePayload(t *testing.T) {
+	broker := newBrokerStub(t)
+	defer broker.Close()
+
+	node, err := test.CreateAndInitNode("mqttClient", types.Configuration{
+		"server":  broker.Addr().String(),
+		"topic":   "/device/msg",
+		"payload": `{"deviceId":"${metadata.deviceId}","payload":${msg}}`,
+	}, Registry)
+	assert.Nil(t, err)
+	defer node.Destroy()
+	publish := func(msg test.Msg) (string, error) {
+		type result struct {
+			relation string
+			err      error
+		}
+		done := make(chan result, 1)
+		test.NodeOnMsgWithChildren(t, node, []test.Msg{msg}, nil, func(msg types.RuleMsg, relationType string, err error) {
+			done <- result{relation: relationType, err: err}
+		})
+		r := <-done
+		return r.relation, r.err
+	}
+	metaData := types.BuildMetadata(map[string]string{"deviceId": "d01"})
+	relation, _ := publish(test.Msg{MetaData: metaData, DataType: types.JSON, MsgType: "TELEMETRY", Data: `{"temperature":60}`})
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, `{"deviceId":"d01","payload":{"temperature":60}}`, (<-broker.published).payload)
+
+	//二进制消息不使用模板
+	relation, _ = publish(test.Msg{MetaData: metaData, DataType: types.BINARY, MsgType: "TELEMETRY", Data: "\x00${msg}"})
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, "\x00${msg}", (<-broker.published).payload)
+
+	//变量不存在
+	relation, err = publish(test.Msg{MetaData: types.NewMetadata(), DataType: types.JSON, MsgType: "TELEMETRY", Data: `{"temperature":60}`})
+	assert.Equal(t, types.Failure, relation)
+	assert.True(t, strings.Contains(err.Error(), `rendered: {"deviceId":"`))
+}
+
+// eventRecorder 记录发布的事件
+type eventRecorder struct {
+	types.EventBus
+	events chan types.Event
+}
+
+func (r *eventRecorder) Publish(event types.Event) {
+	r.events <- event
+}
+
+func TestMqttClientNodeReconnect(t *testing.T) {
+	broker := newBrokerStub(t)
+	defer broker.Close()
+
+	recorder := &eventRecorder{events: make(chan types.Event, 10)}
+	config := types.NewConfig(types.WithEventBus(recorder))
+	node := &MqttClientNode{}
+	err := node.Init(config, types.Configuration{
+		"server":                   broker.Addr().String(),
+		"topic":                    "/device/msg",
+		"initialReconnectInterval": 1,
+	})
+	assert.Nil(t, err)
+	defer node.Destroy()
+	publish := func() (string, error) {
+		type result struct {
+			relation string
+			err      error
+		}
+		done := make(chan result, 1)
+		test.NodeOnMsgWithChildren(t, node, []test.Msg{{MetaData: types.NewMetadata(), MsgType: "TELEMETRY", Data: "AA"}}, nil, func(msg types.RuleMsg, relationType string, err error) {
+			done <- result{relation: relationType, err: err}
+		})
+		r := <-done
+		return r.relation, r.err
+	}
+	relation, _ := publish()
+	assert.Equal(t, types.Success, relation)
+	<-broker.published
+
+	//连接断开后直接发送到Failure链
+	broker.dropConnections()
+	select {
+	case event := <-recorder.events:
+		assert.Equal(t, types.EventResourceUnhealthy, event.Type)
+		assert.Equal(t, broker.Addr().String(), event.Subject)
+	case <-time.After(time.Second * 5):
+		t.Fatal("unhealthy event timeout")
+	}
+	relation, err = publish()
+	assert.Equal(t, types.Failure, relation)
+	assert.Equal(t, mqtt.ErrNotConnected, err)
+
+	//重连成功
+	select {
+	case event := <-recorder.events:
+		assert.Equal(t, types.EventResourceRecovered, event.Type)
+	case <-time.After(time.Second * 5):
+		t.Fatal("recovered event timeout")
+	}
+	relation, _ = publish()
+	assert.Equal(t, types.Success, relation)
+}
+
+// brokerPublish broker收到的发布消息
+type brokerPublish struct {
+	topic    string
+	payload  string
+	retained bool
+}
+
+// brokerStub 只处理连接、发布和心跳的MQTT 3.1.1 broker
+type brokerStub struct {
+	net.Listener
+	published chan brokerPublish
+	//不回复QoS 1/2的发布确认
+	noAck int32
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// dropConnections 断开所有客户端连接，客户端按照重连间隔重连
+func (b *brokerStub) dropConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		_ = conn.Close()
+	}
+	b.conns = nil
+}
+
+func newBrokerStub(t *testing.T) *brokerStub {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	broker := &brokerStub{Listener: ln, published: make(chan brokerPublish, 10)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			broker.mu.Lock()
+			broker.conns = append(broker.conns, conn)
+			broker.mu.Unlock()
+			go broker.serve(conn)
+		}
+	}()
+	return broker
+}
+
+func (b *brokerStub) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		header, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		//剩余长度
+		length, multiplier := 0, 1
+		for {
+			digit, err := reader.ReadByte()
+			if err != nil {
+				return
+			}
+			length += int(digit&127) * multiplier
+			multiplier *= 128
+			if digit&128 == 0 {
+				break
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return
+		}
+		switch header >> 4 {
+		case 1: //CONNECT
+			_, _ = conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 3: //PUBLISH
+			qos := (header >> 1) & 0x03
+			topicLen := int(body[0])<<8 | int(body[1])
+			offset := 2 + topicLen
+			if qos > 0 {
+				if atomic.LoadInt32(&b.noAck) == 0 {
+					//QoS 1回复PUBACK，QoS 2回复PUBREC
+					ack := byte(0x40)
+					if qos == 2 {
+						ack = 0x50
+					}
+					_, _ = conn.Write([]byte{ack, 0x02, body[offset], body[offset+1]})
+				}
+				offset += 2
+			}
+			b.published <- brokerPublish{topic: string(body[2 : 2+topicLen]), payload: string(body[offset:]), retained: header&0x01 == 1}
+		case 6: //PUBREL
+			_, _ = conn.Write([]byte{0x70, 0x02, body[0], body[1]})
+		case 12: //PINGREQ
+			_, _ = conn.Write([]byte{0xD0, 0x00})
+		case 14: //DISCONNECT
+			return
+		}
+	}
+}
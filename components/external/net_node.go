@@ -17,21 +17,35 @@
 package external
 
 import (
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
-	"sync/atomic"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/frame"
 	"github.com/rulego/rulego/utils/maps"
 )
 
 // EndSign 结束符
 const EndSign = '\n'
 
-// PingData ping内容
+// PingData 默认分帧方式下的ping内容
 var PingData = []byte("ping\n")
 
+// pingPayload 心跳内容，发送前按照分帧方式编码
+var pingPayload = []byte("ping")
+
+// minReconnectInterval 重连退避的初始间隔
+const minReconnectInterval = time.Second
+
+// ErrNetReconnecting 连接断开后，在重连退避期间发送消息返回的错误
+var ErrNetReconnecting = errors.New("net connection is reconnecting")
+
 // 注册节点
 func init() {
 	Registry.Add(&NetNode{})
@@ -46,27 +60,44 @@ type NetNodeConfiguration struct {
 	// 连接超时，单位为秒，如果<=0 则默认60
 	ConnectTimeout int
 	// 心跳间隔，用于定期发送心跳消息，单位为秒，如果=0，则不发心跳包。默认60
+	// 开启ReadReply时不发送心跳包，防止心跳响应和请求响应错位
 	HeartbeatInterval int
+	// 写超时，单位为秒，如果<=0 则默认10。写超时后连接会被关闭并重建，消息发送到Failure链
+	WriteTimeout int
+	// 发送数据的分帧方式：delimiter（结束符）、length（长度前缀）、none（不分帧），默认delimiter
+	FrameType string
+	// 结束符，FrameType=delimiter时有效，支持转义字符如\r\n、\x03，以及0x开头的十六进制如0x0d0a。默认\n
+	Delimiter string
+	// 长度前缀字节数：1、2、4，大端序，FrameType=length时有效。默认4
+	LengthFieldSize int
+	// 是否读取服务端响应，开启后发送每条消息后读取一帧响应，并把响应作为消息负荷发送到Success链
+	// 同一个连接同一时刻只允许一个请求在途，保证请求和响应一一对应
+	ReadReply bool
+	// 响应的分帧方式，为空则和FrameType相同
+	ReplyFrameType string
+	// 响应的结束符，为空则和Delimiter相同
+	ReplyDelimiter string
+	// 响应的长度前缀字节数，<=0则和LengthFieldSize相同
+	ReplyLengthFieldSize int
+	// 读取响应超时，单位为秒，如果<=0 则默认10。超时后连接会被关闭并重建，防止迟到的响应和下一个请求错位
+	ReplyTimeout int
+	// 最大重连间隔，单位为秒，连接断开后从1秒开始按指数退避重连，如果<=0 则默认30
+	MaxReconnectInterval int
+	// TLS 配置，配置后使用TLS连接，仅支持tcp协议。证书支持文件路径或者PEM内容
+	TLS types.TLSConfig
 }
 
 // NetNode 把消息负荷通过网络协议发送，支持协议：tcp、udp、ip4:1、ip6:ipv6-icmp、ip6:58、unix、unixgram，以及net包支持的协议类型。
-// 发送前会在消息负荷最后增加结束符：'\n'
+// 连接是持久的，断开后按指数退避重连。默认发送前会在消息负荷最后增加结束符：'\n'，也可以配置为长度前缀分帧或者不分帧。
+// 开启ReadReply后，读取一帧响应替换消息负荷。写超时、读响应超时或者失败，连接会被关闭并重建，消息发送到Failure链
 type NetNode struct {
-	base.SharedNode[net.Conn]
+	base.SharedNode[*netClient]
 	// 节点配置
 	Config NetNodeConfiguration
 	// ruleGo配置
 	ruleConfig types.Config
-	// 客户端连接对象
-	conn net.Conn
-	// 创建一个心跳定时器，用于定期发送心跳消息，可以为0表示不发心跳
-	heartbeatTimer *time.Timer
-	//心跳间隔
-	heartbeatDuration time.Duration
-	// 连接是否已经断开，0：没端口；1：端口
-	disconnected int32
-	//断开连接次数
-	disconnectedCount int32
+	// 客户端
+	client *netClient
 }
 
 // Type 组件类型
@@ -76,9 +107,15 @@ func (x *NetNode) Type() string {
 
 func (x *NetNode) New() types.Node {
 	return &NetNode{Config: NetNodeConfiguration{
-		Protocol:          "tcp",
-		ConnectTimeout:    60,
-		HeartbeatInterval: 60,
+		Protocol:             "tcp",
+		ConnectTimeout:       60,
+		HeartbeatInterval:    60,
+		WriteTimeout:         10,
+		FrameType:            frame.TypeDelimiter,
+		Delimiter:            frame.DefaultDelimiter,
+		LengthFieldSize:      frame.DefaultLengthFieldSize,
+		ReplyTimeout:         10,
+		MaxReconnectInterval: 30,
 	}}
 }
 
@@ -90,149 +127,319 @@ func (x *NetNode) Init(ruleConfig types.Config, configuration types.Configuratio
 	}
 	// 设置默认值
 	x.setDefaultConfig()
-	x.heartbeatDuration = time.Duration(x.Config.HeartbeatInterval) * time.Second
+	client, err := newNetClient(x.Config, ruleConfig)
+	if err != nil {
+		return err
+	}
+	x.client = client
 	return x.SharedNode.Init(ruleConfig, x.Type(), x.Config.Server, ruleConfig.NodeClientInitNow, x.initConnect)
 }
 
 // OnMsg 处理消息
 func (x *NetNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
-	// 将消息的数据转换为字节数组
-	data := []byte(msg.GetData())
-	// 在数据的末尾加上结束符
-	data = append(data, EndSign)
-	x.onWrite(ctx, msg, data)
+	client, err := x.SharedNode.Get()
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	reply, err := client.request([]byte(msg.GetData()))
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	if client.config.ReadReply {
+		msg.SetData(string(reply))
+	}
+	//发送到下一个节点
+	ctx.TellSuccess(msg)
 }
 
 // Destroy 销毁
 func (x *NetNode) Destroy() {
-	x.onDisconnect()
+	x.SharedNode.StopBackgroundInit()
+	if x.client != nil {
+		x.client.close()
+	}
 }
 
-func (x *NetNode) Printf(format string, v ...interface{}) {
-	x.ruleConfig.Logger.Printf(format, v...)
+// initConnect 获取客户端，如果没有连接则建立连接
+func (x *NetNode) initConnect() (*netClient, error) {
+	return x.client, x.client.connect()
 }
 
-// initConnect 方法简化
-func (x *NetNode) initConnect() (net.Conn, error) {
-	x.Locker.Lock()
-	defer x.Locker.Unlock()
-
-	if x.conn != nil && !x.isDisconnected() {
-		return x.conn, nil
+// 默认值设置
+func (x *NetNode) setDefaultConfig() {
+	if x.Config.Protocol == "" {
+		x.Config.Protocol = "tcp"
+	}
+	if x.Config.ConnectTimeout <= 0 {
+		x.Config.ConnectTimeout = 60
 	}
+	if x.Config.HeartbeatInterval < 0 {
+		x.Config.HeartbeatInterval = 60
+	}
+	if x.Config.WriteTimeout <= 0 {
+		x.Config.WriteTimeout = 10
+	}
+	if x.Config.FrameType == "" {
+		x.Config.FrameType = frame.TypeDelimiter
+	}
+	if x.Config.Delimiter == "" {
+		x.Config.Delimiter = frame.DefaultDelimiter
+	}
+	if x.Config.LengthFieldSize <= 0 {
+		x.Config.LengthFieldSize = frame.DefaultLengthFieldSize
+	}
+	if x.Config.ReplyFrameType == "" {
+		x.Config.ReplyFrameType = x.Config.FrameType
+	}
+	if x.Config.ReplyDelimiter == "" {
+		x.Config.ReplyDelimiter = x.Config.Delimiter
+	}
+	if x.Config.ReplyLengthFieldSize <= 0 {
+		x.Config.ReplyLengthFieldSize = x.Config.LengthFieldSize
+	}
+	if x.Config.ReplyTimeout <= 0 {
+		x.Config.ReplyTimeout = 10
+	}
+	if x.Config.MaxReconnectInterval <= 0 {
+		x.Config.MaxReconnectInterval = 30
+	}
+}
 
-	conn, err := net.DialTimeout(x.Config.Protocol, x.Config.Server, time.Duration(x.Config.ConnectTimeout)*time.Second)
+// netClient 持久连接客户端，所有请求串行执行，同一时刻只有一个请求在途
+type netClient struct {
+	config     NetNodeConfiguration
+	ruleConfig types.Config
+	codec      *frame.Codec
+	replyCodec *frame.Codec
+	ping       []byte
+	// TLS配置，nil则不使用TLS
+	tlsConfig *tls.Config
+	// 保护以下字段，并串行化写入和读取响应
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *frame.Reader
+	// 当前重连退避间隔
+	retryInterval time.Duration
+	// 下次允许重连的时间
+	nextRetry time.Time
+	// 心跳和重连定时器
+	heartbeatTimer *time.Timer
+	// 连接是否不可用，用于发布资源不可用和恢复事件
+	unhealthy bool
+	closed    bool
+}
+
+// newNetClient 创建客户端，不会立刻建立连接
+func newNetClient(config NetNodeConfiguration, ruleConfig types.Config) (*netClient, error) {
+	codec, err := frame.NewCodec(frame.Config{
+		Type:            config.FrameType,
+		Delimiter:       config.Delimiter,
+		LengthFieldSize: config.LengthFieldSize,
+	})
 	if err != nil {
 		return nil, err
 	}
-
-	x.conn = conn
-	x.setDisconnected(false)
-	if x.heartbeatDuration != 0 {
-		// 初始化心跳定时器
-		if x.heartbeatTimer == nil {
-			x.heartbeatTimer = time.AfterFunc(x.heartbeatDuration, func() {
-				x.onPing()
-			})
-		} else {
-			x.heartbeatTimer.Reset(x.heartbeatDuration)
-		}
+	replyCodec, err := frame.NewCodec(frame.Config{
+		Type:            config.ReplyFrameType,
+		Delimiter:       config.ReplyDelimiter,
+		LengthFieldSize: config.ReplyLengthFieldSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ping, err := codec.Encode(pingPayload)
+	if err != nil {
+		return nil, err
 	}
-	return conn, nil
+	tlsConfig, err := config.TLS.NewTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil && !strings.HasPrefix(config.Protocol, "tcp") {
+		return nil, fmt.Errorf("tls is not supported for protocol:%s", config.Protocol)
+	}
+	return &netClient{
+		tlsConfig:  tlsConfig,
+		config:     config,
+		ruleConfig: ruleConfig,
+		codec:      codec,
+		replyCodec: replyCodec,
+		ping:       ping,
+	}, nil
+}
+
+// connect 如果没有连接则建立连接
+func (c *netClient) connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connectLocked()
 }
 
-// 重连
-func (x *NetNode) tryReconnect() {
-	conn, err := net.DialTimeout(x.Config.Protocol, x.Config.Server, time.Duration(x.Config.ConnectTimeout)*time.Second)
+// request 发送一帧数据，如果开启ReadReply则读取一帧响应
+func (c *netClient) request(data []byte) ([]byte, error) {
+	frameData, err := c.codec.Encode(data)
 	if err != nil {
-		// 5秒后重试
-		x.heartbeatTimer.Reset(5 * time.Second)
-	} else {
-		x.Locker.Lock()
-		x.conn = conn
-		x.setDisconnected(false)
-		x.Locker.Unlock()
-		x.Printf("Reconnected to: %s", conn.RemoteAddr().String())
-		// 重连成功后，重置为正常的心跳间隔
-		x.heartbeatTimer.Reset(x.heartbeatDuration)
+		return nil, err
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for retry := 0; ; retry++ {
+		if err = c.connectLocked(); err != nil {
+			return nil, err
+		}
+		_ = c.conn.SetWriteDeadline(time.Now().Add(time.Duration(c.config.WriteTimeout) * time.Second))
+		if _, err = c.conn.Write(frameData); err == nil {
+			break
+		}
+		//连接已经损坏，关闭后重建
+		c.closeConnLocked()
+		//连接断开导致的失败重试一次，超时不重试，防止服务端重复处理
+		if retry > 0 || isTimeout(err) {
+			return nil, err
+		}
+	}
+	c.resetHeartbeatLocked()
+	if !c.config.ReadReply {
+		return nil, nil
+	}
+	_ = c.conn.SetReadDeadline(time.Now().Add(time.Duration(c.config.ReplyTimeout) * time.Second))
+	reply, err := c.reader.ReadFrame()
+	if err != nil {
+		//迟到的响应会和下一个请求错位，关闭后重建连接
+		c.closeConnLocked()
+		return nil, err
+	}
+	return reply, nil
 }
 
-func (x *NetNode) onPing() {
-	// 如果连接已经断开，尝试重连
-	if x.isDisconnected() {
-		x.tryReconnect()
-		return
+// close 关闭客户端
+func (c *netClient) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.heartbeatTimer != nil {
+		c.heartbeatTimer.Stop()
 	}
-	// 发送心跳
-	if conn, err := x.SharedNode.Get(); err == nil {
-		if _, err := conn.Write(PingData); err != nil {
-			x.Printf("Ping failed: %v", err)
-			x.setDisconnected(true)
-			x.tryReconnect()
-		} else {
-			x.heartbeatTimer.Reset(x.heartbeatDuration)
-		}
+	c.closeConnLocked()
+}
+
+// dial 建立连接，配置了TLS则完成TLS握手
+func (c *netClient) dial() (net.Conn, error) {
+	timeout := time.Duration(c.config.ConnectTimeout) * time.Second
+	if c.tlsConfig != nil {
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, c.config.Protocol, c.config.Server, c.tlsConfig)
 	}
+	return net.DialTimeout(c.config.Protocol, c.config.Server, timeout)
 }
 
-func (x *NetNode) onWrite(ctx types.RuleContext, msg types.RuleMsg, data []byte) {
-	// 向服务器发送数据
-	if conn, err := x.SharedNode.Get(); err != nil {
-		ctx.TellFailure(msg, err)
-	} else if _, err := conn.Write(data); err != nil {
-		if atomic.LoadInt32(&x.disconnectedCount) == 0 {
-			x.setDisconnected(true)
-			//重试一次
-			x.onWrite(ctx, msg, data)
-		} else {
-			x.setDisconnected(true)
-			ctx.TellFailure(msg, err)
+// connectLocked 建立连接，连接失败后按照指数退避，退避期间直接返回错误。调用方需要持有锁
+func (c *netClient) connectLocked() error {
+	if c.closed {
+		return net.ErrClosed
+	}
+	if c.conn != nil {
+		return nil
+	}
+	if time.Now().Before(c.nextRetry) {
+		return fmt.Errorf("%w: %s", ErrNetReconnecting, c.config.Server)
+	}
+	conn, err := c.dial()
+	if err != nil {
+		c.retryInterval *= 2
+		if c.retryInterval < minReconnectInterval {
+			c.retryInterval = minReconnectInterval
 		}
-	} else {
-		//重置心跳发送间隔
-		if x.heartbeatTimer != nil {
-			x.heartbeatTimer.Reset(x.heartbeatDuration)
+		if maxInterval := time.Duration(c.config.MaxReconnectInterval) * time.Second; c.retryInterval > maxInterval {
+			c.retryInterval = maxInterval
+		}
+		c.nextRetry = time.Now().Add(c.retryInterval)
+		c.scheduleLocked(c.retryInterval)
+		if !c.unhealthy {
+			c.unhealthy = true
+			c.ruleConfig.PublishEvent(types.EventResourceUnhealthy, c.config.Server, map[string]interface{}{"type": "net", "error": err.Error()})
 		}
-		//发送到下一个节点
-		ctx.TellSuccess(msg)
+		return err
+	}
+	if c.retryInterval > 0 && c.ruleConfig.Logger != nil {
+		c.ruleConfig.Logger.Printf("Reconnected to: %s", conn.RemoteAddr().String())
 	}
+	if c.unhealthy {
+		c.unhealthy = false
+		c.ruleConfig.PublishEvent(types.EventResourceRecovered, c.config.Server, map[string]interface{}{"type": "net"})
+	}
+	c.conn = conn
+	c.reader = c.replyCodec.NewReader(conn)
+	c.retryInterval = 0
+	c.nextRetry = time.Time{}
+	c.resetHeartbeatLocked()
+	return nil
 }
 
-func (x *NetNode) onDisconnect() {
-	if x.conn != nil {
-		// 停止心跳定时器
-		if x.heartbeatTimer != nil {
-			x.heartbeatTimer.Stop()
-		}
-		_ = x.conn.Close()
-		x.setDisconnected(true)
+// closeConnLocked 关闭当前连接，下次请求或者定时器触发时重建。调用方需要持有锁
+func (c *netClient) closeConnLocked() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+		c.reader = nil
 	}
 }
 
-func (x *NetNode) isDisconnected() bool {
-	return atomic.LoadInt32(&x.disconnected) == 1
+// heartbeatEnabled 是否发送心跳
+func (c *netClient) heartbeatEnabled() bool {
+	return c.config.HeartbeatInterval > 0 && !c.config.ReadReply
+}
+
+// resetHeartbeatLocked 有数据发送后重置心跳间隔。调用方需要持有锁
+func (c *netClient) resetHeartbeatLocked() {
+	if c.heartbeatEnabled() {
+		c.scheduleLocked(time.Duration(c.config.HeartbeatInterval) * time.Second)
+	}
 }
 
-func (x *NetNode) setDisconnected(disconnected bool) {
-	if disconnected {
-		atomic.AddInt32(&x.disconnectedCount, 1)
-		atomic.StoreInt32(&x.disconnected, 1)
+// scheduleLocked 在d之后发送心跳或者重连。调用方需要持有锁
+func (c *netClient) scheduleLocked(d time.Duration) {
+	if c.closed || c.config.HeartbeatInterval <= 0 {
+		//不开启心跳时，在下一次请求时重连
+		return
+	}
+	if c.heartbeatTimer == nil {
+		c.heartbeatTimer = time.AfterFunc(d, c.onTimer)
 	} else {
-		atomic.StoreInt32(&x.disconnectedCount, 0)
-		atomic.StoreInt32(&x.disconnected, 0)
+		c.heartbeatTimer.Reset(d)
 	}
 }
 
-// 默认值设置
-func (x *NetNode) setDefaultConfig() {
-	if x.Config.Protocol == "" {
-		x.Config.Protocol = "tcp"
+// onTimer 连接断开则重连，否则发送心跳
+func (c *netClient) onTimer() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
 	}
-	if x.Config.ConnectTimeout <= 0 {
-		x.Config.ConnectTimeout = 60
+	if c.conn == nil {
+		//失败会按照退避间隔重新调度
+		_ = c.connectLocked()
+		return
 	}
-	if x.Config.HeartbeatInterval < 0 {
-		x.Config.HeartbeatInterval = 60
+	if !c.heartbeatEnabled() {
+		return
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(time.Duration(c.config.WriteTimeout) * time.Second))
+	if _, err := c.conn.Write(c.ping); err != nil {
+		if c.ruleConfig.Logger != nil {
+			c.ruleConfig.Logger.Printf("Ping failed: %v", err)
+		}
+		c.closeConnLocked()
+		_ = c.connectLocked()
+		return
 	}
+	c.resetHeartbeatLocked()
+}
+
+// isTimeout 是否是超时错误
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
@@ -20,7 +20,11 @@ import (
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/test"
 	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/frame"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -160,3 +164,159 @@ func createNetServer(config NetNodeConfiguration, stop chan struct{}) {
 		}
 	}
 }
+
+// startFrameServer 启动按照分帧读取的服务，handler返回nil则不响应
+func startFrameServer(t *testing.T, addr string, config frame.Config, handler func(data []byte) []byte) (net.Listener, *int32) {
+	listener, err := net.Listen("tcp", addr)
+	assert.Nil(t, err)
+	codec, err := frame.NewCodec(config)
+	assert.Nil(t, err)
+	var accepted int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := codec.NewReader(conn)
+				for {
+					data, err := reader.ReadFrame()
+					if err != nil {
+						return
+					}
+					if reply := handler(data); reply != nil {
+						out, _ := codec.Encode(reply)
+						_, _ = conn.Write(out)
+					}
+				}
+			}(conn)
+		}
+	}()
+	return listener, &accepted
+}
+
+func onNetMsg(node types.Node, data string) (types.RuleMsg, string, error) {
+	var result types.RuleMsg
+	var relation string
+	var resultErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		result, relation, resultErr = msg, relationType, err
+		wg.Done()
+	})
+	node.OnMsg(ctx, ctx.NewMsg("TEST", types.NewMetadata(), data))
+	wg.Wait()
+	return result, relation, resultErr
+}
+
+func TestNetNodeReadReply(t *testing.T) {
+	t.Run("Delimiter", func(t *testing.T) {
+		listener, _ := startFrameServer(t, "127.0.0.1:0", frame.Config{Delimiter: `\r\n`}, func(data []byte) []byte {
+			return []byte("ack:" + string(data))
+		})
+		defer listener.Close()
+		node, err := test.CreateAndInitNode("net", types.Configuration{
+			"server":    listener.Addr().String(),
+			"delimiter": `\r\n`,
+			"readReply": true,
+		}, Registry)
+		assert.Nil(t, err)
+		defer node.Destroy()
+		msg, relationType, err := onNetMsg(node, "a\nb")
+		assert.Nil(t, err)
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, "ack:a\nb", msg.GetData())
+	})
+
+	t.Run("LengthConcurrent", func(t *testing.T) {
+		listener, accepted := startFrameServer(t, "127.0.0.1:0", frame.Config{Type: frame.TypeLength, LengthFieldSize: 2}, func(data []byte) []byte {
+			return []byte(strings.ToUpper(string(data)))
+		})
+		defer listener.Close()
+		node, err := test.CreateAndInitNode("net", types.Configuration{
+			"server":          listener.Addr().String(),
+			"frameType":       frame.TypeLength,
+			"lengthFieldSize": 2,
+			"readReply":       true,
+		}, Registry)
+		assert.Nil(t, err)
+		defer node.Destroy()
+		var wg sync.WaitGroup
+		var mismatched int32
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				data := strings.Repeat(string(rune('a'+i)), i+1)
+				msg, relationType, _ := onNetMsg(node, data)
+				if relationType != types.Success || msg.GetData() != strings.ToUpper(data) {
+					atomic.AddInt32(&mismatched, 1)
+				}
+			}(i)
+		}
+		wg.Wait()
+		assert.Equal(t, int32(0), atomic.LoadInt32(&mismatched))
+		//复用同一个连接
+		assert.Equal(t, int32(1), atomic.LoadInt32(accepted))
+	})
+
+	t.Run("ReplyTimeout", func(t *testing.T) {
+		listener, accepted := startFrameServer(t, "127.0.0.1:0", frame.Config{}, func(data []byte) []byte {
+			if string(data) == "slow" {
+				return nil
+			}
+			return data
+		})
+		defer listener.Close()
+		node, err := test.CreateAndInitNode("net", types.Configuration{
+			"server":       listener.Addr().String(),
+			"readReply":    true,
+			"replyTimeout": 1,
+		}, Registry)
+		assert.Nil(t, err)
+		defer node.Destroy()
+		_, relationType, err := onNetMsg(node, "slow")
+		assert.Equal(t, types.Failure, relationType)
+		assert.True(t, isTimeout(err))
+		//超时后重建连接
+		msg, relationType, _ := onNetMsg(node, "fast")
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, "fast", msg.GetData())
+		assert.Equal(t, int32(2), atomic.LoadInt32(accepted))
+	})
+}
+
+func TestNetNodeReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	node, err := test.CreateAndInitNode("net", types.Configuration{
+		"server":            addr,
+		"heartbeatInterval": 0,
+		"readReply":         true,
+	}, Registry)
+	assert.Nil(t, err)
+	defer node.Destroy()
+	_, relationType, err := onNetMsg(node, "a")
+	assert.Equal(t, types.Failure, relationType)
+	assert.NotNil(t, err)
+	//退避期间直接失败
+	_, relationType, err = onNetMsg(node, "a")
+	assert.Equal(t, types.Failure, relationType)
+	assert.True(t, strings.Contains(err.Error(), ErrNetReconnecting.Error()))
+
+	listener2, _ := startFrameServer(t, addr, frame.Config{}, func(data []byte) []byte {
+		return data
+	})
+	defer listener2.Close()
+	time.Sleep(time.Millisecond * 1100)
+	msg, relationType, _ := onNetMsg(node, "b")
+	assert.Equal(t, types.Success, relationType)
+	assert.Equal(t, "b", msg.GetData())
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+// 规则链节点配置示例：
+//
+//	{
+//	       "id": "s3",
+//	       "type": "replyTo",
+//	       "name": "回复消息来源",
+//	       "configuration": {
+//	       }
+//	     }
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+// 注册节点
+func init() {
+	Registry.Add(&ReplyToNode{})
+}
+
+// ErrNoOrigin 消息没有来源，不是由支持回复的端点接收的消息
+var ErrNoOrigin = errors.New("message has no origin")
+
+// ReplyToNode 把当前消息回复到消息来源，用于非同步路由的规则链发送回复
+// 消息来源由端点写入元数据：originType、originId、originConnection(websocket连接)、originReplyTopic(MQTT回复主题)、originReplyUrl(HTTP回调地址)
+//   - endpoint/ws：写入原websocket连接
+//   - endpoint/mqtt：使用端点的MQTT连接发布到回复主题
+//   - endpoint/http：POST到回调地址
+//
+// 回复成功，把消息发送到`Success`链；消息来源已经不存在(端点已停止或者websocket连接已关闭)或者回复失败，把消息发送到`Failure`链
+type ReplyToNode struct {
+}
+
+// Type 组件类型
+func (x *ReplyToNode) Type() string {
+	return "replyTo"
+}
+
+func (x *ReplyToNode) New() types.Node {
+	return &ReplyToNode{}
+}
+
+// Init 初始化
+func (x *ReplyToNode) Init(_ types.Config, _ types.Configuration) error {
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *ReplyToNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	origin := endpoint.OriginFromMetadata(msg.Metadata)
+	if origin.Id == "" {
+		ctx.TellFailure(msg, ErrNoOrigin)
+		return
+	}
+	replier, ok := endpoint.GetReplier(origin.Id)
+	if !ok {
+		ctx.TellFailure(msg, fmt.Errorf("%w: %s endpoint is stopped", endpoint.ErrOriginGone, origin.Type))
+		return
+	}
+	if err := replier.Reply(msg); err != nil {
+		ctx.TellFailure(msg, err)
+	} else {
+		ctx.TellSuccess(msg)
+	}
+}
+
+// Destroy 销毁
+func (x *ReplyToNode) Destroy() {
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// testReplier 记录回复的消息
+type testReplier struct {
+	replies []string
+	err     error
+}
+
+func (r *testReplier) Reply(msg types.RuleMsg) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.replies = append(r.replies, msg.GetData())
+	return nil
+}
+
+func TestReplyToNode(t *testing.T) {
+	var targetNodeType = "replyTo"
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &ReplyToNode{}, types.Configuration{}, Registry)
+	})
+
+	t.Run("OnMsg", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{}, Registry)
+		assert.Nil(t, err)
+		replier := &testReplier{}
+		originId := endpoint.RegisterReplier(replier)
+		defer endpoint.UnregisterReplier(originId)
+
+		newMsg := func(origin endpoint.Origin) types.RuleMsg {
+			metadata := types.NewMetadata()
+			origin.PutToMetadata(metadata)
+			return types.NewMsg(0, "TEST", types.TEXT, metadata, "hello")
+		}
+		onMsg := func(msg types.RuleMsg) (string, error) {
+			var relationType string
+			var err error
+			ctx := test.NewRuleContextFull(types.NewConfig(), node, nil, func(msg types.RuleMsg, r string, e error) {
+				relationType, err = r, e
+			})
+			node.OnMsg(ctx, msg)
+			return relationType, err
+		}
+
+		relationType, err := onMsg(newMsg(endpoint.Origin{Type: "endpoint/ws", Id: originId, Connection: "c1"}))
+		assert.Equal(t, types.Success, relationType)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"hello"}, replier.replies)
+
+		replier.err = errors.New("write error")
+		relationType, err = onMsg(newMsg(endpoint.Origin{Type: "endpoint/ws", Id: originId, Connection: "c1"}))
+		assert.Equal(t, types.Failure, relationType)
+		assert.Equal(t, "write error", err.Error())
+
+		relationType, err = onMsg(newMsg(endpoint.Origin{}))
+		assert.Equal(t, types.Failure, relationType)
+		assert.True(t, errors.Is(err, ErrNoOrigin))
+
+		endpoint.UnregisterReplier(originId)
+		relationType, err = onMsg(newMsg(endpoint.Origin{Type: "endpoint/mqtt", Id: originId}))
+		assert.Equal(t, types.Failure, relationType)
+		assert.True(t, errors.Is(err, endpoint.ErrOriginGone))
+	})
+}
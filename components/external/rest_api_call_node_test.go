@@ -17,15 +17,23 @@
 package external
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/test"
 	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/test/cert"
 )
 
 const (
@@ -366,3 +374,341 @@ func TestRestApiCallNode(t *testing.T) {
 		})
 	})
 }
+
+func TestRestApiCallNodeRetry(t *testing.T) {
+	//前 failures 次请求响应503
+	var requests, failures int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(&requests, 1) <= atomic.LoadInt32(&failures) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("unavailable"))
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	newNode := func(configuration types.Configuration) types.Node {
+		configuration["restEndpointUrlPattern"] = server.URL
+		if _, ok := configuration["retryInterval"]; !ok {
+			configuration["retryInterval"] = 10
+		}
+		node, err := test.CreateAndInitNode("restApiCall", configuration, Registry)
+		assert.Nil(t, err)
+		t.Cleanup(node.Destroy)
+		return node
+	}
+	exec := func(node types.Node, c context.Context, failureCount int32) (types.RuleMsg, string) {
+		atomic.StoreInt32(&requests, 0)
+		atomic.StoreInt32(&failures, failureCount)
+		var result types.RuleMsg
+		var relation string
+		ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			result, relation = msg, relationType
+		})
+		ctx.SetContext(c)
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), `{"temperature":41}`))
+		return result, relation
+	}
+
+	node := newNode(types.Configuration{"requestMethod": "PUT", "maxRetries": 3})
+	msg, relation := exec(node, context.Background(), 2)
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, `{"temperature":41}`, msg.GetData())
+	assert.Equal(t, "3", msg.Metadata.GetValue(AttemptsMetadataKey))
+	assert.Equal(t, "200", msg.Metadata.GetValue(StatusCodeMetadataKey))
+
+	//重试次数用完，保留最后一次响应
+	msg, relation = exec(node, context.Background(), 10)
+	assert.Equal(t, types.Failure, relation)
+	assert.Equal(t, "4", msg.Metadata.GetValue(AttemptsMetadataKey))
+	assert.Equal(t, "503", msg.Metadata.GetValue(StatusCodeMetadataKey))
+	assert.Equal(t, "unavailable", msg.Metadata.GetValue(ErrorBodyMetadataKey))
+
+	//下次重试超过上下文的截止时间，不再重试
+	slowNode := newNode(types.Configuration{"requestMethod": "PUT", "maxRetries": 3, "retryInterval": 200})
+	c, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+	msg, relation = exec(slowNode, c, 10)
+	assert.Equal(t, types.Failure, relation)
+	assert.Equal(t, "2", msg.Metadata.GetValue(AttemptsMetadataKey))
+
+	//POST默认不重试
+	postNode := newNode(types.Configuration{"requestMethod": "POST", "maxRetries": 3})
+	msg, relation = exec(postNode, context.Background(), 1)
+	assert.Equal(t, types.Failure, relation)
+	assert.Equal(t, "1", msg.Metadata.GetValue(AttemptsMetadataKey))
+	postNode = newNode(types.Configuration{"requestMethod": "POST", "maxRetries": 3, "retryMethods": []string{"post"}})
+	msg, relation = exec(postNode, context.Background(), 1)
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, "2", msg.Metadata.GetValue(AttemptsMetadataKey))
+
+	//不需要重试的状态码
+	node = newNode(types.Configuration{"requestMethod": "GET", "maxRetries": 3, "retryOnStatusCodes": []int{502}, "withoutRequestBody": true})
+	msg, relation = exec(node, context.Background(), 1)
+	assert.Equal(t, types.Failure, relation)
+	assert.Equal(t, "1", msg.Metadata.GetValue(AttemptsMetadataKey))
+
+	//没有开启重试不记录请求次数
+	node = newNode(types.Configuration{"requestMethod": "PUT"})
+	msg, _ = exec(node, context.Background(), 0)
+	assert.Equal(t, "", msg.Metadata.GetValue(AttemptsMetadataKey))
+}
+
+func TestRestApiCallNodeStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "r01")
+		w.Header().Add("X-Multi", "a")
+		w.Header().Add("X-Multi", "b")
+		flusher := w.(http.Flusher)
+		switch r.URL.Path {
+		case "/sse":
+			w.Header().Set(ContentTypeKey, EventStreamMime)
+			for _, event := range []string{"event: start\nid: 1\ndata: a\n\n", ": ping\ndata: line1\r\ndata:line2\n\n", "data: tail"} {
+				_, _ = w.Write([]byte(event))
+				flusher.Flush()
+			}
+		case "/chunk":
+			for _, chunk := range []string{"hello", "world!"} {
+				_, _ = w.Write([]byte(chunk))
+				flusher.Flush()
+			}
+		case "/hang":
+			_, _ = w.Write([]byte("data: first\n\n"))
+			flusher.Flush()
+			<-r.Context().Done()
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	type result struct {
+		msg      types.RuleMsg
+		relation string
+		err      error
+	}
+	exec := func(configuration types.Configuration, path string, c context.Context, onMsg func()) []result {
+		configuration["restEndpointUrlPattern"] = server.URL + path
+		configuration["requestMethod"] = "GET"
+		configuration["withoutRequestBody"] = true
+		node, err := test.CreateAndInitNode("restApiCall", configuration, Registry)
+		assert.Nil(t, err)
+		defer node.Destroy()
+		var results []result
+		ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			results = append(results, result{msg, relationType, err})
+			if onMsg != nil {
+				onMsg()
+			}
+		})
+		ctx.SetContext(c)
+		metadata := types.NewMetadata()
+		//上游节点保存的响应头
+		metadata.PutValue("respHeader.X-Upstream", "u01")
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, metadata, "{}"))
+		return results
+	}
+
+	//保存指定的响应头
+	results := exec(types.Configuration{"responseHeaders": []string{"x-request-id", "X-Multi", "X-None"}}, "/plain", context.Background(), nil)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "ok", results[0].msg.GetData())
+	assert.Equal(t, "r01", results[0].msg.Metadata.GetValue("respHeader.X-Request-Id"))
+	assert.Equal(t, "a,b", results[0].msg.Metadata.GetValue("respHeader.X-Multi"))
+	assert.False(t, results[0].msg.Metadata.Has("respHeader.X-None"))
+	assert.False(t, results[0].msg.Metadata.Has("respHeader.Content-Length"))
+	assert.False(t, results[0].msg.Metadata.Has("respHeader.X-Upstream"))
+	//保存所有响应头
+	results = exec(types.Configuration{"responseHeaders": []string{"*"}}, "/plain", context.Background(), nil)
+	assert.Equal(t, "2", results[0].msg.Metadata.GetValue("respHeader.Content-Length"))
+	//默认不保存
+	results = exec(types.Configuration{}, "/plain", context.Background(), nil)
+	assert.False(t, results[0].msg.Metadata.Has("respHeader.X-Request-Id"))
+	assert.Equal(t, "u01", results[0].msg.Metadata.GetValue("respHeader.X-Upstream"))
+
+	//sse模式
+	results = exec(types.Configuration{"streamMode": "sse", "responseHeaders": []string{"X-Request-Id"}}, "/sse", context.Background(), nil)
+	assert.Equal(t, 4, len(results))
+	for _, item := range results {
+		assert.Equal(t, types.Success, item.relation)
+		assert.Equal(t, "r01", item.msg.Metadata.GetValue("respHeader.X-Request-Id"))
+		assert.Equal(t, "200", item.msg.Metadata.GetValue(StatusCodeMetadataKey))
+	}
+	assert.Equal(t, "a", results[0].msg.GetData())
+	assert.Equal(t, "start", results[0].msg.Metadata.GetValue(EventTypeMetadataKey))
+	assert.Equal(t, "1", results[0].msg.Metadata.GetValue(EventIdMetadataKey))
+	assert.Equal(t, "false", results[0].msg.Metadata.GetValue(StreamEndMetadataKey))
+	assert.Equal(t, "line1\nline2", results[1].msg.GetData())
+	assert.Equal(t, "message", results[1].msg.Metadata.GetValue(EventTypeMetadataKey))
+	assert.Equal(t, "1", results[1].msg.Metadata.GetValue(EventIdMetadataKey))
+	assert.Equal(t, "tail", results[2].msg.GetData())
+	assert.Equal(t, "", results[3].msg.GetData())
+	assert.Equal(t, "true", results[3].msg.Metadata.GetValue(StreamEndMetadataKey))
+
+	//chunk模式
+	results = exec(types.Configuration{"streamMode": "chunk", "streamChunkSize": 4}, "/chunk", context.Background(), nil)
+	var data string
+	for _, item := range results[:len(results)-1] {
+		assert.True(t, len(item.msg.GetData()) <= 4)
+		assert.Equal(t, types.BINARY, item.msg.DataType)
+		assert.Equal(t, "false", item.msg.Metadata.GetValue(StreamEndMetadataKey))
+		data += item.msg.GetData()
+	}
+	assert.Equal(t, "helloworld!", data)
+	assert.Equal(t, "true", results[len(results)-1].msg.Metadata.GetValue(StreamEndMetadataKey))
+
+	//上下文取消后中断读取
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results = exec(types.Configuration{"streamMode": "sse", "readTimeoutMs": 0}, "/hang", c, cancel)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, "first", results[0].msg.GetData())
+	assert.Equal(t, types.Failure, results[1].relation)
+	assert.NotNil(t, results[1].err)
+	assert.False(t, results[1].msg.Metadata.Has(StreamEndMetadataKey))
+
+	//超时后中断读取
+	start := time.Now()
+	results = exec(types.Configuration{"streamMode": "sse", "readTimeoutMs": 300}, "/hang", context.Background(), nil)
+	assert.True(t, time.Since(start) < time.Second*2)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, types.Failure, results[1].relation)
+
+	//不支持的模式
+	_, err := test.CreateAndInitNode("restApiCall", types.Configuration{"streamMode": "unknown"}, Registry)
+	assert.NotNil(t, err)
+}
+
+func TestRestApiCallNodeMutualTLS(t *testing.T) {
+	ca := cert.New(t, "rulego-ca", nil, x509.ExtKeyUsageAny)
+	serverCert := cert.New(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+	clientCert := cert.New(t, "device01", ca, x509.ExtKeyUsageClientAuth)
+	dir := t.TempDir()
+	writeFile := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(path, data, 0600))
+		return path
+	}
+	caFile := writeFile("ca.pem", ca.CertPem)
+	certFile := writeFile("client.pem", clientCert.CertPem)
+	keyFile := writeFile("client.key", clientCert.KeyPem)
+
+	//服务端要求客户端证书
+	pair, err := tls.X509KeyPair(serverCert.CertPem, serverCert.KeyPem)
+	assert.Nil(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Cert)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{pair}, ClientCAs: clientCAs, ClientAuth: tls.RequireAndVerifyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	exec := func(configuration types.Configuration) (*RestApiCallNode, types.RuleMsg, string) {
+		configuration["restEndpointUrlPattern"] = server.URL
+		configuration["requestMethod"] = "GET"
+		configuration["withoutRequestBody"] = true
+		node, err := test.CreateAndInitNode("restApiCall", configuration, Registry)
+		assert.Nil(t, err)
+		t.Cleanup(node.Destroy)
+		var result types.RuleMsg
+		var relation string
+		ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			result, relation = msg, relationType
+		})
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"))
+		return node.(*RestApiCallNode), result, relation
+	}
+
+	node, msg, relation := exec(types.Configuration{"caFile": caFile, "certFile": certFile, "certKeyFile": keyFile})
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, "device01", msg.GetData())
+	//多条消息复用同一个连接
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		assert.Equal(t, types.Success, relationType)
+	})
+	node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"))
+	assert.Equal(t, int64(1), node.Stats().NewConns)
+	assert.Equal(t, int64(1), node.Stats().ReusedConns)
+
+	//TLS配置优先于证书文件，支持PEM内容
+	_, msg, relation = exec(types.Configuration{"tls": map[string]interface{}{"ca": string(ca.CertPem), "cert": string(clientCert.CertPem), "key": string(clientCert.KeyPem)}, "certFile": "not-exist.pem"})
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, "device01", msg.GetData())
+
+	//没有客户端证书
+	_, _, relation = exec(types.Configuration{"caFile": caFile})
+	assert.Equal(t, types.Failure, relation)
+
+	//配置了证书文件后，兼容旧配置的 insecureSkipVerify 不再生效，需要通过 tls.insecureSkipVerify 显式禁用证书验证
+	_, _, relation = exec(types.Configuration{"certFile": certFile, "certKeyFile": keyFile, "insecureSkipVerify": true})
+	assert.Equal(t, types.Failure, relation)
+	_, msg, relation = exec(types.Configuration{"certFile": certFile, "certKeyFile": keyFile, "tls": map[string]interface{}{"insecureSkipVerify": true}})
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, "device01", msg.GetData())
+
+	//证书文件不存在
+	_, err = test.CreateAndInitNode("restApiCall", types.Configuration{"certFile": filepath.Join(dir, "none.pem"), "certKeyFile": keyFile}, Registry)
+	assert.NotNil(t, err)
+}
+
+func TestRestApiCallNodeProxyURL(t *testing.T) {
+	//转发代理，校验认证信息后直接响应请求的地址
+	var proxyRequests int32
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxyRequests, 1)
+		if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("user:p@ss")) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		_, _ = w.Write([]byte("proxied " + r.URL.String()))
+	}))
+	defer proxyServer.Close()
+	proxyHost := proxyServer.Listener.Addr().String()
+
+	exec := func(configuration types.Configuration) (types.RuleMsg, string) {
+		configuration["restEndpointUrlPattern"] = "http://rulego.example/api"
+		configuration["requestMethod"] = "GET"
+		configuration["withoutRequestBody"] = true
+		node, err := test.CreateAndInitNode("restApiCall", configuration, Registry)
+		assert.Nil(t, err)
+		defer node.Destroy()
+		var result types.RuleMsg
+		var relation string
+		ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			result, relation = msg, relationType
+		})
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"))
+		return result, relation
+	}
+
+	msg, relation := exec(types.Configuration{"proxyUrl": "http://user:p%40ss@" + proxyHost})
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, "proxied http://rulego.example/api", msg.GetData())
+	//认证失败
+	msg, relation = exec(types.Configuration{"proxyUrl": "http://user:wrong@" + proxyHost})
+	assert.Equal(t, types.Failure, relation)
+	assert.Equal(t, "407", msg.Metadata.GetValue(StatusCodeMetadataKey))
+	//优先于旧的代理配置
+	msg, relation = exec(types.Configuration{"proxyUrl": "http://user:p%40ss@" + proxyHost, "enableProxy": true,
+		"proxyScheme": "http", "proxyHost": "127.0.0.1", "proxyPort": 1})
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&proxyRequests))
+
+	//不同的代理地址不共享连接池
+	node1, err := test.CreateAndInitNode("restApiCall", types.Configuration{"proxyUrl": "socks5://127.0.0.1:1080"}, Registry)
+	assert.Nil(t, err)
+	defer node1.Destroy()
+	node2, err := test.CreateAndInitNode("restApiCall", types.Configuration{"proxyUrl": "https://127.0.0.1:8443"}, Registry)
+	assert.Nil(t, err)
+	defer node2.Destroy()
+	assert.True(t, node1.(*RestApiCallNode).transport != node2.(*RestApiCallNode).transport)
+
+	for _, proxyUrl := range []string{"ftp://127.0.0.1:21", "http://", "://bad"} {
+		_, err = test.CreateAndInitNode("restApiCall", types.Configuration{"proxyUrl": proxyUrl}, Registry)
+		assert.NotNil(t, err)
+	}
+}
@@ -42,7 +42,7 @@ type Email struct {
 	//From 发件人邮箱
 	From string `json:"from"`
 	//To 收件人邮箱，多个与`,`隔开
-	To string `json:"to"`
+	To string `json:"to" required:"true"`
 	//Cc 抄送人邮箱，多个与`,`隔开
 	Cc string `json:"cc"`
 	//Bcc 密送人邮箱，多个与`,`隔开
@@ -159,7 +159,7 @@ type SendEmailConfiguration struct {
 	//Username 用户名
 	Username string `json:"username"`
 	//Password 授权码
-	Password string `json:"password"`
+	Password string `json:"password" secret:"true"`
 	//EnableTls 是否是使用tls方式
 	EnableTls bool `json:"enableTls"`
 	//Email 邮件内容配置
@@ -0,0 +1,359 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+//{
+//"type": "sftp",
+//"config": {
+//"host": "192.168.1.1",
+//"port": 22,
+//"username": "root",
+//"privateKeyFile": "/root/.ssh/id_ed25519",
+//"knownHostsFile": "/root/.ssh/known_hosts",
+//"action": "download",
+//"remotePath": "/var/log/${metadata.deviceId}.log"
+//}
+//}
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/sftp"
+	"github.com/rulego/rulego/utils/str"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftp 组件的操作
+const (
+	// SftpActionUpload 上传文件
+	SftpActionUpload = "upload"
+	// SftpActionDownload 下载文件
+	SftpActionDownload = "download"
+	// SftpActionList 列出目录下的文件
+	SftpActionList = "list"
+	// SftpActionDelete 删除文件
+	SftpActionDelete = "delete"
+)
+
+const (
+	// KeySftpSize 元数据key：上传或者下载的文件大小，单位字节
+	KeySftpSize = "sftpSize"
+	// KeySftpModTime 元数据key：下载文件的修改时间，RFC3339格式
+	KeySftpModTime = "sftpModTime"
+)
+
+var (
+	SftpActionErr          = errors.New("action must be upload, download, list or delete")
+	SftpRemotePathEmptyErr = errors.New("remotePath can not empty")
+)
+
+func init() {
+	Registry.Add(&SftpNode{})
+}
+
+// SftpConfiguration 配置，连接参数同 SshConfiguration
+type SftpConfiguration struct {
+	//Host ssh 主机地址
+	Host string
+	//Port ssh 主机端口
+	Port int
+	//Username ssh登录用户名
+	Username string
+	//Password ssh登录密码
+	Password string `secret:"true"`
+	//PrivateKeyFile 私钥文件路径，配置后使用私钥认证
+	PrivateKeyFile string
+	//PrivateKeyPassphrase 私钥的密码，私钥加密时需要
+	PrivateKeyPassphrase string `secret:"true"`
+	//UseAgent 是否使用 SSH_AUTH_SOCK 环境变量指定的ssh-agent认证
+	UseAgent bool
+	//KnownHostsFile known_hosts 文件路径，使用该文件校验服务端公钥
+	KnownHostsFile string
+	//HostKeyFingerprint 固定的服务端公钥SHA256指纹
+	HostKeyFingerprint string
+	//InsecureSkipHostKeyCheck 是否跳过服务端公钥校验，存在中间人攻击风险，仅用于测试环境
+	InsecureSkipHostKeyCheck bool
+	//KeepAlive 心跳间隔（秒），0 不发送心跳
+	KeepAlive int
+	//Action 操作：upload、download、list、delete
+	Action string
+	//RemotePath 远程文件或者目录路径，可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
+	RemotePath string
+	//LocalFile 本地文件路径，可以使用变量替换
+	//上传时读取该文件，为空则上传消息负荷；下载时把文件内容写入该文件，为空则把文件内容放到消息负荷，大文件需要配置该路径
+	LocalFile string
+}
+
+// sshConfiguration 连接参数
+func (c SftpConfiguration) sshConfiguration() SshConfiguration {
+	return SshConfiguration{
+		Host:                     c.Host,
+		Port:                     c.Port,
+		Username:                 c.Username,
+		Password:                 c.Password,
+		PrivateKeyFile:           c.PrivateKeyFile,
+		PrivateKeyPassphrase:     c.PrivateKeyPassphrase,
+		UseAgent:                 c.UseAgent,
+		KnownHostsFile:           c.KnownHostsFile,
+		HostKeyFingerprint:       c.HostKeyFingerprint,
+		InsecureSkipHostKeyCheck: c.InsecureSkipHostKeyCheck,
+		KeepAlive:                c.KeepAlive,
+	}
+}
+
+// SftpNode sftp 文件传输组件
+// 通过sftp协议上传、下载、列出和删除远程文件
+// 下载的文件内容放到msg，DataType 为 BINARY，文件大小和修改时间放到元数据
+// 列出目录的结果以JSON数组放到msg，DataType 为 JSON
+type SftpNode struct {
+	base.SharedNode[*sftp.Client]
+	//节点配置
+	Config SftpConfiguration
+	// connector 管理 ssh 客户端的连接
+	connector          *sshConnector
+	remotePathTemplate str.Template
+	localFileTemplate  str.Template
+	//sftp 客户端和所在的 ssh 连接，连接重连后重新创建
+	client      *sftp.Client
+	clientConn  *ssh.Client
+	clientMutex sync.Mutex
+}
+
+// Type 组件类型
+func (x *SftpNode) Type() string {
+	return "sftp"
+}
+
+func (x *SftpNode) New() types.Node {
+	return &SftpNode{Config: SftpConfiguration{
+		Host:       "127.0.0.1",
+		Port:       22,
+		Username:   "root",
+		KeepAlive:  30,
+		Action:     SftpActionDownload,
+		RemotePath: "/tmp/${metadata.fileName}",
+	}}
+}
+
+// Init 初始化，连接在第一次处理消息时建立
+func (x *SftpNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err == nil {
+		switch x.Config.Action {
+		case SftpActionUpload, SftpActionDownload, SftpActionList, SftpActionDelete:
+		default:
+			return SftpActionErr
+		}
+		if x.Config.RemotePath == "" {
+			return SftpRemotePathEmptyErr
+		}
+		//相同 user@host:port 的 ssh 和 sftp 节点共用连接，sftp 会话在共享连接上创建
+		if x.connector, err = acquireSshConnector(x.Config.sshConfiguration()); err != nil {
+			return err
+		}
+		x.remotePathTemplate = str.NewTemplate(x.Config.RemotePath)
+		x.localFileTemplate = str.NewTemplate(x.Config.LocalFile)
+		//后台初始化任务的资源路径，例如：user@host:port
+		resourcePath := x.Config.Username + "@" + x.connector.address
+		initErr := x.SharedNode.Init(ruleConfig, x.Type(), resourcePath, ruleConfig.NodeClientInitNow, func() (*sftp.Client, error) {
+			return x.getClient()
+		})
+		//节点显式指定立即初始化，初始化失败则规则链加载失败
+		if initErr != nil && ruleConfig.NodeClientInitPolicy == types.InitPolicyEager {
+			return initErr
+		}
+	}
+	return err
+}
+
+// OnMsg 处理消息
+func (x *SftpNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	if x.connector == nil {
+		ctx.TellFailure(msg, SshClientNotInitErr)
+		return
+	}
+	evn := base.NodeUtils.GetEvnAndMetadata(ctx, msg)
+	remotePath := x.remotePathTemplate.Execute(evn)
+	localFile := x.localFileTemplate.Execute(evn)
+	client, err := x.SharedNode.Get()
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	err = x.do(client, remotePath, localFile, &msg)
+	if err != nil && client.Closed() {
+		//连接已经断开，重新连接后再执行一次
+		if client, err = x.SharedNode.Get(); err == nil {
+			err = x.do(client, remotePath, localFile, &msg)
+		}
+	}
+	if err != nil {
+		ctx.TellFailure(msg, err)
+	} else {
+		ctx.TellSuccess(msg)
+	}
+}
+
+// do 执行配置的操作
+func (x *SftpNode) do(client *sftp.Client, remotePath, localFile string, msg *types.RuleMsg) error {
+	switch x.Config.Action {
+	case SftpActionUpload:
+		return x.upload(client, remotePath, localFile, msg)
+	case SftpActionDownload:
+		return x.download(client, remotePath, localFile, msg)
+	case SftpActionList:
+		return x.list(client, remotePath, msg)
+	default:
+		return client.Remove(remotePath)
+	}
+}
+
+// upload 上传本地文件或者消息负荷
+func (x *SftpNode) upload(client *sftp.Client, remotePath, localFile string, msg *types.RuleMsg) error {
+	var src io.Reader
+	if localFile != "" {
+		file, err := os.Open(localFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		src = file
+	} else {
+		src = bytes.NewReader(msg.GetBytes())
+	}
+	dst, err := client.Create(remotePath)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	msg.Metadata.PutValue(KeySftpSize, strconv.FormatInt(size, 10))
+	return nil
+}
+
+// download 下载文件到本地文件或者消息负荷
+func (x *SftpNode) download(client *sftp.Client, remotePath, localFile string, msg *types.RuleMsg) error {
+	src, err := client.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if localFile != "" {
+		//直接写入本地文件，不占用内存
+		dst, err := os.Create(localFile)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, src)
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return err
+		}
+		msg.SetData(string(data))
+		msg.DataType = types.BINARY
+	}
+	msg.Metadata.PutValue(KeySftpSize, strconv.FormatInt(info.Size, 10))
+	msg.Metadata.PutValue(KeySftpModTime, info.ModTime.Format(time.RFC3339))
+	return nil
+}
+
+// list 列出目录下的文件，JSON数组格式
+func (x *SftpNode) list(client *sftp.Client, remotePath string, msg *types.RuleMsg) error {
+	files, err := client.ReadDir(remotePath)
+	if err != nil {
+		return err
+	}
+	if files == nil {
+		files = []sftp.FileInfo{}
+	}
+	data, err := json.Marshal(files)
+	if err != nil {
+		return err
+	}
+	msg.SetData(string(data))
+	msg.DataType = types.JSON
+	return nil
+}
+
+// getClient 获取 sftp 客户端，ssh 连接重连或者 sftp 会话失败后重新创建
+func (x *SftpNode) getClient() (*sftp.Client, error) {
+	x.clientMutex.Lock()
+	defer x.clientMutex.Unlock()
+	var err error
+	for i := 0; i < 2; i++ {
+		var conn *ssh.Client
+		if conn, err = x.connector.get(); err != nil {
+			return nil, err
+		}
+		if x.client != nil && x.clientConn == conn && !x.client.Closed() {
+			return x.client, nil
+		}
+		if x.client != nil {
+			_ = x.client.Close()
+			x.client = nil
+		}
+		var client *sftp.Client
+		if client, err = sftp.NewClient(conn); err == nil {
+			x.client, x.clientConn = client, conn
+			return client, nil
+		}
+		//连接可能已经断开，重新连接后再试一次
+		x.connector.reset(conn)
+	}
+	return nil, fmt.Errorf("open sftp subsystem: %w", err)
+}
+
+// Destroy 销毁
+func (x *SftpNode) Destroy() {
+	x.SharedNode.StopBackgroundInit()
+	x.clientMutex.Lock()
+	if x.client != nil {
+		_ = x.client.Close()
+		x.client = nil
+	}
+	x.clientMutex.Unlock()
+	if x.connector != nil {
+		x.connector.release()
+	}
+}
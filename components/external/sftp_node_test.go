@@ -0,0 +1,519 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveSftp 测试用的sftp服务，请求的路径相对于 root 目录
+func serveSftp(rw io.ReadWriter, root string) {
+	files := make(map[string]*os.File)
+	dirs := make(map[string][]os.DirEntry)
+	nextHandle := 0
+	write := func(payload []byte) {
+		_, _ = rw.Write(append(ssh.Marshal(struct{ Length uint32 }{uint32(len(payload))}), payload...))
+	}
+	status := func(id uint32, err error) {
+		code := uint32(0)
+		msg := "ok"
+		if errors.Is(err, io.EOF) {
+			code, msg = 1, "eof"
+		} else if errors.Is(err, os.ErrNotExist) {
+			code, msg = 2, "no such file"
+		} else if err != nil {
+			code, msg = 4, err.Error()
+		}
+		write(ssh.Marshal(struct {
+			Type      byte
+			ID, Code  uint32
+			Msg, Lang string
+		}{101, id, code, msg, ""}))
+	}
+	attrs := func(info os.FileInfo) []byte {
+		perm := uint32(info.Mode().Perm()) | 0100000
+		if info.IsDir() {
+			perm = uint32(info.Mode().Perm()) | 0040000
+		}
+		return ssh.Marshal(struct {
+			Flags        uint32
+			Size         uint64
+			Perm         uint32
+			Atime, Mtime uint32
+		}{0x01 | 0x04 | 0x08, uint64(info.Size()), perm, uint32(info.ModTime().Unix()), uint32(info.ModTime().Unix())})
+	}
+	newHandle := func(id uint32) string {
+		nextHandle++
+		handle := strconv.Itoa(nextHandle)
+		write(ssh.Marshal(struct {
+			Type   byte
+			ID     uint32
+			Handle string
+		}{102, id, handle}))
+		return handle
+	}
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(rw, header[:]); err != nil {
+			return
+		}
+		packet := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(rw, packet); err != nil {
+			return
+		}
+		typ, data := packet[0], packet[1:]
+		var req struct {
+			ID   uint32
+			Path string
+			Rest []byte `ssh:"rest"`
+		}
+		if typ == 1 {
+			write(ssh.Marshal(struct {
+				Type    byte
+				Version uint32
+			}{2, 3}))
+			continue
+		}
+		if err := ssh.Unmarshal(data, &req); err != nil {
+			return
+		}
+		path := filepath.Join(root, req.Path)
+		switch typ {
+		case 3:
+			var open struct {
+				Flags uint32
+				Rest  []byte `ssh:"rest"`
+			}
+			_ = ssh.Unmarshal(req.Rest, &open)
+			flag := os.O_RDONLY
+			if open.Flags&0x02 != 0 {
+				flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			}
+			file, err := os.OpenFile(path, flag, 0644)
+			if err != nil {
+				status(req.ID, err)
+				continue
+			}
+			files[newHandle(req.ID)] = file
+		case 4:
+			if file, ok := files[req.Path]; ok {
+				_ = file.Close()
+				delete(files, req.Path)
+			}
+			delete(dirs, req.Path)
+			status(req.ID, nil)
+		case 5:
+			var read struct {
+				Offset uint64
+				Length uint32
+			}
+			_ = ssh.Unmarshal(req.Rest, &read)
+			buf := make([]byte, read.Length)
+			n, err := files[req.Path].ReadAt(buf, int64(read.Offset))
+			if n == 0 {
+				status(req.ID, err)
+				continue
+			}
+			write(ssh.Marshal(struct {
+				Type byte
+				ID   uint32
+				Data string
+			}{103, req.ID, string(buf[:n])}))
+		case 6:
+			var w struct {
+				Offset uint64
+				Data   string
+			}
+			_ = ssh.Unmarshal(req.Rest, &w)
+			_, err := files[req.Path].WriteAt([]byte(w.Data), int64(w.Offset))
+			status(req.ID, err)
+		case 11:
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				status(req.ID, err)
+				continue
+			}
+			dirs[newHandle(req.ID)] = entries
+		case 12:
+			entries := dirs[req.Path]
+			if len(entries) == 0 {
+				status(req.ID, io.EOF)
+				continue
+			}
+			payload := ssh.Marshal(struct {
+				Type      byte
+				ID, Count uint32
+			}{104, req.ID, uint32(len(entries))})
+			for _, entry := range entries {
+				info, _ := entry.Info()
+				payload = append(payload, ssh.Marshal(struct{ Name, Long string }{entry.Name(), entry.Name()})...)
+				payload = append(payload, attrs(info)...)
+			}
+			dirs[req.Path] = nil
+			write(payload)
+		case 13:
+			status(req.ID, os.Remove(path))
+		case 17:
+			info, err := os.Stat(path)
+			if err != nil {
+				status(req.ID, err)
+				continue
+			}
+			write(append(ssh.Marshal(struct {
+				Type byte
+				ID   uint32
+			}{105, req.ID}), attrs(info)...))
+		default:
+			status(req.ID, errors.New("unsupported"))
+		}
+	}
+}
+
+func TestSftpNode(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(priv)
+	assert.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	assert.Nil(t, err)
+	localDir := t.TempDir()
+	keyFile := filepath.Join(localDir, "id_ed25519")
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+
+	root := t.TempDir()
+	server := startSshServer(t, clientSigner.PublicKey(), "127.0.0.1:0")
+	server.setSftpRoot(root)
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "logs"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "upload"), 0755))
+	modTime := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "logs", "device1.log"), []byte("line1\nline2\n"), 0644))
+	assert.Nil(t, os.Chtimes(filepath.Join(root, "logs", "device1.log"), modTime, modTime))
+	//大于单个数据块的文件
+	large := strings.Repeat("0123456789", 10000)
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "logs", "large.log"), []byte(large), 0644))
+
+	newNode := func(configuration types.Configuration) *SftpNode {
+		configuration["host"] = "127.0.0.1"
+		configuration["port"] = server.port
+		configuration["username"] = "root"
+		configuration["privateKeyFile"] = keyFile
+		configuration["insecureSkipHostKeyCheck"] = true
+		node, err := test.CreateAndInitNode("sftp", configuration, Registry)
+		assert.Nil(t, err)
+		t.Cleanup(node.Destroy)
+		return node.(*SftpNode)
+	}
+	exec := func(node *SftpNode, fileName, data string) (types.RuleMsg, string, error) {
+		var result types.RuleMsg
+		var relation string
+		var resultErr error
+		metaData := types.NewMetadata()
+		metaData.PutValue("fileName", fileName)
+		ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			result, relation, resultErr = msg, relationType, err
+		})
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.TEXT, metaData, data))
+		return result, relation, resultErr
+	}
+
+	t.Run("Init", func(t *testing.T) {
+		node := &SftpNode{}
+		err := node.Init(types.NewConfig(), types.Configuration{"action": "move", "remotePath": "/tmp"})
+		assert.Equal(t, SftpActionErr, err)
+		node = &SftpNode{}
+		err = node.Init(types.NewConfig(), types.Configuration{"action": SftpActionList})
+		assert.Equal(t, SftpRemotePathEmptyErr, err)
+		node = &SftpNode{}
+		err = node.Init(types.NewConfig(), types.Configuration{"action": SftpActionList, "remotePath": "/tmp"})
+		assert.Equal(t, SshConfigEmptyErr, err)
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		node := newNode(types.Configuration{"action": SftpActionDownload, "remotePath": "/logs/${metadata.fileName}"})
+		msg, relation, err := exec(node, "device1.log", "")
+		assert.Nil(t, err)
+		assert.Equal(t, types.Success, relation)
+		assert.Equal(t, types.BINARY, msg.DataType)
+		assert.Equal(t, "line1\nline2\n", msg.GetData())
+		assert.Equal(t, "12", msg.Metadata.GetValue(KeySftpSize))
+		assert.Equal(t, modTime.Local().Format(time.RFC3339), msg.Metadata.GetValue(KeySftpModTime))
+
+		msg, relation, err = exec(node, "large.log", "")
+		assert.Nil(t, err)
+		assert.Equal(t, large, msg.GetData())
+
+		_, relation, err = exec(node, "not_found.log", "")
+		assert.Equal(t, types.Failure, relation)
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+
+		//连接断开后重新连接
+		server.dropConnections()
+		msg, relation, err = exec(node, "device1.log", "")
+		assert.Nil(t, err)
+		assert.Equal(t, "line1\nline2\n", msg.GetData())
+	})
+
+	t.Run("DownloadToLocalFile", func(t *testing.T) {
+		node := newNode(types.Configuration{
+			"action":     SftpActionDownload,
+			"remotePath": "/logs/${metadata.fileName}",
+			"localFile":  filepath.Join(localDir, "${metadata.fileName}"),
+		})
+		msg, relation, err := exec(node, "large.log", "keep")
+		assert.Nil(t, err)
+		assert.Equal(t, types.Success, relation)
+		assert.Equal(t, "keep", msg.GetData())
+		assert.Equal(t, strconv.Itoa(len(large)), msg.Metadata.GetValue(KeySftpSize))
+		content, err := os.ReadFile(filepath.Join(localDir, "large.log"))
+		assert.Nil(t, err)
+		assert.Equal(t, large, string(content))
+	})
+
+	t.Run("Upload", func(t *testing.T) {
+		node := newNode(types.Configuration{"action": SftpActionUpload, "remotePath": "/upload/${metadata.fileName}"})
+		msg, relation, err := exec(node, "config.json", `{"interval":10}`)
+		assert.Nil(t, err)
+		assert.Equal(t, types.Success, relation)
+		assert.Equal(t, "15", msg.Metadata.GetValue(KeySftpSize))
+		content, err := os.ReadFile(filepath.Join(root, "upload", "config.json"))
+		assert.Nil(t, err)
+		assert.Equal(t, `{"interval":10}`, string(content))
+
+		localFile := filepath.Join(localDir, "firmware.bin")
+		assert.Nil(t, os.WriteFile(localFile, []byte(large), 0644))
+		node = newNode(types.Configuration{
+			"action":     SftpActionUpload,
+			"remotePath": "/upload/${metadata.fileName}",
+			"localFile":  localFile,
+		})
+		_, relation, err = exec(node, "firmware.bin", "")
+		assert.Nil(t, err)
+		content, err = os.ReadFile(filepath.Join(root, "upload", "firmware.bin"))
+		assert.Nil(t, err)
+		assert.Equal(t, large, string(content))
+	})
+
+	t.Run("ListAndDelete", func(t *testing.T) {
+		node := newNode(types.Configuration{"action": SftpActionList, "remotePath": "/logs"})
+		msg, relation, err := exec(node, "", "")
+		assert.Nil(t, err)
+		assert.Equal(t, types.Success, relation)
+		assert.Equal(t, types.JSON, msg.DataType)
+		assert.True(t, strings.Contains(msg.GetData(), `"name":"device1.log","size":12`))
+		assert.True(t, strings.Contains(msg.GetData(), `"name":"large.log"`))
+
+		node = newNode(types.Configuration{"action": SftpActionDelete, "remotePath": "/logs/${metadata.fileName}"})
+		_, relation, err = exec(node, "device1.log", "")
+		assert.Nil(t, err)
+		assert.Equal(t, types.Success, relation)
+		_, err = os.Stat(filepath.Join(root, "logs", "device1.log"))
+		assert.True(t, os.IsNotExist(err))
+		_, relation, err = exec(node, "device1.log", "")
+		assert.Equal(t, types.Failure, relation)
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+}
+
+// ssh 和 sftp 节点共用相同 user@host:port 的连接
+func TestSshConnectorShared(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(priv)
+	assert.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	assert.Nil(t, err)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+
+	root := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "device1.log"), []byte("line1"), 0644))
+	server := startSshServer(t, clientSigner.PublicKey(), "127.0.0.1:0")
+	server.setSftpRoot(root)
+	key := "root@127.0.0.1:" + strconv.Itoa(server.port)
+
+	newConfiguration := func() types.Configuration {
+		return types.Configuration{
+			"host":                     "127.0.0.1",
+			"port":                     server.port,
+			"username":                 "root",
+			"password":                 "",
+			"privateKeyFile":           keyFile,
+			"insecureSkipHostKeyCheck": true,
+		}
+	}
+	onMsg := func(node types.Node) (types.RuleMsg, error) {
+		var result types.RuleMsg
+		var resultErr error
+		ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			result, resultErr = msg, err
+		})
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), "{}"))
+		return result, resultErr
+	}
+
+	sshConfiguration := newConfiguration()
+	sshConfiguration["cmd"] = "uptime"
+	sshNode, err := test.CreateAndInitNode("ssh", sshConfiguration, Registry)
+	assert.Nil(t, err)
+	sftpConfiguration := newConfiguration()
+	sftpConfiguration["action"] = SftpActionDownload
+	sftpConfiguration["remotePath"] = "/device1.log"
+	sftpNode, err := test.CreateAndInitNode("sftp", sftpConfiguration, Registry)
+	assert.Nil(t, err)
+	assert.True(t, sshNode.(*SshNode).connector == sftpNode.(*SftpNode).connector)
+	assert.Equal(t, key, sftpNode.(*SftpNode).connector.key)
+
+	msg, err := onMsg(sshNode)
+	assert.Nil(t, err)
+	assert.Equal(t, "uptime", msg.GetData())
+	msg, err = onMsg(sftpNode)
+	assert.Nil(t, err)
+	assert.Equal(t, "line1", msg.GetData())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.handshakes))
+
+	//连接参数不一致的节点不共用连接
+	otherConfiguration := newConfiguration()
+	otherConfiguration["password"] = "password"
+	otherConfiguration["cmd"] = "uptime"
+	otherNode, err := test.CreateAndInitNode("ssh", otherConfiguration, Registry)
+	assert.Nil(t, err)
+	assert.Equal(t, "", otherNode.(*SshNode).connector.key)
+	_, err = onMsg(otherNode)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.handshakes))
+	otherNode.Destroy()
+
+	//还有节点使用时不关闭连接
+	sshNode.Destroy()
+	msg, err = onMsg(sftpNode)
+	assert.Nil(t, err)
+	assert.Equal(t, "line1", msg.GetData())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.handshakes))
+
+	connector := sftpNode.(*SftpNode).connector
+	sftpNode.Destroy()
+	assert.Nil(t, connector.current())
+	sshConnectors.Lock()
+	_, ok := sshConnectors.m[key]
+	sshConnectors.Unlock()
+	assert.False(t, ok)
+}
+
+// lookupSftpServer 查找 OpenSSH sftp-server 程序
+func lookupSftpServer() string {
+	for _, path := range []string{"/usr/lib/openssh/sftp-server", "/usr/libexec/openssh/sftp-server", "/usr/libexec/sftp-server", "/usr/lib/ssh/sftp-server", "/usr/lib/sftp-server"} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	if path, err := exec.LookPath("sftp-server"); err == nil {
+		return path
+	}
+	return ""
+}
+
+// 使用 OpenSSH sftp-server 作为服务端测试
+func TestSftpNodeOpenSsh(t *testing.T) {
+	sftpServer := lookupSftpServer()
+	if sftpServer == "" {
+		t.Skip("OpenSSH sftp-server not found")
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(priv)
+	assert.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	assert.Nil(t, err)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+
+	server := startSshServer(t, clientSigner.PublicKey(), "127.0.0.1:0")
+	server.setSftpServer(sftpServer)
+	//sftp-server 使用本机文件系统，使用绝对路径
+	root := t.TempDir()
+	large := strings.Repeat("0123456789", 10000)
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "large.log"), []byte(large), 0644))
+
+	onMsg := func(configuration types.Configuration, fileName, data string) (types.RuleMsg, string, error) {
+		configuration["host"] = "127.0.0.1"
+		configuration["port"] = server.port
+		configuration["username"] = "root"
+		configuration["privateKeyFile"] = keyFile
+		configuration["insecureSkipHostKeyCheck"] = true
+		configuration["remotePath"] = root + "/${metadata.fileName}"
+		node, err := test.CreateAndInitNode("sftp", configuration, Registry)
+		assert.Nil(t, err)
+		defer node.Destroy()
+		var result types.RuleMsg
+		var relation string
+		var resultErr error
+		metaData := types.NewMetadata()
+		metaData.PutValue("fileName", fileName)
+		ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			result, relation, resultErr = msg, relationType, err
+		})
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.TEXT, metaData, data))
+		return result, relation, resultErr
+	}
+
+	msg, relation, err := onMsg(types.Configuration{"action": SftpActionDownload}, "large.log", "")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, large, msg.GetData())
+	assert.Equal(t, strconv.Itoa(len(large)), msg.Metadata.GetValue(KeySftpSize))
+
+	_, relation, err = onMsg(types.Configuration{"action": SftpActionDownload}, "not_found.log", "")
+	assert.Equal(t, types.Failure, relation)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	msg, relation, err = onMsg(types.Configuration{"action": SftpActionUpload}, "config.json", `{"interval":10}`)
+	assert.Nil(t, err)
+	assert.Equal(t, types.Success, relation)
+	content, err := os.ReadFile(filepath.Join(root, "config.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"interval":10}`, string(content))
+
+	msg, relation, err = onMsg(types.Configuration{"action": SftpActionList}, "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Success, relation)
+	assert.True(t, strings.Contains(msg.GetData(), `"name":"config.json","size":15`))
+	assert.True(t, strings.Contains(msg.GetData(), `"name":"large.log"`))
+
+	_, relation, err = onMsg(types.Configuration{"action": SftpActionDelete}, "config.json", "")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Success, relation)
+	_, err = os.Stat(filepath.Join(root, "config.json"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,335 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/components/base"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshDialTimeout 建立连接的超时时间
+const sshDialTimeout = 10 * time.Second
+
+// sshConnectors 共享的 ssh 连接，key 为 user@host:port
+// 相同服务、用户和连接参数的 ssh 和 sftp 节点共用一个连接，引用计数为0时关闭连接
+var sshConnectors = struct {
+	sync.Mutex
+	m map[string]*sshConnector
+}{m: make(map[string]*sshConnector)}
+
+// sshConnParams 除服务地址和用户外的认证和服务端公钥校验参数，参数一致的节点才共用连接，避免使用其他节点的认证
+// 心跳间隔使用第一个节点的配置
+type sshConnParams struct {
+	password                 string
+	privateKeyFile           string
+	privateKeyPassphrase     string
+	useAgent                 bool
+	knownHostsFile           string
+	hostKeyFingerprint       string
+	insecureSkipHostKeyCheck bool
+}
+
+// sshConnector 管理 ssh 连接，ssh 和 sftp 组件共用
+// 第一次获取客户端时建立连接，连接断开或者心跳失败后下次获取时重新连接，连接失败后按退避间隔重试
+type sshConnector struct {
+	//服务地址 host:port
+	address string
+	//共享连接的key user@host:port，为空表示连接参数和已共享的连接不一致，不共享
+	key    string
+	params sshConnParams
+	//引用计数，使用 sshConnectors 的锁保护
+	refs         int
+	clientConfig *ssh.ClientConfig
+	keepAlive    time.Duration
+	//ssh-agent 连接
+	agentConn net.Conn
+	//防止并发连接
+	locker      sync.Mutex
+	client      *ssh.Client
+	clientMutex sync.RWMutex
+	//连接失败次数、下次连接时间和失败原因，退避期间直接返回 SshNotConnectedErr
+	dialAttempts int
+	nextDial     time.Time
+	dialErr      error
+}
+
+// newSshConnector 使用配置中的连接参数创建认证方式和服务端公钥校验，不建立连接
+func newSshConnector(config SshConfiguration) (*sshConnector, error) {
+	hasAuth := config.Password != "" || config.PrivateKeyFile != "" || config.UseAgent
+	if config.Host == "" || config.Port == 0 || config.Username == "" || !hasAuth {
+		return nil, SshConfigEmptyErr
+	}
+	c := &sshConnector{
+		address:   fmt.Sprintf("%s:%d", config.Host, config.Port),
+		keepAlive: time.Duration(config.KeepAlive) * time.Second,
+	}
+	auth, err := c.authMethods(config)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := hostKeyCallback(config)
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+	c.clientConfig = &ssh.ClientConfig{
+		User:            config.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	}
+	return c, nil
+}
+
+// acquireSshConnector 获取 user@host:port 共享的连接，引用计数加1，不存在则创建，不建立连接
+// 连接参数和已共享的连接不一致时创建不共享的连接
+func acquireSshConnector(config SshConfiguration) (*sshConnector, error) {
+	params := sshConnParams{
+		password:                 config.Password,
+		privateKeyFile:           config.PrivateKeyFile,
+		privateKeyPassphrase:     config.PrivateKeyPassphrase,
+		useAgent:                 config.UseAgent,
+		knownHostsFile:           config.KnownHostsFile,
+		hostKeyFingerprint:       config.HostKeyFingerprint,
+		insecureSkipHostKeyCheck: config.InsecureSkipHostKeyCheck,
+	}
+	key := fmt.Sprintf("%s@%s:%d", config.Username, config.Host, config.Port)
+	sshConnectors.Lock()
+	defer sshConnectors.Unlock()
+	shared, ok := sshConnectors.m[key]
+	if ok && shared.params == params {
+		shared.refs++
+		return shared, nil
+	}
+	c, err := newSshConnector(config)
+	if err != nil {
+		return nil, err
+	}
+	c.params = params
+	c.refs = 1
+	if !ok {
+		c.key = key
+		sshConnectors.m[key] = c
+	}
+	return c, nil
+}
+
+// release 引用计数减1，没有节点使用时关闭连接
+func (c *sshConnector) release() {
+	sshConnectors.Lock()
+	c.refs--
+	if c.refs > 0 {
+		sshConnectors.Unlock()
+		return
+	}
+	if c.key != "" && sshConnectors.m[c.key] == c {
+		delete(sshConnectors.m, c.key)
+	}
+	sshConnectors.Unlock()
+	c.close()
+}
+
+// get 获取客户端，没有连接或者连接已经断开则重新连接，连接失败后按退避间隔重试
+func (c *sshConnector) get() (*ssh.Client, error) {
+	if client := c.current(); client != nil {
+		return client, nil
+	}
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if client := c.current(); client != nil {
+		return client, nil
+	}
+	//上次连接失败，退避期间直接返回
+	if time.Now().Before(c.nextDial) {
+		return nil, fmt.Errorf("%w: %s: %v", SshNotConnectedErr, c.address, c.dialErr)
+	}
+	client, err := ssh.Dial("tcp", c.address, c.clientConfig)
+	if err != nil {
+		c.dialAttempts++
+		c.nextDial = time.Now().Add(sshDialBackoff(c.dialAttempts))
+		c.dialErr = err
+		return nil, err
+	}
+	c.dialAttempts = 0
+	c.nextDial = time.Time{}
+	c.dialErr = nil
+	c.clientMutex.Lock()
+	c.client = client
+	c.clientMutex.Unlock()
+
+	closed := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(closed)
+		c.reset(client)
+	}()
+	if c.keepAlive > 0 {
+		go c.keepAliveLoop(client, closed)
+	}
+	return client, nil
+}
+
+// sshDialBackoff 第 attempts 次连接失败后的退避间隔，从1秒开始翻倍，最大30秒
+func sshDialBackoff(attempts int) time.Duration {
+	delay := base.DefaultInitRetryInterval
+	for i := 1; i < attempts && delay < base.DefaultInitMaxRetryInterval; i++ {
+		delay *= 2
+	}
+	if delay > base.DefaultInitMaxRetryInterval {
+		delay = base.DefaultInitMaxRetryInterval
+	}
+	return delay
+}
+
+func (c *sshConnector) current() *ssh.Client {
+	c.clientMutex.RLock()
+	defer c.clientMutex.RUnlock()
+	return c.client
+}
+
+// reset 关闭已经断开的客户端，下次获取客户端时重新连接
+func (c *sshConnector) reset(client *ssh.Client) {
+	c.clientMutex.Lock()
+	if c.client == client {
+		c.client = nil
+	}
+	c.clientMutex.Unlock()
+	_ = client.Close()
+}
+
+// close 关闭连接和 ssh-agent 连接
+func (c *sshConnector) close() {
+	c.clientMutex.Lock()
+	client := c.client
+	c.client = nil
+	c.clientMutex.Unlock()
+	if client != nil {
+		_ = client.Close()
+	}
+	if c.agentConn != nil {
+		_ = c.agentConn.Close()
+	}
+}
+
+// keepAliveLoop 定时发送心跳，心跳失败或者超时没有响应则关闭连接
+func (c *sshConnector) keepAliveLoop(client *ssh.Client, closed <-chan struct{}) {
+	ticker := time.NewTicker(c.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+		result := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			result <- err
+		}()
+		select {
+		case <-closed:
+			return
+		case err := <-result:
+			if err == nil {
+				continue
+			}
+		case <-time.After(c.keepAlive):
+		}
+		c.reset(client)
+		return
+	}
+}
+
+// authMethods 认证方式，依次尝试私钥、ssh-agent和密码
+// 私钥文件读取或者解析失败时返回错误，不回退到密码认证
+func (c *sshConnector) authMethods(config SshConfiguration) ([]ssh.AuthMethod, error) {
+	var auth []ssh.AuthMethod
+	if config.PrivateKeyFile != "" {
+		pemBytes, err := os.ReadFile(config.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ssh private key file: %w", err)
+		}
+		var signer ssh.Signer
+		if config.PrivateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(config.PrivateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(pemBytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse ssh private key file %s: %w", config.PrivateKeyFile, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if config.UseAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, SshAgentSockEmptyErr
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, fmt.Errorf("connect ssh agent: %w", err)
+		}
+		c.agentConn = conn
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if config.Password != "" {
+		auth = append(auth, ssh.Password(config.Password))
+	}
+	return auth, nil
+}
+
+// hostKeyCallback 服务端公钥校验，校验失败的错误包含服务端公钥的指纹，用于配置 HostKeyFingerprint
+func hostKeyCallback(config SshConfiguration) (ssh.HostKeyCallback, error) {
+	if config.KnownHostsFile == "" && config.HostKeyFingerprint == "" {
+		if config.InsecureSkipHostKeyCheck {
+			return ssh.InsecureIgnoreHostKey(), nil
+		}
+		return nil, SshHostKeyEmptyErr
+	}
+	var knownHostsCallback ssh.HostKeyCallback
+	if config.KnownHostsFile != "" {
+		var err error
+		if knownHostsCallback, err = knownhosts.New(config.KnownHostsFile); err != nil {
+			return nil, fmt.Errorf("read known hosts file: %w", err)
+		}
+	}
+	fingerprint := config.HostKeyFingerprint
+	if fingerprint != "" && !strings.HasPrefix(fingerprint, "SHA256:") {
+		fingerprint = "SHA256:" + fingerprint
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		presented := ssh.FingerprintSHA256(key)
+		if fingerprint != "" && presented != fingerprint {
+			return fmt.Errorf("ssh host key mismatch for %s: presented %s %s, expected %s", hostname, key.Type(), presented, fingerprint)
+		}
+		if knownHostsCallback != nil {
+			if err := knownHostsCallback(hostname, remote, key); err != nil {
+				return fmt.Errorf("ssh host key verification failed for %s: presented %s %s: %w", hostname, key.Type(), presented, err)
+			}
+		}
+		return nil
+	}, nil
+}
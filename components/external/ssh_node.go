@@ -23,13 +23,23 @@ package external
 //"port": 22,
 //"username": "root",
 //"password": "password",
+//"privateKeyFile": "/root/.ssh/id_ed25519",
+//"knownHostsFile": "/root/.ssh/known_hosts",
 //"cmd": "sh count.sh test.txt hello"
 //}
 //}
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/components/base"
 	"github.com/rulego/rulego/utils/maps"
@@ -37,10 +47,22 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
+const (
+	// KeySshStderr 元数据key：命令的标准错误输出
+	KeySshStderr = "sshStderr"
+	// KeySshExitCode 元数据key：命令的退出码，超时或者连接断开没有返回退出码时不设置
+	KeySshExitCode = "sshExitCode"
+)
+
 var (
-	SshConfigEmptyErr   = errors.New("ssh config can not empty")
-	SshClientNotInitErr = errors.New("ssh client not initialized")
-	SshCmdEmptyErr      = errors.New("cmd can not empty")
+	SshConfigEmptyErr    = errors.New("ssh config can not empty")
+	SshClientNotInitErr  = errors.New("ssh client not initialized")
+	SshCmdEmptyErr       = errors.New("cmd can not empty")
+	SshAgentSockEmptyErr = errors.New("SSH_AUTH_SOCK is not set")
+	SshNotConnectedErr   = errors.New("ssh not connected")
+	SshCmdTimeoutErr     = errors.New("ssh command timeout")
+	SshEnvNameErr        = errors.New("invalid env name")
+	SshHostKeyEmptyErr   = errors.New("knownHostsFile or hostKeyFingerprint is required, or set insecureSkipHostKeyCheck")
 )
 
 func init() {
@@ -55,10 +77,34 @@ type SshConfiguration struct {
 	Port int
 	//Username ssh登录用户名
 	Username string
-	//Password ssh登录密码
-	Password string
+	//Password ssh登录密码，同时配置了私钥或者ssh-agent时作为最后尝试的认证方式
+	Password string `secret:"true"`
+	//PrivateKeyFile 私钥文件路径，配置后使用私钥认证
+	PrivateKeyFile string
+	//PrivateKeyPassphrase 私钥的密码，私钥加密时需要
+	PrivateKeyPassphrase string `secret:"true"`
+	//UseAgent 是否使用 SSH_AUTH_SOCK 环境变量指定的ssh-agent认证
+	UseAgent bool
+	//KnownHostsFile known_hosts 文件路径，使用该文件校验服务端公钥
+	KnownHostsFile string
+	//HostKeyFingerprint 固定的服务端公钥SHA256指纹，例如：SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s
+	//同时配置了 KnownHostsFile 时，两者都需要校验通过
+	HostKeyFingerprint string
+	//InsecureSkipHostKeyCheck 是否跳过服务端公钥校验，存在中间人攻击风险，仅用于测试环境
+	InsecureSkipHostKeyCheck bool
+	//KeepAlive 心跳间隔（秒），心跳失败关闭连接，下次处理消息时重新连接，0 不发送心跳
+	KeepAlive int
 	//Cmd shell命令,可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
 	Cmd string
+	//Timeout 命令执行超时时间（秒），超时关闭会话并交给Failure链，0 不超时
+	Timeout int
+	//SuccessOnNonZeroExit 退出码不为0时是否仍然交给Success链，由后续节点根据元数据 sshExitCode 处理
+	SuccessOnNonZeroExit bool
+	//Envs 命令的环境变量，值可以使用 ${metadata.key} 或者 ${msg.key} 替换
+	//优先通过ssh协议设置，服务端不允许时（例如没有配置 AcceptEnv）使用转义后的 export 前缀设置
+	Envs map[string]string
+	//WorkDir 命令的工作目录，可以使用变量替换
+	WorkDir string
 }
 
 // SshNode shell 组件
@@ -66,11 +112,15 @@ type SshConfiguration struct {
 // 脚本执行结果返回到msg,交给下一个节点
 // DataType 会强制转成TEXT
 type SshNode struct {
+	base.SharedNode[*ssh.Client]
 	//节点配置
 	Config SshConfiguration
-	// client 是一个 ssh.Client 类型的字段，用来保存 ssh 客户端对象
-	client      *ssh.Client
+	// connector 管理 ssh 客户端的连接
+	connector   *sshConnector
 	cmdTemplate str.Template
+	//环境变量值和工作目录模板
+	envTemplates    map[string]str.Template
+	workDirTemplate str.Template
 }
 
 // Type 方法用来返回组件的类型
@@ -81,10 +131,11 @@ func (x *SshNode) Type() string {
 // New 方法用来创建一个 SshNode 的新实例
 func (x *SshNode) New() types.Node {
 	return &SshNode{Config: SshConfiguration{
-		Host:     "127.0.0.1",
-		Port:     22,
-		Username: "root",
-		Password: "password",
+		Host:      "127.0.0.1",
+		Port:      22,
+		Username:  "root",
+		Password:  "password",
+		KeepAlive: 30,
 	}}
 }
 
@@ -92,22 +143,26 @@ func (x *SshNode) New() types.Node {
 func (x *SshNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
 	err := maps.Map2Struct(configuration, &x.Config)
 	if err == nil {
-		// 从配置中获取 ssh 连接的参数
-		sshConfig := x.Config
-		// 如果参数不为空，则创建一个 ssh 客户端对象
-		if sshConfig.Host != "" && sshConfig.Port != 0 && sshConfig.Username != "" && sshConfig.Password != "" {
-			config := &ssh.ClientConfig{
-				User: sshConfig.Username,
-				Auth: []ssh.AuthMethod{
-					ssh.Password(sshConfig.Password),
-				},
-				HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		x.cmdTemplate = str.NewTemplate(x.Config.Cmd)
+		x.envTemplates = make(map[string]str.Template, len(x.Config.Envs))
+		for name, value := range x.Config.Envs {
+			if !envNameRegexp.MatchString(name) {
+				return fmt.Errorf("%w: %s", SshEnvNameErr, name)
 			}
-			x.client, err = ssh.Dial("tcp", fmt.Sprintf("%s:%d", sshConfig.Host, sshConfig.Port), config)
-		} else {
-			return SshConfigEmptyErr
+			x.envTemplates[name] = str.NewTemplate(value)
+		}
+		x.workDirTemplate = str.NewTemplate(x.Config.WorkDir)
+		// 从配置中获取 ssh 连接的参数，连接在第一次处理消息时建立，相同 user@host:port 的节点共用连接
+		if x.connector, err = acquireSshConnector(x.Config); err != nil {
+			return err
+		}
+		initErr := x.SharedNode.Init(ruleConfig, x.Type(), x.connector.address, ruleConfig.NodeClientInitNow, func() (*ssh.Client, error) {
+			return x.connector.get()
+		})
+		//节点显式指定立即初始化，初始化失败则规则链加载失败
+		if initErr != nil && ruleConfig.NodeClientInitPolicy == types.InitPolicyEager {
+			return initErr
 		}
-		x.cmdTemplate = str.NewTemplate(x.Config.Cmd)
 	}
 	return err
 
@@ -116,7 +171,7 @@ func (x *SshNode) Init(ruleConfig types.Config, configuration types.Configuratio
 // OnMsg 方法用来处理消息，每条流入组件的数据会经过该函数处理
 func (x *SshNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 	var err error
-	if x.client == nil {
+	if x.connector == nil {
 		ctx.TellFailure(msg, SshClientNotInitErr)
 		return
 	}
@@ -126,18 +181,31 @@ func (x *SshNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 		ctx.TellFailure(msg, SshCmdEmptyErr)
 		return
 	}
-	cmd = x.cmdTemplate.ExecuteFn(func() map[string]any {
-		return base.NodeUtils.GetEvnAndMetadata(ctx, msg)
-	})
-	var output []byte
+	evn := base.NodeUtils.GetEvnAndMetadata(ctx, msg)
+	cmd = x.cmdTemplate.Execute(evn)
 	var session *ssh.Session
 	// 如果有 ssh 客户端对象，则创建一个 ssh 会话，并执行远程 shell 命令，并获取其输出或错误信息
-	if session, err = x.client.NewSession(); err == nil {
+	if session, err = x.newSession(); err == nil {
 		defer session.Close()
-		output, err = session.CombinedOutput(cmd)
+		cmd = x.prepare(session, cmd, evn)
+		var stdout, stderr lockedBuffer
+		session.Stdout = &stdout
+		session.Stderr = &stderr
+		err = x.run(session, cmd)
 
-		msg.SetData(string(output))
+		// 标准输出作为消息负荷，标准错误输出和退出码放到元数据
+		msg.SetData(stdout.String())
 		msg.DataType = types.TEXT
+		msg.Metadata.PutValue(KeySshStderr, stderr.String())
+		var exitErr *ssh.ExitError
+		if err == nil {
+			msg.Metadata.PutValue(KeySshExitCode, "0")
+		} else if errors.As(err, &exitErr) {
+			msg.Metadata.PutValue(KeySshExitCode, strconv.Itoa(exitErr.ExitStatus()))
+			if x.Config.SuccessOnNonZeroExit {
+				err = nil
+			}
+		}
 
 		if err != nil {
 			ctx.TellFailure(msg, err)
@@ -151,9 +219,120 @@ func (x *SshNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 
 }
 
+// envNameRegexp 合法的环境变量名
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// prepare 设置环境变量和工作目录，返回实际执行的命令
+// 服务端不允许设置的环境变量和工作目录使用转义后的 cd 和 export 前缀，防止元数据中的值注入命令
+func (x *SshNode) prepare(session *ssh.Session, cmd string, evn map[string]any) string {
+	envs := make(map[string]string, len(x.envTemplates))
+	setenvFailed := false
+	for name, tmpl := range x.envTemplates {
+		envs[name] = tmpl.Execute(evn)
+		if !setenvFailed && session.Setenv(name, envs[name]) != nil {
+			setenvFailed = true
+		}
+	}
+	if !setenvFailed {
+		envs = nil
+	}
+	return remoteCmd(cmd, x.workDirTemplate.Execute(evn), envs)
+}
+
+// remoteCmd 在命令前面加上 cd 和 export 前缀，例如：cd '/opt/app' && export ENV='prod' && sh start.sh
+func remoteCmd(cmd, workDir string, envs map[string]string) string {
+	var prefix strings.Builder
+	if workDir != "" {
+		prefix.WriteString("cd ")
+		prefix.WriteString(shellQuote(workDir))
+		prefix.WriteString(" && ")
+	}
+	if len(envs) > 0 {
+		names := make([]string, 0, len(envs))
+		for name := range envs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		prefix.WriteString("export")
+		for _, name := range names {
+			prefix.WriteString(" ")
+			prefix.WriteString(name)
+			prefix.WriteString("=")
+			prefix.WriteString(shellQuote(envs[name]))
+		}
+		prefix.WriteString(" && ")
+	}
+	return prefix.String() + cmd
+}
+
+// shellQuote 使用单引号包裹并转义值中的单引号，结果可以安全地拼接到shell命令中
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// run 执行命令并等待结束，超时发送 SIGKILL 信号并关闭会话
+func (x *SshNode) run(session *ssh.Session, cmd string) error {
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	if x.Config.Timeout <= 0 {
+		return session.Wait()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+	timer := time.NewTimer(time.Duration(x.Config.Timeout) * time.Second)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		_ = session.Signal(ssh.SIGKILL)
+		_ = session.Close()
+		return fmt.Errorf("%w after %ds: %s", SshCmdTimeoutErr, x.Config.Timeout, cmd)
+	}
+}
+
+// lockedBuffer 并发安全的输出缓冲区，命令超时后可能仍在写入
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newSession 创建会话，连接已经断开则重新连接后再创建一次
+func (x *SshNode) newSession() (*ssh.Session, error) {
+	client, err := x.SharedNode.Get()
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+	x.connector.reset(client)
+	if client, err = x.SharedNode.Get(); err != nil {
+		return nil, err
+	}
+	return client.NewSession()
+}
+
 // Destroy 方法用来销毁组件，做一些资源释放操作
 func (x *SshNode) Destroy() {
-	if x.client != nil {
-		_ = x.client.Close()
+	x.SharedNode.StopBackgroundInit()
+	if x.connector != nil {
+		x.connector.release()
 	}
 }
@@ -17,14 +17,29 @@
 package external
 
 import (
-	"github.com/rulego/rulego/api/types"
-	"github.com/rulego/rulego/test"
-	"github.com/rulego/rulego/test/assert"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 func TestSshNode(t *testing.T) {
@@ -56,15 +71,17 @@ func TestSshNode(t *testing.T) {
 			return
 		}
 		test.NodeInit(t, targetNodeType, types.Configuration{
-			"host":     serverIp,
-			"port":     port,
-			"username": serverUsername,
-			"password": serverPassword,
+			"host":                     serverIp,
+			"port":                     port,
+			"username":                 serverUsername,
+			"password":                 serverPassword,
+			"insecureSkipHostKeyCheck": true,
 		}, types.Configuration{
-			"host":     serverIp,
-			"port":     22,
-			"username": serverUsername,
-			"password": serverPassword,
+			"host":                     serverIp,
+			"port":                     22,
+			"username":                 serverUsername,
+			"password":                 serverPassword,
+			"insecureSkipHostKeyCheck": true,
 		}, Registry)
 	})
 
@@ -73,15 +90,17 @@ func TestSshNode(t *testing.T) {
 			return
 		}
 		test.NodeInit(t, targetNodeType, types.Configuration{
-			"host":     serverIp,
-			"port":     22,
-			"username": serverUsername,
-			"password": serverPassword,
+			"host":                     serverIp,
+			"port":                     22,
+			"username":                 serverUsername,
+			"password":                 serverPassword,
+			"insecureSkipHostKeyCheck": true,
 		}, types.Configuration{
-			"host":     serverIp,
-			"port":     22,
-			"username": serverUsername,
-			"password": serverPassword,
+			"host":                     serverIp,
+			"port":                     22,
+			"username":                 serverUsername,
+			"password":                 serverPassword,
+			"insecureSkipHostKeyCheck": true,
 		}, Registry)
 	})
 
@@ -90,11 +109,12 @@ func TestSshNode(t *testing.T) {
 			return
 		}
 		node1, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
-			"host":     serverIp,
-			"port":     port,
-			"username": serverUsername,
-			"password": serverPassword,
-			"cmd":      "echo \"hello world\"",
+			"host":                     serverIp,
+			"port":                     port,
+			"username":                 serverUsername,
+			"password":                 serverPassword,
+			"insecureSkipHostKeyCheck": true,
+			"cmd":                      "echo \"hello world\"",
 		}, Registry)
 		assert.Nil(t, err)
 
@@ -107,11 +127,12 @@ func TestSshNode(t *testing.T) {
 		assert.NotNil(t, err)
 
 		node3, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
-			"host":     serverIp,
-			"port":     port,
-			"username": serverUsername,
-			"password": serverPassword,
-			"cmd":      "",
+			"host":                     serverIp,
+			"port":                     port,
+			"username":                 serverUsername,
+			"password":                 serverPassword,
+			"insecureSkipHostKeyCheck": true,
+			"cmd":                      "",
 		}, Registry)
 		assert.Nil(t, err)
 
@@ -164,3 +185,558 @@ func TestSshNode(t *testing.T) {
 		}
 	})
 }
+
+// sshServerStub 只允许 authorizedKey 公钥认证的测试ssh服务，exec 请求输出命令本身
+type sshServerStub struct {
+	port    int
+	hostKey ssh.PublicKey
+	//握手成功的连接数
+	handshakes int32
+	mu         sync.Mutex
+	conns      []net.Conn
+	//sftp 子系统的根目录，为空不支持sftp
+	sftpRoot string
+	//sftp 子系统使用的 OpenSSH sftp-server 程序路径，为空使用 serveSftp
+	sftpServer string
+	//是否允许客户端设置环境变量
+	acceptEnv bool
+}
+
+func (s *sshServerStub) setAcceptEnv(acceptEnv bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acceptEnv = acceptEnv
+}
+
+func (s *sshServerStub) setSftpRoot(root string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sftpRoot = root
+}
+
+func (s *sshServerStub) setSftpServer(sftpServer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sftpServer = sftpServer
+}
+
+// dropConnections 断开所有连接
+func (s *sshServerStub) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+// startSshServer 在 address 启动测试ssh服务
+func startSshServer(t *testing.T, authorizedKey ssh.PublicKey, address string) *sshServerStub {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	assert.Nil(t, err)
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+	ln, err := net.Listen("tcp", address)
+	assert.Nil(t, err)
+	server := &sshServerStub{port: ln.Addr().(*net.TCPAddr).Port, hostKey: hostSigner.PublicKey()}
+	t.Cleanup(func() {
+		_ = ln.Close()
+		server.dropConnections()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.conns = append(server.conns, conn)
+			server.mu.Unlock()
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+func (s *sshServerStub) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	atomic.AddInt32(&s.handshakes, 1)
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			var envs []string
+			for req := range requests {
+				if req.Type == "env" {
+					var env struct{ Name, Value string }
+					_ = ssh.Unmarshal(req.Payload, &env)
+					s.mu.Lock()
+					acceptEnv := s.acceptEnv
+					s.mu.Unlock()
+					if acceptEnv {
+						envs = append(envs, env.Name+"="+env.Value)
+					}
+					_ = req.Reply(acceptEnv, nil)
+					continue
+				}
+				if req.Type == "subsystem" {
+					var payload struct{ Name string }
+					_ = ssh.Unmarshal(req.Payload, &payload)
+					s.mu.Lock()
+					root, sftpServer := s.sftpRoot, s.sftpServer
+					s.mu.Unlock()
+					if payload.Name != "sftp" || (root == "" && sftpServer == "") {
+						_ = req.Reply(false, nil)
+						continue
+					}
+					_ = req.Reply(true, nil)
+					if sftpServer != "" {
+						cmd := exec.Command(sftpServer)
+						cmd.Stdin = channel
+						cmd.Stdout = channel
+						_ = cmd.Run()
+					} else {
+						serveSftp(channel, root)
+					}
+					return
+				}
+				if req.Type != "exec" {
+					_ = req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				_ = ssh.Unmarshal(req.Payload, &payload)
+				_ = req.Reply(true, nil)
+				var status uint32
+				switch {
+				case strings.HasPrefix(payload.Command, "sleep"):
+					//不返回，直到客户端关闭会话
+					continue
+				case strings.HasPrefix(payload.Command, "fail"):
+					_, _ = channel.Write([]byte("partial"))
+					_, _ = channel.Stderr().Write([]byte("error"))
+					status = 2
+				default:
+					//输出命令和设置的环境变量
+					sort.Strings(envs)
+					_, _ = channel.Write([]byte(strings.Join(append([]string{payload.Command}, envs...), "\n")))
+				}
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+func TestSshNodeKeyAuth(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(priv)
+	assert.Nil(t, err)
+	port := startSshServer(t, clientSigner.PublicKey(), "127.0.0.1:0").port
+
+	dir := t.TempDir()
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("secret"))
+	assert.Nil(t, err)
+	keyFile := filepath.Join(dir, "id_ed25519")
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+
+	execCmd := func(node types.Node) {
+		done := make(chan struct{})
+		metaData := types.NewMetadata()
+		metaData.PutValue("name", "rulego")
+		test.NodeOnMsgWithChildren(t, node, []test.Msg{{MetaData: metaData, Data: "{}"}}, nil, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Success, relationType)
+			assert.Equal(t, "echo rulego", msg.GetData())
+			close(done)
+		})
+		select {
+		case <-done:
+		case <-time.After(time.Second * 5):
+			t.Fatal("ssh exec timeout")
+		}
+	}
+
+	t.Run("PrivateKey", func(t *testing.T) {
+		node, err := test.CreateAndInitNode("ssh", types.Configuration{
+			"port":                     port,
+			"privateKeyFile":           keyFile,
+			"privateKeyPassphrase":     "secret",
+			"cmd":                      "echo ${name}",
+			"insecureSkipHostKeyCheck": true,
+		}, Registry)
+		assert.Nil(t, err)
+		defer node.Destroy()
+		execCmd(node)
+	})
+
+	t.Run("WrongPassphrase", func(t *testing.T) {
+		node := &SshNode{}
+		err := node.Init(types.NewConfig(), types.Configuration{
+			"host":                 "127.0.0.1",
+			"port":                 port,
+			"username":             "root",
+			"privateKeyFile":       keyFile,
+			"privateKeyPassphrase": "wrong",
+		})
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "parse ssh private key file"))
+		//缺少密码
+		node = &SshNode{}
+		err = node.Init(types.NewConfig(), types.Configuration{
+			"host":           "127.0.0.1",
+			"port":           port,
+			"username":       "root",
+			"privateKeyFile": keyFile,
+		})
+		var missingErr *ssh.PassphraseMissingError
+		assert.True(t, errors.As(err, &missingErr))
+	})
+
+	t.Run("MissingKeyFile", func(t *testing.T) {
+		node := &SshNode{}
+		err := node.Init(types.NewConfig(), types.Configuration{
+			"host":           "127.0.0.1",
+			"port":           port,
+			"username":       "root",
+			"password":       "password",
+			"privateKeyFile": filepath.Join(dir, "not_found"),
+		})
+		assert.NotNil(t, err)
+		assert.True(t, errors.Is(err, os.ErrNotExist))
+	})
+
+	t.Run("Agent", func(t *testing.T) {
+		keyring := agent.NewKeyring()
+		assert.Nil(t, keyring.Add(agent.AddedKey{PrivateKey: priv}))
+		sock := filepath.Join(dir, "agent.sock")
+		ln, err := net.Listen("unix", sock)
+		assert.Nil(t, err)
+		defer ln.Close()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					_ = agent.ServeAgent(keyring, conn)
+				}()
+			}
+		}()
+
+		t.Setenv("SSH_AUTH_SOCK", "")
+		node := &SshNode{}
+		err = node.Init(types.NewConfig(), types.Configuration{
+			"host":     "127.0.0.1",
+			"port":     port,
+			"username": "root",
+			"useAgent": true,
+		})
+		assert.Equal(t, SshAgentSockEmptyErr, err)
+
+		t.Setenv("SSH_AUTH_SOCK", sock)
+		node2, err := test.CreateAndInitNode("ssh", types.Configuration{
+			"port":                     port,
+			"password":                 "",
+			"useAgent":                 true,
+			"cmd":                      "echo ${name}",
+			"insecureSkipHostKeyCheck": true,
+		}, Registry)
+		assert.Nil(t, err)
+		defer node2.Destroy()
+		execCmd(node2)
+	})
+}
+
+func TestSshNodeHostKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(priv)
+	assert.Nil(t, err)
+	server := startSshServer(t, clientSigner.PublicKey(), "127.0.0.1:0")
+	port, hostKey := server.port, server.hostKey
+
+	dir := t.TempDir()
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	assert.Nil(t, err)
+	keyFile := filepath.Join(dir, "id_ed25519")
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+
+	_, otherPub, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	otherSigner, err := ssh.NewSignerFromKey(otherPub)
+	assert.Nil(t, err)
+	address := knownhosts.Normalize("127.0.0.1:" + strconv.Itoa(port))
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	assert.Nil(t, os.WriteFile(knownHostsFile, []byte(knownhosts.Line([]string{address}, hostKey)+"\n"), 0600))
+	otherKnownHostsFile := filepath.Join(dir, "other_known_hosts")
+	assert.Nil(t, os.WriteFile(otherKnownHostsFile, []byte(knownhosts.Line([]string{address}, otherSigner.PublicKey())+"\n"), 0600))
+
+	initNode := func(configuration types.Configuration) error {
+		configuration["host"] = "127.0.0.1"
+		configuration["port"] = port
+		configuration["username"] = "root"
+		configuration["privateKeyFile"] = keyFile
+		config := types.NewConfig()
+		config.NodeClientInitPolicy = types.InitPolicyEager
+		node := &SshNode{}
+		err := node.Init(config, configuration)
+		node.Destroy()
+		return err
+	}
+	fingerprint := ssh.FingerprintSHA256(hostKey)
+
+	//没有配置校验方式
+	assert.Equal(t, SshHostKeyEmptyErr, initNode(types.Configuration{}))
+	assert.Nil(t, initNode(types.Configuration{"insecureSkipHostKeyCheck": true}))
+
+	assert.Nil(t, initNode(types.Configuration{"hostKeyFingerprint": fingerprint}))
+	assert.Nil(t, initNode(types.Configuration{"hostKeyFingerprint": strings.TrimPrefix(fingerprint, "SHA256:")}))
+	err = initNode(types.Configuration{"hostKeyFingerprint": ssh.FingerprintSHA256(otherSigner.PublicKey()), "insecureSkipHostKeyCheck": true})
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), fingerprint))
+
+	assert.Nil(t, initNode(types.Configuration{"knownHostsFile": knownHostsFile}))
+	err = initNode(types.Configuration{"knownHostsFile": otherKnownHostsFile})
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), fingerprint))
+	var keyErr *knownhosts.KeyError
+	assert.True(t, errors.As(err, &keyErr))
+
+	err = initNode(types.Configuration{"knownHostsFile": filepath.Join(dir, "not_found")})
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestSshNodeReconnect(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(priv)
+	assert.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	assert.Nil(t, err)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+
+	//获取一个没有服务监听的端口
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := ln.Addr().String()
+	port := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+
+	newNode := func() *SshNode {
+		node := &SshNode{}
+		err := node.Init(types.NewConfig(), types.Configuration{
+			"host":                     "127.0.0.1",
+			"port":                     port,
+			"username":                 "root",
+			"privateKeyFile":           keyFile,
+			"insecureSkipHostKeyCheck": true,
+			"cmd":                      "echo ${name}",
+		})
+		assert.Nil(t, err)
+		return node
+	}
+	exec := func(node *SshNode) (string, error) {
+		var data string
+		var resultErr error
+		metaData := types.NewMetadata()
+		metaData.PutValue("name", "rulego")
+		ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			data, resultErr = msg.GetData(), err
+		})
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, metaData, "{}"))
+		return data, resultErr
+	}
+
+	//服务不可用时初始化成功，处理消息失败
+	node := newNode()
+	defer node.Destroy()
+	_, err = exec(node)
+	assert.NotNil(t, err)
+	//退避期间不重新连接
+	_, err = exec(node)
+	assert.True(t, errors.Is(err, SshNotConnectedErr))
+
+	server := startSshServer(t, clientSigner.PublicKey(), address)
+	time.Sleep(sshDialBackoff(1))
+	data, err := exec(node)
+	assert.Nil(t, err)
+	assert.Equal(t, "echo rulego", data)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.handshakes))
+
+	//连接断开后重新连接
+	server.dropConnections()
+	data, err = exec(node)
+	assert.Nil(t, err)
+	assert.Equal(t, "echo rulego", data)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.handshakes))
+
+	//相同 user@host:port 的节点共用连接，并发处理消息不建立新连接
+	node2 := newNode()
+	defer node2.Destroy()
+	var wg sync.WaitGroup
+	var failures int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := exec(node2); err != nil {
+				atomic.AddInt32(&failures, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(0), failures)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.handshakes))
+
+	assert.Equal(t, time.Second, sshDialBackoff(1))
+	assert.Equal(t, time.Second*8, sshDialBackoff(4))
+	assert.Equal(t, time.Second*30, sshDialBackoff(10))
+}
+
+func TestSshNodeCommand(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(priv)
+	assert.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	assert.Nil(t, err)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+	server := startSshServer(t, clientSigner.PublicKey(), "127.0.0.1:0")
+
+	newNode := func(successOnNonZeroExit bool) *SshNode {
+		node := &SshNode{}
+		err := node.Init(types.NewConfig(), types.Configuration{
+			"host":                     "127.0.0.1",
+			"port":                     server.port,
+			"username":                 "root",
+			"privateKeyFile":           keyFile,
+			"insecureSkipHostKeyCheck": true,
+			"cmd":                      "${cmd}",
+			"timeout":                  1,
+			"successOnNonZeroExit":     successOnNonZeroExit,
+		})
+		assert.Nil(t, err)
+		return node
+	}
+	exec := func(node *SshNode, cmd string) (types.RuleMsg, string, error) {
+		var result types.RuleMsg
+		var relation string
+		var resultErr error
+		metaData := types.NewMetadata()
+		metaData.PutValue("cmd", cmd)
+		ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			result, relation, resultErr = msg, relationType, err
+		})
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, metaData, "{}"))
+		return result, relation, resultErr
+	}
+
+	node := newNode(false)
+	defer node.Destroy()
+	msg, relation, err := exec(node, "echo hello")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, "echo hello", msg.GetData())
+	assert.Equal(t, "0", msg.Metadata.GetValue(KeySshExitCode))
+	assert.Equal(t, "", msg.Metadata.GetValue(KeySshStderr))
+
+	//退出码不为0
+	msg, relation, err = exec(node, "fail")
+	assert.Equal(t, types.Failure, relation)
+	var exitErr *ssh.ExitError
+	assert.True(t, errors.As(err, &exitErr))
+	assert.Equal(t, "partial", msg.GetData())
+	assert.Equal(t, "error", msg.Metadata.GetValue(KeySshStderr))
+	assert.Equal(t, "2", msg.Metadata.GetValue(KeySshExitCode))
+
+	node2 := newNode(true)
+	defer node2.Destroy()
+	msg, relation, err = exec(node2, "fail")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Success, relation)
+	assert.Equal(t, "2", msg.Metadata.GetValue(KeySshExitCode))
+
+	//超时
+	start := time.Now()
+	msg, relation, err = exec(node, "sleep 60")
+	assert.True(t, time.Since(start) < time.Second*3)
+	assert.Equal(t, types.Failure, relation)
+	assert.True(t, errors.Is(err, SshCmdTimeoutErr))
+	assert.Equal(t, "", msg.Metadata.GetValue(KeySshExitCode))
+	//超时后连接仍然可用
+	_, relation, _ = exec(node, "echo hello")
+	assert.Equal(t, types.Success, relation)
+}
+
+func TestSshNodeEnvs(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(priv)
+	assert.Nil(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	assert.Nil(t, err)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600))
+	server := startSshServer(t, clientSigner.PublicKey(), "127.0.0.1:0")
+
+	configuration := types.Configuration{
+		"host":                     "127.0.0.1",
+		"port":                     server.port,
+		"username":                 "root",
+		"privateKeyFile":           keyFile,
+		"insecureSkipHostKeyCheck": true,
+		"cmd":                      "sh deploy.sh",
+		"envs":                     map[string]string{"ENV": "prod", "DEVICE": "${deviceId}"},
+		"workDir":                  "/opt/${app}",
+	}
+	node := &SshNode{}
+	assert.Nil(t, node.Init(types.NewConfig(), configuration))
+	defer node.Destroy()
+	exec := func() string {
+		var data string
+		metaData := types.NewMetadata()
+		//元数据中的值不能注入命令
+		metaData.PutValue("deviceId", "d1'; rm -rf /")
+		metaData.PutValue("app", "my app")
+		ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Success, relationType)
+			data = msg.GetData()
+		})
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, metaData, "{}"))
+		return data
+	}
+
+	//服务端允许设置环境变量
+	server.setAcceptEnv(true)
+	assert.Equal(t, "cd '/opt/my app' && sh deploy.sh\nDEVICE=d1'; rm -rf /\nENV=prod", exec())
+
+	//服务端不允许设置环境变量，使用 export 前缀
+	server.setAcceptEnv(false)
+	assert.Equal(t, `cd '/opt/my app' && export DEVICE='d1'\''; rm -rf /' ENV='prod' && sh deploy.sh`, exec())
+
+	configuration["envs"] = map[string]string{"ENV;rm": "prod"}
+	err = (&SshNode{}).Init(types.NewConfig(), configuration)
+	assert.True(t, errors.Is(err, SshEnvNameErr))
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+// 规则链节点配置示例：
+//
+//	{
+//	       "id": "s4",
+//	       "type": "wsPush",
+//	       "name": "推送给设备的websocket连接",
+//	       "configuration": {
+//	         "server": ":9090",
+//	         "tagKey": "deviceId",
+//	         "tagValue": "${metadata.deviceId}"
+//	       }
+//	     }
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/el"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+// KeyPushCount 推送成功的连接数放到元数据的key
+const KeyPushCount = "pushCount"
+
+// ErrNoBroadcaster 没有找到服务地址对应的websocket端点
+var ErrNoBroadcaster = errors.New("websocket endpoint not found")
+
+// 注册节点
+func init() {
+	Registry.Add(&WsPushNode{})
+}
+
+// WsPushNodeConfiguration 节点配置
+type WsPushNodeConfiguration struct {
+	// Server websocket端点的服务地址，和端点配置的server相同，例如：:9090 或者 ref://{resourceId}
+	Server string `json:"server"`
+	// TagKey 按连接标签筛选推送的连接，为空推送给所有连接
+	// 连接标签在端点拦截器中通过 websocket.ResponseMessage.SetSessionTag 设置
+	TagKey string `json:"tagKey"`
+	// TagValue 连接标签的值，可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
+	TagValue string `json:"tagValue"`
+}
+
+// WsPushNode 把消息负荷推送给websocket端点匹配的连接，二进制消息使用BinaryMessage，其他使用TextMessage
+// 慢连接不会阻塞其他连接的推送，推送成功的连接数放到元数据 pushCount
+// 找到端点，把消息发送到`Success`链；端点不存在或者没有启动，把消息发送到`Failure`链
+type WsPushNode struct {
+	// 节点配置
+	Config WsPushNodeConfiguration
+	// 标签值模板
+	tagValueTemplate *el.MixedTemplate
+}
+
+// Type 组件类型
+func (x *WsPushNode) Type() string {
+	return "wsPush"
+}
+
+func (x *WsPushNode) New() types.Node {
+	return &WsPushNode{Config: WsPushNodeConfiguration{
+		Server: ":9090",
+	}}
+}
+
+// Init 初始化
+func (x *WsPushNode) Init(_ types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	if x.Config.Server == "" {
+		return errors.New("server can not empty")
+	}
+	x.tagValueTemplate, err = el.NewMixedTemplate(x.Config.TagValue)
+	return err
+}
+
+// OnMsg 处理消息
+func (x *WsPushNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	broadcasters := endpoint.GetBroadcasters(x.Config.Server)
+	if len(broadcasters) == 0 {
+		ctx.TellFailure(msg, fmt.Errorf("%w: %s", ErrNoBroadcaster, x.Config.Server))
+		return
+	}
+	var filter func(endpoint.SessionInfo) bool
+	if x.Config.TagKey != "" {
+		var evn map[string]interface{}
+		if x.tagValueTemplate.HasVar() {
+			evn = base.NodeUtils.GetEvnAndMetadata(ctx, msg)
+		}
+		tagValue := x.tagValueTemplate.ExecuteAsString(evn)
+		filter = func(session endpoint.SessionInfo) bool {
+			value, ok := session.Tags[x.Config.TagKey]
+			return ok && value == tagValue
+		}
+	}
+	data := msg.GetBytes()
+	count := 0
+	for _, broadcaster := range broadcasters {
+		if msg.DataType == types.BINARY {
+			count += broadcaster.BroadcastBinary(data, filter)
+		} else {
+			count += broadcaster.Broadcast(data, filter)
+		}
+	}
+	msg.Metadata.PutValue(KeyPushCount, strconv.Itoa(count))
+	ctx.TellSuccess(msg)
+}
+
+// Destroy 销毁
+func (x *WsPushNode) Destroy() {
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// testBroadcaster 记录推送的消息
+type testBroadcaster struct {
+	sessions []endpoint.SessionInfo
+	pushed   []string
+	binary   int
+}
+
+func (b *testBroadcaster) Broadcast(data []byte, filter func(endpoint.SessionInfo) bool) int {
+	count := 0
+	for _, session := range b.sessions {
+		if filter == nil || filter(session) {
+			b.pushed = append(b.pushed, session.Id+":"+string(data))
+			count++
+		}
+	}
+	return count
+}
+
+func (b *testBroadcaster) BroadcastBinary(data []byte, filter func(endpoint.SessionInfo) bool) int {
+	b.binary++
+	return b.Broadcast(data, filter)
+}
+
+func TestWsPushNode(t *testing.T) {
+	var targetNodeType = "wsPush"
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &WsPushNode{}, types.Configuration{
+			"server": ":9090",
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		_, err := test.CreateAndInitNode(targetNodeType, types.Configuration{"server": ""}, Registry)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("OnMsg", func(t *testing.T) {
+		broadcaster := &testBroadcaster{sessions: []endpoint.SessionInfo{
+			{Id: "c1", Tags: map[string]string{"deviceId": "d1"}},
+			{Id: "c2", Tags: map[string]string{"deviceId": "d2"}},
+			{Id: "c3"},
+		}}
+		endpoint.RegisterBroadcaster(":wsPushTest", broadcaster)
+		defer endpoint.UnregisterBroadcaster(":wsPushTest", broadcaster)
+
+		onMsg := func(configuration types.Configuration, msg types.RuleMsg) (types.RuleMsg, string, error) {
+			node, err := test.CreateAndInitNode(targetNodeType, configuration, Registry)
+			assert.Nil(t, err)
+			var result types.RuleMsg
+			var relationType string
+			ctx := test.NewRuleContextFull(types.NewConfig(), node, nil, func(msg types.RuleMsg, r string, e error) {
+				result, relationType, err = msg, r, e
+			})
+			node.OnMsg(ctx, msg)
+			return result, relationType, err
+		}
+		metadata := types.NewMetadata()
+		metadata.PutValue("deviceId", "d2")
+
+		msg, relationType, err := onMsg(types.Configuration{"server": ":wsPushTest"}, types.NewMsg(0, "TEST", types.TEXT, metadata, "hello"))
+		assert.Equal(t, types.Success, relationType)
+		assert.Nil(t, err)
+		assert.Equal(t, "3", msg.Metadata.GetValue(KeyPushCount))
+
+		broadcaster.pushed = nil
+		msg, relationType, _ = onMsg(types.Configuration{"server": ":wsPushTest", "tagKey": "deviceId", "tagValue": "${metadata.deviceId}"},
+			types.NewMsg(0, "TEST", types.BINARY, metadata, "hello"))
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, "1", msg.Metadata.GetValue(KeyPushCount))
+		assert.Equal(t, []string{"c2:hello"}, broadcaster.pushed)
+		assert.Equal(t, 1, broadcaster.binary)
+
+		_, relationType, err = onMsg(types.Configuration{"server": ":notFound"}, types.NewMsg(0, "TEST", types.TEXT, metadata, "hello"))
+		assert.Equal(t, types.Failure, relationType)
+		assert.True(t, errors.Is(err, ErrNoBroadcaster))
+	})
+}
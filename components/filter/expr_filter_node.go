@@ -43,7 +43,7 @@ func init() {
 // ExprFilterNodeConfiguration 节点配置
 type ExprFilterNodeConfiguration struct {
 	// 表达式
-	Expr string
+	Expr string `required:"true"`
 }
 
 // ExprFilterNode 使用expr表达式过滤消息
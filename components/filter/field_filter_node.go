@@ -32,7 +32,7 @@ func init() {
 type FieldFilterNodeConfiguration struct {
 	//是否是满足所有field key存在
 	CheckAllKeys bool
-	//msg data字段key多个与逗号隔开
+	//msg data字段key多个与逗号隔开，支持嵌套字段路径，例如：items[0].name 或者 JSON pointer：/a~1b
 	DataNames string
 	//metadata字段key多个与逗号隔开
 	MetadataNames string
@@ -45,6 +45,7 @@ type FieldFilterNode struct {
 	Config            FieldFilterNodeConfiguration
 	DataNamesList     []string
 	MetadataNamesList []string
+	dataPaths         []*json.Path
 }
 
 // Type 组件类型
@@ -61,6 +62,15 @@ func (x *FieldFilterNode) Init(ruleConfig types.Config, configuration types.Conf
 	err := maps.Map2Struct(configuration, &x.Config)
 	x.DataNamesList = strings.Split(x.Config.DataNames, ",")
 	x.MetadataNamesList = strings.Split(x.Config.MetadataNames, ",")
+	x.dataPaths = make([]*json.Path, 0, len(x.DataNamesList))
+	for _, name := range x.DataNamesList {
+		path, pathErr := json.CompilePath(name)
+		if name == "" || pathErr != nil {
+			//无法解析的路径作为普通字段名
+			path = json.MustCompilePath("/" + json.EscapePointer(name))
+		}
+		x.dataPaths = append(x.dataPaths, path)
+	}
 	return err
 }
 
@@ -68,9 +78,11 @@ func (x *FieldFilterNode) Init(ruleConfig types.Config, configuration types.Conf
 func (x *FieldFilterNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 	var dataMap = make(map[string]interface{})
 	if msg.DataType == types.JSON {
-		if err := json.Unmarshal([]byte(msg.GetData()), &dataMap); err != nil {
+		if data, err := msg.GetDataAsJson(); err != nil {
 			ctx.TellFailure(msg, err)
 			return
+		} else {
+			dataMap = data
 		}
 	}
 
@@ -103,11 +115,11 @@ func (x *FieldFilterNode) checkAllKeysMetadata(metadata *types.Metadata) bool {
 }
 
 func (x *FieldFilterNode) checkAllKeysData(data map[string]interface{}) bool {
-	for _, item := range x.DataNamesList {
+	for _, path := range x.dataPaths {
 		if data == nil {
 			return false
 		}
-		if _, ok := data[item]; !ok {
+		if _, ok := path.Get(data); !ok {
 			return false
 		}
 	}
@@ -124,11 +136,11 @@ func (x *FieldFilterNode) checkAtLeastOneMetadata(metadata *types.Metadata) bool
 }
 
 func (x *FieldFilterNode) checkAtLeastOneData(data map[string]interface{}) bool {
-	for _, item := range x.DataNamesList {
+	for _, path := range x.dataPaths {
 		if data == nil {
 			return false
 		}
-		if _, ok := data[item]; ok {
+		if _, ok := path.Get(data); ok {
 			return true
 		}
 	}
@@ -55,6 +55,29 @@ func TestFieldFilterNode(t *testing.T) {
 		}))
 	})
 
+	t.Run("CheckPath", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"checkAllKeys": true,
+			"dataNames":    "device.items[0].name,/x~1y,a\\.b,bad[x]",
+		}, Registry)
+		assert.Nil(t, err)
+		data := map[string]interface{}{
+			"device": map[string]interface{}{
+				"items": []interface{}{map[string]interface{}{"name": "n0"}},
+			},
+			"x/y":    1,
+			"a.b":    2,
+			"bad[x]": 3,
+		}
+		assert.True(t, node.(*FieldFilterNode).checkAllKeysData(data))
+		delete(data, "a.b")
+		assert.False(t, node.(*FieldFilterNode).checkAllKeysData(data))
+		assert.True(t, node.(*FieldFilterNode).checkAtLeastOneData(map[string]interface{}{"bad[x]": 3}))
+		assert.False(t, node.(*FieldFilterNode).checkAtLeastOneData(map[string]interface{}{
+			"device": map[string]interface{}{"items": []interface{}{}},
+		}))
+	})
+
 	t.Run("OnMsg1", func(t *testing.T) {
 		node1, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
 			"checkAllKeys":  true,
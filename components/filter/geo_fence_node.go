@@ -0,0 +1,262 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+//规则链节点配置示例：
+//{
+//        "id": "s1",
+//        "type": "geoFence",
+//        "name": "地理围栏",
+//        "configuration": {
+//          "latitude": "msg.lat",
+//          "longitude": "msg.lon",
+//          "zones": "{\"type\":\"FeatureCollection\",\"features\":[{\"type\":\"Feature\",\"properties\":{\"name\":\"depot\",\"radius\":500},\"geometry\":{\"type\":\"Point\",\"coordinates\":[113.32,23.13]}}]}",
+//          "nearest": true
+//        }
+//      }
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/cast"
+	"github.com/rulego/rulego/utils/geo"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+const (
+	// RelationInside 坐标在任意区域内
+	RelationInside = "Inside"
+	// RelationOutside 坐标不在任何区域内
+	RelationOutside = "Outside"
+)
+
+const (
+	// KeyGeoZones 匹配的区域名称，多个用逗号分隔，按照区域定义顺序
+	KeyGeoZones = "geoZones"
+	// KeyGeoNearestZone 最近的区域名称
+	KeyGeoNearestZone = "geoNearestZone"
+	// KeyGeoNearestDistance 到最近区域的距离，单位米，在区域内为0
+	KeyGeoNearestDistance = "geoNearestDistance"
+)
+
+func init() {
+	Registry.Add(&GeoFenceNode{})
+}
+
+// GeoFenceNodeConfiguration 节点配置
+type GeoFenceNodeConfiguration struct {
+	// 纬度表达式，默认msg.latitude
+	Latitude string
+	// 经度表达式，默认msg.longitude
+	Longitude string
+	// 区域定义，GeoJSON格式：FeatureCollection、Feature或者geometry
+	// 支持Polygon（可以带洞）、MultiPolygon，以及带properties.radius（单位米）的Point表示圆形区域
+	// 区域名称取properties.name，如果没有则取feature id
+	Zones string
+	// 区域定义文件路径，GeoJSON格式，文件修改后自动重新加载。如果配置了该字段，则忽略Zones
+	ZonesFile string
+	// 检查区域定义文件是否修改的间隔，单位秒，如果<=0 则默认10
+	ReloadInterval int
+	// 是否计算最近的区域和距离，结果写入元数据geoNearestZone和geoNearestDistance
+	Nearest bool
+}
+
+// GeoFenceNode 地理围栏过滤器，判断坐标是否在配置的区域内
+// 如果在任意区域内发送到`Inside`链，否则发送到`Outside`链，匹配的区域名称写入元数据geoZones，可以同时匹配多个区域
+// 如果坐标无法获取或者不合法，发送到`Failure`链
+// 使用网格空间索引，每条消息只检查附近的区域。跨越180度经线的多边形会被正确处理
+type GeoFenceNode struct {
+	//节点配置
+	Config           GeoFenceNodeConfiguration
+	ruleConfig       types.Config
+	latitudeProgram  *vm.Program
+	longitudeProgram *vm.Program
+	// 区域索引 *geo.Index
+	index atomic.Value
+	// 区域定义文件修改时间
+	modTime time.Time
+	// 上次检查区域定义文件的时间，单位纳秒
+	lastCheck      int64
+	reloadInterval time.Duration
+	reloadLock     sync.Mutex
+}
+
+// Type 组件类型
+func (x *GeoFenceNode) Type() string {
+	return "geoFence"
+}
+
+func (x *GeoFenceNode) New() types.Node {
+	return &GeoFenceNode{Config: GeoFenceNodeConfiguration{
+		Latitude:       "msg.latitude",
+		Longitude:      "msg.longitude",
+		ReloadInterval: 10,
+	}}
+}
+
+// Init 初始化
+func (x *GeoFenceNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	x.ruleConfig = ruleConfig
+	if err := maps.Map2Struct(configuration, &x.Config); err != nil {
+		return err
+	}
+	if strings.TrimSpace(x.Config.Latitude) == "" {
+		x.Config.Latitude = "msg.latitude"
+	}
+	if strings.TrimSpace(x.Config.Longitude) == "" {
+		x.Config.Longitude = "msg.longitude"
+	}
+	if x.Config.ReloadInterval <= 0 {
+		x.Config.ReloadInterval = 10
+	}
+	x.reloadInterval = time.Duration(x.Config.ReloadInterval) * time.Second
+	var err error
+	if x.latitudeProgram, err = expr.Compile(x.Config.Latitude, expr.AllowUndefinedVariables()); err != nil {
+		return err
+	}
+	if x.longitudeProgram, err = expr.Compile(x.Config.Longitude, expr.AllowUndefinedVariables()); err != nil {
+		return err
+	}
+	x.Config.ZonesFile = strings.TrimSpace(x.Config.ZonesFile)
+	if x.Config.ZonesFile != "" {
+		return x.loadFile()
+	}
+	if strings.TrimSpace(x.Config.Zones) == "" {
+		return errors.New("zones can not be empty")
+	}
+	zones, err := geo.ParseGeoJSON([]byte(x.Config.Zones))
+	if err != nil {
+		return err
+	}
+	x.index.Store(geo.NewIndex(zones, 0))
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *GeoFenceNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	point, err := x.getPoint(ctx, msg)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	x.checkReload()
+	index := x.index.Load().(*geo.Index)
+	zones := index.Contains(point)
+	names := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		names = append(names, zone.Name)
+	}
+	msg.Metadata.PutValue(KeyGeoZones, strings.Join(names, ","))
+	if x.Config.Nearest {
+		if nearest := index.Nearest(point); nearest != nil {
+			msg.Metadata.PutValue(KeyGeoNearestZone, nearest.Zone.Name)
+			msg.Metadata.PutValue(KeyGeoNearestDistance, strconv.FormatFloat(nearest.Distance, 'f', 2, 64))
+		}
+	}
+	if len(zones) > 0 {
+		ctx.TellNext(msg, RelationInside)
+	} else {
+		ctx.TellNext(msg, RelationOutside)
+	}
+}
+
+// Destroy 销毁
+func (x *GeoFenceNode) Destroy() {
+}
+
+// getPoint 获取消息的坐标
+func (x *GeoFenceNode) getPoint(ctx types.RuleContext, msg types.RuleMsg) (geo.Point, error) {
+	evn := base.NodeUtils.GetEvn(ctx, msg)
+	lat, err := x.getFloat(x.latitudeProgram, evn, "latitude")
+	if err != nil {
+		return geo.Point{}, err
+	}
+	lon, err := x.getFloat(x.longitudeProgram, evn, "longitude")
+	if err != nil {
+		return geo.Point{}, err
+	}
+	point := geo.Point{Lon: lon, Lat: lat}
+	if !point.Valid() || lon > 180 {
+		return geo.Point{}, fmt.Errorf("invalid coordinate: latitude=%v longitude=%v", lat, lon)
+	}
+	return point, nil
+}
+
+func (x *GeoFenceNode) getFloat(program *vm.Program, evn map[string]interface{}, name string) (float64, error) {
+	out, err := vm.Run(program, evn)
+	if err != nil {
+		return 0, err
+	}
+	if out == nil {
+		return 0, fmt.Errorf("%s not found", name)
+	}
+	v, err := cast.ToFloat64E(out)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return v, nil
+}
+
+// checkReload 按照间隔检查区域定义文件是否修改，修改则重新加载，加载失败继续使用原来的区域
+func (x *GeoFenceNode) checkReload() {
+	if x.Config.ZonesFile == "" {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&x.lastCheck)
+	if now-last < int64(x.reloadInterval) || !atomic.CompareAndSwapInt64(&x.lastCheck, last, now) {
+		return
+	}
+	if err := x.loadFile(); err != nil && x.ruleConfig.Logger != nil {
+		x.ruleConfig.Logger.Printf("geoFence reload zones file %s error: %v", x.Config.ZonesFile, err)
+	}
+}
+
+// loadFile 如果区域定义文件修改则加载
+func (x *GeoFenceNode) loadFile() error {
+	x.reloadLock.Lock()
+	defer x.reloadLock.Unlock()
+	info, err := os.Stat(x.Config.ZonesFile)
+	if err != nil {
+		return err
+	}
+	if x.index.Load() != nil && info.ModTime().Equal(x.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(x.Config.ZonesFile)
+	if err != nil {
+		return err
+	}
+	zones, err := geo.ParseGeoJSON(data)
+	if err != nil {
+		return err
+	}
+	x.index.Store(geo.NewIndex(zones, 0))
+	x.modTime = info.ModTime()
+	atomic.StoreInt64(&x.lastCheck, time.Now().UnixNano())
+	return nil
+}
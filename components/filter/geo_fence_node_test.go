@@ -0,0 +1,140 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+)
+
+var testGeoZones = `{
+  "type": "FeatureCollection",
+  "features": [
+	{"type": "Feature", "properties": {"name": "yard"}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[10,0],[10,10],[0,10],[0,0]],[[4,4],[6,4],[6,6],[4,6],[4,4]]]}},
+	{"type": "Feature", "properties": {"name": "gate", "radius": 200000}, "geometry": {"type": "Point", "coordinates": [10,5]}}
+  ]
+}`
+
+func onGeoFenceMsg(node types.Node, data string, callback func(msg types.RuleMsg, relationType string, err error)) {
+	ctx := test.NewRuleContext(types.NewConfig(), callback)
+	node.OnMsg(ctx, ctx.NewMsg("TEST", types.NewMetadata(), data))
+}
+
+func TestGeoFenceNode(t *testing.T) {
+	var targetNodeType = "geoFence"
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &GeoFenceNode{}, types.Configuration{
+			"latitude":       "msg.latitude",
+			"longitude":      "msg.longitude",
+			"reloadInterval": 10,
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		test.NodeInit(t, targetNodeType, types.Configuration{
+			"latitude":  "msg.lat",
+			"longitude": "metadata.lon",
+			"zones":     testGeoZones,
+		}, types.Configuration{
+			"latitude":       "msg.lat",
+			"longitude":      "metadata.lon",
+			"reloadInterval": 10,
+		}, Registry)
+		_, err := test.CreateAndInitNode(targetNodeType, types.Configuration{}, Registry)
+		assert.Equal(t, "zones can not be empty", err.Error())
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"zones": `{"type":"LineString"}`}, Registry)
+		assert.NotNil(t, err)
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"zonesFile": "not_found.json"}, Registry)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("OnMsg", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"latitude":  "msg.lat",
+			"longitude": "msg.lon",
+			"zones":     testGeoZones,
+			"nearest":   true,
+		}, Registry)
+		assert.Nil(t, err)
+
+		var tests = []struct {
+			data     string
+			relation string
+			zones    string
+			nearest  string
+			distance string
+		}{
+			{`{"lat":2,"lon":2}`, RelationInside, "yard", "yard", "0.00"},
+			//洞内
+			{`{"lat":5,"lon":5}`, RelationOutside, "", "yard", "110771.95"},
+			//边界和多个区域
+			{`{"lat":5,"lon":10}`, RelationInside, "yard,gate", "yard", "0.00"},
+			{`{"lat":"5","lon":"11"}`, RelationInside, "gate", "gate", "0.00"},
+			{`{"lat":20,"lon":5}`, RelationOutside, "", "yard", "1111950.80"},
+		}
+		for _, tt := range tests {
+			onGeoFenceMsg(node, tt.data, func(msg types.RuleMsg, relationType string, err error) {
+				assert.Equal(t, tt.relation, relationType, tt.data)
+				assert.Equal(t, tt.zones, msg.Metadata.GetValue(KeyGeoZones), tt.data)
+				assert.Equal(t, tt.nearest, msg.Metadata.GetValue(KeyGeoNearestZone), tt.data)
+				assert.Equal(t, tt.distance, msg.Metadata.GetValue(KeyGeoNearestDistance), tt.data)
+			})
+		}
+		for _, data := range []string{`{"lat":2}`, `{"lat":100,"lon":2}`, `{"lat":"a","lon":2}`} {
+			onGeoFenceMsg(node, data, func(msg types.RuleMsg, relationType string, err error) {
+				assert.Equal(t, types.Failure, relationType, data)
+			})
+		}
+	})
+
+	t.Run("ZonesFile", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "zones.json")
+		assert.Nil(t, os.WriteFile(file, []byte(testGeoZones), 0644))
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"zonesFile":      file,
+			"reloadInterval": 1,
+		}, Registry)
+		assert.Nil(t, err)
+		onMsg := func(expected string) {
+			onGeoFenceMsg(node, `{"latitude":30.5,"longitude":30.5}`, func(msg types.RuleMsg, relationType string, err error) {
+				assert.Equal(t, expected, relationType)
+			})
+		}
+		onMsg(RelationOutside)
+
+		assert.Nil(t, os.WriteFile(file, []byte(`{"type":"Feature","properties":{"name":"new"},"geometry":{"type":"Polygon","coordinates":[[[30,30],[31,30],[31,31],[30,31],[30,30]]]}}`), 0644))
+		//保证修改时间变化
+		modTime := time.Now().Add(time.Second)
+		assert.Nil(t, os.Chtimes(file, modTime, modTime))
+		time.Sleep(time.Millisecond * 1100)
+		onMsg(RelationInside)
+
+		//加载失败继续使用原来的区域
+		assert.Nil(t, os.WriteFile(file, []byte(`bad`), 0644))
+		modTime = modTime.Add(time.Second)
+		assert.Nil(t, os.Chtimes(file, modTime, modTime))
+		time.Sleep(time.Millisecond * 1100)
+		onMsg(RelationInside)
+	})
+}
@@ -20,9 +20,11 @@ import (
 	"context"
 	"errors"
 	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/aggregate"
 	"github.com/rulego/rulego/utils/maps"
 	"github.com/rulego/rulego/utils/str"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -39,6 +41,9 @@ type GroupFilterNodeConfiguration struct {
 	NodeIds interface{}
 	//Timeout 执行超时，单位秒，默认0：代表不限制。
 	Timeout int
+	//Aggregations 聚合组内已经执行完成的节点输出消息数据的数值字段，结果写入输出消息的元数据，按照 NodeIds 顺序计算first和last
+	//例如：[{"path":"score","funcs":["min","max","avg"]}]，结果写入元数据score_min、score_max、score_avg，非数值或者缺失的数量写入score_invalid
+	Aggregations []aggregate.Aggregation
 }
 
 // GroupFilterNode 把多个filter节点组成一个分组，
@@ -80,7 +85,10 @@ func (x *GroupFilterNode) Init(ruleConfig types.Config, configuration types.Conf
 		}
 	}
 	x.Length = int32(len(x.NodeIdList))
-	return err
+	if err != nil {
+		return err
+	}
+	return aggregate.InitAll(x.Config.Aggregations)
 }
 
 // OnMsg 处理消息
@@ -102,10 +110,20 @@ func (x *GroupFilterNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 
 	defer cancel()
 
+	//每个节点执行成功的输出，用于聚合
+	var outputsMu sync.Mutex
+	var outputs = make([]*types.RuleMsg, len(x.NodeIdList))
+
 	//执行节点列表逻辑
-	for _, nodeId := range x.NodeIdList {
+	for i, nodeId := range x.NodeIdList {
+		index := i
 		ctx.TellNode(chanCtx, nodeId, msg, true, func(callbackCtx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
 			if atomic.LoadInt32(&completed) == 0 {
+				if err == nil && len(x.Config.Aggregations) > 0 {
+					outputsMu.Lock()
+					outputs[index] = &msg
+					outputsMu.Unlock()
+				}
 				firstRelationType := relationType
 				atomic.AddInt32(&endCount, 1)
 
@@ -132,6 +150,11 @@ func (x *GroupFilterNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 	case <-chanCtx.Done():
 		ctx.TellFailure(msg, chanCtx.Err())
 	case r := <-c:
+		if len(x.Config.Aggregations) > 0 {
+			outputsMu.Lock()
+			msg = x.aggregate(msg, outputs)
+			outputsMu.Unlock()
+		}
 		if r {
 			ctx.TellNext(msg, types.True)
 		} else {
@@ -140,6 +163,19 @@ func (x *GroupFilterNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 	}
 }
 
+// aggregate 聚合组内节点输出，结果写入输出消息副本的元数据
+func (x *GroupFilterNode) aggregate(msg types.RuleMsg, outputs []*types.RuleMsg) types.RuleMsg {
+	var msgs []types.RuleMsg
+	for _, output := range outputs {
+		if output != nil {
+			msgs = append(msgs, *output)
+		}
+	}
+	result := msg.Copy()
+	aggregate.ApplyAll(x.Config.Aggregations, msgs, result.Metadata)
+	return result
+}
+
 // Destroy 销毁
 func (x *GroupFilterNode) Destroy() {
 }
@@ -189,4 +189,42 @@ func TestGroupFilterNode(t *testing.T) {
 		}
 
 	})
+
+	t.Run("Aggregations", func(t *testing.T) {
+		_, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"nodeIds":      "node1,node2",
+			"aggregations": []interface{}{map[string]interface{}{"funcs": "min"}},
+		}, Registry)
+		assert.NotNil(t, err)
+
+		groupFilterNode, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"allMatches":   true,
+			"nodeIds":      "node1,node2",
+			"aggregations": []interface{}{map[string]interface{}{"path": "temperature", "funcs": "max,count", "as": "t"}},
+		}, Registry)
+		assert.Nil(t, err)
+		node1, _ := test.CreateAndInitNode("jsFilter", types.Configuration{
+			"jsScript": "return msg.temperature > 50;",
+		}, Registry)
+		node2, _ := test.CreateAndInitNode("jsFilter", types.Configuration{
+			"jsScript": `return msg.humidity > 80;`,
+		}, Registry)
+		metaData := types.NewMetadata()
+		msgList := []test.Msg{
+			{
+				MetaData:   metaData,
+				MsgType:    "ACTIVITY_EVENT1",
+				Data:       "{\"temperature\":61,\"humidity\":90}",
+				AfterSleep: time.Millisecond * 200,
+			},
+		}
+		test.NodeOnMsgWithChildren(t, groupFilterNode, msgList, map[string]types.Node{"node1": node1, "node2": node2}, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.True, relationType)
+			assert.Equal(t, "61", msg.Metadata.GetValue("t_max"))
+			assert.Equal(t, "2", msg.Metadata.GetValue("t_count"))
+			assert.Equal(t, "0", msg.Metadata.GetValue("t_invalid"))
+		})
+		//输入消息的元数据不被修改
+		assert.False(t, metaData.Has("t_max"))
+	})
 }
@@ -88,6 +88,10 @@ func (x *JsFilterNode) Init(ruleConfig types.Config, configuration types.Configu
 	if err == nil {
 		jsScript := fmt.Sprintf(JsFilterFuncTemplate, x.Config.JsScript)
 		x.jsEngine, err = js.NewGojaJsEngine(ruleConfig, jsScript, base.NodeUtils.GetVars(configuration))
+		if err == nil {
+			//预热：使用空消息执行一次脚本
+			js.WarmUp(ruleConfig, x.jsEngine, JsFilterFuncName, map[string]interface{}{}, map[string]string{}, "")
+		}
 	}
 	return err
 }
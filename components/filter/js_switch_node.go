@@ -78,6 +78,10 @@ func (x *JsSwitchNode) Init(ruleConfig types.Config, configuration types.Configu
 	if err == nil {
 		jsScript := fmt.Sprintf("function Switch(msg, metadata, msgType) { %s }", x.Config.JsScript)
 		x.jsEngine, err = js.NewGojaJsEngine(ruleConfig, jsScript, base.NodeUtils.GetVars(configuration))
+		if err == nil {
+			//预热：使用空消息执行一次脚本
+			js.WarmUp(ruleConfig, x.jsEngine, "Switch", map[string]interface{}{}, map[string]string{}, "")
+		}
 		if v := ruleConfig.Properties.GetValue(KeyOtherRelationTypeName); v != "" {
 			x.defaultRelationType = v
 		} else {
@@ -0,0 +1,238 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+//规则链节点配置示例：
+//{
+//        "id": "s1",
+//        "type": "trafficSplit",
+//        "name": "灰度分流",
+//        "configuration": {
+//          "branches": [
+//            {"relation": "Canary", "weight": 5},
+//            {"relation": "Stable", "weight": 95}
+//          ],
+//          "stickyKey": "${metadata.deviceId}"
+//        }
+//      }
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/el"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+// KeyTrafficSplitBranch 选中的分支，写入元数据
+const KeyTrafficSplitBranch = "trafficSplitBranch"
+
+// trafficSplitScale 流量区间的刻度数，权重按照比例映射到[0,trafficSplitScale)区间
+const trafficSplitScale = 10000
+
+func init() {
+	Registry.Add(&TrafficSplitNode{})
+}
+
+// TrafficSplitNodeConfiguration 节点配置
+type TrafficSplitNodeConfiguration struct {
+	// Branches 分支列表，按顺序把流量区间划分给每个分支，每个分支的流量占比为 weight/所有weight之和
+	Branches []TrafficBranch
+	// StickyKey 粘性key模板，例如：${metadata.deviceId}
+	// 配置后相同key的消息总是路由到同一个分支；不配置或者渲染结果为空，则按照权重随机路由
+	StickyKey string
+}
+
+// TrafficBranch 分支
+type TrafficBranch struct {
+	// Relation 路由关系，把消息转发到对应的路由链
+	Relation string `json:"relation"`
+	// Weight 权重，>=0
+	Weight int `json:"weight"`
+}
+
+// TrafficSplitNode 按照权重把消息分流到不同的路由链，可用于灰度发布，例如5%的消息发送到`Canary`链，95%发送到`Stable`链
+// 配置粘性key后，对key做哈希映射到固定的流量区间，相同key的分配结果是确定的。
+// 分支区间按照配置顺序累加，调整权重后（通过重新加载节点配置），只有落在区间边界变化部分的key会切换分支，
+// 例如Canary从5调整到10，原来分配到Canary的key仍然在Canary，只有部分Stable的key迁移到Canary
+// 选中的分支写入元数据trafficSplitBranch，每个分支的计数可以通过 Stats 或者 RuleEngine.NodeStats 获取，节点重新加载后计数保留
+type TrafficSplitNode struct {
+	//节点配置
+	Config TrafficSplitNodeConfiguration
+	// 每个分支区间的上界（不包含）
+	bounds      []int
+	relations   []string
+	keyTemplate *el.MixedTemplate
+	counters    *trafficSplitCounters
+}
+
+// Type 组件类型
+func (x *TrafficSplitNode) Type() string {
+	return "trafficSplit"
+}
+
+func (x *TrafficSplitNode) New() types.Node {
+	return &TrafficSplitNode{Config: TrafficSplitNodeConfiguration{
+		Branches: []TrafficBranch{
+			{Relation: "Canary", Weight: 5},
+			{Relation: "Stable", Weight: 95},
+		},
+	}}
+}
+
+// Init 初始化
+func (x *TrafficSplitNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	if err := maps.Map2Struct(configuration, &x.Config); err != nil {
+		return err
+	}
+	if len(x.Config.Branches) == 0 {
+		return errors.New("branches is empty")
+	}
+	total := 0
+	relations := make(map[string]bool)
+	for _, branch := range x.Config.Branches {
+		if strings.TrimSpace(branch.Relation) == "" {
+			return errors.New("branch relation is empty")
+		}
+		if relations[branch.Relation] {
+			return fmt.Errorf("duplicate branch relation: %s", branch.Relation)
+		}
+		if branch.Weight < 0 {
+			return fmt.Errorf("branch %s weight must be >= 0", branch.Relation)
+		}
+		relations[branch.Relation] = true
+		total += branch.Weight
+	}
+	if total == 0 {
+		return errors.New("sum of branch weights must be > 0")
+	}
+	x.bounds = nil
+	x.relations = nil
+	cumulative := 0
+	for _, branch := range x.Config.Branches {
+		cumulative += branch.Weight
+		x.bounds = append(x.bounds, cumulative*trafficSplitScale/total)
+		x.relations = append(x.relations, branch.Relation)
+	}
+	if strings.TrimSpace(x.Config.StickyKey) != "" {
+		keyTemplate, err := el.NewMixedTemplate(x.Config.StickyKey)
+		if err != nil {
+			return err
+		}
+		x.keyTemplate = keyTemplate
+	}
+	x.counters = &trafficSplitCounters{}
+	//节点重新加载时，继承旧实例的计数
+	if chainCtx := base.NodeUtils.GetChainCtx(configuration); chainCtx != nil {
+		if self := base.NodeUtils.GetSelfDefinition(configuration); self.Id != "" {
+			if old, ok := chainCtx.GetNodeById(types.RuleNodeId{Id: self.Id, Type: types.NODE}); ok {
+				if getter, ok := old.(types.StatsGetter); ok {
+					x.counters.add(getter.Stats())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *TrafficSplitNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	relation := x.Select(x.stickyKey(ctx, msg))
+	msg.Metadata.PutValue(KeyTrafficSplitBranch, relation)
+	x.counters.incr(relation)
+	ctx.TellNext(msg, relation)
+}
+
+// Destroy 销毁
+func (x *TrafficSplitNode) Destroy() {
+}
+
+// Select 根据粘性key选择分支，key为空则按照权重随机选择
+func (x *TrafficSplitNode) Select(key string) string {
+	var slot int
+	if key == "" {
+		slot = rand.Intn(trafficSplitScale)
+	} else {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key))
+		slot = int(h.Sum64() % trafficSplitScale)
+	}
+	for i, bound := range x.bounds {
+		if slot < bound {
+			return x.relations[i]
+		}
+	}
+	return x.relations[len(x.relations)-1]
+}
+
+// Stats 获取每个分支路由的消息数量
+func (x *TrafficSplitNode) Stats() map[string]int64 {
+	if x.counters == nil {
+		return map[string]int64{}
+	}
+	return x.counters.snapshot()
+}
+
+// stickyKey 渲染粘性key
+func (x *TrafficSplitNode) stickyKey(ctx types.RuleContext, msg types.RuleMsg) string {
+	if x.keyTemplate == nil {
+		return ""
+	}
+	if !x.keyTemplate.HasVar() {
+		return x.Config.StickyKey
+	}
+	return x.keyTemplate.ExecuteAsString(base.NodeUtils.GetEvn(ctx, msg))
+}
+
+// trafficSplitCounters 分支计数器
+type trafficSplitCounters struct {
+	counts sync.Map
+}
+
+func (c *trafficSplitCounters) incr(relation string) {
+	c.addCount(relation, 1)
+}
+
+// add 累加另外一组计数
+func (c *trafficSplitCounters) add(counts map[string]int64) {
+	for relation, count := range counts {
+		c.addCount(relation, count)
+	}
+}
+
+func (c *trafficSplitCounters) addCount(relation string, count int64) {
+	v, ok := c.counts.Load(relation)
+	if !ok {
+		v, _ = c.counts.LoadOrStore(relation, new(int64))
+	}
+	atomic.AddInt64(v.(*int64), count)
+}
+
+func (c *trafficSplitCounters) snapshot() map[string]int64 {
+	result := make(map[string]int64)
+	c.counts.Range(func(key, value interface{}) bool {
+		result[key.(string)] = atomic.LoadInt64(value.(*int64))
+		return true
+	})
+	return result
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func onTrafficSplitMsg(node types.Node, deviceId string) (relation string, branch string) {
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		relation = relationType
+		branch = msg.Metadata.GetValue(KeyTrafficSplitBranch)
+	})
+	metadata := types.NewMetadata()
+	if deviceId != "" {
+		metadata.PutValue("deviceId", deviceId)
+	}
+	node.OnMsg(ctx, ctx.NewMsg("TEST", metadata, "{}"))
+	return
+}
+
+func TestTrafficSplitNode(t *testing.T) {
+	var targetNodeType = "trafficSplit"
+	const sample = 100000
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &TrafficSplitNode{}, types.Configuration{
+			"branches": []TrafficBranch{
+				{Relation: "Canary", Weight: 5},
+				{Relation: "Stable", Weight: 95},
+			},
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		_, err := test.CreateAndInitNode(targetNodeType, types.Configuration{"branches": []interface{}{}}, Registry)
+		assert.Equal(t, "branches is empty", err.Error())
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"branches": []interface{}{
+			map[string]interface{}{"relation": "A", "weight": 0},
+		}}, Registry)
+		assert.Equal(t, "sum of branch weights must be > 0", err.Error())
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"branches": []interface{}{
+			map[string]interface{}{"relation": "A", "weight": -1},
+		}}, Registry)
+		assert.Equal(t, "branch A weight must be >= 0", err.Error())
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"branches": []interface{}{
+			map[string]interface{}{"relation": "A", "weight": 1},
+			map[string]interface{}{"relation": "A", "weight": 1},
+		}}, Registry)
+		assert.Equal(t, "duplicate branch relation: A", err.Error())
+	})
+
+	t.Run("Distribution", func(t *testing.T) {
+		for _, sticky := range []bool{true, false} {
+			config := types.Configuration{}
+			if sticky {
+				config["stickyKey"] = "${metadata.deviceId}"
+			}
+			node, err := test.CreateAndInitNode(targetNodeType, config, Registry)
+			assert.Nil(t, err)
+			for i := 0; i < sample; i++ {
+				relation, branch := onTrafficSplitMsg(node, "device-"+strconv.Itoa(i))
+				assert.Equal(t, relation, branch)
+			}
+			stats := node.(*TrafficSplitNode).Stats()
+			assert.Equal(t, int64(sample), stats["Canary"]+stats["Stable"])
+			canaryRatio := float64(stats["Canary"]) / sample
+			assert.True(t, math.Abs(canaryRatio-0.05) < 0.005)
+			node.Destroy()
+		}
+	})
+
+	t.Run("Sticky", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"stickyKey": "${metadata.deviceId}",
+		}, Registry)
+		assert.Nil(t, err)
+		assignments := make(map[string]string)
+		for i := 0; i < 1000; i++ {
+			deviceId := "device-" + strconv.Itoa(i)
+			relation, _ := onTrafficSplitMsg(node, deviceId)
+			assignments[deviceId] = relation
+			//相同key分配结果不变
+			again, _ := onTrafficSplitMsg(node, deviceId)
+			assert.Equal(t, relation, again)
+		}
+
+		//调大Canary权重，原来的Canary key仍然分配到Canary
+		updated, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"stickyKey": "${metadata.deviceId}",
+			"branches": []interface{}{
+				map[string]interface{}{"relation": "Canary", "weight": 20},
+				map[string]interface{}{"relation": "Stable", "weight": 80},
+			},
+		}, Registry)
+		assert.Nil(t, err)
+		moved := 0
+		for deviceId, relation := range assignments {
+			newRelation, _ := onTrafficSplitMsg(updated, deviceId)
+			if relation == "Canary" {
+				assert.Equal(t, "Canary", newRelation)
+			} else if newRelation != relation {
+				moved++
+			}
+		}
+		assert.True(t, moved > 0)
+		assert.True(t, moved < len(assignments)/4)
+	})
+}
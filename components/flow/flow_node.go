@@ -47,7 +47,8 @@ type ChainNodeConfiguration struct {
 }
 
 // ChainNode 子规则链
-// 如果找不到规则链，则把消息通过`Failure`关系发送到下一个节点
+// 如果找不到规则链，则通过`Failure`关系发送到下一个节点：Extend=true 发送原消息，
+// Extend=false 发送合并消息，合并消息只有一个元素，Err 为找不到规则链的错误
 // Extend=true 子规则链的每一个输出和关系作为下一个节点的输入，不合并子规则链的关系和输出
 // Extend=false 子规则链所有分支执行完后，把每个结束节点处理的消息合后通过`Success`关系发送到下一个节点。消息格式：[]WrapperMsg
 type ChainNode struct {
@@ -116,6 +116,10 @@ func (x *JsTransformNode) Init(ruleConfig types.Config, configuration types.Conf
 	// 非直通模式：初始化JavaScript执行引擎
 	jsScript := fmt.Sprintf(JsTransformFuncTemplate, x.Config.JsScript)
 	x.jsEngine, err = js.NewGojaJsEngine(ruleConfig, jsScript, base.NodeUtils.GetVars(configuration))
+	if err == nil {
+		// 预热：使用空消息执行一次脚本，开启 types.Config.ScriptWarmUp 后生效
+		js.WarmUp(ruleConfig, x.jsEngine, JsTransformFuncName, map[string]interface{}{}, map[string]string{}, "")
+	}
 	return err
 }
 
@@ -23,6 +23,7 @@ import (
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/test"
 	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/js"
 )
 
 func TestJsTransformNode(t *testing.T) {
@@ -125,3 +126,21 @@ func TestJsTransformNode(t *testing.T) {
 		})
 	})
 }
+
+// TestJsTransformNodeReload 重新加载未修改的脚本复用已编译的程序
+func TestJsTransformNodeReload(t *testing.T) {
+	configuration := types.Configuration{
+		"jsScript": "msg.reload=true; return {'msg':msg,'metadata':metadata,'msgType':msgType};",
+	}
+	config := types.NewConfig(types.WithScriptWarmUp(true))
+	node1 := &JsTransformNode{}
+	assert.Nil(t, node1.Init(config, configuration))
+	node2 := &JsTransformNode{}
+	assert.Nil(t, node2.Init(config, configuration))
+	assert.True(t, node1.jsEngine.(*js.GojaJsEngine).Program() == node2.jsEngine.(*js.GojaJsEngine).Program())
+
+	configuration["jsScript"] = "msg.reload=false; return {'msg':msg,'metadata':metadata,'msgType':msgType};"
+	node3 := &JsTransformNode{}
+	assert.Nil(t, node3.Init(config, configuration))
+	assert.True(t, node1.jsEngine.(*js.GojaJsEngine).Program() != node3.jsEngine.(*js.GojaJsEngine).Program())
+}
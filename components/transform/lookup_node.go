@@ -0,0 +1,531 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transform
+
+//规则链节点配置示例：
+//{
+//	"id": "s1",
+//	"type": "lookup",
+//	"name": "设备信息",
+//	"configuration": {
+//		"source": "file",
+//		"file": "./data/devices.csv",
+//		"keyField": "deviceId",
+//		"key": "${metadata.deviceId}",
+//		"mapping": {
+//			"site":  "metadata.site",
+//			"model": "msg.model"
+//		}
+//	}
+//}
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/el"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/str"
+)
+
+func init() {
+	Registry.Add(&LookupNode{})
+}
+
+const (
+	// LookupSourceInline 查找表在节点配置data中定义
+	LookupSourceInline = "inline"
+	// LookupSourceFile 查找表从CSV或者JSON文件加载，文件修改后自动重新加载
+	LookupSourceFile = "file"
+	// LookupSourceCache 从缓存查找，缓存key为cachePrefix+key
+	LookupSourceCache = "cache"
+	// LookupCacheLevelGlobal 全局缓存
+	LookupCacheLevelGlobal = "global"
+	// LookupCacheLevelChain 规则链缓存
+	LookupCacheLevelChain = "chain"
+
+	// RelationMiss 查找表没有对应的key，并且没有配置默认值
+	RelationMiss = "Miss"
+	// KeyLookupVersion 元数据key：文件查找表的版本号，每次重新加载加1
+	KeyLookupVersion = "lookupVersion"
+
+	// lookupTargetMetadata 映射到元数据
+	lookupTargetMetadata = "metadata."
+	// lookupTargetMsg 映射到消息负荷
+	lookupTargetMsg = "msg."
+)
+
+// LookupNodeConfiguration 节点配置
+type LookupNodeConfiguration struct {
+	// Source 查找表数据源：inline（默认）、file、cache
+	Source string `json:"source"`
+	// Data inline数据源：key -> 字段对象，值不是对象则作为value字段
+	Data map[string]interface{} `json:"data"`
+	// File file数据源：文件路径，.csv 后缀按CSV格式（第一行是列名）解析，否则按JSON格式解析
+	// JSON格式可以是 key -> 字段对象 的对象，或者对象数组（使用keyField作为key）
+	// 相同路径的节点共享同一个查找表。文件修改后原子替换，建议先写临时文件再重命名，防止读取到写了一半的文件
+	File string `json:"file"`
+	// KeyField file数据源：作为key的CSV列名或者JSON数组对象字段，CSV默认第一列，JSON默认id
+	KeyField string `json:"keyField"`
+	// ReloadInterval file数据源：检查文件是否修改的间隔，单位秒，如果<=0 则默认10
+	// 相同路径的节点以第一个加载的节点配置为准
+	ReloadInterval int `json:"reloadInterval"`
+	// CacheLevel cache数据源：缓存级别，chain（默认）或者global
+	CacheLevel string `json:"cacheLevel"`
+	// CachePrefix cache数据源：缓存key前缀。缓存值可以是对象或者JSON字符串
+	CachePrefix string `json:"cachePrefix"`
+	// Key 查找key，可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
+	Key string `json:"key"`
+	// Mapping 查找结果字段 -> 目标，目标格式：metadata.xx 或者 msg.xx（支持JSON路径）
+	// 为空则把所有字段合并到元数据
+	Mapping map[string]string `json:"mapping"`
+	// Defaults 没有查找到时使用的默认值，目标 -> 值，目标格式同Mapping
+	// 为空则没有查找到时把消息发送到`Miss`链
+	Defaults map[string]string `json:"defaults"`
+}
+
+// LookupNode 查找表富化节点，根据key从查找表（例如：deviceId -> 站点、型号、负责人）查找字段，映射到元数据或者消息负荷
+// 查找成功，把消息发送到`Success`链；没有查找到，如果配置了默认值，使用默认值并发送到`Success`链，否则把原消息发送到`Miss`链
+// 映射到消息负荷失败，例如消息负荷不是JSON，发送到`Failure`链
+// file数据源在元数据 lookupVersion 记录查找表版本号，同一条消息的所有字段来自同一个版本
+type LookupNode struct {
+	//节点配置
+	Config LookupNodeConfiguration
+	base.SharedNode[*lookupFile]
+	keyTemplate *el.MixedTemplate
+	//inline数据源的查找表
+	table *lookupTable
+	//file数据源，共享查找表的key，空表示没有获取
+	fileKey string
+	file    *lookupFile
+	mapping []lookupMapping
+	//没有查找到时使用的默认值
+	defaults []lookupMapping
+}
+
+// lookupMapping 字段映射
+type lookupMapping struct {
+	field string
+	//目标是否元数据
+	toMetadata bool
+	//元数据key或者JSON路径
+	path  string
+	value string
+}
+
+// Type 组件类型
+func (x *LookupNode) Type() string {
+	return "lookup"
+}
+
+func (x *LookupNode) New() types.Node {
+	return &LookupNode{Config: LookupNodeConfiguration{
+		Source:         LookupSourceInline,
+		Key:            "${metadata.deviceId}",
+		ReloadInterval: 10,
+		CacheLevel:     LookupCacheLevelChain,
+	}}
+}
+
+// Init 初始化
+func (x *LookupNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(x.Config.Key) == "" {
+		return errors.New("key can not be empty")
+	}
+	if x.keyTemplate, err = el.NewMixedTemplate(x.Config.Key); err != nil {
+		return err
+	}
+	for field, target := range x.Config.Mapping {
+		m, err := parseLookupTarget(target)
+		if err != nil {
+			return err
+		}
+		m.field = field
+		x.mapping = append(x.mapping, m)
+	}
+	for target, value := range x.Config.Defaults {
+		m, err := parseLookupTarget(target)
+		if err != nil {
+			return err
+		}
+		m.value = value
+		x.defaults = append(x.defaults, m)
+	}
+	switch x.Config.Source {
+	case "", LookupSourceInline:
+		x.table = newLookupTable(x.Config.Data, 0)
+	case LookupSourceFile:
+		x.Config.File = strings.TrimSpace(x.Config.File)
+		if x.Config.File == "" {
+			return errors.New("file can not be empty")
+		}
+		return x.SharedNode.Init(ruleConfig, x.Type(), x.Config.File, true, func() (*lookupFile, error) {
+			return x.initFile(ruleConfig)
+		})
+	case LookupSourceCache:
+	default:
+		return fmt.Errorf("unsupported source: %s", x.Config.Source)
+	}
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *LookupNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	key := x.keyTemplate.ExecuteAsString(base.NodeUtils.GetEvnAndMetadata(ctx, msg))
+	var fields map[string]interface{}
+	var found bool
+	switch x.Config.Source {
+	case LookupSourceFile:
+		file, err := x.SharedNode.Get()
+		if err != nil {
+			ctx.TellFailure(msg, err)
+			return
+		}
+		//同一条消息只读取一次查找表快照，重新加载不会导致字段来自不同版本
+		table := file.snapshot()
+		fields, found = table.rows[key]
+		msg.Metadata.PutValue(KeyLookupVersion, strconv.FormatInt(table.version, 10))
+	case LookupSourceCache:
+		c := ctx.ChainCache()
+		if x.Config.CacheLevel == LookupCacheLevelGlobal {
+			c = ctx.GlobalCache()
+		}
+		if c != nil {
+			fields, found = toLookupFields(c.Get(x.Config.CachePrefix + key))
+		}
+	default:
+		fields, found = x.table.rows[key]
+	}
+	if !found {
+		if len(x.defaults) == 0 {
+			ctx.TellNext(msg, RelationMiss)
+			return
+		}
+		for _, m := range x.defaults {
+			if err := m.apply(&msg, m.value); err != nil {
+				ctx.TellFailure(msg, err)
+				return
+			}
+		}
+		ctx.TellSuccess(msg)
+		return
+	}
+	if len(x.mapping) == 0 {
+		for k, v := range fields {
+			msg.Metadata.PutValue(k, str.ToString(v))
+		}
+	} else {
+		for _, m := range x.mapping {
+			v, ok := fields[m.field]
+			if !ok {
+				continue
+			}
+			if err := m.apply(&msg, v); err != nil {
+				ctx.TellFailure(msg, err)
+				return
+			}
+		}
+	}
+	ctx.TellSuccess(msg)
+}
+
+// Destroy 释放共享查找表
+func (x *LookupNode) Destroy() {
+	x.SharedNode.StopBackgroundInit()
+	x.Locker.Lock()
+	defer x.Locker.Unlock()
+	if x.fileKey != "" {
+		releaseLookupFile(x.fileKey)
+		x.fileKey = ""
+		x.file = nil
+	}
+}
+
+// initFile 获取共享查找表
+func (x *LookupNode) initFile(ruleConfig types.Config) (*lookupFile, error) {
+	if x.file != nil {
+		return x.file, nil
+	}
+	x.Locker.Lock()
+	defer x.Locker.Unlock()
+	if x.file != nil {
+		return x.file, nil
+	}
+	interval := x.Config.ReloadInterval
+	if interval <= 0 {
+		interval = 10
+	}
+	key, file, err := acquireLookupFile(x.Config.File, x.Config.KeyField, time.Duration(interval)*time.Second, ruleConfig.Logger)
+	if err != nil {
+		return nil, err
+	}
+	x.fileKey = key
+	x.file = file
+	return file, nil
+}
+
+// parseLookupTarget 解析映射目标
+func parseLookupTarget(target string) (lookupMapping, error) {
+	target = strings.TrimSpace(target)
+	if strings.HasPrefix(target, lookupTargetMetadata) && len(target) > len(lookupTargetMetadata) {
+		return lookupMapping{toMetadata: true, path: target[len(lookupTargetMetadata):]}, nil
+	}
+	if strings.HasPrefix(target, lookupTargetMsg) && len(target) > len(lookupTargetMsg) {
+		path := target[len(lookupTargetMsg):]
+		if _, err := json.CompilePath(path); err != nil {
+			return lookupMapping{}, err
+		}
+		return lookupMapping{path: path}, nil
+	}
+	return lookupMapping{}, fmt.Errorf("invalid mapping target: %s, must be metadata.xx or msg.xx", target)
+}
+
+// apply 把值写入目标
+func (m lookupMapping) apply(msg *types.RuleMsg, value interface{}) error {
+	if m.toMetadata {
+		msg.Metadata.PutValue(m.path, str.ToString(value))
+		return nil
+	}
+	return msg.SetDataPath(m.path, value)
+}
+
+// lookupTable 查找表快照，创建后不再修改
+type lookupTable struct {
+	rows    map[string]map[string]interface{}
+	version int64
+}
+
+func newLookupTable(data map[string]interface{}, version int64) *lookupTable {
+	rows := make(map[string]map[string]interface{}, len(data))
+	for k, v := range data {
+		if fields, ok := toLookupFields(v); ok {
+			rows[k] = fields
+		}
+	}
+	return &lookupTable{rows: rows, version: version}
+}
+
+// toLookupFields 把查找到的值转换成字段，对象或者JSON对象字符串按字段，其他值作为value字段
+func toLookupFields(v interface{}) (map[string]interface{}, bool) {
+	switch value := v.(type) {
+	case nil:
+		return nil, false
+	case map[string]interface{}:
+		return value, true
+	case map[string]string:
+		fields := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			fields[k] = item
+		}
+		return fields, true
+	case string:
+		var fields map[string]interface{}
+		if strings.HasPrefix(strings.TrimSpace(value), "{") && json.Unmarshal([]byte(value), &fields) == nil {
+			return fields, true
+		}
+	case []byte:
+		return toLookupFields(string(value))
+	}
+	return map[string]interface{}{"value": v}, true
+}
+
+// lookupFilePool 按文件路径和key字段共享的查找表，使用引用计数
+var lookupFilePool = struct {
+	sync.Mutex
+	items map[string]*lookupFile
+}{items: make(map[string]*lookupFile)}
+
+// acquireLookupFile 获取共享查找表，如果不存在则加载
+func acquireLookupFile(path, keyField string, reloadInterval time.Duration, logger types.Logger) (string, *lookupFile, error) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	key := path + "#" + keyField
+	lookupFilePool.Lock()
+	defer lookupFilePool.Unlock()
+	f, ok := lookupFilePool.items[key]
+	if !ok {
+		f = &lookupFile{path: path, keyField: keyField, reloadInterval: reloadInterval, logger: logger}
+		if err := f.load(); err != nil {
+			return "", nil, err
+		}
+		lookupFilePool.items[key] = f
+	}
+	f.refs++
+	return key, f, nil
+}
+
+// releaseLookupFile 减少引用计数，没有节点使用时删除
+func releaseLookupFile(key string) {
+	lookupFilePool.Lock()
+	defer lookupFilePool.Unlock()
+	if f, ok := lookupFilePool.items[key]; ok {
+		f.refs--
+		if f.refs <= 0 {
+			delete(lookupFilePool.items, key)
+		}
+	}
+}
+
+// lookupFile 从文件加载的共享查找表，文件修改后原子替换
+type lookupFile struct {
+	path     string
+	keyField string
+	// 查找表 *lookupTable
+	table atomic.Value
+	// 文件修改时间和大小
+	modTime time.Time
+	size    int64
+	// 上次检查文件的时间，单位纳秒
+	lastCheck      int64
+	reloadInterval time.Duration
+	reloadLock     sync.Mutex
+	logger         types.Logger
+	//引用计数，由lookupFilePool锁保护
+	refs int
+}
+
+// snapshot 获取当前查找表快照，按照间隔检查文件是否修改
+func (f *lookupFile) snapshot() *lookupTable {
+	f.checkReload()
+	return f.table.Load().(*lookupTable)
+}
+
+// checkReload 按照间隔检查文件是否修改，修改则重新加载，加载失败继续使用原来的查找表
+func (f *lookupFile) checkReload() {
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&f.lastCheck)
+	if now-last < int64(f.reloadInterval) || !atomic.CompareAndSwapInt64(&f.lastCheck, last, now) {
+		return
+	}
+	if err := f.load(); err != nil && f.logger != nil {
+		f.logger.Printf("lookup reload file %s error: %v", f.path, err)
+	}
+}
+
+// load 如果文件修改则加载
+func (f *lookupFile) load() error {
+	f.reloadLock.Lock()
+	defer f.reloadLock.Unlock()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	current, _ := f.table.Load().(*lookupTable)
+	if current != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	var rows map[string]interface{}
+	if strings.EqualFold(filepath.Ext(f.path), ".csv") {
+		rows, err = parseLookupCsv(data, f.keyField)
+	} else {
+		rows, err = parseLookupJson(data, f.keyField)
+	}
+	if err != nil {
+		return err
+	}
+	var version int64 = 1
+	if current != nil {
+		version = current.version + 1
+	}
+	f.table.Store(newLookupTable(rows, version))
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	atomic.StoreInt64(&f.lastCheck, time.Now().UnixNano())
+	return nil
+}
+
+// parseLookupCsv 解析CSV查找表，第一行是列名
+func parseLookupCsv(data []byte, keyField string) (map[string]interface{}, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("csv header not found")
+	}
+	header := records[0]
+	keyIndex := 0
+	if keyField != "" {
+		keyIndex = -1
+		for i, name := range header {
+			if name == keyField {
+				keyIndex = i
+				break
+			}
+		}
+		if keyIndex < 0 {
+			return nil, fmt.Errorf("key field %s not found in csv header", keyField)
+		}
+	}
+	rows := make(map[string]interface{}, len(records)-1)
+	for _, record := range records[1:] {
+		fields := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			if i < len(record) {
+				fields[name] = record[i]
+			}
+		}
+		rows[record[keyIndex]] = fields
+	}
+	return rows, nil
+}
+
+// parseLookupJson 解析JSON查找表，key -> 字段对象，或者对象数组
+func parseLookupJson(data []byte, keyField string) (map[string]interface{}, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var items []map[string]interface{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+		if keyField == "" {
+			keyField = "id"
+		}
+		rows := make(map[string]interface{}, len(items))
+		for _, item := range items {
+			if k, ok := item[keyField]; ok && k != nil {
+				rows[str.ToString(k)] = item
+			}
+		}
+		return rows, nil
+	}
+	var rows map[string]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+)
+
+type lookupResult struct {
+	msg          types.RuleMsg
+	relationType string
+	err          error
+}
+
+// lookupOnMsg 同步执行节点，返回输出
+func lookupOnMsg(node types.Node, deviceId string, data string) lookupResult {
+	var result lookupResult
+	metadata := types.NewMetadata()
+	metadata.PutValue("deviceId", deviceId)
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		result = lookupResult{msg: msg, relationType: relationType, err: err}
+	})
+	node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, metadata, data))
+	return result
+}
+
+// writeLookupFile 先写临时文件再重命名，保证文件原子替换
+func writeLookupFile(t *testing.T, path string, content string, modTime time.Time) {
+	tmp := path + ".tmp"
+	assert.Nil(t, os.WriteFile(tmp, []byte(content), 0644))
+	assert.Nil(t, os.Chtimes(tmp, modTime, modTime))
+	assert.Nil(t, os.Rename(tmp, path))
+}
+
+func TestLookupNode(t *testing.T) {
+	var targetNodeType = "lookup"
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &LookupNode{}, types.Configuration{
+			"source":         LookupSourceInline,
+			"key":            "${metadata.deviceId}",
+			"reloadInterval": 10,
+			"cacheLevel":     LookupCacheLevelChain,
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		_, err := test.CreateAndInitNode(targetNodeType, types.Configuration{"source": "redis"}, Registry)
+		assert.NotNil(t, err)
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"mapping": map[string]string{"site": "site"}}, Registry)
+		assert.NotNil(t, err)
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"source": LookupSourceFile, "file": "./notFound.csv"}, Registry)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Inline", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"data": map[string]interface{}{
+				"dev-1": map[string]interface{}{"site": "sz", "model": "T100", "owner": "tom"},
+				"dev-2": "gateway",
+			},
+			"mapping": map[string]string{
+				"site":  "metadata.site",
+				"model": "msg.device.model",
+				"value": "metadata.kind",
+			},
+		}, Registry)
+		assert.Nil(t, err)
+		result := lookupOnMsg(node, "dev-1", `{"temperature":30}`)
+		assert.Equal(t, types.Success, result.relationType)
+		assert.Equal(t, "sz", result.msg.Metadata.GetValue("site"))
+		assert.Equal(t, "", result.msg.Metadata.GetValue("owner"))
+		assert.Equal(t, `{"device":{"model":"T100"},"temperature":30}`, result.msg.GetData())
+
+		result = lookupOnMsg(node, "dev-2", `{}`)
+		assert.Equal(t, "gateway", result.msg.Metadata.GetValue("kind"))
+
+		//没有查找到
+		result = lookupOnMsg(node, "dev-3", `{}`)
+		assert.Equal(t, RelationMiss, result.relationType)
+
+		//消息负荷不是JSON
+		result = lookupOnMsg(node, "dev-1", `temperature=30`)
+		assert.Equal(t, types.Failure, result.relationType)
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"data": map[string]interface{}{
+				"dev-1": map[string]interface{}{"site": "sz"},
+			},
+			"defaults": map[string]string{
+				"metadata.site": "unknown",
+				"msg.site":      "unknown",
+			},
+		}, Registry)
+		assert.Nil(t, err)
+		//没有配置mapping，所有字段合并到元数据
+		result := lookupOnMsg(node, "dev-1", `{}`)
+		assert.Equal(t, types.Success, result.relationType)
+		assert.Equal(t, "sz", result.msg.Metadata.GetValue("site"))
+		assert.Equal(t, `{}`, result.msg.GetData())
+
+		result = lookupOnMsg(node, "dev-3", `{}`)
+		assert.Equal(t, types.Success, result.relationType)
+		assert.Equal(t, "unknown", result.msg.Metadata.GetValue("site"))
+		assert.Equal(t, `{"site":"unknown"}`, result.msg.GetData())
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"source":      LookupSourceCache,
+			"cacheLevel":  LookupCacheLevelGlobal,
+			"cachePrefix": "device:",
+		}, Registry)
+		assert.Nil(t, err)
+		var result lookupResult
+		ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			result = lookupResult{msg: msg, relationType: relationType, err: err}
+		})
+		assert.Nil(t, ctx.GlobalCache().Set("device:dev-1", `{"site":"gz"}`, ""))
+		metadata := types.NewMetadata()
+		metadata.PutValue("deviceId", "dev-1")
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, metadata, `{}`))
+		assert.Equal(t, types.Success, result.relationType)
+		assert.Equal(t, "gz", result.msg.Metadata.GetValue("site"))
+
+		metadata.PutValue("deviceId", "dev-2")
+		node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, metadata, `{}`))
+		assert.Equal(t, RelationMiss, result.relationType)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		dir := t.TempDir()
+		csvPath := filepath.Join(dir, "devices.csv")
+		writeLookupFile(t, csvPath, "model,deviceId,site\nT100,dev-1,sz\nT200,dev-2,gz\n", time.Now())
+		jsonPath := filepath.Join(dir, "devices.json")
+		writeLookupFile(t, jsonPath, `[{"id":"dev-1","site":"sz","floor":3}]`, time.Now())
+
+		csvNode, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"source":   LookupSourceFile,
+			"file":     csvPath,
+			"keyField": "deviceId",
+			"mapping":  map[string]string{"site": "metadata.site", "model": "metadata.model"},
+		}, Registry)
+		assert.Nil(t, err)
+		defer csvNode.Destroy()
+		result := lookupOnMsg(csvNode, "dev-2", `{}`)
+		assert.Equal(t, types.Success, result.relationType)
+		assert.Equal(t, "gz", result.msg.Metadata.GetValue("site"))
+		assert.Equal(t, "T200", result.msg.Metadata.GetValue("model"))
+		assert.Equal(t, "1", result.msg.Metadata.GetValue(KeyLookupVersion))
+
+		jsonNode, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"source":  LookupSourceFile,
+			"file":    jsonPath,
+			"mapping": map[string]string{"floor": "msg.floor"},
+		}, Registry)
+		assert.Nil(t, err)
+		result = lookupOnMsg(jsonNode, "dev-1", `{}`)
+		assert.Equal(t, `{"floor":3}`, result.msg.GetData())
+		jsonNode.Destroy()
+
+		//相同路径的节点共享同一个查找表
+		otherNode, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"source":   LookupSourceFile,
+			"file":     csvPath,
+			"keyField": "deviceId",
+		}, Registry)
+		assert.Nil(t, err)
+		key := csvNode.(*LookupNode).fileKey
+		lookupFilePool.Lock()
+		assert.Equal(t, 2, lookupFilePool.items[key].refs)
+		assert.Equal(t, 1, len(lookupFilePool.items))
+		lookupFilePool.Unlock()
+		otherNode.Destroy()
+		lookupFilePool.Lock()
+		assert.Equal(t, 1, lookupFilePool.items[key].refs)
+		lookupFilePool.Unlock()
+	})
+
+	t.Run("ReloadWhileProcessing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "devices.csv")
+		modTime := time.Now().Add(-time.Hour)
+		writeTable := func(v int) {
+			var sb strings.Builder
+			sb.WriteString("deviceId,site,model\n")
+			for i := 0; i < 50; i++ {
+				sb.WriteString(fmt.Sprintf("dev-%d,site-%d,model-%d\n", i, v, v))
+			}
+			writeLookupFile(t, path, sb.String(), modTime.Add(time.Duration(v)*time.Second))
+		}
+		writeTable(0)
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"source": LookupSourceFile,
+			"file":   path,
+		}, Registry)
+		assert.Nil(t, err)
+		defer node.Destroy()
+		//每条消息都检查文件是否修改
+		node.(*LookupNode).file.reloadInterval = 0
+
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		var inconsistent []string
+		stop := make(chan struct{})
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					result := lookupOnMsg(node, fmt.Sprintf("dev-%d", (g+i)%50), `{}`)
+					site := strings.TrimPrefix(result.msg.Metadata.GetValue("site"), "site-")
+					model := strings.TrimPrefix(result.msg.Metadata.GetValue("model"), "model-")
+					if result.relationType != types.Success || site != model {
+						lock.Lock()
+						inconsistent = append(inconsistent, result.relationType+":"+site+":"+model)
+						lock.Unlock()
+					}
+				}
+			}(g)
+		}
+		for v := 1; v <= 20; v++ {
+			writeTable(v)
+			time.Sleep(time.Millisecond * 5)
+		}
+		close(stop)
+		wg.Wait()
+		assert.Equal(t, 0, len(inconsistent))
+
+		result := lookupOnMsg(node, "dev-1", `{}`)
+		assert.Equal(t, "site-20", result.msg.Metadata.GetValue("site"))
+		assert.True(t, node.(*LookupNode).file.table.Load().(*lookupTable).version > 1)
+	})
+}
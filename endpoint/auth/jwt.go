@@ -0,0 +1,367 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package auth provides endpoint.TokenValidator implementations shared by the
+// rest, websocket and MQTT endpoints.
+//
+// JwtValidator validates JSON Web Tokens signed with HS256 or RS256. RS256 keys can be
+// configured as a PEM public key or fetched from a JWKS URL, which is cached.
+//
+// Example:
+//
+//	validator, err := auth.NewJwtValidator(auth.JwtConfig{Secret: "secret"})
+//	restEndpoint.SetTokenValidator(validator)
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	// defaultJwksCacheTtl JWKS默认缓存时间
+	defaultJwksCacheTtl = 10 * time.Minute
+	// jwksMinRefreshInterval 找不到kid时，刷新JWKS的最小间隔，防止被恶意令牌频繁触发
+	jwksMinRefreshInterval = 10 * time.Second
+)
+
+var _ endpoint.TokenValidator = (*JwtValidator)(nil)
+
+// JwtConfig JWT校验器配置
+type JwtConfig struct {
+	// Secret HS256签名密钥
+	Secret string `json:"secret" secret:"true"`
+	// PublicKey RS256 PEM格式公钥
+	PublicKey string `json:"publicKey"`
+	// JwksUrl RS256 JWKS地址，根据令牌头部的kid选择公钥
+	JwksUrl string `json:"jwksUrl"`
+	// JwksCacheTtl JWKS缓存时间(秒)，默认600秒
+	JwksCacheTtl int `json:"jwksCacheTtl"`
+	// Issuer 如果不为空，校验iss
+	Issuer string `json:"issuer"`
+	// Audience 如果不为空，校验aud
+	Audience string `json:"audience"`
+	// TenantClaim 租户字段，默认tenant
+	TenantClaim string `json:"tenantClaim"`
+	// RolesClaim 角色字段，默认roles。支持数组或者以空格、逗号分隔的字符串
+	RolesClaim string `json:"rolesClaim"`
+	// Leeway 校验exp、nbf允许的时钟误差(秒)
+	Leeway int `json:"leeway"`
+}
+
+// JwtValidator JWT令牌校验器，支持HS256/RS256
+type JwtValidator struct {
+	config JwtConfig
+	secret []byte
+	rsaKey *rsa.PublicKey
+	// HttpClient 获取JWKS的http客户端
+	HttpClient *http.Client
+	jwksKeys   map[string]*rsa.PublicKey
+	jwksExpire time.Time
+	jwksLoaded time.Time
+	locker     sync.RWMutex
+	// now 获取当前时间，用于测试
+	now func() time.Time
+}
+
+// NewJwtValidator 创建JWT令牌校验器
+func NewJwtValidator(config JwtConfig) (*JwtValidator, error) {
+	if config.Secret == "" && config.PublicKey == "" && config.JwksUrl == "" {
+		return nil, errors.New("jwt validator requires secret, publicKey or jwksUrl")
+	}
+	if config.TenantClaim == "" {
+		config.TenantClaim = "tenant"
+	}
+	if config.RolesClaim == "" {
+		config.RolesClaim = "roles"
+	}
+	v := &JwtValidator{
+		config:     config,
+		HttpClient: &http.Client{Timeout: 10 * time.Second},
+		now:        time.Now,
+	}
+	if config.Secret != "" {
+		v.secret = []byte(config.Secret)
+	}
+	if config.PublicKey != "" {
+		key, err := parseRsaPublicKey(config.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		v.rsaKey = key
+	}
+	return v, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Validate 校验令牌，返回令牌中的用户信息
+func (v *JwtValidator) Validate(token string, transportMeta map[string]string) (endpoint.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return endpoint.Principal{}, fmt.Errorf("%w: malformed token", endpoint.ErrUnauthorized)
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return endpoint.Principal{}, fmt.Errorf("%w: invalid header: %v", endpoint.ErrUnauthorized, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return endpoint.Principal{}, fmt.Errorf("%w: invalid signature encoding", endpoint.ErrUnauthorized)
+	}
+	if err = v.verify(header, parts[0]+"."+parts[1], signature); err != nil {
+		return endpoint.Principal{}, fmt.Errorf("%w: %v", endpoint.ErrUnauthorized, err)
+	}
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return endpoint.Principal{}, fmt.Errorf("%w: invalid claims: %v", endpoint.ErrUnauthorized, err)
+	}
+	if err = v.checkClaims(claims); err != nil {
+		return endpoint.Principal{}, fmt.Errorf("%w: %v", endpoint.ErrUnauthorized, err)
+	}
+	return endpoint.Principal{
+		Id:     claimString(claims, "sub"),
+		Tenant: claimString(claims, v.config.TenantClaim),
+		Roles:  claimStrings(claims, v.config.RolesClaim),
+	}, nil
+}
+
+// verify 校验签名，签名算法必须和配置的密钥类型匹配，防止算法混淆攻击
+func (v *JwtValidator) verify(header jwtHeader, signingInput string, signature []byte) error {
+	switch header.Alg {
+	case AlgHS256:
+		if v.secret == nil {
+			return errors.New("HS256 is not allowed")
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("signature is invalid")
+		}
+		return nil
+	case AlgRS256:
+		key, err := v.rsaPublicKey(header.Kid)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("signature is invalid")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported alg: %s", header.Alg)
+	}
+}
+
+// rsaPublicKey 获取RS256公钥，优先使用JWKS
+func (v *JwtValidator) rsaPublicKey(kid string) (*rsa.PublicKey, error) {
+	if v.config.JwksUrl == "" {
+		if v.rsaKey == nil {
+			return nil, errors.New("RS256 is not allowed")
+		}
+		return v.rsaKey, nil
+	}
+	now := v.now()
+	v.locker.RLock()
+	key, ok := v.jwksKeys[kid]
+	expired := now.After(v.jwksExpire)
+	canRefresh := now.Sub(v.jwksLoaded) >= jwksMinRefreshInterval
+	v.locker.RUnlock()
+	if ok && !expired {
+		return key, nil
+	}
+	if expired || canRefresh {
+		if err := v.loadJwks(); err != nil {
+			//刷新失败，继续使用缓存的公钥
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+		v.locker.RLock()
+		key, ok = v.jwksKeys[kid]
+		v.locker.RUnlock()
+	}
+	if !ok {
+		if v.rsaKey != nil {
+			return v.rsaKey, nil
+		}
+		return nil, fmt.Errorf("key not found: %s", kid)
+	}
+	return key, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// loadJwks 获取JWKS并缓存RSA公钥
+func (v *JwtValidator) loadJwks() error {
+	resp, err := v.HttpClient.Get(v.config.JwksUrl)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch jwks failed, status code: %d", resp.StatusCode)
+	}
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, item := range jwks.Keys {
+		if item.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(item.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(item.E)
+		if err != nil {
+			continue
+		}
+		keys[item.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	ttl := defaultJwksCacheTtl
+	if v.config.JwksCacheTtl > 0 {
+		ttl = time.Duration(v.config.JwksCacheTtl) * time.Second
+	}
+	now := v.now()
+	v.locker.Lock()
+	defer v.locker.Unlock()
+	v.jwksKeys = keys
+	v.jwksLoaded = now
+	v.jwksExpire = now.Add(ttl)
+	return nil
+}
+
+// checkClaims 校验exp、nbf、iss、aud
+func (v *JwtValidator) checkClaims(claims map[string]interface{}) error {
+	now := v.now().Unix()
+	leeway := int64(v.config.Leeway)
+	if exp, ok := claims["exp"].(float64); ok && now > int64(exp)+leeway {
+		return errors.New("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now+leeway < int64(nbf) {
+		return errors.New("token is not valid yet")
+	}
+	if v.config.Issuer != "" && claimString(claims, "iss") != v.config.Issuer {
+		return errors.New("issuer is invalid")
+	}
+	if v.config.Audience != "" {
+		found := false
+		for _, aud := range claimStrings(claims, "aud") {
+			if aud == v.config.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("audience is invalid")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func claimString(claims map[string]interface{}, key string) string {
+	if v, ok := claims[key]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func claimStrings(claims map[string]interface{}, key string) []string {
+	switch v := claims[key].(type) {
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case string:
+		return strings.FieldsFunc(v, func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+	default:
+		return nil
+	}
+}
+
+// parseRsaPublicKey 解析PEM格式RSA公钥，支持PKIX、PKCS1和证书格式
+func parseRsaPublicKey(pemStr string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, errors.New("invalid PEM public key")
+	}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+		return nil, errors.New("certificate public key is not RSA")
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+		return nil, errors.New("public key is not RSA")
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func signToken(t *testing.T, header, claims map[string]interface{}, sign func(input []byte) []byte) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(input)))
+}
+
+func hs256(secret string) func(input []byte) []byte {
+	return func(input []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+}
+
+func rs256(t *testing.T, key *rsa.PrivateKey) func(input []byte) []byte {
+	return func(input []byte) []byte {
+		digest := sha256.Sum256(input)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		assert.Nil(t, err)
+		return sig
+	}
+}
+
+func TestJwtValidatorHS256(t *testing.T) {
+	_, err := NewJwtValidator(JwtConfig{})
+	assert.NotNil(t, err)
+
+	v, err := NewJwtValidator(JwtConfig{Secret: "secret", Issuer: "rulego", Audience: "api"})
+	assert.Nil(t, err)
+	header := map[string]interface{}{"alg": AlgHS256, "typ": "JWT"}
+	claims := map[string]interface{}{
+		"sub":    "u1",
+		"tenant": "t1",
+		"roles":  []string{"admin", "dev"},
+		"iss":    "rulego",
+		"aud":    []string{"api"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+	principal, err := v.Validate(signToken(t, header, claims, hs256("secret")), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "u1", principal.Id)
+	assert.Equal(t, "t1", principal.Tenant)
+	assert.Equal(t, []string{"admin", "dev"}, principal.Roles)
+
+	_, err = v.Validate(signToken(t, header, claims, hs256("other")), nil)
+	assert.True(t, errors.Is(err, endpoint.ErrUnauthorized))
+
+	_, err = v.Validate("a.b", nil)
+	assert.True(t, errors.Is(err, endpoint.ErrUnauthorized))
+
+	_, err = v.Validate(signToken(t, map[string]interface{}{"alg": "none"}, claims, func(input []byte) []byte { return nil }), nil)
+	assert.NotNil(t, err)
+
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = v.Validate(signToken(t, header, claims, hs256("secret")), nil)
+	assert.NotNil(t, err)
+
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["aud"] = "other"
+	_, err = v.Validate(signToken(t, header, claims, hs256("secret")), nil)
+	assert.NotNil(t, err)
+
+	claims["aud"] = "api"
+	claims["iss"] = "other"
+	_, err = v.Validate(signToken(t, header, claims, hs256("secret")), nil)
+	assert.NotNil(t, err)
+}
+
+func TestJwtValidatorRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Nil(t, err)
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	v, err := NewJwtValidator(JwtConfig{PublicKey: publicKey, RolesClaim: "scope"})
+	assert.Nil(t, err)
+	header := map[string]interface{}{"alg": AlgRS256}
+	claims := map[string]interface{}{"sub": "u2", "scope": "read write"}
+	principal, err := v.Validate(signToken(t, header, claims, rs256(t, key)), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "u2", principal.Id)
+	assert.Equal(t, []string{"read", "write"}, principal.Roles)
+
+	//HS256 使用公钥作为密钥伪造的令牌
+	_, err = v.Validate(signToken(t, map[string]interface{}{"alg": AlgHS256}, claims, hs256(publicKey)), nil)
+	assert.NotNil(t, err)
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, err = v.Validate(signToken(t, header, claims, rs256(t, otherKey)), nil)
+	assert.NotNil(t, err)
+}
+
+func TestJwtValidatorJwks(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer server.Close()
+
+	v, err := NewJwtValidator(JwtConfig{JwksUrl: server.URL, JwksCacheTtl: 60})
+	assert.Nil(t, err)
+	claims := map[string]interface{}{"sub": "u3"}
+	token := signToken(t, map[string]interface{}{"alg": AlgRS256, "kid": "k1"}, claims, rs256(t, key))
+	for i := 0; i < 3; i++ {
+		principal, err := v.Validate(token, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "u3", principal.Id)
+	}
+	//使用缓存
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	//未知kid，在最小刷新间隔内不重复请求
+	_, err = v.Validate(signToken(t, map[string]interface{}{"alg": AlgRS256, "kid": "k2"}, claims, rs256(t, key)), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	//缓存过期后重新获取
+	v.now = func() time.Time {
+		return time.Now().Add(2 * time.Minute)
+	}
+	_, err = v.Validate(token, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
@@ -95,6 +95,7 @@ package endpoint
 
 import (
 	"errors"
+	"fmt"
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/api/types/endpoint"
 	"github.com/rulego/rulego/builtin/processor"
@@ -118,6 +119,7 @@ func NewRouter(opts ...endpoint.RouterOption) endpoint.Router {
 
 // Ensure DynamicEndpoint implements the DynamicEndpoint interface.
 var _ endpoint.DynamicEndpoint = (*DynamicEndpoint)(nil)
+var _ endpoint.TokenValidatorSetter = (*DynamicEndpoint)(nil)
 
 // DynamicEndpoint represents a dynamic endpoint with additional properties and methods.
 type DynamicEndpoint struct {
@@ -134,6 +136,10 @@ type DynamicEndpoint struct {
 	routerOpts []endpoint.RouterOption
 	// Restart indicates whether the endpoint should be restarted.
 	restart bool
+	// tokenValidator is the token validator for the endpoint.
+	tokenValidator endpoint.TokenValidator
+	// onEvent is the event listener, kept across endpoint restarts.
+	onEvent endpoint.OnEvent
 	locker  sync.RWMutex
 }
 
@@ -193,6 +199,23 @@ func (e *DynamicEndpoint) SetInterceptors(interceptors ...endpoint.Process) {
 	e.interceptors = interceptors
 }
 
+// SetTokenValidator sets the token validator for the DynamicEndpoint.
+func (e *DynamicEndpoint) SetTokenValidator(validator endpoint.TokenValidator) {
+	e.tokenValidator = validator
+	if setter, ok := e.Endpoint.(endpoint.TokenValidatorSetter); ok {
+		setter.SetTokenValidator(validator)
+	}
+}
+
+// SetOnEvent sets the event listener for the DynamicEndpoint.
+// It is kept when the endpoint is restarted by a reload.
+func (e *DynamicEndpoint) SetOnEvent(onEvent endpoint.OnEvent) {
+	e.onEvent = onEvent
+	if e.Endpoint != nil {
+		e.Endpoint.SetOnEvent(onEvent)
+	}
+}
+
 // AddInterceptors adds interceptors to the DynamicEndpoint.
 func (e *DynamicEndpoint) AddInterceptors(interceptors ...endpoint.Process) {
 	e.interceptors = append(e.interceptors, interceptors...)
@@ -274,7 +297,14 @@ func (e *DynamicEndpoint) AddRouterFromDef(routerDsl *types.RouterDsl) (string,
 		if p, ok := processor.InBuiltins.Get(item); ok {
 			from.Process(p)
 		} else {
-			return "", errors.New("processor not found: " + item)
+			return "", routerError(routerDsl, errors.New("processor not found: "+item))
+		}
+	}
+	for _, item := range routerDsl.From.ProcessorDefs {
+		if p, err := processor.InBuiltins.Build(item); err == nil {
+			from.Process(p)
+		} else {
+			return "", routerError(routerDsl, err)
 		}
 	}
 	if routerDsl.To.Path != "" {
@@ -283,7 +313,14 @@ func (e *DynamicEndpoint) AddRouterFromDef(routerDsl *types.RouterDsl) (string,
 			if p, ok := processor.OutBuiltins.Get(item); ok {
 				to.Process(p)
 			} else {
-				return "", errors.New("processor not found: " + item)
+				return "", routerError(routerDsl, errors.New("processor not found: "+item))
+			}
+		}
+		for _, item := range routerDsl.To.ProcessorDefs {
+			if p, err := processor.OutBuiltins.Build(item); err == nil {
+				to.Process(p)
+			} else {
+				return "", routerError(routerDsl, err)
 			}
 		}
 		if routerDsl.To.Wait {
@@ -370,7 +407,13 @@ func (e *DynamicEndpoint) newEndpoint(dsl types.EndpointDsl) error {
 		if e.id == "" {
 			e.id = ep.Id()
 		}
+		if e.onEvent != nil {
+			ep.SetOnEvent(e.onEvent)
+		}
 		e.AddInterceptors(e.interceptors...)
+		if e.tokenValidator != nil {
+			e.SetTokenValidator(e.tokenValidator)
+		}
 		for _, item := range dsl.Routers {
 			if _, err := e.AddRouterFromDef(item); err != nil {
 				return err
@@ -384,21 +427,63 @@ func (e *DynamicEndpoint) newEndpoint(dsl types.EndpointDsl) error {
 				return errors.New("processor not found: " + item)
 			}
 		}
+		for _, item := range dsl.ProcessorDefs {
+			if p, err := processor.InBuiltins.Build(item); err == nil {
+				e.AddInterceptors(p)
+			} else {
+				return err
+			}
+		}
 		if e.restart {
-			return ep.Start()
+			return e.Start()
 		} else {
 			return nil
 		}
 	}
 }
 
+// Start starts the endpoint, reports its health and publishes the endpoint started event.
+func (e *DynamicEndpoint) Start() error {
+	if e.Endpoint == nil {
+		return errors.New("endpoint not initialized")
+	}
+	if err := e.Endpoint.Start(); err != nil {
+		e.ruleConfig.ReportHealth(types.HealthEndpointPrefix+e.id, types.HealthUnhealthy, err.Error())
+		return err
+	}
+	e.ruleConfig.ReportHealth(types.HealthEndpointPrefix+e.id, types.HealthHealthy, "")
+	e.ruleConfig.PublishEvent(types.EventEndpointStarted, e.id, map[string]interface{}{"type": e.definition.Type})
+	return nil
+}
+
+// Destroy stops the endpoint, removes its health and publishes the endpoint stopped event.
+func (e *DynamicEndpoint) Destroy() {
+	if e.Endpoint == nil {
+		return
+	}
+	e.Endpoint.Destroy()
+	e.ruleConfig.RemoveHealth(types.HealthEndpointPrefix + e.id)
+	e.ruleConfig.PublishEvent(types.EventEndpointStopped, e.id, map[string]interface{}{"type": e.definition.Type})
+}
+
 // reloadEndpoint reloads the Endpoint with the provided DSL.
+// The endpoint is restarted only if the restart flag is set or the listener-level definition changed,
+// otherwise the routers are updated in place and the live connections are kept.
 func (e *DynamicEndpoint) reloadEndpoint(def types.EndpointDsl) error {
 	if e.Endpoint != nil && (e.restart || needRestart(e.definition, def)) {
-		e.Endpoint.Destroy()
+		e.Destroy()
 		e.Endpoint = nil
 		e.restart = true
-		return e.newEndpoint(def)
+		if err := e.newEndpoint(def); err != nil {
+			return err
+		}
+		e.fireReloadEvent(endpoint.EventReloadRestart, nil, nil, nil)
+		return nil
+	}
+	for _, item := range def.Routers {
+		if item == nil {
+			return errors.New("routerDsl cannot be nil")
+		}
 	}
 	// Check for changes in routers
 	added, removed, modified := checkRouterChanges(e.definition.Routers, def.Routers)
@@ -416,9 +501,28 @@ func (e *DynamicEndpoint) reloadEndpoint(def types.EndpointDsl) error {
 		}
 	}
 	e.definition = def
+	e.fireReloadEvent(endpoint.EventReloadRouters, routerIds(added), routerIds(removed), routerIds(modified))
 	return nil
 }
 
+// fireReloadEvent notifies the event listener and publishes the endpoint reloaded event.
+func (e *DynamicEndpoint) fireReloadEvent(eventName string, added, removed, modified []string) {
+	if e.onEvent != nil {
+		if eventName == endpoint.EventReloadRestart {
+			e.onEvent(eventName, e.id)
+		} else {
+			e.onEvent(eventName, e.id, added, removed, modified)
+		}
+	}
+	e.ruleConfig.PublishEvent(types.EventEndpointReloaded, e.id, map[string]interface{}{
+		"type":     e.definition.Type,
+		"restart":  eventName == endpoint.EventReloadRestart,
+		"added":    added,
+		"removed":  removed,
+		"modified": modified,
+	})
+}
+
 // unmarshal converts the provided byte slice into an EndpointDsl.
 func (e *DynamicEndpoint) unmarshal(def []byte) (types.EndpointDsl, error) {
 	var dsl types.EndpointDsl
@@ -432,12 +536,46 @@ func (e *DynamicEndpoint) unmarshal(def []byte) (types.EndpointDsl, error) {
 	return dsl, nil
 }
 
+// routerError adds the router ID to the error of adding a router
+func routerError(routerDsl *types.RouterDsl, err error) error {
+	id := routerDsl.Id
+	if id == "" {
+		id = routerDsl.From.Path
+	}
+	return fmt.Errorf("router %s: %w", id, err)
+}
+
 // needRestart determines whether the endpoint needs to be restarted based on the old and new EndpointBaseInfo
 func needRestart(old, new types.EndpointDsl) bool {
 	if old.Type != new.Type {
 		return true
 	}
-	return !reflect.DeepEqual(old.Configuration, new.Configuration) || !reflect.DeepEqual(old.Processors, new.Processors)
+	return !reflect.DeepEqual(listenerConfiguration(old.Configuration), listenerConfiguration(new.Configuration)) ||
+		!reflect.DeepEqual(old.Processors, new.Processors) || !reflect.DeepEqual(old.ProcessorDefs, new.ProcessorDefs)
+}
+
+// listenerConfiguration returns the configuration without the injected rule chain definition,
+// which changes on every rule chain reload and does not affect the listener.
+func listenerConfiguration(configuration types.Configuration) types.Configuration {
+	if _, ok := configuration[types.NodeConfigurationKeyRuleChainDefinition]; !ok {
+		return configuration
+	}
+	result := make(types.Configuration, len(configuration))
+	for k, v := range configuration {
+		if k != types.NodeConfigurationKeyRuleChainDefinition {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// routerIds returns the ids of the routers.
+func routerIds(routers []*types.RouterDsl) []string {
+	var ids []string
+	for _, item := range routers {
+		ids = append(ids, item.Id)
+	}
+	return ids
 }
 
 // checkRouterChanges checks for added, removed, and modified routers in a list of RouterDsl.
@@ -449,10 +587,14 @@ func checkRouterChanges(oldRouters, newRouters []*types.RouterDsl) (added, remov
 
 	// Convert the old and new routers into maps using their ID as the key.
 	for _, r := range oldRouters {
-		oldMap[r.Id] = r
+		if r != nil {
+			oldMap[r.Id] = r
+		}
 	}
 	for _, r := range newRouters {
-		newMap[r.Id] = r
+		if r != nil {
+			newMap[r.Id] = r
+		}
 	}
 
 	// Check for routers that are new in the newMap but not present in the oldMap.
@@ -18,12 +18,18 @@ package endpoint
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/builtin/processor"
+	"github.com/rulego/rulego/endpoint/rest"
 	"github.com/rulego/rulego/engine"
 	"github.com/rulego/rulego/test"
 	"github.com/rulego/rulego/test/assert"
 	"github.com/rulego/rulego/utils/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"strings"
@@ -83,3 +89,186 @@ func TestDynamicEndpoint(t *testing.T) {
 	
 	ep.Destroy()
 }
+
+func TestDynamicEndpointEvents(t *testing.T) {
+	bus := engine.NewEventBus()
+	sub, err := bus.Subscribe("endpoint.*", 10)
+	assert.Nil(t, err)
+	config := engine.NewConfig(types.WithDefaultPool(), types.WithEventBus(bus))
+	ep, err := NewFromDsl([]byte(`{"id":"eventEndpoint","type":"http","configuration":{"server":":9098"}}`),
+		endpoint.DynamicEndpointOptions.WithConfig(config))
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	ep.Destroy()
+
+	for _, expected := range []string{types.EventEndpointStarted, types.EventEndpointStopped} {
+		select {
+		case event := <-sub.C():
+			assert.Equal(t, expected, event.Type)
+			assert.Equal(t, "eventEndpoint", event.Subject)
+			assert.Equal(t, "http", event.Data["type"])
+		case <-time.After(time.Second):
+			t.Fatal("event timeout")
+		}
+	}
+}
+
+func TestDynamicEndpointTokenValidator(t *testing.T) {
+	validator := endpoint.TokenValidatorFunc(func(token string, transportMeta map[string]string) (endpoint.Principal, error) {
+		return endpoint.Principal{Id: token}, nil
+	})
+	ep, err := NewFromDsl([]byte(`{"id":"authEndpoint","type":"http","configuration":{"server":":9099"}}`),
+		endpoint.DynamicEndpointOptions.WithConfig(engine.NewConfig(types.WithDefaultPool())),
+		endpoint.DynamicEndpointOptions.WithTokenValidator(validator))
+	assert.Nil(t, err)
+	defer ep.Destroy()
+	//校验器通过 TokenValidatorSetter 设置到目标端点
+	target, ok := ep.Target().(interface {
+		Authenticate(token string, transportMeta map[string]string) (*endpoint.Principal, error)
+	})
+	assert.True(t, ok)
+	_, err = target.Authenticate("", nil)
+	assert.True(t, errors.Is(err, endpoint.ErrUnauthorized))
+	principal, err := target.Authenticate("u01", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "u01", principal.Id)
+}
+
+func TestDynamicEndpointReloadEvents(t *testing.T) {
+	var events []string
+	var params [][]interface{}
+	onEvent := func(eventName string, p ...interface{}) {
+		if eventName == endpoint.EventReloadRouters || eventName == endpoint.EventReloadRestart {
+			events = append(events, eventName)
+			params = append(params, p)
+		}
+	}
+	dsl := `{"id":"reloadEndpoint","type":"http","configuration":{"server":"%s"},"routers":[%s]}`
+	router := `{"id":"%s","params":["GET"],"from":{"path":"/api/%s"},"to":{"path":"reloadChain"}}`
+	ep, err := NewFromDsl([]byte(fmt.Sprintf(dsl, ":9153", fmt.Sprintf(router, "r1", "r1"))),
+		endpoint.DynamicEndpointOptions.WithOnEvent(onEvent))
+	assert.Nil(t, err)
+	defer ep.Destroy()
+	target := ep.Target()
+
+	//只修改路由
+	err = ep.Reload([]byte(fmt.Sprintf(dsl, ":9153", fmt.Sprintf(router, "r2", "r2"))))
+	assert.Nil(t, err)
+	assert.True(t, target == ep.Target())
+	//注入的规则链定义不影响对比
+	ep.Definition().Configuration[types.NodeConfigurationKeyRuleChainDefinition] = &types.RuleChain{}
+	err = ep.Reload([]byte(fmt.Sprintf(dsl, ":9153", fmt.Sprintf(router, "r2", "r2"))))
+	assert.Nil(t, err)
+	assert.True(t, target == ep.Target())
+
+	//修改监听地址
+	err = ep.Reload([]byte(fmt.Sprintf(dsl, ":9154", fmt.Sprintf(router, "r2", "r2"))))
+	assert.Nil(t, err)
+	assert.False(t, target == ep.Target())
+
+	assert.Equal(t, []string{endpoint.EventReloadRouters, endpoint.EventReloadRouters, endpoint.EventReloadRestart}, events)
+	assert.Equal(t, []interface{}{"reloadEndpoint", []string{"r2"}, []string{"r1"}, []string(nil)}, params[0])
+	assert.Equal(t, []interface{}{"reloadEndpoint", []string(nil), []string(nil), []string(nil)}, params[1])
+	assert.Equal(t, []interface{}{"reloadEndpoint"}, params[2])
+}
+
+func TestDynamicEndpointProcessorCondition(t *testing.T) {
+	processor.InBuiltins.Register("testAuth", func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		if exchange.In.Headers().Get("Authorization") != "ok" {
+			exchange.Out.SetStatusCode(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	})
+	processor.InBuiltins.Register("testTenant", func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.In.GetMsg().Metadata.PutValue("tenant", exchange.In.Headers().Get("X-Tenant"))
+		return true
+	})
+	processor.InBuiltins.Register("testFail", func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetError(errors.New("fail"))
+		return false
+	})
+	defer processor.InBuiltins.Unregister("testAuth", "testTenant", "testFail")
+
+	_, err := engine.New("processorCondTest", []byte(`{"ruleChain":{"id":"processorCondTest"},"metadata":{"nodes":[{"id":"s1","type":"jsTransform","configuration":{"jsScript":"return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}]}}`))
+	assert.Nil(t, err)
+	defer engine.Del("processorCondTest")
+
+	routerDsl := `{
+	  "id": "%s",
+	  "params": ["POST"],
+	  "from": {
+		"path": "%s",
+		"processors": ["setJsonDataType"],
+		"processorDefs": [
+		  {"name": "testAuth", "condition": "!(path startsWith '/public/')"},
+		  {"name": "testTenant", "condition": "'X-Tenant' in headers"},
+		  {"name": "testFail", "continueOnError": true}
+		]
+	  },
+	  "to": {"path": "chain:processorCondTest", "wait": true, "processors": ["metadataToHeaders", "responseToBody"]}
+	}`
+	dsl := fmt.Sprintf(`{"id":"processorCondEndpoint","type":"http","configuration":{"server":":9099"},"routers":[%s,%s]}`,
+		fmt.Sprintf(routerDsl, "public", "/public/info"), fmt.Sprintf(routerDsl, "private", "/private/info"))
+	ep, err := NewFromDsl([]byte(dsl), endpoint.DynamicEndpointOptions.WithConfig(engine.NewConfig(types.WithDefaultPool())))
+	assert.Nil(t, err)
+	defer ep.Destroy()
+
+	//条件和错误策略可以往返编码
+	var def types.EndpointDsl
+	assert.Nil(t, json.Unmarshal(ep.DSL(), &def))
+	assert.Equal(t, []string{"setJsonDataType"}, def.Routers[0].From.Processors)
+	processors := def.Routers[0].From.ProcessorDefs
+	assert.Equal(t, 3, len(processors))
+	assert.Equal(t, types.ProcessorDsl{Name: "testAuth", Condition: "!(path startsWith '/public/')"}, processors[0])
+	assert.Equal(t, types.ProcessorDsl{Name: "testFail", ContinueOnError: true}, processors[2])
+	assert.True(t, strings.Contains(string(ep.DSL()), `"processors":["metadataToHeaders","responseToBody"]`))
+
+	handler := ep.Target().(*rest.Rest).Router()
+	serve := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", path, strings.NewReader(`{"a":1}`))
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	w := serve("/public/info", map[string]string{"X-Tenant": "t1"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "t1", w.Header().Get("tenant"))
+	assert.Equal(t, `{"a":1}`, w.Body.String())
+
+	w = serve("/private/info", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serve("/private/info", map[string]string{"Authorization": "ok"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get("tenant"))
+
+	//表达式错误在添加路由时按路由报告
+	err = ep.AddOrReloadRouter([]byte(`{"id":"bad","params":["POST"],"from":{"path":"/bad","processorDefs":[{"name":"testAuth","condition":"(("}]}}`))
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "router bad: invalid processor condition"))
+	err = ep.AddOrReloadRouter([]byte(`{"id":"notFound","params":["POST"],"from":{"path":"/notFound","processors":["xx"]}}`))
+	assert.Equal(t, "router notFound: processor not found: xx", err.Error())
+}
+
+// FuzzNewFromDsl 解析和创建任意endpoint DSL不能panic，不启动服务
+func FuzzNewFromDsl(f *testing.F) {
+	f.Add([]byte(`{"id":"e1","type":"endpoint/http","configuration":{"server":":0"},"routers":[{"id":"r1","params":["POST"],"from":{"path":"/api/{id}/:name/*all"},"to":{"path":"chain:default"}}]}`))
+	f.Add([]byte(`{"type":"endpoint/http","routers":[null]}`))
+	f.Add([]byte(`{"type":"endpoint/http","routers":[{"params":["GET"],"from":{"path":"/a/*all/b"}},{"params":["GET"],"from":{"path":"/a/:id:name"}}]}`))
+	f.Add([]byte(`{"type":"endpoint/http","routers":[{"params":["GET"],"from":{"path":"/a/:id"}},{"params":["GET"],"from":{"path":"/a/{name}"}}]}`))
+	f.Add([]byte(`{"type":"endpoint/ws","routers":[{"from":{"path":"ws"}},{"from":{"path":"/ws/:"}}]}`))
+	f.Add([]byte(`{"type":"endpoint/http","processors":["` + strings.Repeat("x", 1<<16) + `"]}`))
+	f.Add([]byte(strings.Repeat(`{"routers":[`, 1000)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ep, err := NewFromDsl(data)
+		if err != nil {
+			return
+		}
+		_ = ep.Reload(data)
+		ep.Destroy()
+	})
+}
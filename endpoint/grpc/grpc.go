@@ -0,0 +1,697 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpc provides a gRPC endpoint implementation for the RuleGo framework.
+// It serves the generic rulego.RuleService, so that services can call rule chains over gRPC
+// without generating code for each rule chain:
+//   - Invoke: unary call, returns the result of the rule chain, the same way the rest endpoint writes the HTTP response
+//   - InvokeStream: server-streaming call, each end of the rule chain sends one response
+//
+// Each router's from is a route. A call is routed by the gRPC metadata Config.RouteKey, or by the request msgType
+// if the metadata is not set. The deadline of the call is passed to the rule chain context.
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/runtime"
+
+	grpcio "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// Type 组件类型
+const Type = types.EndpointTypePrefix + "grpc"
+
+const (
+	// DefaultRouteKey 默认的路由gRPC元数据key
+	DefaultRouteKey = "route"
+	// MatchAll 匹配所有路由
+	MatchAll = "*"
+	// KeyMethod 调用的gRPC方法全名 metadataKey，例如：/rulego.RuleService/Invoke
+	KeyMethod = "grpcMethod"
+	// KeyRoute 匹配的路由 metadataKey
+	KeyRoute = "route"
+	// KeyRemoteAddr 客户端地址 metadataKey
+	KeyRemoteAddr = "remoteAddr"
+	// HeaderMetadataNamespace gRPC元数据放到msg元数据的命名空间，例如gRPC元数据 trace-id 的 metadataKey 为 header.trace-id
+	HeaderMetadataNamespace = "header"
+	// headerAuthorization 认证令牌gRPC元数据key，不放到msg元数据
+	headerAuthorization = "authorization"
+)
+
+// Endpoint 别名
+type Endpoint = Grpc
+
+// Config gRPC 配置
+type Config struct {
+	// Server 服务监听地址，例如：:9090
+	Server string `json:"server"`
+	// RouteKey 路由gRPC元数据key，调用时该元数据的值用于匹配路由，没有该元数据使用请求的msgType匹配。默认 route
+	RouteKey string `json:"routeKey"`
+	// Reflection 是否开启gRPC反射服务，开启后可以使用grpcurl等工具查看和调用服务
+	Reflection bool `json:"reflection"`
+	// TLS TLS配置，为空不使用TLS。配置了CA则要求客户端提供该CA签发的证书
+	TLS types.TLSConfig `json:"tls"`
+}
+
+func (c Config) routeKey() string {
+	if c.RouteKey == "" {
+		return DefaultRouteKey
+	}
+	return strings.ToLower(c.RouteKey)
+}
+
+// RequestMessage gRPC 请求消息
+type RequestMessage struct {
+	ctx     context.Context
+	request *Request
+	//调用的方法全名
+	method  string
+	route   string
+	headers textproto.MIMEHeader
+	body    []byte
+	msg     *types.RuleMsg
+	err     error
+}
+
+func (r *RequestMessage) Body() []byte {
+	if r.body == nil && r.request != nil {
+		r.body = r.request.Payload
+	}
+	return r.body
+}
+
+// Headers 获取请求的gRPC元数据，key按照MIME规范转换
+func (r *RequestMessage) Headers() textproto.MIMEHeader {
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+		if r.ctx != nil {
+			md, _ := metadata.FromIncomingContext(r.ctx)
+			for k, values := range md {
+				for _, v := range values {
+					r.headers.Add(k, v)
+				}
+			}
+		}
+	}
+	return r.headers
+}
+
+// From 获取匹配的路由
+func (r *RequestMessage) From() string {
+	return r.route
+}
+
+// GetParam 不提供获取参数
+func (r *RequestMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *RequestMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+// GetMsg 把请求转换成规则链消息，请求的元数据、gRPC元数据、方法和客户端地址放到元数据
+func (r *RequestMessage) GetMsg() *types.RuleMsg {
+	if r.msg == nil {
+		msgMetadata := types.NewMetadata()
+		msgType := r.From()
+		dataType := types.JSON
+		if r.request != nil {
+			for k, v := range r.request.Metadata {
+				msgMetadata.PutValue(k, v)
+			}
+			msgType = r.request.MsgType
+			if r.request.DataType != "" {
+				dataType = types.DataType(strings.ToUpper(r.request.DataType))
+			}
+		}
+		if r.ctx != nil {
+			md, _ := metadata.FromIncomingContext(r.ctx)
+			headers := msgMetadata.Sub(HeaderMetadataNamespace)
+			for k, values := range md {
+				if len(values) == 0 || k == headerAuthorization || strings.HasPrefix(k, ":") {
+					continue
+				}
+				headers.PutValue(k, values[0])
+			}
+			if p, ok := peer.FromContext(r.ctx); ok && p.Addr != nil {
+				msgMetadata.PutValue(KeyRemoteAddr, p.Addr.String())
+			}
+		}
+		if r.method != "" {
+			msgMetadata.PutValue(KeyMethod, r.method)
+		}
+		if r.route != "" {
+			msgMetadata.PutValue(KeyRoute, r.route)
+		}
+		var ruleMsg types.RuleMsg
+		if dataType == types.BINARY {
+			ruleMsg = types.NewMsgFromBytes(0, msgType, dataType, msgMetadata, r.Body())
+		} else {
+			ruleMsg = types.NewMsg(0, msgType, dataType, msgMetadata, string(r.Body()))
+		}
+		r.msg = &ruleMsg
+	}
+	return r.msg
+}
+
+// SetStatusCode 不提供设置状态码
+func (r *RequestMessage) SetStatusCode(statusCode int) {
+}
+
+func (r *RequestMessage) SetBody(body []byte) {
+	r.body = body
+}
+
+func (r *RequestMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *RequestMessage) GetError() error {
+	return r.err
+}
+
+// Request 获取gRPC请求
+func (r *RequestMessage) Request() *Request {
+	return r.request
+}
+
+// Context 获取gRPC调用的上下文
+func (r *RequestMessage) Context() context.Context {
+	return r.ctx
+}
+
+// ResponseMessage gRPC 响应消息
+// 一元调用返回最后设置的结果；流式调用每次 SetMsg、SetError、SetBody 都发送一条响应
+type ResponseMessage struct {
+	//流式调用的响应流，一元调用为空
+	stream     grpcio.ServerStream
+	headers    textproto.MIMEHeader
+	body       []byte
+	msg        *types.RuleMsg
+	err        error
+	statusCode int
+	//流式调用是否已经发送响应头
+	headerSent bool
+	//调用结束，不再发送响应
+	closed bool
+	mu     sync.Mutex
+}
+
+func (r *ResponseMessage) Body() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.body
+}
+
+// Headers 响应头，作为gRPC响应元数据发送
+func (r *ResponseMessage) Headers() textproto.MIMEHeader {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+	}
+	return r.headers
+}
+
+func (r *ResponseMessage) From() string {
+	return ""
+}
+
+// GetParam 不提供获取参数
+func (r *ResponseMessage) GetParam(key string) string {
+	return ""
+}
+
+// SetMsg 设置规则链处理结果，流式调用发送该结果
+func (r *ResponseMessage) SetMsg(msg *types.RuleMsg) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msg = msg
+	if msg != nil {
+		r.send(newResponse(msg))
+	}
+}
+
+func (r *ResponseMessage) GetMsg() *types.RuleMsg {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.msg
+}
+
+// SetStatusCode 设置HTTP状态码，拦截器中断处理时转换成gRPC状态码
+func (r *ResponseMessage) SetStatusCode(statusCode int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statusCode = statusCode
+}
+
+// SetBody 设置响应负荷，流式调用发送该负荷
+func (r *ResponseMessage) SetBody(body []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.body = body
+	r.send(&Response{Payload: body})
+}
+
+// SetError 设置规则链处理错误，流式调用发送带错误的响应
+func (r *ResponseMessage) SetError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+	if err != nil {
+		r.send(&Response{Error: err.Error()})
+	}
+}
+
+func (r *ResponseMessage) GetError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// send 流式调用发送响应，调用结束后忽略，需要持有锁
+func (r *ResponseMessage) send(response *Response) {
+	if r.stream == nil || r.closed {
+		return
+	}
+	if !r.headerSent {
+		r.headerSent = true
+		if len(r.headers) > 0 {
+			_ = r.stream.SendHeader(toMetadata(r.headers))
+		}
+	}
+	_ = r.stream.SendMsg(response.toProto())
+}
+
+// close 调用结束，不再发送响应
+func (r *ResponseMessage) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+}
+
+// response 一元调用的响应，SetBody 设置的负荷替换规则链结果的负荷
+func (r *ResponseMessage) response() *Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	response := &Response{}
+	if r.msg != nil {
+		response = newResponse(r.msg)
+	}
+	if r.body != nil {
+		response.Payload = r.body
+	}
+	return response
+}
+
+// abortStatus 拦截器中断处理时的gRPC状态，状态码小于400返回nil
+func (r *ResponseMessage) abortStatus() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.statusCode < http.StatusBadRequest {
+		return nil
+	}
+	return status.Error(httpStatusToCode(r.statusCode), string(r.body))
+}
+
+// newResponse 把规则链消息转换成响应
+func newResponse(msg *types.RuleMsg) *Response {
+	response := &Response{
+		Id:       msg.Id,
+		MsgType:  msg.Type,
+		Payload:  msg.GetBytes(),
+		DataType: string(msg.DataType),
+	}
+	if msg.Metadata != nil {
+		response.Metadata = msg.Metadata.Values()
+	}
+	return response
+}
+
+// toMetadata 把响应头转换成gRPC元数据
+func toMetadata(headers textproto.MIMEHeader) metadata.MD {
+	md := metadata.MD{}
+	for k, values := range headers {
+		md.Append(k, values...)
+	}
+	return md
+}
+
+// httpStatusToCode 把拦截器设置的HTTP状态码转换成gRPC状态码
+func httpStatusToCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Unknown
+	}
+}
+
+// Grpc gRPC 接收端端点，路由from为路由名称，MatchAll 匹配所有没有匹配到其他路由的调用
+type Grpc struct {
+	impl.BaseEndpoint
+	RuleConfig types.Config
+	Config     Config
+	server     *grpcio.Server
+	listener   net.Listener
+	mu         sync.Mutex
+}
+
+// Type 组件类型
+func (x *Grpc) Type() string {
+	return Type
+}
+
+func (x *Grpc) New() types.Node {
+	return &Grpc{Config: Config{
+		Server:   ":9090",
+		RouteKey: DefaultRouteKey,
+	}}
+}
+
+// Init 初始化
+func (x *Grpc) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	if err := maps.Map2Struct(configuration, &x.Config); err != nil {
+		return err
+	}
+	if x.Config.Server == "" {
+		return errors.New("server can not empty")
+	}
+	if _, err := x.Config.TLS.NewTLSConfig(); err != nil {
+		return err
+	}
+	x.RuleConfig = ruleConfig
+	return nil
+}
+
+// Destroy 销毁
+func (x *Grpc) Destroy() {
+	_ = x.Close()
+}
+
+// Close 停止服务，正在执行的调用被取消
+func (x *Grpc) Close() error {
+	x.mu.Lock()
+	server := x.server
+	x.server = nil
+	x.listener = nil
+	x.mu.Unlock()
+	if server != nil {
+		server.Stop()
+	}
+	return nil
+}
+
+func (x *Grpc) Id() string {
+	return x.Config.Server
+}
+
+// AddRouter 添加路由，路由from为路由名称
+func (x *Grpc) AddRouter(router endpoint.Router, params ...interface{}) (string, error) {
+	if router == nil {
+		return "", errors.New("router can not nil")
+	}
+	route := router.FromToString()
+	if route == "" {
+		return "", errors.New("route can not empty")
+	}
+	x.CheckAndSetRouterId(router)
+	x.Lock()
+	defer x.Unlock()
+	if x.RouterStorage == nil {
+		x.RouterStorage = make(map[string]endpoint.Router)
+	}
+	for id, item := range x.RouterStorage {
+		if id != router.GetId() && item.FromToString() == route {
+			return "", fmt.Errorf("route: %s already exists", route)
+		}
+	}
+	x.RouterStorage[router.GetId()] = router
+	return router.GetId(), nil
+}
+
+func (x *Grpc) RemoveRouter(routerId string, params ...interface{}) error {
+	x.Lock()
+	defer x.Unlock()
+	if _, ok := x.RouterStorage[routerId]; !ok {
+		return fmt.Errorf("router: %s not found", routerId)
+	}
+	delete(x.RouterStorage, routerId)
+	return nil
+}
+
+// Start 启动gRPC服务
+func (x *Grpc) Start() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.server != nil {
+		return nil
+	}
+	var opts []grpcio.ServerOption
+	tlsConfig, err := x.Config.TLS.NewTLSConfig()
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		if tlsConfig.ClientCAs != nil {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		opts = append(opts, grpcio.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	listener, err := net.Listen("tcp", x.Config.Server)
+	if err != nil {
+		return err
+	}
+	server := grpcio.NewServer(opts...)
+	server.RegisterService(&serviceDesc, x)
+	if x.Config.Reflection {
+		reflection.Register(server)
+	}
+	x.server = server
+	x.listener = listener
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			x.Printf("grpc endpoint serve %s err :%v", x.Config.Server, err)
+		}
+	}()
+	x.Printf("started grpc server on %s", x.Config.Server)
+	return nil
+}
+
+// Addr 服务监听的地址，没有启动返回nil
+func (x *Grpc) Addr() net.Addr {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.listener == nil {
+		return nil
+	}
+	return x.listener.Addr()
+}
+
+func (x *Grpc) Printf(format string, v ...interface{}) {
+	if x.RuleConfig.Logger != nil {
+		x.RuleConfig.Logger.Printf(format, v...)
+	}
+}
+
+// invoke 一元调用，规则链处理错误返回 codes.Internal 状态
+func (x *Grpc) invoke(ctx context.Context, request *Request) (*Response, error) {
+	out := &ResponseMessage{}
+	exchange, router, err := x.newExchange(ctx, FullMethodInvoke, request, out)
+	if err != nil {
+		return nil, err
+	}
+	if err := x.process(ctx, router, exchange); err != nil {
+		return nil, err
+	}
+	if len(out.Headers()) > 0 {
+		_ = grpcio.SetHeader(ctx, toMetadata(out.Headers()))
+	}
+	if exchange.IsAborted() {
+		if err := out.abortStatus(); err != nil {
+			return nil, err
+		}
+	}
+	if err := out.GetError(); err != nil {
+		return nil, errorStatus(err)
+	}
+	return out.response(), nil
+}
+
+// invokeStream 服务端流式调用，规则链每个结束点的结果发送一条响应，处理错误放在响应的error字段
+func (x *Grpc) invokeStream(request *Request, stream grpcio.ServerStream) error {
+	ctx := stream.Context()
+	out := &ResponseMessage{stream: stream}
+	defer out.close()
+	exchange, router, err := x.newExchange(ctx, FullMethodInvokeStream, request, out)
+	if err != nil {
+		return err
+	}
+	if err := x.process(ctx, router, exchange); err != nil {
+		return err
+	}
+	if exchange.IsAborted() {
+		return out.abortStatus()
+	}
+	return nil
+}
+
+// newExchange 匹配路由、校验令牌，并创建交换对象
+func (x *Grpc) newExchange(ctx context.Context, method string, request *Request, out *ResponseMessage) (*endpoint.Exchange, endpoint.Router, error) {
+	route := x.route(ctx, request)
+	router := x.matchRouter(route)
+	if router == nil || router.IsDisable() {
+		return nil, nil, status.Errorf(codes.NotFound, "route: %s not found", route)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	transportMeta := map[string]string{
+		endpoint.TransportKey:     "grpc",
+		endpoint.TransportPathKey: method,
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		transportMeta[endpoint.TransportRemoteAddrKey] = p.Addr.String()
+	}
+	principal, err := x.Authenticate(bearerToken(md), transportMeta)
+	if err != nil {
+		return nil, nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	in := &RequestMessage{
+		ctx:     ctx,
+		request: request,
+		method:  method,
+		route:   route,
+	}
+	if principal != nil {
+		principal.PutToMetadata(in.GetMsg().Metadata)
+	}
+	return &endpoint.Exchange{In: in, Out: out}, router, nil
+}
+
+// process 处理消息，同步路由把调用的上下文（包括截止时间）传递给规则链，调用取消或者超时立即返回对应的gRPC状态
+func (x *Grpc) process(ctx context.Context, router endpoint.Router, exchange *endpoint.Exchange) error {
+	processCtx := ctx
+	if !isWait(router) {
+		//异步不能使用调用的上下文，否则调用返回后后续执行会取消
+		processCtx = context.Background()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			//捕捉异常
+			if e := recover(); e != nil {
+				x.Printf("grpc endpoint handler err :\n%v", runtime.Stack())
+				exchange.Out.SetError(fmt.Errorf("%v", e))
+			}
+		}()
+		x.DoProcess(processCtx, router, exchange)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// route 获取调用的路由，优先使用gRPC元数据 Config.RouteKey，否则使用请求的msgType
+func (x *Grpc) route(ctx context.Context, request *Request) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(x.Config.routeKey()); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return request.MsgType
+}
+
+// matchRouter 匹配路由，没有匹配到使用 MatchAll 路由
+func (x *Grpc) matchRouter(route string) endpoint.Router {
+	x.RLock()
+	defer x.RUnlock()
+	var matchAll endpoint.Router
+	for _, router := range x.RouterStorage {
+		switch router.FromToString() {
+		case route:
+			return router
+		case MatchAll:
+			matchAll = router
+		}
+	}
+	return matchAll
+}
+
+// isWait 路由是否同步执行，没有To的路由同步执行
+func isWait(router endpoint.Router) bool {
+	if from := router.GetFrom(); from != nil && from.GetTo() != nil {
+		return from.GetTo().IsWait()
+	}
+	return true
+}
+
+// bearerToken 获取gRPC元数据 authorization 中的Bearer令牌
+func bearerToken(md metadata.MD) string {
+	values := md.Get(headerAuthorization)
+	if len(values) == 0 {
+		return ""
+	}
+	if len(values[0]) > 7 && strings.EqualFold(values[0][:7], "Bearer ") {
+		return strings.TrimSpace(values[0][7:])
+	}
+	return ""
+}
+
+// errorStatus 把规则链处理错误转换成gRPC状态
+func errorStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
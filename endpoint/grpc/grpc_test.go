@@ -0,0 +1,328 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/test/cert"
+
+	grpcio "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// 测试请求/响应消息
+func TestGrpcMessage(t *testing.T) {
+	t.Run("Request", func(t *testing.T) {
+		test.EndpointMessage(t, &RequestMessage{})
+	})
+	t.Run("Response", func(t *testing.T) {
+		test.EndpointMessage(t, &ResponseMessage{})
+	})
+	t.Run("Metadata", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("trace-id", "t1", "authorization", "Bearer x"))
+		request := &RequestMessage{
+			ctx:     ctx,
+			method:  FullMethodInvoke,
+			route:   "telemetry",
+			request: &Request{MsgType: "TELEMETRY", Metadata: map[string]string{"deviceId": "d1"}, Payload: []byte(`{"temperature":41}`)},
+		}
+		msg := request.GetMsg()
+		assert.Equal(t, `{"temperature":41}`, msg.GetData())
+		assert.Equal(t, "TELEMETRY", msg.Type)
+		assert.Equal(t, types.JSON, msg.DataType)
+		assert.Equal(t, "d1", msg.Metadata.GetValue("deviceId"))
+		assert.Equal(t, FullMethodInvoke, msg.Metadata.GetValue(KeyMethod))
+		assert.Equal(t, "telemetry", msg.Metadata.GetValue(KeyRoute))
+		assert.Equal(t, "t1", msg.Metadata.GetValue(HeaderMetadataNamespace+".trace-id"))
+		//令牌不放到元数据
+		assert.False(t, msg.Metadata.Has(HeaderMetadataNamespace+"."+headerAuthorization))
+		assert.Equal(t, "t1", request.Headers().Get("trace-id"))
+
+		request = &RequestMessage{request: &Request{Payload: []byte{0x01, 0xff}, DataType: "binary"}}
+		assert.Equal(t, types.BINARY, request.GetMsg().DataType)
+		assert.Equal(t, []byte{0x01, 0xff}, request.GetMsg().GetBytes())
+	})
+}
+
+func TestGrpcInit(t *testing.T) {
+	config := engine.NewConfig()
+	ep := &Grpc{}
+	assert.NotNil(t, ep.Init(config, types.Configuration{"server": ""}))
+	assert.NotNil(t, ep.Init(config, types.Configuration{"server": ":9090", "tls": map[string]interface{}{"cert": "not_exist.pem"}}))
+
+	ep = (&Grpc{}).New().(*Grpc)
+	assert.Nil(t, ep.Init(config, types.Configuration{"routeKey": "X-Route"}))
+	assert.Equal(t, Type, ep.Type())
+	assert.Equal(t, ":9090", ep.Id())
+	assert.Equal(t, "x-route", ep.Config.routeKey())
+
+	_, err := ep.AddRouter(impl.NewRouter().From("").End())
+	assert.NotNil(t, err)
+	routerId, err := ep.AddRouter(impl.NewRouter().From("telemetry").To("chain:default").End())
+	assert.Nil(t, err)
+	//不同路由ID的路由不能使用相同的路由名称
+	router := impl.NewRouter().From("telemetry").To("chain:other").End()
+	router.SetId("other")
+	_, err = ep.AddRouter(router)
+	assert.NotNil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From(MatchAll).To("chain:default").End())
+	assert.Nil(t, err)
+	assert.Equal(t, "telemetry", ep.matchRouter("telemetry").FromToString())
+	assert.Equal(t, MatchAll, ep.matchRouter("other").FromToString())
+	assert.Nil(t, ep.RemoveRouter(routerId))
+	assert.NotNil(t, ep.RemoveRouter(routerId))
+	assert.Equal(t, MatchAll, ep.matchRouter("telemetry").FromToString())
+}
+
+func TestGrpcEndpoint(t *testing.T) {
+	ruleChain := `{
+	  "ruleChain": {"id": "grpcTest"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "if (msg.fail) { throw 'fail'; } msg.deviceId = metadata.deviceId; return {'msg':msg,'metadata':metadata,'msgType':msgType};"}},
+		  {"id": "s2", "type": "jsTransform", "configuration": {"jsScript": "msg.branch = 'a'; return {'msg':msg,'metadata':metadata,'msgType':msgType};"}},
+		  {"id": "s3", "type": "jsTransform", "configuration": {"jsScript": "msg.branch = 'b'; return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}
+		],
+		"connections": [
+		  {"fromId": "s1", "toId": "s2", "type": "Success"},
+		  {"fromId": "s1", "toId": "s3", "type": "Success"}
+		]
+	  }
+	}`
+	config := engine.NewConfig(types.WithDefaultPool())
+	_, err := engine.New("grpcTest", []byte(ruleChain), engine.WithConfig(config))
+	assert.Nil(t, err)
+	defer engine.Del("grpcTest")
+
+	ep := &Grpc{}
+	assert.Nil(t, ep.Init(config, types.Configuration{"server": "127.0.0.1:0", "reflection": true}))
+	_, err = ep.AddRouter(impl.NewRouter().From("TELEMETRY").To("chain:grpcTest").Wait().End())
+	assert.Nil(t, err)
+	deadlines := make(chan bool, 1)
+	router := impl.NewRouter().From("echo").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.Headers().Set("x-echo", "1")
+		exchange.Out.SetBody(exchange.In.Body())
+		return true
+	}).End()
+	router.(*impl.Router).SetContextFunc(func(ctx context.Context, exchange *endpoint.Exchange) context.Context {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		return ctx
+	})
+	_, err = ep.AddRouter(router)
+	assert.Nil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From("slow").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		time.Sleep(time.Millisecond * 500)
+		return true
+	}).End())
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+
+	conn, err := grpcio.Dial(ep.Addr().String(), grpcio.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := NewClient(conn)
+
+	t.Run("Invoke", func(t *testing.T) {
+		response, err := client.Invoke(context.Background(), &Request{
+			MsgType:  "TELEMETRY",
+			Metadata: map[string]string{"deviceId": "d1"},
+			Payload:  []byte(`{"temperature":41}`),
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "TELEMETRY", response.MsgType)
+		assert.Equal(t, "d1", response.Metadata["deviceId"])
+		assert.True(t, response.Id != "")
+		assert.Equal(t, string(types.JSON), response.DataType)
+
+		//规则链处理失败
+		_, err = client.Invoke(context.Background(), &Request{MsgType: "TELEMETRY", Payload: []byte(`{"fail":true}`)})
+		assert.Equal(t, codes.Internal, status.Code(err))
+
+		//没有匹配的路由
+		_, err = client.Invoke(context.Background(), &Request{MsgType: "other"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("RouteMetadata", func(t *testing.T) {
+		//gRPC元数据路由优先于msgType，截止时间传递到规则链上下文
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		ctx = metadata.AppendToOutgoingContext(ctx, DefaultRouteKey, "echo")
+		var header metadata.MD
+		response, err := client.Invoke(ctx, &Request{MsgType: "TELEMETRY", Payload: []byte("hello")}, grpcio.Header(&header))
+		assert.Nil(t, err)
+		assert.Equal(t, "hello", string(response.Payload))
+		assert.Equal(t, []string{"1"}, header.Get("x-echo"))
+		assert.True(t, <-deadlines)
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+		start := time.Now()
+		_, err := client.Invoke(ctx, &Request{MsgType: "slow"})
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		assert.True(t, time.Since(start) < time.Millisecond*400)
+	})
+
+	t.Run("InvokeStream", func(t *testing.T) {
+		//规则链每个结束点发送一条响应
+		stream, err := client.InvokeStream(context.Background(), &Request{
+			MsgType:  "TELEMETRY",
+			Metadata: map[string]string{"deviceId": "d1"},
+			Payload:  []byte(`{"temperature":41}`),
+		})
+		assert.Nil(t, err)
+		var branches []string
+		for {
+			response, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "", response.Error)
+			var data map[string]interface{}
+			assert.Nil(t, json.Unmarshal(response.Payload, &data))
+			branches = append(branches, data["branch"].(string))
+		}
+		sort.Strings(branches)
+		assert.Equal(t, []string{"a", "b"}, branches)
+
+		//处理错误放在响应的error字段
+		stream, err = client.InvokeStream(context.Background(), &Request{MsgType: "TELEMETRY", Payload: []byte(`{"fail":true}`)})
+		assert.Nil(t, err)
+		response, err := stream.Recv()
+		assert.Nil(t, err)
+		assert.True(t, response.Error != "")
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("Reflection", func(t *testing.T) {
+		reflectionClient, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+		assert.Nil(t, err)
+		err = reflectionClient.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		})
+		assert.Nil(t, err)
+		response, err := reflectionClient.Recv()
+		assert.Nil(t, err)
+		var services []string
+		for _, service := range response.GetListServicesResponse().GetService() {
+			services = append(services, service.GetName())
+		}
+		assert.True(t, contains(services, ServiceName))
+		_ = reflectionClient.CloseSend()
+	})
+}
+
+func TestGrpcAuthenticate(t *testing.T) {
+	ep := &Grpc{}
+	assert.Nil(t, ep.Init(engine.NewConfig(), types.Configuration{"server": "127.0.0.1:0"}))
+	ep.SetTokenValidator(endpoint.TokenValidatorFunc(func(token string, transportMeta map[string]string) (endpoint.Principal, error) {
+		if token != "t1" {
+			return endpoint.Principal{}, errors.New("invalid token")
+		}
+		assert.Equal(t, "grpc", transportMeta[endpoint.TransportKey])
+		return endpoint.Principal{Id: "u1"}, nil
+	}))
+	_, err := ep.AddRouter(impl.NewRouter().From("echo").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte(exchange.In.GetMsg().Metadata.GetValue(endpoint.PrincipalIdKey)))
+		return true
+	}).End())
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+
+	conn, err := grpcio.Dial(ep.Addr().String(), grpcio.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := NewClient(conn)
+	_, err = client.Invoke(context.Background(), &Request{MsgType: "echo"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer t1")
+	response, err := client.Invoke(ctx, &Request{MsgType: "echo"})
+	assert.Nil(t, err)
+	assert.Equal(t, "u1", string(response.Payload))
+}
+
+func TestGrpcTLS(t *testing.T) {
+	ca := cert.New(t, "ca", nil, x509.ExtKeyUsageAny)
+	serverCert := cert.New(t, "server", ca, x509.ExtKeyUsageServerAuth)
+	ep := &Grpc{}
+	err := ep.Init(engine.NewConfig(), types.Configuration{
+		"server": "127.0.0.1:0",
+		"tls":    map[string]interface{}{"cert": string(serverCert.CertPem), "key": string(serverCert.KeyPem)},
+	})
+	assert.Nil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From(MatchAll).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte("ok"))
+		return true
+	}).End())
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	conn, err := grpcio.Dial(ep.Addr().String(), grpcio.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool})))
+	assert.Nil(t, err)
+	defer conn.Close()
+	response, err := NewClient(conn).Invoke(context.Background(), &Request{MsgType: "any"})
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", string(response.Payload))
+
+	//不使用TLS的客户端调用失败
+	plainConn, err := grpcio.Dial(ep.Addr().String(), grpcio.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer plainConn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	_, err = NewClient(plainConn).Invoke(ctx, &Request{MsgType: "any"})
+	assert.NotNil(t, err)
+}
+
+func contains(items []string, item string) bool {
+	for _, v := range items {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,363 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"context"
+
+	grpcio "google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// RuleService 的定义，等价于以下proto文件，不需要生成代码，开启反射后可以使用grpcurl等工具调用：
+//
+//	syntax = "proto3";
+//	package rulego;
+//
+//	message InvokeRequest {
+//	  string msg_type = 1;
+//	  map<string, string> metadata = 2;
+//	  bytes payload = 3;
+//	  string data_type = 4;
+//	}
+//
+//	message InvokeResponse {
+//	  string msg_type = 1;
+//	  map<string, string> metadata = 2;
+//	  bytes payload = 3;
+//	  string data_type = 4;
+//	  string error = 5;
+//	  string id = 6;
+//	}
+//
+//	service RuleService {
+//	  rpc Invoke(InvokeRequest) returns (InvokeResponse);
+//	  rpc InvokeStream(InvokeRequest) returns (stream InvokeResponse);
+//	}
+const (
+	// ServiceName 服务名称
+	ServiceName = "rulego.RuleService"
+	// MethodInvoke 一元调用方法，返回规则链最后一个结束点的结果
+	MethodInvoke = "Invoke"
+	// MethodInvokeStream 服务端流式调用方法，规则链每个结束点的结果作为一条响应发送
+	MethodInvokeStream = "InvokeStream"
+	// FullMethodInvoke Invoke 方法全名
+	FullMethodInvoke = "/" + ServiceName + "/" + MethodInvoke
+	// FullMethodInvokeStream InvokeStream 方法全名
+	FullMethodInvokeStream = "/" + ServiceName + "/" + MethodInvokeStream
+	// protoFileName 服务定义的proto文件名
+	protoFileName = "rulego/rule_service.proto"
+)
+
+var (
+	requestDesc  protoreflect.MessageDescriptor
+	responseDesc protoreflect.MessageDescriptor
+)
+
+// 注册服务定义到 protoregistry.GlobalFiles，用于反射服务
+func init() {
+	file, err := protodesc.NewFile(newFileDescriptorProto(), protoregistry.GlobalFiles)
+	if err != nil {
+		panic(err)
+	}
+	if err := protoregistry.GlobalFiles.RegisterFile(file); err != nil {
+		panic(err)
+	}
+	requestDesc = file.Messages().ByName("InvokeRequest")
+	responseDesc = file.Messages().ByName("InvokeResponse")
+}
+
+// newFileDescriptorProto 创建服务定义的proto文件描述
+func newFileDescriptorProto() *descriptorpb.FileDescriptorProto {
+	field := func(name, jsonName string, number int32, fieldType descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(jsonName),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     fieldType.Enum(),
+		}
+	}
+	//map<string, string> 字段
+	metadataField := func(message string) *descriptorpb.FieldDescriptorProto {
+		f := field("metadata", "metadata", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+		f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		f.TypeName = proto.String(".rulego." + message + ".MetadataEntry")
+		return f
+	}
+	metadataEntry := &descriptorpb.DescriptorProto{
+		Name: proto.String("MetadataEntry"),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			field("key", "key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			field("value", "value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+		},
+		Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+	}
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String(protoFileName),
+		Package: proto.String("rulego"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("InvokeRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("msg_type", "msgType", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+					metadataField("InvokeRequest"),
+					field("payload", "payload", 3, descriptorpb.FieldDescriptorProto_TYPE_BYTES),
+					field("data_type", "dataType", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{metadataEntry},
+			},
+			{
+				Name: proto.String("InvokeResponse"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("msg_type", "msgType", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+					metadataField("InvokeResponse"),
+					field("payload", "payload", 3, descriptorpb.FieldDescriptorProto_TYPE_BYTES),
+					field("data_type", "dataType", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+					field("error", "error", 5, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+					field("id", "id", 6, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{metadataEntry},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("RuleService"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String(MethodInvoke),
+						InputType:  proto.String(".rulego.InvokeRequest"),
+						OutputType: proto.String(".rulego.InvokeResponse"),
+					},
+					{
+						Name:            proto.String(MethodInvokeStream),
+						InputType:       proto.String(".rulego.InvokeRequest"),
+						OutputType:      proto.String(".rulego.InvokeResponse"),
+						ServerStreaming: proto.Bool(true),
+					},
+				},
+			},
+		},
+	}
+}
+
+// Request Invoke/InvokeStream 请求
+type Request struct {
+	// MsgType 消息类型，没有配置路由元数据时用于匹配路由
+	MsgType string
+	// Metadata 消息元数据
+	Metadata map[string]string
+	// Payload 消息负荷
+	Payload []byte
+	// DataType 消息数据类型：JSON、TEXT、BINARY，默认JSON
+	DataType string
+}
+
+// Response Invoke/InvokeStream 响应
+type Response struct {
+	// Id 消息ID
+	Id string
+	// MsgType 消息类型
+	MsgType string
+	// Metadata 消息元数据
+	Metadata map[string]string
+	// Payload 消息负荷
+	Payload []byte
+	// DataType 消息数据类型
+	DataType string
+	// Error 流式调用时规则链结束点的处理错误，一元调用的错误通过gRPC状态返回
+	Error string
+}
+
+func (r *Request) toProto() *dynamicpb.Message {
+	m := dynamicpb.NewMessage(requestDesc)
+	setString(m, "msg_type", r.MsgType)
+	setMap(m, "metadata", r.Metadata)
+	setBytes(m, "payload", r.Payload)
+	setString(m, "data_type", r.DataType)
+	return m
+}
+
+func requestFromProto(m *dynamicpb.Message) *Request {
+	return &Request{
+		MsgType:  getString(m, "msg_type"),
+		Metadata: getMap(m, "metadata"),
+		Payload:  getBytes(m, "payload"),
+		DataType: getString(m, "data_type"),
+	}
+}
+
+func (r *Response) toProto() *dynamicpb.Message {
+	m := dynamicpb.NewMessage(responseDesc)
+	setString(m, "id", r.Id)
+	setString(m, "msg_type", r.MsgType)
+	setMap(m, "metadata", r.Metadata)
+	setBytes(m, "payload", r.Payload)
+	setString(m, "data_type", r.DataType)
+	setString(m, "error", r.Error)
+	return m
+}
+
+func responseFromProto(m *dynamicpb.Message) *Response {
+	return &Response{
+		Id:       getString(m, "id"),
+		MsgType:  getString(m, "msg_type"),
+		Metadata: getMap(m, "metadata"),
+		Payload:  getBytes(m, "payload"),
+		DataType: getString(m, "data_type"),
+		Error:    getString(m, "error"),
+	}
+}
+
+func setString(m *dynamicpb.Message, name protoreflect.Name, v string) {
+	if v != "" {
+		m.Set(m.Descriptor().Fields().ByName(name), protoreflect.ValueOfString(v))
+	}
+}
+
+func setBytes(m *dynamicpb.Message, name protoreflect.Name, v []byte) {
+	if len(v) > 0 {
+		m.Set(m.Descriptor().Fields().ByName(name), protoreflect.ValueOfBytes(v))
+	}
+}
+
+func setMap(m *dynamicpb.Message, name protoreflect.Name, v map[string]string) {
+	if len(v) == 0 {
+		return
+	}
+	values := m.Mutable(m.Descriptor().Fields().ByName(name)).Map()
+	for key, value := range v {
+		values.Set(protoreflect.ValueOfString(key).MapKey(), protoreflect.ValueOfString(value))
+	}
+}
+
+func getString(m *dynamicpb.Message, name protoreflect.Name) string {
+	return m.Get(m.Descriptor().Fields().ByName(name)).String()
+}
+
+func getBytes(m *dynamicpb.Message, name protoreflect.Name) []byte {
+	return m.Get(m.Descriptor().Fields().ByName(name)).Bytes()
+}
+
+func getMap(m *dynamicpb.Message, name protoreflect.Name) map[string]string {
+	values := m.Get(m.Descriptor().Fields().ByName(name)).Map()
+	result := make(map[string]string, values.Len())
+	values.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+		result[key.String()] = value.String()
+		return true
+	})
+	return result
+}
+
+// ruleService RuleService 服务实现
+type ruleService interface {
+	invoke(ctx context.Context, request *Request) (*Response, error)
+	invokeStream(request *Request, stream grpcio.ServerStream) error
+}
+
+// serviceDesc RuleService 服务描述
+var serviceDesc = grpcio.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*ruleService)(nil),
+	Methods: []grpcio.MethodDesc{
+		{MethodName: MethodInvoke, Handler: invokeHandler},
+	},
+	Streams: []grpcio.StreamDesc{
+		{StreamName: MethodInvokeStream, Handler: invokeStreamHandler, ServerStreams: true},
+	},
+	Metadata: protoFileName,
+}
+
+func invokeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpcio.UnaryServerInterceptor) (interface{}, error) {
+	in := dynamicpb.NewMessage(requestDesc)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		response, err := srv.(ruleService).invoke(ctx, requestFromProto(req.(*dynamicpb.Message)))
+		if err != nil {
+			return nil, err
+		}
+		return response.toProto(), nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	return interceptor(ctx, in, &grpcio.UnaryServerInfo{Server: srv, FullMethod: FullMethodInvoke}, handler)
+}
+
+func invokeStreamHandler(srv interface{}, stream grpcio.ServerStream) error {
+	in := dynamicpb.NewMessage(requestDesc)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(ruleService).invokeStream(requestFromProto(in), stream)
+}
+
+// Client RuleService 客户端
+type Client struct {
+	conn grpcio.ClientConnInterface
+}
+
+// NewClient 创建 RuleService 客户端
+func NewClient(conn grpcio.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+// Invoke 一元调用，ctx的截止时间传递到服务端规则链
+func (c *Client) Invoke(ctx context.Context, request *Request, opts ...grpcio.CallOption) (*Response, error) {
+	out := dynamicpb.NewMessage(responseDesc)
+	if err := c.conn.Invoke(ctx, FullMethodInvoke, request.toProto(), out, opts...); err != nil {
+		return nil, err
+	}
+	return responseFromProto(out), nil
+}
+
+// InvokeStream 服务端流式调用，通过 ResponseStream.Recv 接收规则链每个结束点的结果
+func (c *Client) InvokeStream(ctx context.Context, request *Request, opts ...grpcio.CallOption) (*ResponseStream, error) {
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], FullMethodInvokeStream, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(request.toProto()); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &ResponseStream{stream: stream}, nil
+}
+
+// ResponseStream 流式调用的响应流
+type ResponseStream struct {
+	stream grpcio.ClientStream
+}
+
+// Recv 接收下一条响应，全部接收完成返回 io.EOF
+func (s *ResponseStream) Recv() (*Response, error) {
+	out := dynamicpb.NewMessage(responseDesc)
+	if err := s.stream.RecvMsg(out); err != nil {
+		return nil, err
+	}
+	return responseFromProto(out), nil
+}
@@ -37,7 +37,9 @@ package impl
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -68,6 +70,8 @@ type From struct {
 	processList []endpoint.Process
 	//流转目标路径，例如"chain:{chainId}"，则是交给规则引擎处理数据
 	to *To
+	//事件时间提取器，没有配置为nil
+	eventTs *eventTsExtractor
 }
 
 func (f *From) ToString() string {
@@ -91,6 +95,11 @@ func (f *From) GetProcessList() []endpoint.Process {
 	return f.processList
 }
 
+// SetProcessList 设置from端处理器列表
+func (f *From) SetProcessList(processList []endpoint.Process) {
+	f.processList = processList
+}
+
 // ExecuteProcess 执行处理函数
 // true:执行To端逻辑，否则不执行
 func (f *From) ExecuteProcess(router endpoint.Router, exchange *endpoint.Exchange) bool {
@@ -290,6 +299,16 @@ type Router struct {
 	params []interface{}
 	//记录初始化的错误
 	err error
+	//路由拦截器，按执行顺序排序
+	interceptors     []routerInterceptor
+	interceptorsLock sync.RWMutex
+}
+
+// routerInterceptor 路由拦截器
+type routerInterceptor struct {
+	name    string
+	order   int
+	process endpoint.Process
 }
 
 // RouterOption 选项函数
@@ -358,7 +377,11 @@ func (r *Router) From(from string, configs ...types.Configuration) endpoint.From
 		}
 	}
 	r.from = &From{Router: r, From: from, Config: fromConfig}
-
+	if extractor, err := newEventTsExtractor(fromConfig); err != nil {
+		r.err = err
+	} else {
+		r.from.eventTs = extractor
+	}
 	return r.from
 }
 
@@ -377,6 +400,21 @@ func (r *Router) GetRuleGo(exchange *endpoint.Exchange) types.RuleEnginePool {
 	}
 }
 
+// ToChainLoaded 路由的To端规则链是否已经加载
+// To端不是规则链、路径包含变量或者使用动态规则链池时无法检查，checked返回false
+func (r *Router) ToChainLoaded() (loaded bool, checked bool) {
+	if r.from == nil || r.from.to == nil || r.ruleGoFunc != nil || r.RuleGo == nil {
+		return false, false
+	}
+	to := r.from.to
+	if _, ok := to.executor.(*ChainExecutor); !ok || to.HasVars {
+		return false, false
+	}
+	chainId := strings.Split(to.ToPath, pathSplitFlag)[0]
+	_, loaded = r.RuleGo.Get(chainId)
+	return loaded, true
+}
+
 // Disable 设置状态 true:不可用，false:可以
 func (r *Router) Disable(disable bool) endpoint.Router {
 	if disable {
@@ -403,6 +441,53 @@ func (r *Router) Err() error {
 	return r.err
 }
 
+// AddInterceptor 添加路由拦截器，在全局拦截器之后执行，order小的先执行，相同order按添加顺序执行
+// 如果已经存在同名的拦截器则替换
+func (r *Router) AddInterceptor(name string, interceptor endpoint.Process, order int) endpoint.Router {
+	r.interceptorsLock.Lock()
+	defer r.interceptorsLock.Unlock()
+	item := routerInterceptor{name: name, order: order, process: interceptor}
+	replaced := false
+	for i, old := range r.interceptors {
+		if old.name == name {
+			r.interceptors[i] = item
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		r.interceptors = append(r.interceptors, item)
+	}
+	sort.SliceStable(r.interceptors, func(i, j int) bool {
+		return r.interceptors[i].order < r.interceptors[j].order
+	})
+	return r
+}
+
+// RemoveInterceptor 删除指定名称的路由拦截器，不存在返回false
+func (r *Router) RemoveInterceptor(name string) bool {
+	r.interceptorsLock.Lock()
+	defer r.interceptorsLock.Unlock()
+	for i, item := range r.interceptors {
+		if item.name == name {
+			r.interceptors = append(r.interceptors[:i:i], r.interceptors[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Interceptors 按执行顺序获取路由拦截器的副本
+func (r *Router) Interceptors() []endpoint.Process {
+	r.interceptorsLock.RLock()
+	defer r.interceptorsLock.RUnlock()
+	interceptors := make([]endpoint.Process, len(r.interceptors))
+	for i, item := range r.interceptors {
+		interceptors[i] = item.process
+	}
+	return interceptors
+}
+
 // BaseEndpoint 基础端点
 // 实现全局拦截器基础方法
 type BaseEndpoint struct {
@@ -411,6 +496,10 @@ type BaseEndpoint struct {
 	OnEvent       endpoint.OnEvent
 	//全局拦截器
 	interceptors []endpoint.Process
+	//令牌校验器，为空不校验
+	TokenValidator endpoint.TokenValidator
+	//消息来源回复器注册id，见 RegisterOrigin
+	originId string
 	sync.RWMutex
 }
 
@@ -422,6 +511,63 @@ func (e *BaseEndpoint) SetOnEvent(onEvent endpoint.OnEvent) {
 	e.OnEvent = onEvent
 }
 
+// SetTokenValidator 设置令牌校验器
+func (e *BaseEndpoint) SetTokenValidator(validator endpoint.TokenValidator) {
+	e.Lock()
+	defer e.Unlock()
+	e.TokenValidator = validator
+}
+
+// Authenticate 使用令牌校验器校验令牌，如果没设置令牌校验器，则返回nil
+// 校验失败返回的错误包装了 endpoint.ErrUnauthorized
+func (e *BaseEndpoint) Authenticate(token string, transportMeta map[string]string) (*endpoint.Principal, error) {
+	e.RLock()
+	validator := e.TokenValidator
+	e.RUnlock()
+	if validator == nil {
+		return nil, nil
+	}
+	if token == "" {
+		return nil, fmt.Errorf("%w: missing token", endpoint.ErrUnauthorized)
+	}
+	principal, err := validator.Validate(token, transportMeta)
+	if err != nil {
+		if !errors.Is(err, endpoint.ErrUnauthorized) {
+			err = fmt.Errorf("%w: %v", endpoint.ErrUnauthorized, err)
+		}
+		return nil, err
+	}
+	return &principal, nil
+}
+
+// RegisterOrigin 注册消息来源回复器，返回的id通过元数据 endpoint.OriginIdKey 标记消息来源，replyTo节点使用该id找到回复器
+// 重复调用返回相同的id，不替换已经注册的回复器
+func (e *BaseEndpoint) RegisterOrigin(replier endpoint.Replier) string {
+	e.Lock()
+	defer e.Unlock()
+	if e.originId == "" {
+		e.originId = endpoint.RegisterReplier(replier)
+	}
+	return e.originId
+}
+
+// OriginId 返回回复器注册id，没有注册返回空
+func (e *BaseEndpoint) OriginId() string {
+	e.RLock()
+	defer e.RUnlock()
+	return e.originId
+}
+
+// UnregisterOrigin 注销消息来源回复器，之后该端点接收的消息不能再回复
+func (e *BaseEndpoint) UnregisterOrigin() {
+	e.Lock()
+	defer e.Unlock()
+	if e.originId != "" {
+		endpoint.UnregisterReplier(e.originId)
+		e.originId = ""
+	}
+}
+
 // AddInterceptors 添加全局拦截器
 func (e *BaseEndpoint) AddInterceptors(interceptors ...endpoint.Process) {
 	e.Lock()
@@ -429,10 +575,9 @@ func (e *BaseEndpoint) AddInterceptors(interceptors ...endpoint.Process) {
 	e.interceptors = append(e.interceptors, interceptors...)
 }
 
-func (e *BaseEndpoint) DoProcess(baseCtx context.Context, router endpoint.Router, exchange *endpoint.Exchange) {
-	//创建上下文
-	ctx := e.createContext(baseCtx, router, exchange)
-
+// DoInterceptors 执行全局拦截器和路由拦截器，如果有拦截器返回false则终止并返回false
+// 端点在进入路由处理前拒绝请求时，也可以调用该方法，让拦截器观察到被拒绝的请求
+func (e *BaseEndpoint) DoInterceptors(router endpoint.Router, exchange *endpoint.Exchange) bool {
 	// 线程安全地获取拦截器副本
 	e.RLock()
 	interceptors := make([]endpoint.Process, len(e.interceptors))
@@ -442,11 +587,33 @@ func (e *BaseEndpoint) DoProcess(baseCtx context.Context, router endpoint.Router
 	for _, item := range interceptors {
 		//执行全局拦截器
 		if !item(router, exchange) {
-			return
+			return false
 		}
 	}
+	if router == nil {
+		return true
+	}
+	for _, item := range router.Interceptors() {
+		//执行路由拦截器
+		if !item(router, exchange) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *BaseEndpoint) DoProcess(baseCtx context.Context, router endpoint.Router, exchange *endpoint.Exchange) {
+	//创建上下文
+	ctx := e.createContext(baseCtx, router, exchange)
+
+	if !e.DoInterceptors(router, exchange) {
+		return
+	}
 	//执行from端逻辑
 	if fromFlow := router.GetFrom(); fromFlow != nil {
+		if from, ok := fromFlow.(*From); ok && from.eventTs != nil {
+			from.eventTs.extract(exchange)
+		}
 		if !fromFlow.ExecuteProcess(router, exchange) {
 			return
 		}
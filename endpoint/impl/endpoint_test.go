@@ -435,6 +435,38 @@ func TestEndpoint(t *testing.T) {
 		testEp.DoProcess(nil, router, exchange)
 	})
 
+	t.Run("RouterInterceptors", func(t *testing.T) {
+		var steps []string
+		interceptor := func(step string, result bool) endpoint.Process {
+			return func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+				steps = append(steps, step)
+				return result
+			}
+		}
+		router := NewRouter().From(from).Process(interceptor("from", true)).End()
+		router.AddInterceptor("tenant", interceptor("tenant", true), 20).
+			AddInterceptor("auth", interceptor("auth", true), 10).
+			AddInterceptor("log", interceptor("log", true), 20)
+		testEp := &testEndpoint{}
+		testEp.AddInterceptors(interceptor("global", true))
+		exchange := &endpoint.Exchange{In: &testRequestMessage{body: []byte("{}")}, Out: &testResponseMessage{}}
+		//全局拦截器先执行，路由拦截器按order执行，相同order按添加顺序执行
+		testEp.DoProcess(context.Background(), router, exchange)
+		assert.Equal(t, []string{"global", "auth", "tenant", "log", "from"}, steps)
+
+		//替换同名拦截器，并且中断处理
+		steps = nil
+		router.AddInterceptor("auth", interceptor("deny", false), 30)
+		testEp.DoProcess(context.Background(), router, exchange)
+		assert.Equal(t, []string{"global", "tenant", "log", "deny"}, steps)
+
+		steps = nil
+		assert.True(t, router.RemoveInterceptor("auth"))
+		assert.False(t, router.RemoveInterceptor("auth"))
+		testEp.DoProcess(context.Background(), router, exchange)
+		assert.Equal(t, []string{"global", "tenant", "log", "from"}, steps)
+		assert.Equal(t, 2, len(router.Interceptors()))
+	})
 }
 
 func executeRouterTest(router endpoint.Router, exchange *endpoint.Exchange) {
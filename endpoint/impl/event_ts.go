@@ -0,0 +1,205 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package impl
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/str"
+)
+
+const (
+	// KeyEventTs 路由from配置：从请求中提取事件时间，配置见 EventTsConfig
+	KeyEventTs = "eventTs"
+
+	// EventTsSourceHeader 从请求头提取，例如：header:X-Event-Time
+	EventTsSourceHeader = "header"
+	// EventTsSourceField 从消息负荷字段提取，支持嵌套路径，例如：field:payload.ts
+	EventTsSourceField = "field"
+	// EventTsSourceMetadata 从消息元数据提取，例如：metadata:ts
+	EventTsSourceMetadata = "metadata"
+	// EventTsSourceTopic 从主题/路径按"/"分割后的片段提取，负数从末尾开始，例如：topic:2、topic:-1
+	EventTsSourceTopic = "topic"
+
+	// EventTsFormatUnixMs 毫秒时间戳
+	EventTsFormatUnixMs = "unixMs"
+	// EventTsFormatUnix 秒时间戳，可以带小数
+	EventTsFormatUnix = "unix"
+	// EventTsFormatRFC3339 RFC3339格式，例如：2024-01-02T15:04:05.123Z
+	EventTsFormatRFC3339 = "rfc3339"
+)
+
+// EventTsConfig 事件时间提取配置
+// 提取成功写入 msg.EventTs；缺失、无法解析或者偏差过大时使用接收时间，并在元数据 eventTsFallback 记录原因
+type EventTsConfig struct {
+	// Source 来源，格式：{header|field|metadata|topic}:{name}
+	Source string `json:"source"`
+	// Format 时间格式：unixMs（默认）、unix、rfc3339 或者Go时间布局，例如：2006-01-02 15:04:05
+	Format string `json:"format"`
+	// MaxSkew 事件时间与接收时间允许的最大偏差，例如：1h，超过则使用接收时间。为空不检查
+	MaxSkew string `json:"maxSkew"`
+}
+
+// eventTsExtractor 编译后的事件时间提取器
+type eventTsExtractor struct {
+	sourceType string
+	name       string
+	topicIndex int
+	format     string
+	maxSkew    time.Duration
+}
+
+// newEventTsExtractor 根据from配置创建事件时间提取器，没有配置返回nil
+func newEventTsExtractor(config types.Configuration) (*eventTsExtractor, error) {
+	v, ok := config[KeyEventTs]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	var c EventTsConfig
+	if err := maps.Map2Struct(v, &c); err != nil {
+		return nil, fmt.Errorf("eventTs config error: %w", err)
+	}
+	sourceType, name, found := strings.Cut(c.Source, ":")
+	if !found || name == "" {
+		return nil, fmt.Errorf("eventTs source=%s is invalid, must be {header|field|metadata|topic}:{name}", c.Source)
+	}
+	e := &eventTsExtractor{sourceType: sourceType, name: name, format: c.Format}
+	switch sourceType {
+	case EventTsSourceHeader, EventTsSourceField, EventTsSourceMetadata:
+	case EventTsSourceTopic:
+		index, err := strconv.Atoi(name)
+		if err != nil {
+			return nil, fmt.Errorf("eventTs source=%s is invalid, topic segment must be a number", c.Source)
+		}
+		e.topicIndex = index
+	default:
+		return nil, fmt.Errorf("eventTs source=%s is invalid, unsupported source type", c.Source)
+	}
+	if e.format == "" {
+		e.format = EventTsFormatUnixMs
+	}
+	if c.MaxSkew != "" {
+		skew, err := time.ParseDuration(c.MaxSkew)
+		if err != nil {
+			return nil, fmt.Errorf("eventTs maxSkew error: %w", err)
+		}
+		e.maxSkew = skew
+	}
+	return e, nil
+}
+
+// extract 提取事件时间并写入消息
+func (e *eventTsExtractor) extract(exchange *endpoint.Exchange) {
+	if exchange == nil || exchange.In == nil {
+		return
+	}
+	msg := exchange.In.GetMsg()
+	if msg == nil {
+		return
+	}
+	raw := e.rawValue(exchange.In, msg)
+	if raw == "" {
+		fallbackEventTs(msg, types.EventTsFallbackMissing)
+		return
+	}
+	ts, err := ParseEventTs(raw, e.format)
+	if err != nil {
+		fallbackEventTs(msg, types.EventTsFallbackInvalid)
+		return
+	}
+	if e.maxSkew > 0 && math.Abs(float64(ts-msg.GetIngestTs())) > float64(e.maxSkew.Milliseconds()) {
+		fallbackEventTs(msg, types.EventTsFallbackSkewed)
+		return
+	}
+	msg.SetEventTs(ts)
+}
+
+func (e *eventTsExtractor) rawValue(in endpoint.Message, msg *types.RuleMsg) string {
+	switch e.sourceType {
+	case EventTsSourceHeader:
+		if headers := in.Headers(); headers != nil {
+			return headers.Get(e.name)
+		}
+	case EventTsSourceField:
+		if v, ok := msg.GetDataPath(e.name); ok && v != nil {
+			return str.ToString(v)
+		}
+	case EventTsSourceMetadata:
+		if msg.Metadata != nil {
+			return msg.Metadata.GetValue(e.name)
+		}
+	case EventTsSourceTopic:
+		segments := strings.Split(in.From(), "/")
+		index := e.topicIndex
+		if index < 0 {
+			index += len(segments)
+		}
+		if index >= 0 && index < len(segments) {
+			return segments[index]
+		}
+	}
+	return ""
+}
+
+// fallbackEventTs 使用接收时间作为事件时间，并记录原因
+func fallbackEventTs(msg *types.RuleMsg, reason string) {
+	msg.SetEventTs(msg.GetIngestTs())
+	if msg.Metadata == nil {
+		msg.Metadata = types.NewMetadata()
+	}
+	msg.Metadata.PutValue(types.MetadataKeyEventTsFallback, reason)
+}
+
+// ParseEventTs 按照格式把时间解析为毫秒时间戳
+// format：unixMs、unix、rfc3339 或者Go时间布局
+func ParseEventTs(value string, format string) (int64, error) {
+	value = strings.TrimSpace(value)
+	switch format {
+	case "", EventTsFormatUnixMs, EventTsFormatUnix:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, fmt.Errorf("invalid timestamp: %s", value)
+		}
+		if format == EventTsFormatUnix {
+			f = f * 1000
+		}
+		if f <= 0 {
+			return 0, errors.New("timestamp must be positive")
+		}
+		return int64(f), nil
+	case EventTsFormatRFC3339:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return 0, err
+		}
+		return t.UnixMilli(), nil
+	default:
+		t, err := time.Parse(format, value)
+		if err != nil {
+			return 0, err
+		}
+		return t.UnixMilli(), nil
+	}
+}
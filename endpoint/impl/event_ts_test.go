@@ -0,0 +1,109 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package impl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// topicRequestMessage 带主题的请求消息
+type topicRequestMessage struct {
+	testRequestMessage
+	topic string
+}
+
+func (r *topicRequestMessage) From() string {
+	return r.topic
+}
+
+func TestEventTs(t *testing.T) {
+	now := time.Now().UnixMilli()
+	eventTime := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+
+	extract := func(config map[string]interface{}, in endpoint.Message) *types.RuleMsg {
+		router := NewRouter().From("/device/+/telemetry", types.Configuration{KeyEventTs: config}).End()
+		assert.Nil(t, router.Err())
+		ep := &BaseEndpoint{}
+		ep.DoProcess(context.Background(), router, &endpoint.Exchange{In: in, Out: &testResponseMessage{}})
+		return in.GetMsg()
+	}
+
+	t.Run("Header", func(t *testing.T) {
+		in := &testRequestMessage{body: []byte(`{}`)}
+		in.Headers().Set("X-Event-Time", eventTime.Format(time.RFC3339Nano))
+		msg := extract(map[string]interface{}{"source": "header:X-Event-Time", "format": EventTsFormatRFC3339}, in)
+		assert.Equal(t, eventTime.UnixMilli(), msg.EventTs)
+		assert.True(t, msg.GetIngestTs() >= now)
+		assert.Equal(t, "", msg.Metadata.GetValue(types.MetadataKeyEventTsFallback))
+	})
+
+	t.Run("Field", func(t *testing.T) {
+		in := &testRequestMessage{body: []byte(`{"payload":{"ts":1704164645.006}}`)}
+		msg := extract(map[string]interface{}{"source": "field:payload.ts", "format": EventTsFormatUnix}, in)
+		assert.Equal(t, eventTime.UnixMilli(), msg.EventTs)
+		assert.Equal(t, eventTime.UnixMilli(), msg.GetTsBy(types.TsSourceEvent))
+	})
+
+	t.Run("TopicLayout", func(t *testing.T) {
+		in := &topicRequestMessage{testRequestMessage: testRequestMessage{body: []byte(`{}`)}, topic: "device/d1/20240102030405"}
+		msg := extract(map[string]interface{}{"source": "topic:-1", "format": "20060102150405"}, in)
+		assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMilli(), msg.EventTs)
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		//缺失
+		in := &testRequestMessage{body: []byte(`{}`)}
+		msg := extract(map[string]interface{}{"source": "field:ts"}, in)
+		assert.Equal(t, msg.GetIngestTs(), msg.EventTs)
+		assert.Equal(t, types.EventTsFallbackMissing, msg.Metadata.GetValue(types.MetadataKeyEventTsFallback))
+		//无法解析
+		in = &testRequestMessage{body: []byte(`{"ts":"abc"}`)}
+		msg = extract(map[string]interface{}{"source": "field:ts"}, in)
+		assert.Equal(t, msg.GetIngestTs(), msg.EventTs)
+		assert.Equal(t, types.EventTsFallbackInvalid, msg.Metadata.GetValue(types.MetadataKeyEventTsFallback))
+		//偏差过大
+		in = &testRequestMessage{body: []byte(`{"ts":1000}`)}
+		msg = extract(map[string]interface{}{"source": "field:ts", "maxSkew": "1h"}, in)
+		assert.Equal(t, msg.GetIngestTs(), msg.EventTs)
+		assert.Equal(t, types.EventTsFallbackSkewed, msg.Metadata.GetValue(types.MetadataKeyEventTsFallback))
+		//偏差范围内
+		in = &testRequestMessage{body: []byte(`{"ts":` + time.Now().Add(-time.Minute).Format("") + `}`)}
+		in = &testRequestMessage{body: []byte(`{"ts":"` + time.Now().Add(-time.Minute).Format(time.RFC3339) + `"}`)}
+		msg = extract(map[string]interface{}{"source": "field:ts", "format": EventTsFormatRFC3339, "maxSkew": "1h"}, in)
+		assert.True(t, msg.EventTs < msg.GetIngestTs())
+		assert.Equal(t, "", msg.Metadata.GetValue(types.MetadataKeyEventTsFallback))
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		for _, config := range []interface{}{
+			map[string]interface{}{"source": "ts"},
+			map[string]interface{}{"source": "body:ts"},
+			map[string]interface{}{"source": "topic:x"},
+			map[string]interface{}{"source": "field:ts", "maxSkew": "x"},
+			"bad",
+		} {
+			router := NewRouter().From("/a", types.Configuration{KeyEventTs: config}).End()
+			assert.NotNil(t, router.Err())
+		}
+	})
+}
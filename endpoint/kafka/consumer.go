@@ -0,0 +1,422 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// Handler 消息处理器，返回错误表示处理失败，提交位移模式下不提交该消息的位移
+type Handler func(ctx context.Context, msg kafka.Message) error
+
+// EventListener 消费者事件监听器，事件见 EventPartitionsAssigned、EventPartitionsRevoked、EventGroupError
+type EventListener func(eventName string, params ...interface{})
+
+// Consumer 消费者组成员，多个路由共享一个消费者组，订阅所有路由的主题
+// 每个分配的分区顺序处理消息，主题变化时重新加入消费者组，触发再平衡
+type Consumer struct {
+	config      Config
+	dialer      *kafka.Dialer
+	startOffset int64
+	logger      types.Logger
+	//主题和处理器映射
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	//消费者组运行状态
+	runMu   sync.Mutex
+	stop    context.CancelFunc
+	stopped chan struct{}
+	topics  []string
+	closed  bool
+	//事件监听器
+	listenerMu     sync.Mutex
+	listeners      map[int]EventListener
+	nextListenerId int
+}
+
+// NewConsumer 创建消费者，注册处理器后才加入消费者组
+func NewConsumer(config Config, logger types.Logger) (*Consumer, error) {
+	brokers := config.Brokers()
+	if len(brokers) == 0 {
+		return nil, errors.New("server can not empty")
+	}
+	if config.GroupId == "" {
+		return nil, errors.New("groupId can not empty")
+	}
+	var startOffset int64
+	switch config.StartOffset {
+	case "", StartOffsetLatest:
+		startOffset = kafka.LastOffset
+	case StartOffsetEarliest:
+		startOffset = kafka.FirstOffset
+	default:
+		return nil, fmt.Errorf("unsupported startOffset: %s", config.StartOffset)
+	}
+	dialer, err := newDialer(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Consumer{
+		config:      config,
+		dialer:      dialer,
+		startOffset: startOffset,
+		logger:      logger,
+		handlers:    make(map[string]Handler),
+		listeners:   make(map[int]EventListener),
+	}, nil
+}
+
+// newDialer 根据TLS和SASL配置创建连接器
+func newDialer(config Config) (*kafka.Dialer, error) {
+	dialer := &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
+	tlsConfig, err := config.TLS.NewTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	dialer.TLS = tlsConfig
+	switch strings.ToUpper(config.SASL.Mechanism) {
+	case "":
+	case SASLPlain:
+		dialer.SASLMechanism = plain.Mechanism{Username: config.SASL.Username, Password: config.SASL.Password}
+	case SASLScramSHA256:
+		if dialer.SASLMechanism, err = scram.Mechanism(scram.SHA256, config.SASL.Username, config.SASL.Password); err != nil {
+			return nil, err
+		}
+	case SASLScramSHA512:
+		if dialer.SASLMechanism, err = scram.Mechanism(scram.SHA512, config.SASL.Username, config.SASL.Password); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported sasl mechanism: %s", config.SASL.Mechanism)
+	}
+	return dialer, nil
+}
+
+// RegisterHandler 注册主题处理器，主题变化时重新加入消费者组
+func (c *Consumer) RegisterHandler(topic string, handler Handler) {
+	c.mu.Lock()
+	c.handlers[topic] = handler
+	c.mu.Unlock()
+	c.restart()
+}
+
+// UnregisterHandler 删除主题处理器，主题变化时重新加入消费者组
+func (c *Consumer) UnregisterHandler(topic string) {
+	c.mu.Lock()
+	delete(c.handlers, topic)
+	c.mu.Unlock()
+	c.restart()
+}
+
+// Topics 订阅的主题
+func (c *Consumer) Topics() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	topics := make([]string, 0, len(c.handlers))
+	for topic := range c.handlers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (c *Consumer) getHandler(topic string) Handler {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.handlers[topic]
+}
+
+// Close 离开消费者组
+func (c *Consumer) Close() error {
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	c.closed = true
+	c.stopLocked()
+	return nil
+}
+
+// AddEventListener 添加事件监听器，返回删除监听器的函数
+func (c *Consumer) AddEventListener(listener EventListener) (remove func()) {
+	c.listenerMu.Lock()
+	defer c.listenerMu.Unlock()
+	id := c.nextListenerId
+	c.nextListenerId++
+	c.listeners[id] = listener
+	return func() {
+		c.listenerMu.Lock()
+		defer c.listenerMu.Unlock()
+		delete(c.listeners, id)
+	}
+}
+
+func (c *Consumer) notify(eventName string, params ...interface{}) {
+	c.listenerMu.Lock()
+	listeners := make([]EventListener, 0, len(c.listeners))
+	for _, listener := range c.listeners {
+		listeners = append(listeners, listener)
+	}
+	c.listenerMu.Unlock()
+	for _, listener := range listeners {
+		listener(eventName, params...)
+	}
+}
+
+// restart 订阅的主题变化时，离开消费者组，使用新的主题重新加入
+func (c *Consumer) restart() {
+	topics := c.Topics()
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	if c.closed || (c.stop != nil && equalTopics(c.topics, topics)) {
+		return
+	}
+	c.stopLocked()
+	if len(topics) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	c.stop, c.stopped, c.topics = cancel, stopped, topics
+	go c.run(ctx, topics, stopped)
+}
+
+// stopLocked 停止消费者组并等待正在处理的消息结束，调用方需要持有 runMu
+func (c *Consumer) stopLocked() {
+	if c.stop != nil {
+		c.stop()
+		<-c.stopped
+		c.stop, c.stopped, c.topics = nil, nil, nil
+	}
+}
+
+// run 加入消费者组，每次再平衡后在新的分区分配上消费，直到 ctx 取消
+func (c *Consumer) run(ctx context.Context, topics []string, stopped chan struct{}) {
+	defer close(stopped)
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:          c.config.GroupId,
+		Brokers:     c.config.Brokers(),
+		Dialer:      c.dialer,
+		Topics:      topics,
+		StartOffset: c.startOffset,
+	})
+	if err != nil {
+		c.printf("kafka consumer group %s error: %v", c.config.GroupId, err)
+		c.notify(EventGroupError, c.config.GroupId, err)
+		return
+	}
+	defer func() {
+		_ = group.Close()
+	}()
+	for {
+		gen, err := group.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, kafka.ErrGroupClosed) {
+				return
+			}
+			//加入消费者组失败，由kafka-go退避后重试
+			c.printf("kafka consumer group %s error: %v", c.config.GroupId, err)
+			c.notify(EventGroupError, c.config.GroupId, err)
+			continue
+		}
+		c.consumeGeneration(gen)
+	}
+}
+
+// consumeGeneration 在分配的分区上消费，分区回收时触发 EventPartitionsRevoked 事件
+func (c *Consumer) consumeGeneration(gen *kafka.Generation) {
+	assignments := make(map[string][]int, len(gen.Assignments))
+	for topic, partitions := range gen.Assignments {
+		for _, partition := range partitions {
+			assignments[topic] = append(assignments[topic], partition.ID)
+		}
+	}
+	c.notify(EventPartitionsAssigned, c.config.GroupId, gen.ID, assignments)
+	offsets := newOffsetCommitter(gen.CommitOffsets, c.config.AutoCommit, c.printf)
+	gen.Start(func(ctx context.Context) {
+		if c.config.AutoCommit {
+			ticker := time.NewTicker(c.config.commitInterval())
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					//再平衡前提交已经处理的位移
+					offsets.flush()
+					c.notify(EventPartitionsRevoked, c.config.GroupId, gen.ID, assignments)
+					return
+				case <-ticker.C:
+					offsets.flush()
+				}
+			}
+		}
+		<-ctx.Done()
+		c.notify(EventPartitionsRevoked, c.config.GroupId, gen.ID, assignments)
+	})
+	for topic, partitions := range gen.Assignments {
+		for _, partition := range partitions {
+			topic, partition := topic, partition
+			gen.Start(func(ctx context.Context) {
+				c.consumePartition(ctx, topic, partition, offsets)
+			})
+		}
+	}
+}
+
+// consumePartition 从分配的位移开始顺序消费分区的消息，直到分区被回收
+// 分区消费函数退出会结束当前分配，所以读取出错时重试，不退出
+func (c *Consumer) consumePartition(ctx context.Context, topic string, partition kafka.PartitionAssignment, offsets *offsetCommitter) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   c.config.Brokers(),
+		Topic:     topic,
+		Partition: partition.ID,
+		Dialer:    c.dialer,
+	})
+	defer func() {
+		_ = reader.Close()
+	}()
+	if err := reader.SetOffset(partition.Offset); err != nil {
+		c.printf("kafka consumer set offset topic=%s partition=%d error: %v", topic, partition.ID, err)
+		<-ctx.Done()
+		return
+	}
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.printf("kafka consumer read topic=%s partition=%d error: %v", topic, partition.ID, err)
+			if !c.sleep(ctx, c.config.retryInterval()) {
+				return
+			}
+			continue
+		}
+		c.process(ctx, msg, offsets)
+	}
+}
+
+// process 处理消息，AutoCommit=false 时处理成功后提交位移，处理失败间隔 RetryInterval 重试，直到成功或者分区被回收
+func (c *Consumer) process(ctx context.Context, msg kafka.Message, offsets *offsetCommitter) {
+	for {
+		handler := c.getHandler(msg.Topic)
+		if handler == nil {
+			//路由已经删除，等待重新加入消费者组
+			return
+		}
+		err := handler(ctx, msg)
+		if err == nil || c.config.AutoCommit {
+			//提交的位移是下一条要消费的消息
+			offsets.mark(msg.Topic, msg.Partition, msg.Offset+1)
+			return
+		}
+		c.printf("kafka consumer process topic=%s partition=%d offset=%d error: %v, retry after %s",
+			msg.Topic, msg.Partition, msg.Offset, err, c.config.retryInterval())
+		if !c.sleep(ctx, c.config.retryInterval()) {
+			return
+		}
+	}
+}
+
+// sleep 等待 d，ctx 取消返回false
+func (c *Consumer) sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func (c *Consumer) printf(format string, v ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, v...)
+	}
+}
+
+// offsetCommitter 提交位移，自动提交模式下记录已经处理的位移，由 flush 定时提交，否则立即提交
+type offsetCommitter struct {
+	commit     func(offsets map[string]map[int]int64) error
+	autoCommit bool
+	log        func(format string, v ...interface{})
+	mu         sync.Mutex
+	pending    map[string]map[int]int64
+}
+
+func newOffsetCommitter(commit func(offsets map[string]map[int]int64) error, autoCommit bool, log func(format string, v ...interface{})) *offsetCommitter {
+	return &offsetCommitter{
+		commit:     commit,
+		autoCommit: autoCommit,
+		log:        log,
+		pending:    make(map[string]map[int]int64),
+	}
+}
+
+// mark 记录分区下一条要消费的位移
+func (o *offsetCommitter) mark(topic string, partition int, offset int64) {
+	if !o.autoCommit {
+		if err := o.commit(map[string]map[int]int64{topic: {partition: offset}}); err != nil {
+			//提交失败，再平衡后从上次提交的位移重新消费
+			o.log("kafka consumer commit topic=%s partition=%d offset=%d error: %v", topic, partition, offset, err)
+		}
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.pending[topic] == nil {
+		o.pending[topic] = make(map[int]int64)
+	}
+	o.pending[topic][partition] = offset
+}
+
+// flush 提交记录的位移
+func (o *offsetCommitter) flush() {
+	o.mu.Lock()
+	pending := o.pending
+	o.pending = make(map[string]map[int]int64)
+	o.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	if err := o.commit(pending); err != nil {
+		o.log("kafka consumer commit offsets error: %v", err)
+	}
+}
+
+// equalTopics 两组已经排序的主题是否相同
+func equalTopics(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
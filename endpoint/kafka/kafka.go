@@ -0,0 +1,503 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kafka provides a Kafka consumer group endpoint implementation for the RuleGo framework.
+// Each router subscribes to a topic, all routers of the endpoint join the same consumer group,
+// and the messages of each assigned partition are processed in order.
+//
+// By default the offset of a message is committed after the rule chain completes without error,
+// so routers must wait for the rule chain (To(...).Wait()). A failed message is retried until it succeeds
+// or the partition is revoked, and is then consumed again by the new owner of the partition.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/runtime"
+	"github.com/segmentio/kafka-go"
+)
+
+// Type 组件类型
+const Type = types.EndpointTypePrefix + "kafka"
+
+const (
+	// KeyTopic 消息主题 metadataKey
+	KeyTopic = "topic"
+	// KeyPartition 消息分区 metadataKey
+	KeyPartition = "partition"
+	// KeyOffset 消息位移 metadataKey
+	KeyOffset = "offset"
+	// KeyKey 消息分区键 metadataKey
+	KeyKey = "key"
+	// HeaderMetadataNamespace 消息头放到msg元数据的命名空间，例如消息头 traceId 的 metadataKey 为 header.traceId
+	HeaderMetadataNamespace = "header"
+)
+
+const (
+	// EventPartitionsAssigned 再平衡后分配到分区的事件，参数为消费者组ID、代ID(generationId)和分配的分区 map[string][]int，key为主题
+	EventPartitionsAssigned = "partitionsAssigned"
+	// EventPartitionsRevoked 再平衡前分区被回收的事件，参数和 EventPartitionsAssigned 相同
+	EventPartitionsRevoked = "partitionsRevoked"
+	// EventGroupError 加入消费者组失败的事件，参数为消费者组ID和错误，kafka-go 退避后重试
+	EventGroupError = "groupError"
+)
+
+const (
+	// StartOffsetLatest 消费者组没有提交过位移时，从最新的消息开始消费
+	StartOffsetLatest = "latest"
+	// StartOffsetEarliest 消费者组没有提交过位移时，从最早的消息开始消费
+	StartOffsetEarliest = "earliest"
+)
+
+// SASL 认证机制
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// DefaultCommitInterval 默认自动提交位移间隔，单位毫秒
+const DefaultCommitInterval = 1000
+
+// DefaultRetryInterval 默认处理失败重试间隔，单位毫秒
+const DefaultRetryInterval = 1000
+
+// Endpoint 别名
+type Endpoint = Kafka
+
+// SASLConfig SASL认证配置
+type SASLConfig struct {
+	// Mechanism 认证机制：PLAIN、SCRAM-SHA-256、SCRAM-SHA-512，为空不认证
+	Mechanism string `json:"mechanism"`
+	Username  string `json:"username"`
+	Password  string `json:"password" secret:"true"`
+}
+
+// Config Kafka 消费者配置
+type Config struct {
+	// Server kafka服务器地址，多个使用逗号隔开，例如：127.0.0.1:9092,127.0.0.1:9093
+	Server string `json:"server"`
+	// GroupId 消费者组ID，不能为空，默认rulego
+	GroupId string `json:"groupId"`
+	// AutoCommit 是否自动提交位移，默认false：规则链处理成功后提交消息的位移，处理失败间隔 RetryInterval 重试，路由必须同步(To.Wait)执行
+	// true：消息处理完成后不论成功与否都标记为已消费，每隔 CommitInterval 提交一次，进程退出时可能重复消费最后一个间隔的消息
+	AutoCommit bool `json:"autoCommit"`
+	// CommitInterval 自动提交位移的间隔，单位毫秒，默认1000
+	CommitInterval int `json:"commitInterval"`
+	// RetryInterval 处理失败或者读取失败的重试间隔，单位毫秒，默认1000
+	RetryInterval int `json:"retryInterval"`
+	// StartOffset 消费者组没有提交过位移时从哪里开始消费：latest(默认)、earliest
+	StartOffset string `json:"startOffset"`
+	// TLS TLS配置，为空不使用TLS
+	TLS types.TLSConfig `json:"tls"`
+	// SASL SASL认证配置
+	SASL SASLConfig `json:"sasl"`
+}
+
+// Brokers 服务器地址列表
+func (c Config) Brokers() []string {
+	var brokers []string
+	for _, item := range strings.Split(c.Server, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			brokers = append(brokers, item)
+		}
+	}
+	return brokers
+}
+
+func (c Config) commitInterval() time.Duration {
+	if c.CommitInterval <= 0 {
+		return DefaultCommitInterval * time.Millisecond
+	}
+	return time.Duration(c.CommitInterval) * time.Millisecond
+}
+
+func (c Config) retryInterval() time.Duration {
+	if c.RetryInterval <= 0 {
+		return DefaultRetryInterval * time.Millisecond
+	}
+	return time.Duration(c.RetryInterval) * time.Millisecond
+}
+
+// RequestMessage kafka 请求消息
+type RequestMessage struct {
+	headers textproto.MIMEHeader
+	request kafka.Message
+	body    []byte
+	msg     *types.RuleMsg
+	err     error
+}
+
+// Body 获取请求体
+func (r *RequestMessage) Body() []byte {
+	if r.body == nil {
+		r.body = r.request.Value
+	}
+	return r.body
+}
+
+// Headers 获取kafka消息头，以及主题、分区、位移和分区键
+func (r *RequestMessage) Headers() textproto.MIMEHeader {
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+		for _, item := range r.request.Headers {
+			r.headers.Add(item.Key, string(item.Value))
+		}
+		r.headers.Set(KeyTopic, r.request.Topic)
+		r.headers.Set(KeyPartition, strconv.Itoa(r.request.Partition))
+		r.headers.Set(KeyOffset, strconv.FormatInt(r.request.Offset, 10))
+		r.headers.Set(KeyKey, string(r.request.Key))
+	}
+	return r.headers
+}
+
+// From 获取主题
+func (r *RequestMessage) From() string {
+	return r.request.Topic
+}
+
+// GetParam 不提供获取参数
+func (r *RequestMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *RequestMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+// GetMsg 把kafka消息转换成规则链消息，主题、分区、位移和分区键放到元数据，消息头放到 header 命名空间
+func (r *RequestMessage) GetMsg() *types.RuleMsg {
+	if r.msg == nil {
+		ruleMsg := types.NewMsg(0, r.From(), types.JSON, types.NewMetadata(), string(r.Body()))
+		ruleMsg.Metadata.PutValue(KeyTopic, r.request.Topic)
+		ruleMsg.Metadata.PutValue(KeyPartition, strconv.Itoa(r.request.Partition))
+		ruleMsg.Metadata.PutValue(KeyOffset, strconv.FormatInt(r.request.Offset, 10))
+		ruleMsg.Metadata.PutValue(KeyKey, string(r.request.Key))
+		headers := ruleMsg.Metadata.Sub(HeaderMetadataNamespace)
+		for _, item := range r.request.Headers {
+			headers.PutValue(item.Key, string(item.Value))
+		}
+		r.msg = &ruleMsg
+	}
+	return r.msg
+}
+
+// SetStatusCode 不提供设置状态码
+func (r *RequestMessage) SetStatusCode(statusCode int) {
+}
+
+// SetBody 设置消息体
+func (r *RequestMessage) SetBody(body []byte) {
+	r.body = body
+}
+
+func (r *RequestMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *RequestMessage) GetError() error {
+	return r.err
+}
+
+// Request 获取kafka消息
+func (r *RequestMessage) Request() kafka.Message {
+	return r.request
+}
+
+// ResponseMessage kafka 响应消息，消费端不回复，只记录规则链的处理结果
+type ResponseMessage struct {
+	headers textproto.MIMEHeader
+	request kafka.Message
+	body    []byte
+	msg     *types.RuleMsg
+	err     error
+}
+
+func (r *ResponseMessage) Body() []byte {
+	return r.body
+}
+
+func (r *ResponseMessage) Headers() textproto.MIMEHeader {
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+	}
+	return r.headers
+}
+
+func (r *ResponseMessage) From() string {
+	return r.request.Topic
+}
+
+// GetParam 不提供获取参数
+func (r *ResponseMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *ResponseMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+func (r *ResponseMessage) GetMsg() *types.RuleMsg {
+	return r.msg
+}
+
+func (r *ResponseMessage) SetStatusCode(statusCode int) {
+}
+
+func (r *ResponseMessage) SetBody(body []byte) {
+	r.body = body
+}
+
+func (r *ResponseMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *ResponseMessage) GetError() error {
+	return r.err
+}
+
+// Kafka Kafka 消费者组接收端端点，路由from为订阅的主题
+// 相同服务器和消费者组的端点使用共享资源池(ref://)时共享一个消费者组成员，订阅所有端点路由的主题
+type Kafka struct {
+	impl.BaseEndpoint
+	base.SharedNode[*Consumer]
+	RuleConfig types.Config
+	Config     Config
+	consumer   *Consumer
+	//删除消费者事件监听器
+	removeListener func()
+	started        bool
+}
+
+// Type 组件类型
+func (x *Kafka) Type() string {
+	return Type
+}
+
+func (x *Kafka) New() types.Node {
+	return &Kafka{Config: Config{
+		Server:  "127.0.0.1:9092",
+		GroupId: "rulego",
+	}}
+}
+
+// Init 初始化
+func (x *Kafka) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	if err := maps.Map2Struct(configuration, &x.Config); err != nil {
+		return err
+	}
+	x.RuleConfig = ruleConfig
+	if !base.NodeUtils.IsNetPool(ruleConfig, x.Config.Server) {
+		//提前校验配置，共享资源池的消费者由资源池校验
+		if _, err := NewConsumer(x.Config, nil); err != nil {
+			return err
+		}
+	}
+	return x.SharedNode.Init(x.RuleConfig, x.Type(), x.Config.Server, false, func() (*Consumer, error) {
+		return x.initConsumer()
+	})
+}
+
+// Destroy 销毁
+func (x *Kafka) Destroy() {
+	_ = x.Close()
+}
+
+// Close 删除路由订阅的主题，如果消费者不是来自共享资源池，则离开消费者组
+func (x *Kafka) Close() error {
+	x.Lock()
+	removeListener := x.removeListener
+	x.removeListener = nil
+	routers := make([]endpoint.Router, 0, len(x.RouterStorage))
+	for _, router := range x.RouterStorage {
+		routers = append(routers, router)
+	}
+	x.started = false
+	x.Unlock()
+	if removeListener != nil {
+		removeListener()
+	}
+	if x.SharedNode.IsFromPool() {
+		if consumer, _ := x.SharedNode.Get(); consumer != nil {
+			for _, router := range routers {
+				consumer.UnregisterHandler(router.FromToString())
+			}
+		}
+		return nil
+	}
+	if x.consumer != nil {
+		return x.consumer.Close()
+	}
+	return nil
+}
+
+func (x *Kafka) Id() string {
+	return x.Config.Server
+}
+
+// AddRouter 添加路由，路由from为订阅的主题。AutoCommit=false 时路由必须同步(To.Wait)执行
+func (x *Kafka) AddRouter(router endpoint.Router, params ...interface{}) (string, error) {
+	if router == nil {
+		return "", errors.New("router can not nil")
+	}
+	if router.FromToString() == "" {
+		return "", errors.New("topic can not empty")
+	}
+	if !x.Config.AutoCommit {
+		//规则链执行结束才提交位移
+		if from := router.GetFrom(); from != nil && from.GetTo() != nil && !from.GetTo().IsWait() {
+			return "", errors.New("committing after processing requires the router to wait for the rule chain, use To(...).Wait() or set autoCommit=true")
+		}
+	}
+	x.CheckAndSetRouterId(router)
+	x.saveRouter(router)
+	if x.started {
+		consumer, err := x.SharedNode.Get()
+		if err != nil {
+			return "", err
+		}
+		consumer.RegisterHandler(router.FromToString(), x.handler(router))
+	}
+	return router.GetId(), nil
+}
+
+func (x *Kafka) RemoveRouter(routerId string, params ...interface{}) error {
+	router := x.deleteRouter(routerId)
+	if router == nil {
+		return fmt.Errorf("router: %s not found", routerId)
+	}
+	if !x.started {
+		return nil
+	}
+	if consumer, _ := x.SharedNode.Get(); consumer != nil {
+		consumer.UnregisterHandler(router.FromToString())
+	}
+	return nil
+}
+
+// Start 注册所有路由的主题，加入消费者组
+func (x *Kafka) Start() error {
+	if x.started {
+		return nil
+	}
+	consumer, err := x.SharedNode.Get()
+	if err != nil {
+		return err
+	}
+	x.Lock()
+	x.removeListener = consumer.AddEventListener(x.onConsumerEvent)
+	routers := make([]endpoint.Router, 0, len(x.RouterStorage))
+	for _, router := range x.RouterStorage {
+		routers = append(routers, router)
+	}
+	x.started = true
+	x.Unlock()
+	for _, router := range routers {
+		consumer.RegisterHandler(router.FromToString(), x.handler(router))
+	}
+	return nil
+}
+
+// 存储路由
+func (x *Kafka) saveRouter(routers ...endpoint.Router) {
+	x.Lock()
+	defer x.Unlock()
+	if x.RouterStorage == nil {
+		x.RouterStorage = make(map[string]endpoint.Router)
+	}
+	for _, item := range routers {
+		x.RouterStorage[item.GetId()] = item
+	}
+}
+
+// 从存储器中删除路由
+func (x *Kafka) deleteRouter(id string) endpoint.Router {
+	x.Lock()
+	defer x.Unlock()
+	if x.RouterStorage != nil {
+		if router, ok := x.RouterStorage[id]; ok {
+			delete(x.RouterStorage, id)
+			return router
+		}
+	}
+	return nil
+}
+
+// handler 消息处理器，返回规则链的处理错误，AutoCommit=false 时有错误不提交位移
+// ctx 在分区被回收时取消
+func (x *Kafka) handler(router endpoint.Router) Handler {
+	return func(ctx context.Context, msg kafka.Message) (err error) {
+		defer func() {
+			//捕捉异常
+			if e := recover(); e != nil {
+				x.Printf("kafka endpoint handler err :\n%v", runtime.Stack())
+				err = fmt.Errorf("kafka endpoint handler panic: %v", e)
+			}
+		}()
+		exchange := &endpoint.Exchange{
+			In: &RequestMessage{
+				request: msg,
+			},
+			Out: &ResponseMessage{
+				request: msg,
+			}}
+		x.DoProcess(ctx, router, exchange)
+		return exchange.Out.GetError()
+	}
+}
+
+// onConsumerEvent 把消费者组的再平衡事件转发给 OnEvent，加入消费者组失败发布 types.EventResourceUnhealthy 事件
+func (x *Kafka) onConsumerEvent(eventName string, params ...interface{}) {
+	if eventName == EventGroupError && len(params) > 1 {
+		data := map[string]interface{}{"type": x.Type(), "groupId": x.Config.GroupId}
+		if err, ok := params[1].(error); ok {
+			data["error"] = err.Error()
+		}
+		x.RuleConfig.PublishEvent(types.EventResourceUnhealthy, x.Config.Server, data)
+	}
+	if x.OnEvent != nil {
+		x.OnEvent(eventName, params...)
+	}
+}
+
+func (x *Kafka) Printf(format string, v ...interface{}) {
+	if x.RuleConfig.Logger != nil {
+		x.RuleConfig.Logger.Printf(format, v...)
+	}
+}
+
+// initConsumer 初始化消费者
+func (x *Kafka) initConsumer() (*Consumer, error) {
+	x.Lock()
+	defer x.Unlock()
+	if x.consumer != nil {
+		return x.consumer, nil
+	}
+	var err error
+	x.consumer, err = NewConsumer(x.Config, x.RuleConfig.Logger)
+	return x.consumer, err
+}
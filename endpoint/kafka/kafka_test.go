@@ -0,0 +1,267 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/segmentio/kafka-go"
+)
+
+var testServer = "127.0.0.1:9092"
+
+// 测试请求/响应消息
+func TestKafkaMessage(t *testing.T) {
+	t.Run("Request", func(t *testing.T) {
+		test.EndpointMessage(t, &RequestMessage{})
+	})
+	t.Run("Response", func(t *testing.T) {
+		test.EndpointMessage(t, &ResponseMessage{})
+	})
+	t.Run("Metadata", func(t *testing.T) {
+		request := &RequestMessage{request: kafka.Message{
+			Topic:     "device.data",
+			Partition: 2,
+			Offset:    15,
+			Key:       []byte("device01"),
+			Value:     []byte(`{"temperature":41}`),
+			Headers:   []kafka.Header{{Key: "traceId", Value: []byte("t1")}},
+		}}
+		msg := request.GetMsg()
+		assert.Equal(t, `{"temperature":41}`, msg.GetData())
+		assert.Equal(t, "device.data", msg.Type)
+		assert.Equal(t, "device.data", msg.Metadata.GetValue(KeyTopic))
+		assert.Equal(t, "2", msg.Metadata.GetValue(KeyPartition))
+		assert.Equal(t, "15", msg.Metadata.GetValue(KeyOffset))
+		assert.Equal(t, "device01", msg.Metadata.GetValue(KeyKey))
+		assert.Equal(t, "t1", msg.Metadata.GetValue(HeaderMetadataNamespace+".traceId"))
+		assert.Equal(t, "t1", request.Headers().Get("traceId"))
+		assert.Equal(t, "device01", request.Headers().Get(KeyKey))
+	})
+}
+
+func TestKafkaInit(t *testing.T) {
+	config := engine.NewConfig()
+	ep := &Kafka{}
+	assert.NotNil(t, ep.Init(config, types.Configuration{"server": "127.0.0.1:9092"}))
+	assert.NotNil(t, ep.Init(config, types.Configuration{"server": "", "groupId": "g1"}))
+	assert.NotNil(t, ep.Init(config, types.Configuration{"server": "127.0.0.1:9092", "groupId": "g1", "startOffset": "xx"}))
+	assert.NotNil(t, ep.Init(config, types.Configuration{"server": "127.0.0.1:9092", "groupId": "g1", "sasl": map[string]interface{}{"mechanism": "xx"}}))
+
+	ep = &Kafka{}
+	err := ep.Init(config, types.Configuration{
+		"server":  "127.0.0.1:9092, 127.0.0.1:9093",
+		"groupId": "g1",
+		"sasl":    map[string]interface{}{"mechanism": "scram-sha-512", "username": "u", "password": "p"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"127.0.0.1:9092", "127.0.0.1:9093"}, ep.Config.Brokers())
+	assert.Equal(t, DefaultRetryInterval*time.Millisecond, ep.Config.retryInterval())
+	assert.Equal(t, Type, ep.Type())
+	assert.Equal(t, "127.0.0.1:9092", ep.New().(*Kafka).Config.Server)
+
+	//提交位移需要同步执行规则链
+	_, err = ep.AddRouter(impl.NewRouter().From("device.data").To("chain:default").End())
+	assert.NotNil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From("").End())
+	assert.NotNil(t, err)
+	routerId, err := ep.AddRouter(impl.NewRouter().From("device.data").To("chain:default").Wait().End())
+	assert.Nil(t, err)
+	assert.Nil(t, ep.RemoveRouter(routerId))
+	assert.NotNil(t, ep.RemoveRouter(routerId))
+
+	ep = &Kafka{}
+	assert.Nil(t, ep.Init(config, types.Configuration{"server": "127.0.0.1:9092", "groupId": "g1", "autoCommit": true}))
+	_, err = ep.AddRouter(impl.NewRouter().From("device.data").To("chain:default").End())
+	assert.Nil(t, err)
+}
+
+func TestKafkaHandler(t *testing.T) {
+	ruleChain := `{
+	  "ruleChain": {"id": "kafkaHandlerTest"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsFilter", "configuration": {"jsScript": "if (msg.fail) { throw 'fail'; } return metadata.key === 'device01';"}}
+		]
+	  }
+	}`
+	config := engine.NewConfig(types.WithDefaultPool())
+	_, err := engine.New("kafkaHandlerTest", []byte(ruleChain), engine.WithConfig(config))
+	assert.Nil(t, err)
+	defer engine.Del("kafkaHandlerTest")
+
+	ep := &Kafka{}
+	assert.Nil(t, ep.Init(config, types.Configuration{"server": testServer, "groupId": "g1"}))
+	handler := ep.handler(impl.NewRouter().From("device.data").To("chain:kafkaHandlerTest").Wait().End())
+	msg := kafka.Message{Topic: "device.data", Key: []byte("device01"), Value: []byte(`{"temperature":41}`)}
+	assert.Nil(t, handler(context.Background(), msg))
+	//规则链处理失败，不提交位移
+	msg.Value = []byte(`{"fail":true}`)
+	assert.NotNil(t, handler(context.Background(), msg))
+
+	//处理过程发生异常
+	handler = ep.handler(impl.NewRouter().From("device.data").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		panic("test")
+	}).End())
+	assert.NotNil(t, handler(context.Background(), msg))
+}
+
+func TestKafkaEvent(t *testing.T) {
+	var events []string
+	ep := &Kafka{RuleConfig: engine.NewConfig()}
+	ep.SetOnEvent(func(eventName string, params ...interface{}) {
+		events = append(events, eventName)
+		if eventName == EventPartitionsAssigned {
+			assert.Equal(t, "g1", params[0])
+			assert.Equal(t, map[string][]int{"device.data": {0, 1}}, params[2])
+		}
+	})
+	consumer, err := NewConsumer(Config{Server: testServer, GroupId: "g1"}, nil)
+	assert.Nil(t, err)
+	remove := consumer.AddEventListener(ep.onConsumerEvent)
+	consumer.notify(EventPartitionsAssigned, "g1", int32(1), map[string][]int{"device.data": {0, 1}})
+	consumer.notify(EventPartitionsRevoked, "g1", int32(1), map[string][]int{"device.data": {0, 1}})
+	consumer.notify(EventGroupError, "g1", errors.New("test"))
+	remove()
+	consumer.notify(EventPartitionsAssigned, "g1", int32(2), map[string][]int{"device.data": {0, 1}})
+	assert.Equal(t, []string{EventPartitionsAssigned, EventPartitionsRevoked, EventGroupError}, events)
+}
+
+func TestKafkaConsumerProcess(t *testing.T) {
+	var mu sync.Mutex
+	var commits []map[string]map[int]int64
+	commit := func(offsets map[string]map[int]int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		commits = append(commits, offsets)
+		return nil
+	}
+	msg := kafka.Message{Topic: "device.data", Partition: 1, Offset: 9}
+
+	t.Run("CommitAfterProcess", func(t *testing.T) {
+		commits = nil
+		consumer, err := NewConsumer(Config{Server: testServer, GroupId: "g1", RetryInterval: 10}, nil)
+		assert.Nil(t, err)
+		var count int
+		consumer.handlers["device.data"] = func(ctx context.Context, msg kafka.Message) error {
+			//处理失败重试，成功后提交位移
+			if count++; count < 3 {
+				return errors.New("fail")
+			}
+			return nil
+		}
+		consumer.process(context.Background(), msg, newOffsetCommitter(commit, false, t.Logf))
+		assert.Equal(t, 3, count)
+		assert.Equal(t, []map[string]map[int]int64{{"device.data": {1: 10}}}, commits)
+
+		//分区被回收，停止重试，不提交位移
+		commits = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		consumer.handlers["device.data"] = func(ctx context.Context, msg kafka.Message) error {
+			cancel()
+			return errors.New("fail")
+		}
+		consumer.process(ctx, msg, newOffsetCommitter(commit, false, t.Logf))
+		assert.Equal(t, 0, len(commits))
+	})
+
+	t.Run("AutoCommit", func(t *testing.T) {
+		commits = nil
+		consumer, err := NewConsumer(Config{Server: testServer, GroupId: "g1", AutoCommit: true}, nil)
+		assert.Nil(t, err)
+		var count int
+		consumer.handlers["device.data"] = func(ctx context.Context, msg kafka.Message) error {
+			count++
+			return errors.New("fail")
+		}
+		offsets := newOffsetCommitter(commit, true, t.Logf)
+		consumer.process(context.Background(), msg, offsets)
+		msg.Offset++
+		consumer.process(context.Background(), msg, offsets)
+		assert.Equal(t, 2, count)
+		assert.Equal(t, 0, len(commits))
+		offsets.flush()
+		offsets.flush()
+		assert.Equal(t, []map[string]map[int]int64{{"device.data": {1: 11}}}, commits)
+	})
+}
+
+// 需要kafka服务器，没有则跳过
+func TestKafkaEndpoint(t *testing.T) {
+	conn, err := net.DialTimeout("tcp", testServer, time.Second)
+	if err != nil {
+		t.Skip("kafka broker is not available: " + testServer)
+	}
+	_ = conn.Close()
+
+	topic := fmt.Sprintf("rulego-test-%d", time.Now().UnixNano())
+	kafkaConn, err := kafka.DialLeader(context.Background(), "tcp", testServer, topic, 0)
+	assert.Nil(t, err)
+	_ = kafkaConn.Close()
+
+	var events sync.Map
+	received := make(chan *types.RuleMsg, 1)
+	ep := &Kafka{}
+	err = ep.Init(engine.NewConfig(), types.Configuration{
+		"server":      testServer,
+		"groupId":     topic,
+		"startOffset": StartOffsetEarliest,
+	})
+	assert.Nil(t, err)
+	ep.SetOnEvent(func(eventName string, params ...interface{}) {
+		events.Store(eventName, true)
+	})
+	_, err = ep.AddRouter(impl.NewRouter().From(topic).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		received <- exchange.In.GetMsg()
+		return true
+	}).End())
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+
+	writer := kafka.NewWriter(kafka.WriterConfig{Brokers: []string{testServer}, Topic: topic})
+	defer writer.Close()
+	err = writer.WriteMessages(context.Background(), kafka.Message{
+		Key:     []byte("device01"),
+		Value:   []byte(`{"temperature":41}`),
+		Headers: []kafka.Header{{Key: "traceId", Value: []byte("t1")}},
+	})
+	assert.Nil(t, err)
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, `{"temperature":41}`, msg.GetData())
+		assert.Equal(t, "device01", msg.Metadata.GetValue(KeyKey))
+		assert.Equal(t, "t1", msg.Metadata.GetValue(HeaderMetadataNamespace+".traceId"))
+	case <-time.After(30 * time.Second):
+		t.Fatal("timeout")
+	}
+	_, ok := events.Load(EventPartitionsAssigned)
+	assert.True(t, ok)
+}
@@ -38,6 +38,7 @@ import (
 	"github.com/rulego/rulego/utils/mqtt"
 	"net/textproto"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rulego/rulego/utils/cast"
@@ -59,8 +60,30 @@ const (
 	KeyResponseTopic = "responseTopic"
 	// KeyResponseQos 响应Qos metadataKey
 	KeyResponseQos = "responseQos"
+	// KeyMessageId 消息ID metadataKey，手动确认模式下可用于重发消息去重
+	KeyMessageId = "messageId"
+	// KeyDuplicate 是否是broker重发的消息 metadataKey，手动确认模式下有效
+	KeyDuplicate = "duplicate"
 )
 
+// 手动确认模式下，规则链处理失败时的处理策略
+const (
+	// NackPolicyRequeue 不确认消息，断开连接后重新连接，由broker重发该消息以及之后所有未确认的消息，
+	// 需要持久会话(CleanSession=false)，默认策略。重发的消息元数据 duplicate=true，需要按照 messageId 或者消息内容幂等处理，
+	// 一直处理失败的消息会一直重发，这类消息应该使用 deadLetter 或者 republish 策略
+	NackPolicyRequeue = "requeue"
+	// NackPolicyRepublish 把原消息发布到重发主题 RedeliveryTopic，成功后确认
+	NackPolicyRepublish = "republish"
+	// NackPolicyDeadLetter 交给 types.Config.OnDeadLetter 处理后确认
+	NackPolicyDeadLetter = "deadLetter"
+)
+
+// DefaultReplyTopic 默认回复主题
+const DefaultReplyTopic = "${topic}/reply"
+
+// DefaultMaxUnacked 默认最大未确认消息数量
+const DefaultMaxUnacked = 100
+
 // Endpoint 别名
 type Endpoint = Mqtt
 
@@ -71,6 +94,10 @@ type RequestMessage struct {
 	body    []byte
 	msg     *types.RuleMsg
 	err     error
+	//是否手动确认模式
+	manualAck bool
+	//消息来源，用于replyTo节点回复
+	origin endpoint.Origin
 }
 
 // Body 获取请求体
@@ -112,6 +139,11 @@ func (r *RequestMessage) GetMsg() *types.RuleMsg {
 	if r.msg == nil {
 		ruleMsg := types.NewMsg(0, r.From(), types.JSON, types.NewMetadata(), string(r.Body()))
 		ruleMsg.Metadata.PutValue(KeyRequestTopic, r.From())
+		if r.manualAck && r.request != nil {
+			ruleMsg.Metadata.PutValue(KeyMessageId, strconv.Itoa(int(r.request.MessageID())))
+			ruleMsg.Metadata.PutValue(KeyDuplicate, strconv.FormatBool(r.request.Duplicate()))
+		}
+		r.origin.PutToMetadata(ruleMsg.Metadata)
 		r.msg = &ruleMsg
 	}
 	return r.msg
@@ -221,14 +253,47 @@ func (r *ResponseMessage) Response() paho.Client {
 	return r.response
 }
 
+// AckConfig 手动确认配置，配置 ManualAck=true 后生效
+//
+// 手动确认模式下：
+//   - 路由必须以同步(To.Wait)方式执行，否则 AddRouter 返回错误，规则链执行结束且没有错误才发送PUBACK，处理中途进程退出的消息由broker重发
+//   - 消息并发处理，PUBACK按照收到消息的顺序发送，之前收到的消息都处理完成后才发送
+//   - 规则链执行失败按照 NackPolicy 处理
+//   - 消息元数据增加 messageId 和 duplicate，用于重发消息的幂等处理
+//   - 使用独立的MQTT连接，不会和相同服务器的自动确认端点共享连接，使用共享资源池(ref://)的连接时，连接的确认模式必须和端点一致
+//   - 同一条消息匹配多个路由时，第一个路由处理完成后确认
+type AckConfig struct {
+	// MaxUnacked 最大未确认(处理中)消息数量，达到后暂停接收消息，默认100
+	MaxUnacked int `json:"maxUnacked"`
+	// NackPolicy 规则链处理失败时的处理策略：requeue(默认)、republish、deadLetter
+	NackPolicy string `json:"nackPolicy"`
+	// RedeliveryTopic 重发主题，NackPolicy=republish 时必须配置
+	RedeliveryTopic string `json:"redeliveryTopic"`
+}
+
+// ReplyConfig 回复配置
+type ReplyConfig struct {
+	// ReplyTopic 回复主题，写入消息元数据 originReplyTopic，replyTo节点把回复发布到该主题
+	// 支持 ${topic} 引用请求主题，默认 ${topic}/reply
+	ReplyTopic string `json:"replyTopic"`
+}
+
 // Mqtt MQTT 接收端端点
 type Mqtt struct {
 	impl.BaseEndpoint
 	base.SharedNode[*mqtt.Client]
 	RuleConfig types.Config
 	Config     mqtt.Config
-	client     *mqtt.Client
-	started    bool
+	// AckConfig 手动确认配置
+	AckConfig AckConfig
+	// ReplyConfig 回复配置
+	ReplyConfig ReplyConfig
+	// SubscriptionConfig 订阅配置
+	SubscriptionConfig SubscriptionConfig
+	client             *mqtt.Client
+	started            bool
+	//未确认消息窗口
+	unacked chan struct{}
 }
 
 // Type 组件类型
@@ -255,15 +320,69 @@ func (x *Mqtt) Init(ruleConfig types.Config, configuration types.Configuration)
 		}
 	}
 	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	if err = mqtt.CheckProtocolVersion(x.Config.ProtocolVersion); err != nil {
+		return err
+	}
 	x.RuleConfig = ruleConfig
-	_ = x.SharedNode.Init(x.RuleConfig, x.Type(), x.Config.Server, true, func() (*mqtt.Client, error) {
+	if err = maps.Map2Struct(configuration, &x.ReplyConfig); err != nil {
+		return err
+	}
+	if x.ReplyConfig.ReplyTopic == "" {
+		x.ReplyConfig.ReplyTopic = DefaultReplyTopic
+	}
+	if err = maps.Map2Struct(configuration, &x.SubscriptionConfig); err != nil {
+		return err
+	}
+	instanceId := x.Config.Server
+	if x.Config.ManualAck {
+		if err = x.initAck(configuration); err != nil {
+			return err
+		}
+		//手动确认的连接不和自动确认的端点共享，共享资源池的连接在获取时检查确认模式
+		if !base.NodeUtils.IsNetPool(ruleConfig, x.Config.Server) {
+			instanceId = x.Config.Server + "#manualAck"
+		}
+	}
+	_ = x.SharedNode.Init(x.RuleConfig, x.Type(), instanceId, true, func() (*mqtt.Client, error) {
 		return x.initClient()
 	})
-	return err
+	return nil
+}
+
+// initAck 初始化手动确认配置
+func (x *Mqtt) initAck(configuration types.Configuration) error {
+	if err := maps.Map2Struct(configuration, &x.AckConfig); err != nil {
+		return err
+	}
+	switch x.AckConfig.NackPolicy {
+	case "", NackPolicyRequeue:
+		x.AckConfig.NackPolicy = NackPolicyRequeue
+		if x.Config.CleanSession {
+			//非持久会话重连后broker不会重发
+			return errors.New("nack policy requeue requires cleanSession=false")
+		}
+	case NackPolicyDeadLetter:
+	case NackPolicyRepublish:
+		if x.AckConfig.RedeliveryTopic == "" {
+			return errors.New("redeliveryTopic can not empty")
+		}
+	default:
+		return fmt.Errorf("unsupported nack policy: %s", x.AckConfig.NackPolicy)
+	}
+	if x.AckConfig.MaxUnacked <= 0 {
+		x.AckConfig.MaxUnacked = DefaultMaxUnacked
+	}
+	x.unacked = make(chan struct{}, x.AckConfig.MaxUnacked)
+	return nil
 }
 
 // Destroy 销毁
 func (x *Mqtt) Destroy() {
+	x.UnregisterOrigin()
+	x.RuleConfig.RemoveHealth(types.HealthResourcePrefix + x.Config.Server)
 	_ = x.Close()
 }
 
@@ -283,18 +402,28 @@ func (x *Mqtt) AddRouter(router endpoint.Router, params ...interface{}) (string,
 		return "", errors.New("router can not nil")
 	}
 	x.CheckAndSetRouterId(router)
+	sub, err := x.subscription(router)
+	if err != nil {
+		return "", err
+	}
+	if x.Config.ManualAck {
+		//手动确认需要等待规则链执行结束
+		if from := router.GetFrom(); from != nil && from.GetTo() != nil && !from.GetTo().IsWait() {
+			return "", errors.New("manual ack requires the router to wait for the rule chain, use To(...).Wait()")
+		}
+	}
 	x.saveRouter(router)
 	//服务已经启动
 	if x.started {
 		if form := router.GetFrom(); form != nil {
-			client, err := x.SharedNode.Get()
+			client, err := x.getClient()
 			if err != nil {
 				return "", err
 			}
 			client.RegisterHandler(mqtt.Handler{
-				Topic:  form.ToString(),
-				Qos:    x.Config.QOS,
-				Handle: x.handler(router),
+				Topic:  sub.topic,
+				Qos:    sub.qos,
+				Handle: x.handler(router, client.AckQueue()),
 			})
 		}
 	}
@@ -306,7 +435,9 @@ func (x *Mqtt) RemoveRouter(routerId string, params ...interface{}) error {
 	if router != nil {
 		client, _ := x.SharedNode.Get()
 		if client != nil {
-			return client.UnregisterHandler(router.FromToString())
+			//使用实际订阅的主题取消订阅
+			sub, _ := x.subscription(router)
+			return client.UnregisterHandler(sub.topic)
 		} else {
 			return nil
 		}
@@ -319,16 +450,23 @@ func (x *Mqtt) Start() error {
 	if x.started {
 		return nil
 	}
-	client, err := x.SharedNode.Get()
+	client, err := x.getClient()
 	if err != nil {
 		return err
 	}
+	x.RegisterOrigin(x)
+	//broker连接断开时就绪检查失败
+	x.RuleConfig.RegisterHealth(types.HealthResourcePrefix+x.Config.Server, client.Health)
 	for _, router := range x.RouterStorage {
 		if form := router.GetFrom(); form != nil {
+			sub, err := x.subscription(router)
+			if err != nil {
+				return err
+			}
 			client.RegisterHandler(mqtt.Handler{
-				Topic:  form.ToString(),
-				Qos:    x.Config.QOS,
-				Handle: x.handler(router),
+				Topic:  sub.topic,
+				Qos:    sub.qos,
+				Handle: x.handler(router, client.AckQueue()),
 			})
 		}
 	}
@@ -336,6 +474,20 @@ func (x *Mqtt) Start() error {
 	return nil
 }
 
+// getClient 获取客户端，使用共享资源池的连接时，检查连接的确认模式是否和端点一致
+// 自动确认的连接不会等待手动确认，手动确认的连接收到自动确认端点的消息不会确认
+func (x *Mqtt) getClient() (*mqtt.Client, error) {
+	client, err := x.SharedNode.Get()
+	if err != nil {
+		return nil, err
+	}
+	if x.SharedNode.IsFromPool() && client.ManualAck() != x.Config.ManualAck {
+		return nil, fmt.Errorf("shared mqtt client %s manualAck=%t does not match the endpoint manualAck=%t",
+			x.Config.Server, client.ManualAck(), x.Config.ManualAck)
+	}
+	return client, nil
+}
+
 // 存储路由
 func (x *Mqtt) saveRouter(routers ...endpoint.Router) {
 	x.Lock()
@@ -361,25 +513,105 @@ func (x *Mqtt) deleteRouter(id string) endpoint.Router {
 	return nil
 }
 
-func (x *Mqtt) handler(router endpoint.Router) func(c paho.Client, data paho.Message) {
+// handler 订阅回调，acks 连接的手动确认队列，自动确认模式为nil
+func (x *Mqtt) handler(router endpoint.Router, acks *mqtt.AckQueue) func(c paho.Client, data paho.Message) {
 	return func(c paho.Client, data paho.Message) {
-		defer func() {
-			//捕捉异常
-			if e := recover(); e != nil {
-				x.Printf("mqtt endpoint handler err :\n%v", runtime.Stack())
-			}
+		if !x.Config.ManualAck || acks == nil {
+			x.process(router, c, data, nil)
+			return
+		}
+		//未确认消息达到上限时阻塞，暂停接收消息
+		x.unacked <- struct{}{}
+		//在订阅回调中按照收到的顺序入队，并发处理后按照该顺序确认
+		pending := acks.Push(data)
+		go func() {
+			defer func() {
+				<-x.unacked
+			}()
+			x.process(router, c, data, pending)
 		}()
-		exchange := &endpoint.Exchange{
-			In: &RequestMessage{
-				request: data,
+	}
+}
+
+// process 处理消息，手动确认模式下根据处理结果确认消息，处理过程发生异常则不确认
+func (x *Mqtt) process(router endpoint.Router, c paho.Client, data paho.Message, pending *mqtt.PendingAck) {
+	acked := false
+	defer func() {
+		if pending != nil {
+			pending.Done(acked)
+		}
+		//捕捉异常
+		if e := recover(); e != nil {
+			x.Printf("mqtt endpoint handler err :\n%v", runtime.Stack())
+		}
+	}()
+	exchange := &endpoint.Exchange{
+		In: &RequestMessage{
+			request:   data,
+			manualAck: x.Config.ManualAck,
+			origin: endpoint.Origin{
+				Type:       Type,
+				Id:         x.OriginId(),
+				ReplyTopic: x.replyTopic(data.Topic()),
 			},
-			Out: &ResponseMessage{
-				request:  data,
-				response: c,
-			}}
+		},
+		Out: &ResponseMessage{
+			request:  data,
+			response: c,
+		}}
+
+	x.DoProcess(context.Background(), router, exchange)
+	if pending != nil {
+		acked = x.ack(router, c, data, exchange)
+	}
+}
 
-		x.DoProcess(context.Background(), router, exchange)
+// ack 规则链执行成功则确认消息，否则按照 NackPolicy 处理，返回是否确认
+// 确认由 mqtt.AckQueue 按照收到消息的顺序发送
+func (x *Mqtt) ack(router endpoint.Router, c paho.Client, data paho.Message, exchange *endpoint.Exchange) bool {
+	err := exchange.Out.GetError()
+	if err == nil {
+		return true
 	}
+	switch x.AckConfig.NackPolicy {
+	case NackPolicyRepublish:
+		if token := c.Publish(x.AckConfig.RedeliveryTopic, data.Qos(), false, data.Payload()); token.Wait() && token.Error() != nil {
+			//发布失败不确认，由broker重发
+			x.Printf("mqtt endpoint republish to %s err :%v", x.AckConfig.RedeliveryTopic, token.Error())
+			return false
+		}
+		return true
+	case NackPolicyDeadLetter:
+		if x.RuleConfig.OnDeadLetter != nil {
+			var ruleChainId string
+			if from := router.GetFrom(); from != nil && from.GetTo() != nil {
+				ruleChainId = from.GetTo().ToString()
+			}
+			x.RuleConfig.OnDeadLetter(ruleChainId, "", *exchange.In.GetMsg(), err)
+		}
+		return true
+	default:
+		//不确认，重连后broker重发
+		return false
+	}
+}
+
+// replyTopic 根据请求主题生成回复主题
+func (x *Mqtt) replyTopic(topic string) string {
+	return strings.ReplaceAll(x.ReplyConfig.ReplyTopic, "${topic}", topic)
+}
+
+// Reply 把消息数据发布到消息来源的回复主题(元数据 originReplyTopic)，Qos使用端点配置的Qos
+func (x *Mqtt) Reply(msg types.RuleMsg) error {
+	topic := msg.Metadata.GetValue(endpoint.OriginReplyTopicKey)
+	if topic == "" {
+		return errors.New("reply topic is empty")
+	}
+	client, err := x.SharedNode.Get()
+	if err != nil {
+		return err
+	}
+	return client.Publish(topic, x.Config.QOS, msg.GetBytes())
 }
 
 func (x *Mqtt) Printf(format string, v ...interface{}) {
@@ -404,6 +636,22 @@ func (x *Mqtt) initClient() (*mqtt.Client, error) {
 		}
 		var err error
 		x.client, err = mqtt.NewClient(ctx, x.Config)
+		if err == nil {
+			x.client.AddStateListener(x.onStateChange)
+		}
 		return x.client, err
 	}
 }
+
+// onStateChange 连接断开发布 types.EventResourceUnhealthy 事件，重连成功发布 types.EventResourceRecovered 事件
+func (x *Mqtt) onStateChange(connected bool, err error) {
+	if connected {
+		x.RuleConfig.PublishEvent(types.EventResourceRecovered, x.Config.Server, map[string]interface{}{"type": x.Type()})
+		return
+	}
+	data := map[string]interface{}{"type": x.Type()}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	x.RuleConfig.PublishEvent(types.EventResourceUnhealthy, x.Config.Server, data)
+}
@@ -1,7 +1,10 @@
 package mqtt
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/rulego/rulego/api/types"
 	endpoint "github.com/rulego/rulego/api/types/endpoint"
 	"github.com/rulego/rulego/endpoint/impl"
@@ -10,8 +13,12 @@ import (
 	"github.com/rulego/rulego/test/assert"
 	"github.com/rulego/rulego/utils/maps"
 	"github.com/rulego/rulego/utils/mqtt"
+	"net"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -65,6 +72,15 @@ func TestRouterId(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("router: %s not found", "/device/info"), err.Error())
 }
 
+func TestMqttProtocolVersion(t *testing.T) {
+	//不支持MQTT 5
+	err := (&Endpoint{}).Init(types.NewConfig(), types.Configuration{"server": testServer, "protocolVersion": 5})
+	assert.True(t, errors.Is(err, mqtt.ErrProtocolVersionNotSupported))
+	ep := &Endpoint{}
+	assert.Nil(t, ep.Init(types.NewConfig(), types.Configuration{"server": testServer, "protocolVersion": 4}))
+	assert.Equal(t, uint(4), ep.Config.ProtocolVersion)
+}
+
 func TestMqttEndpoint(t *testing.T) {
 	stop := make(chan struct{})
 	//启动服务
@@ -176,3 +192,400 @@ func startServer(t *testing.T, stop chan struct{}) {
 	<-stop
 	ep.Destroy()
 }
+
+// testAckMessage 模拟broker推送的消息
+type testAckMessage struct {
+	topic     string
+	payload   []byte
+	id        uint16
+	duplicate bool
+	acked     chan struct{}
+}
+
+func newTestAckMessage(id uint16, payload string, duplicate bool) *testAckMessage {
+	return &testAckMessage{topic: "/device/ack", payload: []byte(payload), id: id, duplicate: duplicate, acked: make(chan struct{}, 1)}
+}
+
+func (m *testAckMessage) Duplicate() bool   { return m.duplicate }
+func (m *testAckMessage) Qos() byte         { return 1 }
+func (m *testAckMessage) Retained() bool    { return false }
+func (m *testAckMessage) Topic() string     { return m.topic }
+func (m *testAckMessage) MessageID() uint16 { return m.id }
+func (m *testAckMessage) Payload() []byte   { return m.payload }
+func (m *testAckMessage) Ack()              { m.acked <- struct{}{} }
+
+// isAcked 等待消息被确认
+func (m *testAckMessage) isAcked() bool {
+	select {
+	case <-m.acked:
+		return true
+	case <-time.After(time.Millisecond * 500):
+		return false
+	}
+}
+
+// testAckClient 记录发布的消息
+type testAckClient struct {
+	paho.Client
+	published chan string
+}
+
+func (c *testAckClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	c.published <- topic + ":" + string(payload.([]byte))
+	return &paho.DummyToken{}
+}
+
+// testNetPool 共享资源池，只提供 GetInstance
+type testNetPool struct {
+	types.NodePool
+	client *mqtt.Client
+}
+
+func (p *testNetPool) GetInstance(id string) (interface{}, error) {
+	return p.client, nil
+}
+
+func TestMqttManualAck(t *testing.T) {
+	ruleChain := `{
+	  "ruleChain": {"id": "manualAckTest"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsFilter", "configuration": {"jsScript": "if (msg.fail) { throw 'fail'; } return true;"}}
+		]
+	  }
+	}`
+	var processed sync.Map
+	config := engine.NewConfig(types.WithDefaultPool())
+	_, err := engine.New("manualAckTest", []byte(ruleChain), engine.WithConfig(config))
+	assert.Nil(t, err)
+	defer engine.Del("manualAckTest")
+
+	newEndpoint := func(configuration types.Configuration) *Mqtt {
+		ep := &Mqtt{Config: mqtt.Config{ManualAck: true}, RuleConfig: config}
+		err := ep.initAck(configuration)
+		assert.Nil(t, err)
+		return ep
+	}
+	newRouter := func(ep *Mqtt) endpoint.Router {
+		router := impl.NewRouter().From("/device/ack").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			msg := exchange.In.GetMsg()
+			//按照消息ID去重
+			if _, ok := processed.LoadOrStore(msg.Metadata.GetValue(KeyMessageId), true); ok {
+				assert.Equal(t, "true", msg.Metadata.GetValue(KeyDuplicate))
+				return false
+			}
+			return true
+		}).To("chain:manualAckTest").Wait().End()
+		_, err := ep.AddRouter(router)
+		assert.Nil(t, err)
+		return router
+	}
+	//模拟客户端：队首消息不确认时断开重连，清空队列
+	var nacks int32
+	newAckQueue := func() *mqtt.AckQueue {
+		var acks *mqtt.AckQueue
+		acks = mqtt.NewAckQueue(func() {
+			atomic.AddInt32(&nacks, 1)
+			acks.Reset()
+		})
+		return acks
+	}
+
+	t.Run("InitAck", func(t *testing.T) {
+		assert.NotNil(t, (&Mqtt{}).initAck(types.Configuration{"nackPolicy": "xx"}))
+		assert.NotNil(t, (&Mqtt{}).initAck(types.Configuration{"nackPolicy": NackPolicyRepublish}))
+		ep := &Mqtt{}
+		assert.Nil(t, ep.initAck(types.Configuration{}))
+		assert.Equal(t, NackPolicyRequeue, ep.AckConfig.NackPolicy)
+		assert.Equal(t, DefaultMaxUnacked, cap(ep.unacked))
+		//非持久会话不能重发
+		ep = &Mqtt{Config: mqtt.Config{CleanSession: true}}
+		assert.NotNil(t, ep.initAck(types.Configuration{}))
+		assert.Nil(t, ep.initAck(types.Configuration{"nackPolicy": NackPolicyDeadLetter}))
+	})
+
+	t.Run("RequireWait", func(t *testing.T) {
+		ep := newEndpoint(types.Configuration{})
+		_, err := ep.AddRouter(impl.NewRouter().From("/device/ack").To("chain:manualAckTest").End())
+		assert.NotNil(t, err)
+		//没有To的路由同步执行
+		_, err = ep.AddRouter(impl.NewRouter().From("/device/ack").End())
+		assert.Nil(t, err)
+	})
+
+	t.Run("SharedClient", func(t *testing.T) {
+		config := engine.NewConfig()
+		config.NetPool = &testNetPool{client: &mqtt.Client{}}
+		//共享连接是自动确认模式
+		ep := &Mqtt{}
+		assert.Nil(t, ep.Init(config, types.Configuration{"server": "ref://sharedMqtt", "manualAck": true}))
+		err := ep.Start()
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "does not match"))
+
+		ep = &Mqtt{}
+		assert.Nil(t, ep.Init(config, types.Configuration{"server": "ref://sharedMqtt"}))
+		_, err = ep.getClient()
+		assert.Nil(t, err)
+	})
+
+	t.Run("Order", func(t *testing.T) {
+		ep := newEndpoint(types.Configuration{})
+		acks := newAckQueue()
+		release := make(chan struct{})
+		router := impl.NewRouter().From("/device/ack").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			if exchange.In.GetMsg().GetData() == "first" {
+				<-release
+			}
+			return false
+		}).End()
+		handler := ep.handler(router, acks)
+		first := newTestAckMessage(7, "first", false)
+		second := newTestAckMessage(8, "second", false)
+		handler(&testAckClient{}, first)
+		handler(&testAckClient{}, second)
+		//第二条消息先处理完成，等待第一条消息确认后才确认
+		assert.False(t, second.isAcked())
+		close(release)
+		assert.True(t, first.isAcked())
+		assert.True(t, second.isAcked())
+		assert.Equal(t, 0, acks.Len())
+	})
+
+	t.Run("Requeue", func(t *testing.T) {
+		ep := newEndpoint(types.Configuration{"maxUnacked": 2})
+		handler := ep.handler(newRouter(ep), newAckQueue())
+		client := &testAckClient{published: make(chan string, 1)}
+
+		ok := newTestAckMessage(1, `{"fail":false}`, false)
+		handler(client, ok)
+		assert.True(t, ok.isAcked())
+
+		//处理失败，不确认，断开重连后broker重发
+		processed.Delete("2")
+		failed := newTestAckMessage(2, `{"fail":true}`, false)
+		handler(client, failed)
+		assert.False(t, failed.isAcked())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&nacks))
+		processed.Delete("2")
+		//broker重发，处理成功后确认
+		redelivered := newTestAckMessage(2, `{"fail":false}`, true)
+		handler(client, redelivered)
+		assert.True(t, redelivered.isAcked())
+
+		//已经处理过的重发消息，去重后确认
+		duplicate := newTestAckMessage(1, `{"fail":false}`, true)
+		handler(client, duplicate)
+		assert.True(t, duplicate.isAcked())
+		processed = sync.Map{}
+	})
+
+	t.Run("Republish", func(t *testing.T) {
+		ep := newEndpoint(types.Configuration{"nackPolicy": NackPolicyRepublish, "redeliveryTopic": "/device/retry"})
+		handler := ep.handler(newRouter(ep), newAckQueue())
+		client := &testAckClient{published: make(chan string, 1)}
+		failed := newTestAckMessage(3, `{"fail":true}`, false)
+		handler(client, failed)
+		assert.True(t, failed.isAcked())
+		assert.Equal(t, `/device/retry:{"fail":true}`, <-client.published)
+		processed = sync.Map{}
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		deadLetters := make(chan string, 1)
+		ep := newEndpoint(types.Configuration{"nackPolicy": NackPolicyDeadLetter})
+		ep.RuleConfig.OnDeadLetter = func(ruleChainId string, nodeId string, msg types.RuleMsg, err error) {
+			deadLetters <- ruleChainId + ":" + msg.Metadata.GetValue(KeyMessageId)
+		}
+		handler := ep.handler(newRouter(ep), newAckQueue())
+		failed := newTestAckMessage(4, `{"fail":true}`, false)
+		handler(&testAckClient{}, failed)
+		assert.True(t, failed.isAcked())
+		assert.Equal(t, "manualAckTest:4", <-deadLetters)
+		processed = sync.Map{}
+	})
+
+	t.Run("MaxUnacked", func(t *testing.T) {
+		ep := newEndpoint(types.Configuration{"maxUnacked": 1})
+		block := make(chan struct{})
+		router := impl.NewRouter().From("/device/ack").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			<-block
+			return false
+		}).End()
+		handler := ep.handler(router, newAckQueue())
+		first := newTestAckMessage(5, `{}`, false)
+		handler(&testAckClient{}, first)
+		received := make(chan struct{})
+		go func() {
+			//窗口已满，阻塞接收
+			handler(&testAckClient{}, newTestAckMessage(6, `{}`, false))
+			close(received)
+		}()
+		select {
+		case <-received:
+			t.Fatal("expected blocking when unacked window is full")
+		case <-time.After(time.Millisecond * 100):
+		}
+		close(block)
+		<-received
+		assert.True(t, first.isAcked())
+	})
+}
+
+// 测试手动确认模式下，规则链处理失败不确认，断开重连后broker重发，重发的重复消息去重后确认
+// 需要本地运行mqtt broker，否则跳过
+func TestMqttManualAckRedelivery(t *testing.T) {
+	conn, err := net.DialTimeout("tcp", testServer, time.Second)
+	if err != nil {
+		t.Skip("mqtt broker is not available: " + testServer)
+	}
+	_ = conn.Close()
+
+	ruleChain := `{
+	  "ruleChain": {"id": "manualAckRedeliveryTest"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsFilter", "configuration": {"jsScript": "if (msg.fail) { throw 'fail'; } return true;"}}
+		]
+	  }
+	}`
+	config := engine.NewConfig(types.WithDefaultPool())
+	_, err = engine.New("manualAckRedeliveryTest", []byte(ruleChain), engine.WithConfig(config))
+	assert.Nil(t, err)
+	defer engine.Del("manualAckRedeliveryTest")
+
+	topic := fmt.Sprintf("/device/ack/%d", time.Now().UnixNano())
+	payload := `{"fail":true}`
+	//投递记录，值为duplicate标记
+	deliveries := make(chan string, 10)
+	//已经执行过规则链的消息
+	var processed sync.Map
+	var chainCount int32
+
+	//使用相同的clientId和持久会话，断开重连后broker重发未确认的消息
+	startEndpoint := func() *Mqtt {
+		ep := &Mqtt{}
+		err := ep.Init(config, types.Configuration{
+			"server":       testServer,
+			"clientId":     "manualAckRedeliveryTest",
+			"cleanSession": false,
+			"manualAck":    true,
+			"qos":          1,
+		})
+		assert.Nil(t, err)
+		router := impl.NewRouter().From(topic).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			msg := exchange.In.GetMsg()
+			if msg.GetData() != payload {
+				return false
+			}
+			deliveries <- msg.Metadata.GetValue(KeyDuplicate)
+			//按照消息内容去重，重复消息不再执行规则链
+			if _, ok := processed.LoadOrStore(msg.GetData(), true); ok {
+				return false
+			}
+			atomic.AddInt32(&chainCount, 1)
+			return true
+		}).To("chain:manualAckRedeliveryTest").Wait().End()
+		_, err = ep.AddRouter(router)
+		assert.Nil(t, err)
+		assert.Nil(t, ep.Start())
+		return ep
+	}
+	waitDelivery := func() string {
+		select {
+		case duplicate := <-deliveries:
+			return duplicate
+		case <-time.After(time.Second * 5):
+			t.Fatal("wait delivery timeout")
+			return ""
+		}
+	}
+
+	ep := startEndpoint()
+	publisher, err := mqtt.NewClient(context.Background(), mqtt.Config{Server: testServer, ClientID: "manualAckRedeliveryPublisher"})
+	assert.Nil(t, err)
+	defer publisher.Close()
+	assert.Nil(t, publisher.Publish(topic, 1, []byte(payload)))
+
+	//规则链处理失败，不确认
+	assert.Equal(t, "false", waitDelivery())
+
+	//客户端断开重连，broker重发，重复消息去重后确认
+	assert.Equal(t, "true", waitDelivery())
+	time.Sleep(time.Millisecond * 200)
+	ep.Destroy()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&chainCount))
+
+	//已经确认，broker不再重发
+	ep = startEndpoint()
+	defer ep.Destroy()
+	select {
+	case <-deliveries:
+		t.Fatal("acked message should not be redelivered")
+	case <-time.After(time.Second):
+	}
+}
+
+func TestMqttReply(t *testing.T) {
+	ep := &Mqtt{ReplyConfig: ReplyConfig{ReplyTopic: DefaultReplyTopic}}
+	originId := ep.RegisterOrigin(ep)
+	defer ep.UnregisterOrigin()
+	replier, ok := endpoint.GetReplier(originId)
+	assert.True(t, ok)
+	assert.Equal(t, ep, replier)
+
+	var msg types.RuleMsg
+	router := impl.NewRouter().From("/device/ack").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		msg = *exchange.In.GetMsg()
+		return false
+	}).End()
+	ep.handler(router, nil)(&testAckClient{}, newTestAckMessage(1, `{}`, false))
+	origin := endpoint.OriginFromMetadata(msg.Metadata)
+	assert.Equal(t, Type, origin.Type)
+	assert.Equal(t, originId, origin.Id)
+	assert.Equal(t, "/device/ack/reply", origin.ReplyTopic)
+
+	ep.ReplyConfig.ReplyTopic = "/reply${topic}"
+	assert.Equal(t, "/reply/device/ack", ep.replyTopic("/device/ack"))
+	assert.NotNil(t, ep.Reply(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}")))
+
+	ep.UnregisterOrigin()
+	_, ok = endpoint.GetReplier(originId)
+	assert.False(t, ok)
+}
+
+func TestMqttSubscription(t *testing.T) {
+	ep := &Endpoint{}
+	assert.Nil(t, ep.Init(types.NewConfig(), types.Configuration{"server": testServer, "qos": 1, "group": "rulego"}))
+	assert.Equal(t, "rulego", ep.SubscriptionConfig.Group)
+
+	router := impl.NewRouter().From("/device/+/data").End()
+	sub, err := ep.subscription(router)
+	assert.Nil(t, err)
+	assert.Equal(t, subscription{topic: "$share/rulego//device/+/data", qos: 1}, sub)
+	//路由id仍然是原主题
+	routerId, err := ep.AddRouter(router)
+	assert.Nil(t, err)
+	assert.Equal(t, "/device/+/data", routerId)
+
+	//路由配置覆盖端点配置
+	router = impl.NewRouter().From("device/alarm", types.Configuration{KeyQos: 2, KeyGroup: "alarm"}).End()
+	sub, err = ep.subscription(router)
+	assert.Nil(t, err)
+	assert.Equal(t, subscription{topic: "$share/alarm/device/alarm", qos: 2}, sub)
+	//不使用共享订阅
+	router = impl.NewRouter().From("device/log", types.Configuration{KeyQos: "0", KeyGroup: ""}).End()
+	sub, err = ep.subscription(router)
+	assert.Nil(t, err)
+	assert.Equal(t, subscription{topic: "device/log", qos: 0}, sub)
+	//已经是共享订阅主题
+	router = impl.NewRouter().From("$share/g1/device/event").End()
+	sub, err = ep.subscription(router)
+	assert.Nil(t, err)
+	assert.Equal(t, "$share/g1/device/event", sub.topic)
+
+	for _, configuration := range []types.Configuration{{KeyQos: 3}, {KeyQos: "x"}, {KeyGroup: "a/b"}} {
+		_, err = ep.AddRouter(impl.NewRouter().From("device/error", configuration).End())
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/cast"
+	"github.com/rulego/rulego/utils/str"
+)
+
+const (
+	// KeyQos 路由from配置：订阅的Qos，覆盖端点配置的Qos
+	KeyQos = "qos"
+	// KeyGroup 路由from配置：共享订阅的分组，覆盖 SubscriptionConfig.Group
+	KeyGroup = "group"
+	// SharePrefix 共享订阅主题的前缀，例如：$share/group1/device/+/data
+	SharePrefix = "$share/"
+)
+
+// SubscriptionConfig 订阅配置
+type SubscriptionConfig struct {
+	// Group 共享订阅的分组，配置后路由主题改写为 $share/{group}/{topic} 订阅，
+	// 同一分组的多个端点实例分摊消息，每条消息只由其中一个实例处理。路由id仍然是原主题
+	Group string `json:"group"`
+}
+
+// subscription 路由的订阅信息
+type subscription struct {
+	// topic 实际订阅的主题，共享订阅时包括 $share/{group}/ 前缀
+	topic string
+	qos   byte
+}
+
+// subscription 获取路由实际订阅的主题和Qos，路由from配置优先于端点配置
+// 路由主题已经是 $share/ 形式时不改写
+func (x *Mqtt) subscription(router endpoint.Router) (subscription, error) {
+	topic := router.FromToString()
+	sub := subscription{topic: topic, qos: x.Config.QOS}
+	group := x.SubscriptionConfig.Group
+	if from, ok := router.GetFrom().(*impl.From); ok && from != nil {
+		if v, ok := from.Config[KeyQos]; ok && v != nil {
+			qos, err := cast.ToIntE(v)
+			if err != nil {
+				return sub, fmt.Errorf("router %s qos config error: %w", router.GetId(), err)
+			}
+			if qos < 0 || qos > 2 {
+				return sub, fmt.Errorf("router %s qos config error: invalid qos %d", router.GetId(), qos)
+			}
+			sub.qos = byte(qos)
+		}
+		if v, ok := from.Config[KeyGroup]; ok && v != nil {
+			group = str.ToString(v)
+		}
+	}
+	if group == "" || strings.HasPrefix(topic, SharePrefix) {
+		return sub, nil
+	}
+	if strings.ContainsAny(group, "/+#") {
+		return sub, fmt.Errorf("router %s group config error: invalid group %s", router.GetId(), group)
+	}
+	sub.topic = SharePrefix + group + "/" + topic
+	return sub, nil
+}
@@ -0,0 +1,692 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package nats provides a NATS endpoint implementation for the RuleGo framework.
+// Each router subscribes to a subject, which may contain the wildcards * and >,
+// optionally in a queue group so that several endpoint instances share the messages.
+//
+// When an incoming message has a reply subject (request-reply), routers that wait for the rule chain
+// publish the result back to the reply subject, the same way the rest endpoint writes the HTTP response.
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/runtime"
+	"github.com/rulego/rulego/utils/str"
+
+	natsio "github.com/nats-io/nats.go"
+)
+
+// Type 组件类型
+const Type = types.EndpointTypePrefix + "nats"
+
+const (
+	// KeySubject 消息主题 metadataKey
+	KeySubject = "subject"
+	// KeyReplySubject 回复主题 metadataKey，请求-响应模式下有值
+	KeyReplySubject = "replySubject"
+	// WildcardMetadataNamespace 路由主题通配符匹配的主题片段放到msg元数据的命名空间，按照通配符出现的顺序从0编号，
+	// 例如：路由主题 device.*.data.> 收到 device.d1.data.temp.c 的消息，元数据 wildcard.0=d1，wildcard.1=temp.c
+	WildcardMetadataNamespace = "wildcard"
+	// HeaderMetadataNamespace 消息头放到msg元数据的命名空间，例如消息头 traceId 的 metadataKey 为 header.traceId
+	HeaderMetadataNamespace = "header"
+	// KeyError 回复消息中规则链处理错误的消息头
+	KeyError = "error"
+)
+
+const (
+	// KeyQueueGroup 路由from配置：队列组，覆盖 Config.QueueGroup，空字符串表示不使用队列组
+	KeyQueueGroup = "queueGroup"
+)
+
+// DefaultReconnectWait 默认重连间隔，单位毫秒
+const DefaultReconnectWait = 2000
+
+// Endpoint 别名
+type Endpoint = Nats
+
+// Config NATS 配置
+type Config struct {
+	// Server NATS服务器地址，多个使用逗号隔开，例如：nats://127.0.0.1:4222
+	Server string `json:"server"`
+	// Username 用户名
+	Username string `json:"username"`
+	// Password 密码
+	Password string `json:"password" secret:"true"`
+	// Token 认证令牌
+	Token string `json:"token" secret:"true"`
+	// QueueGroup 队列组，配置后同一队列组的多个端点实例分摊消息，每条消息只由其中一个实例处理
+	QueueGroup string `json:"queueGroup"`
+	// MaxReconnects 最大重连次数，默认-1，无限重连。超过后连接关闭，端点重新建立连接并重新订阅所有路由
+	MaxReconnects int `json:"maxReconnects"`
+	// ReconnectWait 重连间隔，单位毫秒，默认2000
+	ReconnectWait int `json:"reconnectWait"`
+	// TLS TLS配置，为空不使用TLS
+	TLS types.TLSConfig `json:"tls"`
+}
+
+func (c Config) reconnectWait() time.Duration {
+	if c.ReconnectWait <= 0 {
+		return DefaultReconnectWait * time.Millisecond
+	}
+	return time.Duration(c.ReconnectWait) * time.Millisecond
+}
+
+// RequestMessage nats 请求消息
+type RequestMessage struct {
+	headers textproto.MIMEHeader
+	request *natsio.Msg
+	//路由订阅的主题，用于提取通配符匹配的主题片段
+	pattern string
+	body    []byte
+	msg     *types.RuleMsg
+	err     error
+}
+
+// Body 获取请求体
+func (r *RequestMessage) Body() []byte {
+	if r.body == nil && r.request != nil {
+		r.body = r.request.Data
+	}
+	return r.body
+}
+
+// Headers 获取nats消息头，以及消息主题，nats消息头区分大小写，这里的key按照MIME规范转换，原始的key见元数据 header 命名空间
+func (r *RequestMessage) Headers() textproto.MIMEHeader {
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+		if r.request != nil {
+			for k, values := range r.request.Header {
+				for _, v := range values {
+					r.headers.Add(k, v)
+				}
+			}
+			r.headers.Set(KeySubject, r.request.Subject)
+		}
+	}
+	return r.headers
+}
+
+// From 获取主题
+func (r *RequestMessage) From() string {
+	if r.request == nil {
+		return ""
+	}
+	return r.request.Subject
+}
+
+// GetParam 不提供获取参数
+func (r *RequestMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *RequestMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+// GetMsg 把nats消息转换成规则链消息，主题、回复主题、通配符匹配的主题片段和消息头放到元数据
+func (r *RequestMessage) GetMsg() *types.RuleMsg {
+	if r.msg == nil {
+		ruleMsg := types.NewMsg(0, r.From(), types.JSON, types.NewMetadata(), string(r.Body()))
+		if r.request != nil {
+			ruleMsg.Metadata.PutValue(KeySubject, r.request.Subject)
+			if r.request.Reply != "" {
+				ruleMsg.Metadata.PutValue(KeyReplySubject, r.request.Reply)
+			}
+			wildcards := ruleMsg.Metadata.Sub(WildcardMetadataNamespace)
+			for i, token := range wildcardTokens(r.pattern, r.request.Subject) {
+				wildcards.PutValue(strconv.Itoa(i), token)
+			}
+			headers := ruleMsg.Metadata.Sub(HeaderMetadataNamespace)
+			for k := range r.request.Header {
+				headers.PutValue(k, r.request.Header.Get(k))
+			}
+		}
+		r.msg = &ruleMsg
+	}
+	return r.msg
+}
+
+// SetStatusCode 不提供设置状态码
+func (r *RequestMessage) SetStatusCode(statusCode int) {
+}
+
+// SetBody 设置消息体
+func (r *RequestMessage) SetBody(body []byte) {
+	r.body = body
+}
+
+func (r *RequestMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *RequestMessage) GetError() error {
+	return r.err
+}
+
+// Request 获取nats消息
+func (r *RequestMessage) Request() *natsio.Msg {
+	return r.request
+}
+
+// publisher 发布回复消息
+type publisher interface {
+	PublishMsg(m *natsio.Msg) error
+}
+
+// ResponseMessage nats 响应消息，请求消息有回复主题时，SetBody 把响应体发布到回复主题
+type ResponseMessage struct {
+	headers   textproto.MIMEHeader
+	request   *natsio.Msg
+	publisher publisher
+	body      []byte
+	msg       *types.RuleMsg
+	err       error
+	//是否已经回复，每个请求只回复一次
+	replied bool
+	mu      sync.Mutex
+}
+
+func (r *ResponseMessage) Body() []byte {
+	return r.body
+}
+
+// Headers 响应头，回复时作为nats消息头发送，key按照MIME规范转换，例如：Content-Type
+func (r *ResponseMessage) Headers() textproto.MIMEHeader {
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+	}
+	return r.headers
+}
+
+func (r *ResponseMessage) From() string {
+	if r.request == nil {
+		return ""
+	}
+	return r.request.Subject
+}
+
+// GetParam 不提供获取参数
+func (r *ResponseMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *ResponseMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+func (r *ResponseMessage) GetMsg() *types.RuleMsg {
+	return r.msg
+}
+
+func (r *ResponseMessage) SetStatusCode(statusCode int) {
+}
+
+// SetBody 设置响应体，请求消息有回复主题时发布到回复主题
+func (r *ResponseMessage) SetBody(body []byte) {
+	r.body = body
+	if err := r.reply(body, nil); err != nil {
+		r.err = err
+	}
+}
+
+func (r *ResponseMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *ResponseMessage) GetError() error {
+	return r.err
+}
+
+// reply 发布回复消息，请求消息没有回复主题或者已经回复则忽略
+// processErr 不为空时，错误信息放到消息头 KeyError，服务器不支持消息头时作为消息体
+func (r *ResponseMessage) reply(body []byte, processErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.replied || r.request == nil || r.request.Reply == "" || r.publisher == nil {
+		return nil
+	}
+	r.replied = true
+	msg := natsio.NewMsg(r.request.Reply)
+	msg.Data = body
+	for k, v := range r.headers {
+		msg.Header[k] = v
+	}
+	if processErr != nil {
+		msg.Header.Set(KeyError, processErr.Error())
+	}
+	err := r.publisher.PublishMsg(msg)
+	if errors.Is(err, natsio.ErrHeadersNotSupported) {
+		if processErr != nil {
+			msg.Data = []byte(processErr.Error())
+		}
+		msg.Header = nil
+		err = r.publisher.PublishMsg(msg)
+	}
+	return err
+}
+
+// Nats NATS 接收端端点，路由from为订阅的主题
+type Nats struct {
+	impl.BaseEndpoint
+	base.SharedNode[*natsio.Conn]
+	RuleConfig types.Config
+	Config     Config
+	conn       *natsio.Conn
+	//路由ID和订阅映射
+	subscriptions map[string]*natsio.Subscription
+	subMu         sync.Mutex
+	started       bool
+	//端点已经销毁，不再重新连接
+	closed bool
+}
+
+// Type 组件类型
+func (x *Nats) Type() string {
+	return Type
+}
+
+func (x *Nats) New() types.Node {
+	return &Nats{Config: Config{
+		Server:        natsio.DefaultURL,
+		MaxReconnects: -1,
+	}}
+}
+
+// Init 初始化
+func (x *Nats) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	if err := maps.Map2Struct(configuration, &x.Config); err != nil {
+		return err
+	}
+	if x.Config.Server == "" {
+		return errors.New("server can not empty")
+	}
+	x.RuleConfig = ruleConfig
+	return x.SharedNode.Init(x.RuleConfig, x.Type(), x.Config.Server, false, func() (*natsio.Conn, error) {
+		return x.initConn()
+	})
+}
+
+// Destroy 销毁
+func (x *Nats) Destroy() {
+	x.RuleConfig.RemoveHealth(types.HealthResourcePrefix + x.Config.Server)
+	_ = x.Close()
+}
+
+// Close 取消所有订阅，如果连接不是来自共享资源池，则关闭连接
+func (x *Nats) Close() error {
+	x.subMu.Lock()
+	x.closed = true
+	x.started = false
+	for id, sub := range x.subscriptions {
+		_ = sub.Unsubscribe()
+		delete(x.subscriptions, id)
+	}
+	x.subMu.Unlock()
+	x.Lock()
+	conn := x.conn
+	x.conn = nil
+	x.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	return nil
+}
+
+func (x *Nats) Id() string {
+	return x.Config.Server
+}
+
+// AddRouter 添加路由，路由from为订阅的主题
+func (x *Nats) AddRouter(router endpoint.Router, params ...interface{}) (string, error) {
+	if router == nil {
+		return "", errors.New("router can not nil")
+	}
+	if router.FromToString() == "" {
+		return "", errors.New("subject can not empty")
+	}
+	if _, err := x.queueGroup(router); err != nil {
+		return "", err
+	}
+	x.CheckAndSetRouterId(router)
+	x.saveRouter(router)
+	x.subMu.Lock()
+	started := x.started
+	x.subMu.Unlock()
+	if started {
+		conn, err := x.SharedNode.Get()
+		if err != nil {
+			return "", err
+		}
+		if err := x.subscribe(conn, router); err != nil {
+			return "", err
+		}
+	}
+	return router.GetId(), nil
+}
+
+func (x *Nats) RemoveRouter(routerId string, params ...interface{}) error {
+	router := x.deleteRouter(routerId)
+	if router == nil {
+		return fmt.Errorf("router: %s not found", routerId)
+	}
+	x.subMu.Lock()
+	defer x.subMu.Unlock()
+	if sub, ok := x.subscriptions[routerId]; ok {
+		delete(x.subscriptions, routerId)
+		return sub.Unsubscribe()
+	}
+	return nil
+}
+
+// Start 订阅所有路由的主题
+func (x *Nats) Start() error {
+	x.subMu.Lock()
+	started := x.started
+	x.subMu.Unlock()
+	if started {
+		return nil
+	}
+	conn, err := x.SharedNode.Get()
+	if err != nil {
+		return err
+	}
+	//服务器连接断开时就绪检查失败
+	x.RuleConfig.RegisterHealth(types.HealthResourcePrefix+x.Config.Server, x.health)
+	if err := x.resubscribe(conn, true); err != nil {
+		return err
+	}
+	x.subMu.Lock()
+	x.started = true
+	x.subMu.Unlock()
+	return nil
+}
+
+// resubscribe 订阅路由的主题，all=false 时只重新订阅失效的订阅
+func (x *Nats) resubscribe(conn *natsio.Conn, all bool) error {
+	x.RLock()
+	routers := make([]endpoint.Router, 0, len(x.RouterStorage))
+	for _, router := range x.RouterStorage {
+		routers = append(routers, router)
+	}
+	x.RUnlock()
+	for _, router := range routers {
+		x.subMu.Lock()
+		sub, ok := x.subscriptions[router.GetId()]
+		x.subMu.Unlock()
+		if !all && ok && sub.IsValid() {
+			continue
+		}
+		if err := x.subscribe(conn, router); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribe 订阅路由的主题，替换路由原来的订阅
+func (x *Nats) subscribe(conn *natsio.Conn, router endpoint.Router) error {
+	group, err := x.queueGroup(router)
+	if err != nil {
+		return err
+	}
+	var sub *natsio.Subscription
+	if group == "" {
+		sub, err = conn.Subscribe(router.FromToString(), x.handler(router, conn))
+	} else {
+		sub, err = conn.QueueSubscribe(router.FromToString(), group, x.handler(router, conn))
+	}
+	if err != nil {
+		return err
+	}
+	x.subMu.Lock()
+	defer x.subMu.Unlock()
+	if old, ok := x.subscriptions[router.GetId()]; ok {
+		_ = old.Unsubscribe()
+	}
+	if x.subscriptions == nil {
+		x.subscriptions = make(map[string]*natsio.Subscription)
+	}
+	x.subscriptions[router.GetId()] = sub
+	return nil
+}
+
+// queueGroup 获取路由的队列组，路由from配置优先于端点配置
+func (x *Nats) queueGroup(router endpoint.Router) (string, error) {
+	group := x.Config.QueueGroup
+	if from, ok := router.GetFrom().(*impl.From); ok && from != nil {
+		if v, ok := from.Config[KeyQueueGroup]; ok && v != nil {
+			group = str.ToString(v)
+		}
+	}
+	if strings.ContainsAny(group, " \t\r\n.*>") {
+		return "", fmt.Errorf("router %s queueGroup config error: invalid queue group %s", router.GetId(), group)
+	}
+	return group, nil
+}
+
+// 存储路由
+func (x *Nats) saveRouter(routers ...endpoint.Router) {
+	x.Lock()
+	defer x.Unlock()
+	if x.RouterStorage == nil {
+		x.RouterStorage = make(map[string]endpoint.Router)
+	}
+	for _, item := range routers {
+		x.RouterStorage[item.GetId()] = item
+	}
+}
+
+// 从存储器中删除路由
+func (x *Nats) deleteRouter(id string) endpoint.Router {
+	x.Lock()
+	defer x.Unlock()
+	if x.RouterStorage != nil {
+		if router, ok := x.RouterStorage[id]; ok {
+			delete(x.RouterStorage, id)
+			return router
+		}
+	}
+	return nil
+}
+
+// handler 订阅回调，同步执行的路由执行结束后把结果回复到请求的回复主题
+func (x *Nats) handler(router endpoint.Router, conn *natsio.Conn) natsio.MsgHandler {
+	return func(msg *natsio.Msg) {
+		x.process(router, conn, msg)
+	}
+}
+
+// process 处理消息，请求消息有回复主题且路由同步执行时，回复 Out 的消息体，规则链处理失败回复错误
+func (x *Nats) process(router endpoint.Router, conn publisher, msg *natsio.Msg) {
+	defer func() {
+		//捕捉异常
+		if e := recover(); e != nil {
+			x.Printf("nats endpoint handler err :\n%v", runtime.Stack())
+		}
+	}()
+	out := &ResponseMessage{
+		request:   msg,
+		publisher: conn,
+	}
+	exchange := &endpoint.Exchange{
+		In: &RequestMessage{
+			request: msg,
+			pattern: router.FromToString(),
+		},
+		Out: out,
+	}
+	x.DoProcess(context.Background(), router, exchange)
+	if msg.Reply == "" || !isWait(router) {
+		return
+	}
+	var err error
+	if processErr := out.GetError(); processErr != nil {
+		err = out.reply(nil, processErr)
+	} else if out.GetMsg() != nil {
+		err = out.reply(out.GetMsg().GetBytes(), nil)
+	} else {
+		err = out.reply(out.Body(), nil)
+	}
+	if err != nil {
+		x.Printf("nats endpoint reply to %s err :%v", msg.Reply, err)
+	}
+}
+
+// isWait 路由是否同步执行，没有To的路由同步执行
+func isWait(router endpoint.Router) bool {
+	if from := router.GetFrom(); from != nil && from.GetTo() != nil {
+		return from.GetTo().IsWait()
+	}
+	return true
+}
+
+// wildcardTokens 获取主题中和路由主题通配符 * 和 > 匹配的片段，> 匹配剩余的所有片段
+func wildcardTokens(pattern, subject string) []string {
+	if !strings.ContainsAny(pattern, "*>") {
+		return nil
+	}
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+	var tokens []string
+	for i, token := range patternTokens {
+		if i >= len(subjectTokens) {
+			break
+		}
+		switch token {
+		case "*":
+			tokens = append(tokens, subjectTokens[i])
+		case ">":
+			return append(tokens, strings.Join(subjectTokens[i:], "."))
+		}
+	}
+	return tokens
+}
+
+func (x *Nats) Printf(format string, v ...interface{}) {
+	if x.RuleConfig.Logger != nil {
+		x.RuleConfig.Logger.Printf(format, v...)
+	}
+}
+
+// health 服务器连接断开时不健康
+func (x *Nats) health() (types.HealthStatus, string) {
+	conn, err := x.SharedNode.Get()
+	if err != nil {
+		return types.HealthUnhealthy, err.Error()
+	}
+	if conn.IsConnected() {
+		return types.HealthHealthy, ""
+	}
+	reason := "nats server disconnected"
+	if err := conn.LastError(); err != nil {
+		reason += ":" + err.Error()
+	}
+	return types.HealthUnhealthy, reason
+}
+
+// initConn 初始化连接，nats客户端重连后自动重新订阅
+// 连接断开发布 types.EventResourceUnhealthy 事件，重连成功后重新订阅失效的订阅，并发布 types.EventResourceRecovered 事件
+// 超过最大重连次数连接关闭后，重新建立连接并重新订阅所有路由
+func (x *Nats) initConn() (*natsio.Conn, error) {
+	x.Lock()
+	defer x.Unlock()
+	if x.conn != nil {
+		return x.conn, nil
+	}
+	opts := []natsio.Option{
+		natsio.Name(x.Type()),
+		natsio.MaxReconnects(x.Config.MaxReconnects),
+		natsio.ReconnectWait(x.Config.reconnectWait()),
+		natsio.DisconnectErrHandler(func(conn *natsio.Conn, err error) {
+			data := map[string]interface{}{"type": x.Type()}
+			if err != nil {
+				data["error"] = err.Error()
+			}
+			x.RuleConfig.PublishEvent(types.EventResourceUnhealthy, x.Config.Server, data)
+		}),
+		natsio.ReconnectHandler(func(conn *natsio.Conn) {
+			if err := x.resubscribe(conn, false); err != nil {
+				x.Printf("nats endpoint resubscribe err :%v", err)
+			}
+			x.RuleConfig.PublishEvent(types.EventResourceRecovered, x.Config.Server, map[string]interface{}{"type": x.Type()})
+		}),
+		natsio.ClosedHandler(func(conn *natsio.Conn) {
+			go x.reconnect(conn)
+		}),
+	}
+	if x.Config.Username != "" {
+		opts = append(opts, natsio.UserInfo(x.Config.Username, x.Config.Password))
+	}
+	if x.Config.Token != "" {
+		opts = append(opts, natsio.Token(x.Config.Token))
+	}
+	tlsConfig, err := x.Config.TLS.NewTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, natsio.Secure(tlsConfig))
+	}
+	conn, err := natsio.Connect(x.Config.Server, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x.conn = conn
+	return conn, nil
+}
+
+// reconnect 连接关闭后，如果端点没有销毁，间隔 ReconnectWait 重新建立连接，并重新订阅所有路由
+func (x *Nats) reconnect(closed *natsio.Conn) {
+	x.Lock()
+	if x.conn != closed {
+		//端点关闭连接
+		x.Unlock()
+		return
+	}
+	x.conn = nil
+	x.Unlock()
+	for {
+		x.subMu.Lock()
+		stop := x.closed
+		x.subMu.Unlock()
+		if stop {
+			return
+		}
+		conn, err := x.initConn()
+		if err == nil {
+			if err = x.resubscribe(conn, true); err == nil {
+				x.RuleConfig.PublishEvent(types.EventResourceRecovered, x.Config.Server, map[string]interface{}{"type": x.Type()})
+				return
+			}
+		}
+		x.Printf("nats endpoint reconnect to %s err :%v, retry after %s", x.Config.Server, err, x.Config.reconnectWait())
+		time.Sleep(x.Config.reconnectWait())
+	}
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nats
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+
+	natsio "github.com/nats-io/nats.go"
+)
+
+var testServer = "127.0.0.1:4222"
+
+// testPublisher 记录回复消息
+type testPublisher struct {
+	mu   sync.Mutex
+	msgs []*natsio.Msg
+}
+
+func (p *testPublisher) PublishMsg(m *natsio.Msg) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.msgs = append(p.msgs, m)
+	return nil
+}
+
+// 测试请求/响应消息
+func TestNatsMessage(t *testing.T) {
+	t.Run("Request", func(t *testing.T) {
+		test.EndpointMessage(t, &RequestMessage{})
+	})
+	t.Run("Response", func(t *testing.T) {
+		test.EndpointMessage(t, &ResponseMessage{})
+	})
+	t.Run("Metadata", func(t *testing.T) {
+		msg := natsio.NewMsg("device.d1.data.temp.c")
+		msg.Reply = "_INBOX.1"
+		msg.Data = []byte(`{"temperature":41}`)
+		msg.Header.Set("traceId", "t1")
+		request := &RequestMessage{request: msg, pattern: "device.*.data.>"}
+		ruleMsg := request.GetMsg()
+		assert.Equal(t, `{"temperature":41}`, ruleMsg.GetData())
+		assert.Equal(t, "device.d1.data.temp.c", ruleMsg.Type)
+		assert.Equal(t, "device.d1.data.temp.c", ruleMsg.Metadata.GetValue(KeySubject))
+		assert.Equal(t, "_INBOX.1", ruleMsg.Metadata.GetValue(KeyReplySubject))
+		assert.Equal(t, "d1", ruleMsg.Metadata.GetValue(WildcardMetadataNamespace+".0"))
+		assert.Equal(t, "temp.c", ruleMsg.Metadata.GetValue(WildcardMetadataNamespace+".1"))
+		assert.Equal(t, "t1", ruleMsg.Metadata.GetValue(HeaderMetadataNamespace+".traceId"))
+		assert.Equal(t, "t1", request.Headers().Get("traceId"))
+		assert.Equal(t, "device.d1.data.temp.c", request.Headers().Get(KeySubject))
+	})
+}
+
+func TestWildcardTokens(t *testing.T) {
+	assert.Equal(t, 0, len(wildcardTokens("device.d1.data", "device.d1.data")))
+	assert.Equal(t, []string{"d1"}, wildcardTokens("device.*.data", "device.d1.data"))
+	assert.Equal(t, []string{"d1", "temp"}, wildcardTokens("device.*.data.*", "device.d1.data.temp"))
+	assert.Equal(t, []string{"d1.data.temp"}, wildcardTokens("device.>", "device.d1.data.temp"))
+	assert.Equal(t, []string{"device", "data.temp"}, wildcardTokens("*.d1.>", "device.d1.data.temp"))
+}
+
+func TestNatsInit(t *testing.T) {
+	config := engine.NewConfig()
+	ep := &Nats{}
+	assert.NotNil(t, ep.Init(config, types.Configuration{"server": ""}))
+	ep = (&Nats{}).New().(*Nats)
+	assert.Nil(t, ep.Init(config, types.Configuration{"server": testServer, "queueGroup": "g1"}))
+	assert.Equal(t, Type, ep.Type())
+	assert.Equal(t, -1, ep.Config.MaxReconnects)
+	assert.Equal(t, DefaultReconnectWait*time.Millisecond, ep.Config.reconnectWait())
+
+	_, err := ep.AddRouter(impl.NewRouter().From("").End())
+	assert.NotNil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From("device.*", types.Configuration{KeyQueueGroup: "g.1"}).End())
+	assert.NotNil(t, err)
+	router := impl.NewRouter().From("device.*").End()
+	group, err := ep.queueGroup(router)
+	assert.Nil(t, err)
+	assert.Equal(t, "g1", group)
+	//路由配置覆盖端点配置
+	router = impl.NewRouter().From("device.*", types.Configuration{KeyQueueGroup: ""}).End()
+	group, err = ep.queueGroup(router)
+	assert.Nil(t, err)
+	assert.Equal(t, "", group)
+
+	routerId, err := ep.AddRouter(router)
+	assert.Nil(t, err)
+	assert.Nil(t, ep.RemoveRouter(routerId))
+	assert.NotNil(t, ep.RemoveRouter(routerId))
+}
+
+func TestNatsReply(t *testing.T) {
+	ruleChain := `{
+	  "ruleChain": {"id": "natsReplyTest"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "if (msg.fail) { throw 'fail'; } msg.device = metadata['wildcard.0']; return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}
+		]
+	  }
+	}`
+	config := engine.NewConfig(types.WithDefaultPool())
+	_, err := engine.New("natsReplyTest", []byte(ruleChain), engine.WithConfig(config))
+	assert.Nil(t, err)
+	defer engine.Del("natsReplyTest")
+
+	ep := &Nats{RuleConfig: config}
+	newMsg := func(data string, reply string) *natsio.Msg {
+		msg := natsio.NewMsg("device.d1.data")
+		msg.Data = []byte(data)
+		msg.Reply = reply
+		return msg
+	}
+
+	t.Run("Wait", func(t *testing.T) {
+		publisher := &testPublisher{}
+		router := impl.NewRouter().From("device.*.data").To("chain:natsReplyTest").Wait().End()
+		ep.process(router, publisher, newMsg(`{"temperature":41}`, "_INBOX.1"))
+		assert.Equal(t, 1, len(publisher.msgs))
+		assert.Equal(t, "_INBOX.1", publisher.msgs[0].Subject)
+		assert.Equal(t, `{"device":"d1","temperature":41}`, string(publisher.msgs[0].Data))
+
+		//规则链处理失败，错误放到消息头
+		ep.process(router, publisher, newMsg(`{"fail":true}`, "_INBOX.2"))
+		assert.Equal(t, 2, len(publisher.msgs))
+		assert.True(t, publisher.msgs[1].Header.Get(KeyError) != "")
+
+		//没有回复主题不回复
+		ep.process(router, publisher, newMsg(`{"temperature":41}`, ""))
+		assert.Equal(t, 2, len(publisher.msgs))
+	})
+
+	t.Run("SetBody", func(t *testing.T) {
+		//路由设置的响应体只回复一次
+		publisher := &testPublisher{}
+		router := impl.NewRouter().From("device.*.data").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			exchange.Out.Headers().Set("Content-Type", "text/plain")
+			exchange.Out.SetBody([]byte("ok"))
+			return true
+		}).End()
+		ep.process(router, publisher, newMsg(`{"temperature":41}`, "_INBOX.1"))
+		assert.Equal(t, 1, len(publisher.msgs))
+		assert.Equal(t, "ok", string(publisher.msgs[0].Data))
+		assert.Equal(t, "text/plain", publisher.msgs[0].Header.Get("Content-Type"))
+	})
+
+	t.Run("Async", func(t *testing.T) {
+		//异步执行的路由不自动回复
+		publisher := &testPublisher{}
+		router := impl.NewRouter().From("device.*.data").To("chain:natsReplyTest").End()
+		ep.process(router, publisher, newMsg(`{"temperature":41}`, "_INBOX.1"))
+		assert.Equal(t, 0, len(publisher.msgs))
+	})
+}
+
+// 需要nats服务器，没有则跳过
+func TestNatsEndpoint(t *testing.T) {
+	conn, err := net.DialTimeout("tcp", testServer, time.Second)
+	if err != nil {
+		t.Skip("nats server is not available: " + testServer)
+	}
+	_ = conn.Close()
+
+	subject := fmt.Sprintf("rulego.test.%d", time.Now().UnixNano())
+	config := engine.NewConfig(types.WithDefaultPool())
+	var count int32
+	newEndpoint := func() *Nats {
+		ep := &Nats{}
+		err := ep.Init(config, types.Configuration{"server": testServer, "queueGroup": "rulego"})
+		assert.Nil(t, err)
+		_, err = ep.AddRouter(impl.NewRouter().From(subject + ".*").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			atomic.AddInt32(&count, 1)
+			exchange.Out.SetBody([]byte(exchange.In.GetMsg().Metadata.GetValue(WildcardMetadataNamespace + ".0")))
+			return true
+		}).End())
+		assert.Nil(t, err)
+		assert.Nil(t, ep.Start())
+		return ep
+	}
+	//同一队列组的两个端点分摊消息
+	ep1 := newEndpoint()
+	defer ep1.Destroy()
+	ep2 := newEndpoint()
+	defer ep2.Destroy()
+
+	client, err := natsio.Connect(testServer)
+	assert.Nil(t, err)
+	defer client.Close()
+	for i := 0; i < 10; i++ {
+		reply, err := client.Request(subject+".d1", []byte(`{"temperature":41}`), 2*time.Second)
+		assert.Nil(t, err)
+		assert.Equal(t, "d1", string(reply.Data))
+	}
+	assert.Equal(t, int32(10), atomic.LoadInt32(&count))
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package net
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/frame"
+)
+
+func TestFrameCodec(t *testing.T) {
+	//没有配置分帧方式按行读取
+	codec, err := newFrameCodec(Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, codec)
+
+	//逐字节读取，验证跨tcp分段的帧重新组装
+	frames := func(config Config, data []byte) ([]string, error) {
+		codec, err := newFrameCodec(config)
+		assert.Nil(t, err)
+		reader := codec.NewReader(iotest.OneByteReader(bytes.NewReader(data)))
+		var result []string
+		for {
+			item, err := reader.ReadFrame()
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				return result, err
+			}
+			result = append(result, string(item))
+		}
+	}
+	result, err := frames(Config{FrameType: frame.TypeDelimiter, Delimiter: "0x0d0a"}, []byte("a\r\nbc\r\n\r\nd"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "bc", ""}, result)
+
+	result, err = frames(Config{FrameType: frame.TypeDelimiter, Delimiter: `\r\n`}, []byte("a\r\nbc\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "bc"}, result)
+
+	result, err = frames(Config{FrameType: frame.TypeLength}, []byte{0, 0, 0, 2, 'a', 'b', 0, 0, 0, 0, 0, 0, 0, 1, 'c'})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ab", "", "c"}, result)
+
+	result, err = frames(Config{FrameType: frame.TypeLength, LengthFieldSize: 2, LittleEndian: true}, []byte{3, 0, 'a', 'b', 'c'})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"abc"}, result)
+
+	result, err = frames(Config{FrameType: frame.TypeFixedLength, FixedLength: 2}, []byte("abcde"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ab", "cd"}, result)
+
+	//超过最大帧大小
+	_, err = frames(Config{FrameType: frame.TypeLength, LengthFieldSize: 2, MaxFrameSize: 8}, []byte{0, 9})
+	assert.True(t, errors.Is(err, frame.ErrFrameTooLarge))
+	_, err = frames(Config{FrameType: frame.TypeDelimiter, Delimiter: "|", MaxFrameSize: 4}, []byte("abcdefgh|"))
+	assert.True(t, errors.Is(err, frame.ErrFrameTooLarge))
+
+	//配置错误
+	for _, config := range []types.Configuration{
+		{"frameType": frame.TypeDelimiter, "delimiter": "0xzz"},
+		{"frameType": frame.TypeLength, "lengthFieldSize": 3},
+		{"frameType": frame.TypeFixedLength},
+		{"frameType": "unknown"},
+	} {
+		assert.NotNil(t, (&Net{}).Init(types.NewConfig(), config))
+	}
+}
+
+func TestTcpFraming(t *testing.T) {
+	eventBus := engine.NewEventBus()
+	subscription, err := eventBus.Subscribe(types.EventEndpointFrameTooLarge, 0)
+	assert.Nil(t, err)
+	defer subscription.Unsubscribe()
+
+	var ep = &Net{}
+	err = ep.Init(types.NewConfig(types.WithEventBus(eventBus)), types.Configuration{
+		"server": "127.0.0.1:6342", "frameType": frame.TypeLength, "maxFrameSize": 16})
+	assert.Nil(t, err)
+	received := make(chan *types.RuleMsg, 10)
+	router := impl.NewRouter().From("").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		received <- exchange.In.GetMsg()
+		return true
+	}).End()
+	_, err = ep.AddRouter(router)
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+
+	conn, err := net.Dial("tcp", "127.0.0.1:6342")
+	assert.Nil(t, err)
+	defer conn.Close()
+	data := []byte{0x01, 0x00, 0xff, 0x0a}
+	header := make([]byte, frame.DefaultLengthFieldSize)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	//分多个tcp分段发送
+	_, _ = conn.Write(append(header, data[:1]...))
+	time.Sleep(time.Millisecond * 50)
+	_, _ = conn.Write(data[1:])
+	msg := <-received
+	assert.Equal(t, types.BINARY, msg.DataType)
+	assert.Equal(t, data, msg.GetBytes())
+	assert.Equal(t, "4", msg.Metadata.GetValue(KeyFrameLength))
+
+	//超过最大帧大小，断开连接
+	_, _ = conn.Write([]byte{0x00, 0x00, 0x00, 0x20})
+	select {
+	case event := <-subscription.C():
+		assert.Equal(t, "127.0.0.1:6342", event.Subject)
+		assert.Equal(t, conn.LocalAddr().String(), event.Data[RemoteAddrKey])
+	case <-time.After(time.Second * 2):
+		t.Fatal("frame too large event timeout")
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	_, err = conn.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+}
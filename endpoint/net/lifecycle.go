@@ -0,0 +1,82 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package net
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+const (
+	// MsgTypeConnect 连接建立消息的消息类型，见 Config.ConnectRouterId
+	MsgTypeConnect = "CONNECT"
+	// MsgTypeDisconnect 连接断开消息的消息类型，见 Config.DisconnectRouterId
+	MsgTypeDisconnect = "DISCONNECT"
+	// KeySessionId 连接id放到消息元数据的key
+	KeySessionId = "sessionId"
+	// KeyConnectionDuration 连接时长（毫秒）放到断开消息元数据的key
+	KeyConnectionDuration = "connectionDuration"
+)
+
+// isLifecycleRouter 是否是接收连接建立或者断开消息的路由，该路由不参与数据的匹配
+func (ep *Net) isLifecycleRouter(routerId string) bool {
+	return routerId != "" && (routerId == ep.Config.ConnectRouterId || routerId == ep.Config.DisconnectRouterId)
+}
+
+// lifecycle 把连接建立或者断开消息交给routerId指定的路由处理，没有配置或者路由不存在时忽略
+// duration 为连接时长，只在断开消息中设置
+func (ep *Net) lifecycle(routerId, msgType string, conn net.Conn, sessionId string, duration time.Duration) {
+	if routerId == "" {
+		return
+	}
+	ep.RLock()
+	v, ok := ep.routers[routerId]
+	ep.RUnlock()
+	if !ok || v.router.IsDisable() {
+		return
+	}
+	from := ""
+	if conn.RemoteAddr() != nil {
+		from = conn.RemoteAddr().String()
+	}
+	metadata := types.NewMetadata()
+	metadata.PutValue(RemoteAddrKey, from)
+	metadata.PutValue(KeySessionId, sessionId)
+	if msgType == MsgTypeDisconnect {
+		metadata.PutValue(KeyConnectionDuration, strconv.FormatInt(duration.Milliseconds(), 10))
+	}
+	msg := types.NewMsg(0, msgType, types.JSON, metadata, "{}")
+	exchange := &endpoint.Exchange{
+		In: &RequestMessage{
+			conn: conn,
+			from: from,
+			msg:  &msg,
+		},
+		Out: &ResponseMessage{
+			log: func(format string, v ...interface{}) {
+				ep.Printf(format, v...)
+			},
+			conn: conn,
+			from: from,
+		}}
+	ep.DoProcess(context.Background(), v.router, exchange)
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package net
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestConnectionLifecycle(t *testing.T) {
+	var ep = &Net{}
+	err := ep.Init(types.NewConfig(), types.Configuration{
+		"server": "127.0.0.1:6343", "connectRouterId": "connect", "disconnectRouterId": "disconnect"})
+	assert.Nil(t, err)
+	connectMsgs := make(chan *types.RuleMsg, 4)
+	dataMsgs := make(chan *types.RuleMsg, 4)
+	newRouter := func(id string, msgs chan *types.RuleMsg, reply string) endpoint.Router {
+		return impl.NewRouter().SetId(id).From("").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			msgs <- exchange.In.GetMsg()
+			if reply != "" {
+				exchange.Out.SetBody([]byte(reply))
+			}
+			return true
+		}).End()
+	}
+	for _, router := range []endpoint.Router{
+		newRouter("connect", connectMsgs, "welcome\n"),
+		newRouter("disconnect", connectMsgs, ""),
+		newRouter("data", dataMsgs, ""),
+	} {
+		_, err = ep.AddRouter(router)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+
+	conn, err := net.Dial("tcp", "127.0.0.1:6343")
+	assert.Nil(t, err)
+	msg := <-connectMsgs
+	assert.Equal(t, MsgTypeConnect, msg.Type)
+	assert.Equal(t, conn.LocalAddr().String(), msg.Metadata.GetValue(RemoteAddrKey))
+	sessionId := msg.Metadata.GetValue(KeySessionId)
+	assert.True(t, sessionId != "")
+	//连接消息的响应发送给客户端
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "welcome\n", line)
+
+	//连接和断开路由不参与数据的匹配
+	_, _ = conn.Write([]byte("hello\n"))
+	msg = <-dataMsgs
+	assert.Equal(t, "hello", msg.GetData())
+	assert.Equal(t, sessionId, msg.Metadata.GetValue(KeySessionId))
+
+	time.Sleep(time.Millisecond * 100)
+	_ = conn.Close()
+	select {
+	case msg = <-connectMsgs:
+		assert.Equal(t, MsgTypeDisconnect, msg.Type)
+		assert.Equal(t, sessionId, msg.Metadata.GetValue(KeySessionId))
+		duration, err := strconv.Atoi(msg.Metadata.GetValue(KeyConnectionDuration))
+		assert.Nil(t, err)
+		assert.True(t, duration >= 100)
+	case <-time.After(time.Second * 5):
+		t.Fatal("disconnect message timeout")
+	}
+	assert.Equal(t, 0, len(dataMsgs))
+}
@@ -42,13 +42,17 @@ import (
 	"net/textproto"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gofrs/uuid/v5"
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/api/types/endpoint"
 	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/frame"
 	"github.com/rulego/rulego/utils/maps"
 	"github.com/rulego/rulego/utils/runtime"
 )
@@ -64,6 +68,8 @@ const (
 	MatchAll = "*"
 	// BufferSize 假设缓冲区大小为1024字节
 	BufferSize = 1024
+	// KeyFrameLength 帧长度元数据key
+	KeyFrameLength = "frameLength"
 )
 
 // Endpoint 别名
@@ -77,6 +83,8 @@ type RequestMessage struct {
 	msg     *types.RuleMsg
 	err     error
 	from    string
+	//消息数据类型，默认TEXT
+	dataType types.DataType
 }
 
 func (r *RequestMessage) Body() []byte {
@@ -108,9 +116,17 @@ func (r *RequestMessage) SetMsg(msg *types.RuleMsg) {
 
 func (r *RequestMessage) GetMsg() *types.RuleMsg {
 	if r.msg == nil {
-		dataType := types.TEXT
-		ruleMsg := types.NewMsg(0, r.From(), dataType, types.NewMetadata(), string(r.Body()))
-		r.msg = &ruleMsg
+		if r.dataType == types.BINARY {
+			ruleMsg := types.NewMsgFromBytes(0, r.From(), types.BINARY, types.NewMetadata(), r.Body())
+			r.msg = &ruleMsg
+		} else {
+			dataType := r.dataType
+			if dataType == "" {
+				dataType = types.TEXT
+			}
+			ruleMsg := types.NewMsg(0, r.From(), dataType, types.NewMetadata(), string(r.Body()))
+			r.msg = &ruleMsg
+		}
 	}
 	return r.msg
 }
@@ -235,6 +251,40 @@ type Config struct {
 	ReadTimeout int
 	//编解码 转16进制字符串(hex)、转base64字符串(base64)、其他
 	Encode string
+	// tcp分帧方式，和 frame 包的分帧方式一致：delimiter（按分隔符）、length（按长度前缀）、fixedLength（按固定长度）、none（不分帧）
+	// 为空按行读取。按帧读取的数据为BINARY类型，帧长度放在元数据 frameLength
+	FrameType string
+	// 分隔符，用于delimiter分帧方式，默认"\n"，支持转义字符，例如：\r\n，以及0x开头的16进制，例如：0x0d0a
+	Delimiter string
+	// 长度字段的字节数，用于length分帧方式和udp批量处理的length格式，可以是1、2、4，默认4。长度不包含长度字段本身
+	LengthFieldSize int
+	// 长度字段是否小端字节序，默认大端字节序
+	LittleEndian bool
+	// 帧长度，用于fixedLength分帧方式
+	FixedLength int
+	// 最大帧大小，单位字节，超过会断开连接并发布 types.EventEndpointFrameTooLarge 事件，默认 frame.DefaultMaxFrameSize
+	MaxFrameSize int
+	// tcp连接建立时接收连接建立消息的路由id，该路由需要已经注册到端点，并且不参与数据的匹配，为空不发送
+	// 消息类型为CONNECT，元数据包括客户端地址remoteAddr和连接id sessionId
+	ConnectRouterId string
+	// tcp连接断开时接收断开消息的路由id，客户端异常断开、读超时也会发送，为空不发送
+	// 消息类型为DISCONNECT，元数据包括客户端地址remoteAddr、连接id sessionId和连接时长connectionDuration（毫秒）
+	DisconnectRouterId string
+	// udp socket接收缓冲区大小，单位字节，0表示使用系统默认值
+	ReadBufferSize int
+	// udp最大数据包大小，单位字节，超过该大小的数据包会被丢弃，0表示使用默认缓冲区大小 BufferSize，超出部分被截断
+	MaxPacketSize int
+	// udp批量处理的数据包数量，同一个路由同一个客户端的数据包达到该数量合并成一条消息，0或者1表示不批量处理
+	BatchSize int
+	// udp批量处理的时间窗口，单位毫秒，从第一个数据包开始计时，到期后合并成一条消息，0表示不按时间合并
+	BatchInterval int
+	// udp批量处理时合并数据包的格式：
+	//   - delimiter：数据包之间使用 BatchDelimiter 分隔，默认，消息类型为TEXT
+	//   - length：每个数据包前加上 LengthFieldSize 字节的长度前缀，字节序见 LittleEndian，消息类型为BINARY，适用于二进制数据包
+	//   - json：JSON字符串数组，每个数据包是一个元素，消息类型为JSON，适用于文本数据包
+	BatchFormat string
+	// udp批量处理时数据包之间的分隔符，用于delimiter格式，默认"\n"，支持转义字符，例如：\r\n，以及0x开头的16进制，例如：0x1e
+	BatchDelimiter string
 }
 
 // RegexpRouter 正则表达式路由
@@ -262,7 +312,10 @@ type Net struct {
 	udpConn *net.UDPConn
 	// 路由映射表
 	routers map[string]*RegexpRouter
-	closed  bool
+	// udp批量处理器
+	batcher *udpBatcher
+	//是否已经关闭，1：关闭，udp读取协程会并发读取
+	closed int32
 }
 
 // Type 组件类型
@@ -284,6 +337,10 @@ func (ep *Net) Init(ruleConfig types.Config, configuration types.Configuration)
 		ep.Config.Protocol = "tcp"
 	}
 	ep.RuleConfig = ruleConfig
+	if err != nil {
+		return err
+	}
+	_, err = newFrameCodec(ep.Config)
 	return err
 }
 
@@ -292,8 +349,15 @@ func (ep *Net) Destroy() {
 	_ = ep.Close()
 }
 
+// isClosed 是否已经关闭
+func (ep *Net) isClosed() bool {
+	return atomic.LoadInt32(&ep.closed) == 1
+}
+
 func (ep *Net) Close() error {
-	ep.closed = true
+	atomic.StoreInt32(&ep.closed, 1)
+	//处理未到期的批量消息
+	ep.batcher.flushAll()
 	if ep.listener != nil {
 		err := ep.listener.Close()
 		ep.listener = nil
@@ -375,6 +439,12 @@ func (ep *Net) Start() error {
 			return err
 		}
 		ep.Printf("started UDP server on %s", ep.Config.Server)
+		if ep.Config.BatchSize > 1 || ep.Config.BatchInterval > 0 {
+			if ep.batcher, err = newUdpBatcher(ep); err != nil {
+				_ = ep.udpConn.Close()
+				return err
+			}
+		}
 		h := UDPHandler{
 			endpoint: ep,
 			config:   ep.Config,
@@ -395,6 +465,9 @@ func (ep *Net) listenUDP() error {
 	if err != nil {
 		return err
 	}
+	if ep.Config.ReadBufferSize > 0 {
+		return ep.udpConn.SetReadBuffer(ep.Config.ReadBufferSize)
+	}
 	return nil
 }
 
@@ -477,13 +550,18 @@ type TcpHandler struct {
 }
 
 func (x *TcpHandler) handler() {
+	sessionId, _ := uuid.NewV4()
+	connectedAt := time.Now()
 	defer func() {
 		_ = x.conn.Close()
 		//捕捉异常
 		if e := recover(); e != nil {
 			x.endpoint.Printf("net endpoint handler err :\n%v", runtime.Stack())
 		}
+		//连接正常关闭、异常断开或者读超时都发送断开消息
+		x.endpoint.lifecycle(x.endpoint.Config.DisconnectRouterId, MsgTypeDisconnect, x.conn, sessionId.String(), time.Since(connectedAt))
 	}()
+	x.endpoint.lifecycle(x.endpoint.Config.ConnectRouterId, MsgTypeConnect, x.conn, sessionId.String(), 0)
 	readTimeoutDuration := time.Duration(x.endpoint.Config.ReadTimeout+5) * time.Second
 	//读超时，断开连接
 	x.readTimeoutTimer = time.AfterFunc(readTimeoutDuration, func() {
@@ -493,6 +571,11 @@ func (x *TcpHandler) handler() {
 	})
 	// 创建一个缓冲读取器，用于读取客户端发送的数据
 	reader := bufio.NewReader(x.conn)
+	// 配置了分帧方式，按帧读取
+	var frameReader *frame.Reader
+	if codec, _ := newFrameCodec(x.endpoint.Config); codec != nil {
+		frameReader = codec.NewReader(x.conn)
+	}
 	// 循环读取客户端发送的数据
 	for {
 		// 设置读取超时
@@ -504,8 +587,18 @@ func (x *TcpHandler) handler() {
 			}
 		}
 
-		// 读取一行数据，直到遇到\n或者\t\n为止
-		data, _, err := reader.ReadLine()
+		var data []byte
+		var err error
+		if frameReader != nil {
+			data, err = frameReader.ReadFrame()
+			if errors.Is(err, frame.ErrFrameTooLarge) {
+				x.onFrameTooLarge(err)
+				break
+			}
+		} else {
+			// 读取一行数据，直到遇到\n或者\t\n为止
+			data, _, err = reader.ReadLine()
+		}
 
 		if err != nil && err.Error() != os.ErrDeadlineExceeded.Error() {
 			if e, ok := err.(*net.OpError); ok {
@@ -524,7 +617,7 @@ func (x *TcpHandler) handler() {
 		if x.endpoint.Config.ReadTimeout > 0 {
 			x.readTimeoutTimer.Reset(readTimeoutDuration)
 		}
-		if string(data) == PingData {
+		if frameReader == nil && string(data) == PingData {
 			continue
 		}
 		// 编码处理
@@ -534,12 +627,17 @@ func (x *TcpHandler) handler() {
 		if x.conn.RemoteAddr() != nil {
 			from = x.conn.RemoteAddr().String()
 		}
+		var dataType types.DataType
+		if frameReader != nil && x.endpoint.Config.Encode == "" {
+			dataType = types.BINARY
+		}
 		// 创建一个交换对象，用于存储输入和输出的消息
 		exchange := &endpoint.Exchange{
 			In: &RequestMessage{
-				conn: x.conn,
-				body: encodedMessage,
-				from: from,
+				conn:     x.conn,
+				body:     encodedMessage,
+				from:     from,
+				dataType: dataType,
 			},
 			Out: &ResponseMessage{
 				log: func(format string, v ...interface{}) {
@@ -552,9 +650,16 @@ func (x *TcpHandler) handler() {
 		msg := exchange.In.GetMsg()
 		// 把客户端连接的地址放到msg元数据中
 		msg.Metadata.PutValue(RemoteAddrKey, from)
+		msg.Metadata.PutValue(KeySessionId, sessionId.String())
+		if frameReader != nil {
+			msg.Metadata.PutValue(KeyFrameLength, strconv.Itoa(len(data)))
+		}
 
 		// 匹配符合的路由，处理消息
-		for _, v := range x.endpoint.routers {
+		for id, v := range x.endpoint.routers {
+			if x.endpoint.isLifecycleRouter(id) {
+				continue
+			}
 			if v.regexp == nil || v.regexp.Match(encodedMessage) {
 				x.endpoint.DoProcess(context.Background(), v.router, exchange)
 			}
@@ -563,6 +668,36 @@ func (x *TcpHandler) handler() {
 
 }
 
+// newFrameCodec 根据配置创建分帧编解码器，没有配置分帧方式返回nil，按行读取
+func newFrameCodec(config Config) (*frame.Codec, error) {
+	if config.FrameType == "" {
+		return nil, nil
+	}
+	return frame.NewCodec(frame.Config{
+		Type:            config.FrameType,
+		Delimiter:       config.Delimiter,
+		LengthFieldSize: config.LengthFieldSize,
+		LittleEndian:    config.LittleEndian,
+		FixedLength:     config.FixedLength,
+		MaxFrameSize:    config.MaxFrameSize,
+	})
+}
+
+// onFrameTooLarge 帧超过最大帧大小，发布事件并断开连接，不继续缓存数据
+func (x *TcpHandler) onFrameTooLarge(err error) {
+	from := ""
+	if x.conn.RemoteAddr() != nil {
+		from = x.conn.RemoteAddr().String()
+	}
+	x.endpoint.Printf("net endpoint %s close connection %s: %v", x.endpoint.Id(), from, err)
+	x.endpoint.RuleConfig.PublishEvent(types.EventEndpointFrameTooLarge, x.endpoint.Id(), map[string]interface{}{
+		"type":        x.endpoint.Type(),
+		RemoteAddrKey: from,
+		"error":       err.Error(),
+	})
+	x.onDisconnect()
+}
+
 func (x *TcpHandler) onDisconnect() {
 	if x.conn != nil {
 		_ = x.conn.Close()
@@ -584,15 +719,21 @@ type UDPHandler struct {
 }
 
 func (x *UDPHandler) handler() {
-	buffer := make([]byte, BufferSize)
+	maxPacketSize := x.config.MaxPacketSize
+	bufferSize := BufferSize
+	if maxPacketSize > 0 {
+		//多读一个字节，用于判断数据包是否超过最大值
+		bufferSize = maxPacketSize + 1
+	}
+	buffer := make([]byte, bufferSize)
 	for {
-		if x.endpoint.udpConn == nil || x.endpoint.closed {
+		if x.endpoint.isClosed() || x.endpoint.udpConn == nil {
 			break
 		}
 		n, addr, err := x.endpoint.udpConn.ReadFromUDP(buffer)
 		if err != nil {
 			time.Sleep(time.Second)
-			if x.endpoint.closed {
+			if x.endpoint.isClosed() {
 				break
 			}
 			err = x.endpoint.listenUDP()
@@ -602,41 +743,32 @@ func (x *UDPHandler) handler() {
 			}
 			continue
 		}
-		msgBuffer := buffer[:n]
-		if string(msgBuffer) == PingData {
-			continue
-		}
 		from := ""
 		if addr != nil {
 			from = addr.String()
 		}
+		if maxPacketSize > 0 && n > maxPacketSize {
+			x.endpoint.Printf("udp packet from %s exceeds max packet size %d, dropped", from, maxPacketSize)
+			continue
+		}
+		msgBuffer := buffer[:n]
+		if string(msgBuffer) == PingData {
+			continue
+		}
 		// 编码处理
 		encodedMessage := x.endpoint.encode(msgBuffer)
 
-		// 创建一个交换对象，用于存储输入和输出的消息
-		exchange := &endpoint.Exchange{
-			In: &RequestMessage{
-				conn: x.endpoint.udpConn,
-				body: encodedMessage,
-				from: from,
-			},
-			Out: &ResponseMessage{
-				log: func(format string, v ...interface{}) {
-					x.endpoint.Printf(format, v...)
-				},
-				conn:    x.endpoint.udpConn,
-				udpAddr: addr,
-				from:    from,
-			}}
-
-		msg := exchange.In.GetMsg()
-		// 把客户端连接的地址放到msg元数据中
-		msg.Metadata.PutValue(RemoteAddrKey, from)
-
 		// 匹配符合的路由，处理消息
-		for _, v := range x.endpoint.routers {
+		for id, v := range x.endpoint.routers {
+			if x.endpoint.isLifecycleRouter(id) {
+				continue
+			}
 			if v.regexp == nil || v.regexp.Match(encodedMessage) {
-				x.endpoint.DoProcess(context.Background(), v.router, exchange)
+				if x.endpoint.batcher != nil {
+					x.endpoint.batcher.add(v.router, addr, encodedMessage)
+				} else {
+					x.endpoint.processUDP(v.router, addr, encodedMessage, "", 1)
+				}
 			}
 		}
 	}
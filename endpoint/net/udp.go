@@ -0,0 +1,250 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package net
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/utils/frame"
+)
+
+const (
+	// UdpType udp endpoint组件类型
+	UdpType = types.EndpointTypePrefix + "udp"
+	// KeyBatchSize 合并成一条消息的数据包数量元数据key
+	KeyBatchSize = "batchSize"
+	// BatchDelimiter 批量处理时数据包之间的默认分隔符，见 Config.BatchDelimiter
+	BatchDelimiter = "\n"
+	// BatchFormatJSON 批量处理时把数据包合并成JSON字符串数组，消息类型为JSON
+	BatchFormatJSON = "json"
+)
+
+// Udp udp endpoint组件，用于接收syslog、遥测设备等只支持udp协议的数据
+// 每个数据包作为一条消息，通过正则表达式把匹配的数据包路由到指定路由，例如：^<\d+> 匹配syslog数据包
+// 通过 Config.BatchSize 和 Config.BatchInterval 可以把高频数据源的多个数据包合并成一条消息
+// 通过 ResponseMessage.SetBody 响应的数据发送回数据包的来源地址
+type Udp struct {
+	Net
+}
+
+// Type 组件类型
+func (ep *Udp) Type() string {
+	return UdpType
+}
+
+func (ep *Udp) New() types.Node {
+	return &Udp{
+		Net: Net{Config: Config{Protocol: "udp", Server: ":6336"}},
+	}
+}
+
+// Init 初始化，协议只支持udp、udp4、udp6
+func (ep *Udp) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	if ep.Config.Protocol == "" {
+		ep.Config.Protocol = "udp"
+	}
+	if err := ep.Net.Init(ruleConfig, configuration); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(ep.Config.Protocol, "udp") {
+		return fmt.Errorf("unsupported protocol: %s", ep.Config.Protocol)
+	}
+	_, err := newBatchEncoder(ep.Config)
+	return err
+}
+
+// processUDP 使用数据包创建交换对象，交给路由处理，响应发送回数据包的来源地址
+func (ep *Net) processUDP(router endpoint.Router, addr *net.UDPAddr, data []byte, dataType types.DataType, count int) {
+	from := ""
+	if addr != nil {
+		from = addr.String()
+	}
+	// 创建一个交换对象，用于存储输入和输出的消息
+	exchange := &endpoint.Exchange{
+		In: &RequestMessage{
+			conn:     ep.udpConn,
+			body:     data,
+			from:     from,
+			dataType: dataType,
+		},
+		Out: &ResponseMessage{
+			log: func(format string, v ...interface{}) {
+				ep.Printf(format, v...)
+			},
+			conn:    ep.udpConn,
+			udpAddr: addr,
+			from:    from,
+		}}
+
+	msg := exchange.In.GetMsg()
+	// 把客户端的地址放到msg元数据中
+	msg.Metadata.PutValue(RemoteAddrKey, from)
+	if count > 1 {
+		msg.Metadata.PutValue(KeyBatchSize, strconv.Itoa(count))
+	}
+	ep.DoProcess(context.Background(), router, exchange)
+}
+
+// udpBatcher 按路由和客户端地址合并数据包
+type udpBatcher struct {
+	endpoint *Net
+	encode   batchEncoder
+	size     int
+	interval time.Duration
+	mu       sync.Mutex
+	batches  map[string]*udpBatch
+}
+
+type udpBatch struct {
+	router  endpoint.Router
+	addr    *net.UDPAddr
+	packets [][]byte
+	timer   *time.Timer
+}
+
+func newUdpBatcher(ep *Net) (*udpBatcher, error) {
+	encode, err := newBatchEncoder(ep.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &udpBatcher{
+		endpoint: ep,
+		encode:   encode,
+		size:     ep.Config.BatchSize,
+		interval: time.Duration(ep.Config.BatchInterval) * time.Millisecond,
+		batches:  make(map[string]*udpBatch),
+	}, nil
+}
+
+// add 添加数据包，达到数量后立即处理
+func (b *udpBatcher) add(router endpoint.Router, addr *net.UDPAddr, data []byte) {
+	key := router.GetId() + "|" + addr.String()
+	b.mu.Lock()
+	batch, ok := b.batches[key]
+	if !ok {
+		batch = &udpBatch{router: router, addr: addr}
+		b.batches[key] = batch
+		if b.interval > 0 {
+			batch.timer = time.AfterFunc(b.interval, func() {
+				b.flush(key, batch)
+			})
+		}
+	}
+	//读取缓冲区会被复用，需要复制
+	batch.packets = append(batch.packets, append([]byte(nil), data...))
+	full := b.size > 1 && len(batch.packets) >= b.size
+	b.mu.Unlock()
+	if full {
+		b.flush(key, batch)
+	}
+}
+
+// flush 处理批量消息，已经处理过的批次忽略
+func (b *udpBatcher) flush(key string, batch *udpBatch) {
+	b.mu.Lock()
+	if b.batches[key] != batch {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.batches, key)
+	b.mu.Unlock()
+	b.process(batch)
+}
+
+// flushAll 处理所有未到期的批量消息
+func (b *udpBatcher) flushAll() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	batches := b.batches
+	b.batches = make(map[string]*udpBatch)
+	b.mu.Unlock()
+	for _, batch := range batches {
+		b.process(batch)
+	}
+}
+
+func (b *udpBatcher) process(batch *udpBatch) {
+	if batch.timer != nil {
+		batch.timer.Stop()
+	}
+	data, dataType, err := b.encode(batch.packets)
+	if err != nil {
+		b.endpoint.Printf("udp batch from %s error: %v", batch.addr, err)
+		return
+	}
+	b.endpoint.processUDP(batch.router, batch.addr, data, dataType, len(batch.packets))
+}
+
+// batchEncoder 把多个数据包合并成一条消息的数据，返回数据和消息类型，消息类型为空表示TEXT
+type batchEncoder func(packets [][]byte) ([]byte, types.DataType, error)
+
+// newBatchEncoder 根据 Config.BatchFormat 创建批量数据编码器
+func newBatchEncoder(config Config) (batchEncoder, error) {
+	switch config.BatchFormat {
+	case "", frame.TypeDelimiter:
+		d := config.BatchDelimiter
+		if d == "" {
+			d = BatchDelimiter
+		}
+		delimiter, err := frame.ParseDelimiter(d)
+		if err != nil {
+			return nil, err
+		}
+		return func(packets [][]byte) ([]byte, types.DataType, error) {
+			return bytes.Join(packets, delimiter), "", nil
+		}, nil
+	case frame.TypeLength:
+		codec, err := frame.NewCodec(frame.Config{Type: frame.TypeLength, LengthFieldSize: config.LengthFieldSize, LittleEndian: config.LittleEndian})
+		if err != nil {
+			return nil, err
+		}
+		return func(packets [][]byte) ([]byte, types.DataType, error) {
+			var data []byte
+			for _, packet := range packets {
+				item, err := codec.Encode(packet)
+				if err != nil {
+					return nil, "", err
+				}
+				data = append(data, item...)
+			}
+			return data, types.BINARY, nil
+		}, nil
+	case BatchFormatJSON:
+		return func(packets [][]byte) ([]byte, types.DataType, error) {
+			items := make([]string, len(packets))
+			for i, packet := range packets {
+				items[i] = string(packet)
+			}
+			data, err := json.Marshal(items)
+			return data, types.JSON, err
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported batch format: %s", config.BatchFormat)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package net
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestUdpEndpoint(t *testing.T) {
+	ep := (&Udp{}).New().(*Udp)
+	assert.Equal(t, UdpType, ep.Type())
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": "127.0.0.1:6340", "maxPacketSize": 16})
+	assert.Nil(t, err)
+	assert.Equal(t, "udp", ep.Config.Protocol)
+
+	received := make(chan *types.RuleMsg, 10)
+	router := impl.NewRouter().From(`^<\d+>`).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		received <- exchange.In.GetMsg()
+		exchange.Out.SetBody([]byte("ack:" + exchange.In.GetMsg().GetData()))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router)
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+
+	conn, err := net.Dial("udp", "127.0.0.1:6340")
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, _ = conn.Write([]byte("<13>hello"))
+	msg := <-received
+	assert.Equal(t, "<13>hello", msg.GetData())
+	assert.Equal(t, conn.LocalAddr().String(), msg.Metadata.GetValue(RemoteAddrKey))
+	//响应发送回来源地址
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	n, err := conn.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "ack:<13>hello", string(buf[:n]))
+
+	//不匹配和超过最大数据包大小的数据包不处理
+	_, _ = conn.Write([]byte("hello"))
+	_, _ = conn.Write([]byte("<13>0123456789abcdef"))
+	_, _ = conn.Write([]byte("<14>end"))
+	msg = <-received
+	assert.Equal(t, "<14>end", msg.GetData())
+
+	//只支持udp协议
+	err = (&Udp{}).Init(types.NewConfig(), types.Configuration{"protocol": "tcp"})
+	assert.NotNil(t, err)
+}
+
+func TestUdpBatch(t *testing.T) {
+	ep := (&Udp{}).New().(*Udp)
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": "127.0.0.1:6341", "batchSize": 3, "batchInterval": 300})
+	assert.Nil(t, err)
+
+	received := make(chan *types.RuleMsg, 10)
+	router := impl.NewRouter().From("").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		received <- exchange.In.GetMsg()
+		return true
+	}).End()
+	_, err = ep.AddRouter(router)
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+
+	conn, err := net.Dial("udp", "127.0.0.1:6341")
+	assert.Nil(t, err)
+	defer conn.Close()
+	//达到数量合并
+	for _, data := range []string{"a", "b", "c", "d"} {
+		_, _ = conn.Write([]byte(data))
+	}
+	msg := <-received
+	assert.Equal(t, "a\nb\nc", msg.GetData())
+	assert.Equal(t, "3", msg.Metadata.GetValue(KeyBatchSize))
+	assert.Equal(t, conn.LocalAddr().String(), msg.Metadata.GetValue(RemoteAddrKey))
+
+	//时间窗口到期合并
+	start := time.Now()
+	msg = <-received
+	assert.Equal(t, "d", msg.GetData())
+	assert.Equal(t, "", msg.Metadata.GetValue(KeyBatchSize))
+	assert.True(t, time.Since(start) > time.Millisecond*100)
+}
+
+func TestUdpBatchFormat(t *testing.T) {
+	packets := [][]byte{[]byte("a"), {0x00, 0x0a}}
+	//自定义分隔符
+	encode, err := newBatchEncoder(Config{BatchDelimiter: "0x1e"})
+	assert.Nil(t, err)
+	data, dataType, err := encode(packets)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{'a', 0x1e, 0x00, 0x0a}, data)
+	assert.Equal(t, types.DataType(""), dataType)
+
+	//二进制数据包使用长度前缀
+	encode, err = newBatchEncoder(Config{BatchFormat: "length", LengthFieldSize: 2})
+	assert.Nil(t, err)
+	data, dataType, err = encode(packets)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x00, 0x01, 'a', 0x00, 0x02, 0x00, 0x0a}, data)
+	assert.Equal(t, types.BINARY, dataType)
+
+	encode, err = newBatchEncoder(Config{BatchFormat: BatchFormatJSON})
+	assert.Nil(t, err)
+	data, dataType, err = encode([][]byte{[]byte("a"), []byte(`{"b":1}`)})
+	assert.Nil(t, err)
+	assert.Equal(t, `["a","{\"b\":1}"]`, string(data))
+	assert.Equal(t, types.JSON, dataType)
+
+	err = (&Udp{}).Init(types.NewConfig(), types.Configuration{"batchFormat": "xx"})
+	assert.NotNil(t, err)
+	err = (&Udp{}).Init(types.NewConfig(), types.Configuration{"batchFormat": "length", "lengthFieldSize": 3})
+	assert.NotNil(t, err)
+
+	//合并后的消息类型
+	ep := (&Udp{}).New().(*Udp)
+	err = ep.Init(types.NewConfig(), types.Configuration{"server": "127.0.0.1:6342", "batchSize": 2, "batchFormat": "length"})
+	assert.Nil(t, err)
+	received := make(chan *types.RuleMsg, 10)
+	_, err = ep.AddRouter(impl.NewRouter().From("").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		received <- exchange.In.GetMsg()
+		return true
+	}).End())
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+	conn, err := net.Dial("udp", "127.0.0.1:6342")
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, _ = conn.Write([]byte("a"))
+	_, _ = conn.Write([]byte("bc"))
+	msg := <-received
+	assert.Equal(t, types.BINARY, msg.DataType)
+	assert.Equal(t, []byte{0, 0, 0, 1, 'a', 0, 0, 0, 2, 'b', 'c'}, msg.GetBytes())
+}
@@ -20,7 +20,10 @@ import (
 	"fmt"
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/grpc"
+	"github.com/rulego/rulego/endpoint/kafka"
 	"github.com/rulego/rulego/endpoint/mqtt"
+	"github.com/rulego/rulego/endpoint/nats"
 	"github.com/rulego/rulego/endpoint/net"
 	"github.com/rulego/rulego/endpoint/rest"
 	"github.com/rulego/rulego/endpoint/schedule"
@@ -33,8 +36,12 @@ import (
 // init registers the available endpoint components with the Registry.
 func init() {
 	_ = Registry.Register(&mqtt.Endpoint{})
+	_ = Registry.Register(&kafka.Endpoint{})
+	_ = Registry.Register(&nats.Endpoint{})
+	_ = Registry.Register(&grpc.Endpoint{})
 	_ = Registry.Register(&rest.Endpoint{})
 	_ = Registry.Register(&net.Endpoint{})
+	_ = Registry.Register(&net.Udp{})
 	_ = Registry.Register(&websocket.Endpoint{})
 	_ = Registry.Register(&schedule.Endpoint{})
 }
@@ -55,7 +62,7 @@ func (r *ComponentRegistry) Register(component endpoint.Endpoint) error {
 // New creates a new instance of an endpoint based on the component type.
 // The configuration parameter can be either types.Configuration or the corresponding Config type for the endpoint.
 func (r *ComponentRegistry) New(componentType string, ruleConfig types.Config, configuration interface{}) (endpoint.Endpoint, error) {
-	if strings.Contains("http,ws,mqtt,net,schedule,kafka,nats", componentType) {
+	if strings.Contains("http,ws,mqtt,net,schedule,kafka,nats,grpc", componentType) {
 		//Compatible with older versions
 		componentType = types.EndpointTypePrefix + componentType
 	}
@@ -131,3 +131,19 @@ func (test *testEndpoint) RemoveRouter(routeId string, params ...interface{}) er
 func (test *testEndpoint) Start() error {
 	return nil
 }
+
+// 使用表单的默认值生成的配置可以初始化endpoint
+func TestDescribeEndpoints(t *testing.T) {
+	config := engine.NewConfig(types.WithDefaultPool())
+	forms := Registry.DescribeAll()
+	assert.True(t, len(forms) > 0)
+	for _, form := range forms {
+		assert.Equal(t, types.ComponentKindEndpoint, form.ComponentKind)
+		ep, err := Registry.New(form.Type, config, form.Fields.DefaultConfiguration())
+		if err != nil {
+			t.Errorf("%s init with default configuration error:%v", form.Type, err)
+			continue
+		}
+		ep.Destroy()
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestInterceptorAbort(t *testing.T) {
+	for _, configuration := range []types.Configuration{
+		{"server": ":9147", "accessLog": true, "metrics": true, "errorResponse": map[string]interface{}{}},
+		{"server": ":9148", "accessLog": true, "metrics": true, "enableCompression": true},
+	} {
+		var ep = &Endpoint{}
+		err := ep.Init(types.NewConfig(), configuration)
+		assert.Nil(t, err)
+		var entries []AccessLogEntry
+		ep.SetAccessLogFunc(func(entry AccessLogEntry) {
+			entries = append(entries, entry)
+		})
+		var nextCount, processCount int
+		ep.AddInterceptors(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			if exchange.In.Headers().Get("X-Token") == "" {
+				exchange.Out.Headers().Set(ContentTypeKey, JsonContextType)
+				return exchange.Abort(http.StatusUnauthorized, []byte(`{"code":401,"message":"missing token"}`))
+			}
+			if exchange.In.Headers().Get("X-Token") == "forbidden" {
+				return exchange.Abort(http.StatusForbidden, nil)
+			}
+			return true
+		}, func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			nextCount++
+			return true
+		})
+		router := impl.NewRouter().SetId("abort").From("/api/abort").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			processCount++
+			exchange.Out.SetBody([]byte("ok"))
+			return true
+		}).End()
+		_, err = ep.AddRouter(router, "GET")
+		assert.Nil(t, err)
+		serve := func(token string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/api/abort", nil)
+			if token != "" {
+				r.Header.Set("X-Token", token)
+			}
+			ep.Router().ServeHTTP(w, r)
+			return w
+		}
+		w := serve("")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, JsonContextType, w.Header().Get(ContentTypeKey))
+		assert.Equal(t, `{"code":401,"message":"missing token"}`, w.Body.String())
+		//只设置状态码
+		w = serve("forbidden")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "", w.Body.String())
+		//后续拦截器和路由不执行
+		assert.Equal(t, 0, nextCount)
+		assert.Equal(t, 0, processCount)
+
+		w = serve("t1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", w.Body.String())
+		assert.Equal(t, 1, nextCount)
+
+		//访问日志和指标记录短路的状态码
+		assert.Equal(t, 3, len(entries))
+		assert.Equal(t, http.StatusUnauthorized, entries[0].StatusCode)
+		assert.True(t, entries[0].Aborted)
+		assert.Equal(t, http.StatusForbidden, entries[1].StatusCode)
+		assert.False(t, entries[2].Aborted)
+		assert.Equal(t, map[string]int64{"2xx": 1, "4xx": 2}, ep.Metrics().Routes[0].Requests)
+		ep.Destroy()
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+// AccessLogEntry 一次请求的访问日志
+type AccessLogEntry struct {
+	// Method 请求方法
+	Method string
+	// Path 请求路径
+	Path string
+	// RouterId 匹配的路由id
+	RouterId string
+	// StatusCode 响应状态码
+	StatusCode int
+	// BytesWritten 写入的响应体字节数，开启压缩时为压缩后的字节数
+	BytesWritten int64
+	// Latency 处理耗时
+	Latency time.Duration
+	// RemoteAddr 客户端地址
+	RemoteAddr string
+	// MsgId 消息id，请求在创建消息之前被拒绝时为空
+	MsgId string
+	// Aborted 是否被拦截器通过 endpoint.Exchange.Abort 短路
+	Aborted bool
+}
+
+// AccessLogFunc 访问日志处理函数，请求处理完成后调用
+type AccessLogFunc func(entry AccessLogEntry)
+
+// SetAccessLogFunc 设置访问日志处理函数，Config.AccessLog 开启时生效，为空使用 RuleConfig.Logger 输出一行日志
+func (rest *Rest) SetAccessLogFunc(fn AccessLogFunc) {
+	rest.accessLogMu.Lock()
+	defer rest.accessLogMu.Unlock()
+	rest.accessLogFunc = fn
+}
+
+// logAccess 输出请求的访问日志
+func (rest *Rest) logAccess(router endpoint.Router, r *http.Request, w *accessLogWriter, exchange *endpoint.Exchange) {
+	entry := AccessLogEntry{
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		RouterId:     router.GetId(),
+		StatusCode:   w.statusCode(),
+		BytesWritten: w.bytes,
+		Latency:      time.Since(w.start),
+		RemoteAddr:   r.RemoteAddr,
+	}
+	if exchange != nil {
+		if msg := exchange.In.GetMsg(); msg != nil {
+			entry.MsgId = msg.Id
+		}
+		entry.Aborted = exchange.IsAborted()
+	}
+	rest.accessLogMu.RLock()
+	fn := rest.accessLogFunc
+	rest.accessLogMu.RUnlock()
+	if fn != nil {
+		fn(entry)
+		return
+	}
+	rest.Printf("%s %s %s %d %d %s %s %s", entry.RemoteAddr, entry.Method, entry.Path, entry.StatusCode,
+		entry.BytesWritten, entry.Latency, entry.RouterId, entry.MsgId)
+}
+
+// accessLogWriter 记录响应状态码和写入的字节数
+type accessLogWriter struct {
+	http.ResponseWriter
+	start  time.Time
+	status int
+	bytes  int64
+	mu     sync.Mutex
+}
+
+func (w *accessLogWriter) statusCode() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.status == 0 {
+		//没有写入响应时，net/http 响应200
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *accessLogWriter) WriteHeader(statusCode int) {
+	w.mu.Lock()
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.mu.Unlock()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.mu.Lock()
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.bytes += int64(n)
+	w.mu.Unlock()
+	return n, err
+}
+
+func (w *accessLogWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *accessLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("http.Hijacker is not supported")
+}
+
+// Unwrap 供 http.ResponseController 使用
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+type accessLogger struct {
+	logs []string
+}
+
+func (l *accessLogger) Printf(format string, v ...interface{}) {
+	l.logs = append(l.logs, fmt.Sprintf(format, v...))
+}
+
+func TestAccessLog(t *testing.T) {
+	logger := &accessLogger{}
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(types.WithLogger(logger)), types.Configuration{
+		"server":         ":9113",
+		"accessLog":      true,
+		"maxQPS":         0.1,
+		"rateLimitBurst": 4,
+	})
+	assert.Nil(t, err)
+	var msgId string
+	router := impl.NewRouter().SetId("created").From("/api/devices/:id").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		msgId = exchange.In.GetMsg().Id
+		exchange.Out.SetStatusCode(http.StatusCreated)
+		exchange.Out.SetBody([]byte("hello"))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+	router = impl.NewRouter().SetId("panic").From("/api/panic").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		panic("test panic")
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+
+	serve := func(method, url string) {
+		r := httptest.NewRequest(method, url, strings.NewReader("{}"))
+		ep.Router().ServeHTTP(httptest.NewRecorder(), r)
+	}
+	//默认通过 RuleConfig.Logger 输出一行日志
+	serve(http.MethodPost, "/api/devices/d01")
+	assert.Equal(t, 1, len(logger.logs))
+	assert.True(t, strings.HasPrefix(logger.logs[0], "192.0.2.1:1234 POST /api/devices/d01 201 5 "))
+	assert.True(t, strings.HasSuffix(logger.logs[0], " created "+msgId))
+
+	var entries []AccessLogEntry
+	ep.SetAccessLogFunc(func(entry AccessLogEntry) {
+		entries = append(entries, entry)
+	})
+	serve(http.MethodPost, "/api/devices/d02")
+	assert.Equal(t, 1, len(entries))
+	entry := entries[0]
+	assert.Equal(t, http.MethodPost, entry.Method)
+	assert.Equal(t, "/api/devices/d02", entry.Path)
+	assert.Equal(t, "created", entry.RouterId)
+	assert.Equal(t, http.StatusCreated, entry.StatusCode)
+	assert.Equal(t, int64(5), entry.BytesWritten)
+	assert.Equal(t, "192.0.2.1:1234", entry.RemoteAddr)
+	assert.Equal(t, msgId, entry.MsgId)
+	assert.True(t, entry.Latency > 0)
+
+	//处理异常的请求也输出访问日志
+	serve(http.MethodGet, "/api/panic")
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "panic", entries[1].RouterId)
+	assert.True(t, entries[1].MsgId != "")
+
+	//在创建消息之前被拒绝的请求没有消息id
+	for i := 0; i < 2; i++ {
+		serve(http.MethodGet, "/api/panic")
+	}
+	entry = entries[len(entries)-1]
+	assert.Equal(t, http.StatusTooManyRequests, entry.StatusCode)
+	assert.Equal(t, "", entry.MsgId)
+	assert.True(t, entry.BytesWritten > 0)
+	//自定义处理函数后不再输出默认日志
+	var lines int
+	for _, line := range logger.logs {
+		if strings.HasPrefix(line, "192.0.2.1:1234 ") {
+			lines++
+		}
+	}
+	assert.Equal(t, 1, lines)
+}
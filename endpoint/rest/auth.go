@@ -0,0 +1,128 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/builtin/processor"
+)
+
+const (
+	// AuthTypeBasic HTTP Basic 认证
+	AuthTypeBasic = "basic"
+	// AuthTypeBearer Bearer 令牌认证
+	AuthTypeBearer = "bearer"
+	// AuthUserKey 认证通过的用户放到消息元数据的key
+	AuthUserKey = "authUser"
+	// defaultAuthRealm 默认认证域
+	defaultAuthRealm = "rulego"
+)
+
+// AuthConfig 路由认证配置，认证在全局拦截器之前执行，失败响应401，不执行路由处理
+type AuthConfig struct {
+	// Type 认证类型：basic 或者 bearer
+	Type string `json:"type"`
+	// Users basic认证的用户名和密码
+	Users map[string]string `json:"users" secret:"true"`
+	// TokenValidator bearer认证的令牌校验处理器名称，处理器通过 processor.InBuiltins 注册
+	// 处理器返回false或者设置了 exchange.Out 错误表示认证失败，可以把认证通过的用户写入元数据 AuthUserKey
+	TokenValidator string `json:"tokenValidator"`
+	// Realm 认证失败时 WWW-Authenticate 响应头的认证域，默认rulego
+	Realm string `json:"realm"`
+}
+
+// authenticator 每个端点独立的认证器，共享同一个服务的多个端点使用各自的认证配置
+type authenticator struct {
+	config    AuthConfig
+	validator endpoint.Process
+}
+
+func newAuthenticator(config *AuthConfig) (*authenticator, error) {
+	if config == nil || config.Type == "" {
+		return nil, nil
+	}
+	a := &authenticator{config: *config}
+	if a.config.Realm == "" {
+		a.config.Realm = defaultAuthRealm
+	}
+	switch strings.ToLower(config.Type) {
+	case AuthTypeBasic:
+		a.config.Type = AuthTypeBasic
+		if len(config.Users) == 0 {
+			return nil, fmt.Errorf("basic auth users can not be empty")
+		}
+	case AuthTypeBearer:
+		a.config.Type = AuthTypeBearer
+		if config.TokenValidator == "" {
+			return nil, fmt.Errorf("bearer auth tokenValidator can not be empty")
+		}
+		validator, ok := processor.InBuiltins.Get(config.TokenValidator)
+		if !ok {
+			return nil, fmt.Errorf("token validator processor:%s not found", config.TokenValidator)
+		}
+		a.validator = validator
+	default:
+		return nil, fmt.Errorf("unsupported auth type:%s", config.Type)
+	}
+	return a, nil
+}
+
+// authenticate 校验请求，认证通过后把用户写入元数据 AuthUserKey
+func (a *authenticator) authenticate(router endpoint.Router, exchange *endpoint.Exchange, r *http.Request, tokenParam string) error {
+	metadata := exchange.In.GetMsg().Metadata
+	if a.config.Type == AuthTypeBasic {
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return fmt.Errorf("%w: missing credentials", endpoint.ErrUnauthorized)
+		}
+		expected, exists := a.config.Users[username]
+		//用户不存在也比较一次，避免通过响应时间判断用户是否存在
+		if subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 || !exists {
+			return fmt.Errorf("%w: invalid username or password", endpoint.ErrUnauthorized)
+		}
+		metadata.PutValue(AuthUserKey, username)
+		return nil
+	}
+	if BearerToken(r, tokenParam) == "" {
+		return fmt.Errorf("%w: missing token", endpoint.ErrUnauthorized)
+	}
+	if !a.validator(router, exchange) {
+		return fmt.Errorf("%w: invalid token", endpoint.ErrUnauthorized)
+	}
+	if err := exchange.Out.GetError(); err != nil {
+		return fmt.Errorf("%w: %v", endpoint.ErrUnauthorized, err)
+	}
+	return nil
+}
+
+// isBearer 是否bearer认证，令牌url参数不放到元数据中
+func (a *authenticator) isBearer() bool {
+	return a != nil && a.config.Type == AuthTypeBearer
+}
+
+// challenge 认证失败时 WWW-Authenticate 响应头的值
+func (a *authenticator) challenge() string {
+	if a.config.Type == AuthTypeBasic {
+		return fmt.Sprintf("Basic realm=%q", a.config.Realm)
+	}
+	return fmt.Sprintf("Bearer realm=%q", a.config.Realm)
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/builtin/processor"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestAuth(t *testing.T) {
+	processor.InBuiltins.Register("testTokenValidator", func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		if exchange.In.Headers().Get(HeaderKeyAuthorization) != "Bearer token01" {
+			return false
+		}
+		exchange.In.GetMsg().Metadata.PutValue(AuthUserKey, "tokenUser")
+		return true
+	})
+	defer processor.InBuiltins.Unregister("testTokenValidator")
+
+	var users []string
+	var intercepted int
+	newEndpoint := func(auth *AuthConfig) *Endpoint {
+		var ep = &Endpoint{}
+		err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9105", "auth": auth})
+		assert.Nil(t, err)
+		ep.AddInterceptors(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			intercepted++
+			return true
+		})
+		router := impl.NewRouter().From("/api/auth").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			users = append(users, exchange.In.GetMsg().Metadata.GetValue(AuthUserKey))
+			return true
+		}).End()
+		_, err = ep.AddRouter(router, "GET")
+		assert.Nil(t, err)
+		return ep
+	}
+	get := func(ep *Endpoint, setAuth func(r *http.Request)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/auth", nil)
+		if setAuth != nil {
+			setAuth(r)
+		}
+		ep.Router().ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("Basic", func(t *testing.T) {
+		users, intercepted = nil, 0
+		ep := newEndpoint(&AuthConfig{Type: AuthTypeBasic, Users: map[string]string{"admin": "123456"}})
+		w := get(ep, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, `Basic realm="rulego"`, w.Header().Get(HeaderKeyWWWAuthenticate))
+		w = get(ep, func(r *http.Request) { r.SetBasicAuth("admin", "654321") })
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = get(ep, func(r *http.Request) { r.SetBasicAuth("guest", "123456") })
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		//认证失败不执行拦截器和路由处理
+		assert.Equal(t, 0, intercepted)
+		assert.Equal(t, 0, len(users))
+
+		w = get(ep, func(r *http.Request) { r.SetBasicAuth("admin", "123456") })
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 1, intercepted)
+		assert.Equal(t, []string{"admin"}, users)
+	})
+
+	t.Run("Bearer", func(t *testing.T) {
+		users, intercepted = nil, 0
+		ep := newEndpoint(&AuthConfig{Type: AuthTypeBearer, TokenValidator: "testTokenValidator", Realm: "api"})
+		w := get(ep, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, `Bearer realm="api"`, w.Header().Get(HeaderKeyWWWAuthenticate))
+		w = get(ep, func(r *http.Request) { r.Header.Set(HeaderKeyAuthorization, "Bearer token02") })
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, 0, len(users))
+
+		w = get(ep, func(r *http.Request) { r.Header.Set(HeaderKeyAuthorization, "Bearer token01") })
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"tokenUser"}, users)
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		for _, auth := range []*AuthConfig{
+			{Type: "digest"},
+			{Type: AuthTypeBasic},
+			{Type: AuthTypeBearer},
+			{Type: AuthTypeBearer, TokenValidator: "notFound"},
+		} {
+			var ep = &Endpoint{}
+			err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9105", "auth": auth})
+			assert.NotNil(t, err)
+		}
+	})
+
+	//共享同一个服务的路由使用各自端点的认证器
+	t.Run("SharedServer", func(t *testing.T) {
+		users, intercepted = nil, 0
+		shared := newEndpoint(nil)
+		basic, err := newAuthenticator(&AuthConfig{Type: AuthTypeBasic, Users: map[string]string{"admin": "123456"}})
+		assert.Nil(t, err)
+		router := impl.NewRouter().From("/api/auth2").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			users = append(users, exchange.In.GetMsg().Metadata.GetValue(AuthUserKey))
+			return true
+		}).End()
+		assert.Nil(t, shared.addRouterWithAuth(http.MethodGet, basic, router))
+
+		assert.Equal(t, http.StatusOK, get(shared, nil).Code)
+		w := httptest.NewRecorder()
+		shared.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth2", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, []string{""}, users)
+	})
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// normalizeBasePath 规范化路由的路径前缀，以/开头并且去掉末尾的/，/和空返回空，不能包含路径参数
+func normalizeBasePath(basePath string) (string, error) {
+	basePath = strings.TrimRight(strings.TrimSpace(basePath), "/")
+	if basePath == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+	if strings.ContainsAny(basePath, ":*{}") {
+		return "", fmt.Errorf("basePath can not contain path params: %s", basePath)
+	}
+	return basePath, nil
+}
+
+// withBasePath 路径加上 Config.BasePath 前缀，不以/开头的路径不处理，由路径校验返回错误
+func (rest *Rest) withBasePath(path string) string {
+	if rest.Config.BasePath == "" || !strings.HasPrefix(path, "/") {
+		return path
+	}
+	return rest.Config.BasePath + path
+}
+
+// fullPath 路径加上服务的 Config.BasePath 前缀，共享服务时使用服务实例的配置
+func (rest *Rest) fullPath(path string) string {
+	if rest.SharedNode.InstanceId != "" {
+		if shared, err := rest.SharedNode.Get(); err == nil {
+			return shared.withBasePath(path)
+		}
+	}
+	return rest.withBasePath(path)
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestBasePath(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9138", "basePath": " api/rulego/ "})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+	assert.Equal(t, "/api/rulego", ep.Config.BasePath)
+	router := impl.NewRouter().From("/devices/{id}").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte(exchange.In.GetParam("id")))
+		return true
+	}).End()
+	id, err := ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	//路由id不包含前缀
+	assert.Equal(t, "GET:/devices/{id}", id)
+	assert.Equal(t, "/api/rulego/devices/{id}", ep.Routes()[0].Path)
+
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "data.txt"), []byte("ui"), 0600))
+	ep.RegisterStaticFiles("/ui=" + dir)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	w := serve(http.MethodGet, "/api/rulego/devices/d01")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "d01", w.Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/devices/d01").Code)
+	assert.Equal(t, "GET, OPTIONS", serve(http.MethodOptions, "/api/rulego/devices/d01").Header().Get(HeaderKeyAllow))
+	assert.Equal(t, "ui", serve(http.MethodGet, "/api/rulego/ui/data.txt").Body.String())
+
+	//路由路径冲突检查不受前缀影响
+	_, err = ep.AddRouter(impl.NewRouter().From("/devices/:name").End(), "GET")
+	assert.NotNil(t, err)
+
+	//不能包含路径参数
+	err = (&Endpoint{}).Init(types.NewConfig(), types.Configuration{"server": ":9139", "basePath": "/api/:tenant"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/str"
+)
+
+// KeyDataType 路由from配置的消息数据类型：JSON、TEXT、BINARY，不根据内容类型判断，GET请求使用url参数的JSON
+const KeyDataType = "dataType"
+
+// DefaultBinaryContentTypes 默认创建BINARY消息的请求内容类型，见 Config.BinaryContentTypes
+var DefaultBinaryContentTypes = []string{"application/octet-stream", "application/x-protobuf", "application/protobuf", "application/cbor"}
+
+// newBinaryContentTypes 创建BINARY消息的内容类型，为空使用 DefaultBinaryContentTypes
+func newBinaryContentTypes(config Config) map[string]struct{} {
+	contentTypes := config.BinaryContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = DefaultBinaryContentTypes
+	}
+	result := make(map[string]struct{}, len(contentTypes))
+	for _, item := range contentTypes {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			result[item] = struct{}{}
+		}
+	}
+	return result
+}
+
+// routerDataType 获取路由from配置的消息数据类型，没有配置返回空
+func (rest *Rest) routerDataType(router endpoint.Router) (types.DataType, error) {
+	from, ok := router.GetFrom().(*impl.From)
+	if !ok || from == nil {
+		return "", nil
+	}
+	v, ok := from.Config[KeyDataType]
+	if !ok || v == nil {
+		return "", nil
+	}
+	switch dataType := types.DataType(strings.ToUpper(str.ToString(v))); dataType {
+	case types.JSON, types.TEXT, types.BINARY:
+		return dataType, nil
+	case "":
+		return "", nil
+	default:
+		return "", fmt.Errorf("router %s dataType config error: unsupported data type %s", router.GetId(), dataType)
+	}
+}
+
+// bodyDataType 请求体的消息数据类型，优先使用路由配置，其次根据内容类型判断
+func (r *RequestMessage) bodyDataType() types.DataType {
+	if r.dataType != "" {
+		return r.dataType
+	}
+	contentType := r.Headers().Get(ContentTypeKey)
+	if strings.HasPrefix(contentType, JsonContextType) {
+		return types.JSON
+	}
+	if len(r.binaryContentTypes) > 0 && contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			if _, ok := r.binaryContentTypes[mediaType]; ok {
+				return types.BINARY
+			}
+		}
+	}
+	return types.TEXT
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestBinaryBody(t *testing.T) {
+	var msgs = make(chan types.RuleMsg, 1)
+	newEndpoint := func(configuration types.Configuration) *Endpoint {
+		var ep = &Endpoint{}
+		assert.Nil(t, ep.Init(types.NewConfig(), configuration))
+		process := func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			msgs <- *exchange.In.GetMsg()
+			return true
+		}
+		_, err := ep.AddRouter(impl.NewRouter().From("/api/data").Process(process).End(), "POST")
+		assert.Nil(t, err)
+		//路由指定消息数据类型
+		_, err = ep.AddRouter(impl.NewRouter().From("/api/raw", types.Configuration{KeyDataType: "binary"}).Process(process).End(), "POST")
+		assert.Nil(t, err)
+		return ep
+	}
+	body := []byte{0x08, 0x96, 0x01, 0xff, 0x00}
+	post := func(ep *Endpoint, path, contentType string) types.RuleMsg {
+		r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		r.Header.Set(ContentTypeKey, contentType)
+		ep.Router().ServeHTTP(httptest.NewRecorder(), r)
+		return <-msgs
+	}
+
+	ep := newEndpoint(types.Configuration{"server": ":9133"})
+	for _, contentType := range []string{"application/octet-stream", "application/x-protobuf", "Application/CBOR; foo=bar"} {
+		msg := post(ep, "/api/data", contentType)
+		assert.Equal(t, types.BINARY, msg.DataType)
+		assert.Equal(t, body, msg.GetBytes())
+	}
+	assert.Equal(t, types.TEXT, post(ep, "/api/data", "text/plain").DataType)
+	msg := post(ep, "/api/raw", "text/plain")
+	assert.Equal(t, types.BINARY, msg.DataType)
+	assert.Equal(t, body, msg.GetBytes())
+
+	//自定义内容类型
+	ep = newEndpoint(types.Configuration{"server": ":9134", "binaryContentTypes": []string{"application/vnd.device"}})
+	assert.Equal(t, types.BINARY, post(ep, "/api/data", "application/vnd.device").DataType)
+	assert.Equal(t, types.TEXT, post(ep, "/api/data", "application/octet-stream").DataType)
+
+	//不支持的数据类型
+	_, err := ep.AddRouter(impl.NewRouter().From("/api/xml", types.Configuration{KeyDataType: "xml"}).End(), "POST")
+	assert.NotNil(t, err)
+}
+
+// BenchmarkBinaryBody 基准测试：1MB请求体创建消息，BINARY消息不复制请求体
+func BenchmarkBinaryBody(b *testing.B) {
+	body := make([]byte, 1024*1024)
+	binaryContentTypes := newBinaryContentTypes(Config{})
+	for _, contentType := range []string{"text/plain", "application/octet-stream"} {
+		b.Run(contentType, func(b *testing.B) {
+			r := httptest.NewRequest(http.MethodPost, "/api/data", nil)
+			r.Header.Set(ContentTypeKey, contentType)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				in := &RequestMessage{request: r, body: body, binaryContentTypes: binaryContentTypes}
+				_ = in.GetMsg()
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	HeaderKeyAcceptEncoding  = "Accept-Encoding"
+	HeaderKeyContentEncoding = "Content-Encoding"
+	HeaderKeyContentLength   = "Content-Length"
+	EncodingGzip             = "gzip"
+	EncodingDeflate          = "deflate"
+	// DefaultCompressionMinSize 默认压缩的最小响应体字节数
+	DefaultCompressionMinSize = 1024
+)
+
+// compressedContentTypes 已经压缩过的响应类型，不再压缩
+var compressedContentTypes = []string{
+	"image/", "video/", "audio/", "font/woff",
+	"application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/x-xz", "application/zstd",
+}
+
+// compressor 响应压缩，所有方法调用方需要持有ResponseMessage的锁
+// 开启压缩后 SetStatusCode 延迟到第一次 SetBody 时写入，以便在提交响应头之前设置 Content-Encoding
+type compressor struct {
+	minSize int
+	//延迟写入的状态码
+	status int
+	//响应头是否已经提交
+	committed bool
+	writer    io.WriteCloser
+}
+
+func newCompressor(config Config) *compressor {
+	if !config.EnableCompression {
+		return nil
+	}
+	minSize := config.CompressionMinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressionMinSize
+	}
+	return &compressor{minSize: minSize}
+}
+
+// commit 根据第一次写入的响应体选择编码，并提交响应头
+func (c *compressor) commit(w http.ResponseWriter, r *http.Request, body []byte) {
+	c.committed = true
+	if encoding := c.encoding(w.Header(), r, body); encoding != "" {
+		header := w.Header()
+		header.Set(HeaderKeyContentEncoding, encoding)
+		header.Add(HeaderKeyVary, HeaderKeyAcceptEncoding)
+		header.Del(HeaderKeyContentLength)
+		if encoding == EncodingGzip {
+			c.writer = gzip.NewWriter(w)
+		} else {
+			c.writer = zlib.NewWriter(w)
+		}
+	}
+	if c.status != 0 {
+		w.WriteHeader(c.status)
+	}
+}
+
+// encoding 返回响应体使用的编码，不压缩返回空
+func (c *compressor) encoding(header http.Header, r *http.Request, body []byte) string {
+	if len(body) < c.minSize || r == nil || header.Get(HeaderKeyContentEncoding) != "" {
+		return ""
+	}
+	if c.status == http.StatusNoContent || c.status == http.StatusNotModified {
+		return ""
+	}
+	contentType := strings.ToLower(header.Get(ContentTypeKey))
+	for _, item := range compressedContentTypes {
+		if strings.HasPrefix(contentType, item) {
+			return ""
+		}
+	}
+	return acceptEncoding(r.Header.Get(HeaderKeyAcceptEncoding))
+}
+
+// write 写入响应体，压缩时每次写入后flush，保证同步路由的响应及时发送
+func (c *compressor) write(w http.ResponseWriter, body []byte) {
+	if c.writer == nil {
+		_, _ = w.Write(body)
+		return
+	}
+	_, _ = c.writer.Write(body)
+	if flusher, ok := c.writer.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+}
+
+// finish 写入没有响应体时延迟的状态码，并结束压缩流
+func (c *compressor) finish(w http.ResponseWriter) {
+	if !c.committed {
+		c.committed = true
+		if c.status != 0 {
+			w.WriteHeader(c.status)
+		}
+	}
+	if c.writer != nil {
+		_ = c.writer.Close()
+		c.writer = nil
+	}
+}
+
+// acceptEncoding 根据 Accept-Encoding 选择编码，优先gzip
+func acceptEncoding(value string) string {
+	var deflate bool
+	for _, item := range strings.Split(value, ",") {
+		name, q := item, ""
+		if i := strings.Index(item, ";"); i >= 0 {
+			name, q = item[:i], strings.TrimSpace(item[i+1:])
+		}
+		if strings.HasPrefix(q, "q=") {
+			if v, err := strconv.ParseFloat(q[2:], 64); err == nil && v <= 0 {
+				continue
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case EncodingGzip:
+			return EncodingGzip
+		case EncodingDeflate:
+			deflate = true
+		}
+	}
+	if deflate {
+		return EncodingDeflate
+	}
+	return ""
+}
+
+// finishCompression 结束响应压缩，处理器返回后由端点调用
+func (r *ResponseMessage) finishCompression() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.compressor == nil || r.response == nil {
+		return
+	}
+	if r.errorResponse != nil && r.err != nil && !r.compressor.committed {
+		//已经由端点写入错误响应
+		return
+	}
+	r.applyConnectionHeader()
+	r.compressor.finish(r.response)
+}
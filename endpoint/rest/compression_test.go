@@ -0,0 +1,128 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestAcceptEncoding(t *testing.T) {
+	assert.Equal(t, EncodingGzip, acceptEncoding("gzip, deflate, br"))
+	assert.Equal(t, EncodingGzip, acceptEncoding("deflate, GZIP;q=0.8"))
+	assert.Equal(t, EncodingDeflate, acceptEncoding("deflate, gzip;q=0"))
+	assert.Equal(t, "", acceptEncoding("br, identity"))
+	assert.Equal(t, "", acceptEncoding(""))
+}
+
+func TestCompression(t *testing.T) {
+	largeBody := `{"data":"` + strings.Repeat("rulego", 500) + `"}`
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9106", "enableCompression": true})
+	assert.Nil(t, err)
+	addRouter := func(path, contentType, body string) {
+		router := impl.NewRouter().From(path).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			exchange.Out.Headers().Set(ContentTypeKey, contentType)
+			//先设置状态码，再设置响应体
+			exchange.Out.SetStatusCode(http.StatusCreated)
+			if body != "" {
+				exchange.Out.SetBody([]byte(body))
+			}
+			return true
+		}).End()
+		_, err := ep.AddRouter(router, "GET")
+		assert.Nil(t, err)
+	}
+	addRouter("/api/large", JsonContextType, largeBody)
+	addRouter("/api/small", JsonContextType, `{"data":"ok"}`)
+	addRouter("/api/image", "image/png", largeBody)
+	addRouter("/api/empty", JsonContextType, "")
+
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "data.json"), []byte(largeBody), 0644))
+	ep.RegisterStaticFiles("/ui/*filepath=" + dir)
+
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			r.Header.Set(HeaderKeyAcceptEncoding, acceptEncoding)
+		}
+		ep.Router().ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/api/large", "gzip, deflate")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, EncodingGzip, w.Header().Get(HeaderKeyContentEncoding))
+	assert.Equal(t, HeaderKeyAcceptEncoding, w.Header().Get(HeaderKeyVary))
+	assert.True(t, w.Body.Len() < len(largeBody))
+	reader, err := gzip.NewReader(w.Body)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, largeBody, string(body))
+
+	w = get("/api/large", "deflate")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, EncodingDeflate, w.Header().Get(HeaderKeyContentEncoding))
+	zreader, err := zlib.NewReader(w.Body)
+	assert.Nil(t, err)
+	body, err = io.ReadAll(zreader)
+	assert.Nil(t, err)
+	assert.Equal(t, largeBody, string(body))
+
+	//客户端不支持压缩
+	w = get("/api/large", "")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "", w.Header().Get(HeaderKeyContentEncoding))
+	assert.Equal(t, largeBody, w.Body.String())
+
+	//响应体小于阈值
+	w = get("/api/small", "gzip")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "", w.Header().Get(HeaderKeyContentEncoding))
+	assert.Equal(t, `{"data":"ok"}`, w.Body.String())
+
+	//已经压缩的响应类型
+	w = get("/api/image", "gzip")
+	assert.Equal(t, "", w.Header().Get(HeaderKeyContentEncoding))
+	assert.Equal(t, largeBody, w.Body.String())
+
+	//没有响应体，延迟的状态码在处理结束时写入
+	w = get("/api/empty", "gzip")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "", w.Header().Get(HeaderKeyContentEncoding))
+
+	//静态文件不压缩
+	w = get("/ui/data.json", "gzip")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get(HeaderKeyContentEncoding))
+	assert.Equal(t, largeBody, w.Body.String())
+}
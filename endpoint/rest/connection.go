@@ -0,0 +1,121 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+const (
+	// KeyConnection 路由from配置：连接指令，配置见 ConnectionConfig
+	KeyConnection = "connection"
+	// HeaderKeyConnection Connection响应头
+	HeaderKeyConnection = "Connection"
+	// HeaderValueClose 响应后关闭连接
+	HeaderValueClose = "close"
+)
+
+// ConnectionConfig 路由连接指令，只对HTTP/1.x请求生效，HTTP/2请求忽略
+// 用于在不禁用整个端点keepalive的情况下，让负载均衡器重新分配某些重路由的连接
+type ConnectionConfig struct {
+	// ForceClose 响应后关闭连接，响应头添加 Connection: close
+	ForceClose bool `json:"forceClose"`
+	// MaxRequestsPerConn 同一个连接处理的请求数（包括其他路由）达到该值后，处理本路由请求时关闭连接，0不限制
+	// 需要由端点启动的服务，使用外部服务时无法统计连接的请求数
+	MaxRequestsPerConn int `json:"maxRequestsPerConn"`
+}
+
+// enabled 是否配置了连接指令
+func (c *ConnectionConfig) enabled() bool {
+	return c != nil && (c.ForceClose || c.MaxRequestsPerConn > 0)
+}
+
+// connStateKey 连接状态上下文key
+type connStateKey struct{}
+
+// connState 连接状态，http.Server.ConnContext 为每个连接创建
+type connState struct {
+	//连接已经处理的请求数
+	requests int64
+}
+
+// withConnState 为每个连接记录请求数
+func withConnState(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connStateKey{}, &connState{})
+}
+
+// countConnRequest 统计连接的请求数，返回包括本次请求在内的请求数，无法统计返回0
+func countConnRequest(r *http.Request) int64 {
+	if state, ok := r.Context().Value(connStateKey{}).(*connState); ok {
+		return atomic.AddInt64(&state.requests, 1)
+	}
+	return 0
+}
+
+// shouldCloseConn 根据连接指令判断响应后是否关闭连接
+// requests 为连接已经处理的请求数
+func shouldCloseConn(config *ConnectionConfig, r *http.Request, requests int64) bool {
+	if !config.enabled() || r.ProtoMajor != 1 {
+		//HTTP/2 多路复用，关闭连接会影响其他流，忽略连接指令
+		return false
+	}
+	if config.ForceClose {
+		return true
+	}
+	return config.MaxRequestsPerConn > 0 && requests >= int64(config.MaxRequestsPerConn)
+}
+
+// routerConnection 获取路由的连接指令配置，没有配置返回nil
+func (rest *Rest) routerConnection(router endpoint.Router) (*ConnectionConfig, error) {
+	if from, ok := router.GetFrom().(*impl.From); ok && from != nil {
+		if v, ok := from.Config[KeyConnection]; ok && v != nil {
+			var config ConnectionConfig
+			if err := maps.Map2Struct(v, &config); err != nil {
+				return nil, fmt.Errorf("router %s connection config error: %w", router.GetId(), err)
+			}
+			if config.MaxRequestsPerConn < 0 {
+				return nil, fmt.Errorf("router %s connection config error: maxRequestsPerConn must be >= 0", router.GetId())
+			}
+			if config.enabled() {
+				return &config, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// ConnectionReusable 响应后连接是否可以被复用
+func (r *ResponseMessage) ConnectionReusable() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.closeConn
+}
+
+// applyConnectionHeader 写入响应前确保连接指令的响应头没有被覆盖，调用方需要持有锁
+func (r *ResponseMessage) applyConnectionHeader() {
+	if r.closeConn && r.response != nil {
+		r.response.Header().Set(HeaderKeyConnection, HeaderValueClose)
+	}
+}
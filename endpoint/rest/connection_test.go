@@ -0,0 +1,131 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestConnectionDirectives(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{
+		"server": ":9096",
+	})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+
+	var reusable atomic.Value
+	recordReusable := func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		out := exchange.Out.(*ResponseMessage)
+		reusable.Store(out.ConnectionReusable())
+		out.Headers().Set(HeaderKeyConnection, "keep-alive")
+		out.SetBody([]byte("ok"))
+		return false
+	}
+	router := impl.NewRouter().From("/api/export", types.Configuration{
+		KeyConnection: map[string]interface{}{"forceClose": true},
+	}).Process(recordReusable).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	router = impl.NewRouter().From("/api/limited", types.Configuration{
+		KeyConnection: map[string]interface{}{"maxRequestsPerConn": 3},
+	}).Process(recordReusable).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	router = impl.NewRouter().From("/api/normal").Process(recordReusable).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+
+	//配置错误
+	router = impl.NewRouter().From("/api/invalid", types.Configuration{
+		KeyConnection: map[string]interface{}{"maxRequestsPerConn": -1},
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.NotNil(t, err)
+
+	err = ep.Start()
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 200)
+
+	//记录建立的连接数
+	var dials int32
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	get := func(path string) *http.Response {
+		resp, err := client.Get("http://127.0.0.1:9096" + path)
+		assert.Nil(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	t.Run("Normal", func(t *testing.T) {
+		resp := get("/api/normal")
+		assert.Equal(t, "keep-alive", resp.Header.Get(HeaderKeyConnection))
+		assert.True(t, reusable.Load().(bool))
+		get("/api/normal")
+		assert.Equal(t, int32(1), atomic.LoadInt32(&dials))
+	})
+
+	t.Run("ForceClose", func(t *testing.T) {
+		resp := get("/api/export")
+		//客户端读取到 Connection: close 后删除该响应头，并标记resp.Close
+		assert.True(t, resp.Close)
+		assert.False(t, reusable.Load().(bool))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&dials))
+		//连接已经关闭，重新建立连接
+		get("/api/normal")
+		assert.Equal(t, int32(2), atomic.LoadInt32(&dials))
+	})
+
+	t.Run("MaxRequestsPerConn", func(t *testing.T) {
+		//当前连接已经处理1个请求
+		resp := get("/api/limited")
+		assert.Equal(t, "keep-alive", resp.Header.Get(HeaderKeyConnection))
+		assert.False(t, resp.Close)
+		resp = get("/api/limited")
+		assert.True(t, resp.Close)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&dials))
+		get("/api/limited")
+		assert.Equal(t, int32(3), atomic.LoadInt32(&dials))
+	})
+
+	t.Run("HTTP2", func(t *testing.T) {
+		config := &ConnectionConfig{ForceClose: true}
+		r := httptest.NewRequest("GET", "/api/export", nil)
+		assert.True(t, shouldCloseConn(config, r, 1))
+		r.ProtoMajor = 2
+		assert.False(t, shouldCloseConn(config, r, 1))
+		assert.False(t, shouldCloseConn(nil, httptest.NewRequest("GET", "/api/normal", nil), 100))
+	})
+}
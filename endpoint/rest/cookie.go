@@ -0,0 +1,87 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// DefaultCookieMetadataPrefix 请求cookie放到msg元数据的默认前缀，例如：cookie.sessionId
+const DefaultCookieMetadataPrefix = "cookie."
+
+// CookieOptions 响应cookie的属性
+type CookieOptions struct {
+	Path   string
+	Domain string
+	// Expires 过期时间，零值表示会话cookie
+	Expires time.Time
+	// MaxAge 大于0表示有效秒数，小于0表示立即删除cookie，0不设置
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// Cookies 获取请求的cookie
+func (r *RequestMessage) Cookies() []*http.Cookie {
+	if r.request == nil {
+		return nil
+	}
+	return r.request.Cookies()
+}
+
+// SetCookie 添加Set-Cookie响应头，可以多次调用设置多个cookie，需要在 SetStatusCode、SetBody 之前调用，opts 为空不设置属性
+func (r *ResponseMessage) SetCookie(name, value string, opts *CookieOptions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.response == nil {
+		return
+	}
+	cookie := &http.Cookie{Name: name, Value: value}
+	if opts != nil {
+		cookie.Path = opts.Path
+		cookie.Domain = opts.Domain
+		cookie.Expires = opts.Expires
+		cookie.MaxAge = opts.MaxAge
+		cookie.Secure = opts.Secure
+		cookie.HttpOnly = opts.HttpOnly
+		cookie.SameSite = opts.SameSite
+	}
+	http.SetCookie(r.response, cookie)
+}
+
+// putCookieMetadata 把请求的cookie放到msg元数据中，覆盖同名的url参数，同名cookie使用第一个
+func (rest *Rest) putCookieMetadata(metadata *types.Metadata, r *http.Request) {
+	if rest.Config.DisableCookieMetadata {
+		return
+	}
+	prefix := rest.Config.CookieMetadataPrefix
+	if prefix == "" {
+		prefix = DefaultCookieMetadataPrefix
+	}
+	seen := make(map[string]struct{})
+	for _, cookie := range r.Cookies() {
+		if _, ok := seen[cookie.Name]; ok {
+			continue
+		}
+		seen[cookie.Name] = struct{}{}
+		metadata.PutValue(prefix+cookie.Name, cookie.Value)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestCookies(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9117"})
+	assert.Nil(t, err)
+	var metadata map[string]string
+	var cookies []*http.Cookie
+	router := impl.NewRouter().From("/api/login").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		metadata = exchange.In.GetMsg().Metadata.Values()
+		cookies = exchange.In.(*RequestMessage).Cookies()
+		out := exchange.Out.(*ResponseMessage)
+		out.SetCookie("sessionId", "s02", &CookieOptions{
+			Path:     "/",
+			MaxAge:   3600,
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		out.SetCookie("theme", "dark", nil)
+		out.SetBody([]byte("ok"))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/login?cookie.sessionId=fake", nil)
+		r.Header.Add("Cookie", "sessionId=s01; lang=zh")
+		r.Header.Add("Cookie", "sessionId=s03")
+		ep.Router().ServeHTTP(w, r)
+		return w
+	}
+	w := serve()
+	assert.Equal(t, 3, len(cookies))
+	//cookie覆盖同名的url参数，同名cookie使用第一个
+	assert.Equal(t, "s01", metadata["cookie.sessionId"])
+	assert.Equal(t, "zh", metadata["cookie.lang"])
+	setCookies := w.Result().Cookies()
+	assert.Equal(t, 2, len(setCookies))
+	assert.Equal(t, "sessionId", setCookies[0].Name)
+	assert.Equal(t, "s02", setCookies[0].Value)
+	assert.Equal(t, 3600, setCookies[0].MaxAge)
+	assert.True(t, setCookies[0].Secure)
+	assert.True(t, setCookies[0].HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, setCookies[0].SameSite)
+	assert.Equal(t, "theme", setCookies[1].Name)
+	assert.Equal(t, "ok", w.Body.String())
+
+	//自定义前缀
+	ep.Config.CookieMetadataPrefix = "c_"
+	serve()
+	assert.Equal(t, "s01", metadata["c_sessionId"])
+	assert.Equal(t, "fake", metadata["cookie.sessionId"])
+
+	ep.Config.DisableCookieMetadata = true
+	serve()
+	_, ok := metadata["c_sessionId"]
+	assert.False(t, ok)
+	assert.Equal(t, 3, len(cookies))
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+const (
+	HeaderKeyOrigin                      = "Origin"
+	HeaderKeyVary                        = "Vary"
+	HeaderKeyAccessControlRequestHeaders = "Access-Control-Request-Headers"
+	HeaderKeyAccessControlAllowCreds     = "Access-Control-Allow-Credentials"
+)
+
+// corsPolicy 跨域策略，由 Config.AllowCors 开启
+// AllowedOrigins、AllowedMethods、AllowedHeaders 为空并且没有开启 AllowCredentials 时，保持允许所有来源(*)的行为
+type corsPolicy struct {
+	origins     []string
+	methods     []string
+	headers     []string
+	credentials bool
+}
+
+func newCorsPolicy(config Config) *corsPolicy {
+	p := &corsPolicy{credentials: config.AllowCredentials}
+	for _, origin := range config.AllowedOrigins {
+		if origin = strings.ToLower(strings.TrimSpace(origin)); origin != "" {
+			p.origins = append(p.origins, origin)
+		}
+	}
+	for _, method := range config.AllowedMethods {
+		if method = strings.ToUpper(strings.TrimSpace(method)); method != "" {
+			p.methods = append(p.methods, method)
+		}
+	}
+	for _, header := range config.AllowedHeaders {
+		if header = strings.TrimSpace(header); header != "" {
+			p.headers = append(p.headers, header)
+		}
+	}
+	return p
+}
+
+// allowOrigin 返回 Access-Control-Allow-Origin 响应头的值，来源不允许返回false
+// 配置了来源列表或者允许携带凭证时回显请求来源，否则为*
+func (p *corsPolicy) allowOrigin(origin string) (string, bool) {
+	if len(p.origins) == 0 {
+		if p.credentials && origin != "" {
+			return origin, true
+		}
+		return HeaderValueAll, true
+	}
+	if origin != "" && MatchOrigin(p.origins, origin) {
+		return origin, true
+	}
+	return "", false
+}
+
+// setOriginHeaders 设置允许的来源响应头
+func (p *corsPolicy) setOriginHeaders(header http.Header, allowOrigin string) {
+	header.Set(HeaderKeyAccessControlAllowOrigin, allowOrigin)
+	if allowOrigin != HeaderValueAll {
+		header.Add(HeaderKeyVary, HeaderKeyOrigin)
+	}
+	if p.credentials {
+		header.Set(HeaderKeyAccessControlAllowCreds, "true")
+	}
+}
+
+// preflight 处理预检请求，不允许的来源或者方法响应403
+// 没有配置 AllowedMethods 时，Access-Control-Allow-Methods 使用Allow响应头的路径实际注册的方法
+func (p *corsPolicy) preflight(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(HeaderKeyAccessControlRequestMethod) != "" {
+		allowOrigin, ok := p.allowOrigin(r.Header.Get(HeaderKeyOrigin))
+		if !ok || !p.allowMethod(r.Header.Get(HeaderKeyAccessControlRequestMethod)) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		header := w.Header()
+		if len(p.methods) > 0 {
+			header.Set(HeaderKeyAccessControlAllowMethods, strings.Join(p.methods, ","))
+		} else if allow := header.Get(HeaderKeyAllow); allow != "" {
+			header.Set(HeaderKeyAccessControlAllowMethods, allow)
+		} else {
+			header.Set(HeaderKeyAccessControlAllowMethods, HeaderValueAll)
+		}
+		if len(p.headers) > 0 {
+			header.Set(HeaderKeyAccessControlAllowHeaders, strings.Join(p.headers, ","))
+		} else if requestHeaders := r.Header.Get(HeaderKeyAccessControlRequestHeaders); p.credentials && requestHeaders != "" {
+			//携带凭证时*不是通配符，回显请求的头
+			header.Set(HeaderKeyAccessControlAllowHeaders, requestHeaders)
+		} else {
+			header.Set(HeaderKeyAccessControlAllowHeaders, HeaderValueAll)
+		}
+		p.setOriginHeaders(header, allowOrigin)
+	}
+	// 返回 204 状态码
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *corsPolicy) allowMethod(method string) bool {
+	if len(p.methods) == 0 {
+		return true
+	}
+	method = strings.ToUpper(strings.TrimSpace(method))
+	for _, item := range p.methods {
+		if item == method {
+			return true
+		}
+	}
+	return false
+}
+
+// interceptor 实际请求的拦截器，只对允许的来源设置跨域响应头，不拦截请求
+func (p *corsPolicy) interceptor(router endpoint.Router, exchange *endpoint.Exchange) bool {
+	origin := ""
+	if headers := exchange.In.Headers(); headers != nil {
+		origin = headers.Get(HeaderKeyOrigin)
+	}
+	if allowOrigin, ok := p.allowOrigin(origin); ok {
+		p.setOriginHeaders(http.Header(exchange.Out.Headers()), allowOrigin)
+	}
+	return true
+}
+
+// MatchOrigin 请求来源是否匹配来源列表，忽略大小写，*匹配除/外的任意字符，例如：https://*.example.com
+func MatchOrigin(patterns []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), origin); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	patterns := []string{"https://*.example.com", "http://localhost:*", "https://rulego.cc"}
+	assert.True(t, MatchOrigin(patterns, "https://api.example.com"))
+	assert.True(t, MatchOrigin(patterns, "https://a.b.Example.com"))
+	assert.True(t, MatchOrigin(patterns, "http://localhost:8080"))
+	assert.True(t, MatchOrigin(patterns, "https://rulego.cc"))
+	assert.False(t, MatchOrigin(patterns, "https://example.com"))
+	assert.False(t, MatchOrigin(patterns, "https://evil.com/.example.com"))
+	assert.False(t, MatchOrigin(patterns, "http://api.example.com"))
+	assert.False(t, MatchOrigin(patterns, "https://rulego.cc.evil.com"))
+	assert.False(t, MatchOrigin(patterns, ""))
+}
+
+func TestCors(t *testing.T) {
+	newEndpoint := func(configuration types.Configuration) *Endpoint {
+		var ep = &Endpoint{}
+		configuration["server"] = ":9104"
+		assert.Nil(t, ep.Init(types.NewConfig(), configuration))
+		router := impl.NewRouter().From("/api/cors").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			exchange.Out.SetBody([]byte("ok"))
+			return true
+		}).End()
+		_, err := ep.AddRouter(router, "GET")
+		assert.Nil(t, err)
+		return ep
+	}
+	preflight := func(ep *Endpoint, origin, method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodOptions, "/api/cors", nil)
+		r.Header.Set(HeaderKeyOrigin, origin)
+		r.Header.Set(HeaderKeyAccessControlRequestMethod, method)
+		r.Header.Set(HeaderKeyAccessControlRequestHeaders, "Content-Type")
+		ep.Router().ServeHTTP(w, r)
+		return w
+	}
+	get := func(ep *Endpoint, origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/cors", nil)
+		r.Header.Set(HeaderKeyOrigin, origin)
+		ep.Router().ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("AllowAll", func(t *testing.T) {
+		ep := newEndpoint(types.Configuration{"allowCors": true})
+		w := preflight(ep, "https://any.com", http.MethodPost)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, HeaderValueAll, w.Header().Get(HeaderKeyAccessControlAllowOrigin))
+		//使用路径实际注册的方法
+		assert.Equal(t, "GET, OPTIONS", w.Header().Get(HeaderKeyAccessControlAllowMethods))
+		assert.Equal(t, HeaderValueAll, w.Header().Get(HeaderKeyAccessControlAllowHeaders))
+		assert.Equal(t, "", w.Header().Get(HeaderKeyVary))
+
+		w = get(ep, "https://any.com")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, HeaderValueAll, w.Header().Get(HeaderKeyAccessControlAllowOrigin))
+	})
+
+	t.Run("AllowedOrigins", func(t *testing.T) {
+		ep := newEndpoint(types.Configuration{
+			"allowCors":        true,
+			"allowedOrigins":   []string{"https://*.example.com"},
+			"allowedMethods":   []string{"get", "POST"},
+			"allowedHeaders":   []string{"Content-Type", "Authorization"},
+			"allowCredentials": true,
+		})
+		w := preflight(ep, "https://app.example.com", http.MethodPost)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://app.example.com", w.Header().Get(HeaderKeyAccessControlAllowOrigin))
+		assert.Equal(t, "GET,POST", w.Header().Get(HeaderKeyAccessControlAllowMethods))
+		assert.Equal(t, "Content-Type,Authorization", w.Header().Get(HeaderKeyAccessControlAllowHeaders))
+		assert.Equal(t, "true", w.Header().Get(HeaderKeyAccessControlAllowCreds))
+		assert.Equal(t, HeaderKeyOrigin, w.Header().Get(HeaderKeyVary))
+
+		//不允许的来源和方法
+		assert.Equal(t, http.StatusForbidden, preflight(ep, "https://evil.com", http.MethodPost).Code)
+		assert.Equal(t, http.StatusForbidden, preflight(ep, "https://app.example.com", http.MethodDelete).Code)
+
+		w = get(ep, "https://app.example.com")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "https://app.example.com", w.Header().Get(HeaderKeyAccessControlAllowOrigin))
+		assert.Equal(t, "true", w.Header().Get(HeaderKeyAccessControlAllowCreds))
+
+		//不允许的来源不设置跨域响应头，由浏览器拦截
+		w = get(ep, "https://evil.com")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "", w.Header().Get(HeaderKeyAccessControlAllowOrigin))
+	})
+
+	t.Run("AllowCredentials", func(t *testing.T) {
+		ep := newEndpoint(types.Configuration{"allowCors": true, "allowCredentials": true})
+		w := preflight(ep, "https://any.com", http.MethodPost)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://any.com", w.Header().Get(HeaderKeyAccessControlAllowOrigin))
+		assert.Equal(t, "Content-Type", w.Header().Get(HeaderKeyAccessControlAllowHeaders))
+	})
+}
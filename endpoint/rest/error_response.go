@@ -0,0 +1,187 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/str"
+)
+
+const (
+	// ErrorCodeChainError 规则链或者路由处理失败
+	ErrorCodeChainError = "CHAIN_ERROR"
+	// ErrorCodeInternalError 处理请求时发生panic
+	ErrorCodeInternalError = "INTERNAL_ERROR"
+	// KeyErrorResponse 路由from配置：覆盖端点的错误响应配置
+	KeyErrorResponse = "errorResponse"
+	// HeaderKeyRequestId 请求ID请求头，错误响应的requestId优先使用该值
+	HeaderKeyRequestId = "X-Request-Id"
+	// DefaultErrorResponseBody 默认错误响应模板
+	DefaultErrorResponseBody = `{"code":"${code}","message":"${message}","requestId":"${requestId}"}`
+)
+
+// ErrorResponse 错误响应配置
+// 同步路由(To.Wait)以错误结束，或者处理请求时发生panic，且还没有写入任何响应时，使用该配置响应客户端
+// 如果已经写入了响应头（例如已经写入部分响应或者发送了保活字节），则中断连接，客户端不会收到看似成功的残缺响应
+type ErrorResponse struct {
+	// StatusCode 响应状态码，默认500
+	StatusCode int `json:"statusCode"`
+	// ContentType 响应类型，默认application/json
+	ContentType string `json:"contentType"`
+	// Body 响应模板，默认DefaultErrorResponseBody
+	// 可用变量：${code} 错误码，${message} 错误信息，${requestId} 请求ID，${status} 状态码
+	// ContentType 是JSON时，变量值按照JSON字符串转义
+	Body string `json:"body"`
+	// Verbose 是否返回内部错误详情，false时message为状态码描述，防止泄露内部信息
+	Verbose bool `json:"verbose"`
+}
+
+// withDefaults 返回填充默认值后的配置
+func (e ErrorResponse) withDefaults() *ErrorResponse {
+	if e.StatusCode <= 0 {
+		e.StatusCode = http.StatusInternalServerError
+	}
+	if e.ContentType == "" {
+		e.ContentType = JsonContextType
+	}
+	if e.Body == "" {
+		e.Body = DefaultErrorResponseBody
+	}
+	return &e
+}
+
+// render 渲染错误响应
+func (e *ErrorResponse) render(code string, err error, requestId string) []byte {
+	message := http.StatusText(e.StatusCode)
+	if e.Verbose && err != nil {
+		message = err.Error()
+	}
+	dict := map[string]interface{}{
+		"code":      code,
+		"message":   message,
+		"requestId": requestId,
+		"status":    strconv.Itoa(e.StatusCode),
+	}
+	if strings.Contains(e.ContentType, "json") {
+		for k, v := range dict {
+			dict[k] = jsonEscape(v.(string))
+		}
+	}
+	return []byte(str.ExecuteTemplate(e.Body, dict))
+}
+
+// jsonEscape 转义为JSON字符串内容，不包含两边的引号
+func jsonEscape(s string) string {
+	b, err := json.Marshal(s)
+	if err != nil || len(b) < 2 {
+		return s
+	}
+	return string(b[1 : len(b)-1])
+}
+
+// routerErrorResponse 获取路由的错误响应配置，路由from配置的errorResponse覆盖端点配置，没有配置返回nil
+func (rest *Rest) routerErrorResponse(router endpoint.Router) (*ErrorResponse, error) {
+	if from, ok := router.GetFrom().(*impl.From); ok && from != nil {
+		if v, ok := from.Config[KeyErrorResponse]; ok && v != nil {
+			var override ErrorResponse
+			if err := maps.Map2Struct(v, &override); err != nil {
+				return nil, fmt.Errorf("router %s errorResponse config error: %w", router.GetId(), err)
+			}
+			return override.withDefaults(), nil
+		}
+	}
+	if rest.Config.ErrorResponse != nil {
+		return rest.Config.ErrorResponse.withDefaults(), nil
+	}
+	return nil, nil
+}
+
+// writeErrorResponse 写入错误响应，如果已经写入响应头，则中断连接
+// requestId 优先使用请求头X-Request-Id，其次使用消息ID
+func writeErrorResponse(w *responseWriter, r *http.Request, errorResponse *ErrorResponse, code string, err error, msgId string) {
+	if w.Committed() {
+		//响应头已经提交，无法修改状态码，中断连接，由http.Server静默处理
+		panic(http.ErrAbortHandler)
+	}
+	requestId := r.Header.Get(HeaderKeyRequestId)
+	if requestId == "" {
+		requestId = msgId
+	}
+	if requestId == "" {
+		uuId, _ := uuid.NewV4()
+		requestId = uuId.String()
+	}
+	header := w.Header()
+	header.Set(ContentTypeKey, errorResponse.ContentType)
+	header.Del("Content-Length")
+	header.Set(HeaderKeyRequestId, requestId)
+	w.WriteHeader(errorResponse.StatusCode)
+	_, _ = w.Write(errorResponse.render(code, err, requestId))
+}
+
+// responseWriter 记录是否已经写入响应头
+type responseWriter struct {
+	http.ResponseWriter
+	committed bool
+}
+
+// Committed 响应头是否已经提交
+func (w *responseWriter) Committed() bool {
+	return w.committed
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	w.committed = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.committed = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.committed = true
+		flusher.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.committed = true
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("http.Hijacker is not supported")
+}
+
+// Unwrap 供 http.ResponseController 使用
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/builtin/processor"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/json"
+)
+
+func TestErrorResponse(t *testing.T) {
+	responseToBody, _ := processor.OutBuiltins.Get("responseToBody")
+	ruleChain := `{
+	  "ruleChain": {"id": "errorResponseTest"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "throw new Error('dial tcp \"db:3306\": refused');"}}
+		]
+	  }
+	}`
+	ruleEngine, err := engine.New("errorResponseTest", []byte(ruleChain), engine.WithConfig(engine.NewConfig(types.WithDefaultPool())))
+	assert.Nil(t, err)
+	defer engine.Del(ruleEngine.Id())
+
+	var ep = &Endpoint{}
+	err = ep.Init(types.NewConfig(), types.Configuration{
+		"server":        ":9094",
+		"errorResponse": map[string]interface{}{},
+	})
+	assert.Nil(t, err)
+
+	//默认配置，隐藏内部错误信息
+	router := impl.NewRouter().From("/api/error").To("chain:errorResponseTest").Wait().Process(responseToBody).End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+
+	//路由覆盖配置，返回内部错误信息
+	router = impl.NewRouter().From("/api/verbose", types.Configuration{
+		KeyErrorResponse: map[string]interface{}{
+			"statusCode": 502,
+			"verbose":    true,
+			"body":       `{"error":{"code":"${code}","status":${status},"detail":"${message}","id":"${requestId}"}}`,
+		},
+	}).To("chain:errorResponseTest").Wait().Process(responseToBody).End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+
+	//规则链执行前已经写入部分响应
+	router = impl.NewRouter().From("/api/partial").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		w := exchange.In.(*RequestMessage).Response()
+		_, _ = w.Write([]byte(`{"items":[`))
+		w.(http.Flusher).Flush()
+		return true
+	}).To("chain:errorResponseTest").Wait().Process(responseToBody).End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+
+	//处理过程中panic
+	router = impl.NewRouter().From("/api/panic", types.Configuration{
+		KeyErrorResponse: map[string]interface{}{"verbose": true},
+	}).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		panic("processor bug")
+	}).To("chain:errorResponseTest").Wait().End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+
+	t.Run("ErrorBeforeWrite", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/error", strings.NewReader(`{"a":1}`))
+		r.Header.Set(HeaderKeyRequestId, "req-1")
+		ep.Router().ServeHTTP(w, r)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, JsonContextType, w.Header().Get(ContentTypeKey))
+		assert.Equal(t, "req-1", w.Header().Get(HeaderKeyRequestId))
+		assert.Equal(t, `{"code":"CHAIN_ERROR","message":"Internal Server Error","requestId":"req-1"}`, w.Body.String())
+	})
+
+	t.Run("Verbose", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/verbose", strings.NewReader(`{"a":1}`)))
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+		var body struct {
+			Error struct {
+				Code   string `json:"code"`
+				Status int    `json:"status"`
+				Detail string `json:"detail"`
+				Id     string `json:"id"`
+			} `json:"error"`
+		}
+		//错误信息中的引号被转义，响应是合法的JSON
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, ErrorCodeChainError, body.Error.Code)
+		assert.Equal(t, 502, body.Error.Status)
+		assert.True(t, strings.Contains(body.Error.Detail, `dial tcp "db:3306": refused`))
+		//没有请求头时使用消息ID
+		assert.Equal(t, 36, len(body.Error.Id))
+	})
+
+	t.Run("ErrorAfterPartialWrite", func(t *testing.T) {
+		server := httptest.NewServer(ep.Router())
+		defer server.Close()
+		resp, err := http.Post(server.URL+"/api/partial", JsonContextType, strings.NewReader(`{"a":1}`))
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		//响应头已经提交，连接被中断，客户端读取响应体失败，不会得到看似成功的响应
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		assert.NotNil(t, err)
+		assert.Equal(t, `{"items":[`, string(body))
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/panic", strings.NewReader(`{"a":1}`)))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		var body map[string]string
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, ErrorCodeInternalError, body["code"])
+		assert.Equal(t, "processor bug", body["message"])
+	})
+
+	t.Run("InvalidRouterConfig", func(t *testing.T) {
+		router := impl.NewRouter().From("/api/invalid", types.Configuration{
+			KeyErrorResponse: "bad",
+		}).To("chain:errorResponseTest").Wait().End()
+		_, err := ep.AddRouter(router, "POST")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestErrorResponseDisabled(t *testing.T) {
+	responseToBody, _ := processor.OutBuiltins.Get("responseToBody")
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9095"})
+	assert.Nil(t, err)
+	router := impl.NewRouter().From("/api/notFound").To("chain:notFoundChain").Wait().Process(responseToBody).End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+
+	//没有配置错误响应，保持原有行为
+	w := httptest.NewRecorder()
+	ep.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/notFound", strings.NewReader(`{"a":1}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "chainId=notFoundChain not found error", w.Body.String())
+}
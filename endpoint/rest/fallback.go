@@ -0,0 +1,125 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+// FallbackRouterId 默认路由的id
+const FallbackRouterId = "fallback"
+
+// SetNotFoundHandler 设置没有匹配路由时的处理器，为空使用httprouter默认的404响应
+// 配置了默认路由时由默认路由处理，重启后保留，共享服务时设置到服务实例
+func (rest *Rest) SetNotFoundHandler(handler http.Handler) {
+	if server, err := rest.serverInstance(); err != nil {
+		rest.Printf("set not found handler err :%v", err)
+	} else {
+		server.Lock()
+		defer server.Unlock()
+		server.notFoundHandler = handler
+		server.applyFallbackHandlers()
+	}
+}
+
+// SetMethodNotAllowedHandler 设置路径匹配但是方法不匹配时的处理器，为空使用httprouter默认的405响应
+// 重启后保留，共享服务时设置到服务实例
+func (rest *Rest) SetMethodNotAllowedHandler(handler http.Handler) {
+	if server, err := rest.serverInstance(); err != nil {
+		rest.Printf("set method not allowed handler err :%v", err)
+	} else {
+		server.Lock()
+		defer server.Unlock()
+		server.methodNotAllowedHandler = handler
+		server.applyFallbackHandlers()
+	}
+}
+
+// SetFallbackRouter 设置默认路由，处理所有没有匹配路由的请求，例如交给规则链记录日志，router为空删除默认路由
+// 默认路由和普通路由一样执行认证、限流、拦截器和To端处理，请求没有路径参数
+func (rest *Rest) SetFallbackRouter(router endpoint.Router) error {
+	server, err := rest.serverInstance()
+	if err != nil {
+		return err
+	}
+	var handler http.Handler
+	if router != nil {
+		if router.GetFrom() == nil {
+			return errors.New("fallback router from can not be nil")
+		}
+		if router.GetId() == "" {
+			router.SetId(FallbackRouterId)
+		}
+		isWait := false
+		if to := router.GetFrom().GetTo(); to != nil {
+			isWait = to.IsWait()
+		}
+		errorResponse, err := server.routerErrorResponse(router)
+		if err != nil {
+			return err
+		}
+		connection, err := server.routerConnection(router)
+		if err != nil {
+			return err
+		}
+		limiter, err := server.routerRateLimit(router)
+		if err != nil {
+			return err
+		}
+		timeout, err := server.routerTimeout(router)
+		if err != nil {
+			return err
+		}
+		dataType, err := server.routerDataType(router)
+		if err != nil {
+			return err
+		}
+		handle := server.handler(router, isWait, errorResponse, connection, rest.auth, limiter, timeout, dataType)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handle(w, r, nil)
+		})
+	}
+	server.Lock()
+	defer server.Unlock()
+	server.fallbackHandler = handler
+	server.applyFallbackHandlers()
+	return nil
+}
+
+// serverInstance 获取持有http服务的实例，共享服务时为服务实例
+func (rest *Rest) serverInstance() (*Rest, error) {
+	if err := rest.checkIsInitSharedNode(); err != nil {
+		return nil, err
+	}
+	return rest.SharedNode.Get()
+}
+
+// applyFallbackHandlers 把404、405处理器和默认路由设置到httprouter，newRouter 重新创建路由器后调用，调用方需要持有锁或者在初始化时调用
+func (rest *Rest) applyFallbackHandlers() {
+	if rest.router == nil {
+		return
+	}
+	if rest.fallbackHandler != nil {
+		rest.router.NotFound = rest.fallbackHandler
+	} else {
+		rest.router.NotFound = rest.notFoundHandler
+	}
+	rest.router.MethodNotAllowed = rest.methodNotAllowedHandler
+}
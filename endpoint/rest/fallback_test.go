@@ -0,0 +1,93 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestFallbackHandlers(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9115"})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+	router := impl.NewRouter().From("/api/devices").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte("devices"))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	jsonHandler := func(code int, body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(ContentTypeKey, JsonContextType)
+			w.WriteHeader(code)
+			_, _ = w.Write([]byte(body))
+		})
+	}
+
+	ep.SetNotFoundHandler(jsonHandler(http.StatusNotFound, `{"error":"not found"}`))
+	ep.SetMethodNotAllowedHandler(jsonHandler(http.StatusMethodNotAllowed, `{"error":"method not allowed"}`))
+	w := serve(http.MethodGet, "/api/unknown")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":"not found"}`, w.Body.String())
+	w = serve(http.MethodPost, "/api/devices")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, `{"error":"method not allowed"}`, w.Body.String())
+	assert.Equal(t, "devices", serve(http.MethodGet, "/api/devices").Body.String())
+
+	//默认路由处理所有没有匹配路由的请求
+	var paths []string
+	fallback := impl.NewRouter().From("/*").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		paths = append(paths, exchange.In.(*RequestMessage).request.URL.Path)
+		exchange.Out.SetStatusCode(http.StatusNotFound)
+		exchange.Out.SetBody([]byte(`{"fallback":true}`))
+		return true
+	}).End()
+	assert.Nil(t, ep.SetFallbackRouter(fallback))
+	assert.Equal(t, FallbackRouterId, fallback.GetId())
+	w = serve(http.MethodPut, "/api/unknown")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"fallback":true}`, w.Body.String())
+	assert.Equal(t, []string{"/api/unknown"}, paths)
+
+	//重启后保留
+	assert.Nil(t, ep.Start())
+	time.Sleep(time.Millisecond * 200)
+	assert.Nil(t, ep.Restart())
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, `{"fallback":true}`, serve(http.MethodGet, "/other").Body.String())
+	assert.Equal(t, `{"error":"method not allowed"}`, serve(http.MethodPost, "/api/devices").Body.String())
+
+	//删除默认路由后使用404处理器
+	assert.Nil(t, ep.SetFallbackRouter(nil))
+	assert.Equal(t, `{"error":"not found"}`, serve(http.MethodGet, "/other").Body.String())
+	assert.Equal(t, []string{"/api/unknown", "/other"}, paths)
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"mime"
+	"net/url"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// FormContentType 表单请求体的内容类型
+const FormContentType = "application/x-www-form-urlencoded"
+
+// isForm 请求体是否是 application/x-www-form-urlencoded 表单
+func (r *RequestMessage) isForm() bool {
+	if r.request == nil {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.request.Header.Get(ContentTypeKey))
+	return err == nil && mediaType == FormContentType
+}
+
+// Form 获取 application/x-www-form-urlencoded 请求体的表单字段，从 Body 解析并且只解析一次，
+// 和读取请求体的先后顺序无关，其他内容类型返回nil
+func (r *RequestMessage) Form() url.Values {
+	if !r.formParsed {
+		r.formParsed = true
+		if r.isForm() {
+			//解析失败保留已经解析的字段
+			r.form, _ = url.ParseQuery(string(r.Body()))
+		}
+	}
+	return r.form
+}
+
+// putFormMetadata 把表单字段放到msg元数据中，覆盖同名的url参数，重复的字段使用JSON数组字符串
+func (rest *Rest) putFormMetadata(metadata *types.Metadata, r *RequestMessage) {
+	if rest.Config.DisableFormMetadata {
+		return
+	}
+	putQueryMetadata(metadata, r.Form(), "")
+}
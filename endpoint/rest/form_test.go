@@ -0,0 +1,68 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestFormBody(t *testing.T) {
+	newEndpoint := func(configuration types.Configuration) *Endpoint {
+		var ep = &Endpoint{}
+		assert.Nil(t, ep.Init(types.NewConfig(), configuration))
+		router := impl.NewRouter().From("/api/devices/:id").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			//先读取请求体，不影响读取表单字段
+			body := string(exchange.In.Body())
+			msg := exchange.In.GetMsg()
+			params := []string{exchange.In.GetParam("id"), exchange.In.GetParam("name"), exchange.In.GetParam("page")}
+			exchange.Out.SetBody([]byte(strings.Join([]string{body, string(msg.DataType), msg.GetData(),
+				msg.Metadata.GetValue("id"), msg.Metadata.GetValue("name"), msg.Metadata.GetValue("tag"), strings.Join(params, ",")}, "|")))
+			return true
+		}).End()
+		_, err := ep.AddRouter(router, "POST")
+		assert.Nil(t, err)
+		return ep
+	}
+	serve := func(ep *Endpoint, contentType string) string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/devices/d01?id=q01&name=query&page=2", strings.NewReader("id=f01&name=form&tag=a&tag=b"))
+		r.Header.Set(ContentTypeKey, contentType)
+		ep.Router().ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	//路径参数优先，表单字段覆盖同名的url参数
+	ep := newEndpoint(types.Configuration{"server": ":9128"})
+	assert.Equal(t, `id=f01&name=form&tag=a&tag=b|TEXT|id=f01&name=form&tag=a&tag=b|f01|form|["a","b"]|d01,form,2`,
+		serve(ep, FormContentType+"; charset=utf-8"))
+	//其他内容类型不解析请求体
+	assert.Equal(t, `id=f01&name=form&tag=a&tag=b|TEXT|id=f01&name=form&tag=a&tag=b|q01|query||d01,query,2`,
+		serve(ep, "text/plain"))
+
+	//转换成JSON消息负荷，不放到元数据中
+	ep = newEndpoint(types.Configuration{"server": ":9129", "formToJson": true, "disableFormMetadata": true})
+	assert.Equal(t, `id=f01&name=form&tag=a&tag=b|JSON|{"id":["f01"],"name":["form"],"tag":["a","b"]}|q01|query||d01,form,2`,
+		serve(ep, FormContentType))
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/str"
+)
+
+// ErrGroupNestedTooDeep 路由分组只允许嵌套一层
+var ErrGroupNestedTooDeep = errors.New("router group can only be nested one level deep")
+
+// RouterGroup 路由分组，分组内的路由共享路径前缀和拦截器
+// 注册路由时，把分组前缀添加到路由路径前面，分组拦截器在路由自身的from端处理器之前执行
+// 例如：
+//
+//	v1 := restEndpoint.Group("/api/v1", authInterceptor)
+//	err := v1.GET(impl.NewRouter().From("/users/:id").To("chain:users").End())
+//
+// 实际注册的路径为 /api/v1/users/:id
+type RouterGroup struct {
+	rest   *Rest
+	parent *RouterGroup
+	// 完整的路径前缀，包括父分组前缀
+	prefix string
+	// 完整的拦截器列表，父分组拦截器在前
+	interceptors []endpoint.Process
+	err          error
+	mu           sync.Mutex
+	// 分组内注册成功的路由ID
+	routerIds []string
+	children  []*RouterGroup
+}
+
+// Group 创建路由分组，prefix为路径前缀，interceptors为分组拦截器
+func (rest *Rest) Group(prefix string, interceptors ...endpoint.Process) *RouterGroup {
+	return &RouterGroup{
+		rest:         rest,
+		prefix:       normalizePrefix(prefix),
+		interceptors: interceptors,
+	}
+}
+
+// Group 创建子分组，子分组继承当前分组的前缀和拦截器。子分组不能再创建分组
+func (g *RouterGroup) Group(prefix string, interceptors ...endpoint.Process) *RouterGroup {
+	child := &RouterGroup{
+		rest:         g.rest,
+		parent:       g,
+		prefix:       g.prefix + normalizePrefix(prefix),
+		interceptors: append(append([]endpoint.Process{}, g.interceptors...), interceptors...),
+		err:          g.err,
+	}
+	if g.parent != nil {
+		child.err = ErrGroupNestedTooDeep
+	}
+	g.mu.Lock()
+	g.children = append(g.children, child)
+	g.mu.Unlock()
+	return child
+}
+
+// Prefix 分组完整的路径前缀
+func (g *RouterGroup) Prefix() string {
+	return g.prefix
+}
+
+// AddRouter 在分组内注册路由，params[0]为HTTP方法
+// 路径和已经注册的路由冲突，例如共享服务的其他规则链已经注册了相同的路径，返回错误
+func (g *RouterGroup) AddRouter(router endpoint.Router, params ...interface{}) (string, error) {
+	if g.err != nil {
+		return "", g.err
+	}
+	if len(params) <= 0 {
+		return "", errors.New("need to specify HTTP method")
+	} else if router == nil {
+		return "", errors.New("router can not nil")
+	}
+	from, ok := router.GetFrom().(*impl.From)
+	if !ok {
+		return "", errors.New("router from is not set")
+	}
+	//添加分组前缀和拦截器，注册失败则还原
+	path := from.From
+	processList := from.GetProcessList()
+	//路径前的Host不加分组前缀
+	host, hostPath := splitHost(path)
+	from.From = host + g.fullPath(hostPath)
+	from.SetProcessList(append(append([]endpoint.Process{}, g.interceptors...), processList...))
+	def := router.Definition()
+	if def != nil {
+		def.From.Path = from.From
+	}
+
+	id, err := g.rest.AddRouter(router, strings.ToUpper(str.ToString(params[0])))
+	if err != nil {
+		from.From = path
+		from.SetProcessList(processList)
+		if def != nil {
+			def.From.Path = path
+		}
+		return "", err
+	}
+	g.mu.Lock()
+	g.routerIds = append(g.routerIds, id)
+	g.mu.Unlock()
+	return id, nil
+}
+
+func (g *RouterGroup) GET(routers ...endpoint.Router) error {
+	return g.addRouters(http.MethodGet, routers...)
+}
+
+func (g *RouterGroup) HEAD(routers ...endpoint.Router) error {
+	return g.addRouters(http.MethodHead, routers...)
+}
+
+func (g *RouterGroup) OPTIONS(routers ...endpoint.Router) error {
+	return g.addRouters(http.MethodOptions, routers...)
+}
+
+func (g *RouterGroup) POST(routers ...endpoint.Router) error {
+	return g.addRouters(http.MethodPost, routers...)
+}
+
+func (g *RouterGroup) PUT(routers ...endpoint.Router) error {
+	return g.addRouters(http.MethodPut, routers...)
+}
+
+func (g *RouterGroup) PATCH(routers ...endpoint.Router) error {
+	return g.addRouters(http.MethodPatch, routers...)
+}
+
+func (g *RouterGroup) DELETE(routers ...endpoint.Router) error {
+	return g.addRouters(http.MethodDelete, routers...)
+}
+
+// RouterIds 分组内注册的路由ID，包括子分组
+func (g *RouterGroup) RouterIds() []string {
+	g.mu.Lock()
+	ids := append([]string{}, g.routerIds...)
+	children := append([]*RouterGroup{}, g.children...)
+	g.mu.Unlock()
+	for _, child := range children {
+		ids = append(ids, child.RouterIds()...)
+	}
+	return ids
+}
+
+// Remove 删除分组内的所有路由，包括子分组的路由。在同一个锁内完成，请求不会看到只删除了部分路由的状态
+func (g *RouterGroup) Remove() {
+	ids := g.RouterIds()
+	g.rest.removeRouters(ids)
+	g.clear()
+}
+
+func (g *RouterGroup) clear() {
+	g.mu.Lock()
+	g.routerIds = nil
+	children := g.children
+	g.mu.Unlock()
+	for _, child := range children {
+		child.clear()
+	}
+}
+
+func (g *RouterGroup) addRouters(method string, routers ...endpoint.Router) error {
+	for _, router := range routers {
+		if _, err := g.AddRouter(router, method); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fullPath 添加分组前缀
+func (g *RouterGroup) fullPath(path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" || path == "/" {
+		if g.prefix == "" {
+			return "/"
+		}
+		return g.prefix
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return g.prefix + path
+}
+
+// normalizePrefix 前缀以/开头，不以/结尾
+func normalizePrefix(prefix string) string {
+	prefix = strings.TrimRight(strings.TrimSpace(prefix), "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
+
+// removeRouters 在同一个锁内删除多个路由
+func (rest *Rest) removeRouters(routerIds []string) {
+	rest.Lock()
+	defer rest.Unlock()
+	for _, id := range routerIds {
+		rest.removeRouter(id, false)
+	}
+}
+
+// RouteInfo 路由信息
+type RouteInfo struct {
+	// Id 路由ID
+	Id string `json:"id"`
+	// Method HTTP方法
+	Method string `json:"method"`
+	// Path 实际注册的完整路径，包括分组前缀和 Config.BasePath
+	Path string `json:"path"`
+	// Host 匹配的请求Host，为空匹配所有Host，见 KeyHost
+	Host string `json:"host,omitempty"`
+	// Disabled 是否已经删除
+	Disabled bool `json:"disabled"`
+}
+
+// Routes 获取当前端点注册的路由列表，按照路径和方法排序
+func (rest *Rest) Routes() []RouteInfo {
+	rest.RLock()
+	defer rest.RUnlock()
+	var routes []RouteInfo
+	for id, router := range rest.RouterStorage {
+		var method string
+		if params := router.GetParams(); len(params) > 0 {
+			method = str.ToString(params[0])
+		}
+		host, path := routerHostPath(router)
+		routes = append(routes, RouteInfo{
+			Id:       id,
+			Method:   method,
+			Path:     rest.fullPath(path),
+			Host:     host,
+			Disabled: router.IsDisable(),
+		})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			if routes[i].Method == routes[j].Method {
+				return routes[i].Host < routes[j].Host
+			}
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
+}
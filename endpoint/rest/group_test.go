@@ -0,0 +1,112 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// orderInterceptor 把名称追加到响应头X-Order，用于验证执行顺序
+func orderInterceptor(name string) endpoint.Process {
+	return func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.Headers().Add("X-Order", name)
+		return true
+	}
+}
+
+func newGroupTestRouter(path string) endpoint.Router {
+	return impl.NewRouter().From(path).Process(orderInterceptor("router")).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte(router.FromToString()))
+		return true
+	}).End()
+}
+
+func serveGroupTest(ep *Endpoint, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ep.Router().ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestRouterGroup(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9094"})
+	assert.Nil(t, err)
+
+	api := ep.Group("api/", orderInterceptor("api"))
+	v1 := api.Group("/v1", orderInterceptor("v1"))
+	assert.Equal(t, "/api/v1", v1.Prefix())
+
+	err = api.GET(newGroupTestRouter("/health"))
+	assert.Nil(t, err)
+	err = v1.POST(newGroupTestRouter("/users/:id"), newGroupTestRouter("/devices"))
+	assert.Nil(t, err)
+
+	t.Run("Serve", func(t *testing.T) {
+		w := serveGroupTest(ep, http.MethodPost, "/api/v1/users/1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "/api/v1/users/:id", w.Body.String())
+		//分组拦截器在路由处理器之前执行，父分组在前
+		assert.Equal(t, "api,v1,router", strings.Join(w.Header().Values("X-Order"), ","))
+
+		w = serveGroupTest(ep, http.MethodGet, "/api/health")
+		assert.Equal(t, "api,router", strings.Join(w.Header().Values("X-Order"), ","))
+		assert.Equal(t, http.StatusNotFound, serveGroupTest(ep, http.MethodPost, "/users/1").Code)
+	})
+
+	t.Run("Routes", func(t *testing.T) {
+		var paths []string
+		for _, route := range ep.Routes() {
+			paths = append(paths, route.Method+" "+route.Path)
+		}
+		assert.Equal(t, "GET /api/health,POST /api/v1/devices,POST /api/v1/users/:id", strings.Join(paths, ","))
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		other := ep.Group("/api/v1")
+		router := newGroupTestRouter("/devices")
+		_, err := other.AddRouter(router, http.MethodPost)
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "conflicts with registered router"))
+		//注册失败，路由路径还原
+		assert.Equal(t, "/devices", router.FromToString())
+		assert.Equal(t, 0, len(other.RouterIds()))
+	})
+
+	t.Run("NestedTooDeep", func(t *testing.T) {
+		err := v1.Group("/x").GET(newGroupTestRouter("/y"))
+		assert.Equal(t, ErrGroupNestedTooDeep, err)
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		assert.Equal(t, 3, len(api.RouterIds()))
+		api.Remove()
+		assert.Equal(t, 0, len(api.RouterIds()))
+		assert.Equal(t, http.StatusNotFound, serveGroupTest(ep, http.MethodGet, "/api/health").Code)
+		assert.Equal(t, http.StatusNotFound, serveGroupTest(ep, http.MethodPost, "/api/v1/devices").Code)
+		for _, route := range ep.Routes() {
+			assert.True(t, route.Disabled)
+		}
+	})
+}
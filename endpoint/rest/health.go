@@ -0,0 +1,126 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/json"
+)
+
+const (
+	// HealthzPath 默认存活检查路径，服务没有启动或者 types.HealthReport.Live 为false返回503
+	HealthzPath = "/healthz"
+	// ReadyzPath 默认就绪检查路径，types.HealthReport.Ready 为false或者有路由不可用返回503
+	ReadyzPath = "/readyz"
+	// HealthRouterPrefix 就绪检查中路由的名称前缀，后面是路由id
+	HealthRouterPrefix = "router:"
+)
+
+// healthCheckEnabled 是否注册存活和就绪检查路由
+func (rest *Rest) healthCheckEnabled() bool {
+	return rest.Config.HealthCheck || rest.Config.HealthCheckPath != "" || rest.Config.ReadinessPath != ""
+}
+
+// addHealthRouters 注册存活和就绪检查路由，响应体为 types.HealthReport JSON
+// 直接注册到httprouter，不经过规则链、拦截器和路由存储，随 newRouter 在重启后重新注册，共享服务只由服务实例注册
+// 没有配置 types.Config.HealthRegistry 则只检查服务和路由的状态
+func (rest *Rest) addHealthRouters() error {
+	healthPath, readinessPath := rest.Config.HealthCheckPath, rest.Config.ReadinessPath
+	if healthPath == "" {
+		healthPath = HealthzPath
+	}
+	if readinessPath == "" {
+		readinessPath = ReadyzPath
+	}
+	if err := Handle(rest.router, http.MethodGet, healthPath, rest.healthHandler(func(report *types.HealthReport) bool {
+		return rest.Started() && report.Live
+	})); err != nil {
+		return err
+	}
+	return Handle(rest.router, http.MethodGet, readinessPath, rest.healthHandler(func(report *types.HealthReport) bool {
+		routersReady := rest.checkRouters(report)
+		return rest.Started() && report.Ready && routersReady
+	}))
+}
+
+func (rest *Rest) healthHandler(ok func(report *types.HealthReport) bool) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		report := types.HealthReport{Status: types.HealthHealthy, Live: true, Ready: true, Checks: []types.HealthCheck{}}
+		if healthRegistry := rest.RuleConfig.HealthRegistry; healthRegistry != nil {
+			report = healthRegistry.Health()
+		}
+		healthy := ok(&report)
+		body, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(ContentTypeKey, JsonContextType)
+		if healthy {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = w.Write(body)
+	}
+}
+
+// checkRouters 检查所有路由是否可用，开启 ReadinessCheckChains 时检查To端规则链是否已经加载
+// 不可用的路由添加到报告的检查项中，返回所有路由是否可用
+func (rest *Rest) checkRouters(report *types.HealthReport) bool {
+	rest.RLock()
+	defer rest.RUnlock()
+	ready := true
+	now := time.Now()
+	for id, router := range rest.RouterStorage {
+		reason := ""
+		if router.IsDisable() {
+			reason = "router is disabled"
+		} else if rest.Config.ReadinessCheckChains {
+			if r, ok := router.(*impl.Router); ok {
+				if loaded, checked := r.ToChainLoaded(); checked && !loaded {
+					reason = fmt.Sprintf("rule chain %s is not loaded", router.GetFrom().GetTo().ToString())
+				}
+			}
+		}
+		if reason != "" {
+			ready = false
+			report.Checks = append(report.Checks, types.HealthCheck{
+				Name:      HealthRouterPrefix + id,
+				Status:    types.HealthUnhealthy,
+				Reason:    reason,
+				CheckedAt: now,
+				Required:  true,
+			})
+		}
+	}
+	if !ready {
+		report.Ready = false
+		report.Status = types.HealthUnhealthy
+		sort.Slice(report.Checks, func(i, j int) bool {
+			return report.Checks[i].Name < report.Checks[j].Name
+		})
+	}
+	return ready
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/json"
+)
+
+func TestHealthCheck(t *testing.T) {
+	healthRegistry := engine.NewHealthRegistry(types.HealthPolicy{})
+	//模拟broker连接
+	var connected int32 = 1
+	healthRegistry.Register(types.HealthResourcePrefix+"tcp://127.0.0.1:1883", func() (types.HealthStatus, string) {
+		if atomic.LoadInt32(&connected) == 1 {
+			return types.HealthHealthy, ""
+		}
+		return types.HealthUnhealthy, "mqtt broker disconnected"
+	})
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(types.WithHealthRegistry(healthRegistry)), types.Configuration{
+		"server":      ":9102",
+		"healthCheck": true,
+	})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+	assert.Nil(t, ep.Start())
+	time.Sleep(time.Millisecond * 200)
+
+	get := func(path string) (int, types.HealthReport) {
+		resp, err := http.Get("http://127.0.0.1:9102" + path)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, JsonContextType, resp.Header.Get(ContentTypeKey))
+		body, _ := io.ReadAll(resp.Body)
+		var report types.HealthReport
+		assert.Nil(t, json.Unmarshal(body, &report))
+		return resp.StatusCode, report
+	}
+
+	code, report := get(HealthzPath)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = get(ReadyzPath)
+	assert.Equal(t, http.StatusOK, code)
+
+	//broker不可用，就绪检查失败，存活检查不受影响
+	atomic.StoreInt32(&connected, 0)
+	code, report = get(ReadyzPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, types.HealthUnhealthy, report.Status)
+	assert.Equal(t, "mqtt broker disconnected", report.Checks[0].Reason)
+	code, report = get(HealthzPath)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Live)
+
+	atomic.StoreInt32(&connected, 1)
+	code, _ = get(ReadyzPath)
+	assert.Equal(t, http.StatusOK, code)
+
+	//没有开启健康检查
+	var ep2 = &Endpoint{}
+	assert.Nil(t, ep2.Init(types.NewConfig(), types.Configuration{"server": ":9103"}))
+	defer ep2.Destroy()
+	assert.Nil(t, ep2.Start())
+	time.Sleep(time.Millisecond * 200)
+	resp, err := http.Get("http://127.0.0.1:9103" + ReadyzPath)
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestHealthCheckRouters(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{
+		"server":               ":9114",
+		"healthCheckPath":      "/probe/live",
+		"readinessPath":        "/probe/ready",
+		"readinessCheckChains": true,
+	})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+	router := impl.NewRouter().From("/api/health").To("chain:healthCheckTest").End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+
+	get := func(path string) (int, types.HealthReport) {
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var report types.HealthReport
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report
+	}
+	//服务没有启动
+	code, _ := get("/probe/live")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Nil(t, ep.Start())
+	time.Sleep(time.Millisecond * 200)
+	code, _ = get("/probe/live")
+	assert.Equal(t, http.StatusOK, code)
+
+	//规则链没有加载
+	code, report := get("/probe/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, HealthRouterPrefix+router.GetId(), report.Checks[0].Name)
+	assert.Equal(t, "rule chain healthCheckTest is not loaded", report.Checks[0].Reason)
+
+	ruleChain := `{"ruleChain": {"id": "healthCheckTest"}, "metadata": {"nodes": []}}`
+	ruleEngine, err := engine.New("healthCheckTest", []byte(ruleChain))
+	assert.Nil(t, err)
+	defer engine.Del(ruleEngine.Id())
+	code, _ = get("/probe/ready")
+	assert.Equal(t, http.StatusOK, code)
+
+	//路由不可用
+	assert.Nil(t, ep.RemoveRouter(router.GetId()))
+	code, report = get("/probe/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "router is disabled", report.Checks[0].Reason)
+	code, _ = get("/probe/live")
+	assert.Equal(t, http.StatusOK, code)
+
+	//重启后仍然可用
+	assert.Nil(t, ep.Restart())
+	time.Sleep(time.Millisecond * 200)
+	code, _ = get("/probe/live")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = get("/probe/ready")
+	assert.Equal(t, http.StatusOK, code)
+}
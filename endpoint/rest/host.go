@@ -0,0 +1,81 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net"
+	"strings"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/str"
+)
+
+// KeyHost 路由from配置：匹配的请求Host（虚拟主机），例如：tenant-a.example.com，为空匹配所有Host
+// 也可以在路径前加上Host，例如：From("tenant-a.example.com/ingest")，from配置优先
+// 请求先匹配Host相同的路由，没有则匹配没有配置Host的路由。请求的Host（不包含端口）放到msg元数据的该key
+const KeyHost = "host"
+
+// splitHost 拆分From中的Host和路径，以/开头时没有Host
+func splitHost(from string) (host, path string) {
+	from = strings.TrimSpace(from)
+	if from == "" || strings.HasPrefix(from, "/") {
+		return "", from
+	}
+	if i := strings.Index(from, "/"); i > 0 && isHost(from[:i]) {
+		return from[:i], from[i:]
+	}
+	return "", from
+}
+
+// isHost 是否只包含Host允许的字符：字母、数字、-、.，以及端口和IPv6地址的:、[、]
+func isHost(host string) bool {
+	for _, c := range host {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-.:[]", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeHost 转换成小写并去掉端口，用于匹配请求的Host
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// routerHostPath 获取路由匹配的Host和路径，Host已经转换成小写并去掉端口
+func routerHostPath(router endpoint.Router) (host, path string) {
+	host, path = splitHost(router.FromToString())
+	if from, ok := router.GetFrom().(*impl.From); ok && from != nil {
+		if v, ok := from.Config[KeyHost]; ok && v != nil {
+			if value := str.ToString(v); value != "" {
+				host = value
+			}
+		}
+	}
+	return normalizeHost(host), path
+}
+
+// routerPath 获取路由的路径，不包含Host
+func routerPath(router endpoint.Router) string {
+	_, path := routerHostPath(router)
+	return path
+}
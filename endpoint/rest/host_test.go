@@ -0,0 +1,82 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestHostRouting(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9150"})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+	newRouter := func(from, body string, configs ...types.Configuration) endpoint.Router {
+		return impl.NewRouter().From(from, configs...).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			exchange.Out.SetBody([]byte(body + ":" + exchange.In.GetMsg().Metadata.GetValue(KeyHost)))
+			return true
+		}).End()
+	}
+	serve := func(host string) string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader("{}"))
+		r.Host = host
+		ep.Router().ServeHTTP(w, r)
+		return w.Body.String()
+	}
+	id, err := ep.AddRouter(newRouter("tenant-a.example.com/ingest", "a"), "POST")
+	assert.Nil(t, err)
+	assert.Equal(t, "POST:tenant-a.example.com/ingest", id)
+	id, err = ep.AddRouter(newRouter("/ingest", "b", types.Configuration{KeyHost: "Tenant-B.example.com"}), "POST")
+	assert.Nil(t, err)
+	assert.Equal(t, "POST:tenant-b.example.com/ingest", id)
+
+	//没有配置Host的路由之前，其他Host响应404
+	assert.Equal(t, "404 page not found\n", serve("other.example.com"))
+	id, err = ep.AddRouter(newRouter("/ingest", "default"), "POST")
+	assert.Nil(t, err)
+	assert.Equal(t, "POST:/ingest", id)
+
+	assert.Equal(t, "a:tenant-a.example.com", serve("tenant-a.example.com:9150"))
+	assert.Equal(t, "b:tenant-b.example.com", serve("TENANT-B.example.com"))
+	assert.Equal(t, "default:other.example.com", serve("other.example.com"))
+
+	//相同Host和路径冲突
+	_, err = ep.AddRouter(newRouter("/ingest", "a2", types.Configuration{KeyHost: "tenant-a.example.com"}), "POST")
+	assert.NotNil(t, err)
+
+	routes := ep.Routes()
+	assert.Equal(t, 3, len(routes))
+	assert.Equal(t, "", routes[0].Host)
+	assert.Equal(t, "tenant-a.example.com", routes[1].Host)
+	assert.Equal(t, "/ingest", routes[1].Path)
+
+	//删除后使用没有配置Host的路由
+	assert.Nil(t, ep.RemoveRouter("POST:tenant-a.example.com/ingest"))
+	assert.Equal(t, "default:tenant-a.example.com", serve("tenant-a.example.com"))
+	_, err = ep.AddRouter(newRouter("tenant-a.example.com/ingest", "a3"), "POST")
+	assert.Nil(t, err)
+	assert.Equal(t, "a3:tenant-a.example.com", serve("tenant-a.example.com"))
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+
+	"github.com/rulego/rulego/api/types"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// ProtocolKey 开启 Config.EnableHTTP2 后，请求协商的协议的元数据key，例如：HTTP/1.1、HTTP/2.0
+const ProtocolKey = "protocol"
+
+// configureHTTP2 开启HTTP/2，TLS通过ALPN协商，明文使用h2c（支持prior knowledge和Upgrade: h2c）
+// 需要在设置超时配置之后调用
+func (rest *Rest) configureHTTP2(isTls bool) error {
+	if !rest.Config.EnableHTTP2 {
+		return nil
+	}
+	h2s := &http2.Server{IdleTimeout: rest.Server.IdleTimeout}
+	if isTls {
+		rest.Server.TLSConfig.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+	}
+	//关闭服务时通知HTTP/2连接不再接收新的流
+	if err := http2.ConfigureServer(rest.Server, h2s); err != nil {
+		return err
+	}
+	if !isTls {
+		rest.Server.Handler = h2c.NewHandler(rest.Server.Handler, h2s)
+	}
+	return nil
+}
+
+// putProtocol 把请求协商的协议放到msg元数据中
+func (rest *Rest) putProtocol(metadata *types.Metadata, r *http.Request) {
+	if rest.Config.EnableHTTP2 {
+		metadata.PutValue(ProtocolKey, r.Proto)
+	}
+}
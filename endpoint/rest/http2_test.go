@@ -0,0 +1,125 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/test/cert"
+	"golang.org/x/net/http2"
+)
+
+func TestHTTP2(t *testing.T) {
+	registry := new(engine.RuleComponentRegistry)
+	_ = registry.Register(&streamNode{})
+	ruleChain := `{"ruleChain":{"id":"http2Stream"},"metadata":{"nodes":[{"id":"s1","type":"test/stream","configuration":{"close":true}}]}}`
+	ruleEngine, err := engine.New("http2Stream", []byte(ruleChain), engine.WithConfig(engine.NewConfig(types.WithDefaultPool(), types.WithComponentsRegistry(registry))))
+	assert.Nil(t, err)
+	defer engine.Del(ruleEngine.Id())
+
+	start := func(configuration types.Configuration) *Endpoint {
+		var ep = &Endpoint{}
+		configuration["enableHTTP2"] = true
+		assert.Nil(t, ep.Init(types.NewConfig(), configuration))
+		router := impl.NewRouter().From("/api/protocol").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			exchange.Out.SetBody([]byte(exchange.In.GetMsg().Metadata.GetValue(ProtocolKey)))
+			return true
+		}).End()
+		_, err := ep.AddRouter(router, "GET")
+		assert.Nil(t, err)
+		router = impl.NewRouter().From("/api/stream").To("chain:http2Stream").Wait().End()
+		_, err = ep.AddRouter(router, "POST")
+		assert.Nil(t, err)
+		assert.Nil(t, ep.Start())
+		time.Sleep(time.Millisecond * 200)
+		return ep
+	}
+	do := func(client *http.Client, method, url string) (*http.Response, string) {
+		req, err := http.NewRequest(method, url, strings.NewReader("{}"))
+		assert.Nil(t, err)
+		resp, err := client.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return resp, string(body)
+	}
+	const streamBody = "event: token\ndata: hello\n\ndata: rule\ndata: go\n\ndata: [DONE]\n\n"
+
+	t.Run("h2c", func(t *testing.T) {
+		ep := start(types.Configuration{"server": ":9118"})
+		defer ep.Destroy()
+		client := &http.Client{Timeout: time.Second * 5, Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}}
+		resp, body := do(client, http.MethodGet, "http://127.0.0.1:9118/api/protocol")
+		assert.Equal(t, 2, resp.ProtoMajor)
+		assert.Equal(t, "HTTP/2.0", body)
+		//流式响应
+		resp, body = do(client, http.MethodPost, "http://127.0.0.1:9118/api/stream")
+		assert.Equal(t, 2, resp.ProtoMajor)
+		assert.Equal(t, ContentTypeEventStream, resp.Header.Get(ContentTypeKey))
+		assert.Equal(t, streamBody, body)
+		//仍然支持HTTP/1.1
+		resp, body = do(&http.Client{Timeout: time.Second * 5}, http.MethodGet, "http://127.0.0.1:9118/api/protocol")
+		assert.Equal(t, 1, resp.ProtoMajor)
+		assert.Equal(t, "HTTP/1.1", body)
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		ca := cert.New(t, "rulego-ca", nil, x509.ExtKeyUsageAny)
+		serverCert := cert.New(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+		dir := t.TempDir()
+		certFile := filepath.Join(dir, "server.pem")
+		keyFile := filepath.Join(dir, "server.key")
+		assert.Nil(t, os.WriteFile(certFile, serverCert.CertPem, 0600))
+		assert.Nil(t, os.WriteFile(keyFile, serverCert.KeyPem, 0600))
+		ep := start(types.Configuration{"server": ":9119", "certFile": certFile, "certKeyFile": keyFile})
+		defer ep.Destroy()
+		assert.Equal(t, []string{http2.NextProtoTLS, "http/1.1"}, ep.Server.TLSConfig.NextProtos)
+
+		rootCAs := x509.NewCertPool()
+		rootCAs.AddCert(ca.Cert)
+		client := &http.Client{Timeout: time.Second * 5, Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: rootCAs},
+			ForceAttemptHTTP2: true,
+		}}
+		resp, body := do(client, http.MethodGet, "https://127.0.0.1:9119/api/protocol")
+		assert.Equal(t, 2, resp.ProtoMajor)
+		assert.Equal(t, "HTTP/2.0", body)
+		resp, body = do(client, http.MethodPost, "https://127.0.0.1:9119/api/stream")
+		assert.Equal(t, 2, resp.ProtoMajor)
+		assert.Equal(t, streamBody, body)
+	})
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderKeyXForwardedFor = "X-Forwarded-For"
+	HeaderKeyXRealIP       = "X-Real-IP"
+	// KeyRemoteIp 客户端IP放到msg元数据的key，见 Rest.clientIP
+	KeyRemoteIp = "remoteIp"
+	// EventIPRejected 客户端IP被访问控制列表拒绝的事件，参数为客户端IP和 *http.Request
+	EventIPRejected = "ipRejected"
+)
+
+// ipFilter 客户端IP访问控制列表，先匹配拒绝列表，再匹配允许列表
+type ipFilter struct {
+	allowed []*net.IPNet
+	denied  []*net.IPNet
+}
+
+func newIPFilter(config Config) (*ipFilter, error) {
+	if len(config.AllowedIPs) == 0 && len(config.DeniedIPs) == 0 {
+		return nil, nil
+	}
+	allowed, err := parseCIDRs(config.AllowedIPs)
+	if err != nil {
+		return nil, fmt.Errorf("allowedIPs error: %w", err)
+	}
+	denied, err := parseCIDRs(config.DeniedIPs)
+	if err != nil {
+		return nil, fmt.Errorf("deniedIPs error: %w", err)
+	}
+	return &ipFilter{allowed: allowed, denied: denied}, nil
+}
+
+// parseCIDRs 解析CIDR列表，单个IP视为只包含该IP的网段
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip:%s", value)
+			}
+			bits := 8 * net.IPv6len
+			if v4 := ip.To4(); v4 != nil {
+				ip, bits = v4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// allow 客户端IP是否允许访问，无法解析的IP在配置了允许列表时拒绝
+func (f *ipFilter) allow(value string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return len(f.allowed) == 0 && len(f.denied) == 0
+	}
+	if containsIP(f.denied, ip) {
+		return false
+	}
+	return len(f.allowed) == 0 || containsIP(f.allowed, ip)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, item := range nets {
+		if item.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP 获取客户端IP，只有开启 TrustProxyHeaders 或者直接连接的对端是 TrustedProxies 中的代理时才读取代理请求头
+// X-Forwarded-For 从右往左取第一个不是可信代理的地址，客户端伪造的地址在其左边；
+// 只开启 TrustProxyHeaders 时所有对端都视为可信，使用最右边的地址，即离端点最近的代理追加的地址
+func (rest *Rest) clientIP(r *http.Request) string {
+	remoteIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		remoteIP = host
+	}
+	if !rest.trustProxy(remoteIP) {
+		return remoteIP
+	}
+	if ip := rest.forwardedFor(r.Header.Values(HeaderKeyXForwardedFor)); ip != "" {
+		return ip
+	}
+	if ip := strings.TrimSpace(r.Header.Get(HeaderKeyXRealIP)); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return remoteIP
+}
+
+// trustProxy 是否信任对端发送的代理请求头
+func (rest *Rest) trustProxy(remoteIP string) bool {
+	if len(rest.trustedProxies) == 0 {
+		return rest.Config.TrustProxyHeaders
+	}
+	ip := net.ParseIP(remoteIP)
+	return ip != nil && containsIP(rest.trustedProxies, ip)
+}
+
+// forwardedFor 从右往左跳过可信代理，返回第一个不可信的地址，所有地址都是可信代理时返回最左边的地址
+func (rest *Rest) forwardedFor(values []string) string {
+	var items []string
+	for _, value := range values {
+		items = append(items, strings.Split(value, ",")...)
+	}
+	var leftmost string
+	for i := len(items) - 1; i >= 0; i-- {
+		value := strings.TrimSpace(items[i])
+		ip := net.ParseIP(value)
+		if ip == nil {
+			//无法解析的地址之前的内容不可信
+			break
+		}
+		if !containsIP(rest.trustedProxies, ip) {
+			return value
+		}
+		leftmost = value
+	}
+	return leftmost
+}
+
+// rejectIP 客户端IP不允许访问时响应403，并触发 EventIPRejected 事件，返回true
+func (rest *Rest) rejectIP(w http.ResponseWriter, r *http.Request, ip string) bool {
+	if rest.ipFilter == nil || rest.ipFilter.allow(ip) {
+		return false
+	}
+	if rest.OnEvent != nil {
+		rest.OnEvent(EventIPRejected, ip, r)
+	}
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	return true
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestIPFilter(t *testing.T) {
+	var processed int
+	var rejected []string
+	newEndpoint := func(configuration types.Configuration) *Endpoint {
+		var ep = &Endpoint{}
+		configuration["server"] = ":9111"
+		err := ep.Init(types.NewConfig(), configuration)
+		assert.Nil(t, err)
+		ep.SetOnEvent(func(eventName string, params ...interface{}) {
+			if eventName == EventIPRejected {
+				rejected = append(rejected, params[0].(string))
+			}
+		})
+		router := impl.NewRouter().From("/api/ip").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			processed++
+			return true
+		}).End()
+		_, err = ep.AddRouter(router, "GET")
+		assert.Nil(t, err)
+		return ep
+	}
+	get := func(ep *Endpoint, remoteAddr string, headers map[string]string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/ip", nil)
+		r.RemoteAddr = remoteAddr
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		ep.Router().ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Run("AllowDeny", func(t *testing.T) {
+		processed, rejected = 0, nil
+		ep := newEndpoint(types.Configuration{
+			"allowedIPs": []string{"192.168.1.0/24", "fd00::/8", "10.0.0.1"},
+			"deniedIPs":  []string{"192.168.1.100"},
+		})
+		assert.Equal(t, http.StatusOK, get(ep, "192.168.1.10:5000", nil))
+		assert.Equal(t, http.StatusOK, get(ep, "10.0.0.1:5000", nil))
+		assert.Equal(t, http.StatusOK, get(ep, "[fd00::1]:5000", nil))
+		//拒绝列表优先
+		assert.Equal(t, http.StatusForbidden, get(ep, "192.168.1.100:5000", nil))
+		assert.Equal(t, http.StatusForbidden, get(ep, "10.0.0.2:5000", nil))
+		assert.Equal(t, http.StatusForbidden, get(ep, "[2001:db8::1]:5000", nil))
+		assert.Equal(t, 3, processed)
+		assert.Equal(t, []string{"192.168.1.100", "10.0.0.2", "2001:db8::1"}, rejected)
+	})
+
+	t.Run("DenyOnly", func(t *testing.T) {
+		processed, rejected = 0, nil
+		ep := newEndpoint(types.Configuration{"deniedIPs": []string{"2001:db8::/32"}})
+		assert.Equal(t, http.StatusForbidden, get(ep, "[2001:db8:1::1]:5000", nil))
+		assert.Equal(t, http.StatusOK, get(ep, "[2001:db9::1]:5000", nil))
+		assert.Equal(t, http.StatusOK, get(ep, "172.16.0.1:5000", nil))
+		assert.Equal(t, 2, processed)
+	})
+
+	//没有开启 TrustProxyHeaders 时忽略代理请求头，防止客户端伪造
+	t.Run("ProxyHeadersSpoofing", func(t *testing.T) {
+		processed, rejected = 0, nil
+		ep := newEndpoint(types.Configuration{"allowedIPs": []string{"192.168.1.0/24"}})
+		assert.Equal(t, http.StatusForbidden, get(ep, "8.8.8.8:5000", map[string]string{HeaderKeyXForwardedFor: "192.168.1.10"}))
+		assert.Equal(t, http.StatusForbidden, get(ep, "8.8.8.8:5000", map[string]string{HeaderKeyXRealIP: "192.168.1.10"}))
+		assert.Equal(t, 0, processed)
+		assert.Equal(t, []string{"8.8.8.8", "8.8.8.8"}, rejected)
+	})
+
+	t.Run("TrustProxyHeaders", func(t *testing.T) {
+		processed, rejected = 0, nil
+		ep := newEndpoint(types.Configuration{
+			"allowedIPs":        []string{"192.168.1.0/24"},
+			"trustProxyHeaders": true,
+		})
+		proxy := "127.0.0.1:5000"
+		assert.Equal(t, http.StatusOK, get(ep, proxy, map[string]string{HeaderKeyXForwardedFor: "192.168.1.10"}))
+		//客户端伪造的地址在代理追加的地址左边，使用最右边的地址
+		assert.Equal(t, http.StatusForbidden, get(ep, proxy, map[string]string{HeaderKeyXForwardedFor: "192.168.1.10, 8.8.8.8"}))
+		assert.Equal(t, http.StatusOK, get(ep, proxy, map[string]string{HeaderKeyXRealIP: "192.168.1.20"}))
+		//请求头无效时使用连接地址
+		assert.Equal(t, http.StatusForbidden, get(ep, proxy, map[string]string{HeaderKeyXForwardedFor: "unknown"}))
+		assert.Equal(t, 2, processed)
+		assert.Equal(t, []string{"8.8.8.8", "127.0.0.1"}, rejected)
+	})
+
+	t.Run("TrustedProxies", func(t *testing.T) {
+		processed, rejected = 0, nil
+		ep := newEndpoint(types.Configuration{
+			"allowedIPs":     []string{"192.168.1.0/24"},
+			"trustedProxies": []string{"10.0.0.0/8"},
+		})
+		proxy := "10.0.0.1:5000"
+		//跳过可信代理追加的地址
+		assert.Equal(t, http.StatusOK, get(ep, proxy, map[string]string{HeaderKeyXForwardedFor: "8.8.8.8, 192.168.1.10, 10.0.0.2"}))
+		assert.Equal(t, http.StatusForbidden, get(ep, proxy, map[string]string{HeaderKeyXForwardedFor: "192.168.1.10, 8.8.8.8, 10.0.0.2"}))
+		assert.Equal(t, http.StatusOK, get(ep, proxy, map[string]string{HeaderKeyXRealIP: "192.168.1.20"}))
+		//对端不是可信代理时忽略代理请求头
+		assert.Equal(t, http.StatusForbidden, get(ep, "8.8.4.4:5000", map[string]string{HeaderKeyXForwardedFor: "192.168.1.10"}))
+		assert.Equal(t, 2, processed)
+		assert.Equal(t, []string{"8.8.8.8", "8.8.4.4"}, rejected)
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		for _, configuration := range []types.Configuration{
+			{"server": ":9111", "allowedIPs": []string{"192.168.1.0/33"}},
+			{"server": ":9111", "deniedIPs": []string{"not-an-ip"}},
+			{"server": ":9111", "trustedProxies": []string{"10.0.0.0/40"}},
+		} {
+			var ep = &Endpoint{}
+			assert.NotNil(t, ep.Init(types.NewConfig(), configuration))
+		}
+	})
+}
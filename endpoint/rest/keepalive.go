@@ -0,0 +1,173 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// KeepAliveFormatSpace 保活时发送空格，适用于JSON、XML和文本响应，默认格式
+	KeepAliveFormatSpace = "space"
+	// KeepAliveFormatSSE 保活时发送SSE注释 ": keep-alive"，适用于 text/event-stream 响应
+	KeepAliveFormatSSE = "sse"
+	// ContentTypeEventStream SSE响应类型
+	ContentTypeEventStream = "text/event-stream"
+)
+
+var (
+	keepAliveSpace = []byte(" ")
+	keepAliveSSE   = []byte(": keep-alive\n\n")
+)
+
+// keepAlive 同步路由等待规则链处理结果期间，定时向客户端发送保活字节，防止负载均衡器空闲超时断开连接
+// 所有写操作都通过ResponseMessage的锁和最终响应互斥，保证字节不会交错
+type keepAlive struct {
+	format string
+	//是否已经发送过保活字节，发送后响应头和状态码已经提交
+	started bool
+	//是否已经停止
+	stopped bool
+	done    chan struct{}
+	//写保活字节失败（客户端断开）时，取消规则链上下文
+	cancel context.CancelFunc
+}
+
+// newKeepAlive 创建保活器
+func newKeepAlive(format string, cancel context.CancelFunc) *keepAlive {
+	if format != KeepAliveFormatSSE {
+		format = KeepAliveFormatSpace
+	}
+	return &keepAlive{
+		format: format,
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+}
+
+// stop 停止发送保活字节，调用方需要持有ResponseMessage的锁
+func (k *keepAlive) stop() {
+	if !k.stopped {
+		k.stopped = true
+		close(k.done)
+	}
+}
+
+// data 保活字节
+func (k *keepAlive) data() []byte {
+	if k.format == KeepAliveFormatSSE {
+		return keepAliveSSE
+	}
+	return keepAliveSpace
+}
+
+// defaultContentType 没有设置响应类型时使用的类型
+func (k *keepAlive) defaultContentType() string {
+	if k.format == KeepAliveFormatSSE {
+		return ContentTypeEventStream
+	}
+	return JsonContextType
+}
+
+// isStreamable 响应类型是否允许在前面插入保活字节
+func (k *keepAlive) isStreamable(contentType string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if k.format == KeepAliveFormatSSE {
+		return contentType == ContentTypeEventStream
+	}
+	return contentType == JsonContextType ||
+		strings.HasPrefix(contentType, "text/") ||
+		strings.HasSuffix(contentType, "+json") ||
+		strings.HasSuffix(contentType, "/xml") ||
+		strings.HasSuffix(contentType, "+xml")
+}
+
+// startKeepAlive 按照interval间隔发送保活字节，直到最终响应写入或者stopKeepAlive被调用
+func (r *ResponseMessage) startKeepAlive(interval time.Duration, format string, cancel context.CancelFunc) {
+	if interval <= 0 || r.response == nil {
+		return
+	}
+	k := newKeepAlive(format, cancel)
+	r.mu.Lock()
+	r.keepAlive = k
+	r.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-k.done:
+				return
+			case <-ticker.C:
+				if !r.writeKeepAlive(k) {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// stopKeepAlive 停止发送保活字节
+func (r *ResponseMessage) stopKeepAlive() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keepAlive != nil {
+		r.keepAlive.stop()
+	}
+}
+
+// writeKeepAlive 写一次保活字节，返回false表示不再需要继续发送
+func (r *ResponseMessage) writeKeepAlive(k *keepAlive) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if k.stopped {
+		return false
+	}
+	if !k.started {
+		header := r.response.Header()
+		if contentType := header.Get(ContentTypeKey); contentType == "" {
+			header.Set(ContentTypeKey, k.defaultContentType())
+		} else if !k.isStreamable(contentType) {
+			//响应类型不允许插入保活字节，例如二进制响应
+			k.stop()
+			return false
+		}
+		r.applyConnectionHeader()
+		r.response.WriteHeader(http.StatusOK)
+		k.started = true
+	}
+	if _, err := r.response.Write(k.data()); err != nil {
+		//客户端已经断开
+		k.stop()
+		if k.cancel != nil {
+			k.cancel()
+		}
+		return false
+	}
+	if flusher, ok := r.response.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return true
+}
+
+// keepAliveStarted 是否已经发送过保活字节，调用方需要持有锁
+func (r *ResponseMessage) keepAliveStarted() bool {
+	return r.keepAlive != nil && r.keepAlive.started
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// brokenWriter 模拟客户端断开的响应
+type brokenWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w *brokenWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func newTestResponseMessage(w http.ResponseWriter) *ResponseMessage {
+	return &ResponseMessage{
+		request:  httptest.NewRequest("GET", "/api/slow", nil),
+		response: w,
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	t.Run("Space", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := newTestResponseMessage(w)
+		r.startKeepAlive(time.Millisecond*20, "", nil)
+		time.Sleep(time.Millisecond * 70)
+		r.SetStatusCode(http.StatusInternalServerError)
+		r.SetBody([]byte(`{"ok":true}`))
+		time.Sleep(time.Millisecond * 50)
+		body := w.Body.String()
+		assert.True(t, strings.HasPrefix(body, "  "))
+		assert.True(t, strings.HasSuffix(body, `{"ok":true}`))
+		assert.Equal(t, `{"ok":true}`, strings.TrimSpace(body))
+		//保活后状态码已经提交
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, JsonContextType, w.Header().Get(ContentTypeKey))
+	})
+	t.Run("SSE", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := newTestResponseMessage(w)
+		r.startKeepAlive(time.Millisecond*20, KeepAliveFormatSSE, nil)
+		time.Sleep(time.Millisecond * 50)
+		r.SetBody([]byte("data: ok\n\n"))
+		body := w.Body.String()
+		assert.True(t, strings.HasPrefix(body, ": keep-alive\n\n"))
+		assert.True(t, strings.HasSuffix(body, "data: ok\n\n"))
+		assert.Equal(t, ContentTypeEventStream, w.Header().Get(ContentTypeKey))
+	})
+	t.Run("NotStreamable", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		w.Header().Set(ContentTypeKey, "image/png")
+		r := newTestResponseMessage(w)
+		r.startKeepAlive(time.Millisecond*20, KeepAliveFormatSpace, nil)
+		time.Sleep(time.Millisecond * 50)
+		r.SetStatusCode(http.StatusCreated)
+		r.SetBody([]byte("png"))
+		assert.Equal(t, "png", w.Body.String())
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+	t.Run("NoKeepAliveBeforeInterval", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := newTestResponseMessage(w)
+		r.startKeepAlive(time.Millisecond*100, KeepAliveFormatSpace, nil)
+		r.SetStatusCode(http.StatusBadRequest)
+		r.SetBody([]byte("bad"))
+		time.Sleep(time.Millisecond * 150)
+		assert.Equal(t, "bad", w.Body.String())
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("ClientDisconnect", func(t *testing.T) {
+		var canceled int32
+		r := newTestResponseMessage(&brokenWriter{httptest.NewRecorder()})
+		r.startKeepAlive(time.Millisecond*20, KeepAliveFormatSpace, func() {
+			atomic.AddInt32(&canceled, 1)
+		})
+		time.Sleep(time.Millisecond * 100)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&canceled))
+		r.stopKeepAlive()
+	})
+}
+
+func TestRestKeepAlive(t *testing.T) {
+	ruleChain := `{
+	  "ruleChain": {"id": "keepAliveTest"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "delay", "configuration": {"periodInSeconds": 2, "maxPendingMsgs": 10}}
+		]
+	  }
+	}`
+	ruleEngine, err := engine.New("keepAliveTest", []byte(ruleChain), engine.WithConfig(engine.NewConfig(types.WithDefaultPool())))
+	assert.Nil(t, err)
+	defer engine.Del(ruleEngine.Id())
+
+	var ep = &Endpoint{}
+	err = ep.Init(types.NewConfig(), types.Configuration{"server": ":9093", "keepAliveInterval": 1})
+	assert.Nil(t, err)
+	router := impl.NewRouter().From("/api/slow").To("chain:keepAliveTest").Wait().Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte(exchange.Out.GetMsg().GetData()))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	ep.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/slow", strings.NewReader(`{"a":1}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), " "))
+	assert.Equal(t, `{"a":1}`, strings.TrimSpace(w.Body.String()))
+}
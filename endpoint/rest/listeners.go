@@ -0,0 +1,138 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRedirectRequiresTLS 开启 Config.RedirectToHTTPS 但是 Config.Server 没有配置TLS
+var ErrRedirectRequiresTLS = errors.New("redirectToHTTPS requires TLS on server")
+
+// newHttpServer 创建 Config.HttpServer 的纯HTTP服务，超时配置和主服务相同，没有配置返回nil
+// 开启 Config.RedirectToHTTPS 时所有请求重定向到HTTPS服务，否则和主服务共享路由
+func (rest *Rest) newHttpServer(isTls bool) (*http.Server, error) {
+	if rest.Config.HttpServer == "" {
+		return nil, nil
+	}
+	var handler http.Handler = rest.router
+	if rest.Config.RedirectToHTTPS {
+		if !isTls {
+			return nil, ErrRedirectRequiresTLS
+		}
+		handler = http.HandlerFunc(rest.redirectToHTTPS)
+	}
+	server := &http.Server{
+		Addr:           rest.Config.HttpServer,
+		Handler:        handler,
+		MaxHeaderBytes: rest.Server.MaxHeaderBytes,
+		ReadTimeout:    rest.Server.ReadTimeout,
+		WriteTimeout:   rest.Server.WriteTimeout,
+		IdleTimeout:    rest.Server.IdleTimeout,
+		ConnContext:    withConnState,
+	}
+	if rest.Config.DisableKeepalive {
+		server.SetKeepAlivesEnabled(false)
+	}
+	return server, nil
+}
+
+// redirectToHTTPS 301重定向到HTTPS服务的相同路径，端口使用 Config.Server 的端口，443省略
+func (rest *Rest) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else {
+		host = strings.Trim(host, "[]")
+	}
+	if _, port, err := net.SplitHostPort(rest.Config.Server); err == nil && port != "" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		//IPv6地址
+		host = "[" + host + "]"
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// startupTimeout 等待服务开始接收连接的超时时间
+const startupTimeout = 3 * time.Second
+
+// ErrStartupTimeout 服务在 startupTimeout 内没有开始接收连接
+var ErrStartupTimeout = errors.New("rest server startup timeout")
+
+// serve 在协程中启动服务，返回的通道在服务开始接收连接时收到nil，启动失败时收到错误
+func (rest *Rest) serve(server *http.Server, ln net.Listener, isTls bool) <-chan error {
+	rl := &readyListener{Listener: ln, ready: make(chan error, 1)}
+	go func() {
+		defer ln.Close()
+		var err error
+		if isTls {
+			err = server.ServeTLS(rl, "", "")
+		} else {
+			err = server.Serve(rl)
+		}
+		//启动阶段的错误已经同步返回给调用方
+		if !rl.notify(err) {
+			rest.serveCompleted(err)
+		}
+	}()
+	return rl.ready
+}
+
+// waitReady 等待所有服务开始接收连接，返回第一个启动错误
+func waitReady(timeout time.Duration, ready ...<-chan error) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for _, ch := range ready {
+		select {
+		case err := <-ch:
+			if err != nil {
+				return err
+			}
+		case <-timer.C:
+			return ErrStartupTimeout
+		}
+	}
+	return nil
+}
+
+// readyListener 第一次调用 Accept 时表示服务已经开始接收连接
+type readyListener struct {
+	net.Listener
+	once  sync.Once
+	ready chan error
+}
+
+func (l *readyListener) Accept() (net.Conn, error) {
+	l.notify(nil)
+	return l.Listener.Accept()
+}
+
+// notify 只通知一次，返回是否本次通知
+func (l *readyListener) notify(err error) bool {
+	notified := false
+	l.once.Do(func() {
+		l.ready <- err
+		notified = true
+	})
+	return notified
+}
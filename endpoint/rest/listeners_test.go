@@ -0,0 +1,122 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/test/cert"
+)
+
+func TestHttpServer(t *testing.T) {
+	ca := cert.New(t, "rulego-ca", nil, x509.ExtKeyUsageAny)
+	serverCert := cert.New(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server.key")
+	assert.Nil(t, os.WriteFile(certFile, serverCert.CertPem, 0600))
+	assert.Nil(t, os.WriteFile(keyFile, serverCert.KeyPem, 0600))
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.Cert)
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}},
+		Timeout:   time.Second * 5,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	get := func(url string) (int, string, string) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return 0, "", ""
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), resp.Header.Get("Location")
+	}
+	start := func(configuration types.Configuration) *Endpoint {
+		var ep = &Endpoint{}
+		configuration["certFile"] = certFile
+		configuration["certKeyFile"] = keyFile
+		assert.Nil(t, ep.Init(types.NewConfig(), configuration))
+		router := impl.NewRouter().From("/api/scheme").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			if exchange.In.(*RequestMessage).Request().TLS != nil {
+				exchange.Out.SetBody([]byte("https"))
+			} else {
+				exchange.Out.SetBody([]byte("http"))
+			}
+			return true
+		}).End()
+		_, err := ep.AddRouter(router, "GET")
+		assert.Nil(t, err)
+		assert.Nil(t, ep.Start())
+		time.Sleep(time.Millisecond * 200)
+		return ep
+	}
+
+	//同时提供HTTP和HTTPS服务，共享路由
+	ep := start(types.Configuration{"server": ":9157", "httpServer": ":9158"})
+	assert.True(t, ep.Started())
+	code, body, _ := get("https://127.0.0.1:9157/api/scheme")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "https", body)
+	code, body, _ = get("http://127.0.0.1:9158/api/scheme")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "http", body)
+
+	//重启后两个服务都可用
+	assert.Nil(t, ep.Restart())
+	time.Sleep(time.Millisecond * 200)
+	assert.True(t, ep.Started())
+	_, body, _ = get("http://127.0.0.1:9158/api/scheme")
+	assert.Equal(t, "http", body)
+
+	//关闭所有服务
+	assert.Nil(t, ep.Close())
+	assert.False(t, ep.Started())
+	code, _, _ = get("http://127.0.0.1:9158/api/scheme")
+	assert.Equal(t, 0, code)
+	code, _, _ = get("https://127.0.0.1:9157/api/scheme")
+	assert.Equal(t, 0, code)
+
+	//重定向到HTTPS
+	ep = start(types.Configuration{"server": ":9157", "httpServer": ":9158", "redirectToHTTPS": true})
+	defer ep.Destroy()
+	code, _, location := get("http://127.0.0.1:9158/api/scheme?id=1")
+	assert.Equal(t, http.StatusMovedPermanently, code)
+	assert.Equal(t, "https://127.0.0.1:9157/api/scheme?id=1", location)
+	_, body, _ = get(location)
+	assert.Equal(t, "https", body)
+
+	//重定向需要TLS
+	var plain = &Endpoint{}
+	assert.Nil(t, plain.Init(types.NewConfig(), types.Configuration{"server": ":9159", "httpServer": ":9160", "redirectToHTTPS": true}))
+	assert.Equal(t, ErrRedirectRequiresTLS, plain.Start())
+	assert.False(t, plain.Started())
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"strconv"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+const (
+	// DefaultResponseHeaderNamespace 设置为响应头的输出消息元数据的默认命名空间，例如：httpHeader.X-Request-Id
+	DefaultResponseHeaderNamespace = "httpHeader"
+	// KeyResponseStatus 设置响应状态码的输出消息元数据key，例如：201
+	KeyResponseStatus = "httpStatus"
+)
+
+// responseHeaderNamespace 同步路由从输出消息元数据设置响应头的命名空间，没有开启返回空
+func (rest *Rest) responseHeaderNamespace(isWait bool) string {
+	if !isWait || !rest.Config.ResponseFromMetadata {
+		return ""
+	}
+	if rest.Config.ResponseHeaderNamespace == "" {
+		return DefaultResponseHeaderNamespace
+	}
+	return rest.Config.ResponseHeaderNamespace
+}
+
+// applyMetadataResponse 使用输出消息的元数据设置响应头和状态码，已经写入响应头后忽略，调用方需要持有锁
+func (r *ResponseMessage) applyMetadataResponse(msg *types.RuleMsg) {
+	if r.headerNamespace == "" || msg == nil || msg.Metadata == nil || r.response == nil || r.headerCommitted() {
+		return
+	}
+	header := r.response.Header()
+	for key, value := range msg.Metadata.ValuesWithPrefix(r.headerNamespace) {
+		if key != "" {
+			header.Set(key, value)
+		}
+	}
+	if value := msg.Metadata.GetValue(KeyResponseStatus); value != "" {
+		if code, err := strconv.Atoi(value); err == nil && code >= 100 && code <= 999 {
+			r.pendingStatus = code
+		}
+	}
+}
+
+// commitPendingStatus 提交输出消息元数据设置的状态码，调用方需要持有锁
+func (r *ResponseMessage) commitPendingStatus() {
+	if r.pendingStatus == 0 {
+		return
+	}
+	code := r.pendingStatus
+	r.pendingStatus = 0
+	r.setStatusCode(code)
+}
+
+// flushPendingStatus 规则链没有写入响应体时提交状态码，例如：204
+func (r *ResponseMessage) flushPendingStatus() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.errorResponse != nil && r.err != nil {
+		return
+	}
+	r.commitPendingStatus()
+}
+
+// headerCommitted 是否已经写入响应头，调用方需要持有锁
+func (r *ResponseMessage) headerCommitted() bool {
+	return r.written || r.keepAliveStarted() ||
+		(r.compressor != nil && r.compressor.committed) ||
+		(r.stream != nil && r.stream.started)
+}
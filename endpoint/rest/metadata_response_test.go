@@ -0,0 +1,101 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/builtin/processor"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestResponseFromMetadata(t *testing.T) {
+	responseToBody, _ := processor.OutBuiltins.Get("responseToBody")
+	for _, item := range []struct {
+		id     string
+		script string
+	}{
+		{"metadataCreated", "metadata['httpHeader.Location']='/api/devices/'+msg.id; metadata['httpHeader.X-Request-Id']='r01'; metadata['httpStatus']='201'; return {'msg':msg,'metadata':metadata,'msgType':msgType};"},
+		{"metadataNoContent", "metadata['httpStatus']='204'; return {'msg':msg,'metadata':metadata,'msgType':msgType};"},
+	} {
+		ruleChain := `{"ruleChain":{"id":"` + item.id + `"},"metadata":{"nodes":[{"id":"s1","type":"jsTransform","configuration":{"jsScript":"` + item.script + `"}}]}}`
+		ruleEngine, err := engine.New(item.id, []byte(ruleChain), engine.WithConfig(engine.NewConfig(types.WithDefaultPool())))
+		assert.Nil(t, err)
+		defer engine.Del(ruleEngine.Id())
+	}
+
+	newEndpoint := func(configuration types.Configuration) *Endpoint {
+		var ep = &Endpoint{}
+		assert.Nil(t, ep.Init(types.NewConfig(), configuration))
+		router := impl.NewRouter().From("/api/devices").To("chain:metadataCreated").Wait().Process(responseToBody).End()
+		_, err := ep.AddRouter(router, "POST")
+		assert.Nil(t, err)
+		router = impl.NewRouter().From("/api/devices/:id").To("chain:metadataNoContent").Wait().End()
+		_, err = ep.AddRouter(router, "DELETE")
+		assert.Nil(t, err)
+		//写入响应体之后的元数据不再设置响应头
+		router = impl.NewRouter().From("/api/late").To("chain:metadataCreated").Wait().Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			exchange.Out.SetBody([]byte("late"))
+			msg := exchange.Out.GetMsg().Copy()
+			msg.Metadata.PutValue("httpHeader.X-Late", "true")
+			exchange.Out.SetMsg(&msg)
+			return true
+		}).End()
+		_, err = ep.AddRouter(router, "POST")
+		assert.Nil(t, err)
+		return ep
+	}
+	serve := func(ep *Endpoint, method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(`{"id":"d01"}`))
+		r.Header.Set(ContentTypeKey, JsonContextType)
+		ep.Router().ServeHTTP(w, r)
+		return w
+	}
+
+	ep := newEndpoint(types.Configuration{"server": ":9120", "responseFromMetadata": true})
+	w := serve(ep, http.MethodPost, "/api/devices")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/api/devices/d01", w.Header().Get("Location"))
+	assert.Equal(t, "r01", w.Header().Get("X-Request-Id"))
+	assert.Equal(t, `{"id":"d01"}`, w.Body.String())
+	//没有写入响应体时也提交状态码
+	w = serve(ep, http.MethodDelete, "/api/devices/d01")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = serve(ep, http.MethodPost, "/api/late")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "", w.Header().Get("X-Late"))
+
+	//默认不开启
+	ep = newEndpoint(types.Configuration{"server": ":9121"})
+	w = serve(ep, http.MethodPost, "/api/devices")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Header().Get("Location"))
+
+	//自定义命名空间
+	ep = newEndpoint(types.Configuration{"server": ":9122", "responseFromMetadata": true, "responseHeaderNamespace": "resp"})
+	w = serve(ep, http.MethodPost, "/api/devices")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "", w.Header().Get("Location"))
+}
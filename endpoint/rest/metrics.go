@@ -0,0 +1,226 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+// DefaultMetricsPath 建议的Prometheus指标路由路径，见 Config.MetricsPath
+const DefaultMetricsPath = "/metrics"
+
+// ContentTypePrometheus Prometheus文本格式的内容类型
+const ContentTypePrometheus = "text/plain; version=0.0.4; charset=utf-8"
+
+// latencyBuckets 请求延迟直方图的桶上限（秒），与Prometheus客户端默认值相同
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics 端点指标的快照，共享服务时为所有端点定义的汇总
+type Metrics struct {
+	// InFlight 正在处理的请求数
+	InFlight int64
+	// LatencyBounds 延迟直方图的桶上限（秒）
+	LatencyBounds []float64
+	// Routes 每个路由的指标，按路由id排序
+	Routes []RouteMetrics
+}
+
+// RouteMetrics 路由指标的快照
+type RouteMetrics struct {
+	// RouterId 路由id
+	RouterId string
+	// Requests 按状态码分类统计的请求数，key：1xx、2xx、3xx、4xx、5xx
+	Requests map[string]int64
+	// Errors 规则链处理出错、处理过程发生异常或者响应5xx的请求数
+	Errors int64
+	// LatencyBuckets 延迟小于等于 Metrics.LatencyBounds 对应上限的累计请求数
+	LatencyBuckets []int64
+	// LatencyCount 请求总数
+	LatencyCount int64
+	// LatencySum 总耗时
+	LatencySum time.Duration
+}
+
+// metricsCollector 端点的指标，创建在服务实例，重启后保留
+type metricsCollector struct {
+	inFlight int64
+	mu       sync.Mutex
+	routes   map[string]*routeMetrics
+}
+
+type routeMetrics struct {
+	requests map[string]int64
+	errors   int64
+	buckets  []int64
+	count    int64
+	sum      time.Duration
+}
+
+func newMetricsCollector() *metricsCollector {
+	return &metricsCollector{routes: make(map[string]*routeMetrics)}
+}
+
+// metricsEnabled 是否统计指标
+func (rest *Rest) metricsEnabled() bool {
+	return rest.Config.Metrics || rest.Config.MetricsPath != ""
+}
+
+// Metrics 获取端点指标的快照，没有开启 Config.Metrics 返回空的快照
+func (rest *Rest) Metrics() Metrics {
+	server, err := rest.serverInstance()
+	if err != nil || server.metrics == nil {
+		return Metrics{}
+	}
+	return server.metrics.snapshot()
+}
+
+func (m *metricsCollector) begin() {
+	atomic.AddInt64(&m.inFlight, 1)
+}
+
+// end 记录一次请求，chainErr 为规则链处理是否出错
+func (m *metricsCollector) end(routerId string, statusCode int, latency time.Duration, chainErr bool) {
+	atomic.AddInt64(&m.inFlight, -1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.routes[routerId]
+	if !ok {
+		route = &routeMetrics{requests: make(map[string]int64), buckets: make([]int64, len(latencyBuckets))}
+		m.routes[routerId] = route
+	}
+	route.requests[statusClass(statusCode)]++
+	if chainErr || statusCode >= http.StatusInternalServerError {
+		route.errors++
+	}
+	seconds := latency.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			route.buckets[i]++
+		}
+	}
+	route.count++
+	route.sum += latency
+}
+
+func (m *metricsCollector) snapshot() Metrics {
+	metrics := Metrics{InFlight: atomic.LoadInt64(&m.inFlight), LatencyBounds: append([]float64(nil), latencyBuckets...)}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, route := range m.routes {
+		requests := make(map[string]int64, len(route.requests))
+		for class, count := range route.requests {
+			requests[class] = count
+		}
+		metrics.Routes = append(metrics.Routes, RouteMetrics{
+			RouterId:       id,
+			Requests:       requests,
+			Errors:         route.errors,
+			LatencyBuckets: append([]int64(nil), route.buckets...),
+			LatencyCount:   route.count,
+			LatencySum:     route.sum,
+		})
+	}
+	sort.Slice(metrics.Routes, func(i, j int) bool {
+		return metrics.Routes[i].RouterId < metrics.Routes[j].RouterId
+	})
+	return metrics
+}
+
+// observeMetrics 请求处理完成后记录指标，处理过程发生异常记为错误
+func (rest *Rest) observeMetrics(router endpoint.Router, w *accessLogWriter, exchange *endpoint.Exchange, panicked bool) {
+	chainErr := panicked
+	if !chainErr && exchange != nil {
+		chainErr = exchange.Out.GetError() != nil
+	}
+	rest.metrics.end(router.GetId(), w.statusCode(), time.Since(w.start), chainErr)
+}
+
+// statusClass 状态码分类，例如：2xx
+func statusClass(statusCode int) string {
+	if statusCode < 100 || statusCode > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(statusCode/100) + "xx"
+}
+
+// metricsHandler 以Prometheus文本格式输出指标，直接注册到httprouter，不经过规则链、拦截器和认证
+func (rest *Rest) metricsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set(ContentTypeKey, ContentTypePrometheus)
+	_, _ = w.Write(rest.metrics.snapshot().Prometheus())
+}
+
+// Prometheus 转换成Prometheus文本格式
+func (m Metrics) Prometheus() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# HELP rulego_http_requests_in_flight Number of http requests being processed.\n")
+	buf.WriteString("# TYPE rulego_http_requests_in_flight gauge\n")
+	fmt.Fprintf(&buf, "rulego_http_requests_in_flight %d\n", m.InFlight)
+
+	buf.WriteString("# HELP rulego_http_requests_total Total number of http requests by router and status class.\n")
+	buf.WriteString("# TYPE rulego_http_requests_total counter\n")
+	for _, route := range m.Routes {
+		classes := make([]string, 0, len(route.Requests))
+		for class := range route.Requests {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			fmt.Fprintf(&buf, "rulego_http_requests_total{router=\"%s\",code=\"%s\"} %d\n", escapeLabel(route.RouterId), class, route.Requests[class])
+		}
+	}
+
+	buf.WriteString("# HELP rulego_http_request_errors_total Total number of http requests failed in rule chain or responded 5xx.\n")
+	buf.WriteString("# TYPE rulego_http_request_errors_total counter\n")
+	for _, route := range m.Routes {
+		fmt.Fprintf(&buf, "rulego_http_request_errors_total{router=\"%s\"} %d\n", escapeLabel(route.RouterId), route.Errors)
+	}
+
+	buf.WriteString("# HELP rulego_http_request_duration_seconds Latency of http requests.\n")
+	buf.WriteString("# TYPE rulego_http_request_duration_seconds histogram\n")
+	for _, route := range m.Routes {
+		label := escapeLabel(route.RouterId)
+		for i, bound := range m.LatencyBounds {
+			if i < len(route.LatencyBuckets) {
+				fmt.Fprintf(&buf, "rulego_http_request_duration_seconds_bucket{router=\"%s\",le=\"%s\"} %d\n", label,
+					strconv.FormatFloat(bound, 'f', -1, 64), route.LatencyBuckets[i])
+			}
+		}
+		fmt.Fprintf(&buf, "rulego_http_request_duration_seconds_bucket{router=\"%s\",le=\"+Inf\"} %d\n", label, route.LatencyCount)
+		fmt.Fprintf(&buf, "rulego_http_request_duration_seconds_sum{router=\"%s\"} %s\n", label,
+			strconv.FormatFloat(route.LatencySum.Seconds(), 'f', -1, 64))
+		fmt.Fprintf(&buf, "rulego_http_request_duration_seconds_count{router=\"%s\"} %d\n", label, route.LatencyCount)
+	}
+	return buf.Bytes()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel 转义Prometheus标签值
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9125", "metricsPath": DefaultMetricsPath})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+	router := impl.NewRouter().SetId("ok").From("/api/ok").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte("ok"))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	router = impl.NewRouter().SetId("error").From("/api/error").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetError(errors.New("chain error"))
+		exchange.Out.SetStatusCode(http.StatusBadRequest)
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+
+	router = impl.NewRouter().SetId("panic").From("/api/panic").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		panic("test panic")
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	serve("/api/ok")
+	serve("/api/ok")
+	serve("/api/error")
+	serve("/api/panic")
+
+	metrics := ep.Metrics()
+	assert.Equal(t, int64(0), metrics.InFlight)
+	assert.Equal(t, 3, len(metrics.Routes))
+	errorRoute, okRoute, panicRoute := metrics.Routes[0], metrics.Routes[1], metrics.Routes[2]
+	assert.Equal(t, "ok", okRoute.RouterId)
+	assert.Equal(t, map[string]int64{"2xx": 2}, okRoute.Requests)
+	assert.Equal(t, int64(0), okRoute.Errors)
+	assert.Equal(t, int64(2), okRoute.LatencyCount)
+	assert.Equal(t, int64(2), okRoute.LatencyBuckets[len(okRoute.LatencyBuckets)-1])
+	assert.Equal(t, map[string]int64{"4xx": 1}, errorRoute.Requests)
+	assert.Equal(t, int64(1), errorRoute.Errors)
+	//没有配置错误响应时，异常的请求仍然响应200
+	assert.Equal(t, map[string]int64{"2xx": 1}, panicRoute.Requests)
+	assert.Equal(t, int64(1), panicRoute.Errors)
+
+	//Prometheus文本格式
+	w := serve(DefaultMetricsPath)
+	assert.Equal(t, ContentTypePrometheus, w.Header().Get(ContentTypeKey))
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE rulego_http_requests_total counter",
+		`rulego_http_requests_total{router="ok",code="2xx"} 2`,
+		`rulego_http_request_errors_total{router="error"} 1`,
+		`rulego_http_request_duration_seconds_bucket{router="ok",le="+Inf"} 2`,
+		`rulego_http_request_duration_seconds_count{router="panic"} 1`,
+		"rulego_http_requests_in_flight 0",
+	} {
+		assert.True(t, strings.Contains(body, line+"\n"))
+	}
+
+	//重启后保留
+	assert.Nil(t, ep.Start())
+	time.Sleep(time.Millisecond * 200)
+	assert.Nil(t, ep.Restart())
+	time.Sleep(time.Millisecond * 200)
+	serve("/api/ok")
+	metrics = ep.Metrics()
+	assert.Equal(t, map[string]int64{"2xx": 3}, metrics.Routes[1].Requests)
+	assert.True(t, strings.Contains(serve(DefaultMetricsPath).Body.String(), `rulego_http_requests_total{router="ok",code="2xx"} 3`))
+
+	//没有开启指标
+	var disabled = &Endpoint{}
+	err = disabled.Init(types.NewConfig(), types.Configuration{"server": ":9126"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(disabled.Metrics().Routes))
+	assert.Equal(t, "line1\\nline\\\"2\\\\", escapeLabel("line1\nline\"2\\"))
+}
@@ -0,0 +1,306 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+)
+
+const (
+	// HeaderKeyAccept 客户端可以接受的响应内容类型请求头
+	HeaderKeyAccept = "Accept"
+	// KeyResponseContentType 路由from配置的响应内容类型，不根据Accept请求头协商，例如：application/xml
+	KeyResponseContentType = "responseContentType"
+	// XmlContentType XML响应的内容类型
+	XmlContentType = "application/xml"
+	// TextContentType 文本响应的内容类型
+	TextContentType = "text/plain"
+	// xmlRootElement JSON转换成XML的根元素
+	xmlRootElement = "response"
+	// xmlItemElement JSON数组转换成XML的元素，数组不是对象的字段时使用
+	xmlItemElement = "item"
+)
+
+// ResponseMarshaler 把JSON消息负荷转换成指定内容类型的响应体，见 Rest.RegisterResponseMarshaler
+type ResponseMarshaler func(data []byte) ([]byte, error)
+
+// marshalerRegistry 响应内容类型的转换器，创建在服务实例
+type marshalerRegistry struct {
+	mu    sync.RWMutex
+	items map[string]ResponseMarshaler
+}
+
+func newMarshalerRegistry() *marshalerRegistry {
+	return &marshalerRegistry{items: map[string]ResponseMarshaler{
+		JsonContextType: func(data []byte) ([]byte, error) {
+			return data, nil
+		},
+		XmlContentType: JsonToXml,
+		TextContentType: func(data []byte) ([]byte, error) {
+			//JSON字符串去掉引号，其他类型使用JSON文本
+			var s string
+			if err := json.Unmarshal(data, &s); err == nil {
+				return []byte(s), nil
+			}
+			return data, nil
+		},
+	}}
+}
+
+// RegisterResponseMarshaler 注册响应内容类型的转换器，用于内容协商，marshaler为空删除该内容类型
+// 默认支持：application/json、application/xml、text/plain，共享服务时注册到服务实例
+func (rest *Rest) RegisterResponseMarshaler(contentType string, marshaler ResponseMarshaler) {
+	server, err := rest.serverInstance()
+	if err != nil {
+		rest.Printf("register response marshaler err :%v", err)
+		return
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	registry := server.marshalers
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if marshaler == nil {
+		delete(registry.items, contentType)
+	} else {
+		registry.items[contentType] = marshaler
+	}
+}
+
+// negotiation 同步路由响应的内容协商
+type negotiation struct {
+	//Accept请求头
+	accept string
+	//路由配置的响应内容类型，不为空时不根据Accept协商
+	contentType string
+	//没有可以接受的内容类型时响应406，否则使用JSON
+	strict     bool
+	marshalers *marshalerRegistry
+}
+
+// newNegotiation 创建同步路由的内容协商，没有开启 Config.ContentNegotiation 并且路由没有配置响应内容类型返回nil
+func (rest *Rest) newNegotiation(router endpoint.Router, r *http.Request) *negotiation {
+	contentType := ""
+	if from, ok := router.GetFrom().(*impl.From); ok && from != nil {
+		if v, ok := from.Config[KeyResponseContentType].(string); ok {
+			contentType = strings.ToLower(strings.TrimSpace(v))
+		}
+	}
+	if !rest.Config.ContentNegotiation && contentType == "" {
+		return nil
+	}
+	return &negotiation{
+		accept:      r.Header.Get(HeaderKeyAccept),
+		contentType: contentType,
+		strict:      rest.Config.StrictAccept,
+		marshalers:  rest.marshalers,
+	}
+}
+
+// choose 选择响应的内容类型和转换器，没有可以接受的内容类型并且 strict 返回nil转换器
+func (n *negotiation) choose() (string, ResponseMarshaler) {
+	n.marshalers.mu.RLock()
+	defer n.marshalers.mu.RUnlock()
+	if n.contentType != "" {
+		return n.contentType, n.marshalers.items[n.contentType]
+	}
+	if n.accept == "" {
+		return JsonContextType, n.marshalers.items[JsonContextType]
+	}
+	for _, mediaType := range parseAccept(n.accept) {
+		if marshaler, ok := n.marshalers.items[mediaType]; ok {
+			return mediaType, marshaler
+		}
+		if !strings.HasSuffix(mediaType, "/*") {
+			continue
+		}
+		//通配符优先使用JSON，其次按内容类型排序
+		prefix := strings.TrimSuffix(mediaType, "*")
+		if mediaType == "*/*" || strings.HasPrefix(JsonContextType, prefix) {
+			return JsonContextType, n.marshalers.items[JsonContextType]
+		}
+		var matched []string
+		for contentType := range n.marshalers.items {
+			if strings.HasPrefix(contentType, prefix) {
+				matched = append(matched, contentType)
+			}
+		}
+		if len(matched) > 0 {
+			sort.Strings(matched)
+			return matched[0], n.marshalers.items[matched[0]]
+		}
+	}
+	if n.strict {
+		return "", nil
+	}
+	return JsonContextType, n.marshalers.items[JsonContextType]
+}
+
+// parseAccept 解析Accept请求头，按q值从大到小排序，忽略q=0的内容类型
+func parseAccept(accept string) []string {
+	type acceptItem struct {
+		mediaType string
+		q         float64
+	}
+	var items []acceptItem
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			items = append(items, acceptItem{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].q > items[j].q
+	})
+	mediaTypes := make([]string, len(items))
+	for i, item := range items {
+		mediaTypes[i] = item.mediaType
+	}
+	return mediaTypes
+}
+
+// negotiate 根据协商的内容类型转换响应体并设置Content-Type，调用方需要持有锁
+// 只转换JSON消息负荷，处理器设置了非JSON的内容类型或者已经写入响应头时不处理，返回false表示没有可以接受的内容类型
+func (r *ResponseMessage) negotiate(body []byte) ([]byte, bool) {
+	n := r.negotiation
+	if n == nil || r.response == nil || r.headerCommitted() {
+		return body, true
+	}
+	header := r.response.Header()
+	if contentType := header.Get(ContentTypeKey); contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != JsonContextType {
+			return body, true
+		}
+	}
+	if n.contentType == "" && (r.msg == nil || r.msg.DataType != types.JSON) {
+		return body, true
+	}
+	contentType, marshaler := n.choose()
+	if marshaler == nil {
+		if contentType == "" {
+			return nil, false
+		}
+		//路由配置的内容类型没有注册转换器，不转换
+		header.Set(ContentTypeKey, contentType)
+		return body, true
+	}
+	converted, err := marshaler(body)
+	if err != nil {
+		//不是JSON的响应体不转换
+		return body, true
+	}
+	header.Set(ContentTypeKey, contentType)
+	return converted, true
+}
+
+// JsonToXml 把JSON转换成XML，根元素为response，对象的字段转换成子元素，数组转换成多个同名元素
+func JsonToXml(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	writeXmlElement(&buf, xmlRootElement, v, false)
+	return buf.Bytes(), nil
+}
+
+// writeXmlElement 写入XML元素，flatten 为对象字段的数组是否转换成多个同名元素，否则数组元素转换成item子元素
+func writeXmlElement(buf *bytes.Buffer, name string, v interface{}, flatten bool) {
+	if items, ok := v.([]interface{}); ok && flatten {
+		for _, item := range items {
+			writeXmlElement(buf, name, item, false)
+		}
+		return
+	}
+	buf.WriteString("<" + name + ">")
+	switch value := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			writeXmlElement(buf, xmlName(key), value[key], true)
+		}
+	case []interface{}:
+		for _, item := range value {
+			writeXmlElement(buf, xmlItemElement, item, false)
+		}
+	case nil:
+	case string:
+		_ = xml.EscapeText(buf, []byte(value))
+	default:
+		_ = xml.EscapeText(buf, []byte(toXmlText(value)))
+	}
+	buf.WriteString("</" + name + ">")
+}
+
+func toXmlText(v interface{}) string {
+	switch value := v.(type) {
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		b, _ := json.Marshal(value)
+		return string(b)
+	}
+}
+
+// xmlName 把字段名转换成合法的XML元素名，不合法的字符替换成_
+func xmlName(key string) string {
+	if key == "" {
+		return "_"
+	}
+	var b strings.Builder
+	for i, c := range key {
+		valid := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c > 0x7f
+		if i > 0 {
+			valid = valid || c == '-' || c == '.' || c >= '0' && c <= '9'
+		}
+		if valid {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
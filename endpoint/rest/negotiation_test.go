@@ -0,0 +1,116 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/builtin/processor"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestJsonToXml(t *testing.T) {
+	xml, err := JsonToXml([]byte(`{"name":"a<b>","temperature":21.50,"tags":["x","y"],"1st key":true,"empty":null,"items":[[1,2]]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<response><_st_key>true</_st_key><empty></empty><items><item>1</item><item>2</item></items>`+
+		`<name>a&lt;b&gt;</name><tags>x</tags><tags>y</tags><temperature>21.50</temperature></response>`, string(xml))
+	xml, err = JsonToXml([]byte(`[{"id":1},{"id":2}]`))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(string(xml), `<response><item><id>1</id></item><item><id>2</id></item></response>`))
+	_, err = JsonToXml([]byte(`not json`))
+	assert.NotNil(t, err)
+}
+
+func TestContentNegotiation(t *testing.T) {
+	ruleChain := `{"ruleChain":{"id":"negotiation"},"metadata":{"nodes":[{"id":"s1","type":"jsTransform","configuration":{"jsScript":"return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}]}}`
+	ruleEngine, err := engine.New("negotiation", []byte(ruleChain), engine.WithConfig(engine.NewConfig(types.WithDefaultPool())))
+	assert.Nil(t, err)
+	defer engine.Del(ruleEngine.Id())
+	responseToBody, _ := processor.OutBuiltins.Get("responseToBody")
+
+	newEndpoint := func(configuration types.Configuration) *Endpoint {
+		var ep = &Endpoint{}
+		assert.Nil(t, ep.Init(types.NewConfig(), configuration))
+		router := impl.NewRouter().From("/api/devices").To("chain:negotiation").Wait().Process(responseToBody).End()
+		_, err := ep.AddRouter(router, "POST")
+		assert.Nil(t, err)
+		//路由指定响应内容类型
+		router = impl.NewRouter().From("/api/xml", types.Configuration{KeyResponseContentType: XmlContentType}).To("chain:negotiation").Wait().Process(responseToBody).End()
+		_, err = ep.AddRouter(router, "POST")
+		assert.Nil(t, err)
+		return ep
+	}
+	serve := func(ep *Endpoint, path, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"id":"d01"}`))
+		r.Header.Set(ContentTypeKey, JsonContextType)
+		if accept != "" {
+			r.Header.Set(HeaderKeyAccept, accept)
+		}
+		ep.Router().ServeHTTP(w, r)
+		return w
+	}
+	const xmlBody = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<response><id>d01</id></response>`
+
+	ep := newEndpoint(types.Configuration{"server": ":9135", "contentNegotiation": true})
+	w := serve(ep, "/api/devices", "")
+	assert.Equal(t, JsonContextType, w.Header().Get(ContentTypeKey))
+	assert.Equal(t, `{"id":"d01"}`, w.Body.String())
+	w = serve(ep, "/api/devices", "application/xml")
+	assert.Equal(t, XmlContentType, w.Header().Get(ContentTypeKey))
+	assert.Equal(t, xmlBody, w.Body.String())
+	//按q值选择，通配符
+	w = serve(ep, "/api/devices", "text/html, application/xml;q=0.4, text/*;q=0.5")
+	assert.Equal(t, TextContentType, w.Header().Get(ContentTypeKey))
+	assert.Equal(t, `{"id":"d01"}`, w.Body.String())
+	assert.Equal(t, JsonContextType, serve(ep, "/api/devices", "*/*").Header().Get(ContentTypeKey))
+	//不支持的内容类型使用JSON
+	w = serve(ep, "/api/devices", "image/png")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, JsonContextType, w.Header().Get(ContentTypeKey))
+	//路由指定的内容类型
+	w = serve(ep, "/api/xml", JsonContextType)
+	assert.Equal(t, XmlContentType, w.Header().Get(ContentTypeKey))
+	assert.Equal(t, xmlBody, w.Body.String())
+
+	//注册转换器
+	ep.RegisterResponseMarshaler("application/x-custom", func(data []byte) ([]byte, error) {
+		return []byte("custom:" + string(data)), nil
+	})
+	assert.Equal(t, `custom:{"id":"d01"}`, serve(ep, "/api/devices", "application/x-custom").Body.String())
+	ep.RegisterResponseMarshaler("application/x-custom", nil)
+	assert.Equal(t, JsonContextType, serve(ep, "/api/devices", "application/x-custom").Header().Get(ContentTypeKey))
+
+	//没有可以接受的内容类型响应406
+	ep = newEndpoint(types.Configuration{"server": ":9136", "contentNegotiation": true, "strictAccept": true})
+	assert.Equal(t, http.StatusNotAcceptable, serve(ep, "/api/devices", "image/png").Code)
+	assert.Equal(t, http.StatusOK, serve(ep, "/api/devices", "image/png, */*;q=0.1").Code)
+
+	//默认不协商
+	ep = newEndpoint(types.Configuration{"server": ":9137"})
+	w = serve(ep, "/api/devices", "application/xml")
+	assert.Equal(t, JsonContextType, w.Header().Get(ContentTypeKey))
+	assert.Equal(t, `{"id":"d01"}`, w.Body.String())
+	assert.Equal(t, xmlBody, serve(ep, "/api/xml", "").Body.String())
+}
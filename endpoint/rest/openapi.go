@@ -0,0 +1,213 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/utils/str"
+)
+
+const (
+	// DefaultOpenAPIPath 建议的OpenAPI文档路由路径，见 Config.OpenAPIPath
+	DefaultOpenAPIPath = "/openapi.json"
+	// OpenAPISpecVersion 生成的OpenAPI文档规范版本
+	OpenAPISpecVersion = "3.0.3"
+	// DefaultOpenAPITitle 文档的默认标题
+	DefaultOpenAPITitle = "RuleGo HTTP Endpoint"
+	// DefaultOpenAPIVersion 文档描述的接口的默认版本
+	DefaultOpenAPIVersion = "1.0.0"
+)
+
+// 路由定义 RouterDsl.AdditionalInfo 中补充OpenAPI文档的key
+const (
+	// OpenAPIKeySummary 接口摘要，字符串
+	OpenAPIKeySummary = "summary"
+	// OpenAPIKeyDescription 接口描述，字符串
+	OpenAPIKeyDescription = "description"
+	// OpenAPIKeyTags 接口标签，字符串或者字符串数组
+	OpenAPIKeyTags = "tags"
+	// OpenAPIKeyRequestSchema 请求体的JSON Schema
+	OpenAPIKeyRequestSchema = "requestSchema"
+	// OpenAPIKeyResponseSchema 响应体的JSON Schema
+	OpenAPIKeyResponseSchema = "responseSchema"
+)
+
+// OpenAPIDoc OpenAPI 3文档，只包含路由生成的部分
+type OpenAPIDoc struct {
+	OpenAPI string                                  `json:"openapi"`
+	Info    OpenAPIInfo                             `json:"info"`
+	Paths   map[string]map[string]*OpenAPIOperation `json:"paths"`
+}
+
+// OpenAPIInfo 文档的基本信息
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIOperation 路径的一个方法
+type OpenAPIOperation struct {
+	OperationId string                     `json:"operationId,omitempty"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIBody               `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter 接口参数，路由生成的文档只包含路径参数
+type OpenAPIParameter struct {
+	Name     string                 `json:"name"`
+	In       string                 `json:"in"`
+	Required bool                   `json:"required"`
+	Schema   map[string]interface{} `json:"schema"`
+}
+
+// OpenAPIBody 请求体
+type OpenAPIBody struct {
+	Content map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse 响应
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType 请求体或者响应体的格式
+type OpenAPIMediaType struct {
+	Schema interface{} `json:"schema,omitempty"`
+}
+
+// OpenAPI 使用当前注册的路由生成OpenAPI 3文档，跳过已经删除的路由，
+// 接口摘要、描述、标签和请求响应的JSON Schema从路由定义的 AdditionalInfo 读取，见 OpenAPIKeySummary 等
+func (rest *Rest) OpenAPI() *OpenAPIDoc {
+	doc := &OpenAPIDoc{
+		OpenAPI: OpenAPISpecVersion,
+		Info:    rest.openAPIInfo(),
+		Paths:   make(map[string]map[string]*OpenAPIOperation),
+	}
+	rest.RLock()
+	defer rest.RUnlock()
+	for id, router := range rest.RouterStorage {
+		params := router.GetParams()
+		if len(params) == 0 || router.IsDisable() {
+			continue
+		}
+		method := str.ToString(params[0])
+		if method == MethodWS {
+			method = http.MethodGet
+		}
+		path, pathParams := openAPIPath(rest.fullPath(rest.convertPathParams(routerPath(router))))
+		operations, ok := doc.Paths[path]
+		if !ok {
+			operations = make(map[string]*OpenAPIOperation)
+			doc.Paths[path] = operations
+		}
+		operation := &OpenAPIOperation{
+			OperationId: id,
+			Responses:   map[string]OpenAPIResponse{"200": {Description: http.StatusText(http.StatusOK)}},
+		}
+		for _, name := range pathParams {
+			operation.Parameters = append(operation.Parameters, OpenAPIParameter{
+				Name: name, In: "path", Required: true, Schema: map[string]interface{}{"type": "string"},
+			})
+		}
+		applyOpenAPIInfo(operation, router)
+		operations[strings.ToLower(method)] = operation
+	}
+	return doc
+}
+
+// openAPIInfo 文档的基本信息，没有配置使用默认值
+func (rest *Rest) openAPIInfo() OpenAPIInfo {
+	info := OpenAPIInfo{Title: rest.Config.OpenAPITitle, Version: rest.Config.OpenAPIVersion}
+	if info.Title == "" {
+		info.Title = DefaultOpenAPITitle
+	}
+	if info.Version == "" {
+		info.Version = DefaultOpenAPIVersion
+	}
+	return info
+}
+
+// openAPIPath 把httprouter的路径参数转换成OpenAPI格式，例如：/api/:id/*path 转换成 /api/{id}/{path}
+func openAPIPath(path string) (string, []string) {
+	var names []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		index := strings.IndexAny(segment, ":*")
+		if index < 0 {
+			continue
+		}
+		name := segment[index+1:]
+		names = append(names, name)
+		segments[i] = segment[:index] + "{" + name + "}"
+	}
+	return strings.Join(segments, "/"), names
+}
+
+// applyOpenAPIInfo 使用路由定义的 AdditionalInfo 补充接口信息
+func applyOpenAPIInfo(operation *OpenAPIOperation, router endpoint.Router) {
+	def := router.Definition()
+	if def == nil || len(def.AdditionalInfo) == 0 {
+		return
+	}
+	info := def.AdditionalInfo
+	if v, ok := info[OpenAPIKeySummary]; ok {
+		operation.Summary = str.ToString(v)
+	}
+	if v, ok := info[OpenAPIKeyDescription]; ok {
+		operation.Description = str.ToString(v)
+	}
+	switch tags := info[OpenAPIKeyTags].(type) {
+	case string:
+		operation.Tags = []string{tags}
+	case []string:
+		operation.Tags = tags
+	case []interface{}:
+		for _, tag := range tags {
+			operation.Tags = append(operation.Tags, str.ToString(tag))
+		}
+	}
+	if schema, ok := info[OpenAPIKeyRequestSchema]; ok && schema != nil {
+		operation.RequestBody = &OpenAPIBody{Content: map[string]OpenAPIMediaType{JsonContextType: {Schema: schema}}}
+	}
+	if schema, ok := info[OpenAPIKeyResponseSchema]; ok && schema != nil {
+		operation.Responses["200"] = OpenAPIResponse{
+			Description: http.StatusText(http.StatusOK),
+			Content:     map[string]OpenAPIMediaType{JsonContextType: {Schema: schema}},
+		}
+	}
+}
+
+// openAPIHandler 输出OpenAPI文档，直接注册到httprouter，不经过规则链、拦截器和认证
+func (rest *Rest) openAPIHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	data, err := json.Marshal(rest.OpenAPI())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(ContentTypeKey, JsonContextType)
+	_, _ = w.Write(data)
+}
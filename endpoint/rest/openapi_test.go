@@ -0,0 +1,107 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestOpenAPI(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9142", "basePath": "/v1", "openapiPath": DefaultOpenAPIPath, "openapiTitle": "devices"})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+	process := func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		return true
+	}
+	router := impl.NewRouter(endpoint.RouterOptions.WithDefinition(&types.RouterDsl{AdditionalInfo: map[string]interface{}{
+		OpenAPIKeySummary:        "get device",
+		OpenAPIKeyTags:           []interface{}{"device"},
+		OpenAPIKeyResponseSchema: map[string]interface{}{"type": "object"},
+	}})).SetId("getDevice").From("/api/devices/:id/*path").Process(process).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	router = impl.NewRouter(endpoint.RouterOptions.WithDefinition(&types.RouterDsl{AdditionalInfo: map[string]interface{}{
+		OpenAPIKeyDescription:   "add a device",
+		OpenAPIKeyTags:          "device",
+		OpenAPIKeyRequestSchema: map[string]interface{}{"type": "object", "required": []string{"id"}},
+	}})).SetId("addDevice").From("/api/devices").Process(process).End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+	router = impl.NewRouter().SetId("ws").From("/api/ws").Process(process).End()
+	_, err = ep.AddRouter(router, MethodWS)
+	assert.Nil(t, err)
+
+	get := func() map[string]map[string]*OpenAPIOperation {
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, DefaultOpenAPIPath, nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, JsonContextType, w.Header().Get(ContentTypeKey))
+		var doc OpenAPIDoc
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, OpenAPISpecVersion, doc.OpenAPI)
+		assert.Equal(t, OpenAPIInfo{Title: "devices", Version: DefaultOpenAPIVersion}, doc.Info)
+		return doc.Paths
+	}
+	paths := get()
+	assert.Equal(t, 3, len(paths))
+	getDevice := paths["/v1/api/devices/{id}/{path}"]["get"]
+	assert.Equal(t, "getDevice", getDevice.OperationId)
+	assert.Equal(t, "get device", getDevice.Summary)
+	assert.Equal(t, []string{"device"}, getDevice.Tags)
+	assert.Equal(t, 2, len(getDevice.Parameters))
+	assert.Equal(t, OpenAPIParameter{Name: "id", In: "path", Required: true, Schema: map[string]interface{}{"type": "string"}}, getDevice.Parameters[0])
+	assert.Equal(t, "path", getDevice.Parameters[1].Name)
+	assert.Nil(t, getDevice.RequestBody)
+	assert.Equal(t, map[string]interface{}{"type": "object"}, getDevice.Responses["200"].Content[JsonContextType].Schema)
+
+	addDevice := paths["/v1/api/devices"]["post"]
+	assert.Equal(t, "add a device", addDevice.Description)
+	assert.Equal(t, []string{"device"}, addDevice.Tags)
+	assert.Equal(t, 0, len(addDevice.Parameters))
+	assert.NotNil(t, addDevice.RequestBody.Content[JsonContextType].Schema)
+	assert.Equal(t, 0, len(addDevice.Responses["200"].Content))
+	//websocket路由使用GET
+	assert.NotNil(t, paths["/v1/api/ws"]["get"])
+
+	//运行时添加和删除的路由
+	router = impl.NewRouter().SetId("updateDevice").From("/api/devices/{id}").Process(process).End()
+	_, err = ep.AddRouter(router, "PUT")
+	assert.Nil(t, err)
+	assert.Nil(t, ep.RemoveRouter("ws"))
+	paths = get()
+	assert.Equal(t, 3, len(paths))
+	assert.Equal(t, "updateDevice", paths["/v1/api/devices/{id}"]["put"].OperationId)
+	assert.Nil(t, paths["/v1/api/ws"])
+
+	//没有配置路由路径时只能通过方法获取
+	var disabled = &Endpoint{}
+	err = disabled.Init(types.NewConfig(), types.Configuration{"server": ":9143"})
+	assert.Nil(t, err)
+	w := httptest.NewRecorder()
+	disabled.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, DefaultOpenAPIPath, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, DefaultOpenAPITitle, disabled.OpenAPI().Info.Title)
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rulego/rulego/utils/str"
+)
+
+// HeaderKeyAllow OPTIONS和405响应的允许方法响应头
+const HeaderKeyAllow = "Allow"
+
+// serveOptions 处理没有注册OPTIONS路由的OPTIONS请求，Allow响应头为路径实际注册并且可用的方法，
+// 匹配的路由都已经删除时按没有匹配路由处理，然后交给 GlobalOPTIONS 设置的处理器或者跨域预检处理
+func (rest *Rest) serveOptions(w http.ResponseWriter, r *http.Request) {
+	methods, matched := rest.allowedMethods(r.URL.Path)
+	rest.RLock()
+	handler := rest.optionsHandler
+	var notFound http.Handler
+	if rest.router != nil {
+		notFound = rest.router.NotFound
+	}
+	rest.RUnlock()
+	if matched && len(methods) == 0 {
+		if notFound != nil {
+			notFound.ServeHTTP(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+		return
+	}
+	if len(methods) > 0 {
+		w.Header().Set(HeaderKeyAllow, strings.Join(methods, ", "))
+	}
+	if handler != nil {
+		handler.ServeHTTP(w, r)
+	} else if rest.cors != nil {
+		rest.cors.preflight(w, r)
+	}
+}
+
+// allowedMethods 获取路径注册并且可用的方法，包括OPTIONS，matched 为是否有路由匹配该路径，包括已经删除的路由
+// 没有通过 RouterStorage 注册的路径，例如静态文件，返回matched=false，使用httprouter的Allow响应头
+func (rest *Rest) allowedMethods(path string) (methods []string, matched bool) {
+	rest.RLock()
+	defer rest.RUnlock()
+	seen := make(map[string]struct{})
+	for _, item := range rest.RouterStorage {
+		params := item.GetParams()
+		if len(params) == 0 {
+			continue
+		}
+		if !matchPath(rest.withBasePath(rest.convertPathParams(routerPath(item))), path) {
+			continue
+		}
+		matched = true
+		if item.IsDisable() {
+			continue
+		}
+		method := str.ToString(params[0])
+		if method == MethodWS {
+			method = http.MethodGet
+		}
+		if _, ok := seen[method]; !ok {
+			seen[method] = struct{}{}
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) > 0 {
+		if _, ok := seen[http.MethodOptions]; !ok {
+			methods = append(methods, http.MethodOptions)
+		}
+		sort.Strings(methods)
+	}
+	return methods, matched
+}
+
+// matchPath 请求路径是否匹配httprouter格式的路由路径，:name 匹配一段非空的路径，*name 匹配剩余的路径
+func matchPath(pattern, path string) bool {
+	patterns := strings.Split(pattern, "/")
+	segments := strings.Split(path, "/")
+	for i, p := range patterns {
+		if i >= len(segments) {
+			return false
+		}
+		segment := segments[i]
+		idx := strings.IndexAny(p, ":*")
+		if idx < 0 {
+			if p != segment {
+				return false
+			}
+			continue
+		}
+		if !strings.HasPrefix(segment, p[:idx]) {
+			return false
+		}
+		if p[idx] == '*' {
+			return true
+		}
+		if len(segment) == idx {
+			return false
+		}
+	}
+	return len(patterns) == len(segments)
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestMatchPath(t *testing.T) {
+	assert.True(t, matchPath("/api/devices", "/api/devices"))
+	assert.True(t, matchPath("/api/devices/:id", "/api/devices/d01"))
+	assert.True(t, matchPath("/api/v:version/devices", "/api/v1/devices"))
+	assert.True(t, matchPath("/files/*filepath", "/files/"))
+	assert.True(t, matchPath("/files/*filepath", "/files/a/b.txt"))
+	assert.False(t, matchPath("/api/devices/:id", "/api/devices/"))
+	assert.False(t, matchPath("/api/devices/:id", "/api/devices/d01/logs"))
+	assert.False(t, matchPath("/api/v:version/devices", "/api/v/devices"))
+	assert.False(t, matchPath("/files/*filepath", "/files"))
+	assert.False(t, matchPath("/api/devices", "/api/users"))
+}
+
+func TestOptions(t *testing.T) {
+	var ep = &Endpoint{}
+	assert.Nil(t, ep.Init(types.NewConfig(), types.Configuration{"server": ":9130", "allowCors": true}))
+	defer ep.Destroy()
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		_, err := ep.AddRouter(impl.NewRouter().SetId(method).From("/api/devices/{id}").End(), method)
+		assert.Nil(t, err)
+	}
+	_, err := ep.AddRouter(impl.NewRouter().From("/api/devices").End(), "POST")
+	assert.Nil(t, err)
+	options := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodOptions, path, nil)
+		r.Header.Set(HeaderKeyOrigin, "https://any.com")
+		r.Header.Set(HeaderKeyAccessControlRequestMethod, http.MethodPut)
+		ep.Router().ServeHTTP(w, r)
+		return w
+	}
+	w := options("/api/devices/d01")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "DELETE, GET, OPTIONS, PUT", w.Header().Get(HeaderKeyAllow))
+	assert.Equal(t, "DELETE, GET, OPTIONS, PUT", w.Header().Get(HeaderKeyAccessControlAllowMethods))
+	assert.Equal(t, "OPTIONS, POST", options("/api/devices").Header().Get(HeaderKeyAllow))
+
+	//删除的路由不在允许的方法中
+	assert.Nil(t, ep.RemoveRouter("PUT"))
+	assert.Equal(t, "DELETE, GET, OPTIONS", options("/api/devices/d01").Header().Get(HeaderKeyAllow))
+	assert.Nil(t, ep.RemoveRouter("GET"))
+	assert.Nil(t, ep.RemoveRouter("DELETE"))
+	assert.Equal(t, http.StatusNotFound, options("/api/devices/d01").Code)
+
+	//自定义处理器，重启后保留
+	ep.GlobalOPTIONS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Allow", w.Header().Get(HeaderKeyAllow))
+		w.WriteHeader(http.StatusOK)
+	}))
+	assert.Nil(t, ep.Start())
+	time.Sleep(time.Millisecond * 200)
+	assert.Nil(t, ep.Restart())
+	time.Sleep(time.Millisecond * 200)
+	w = options("/api/devices")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "OPTIONS, POST", w.Header().Get("X-Allow"))
+	assert.Equal(t, "", w.Header().Get(HeaderKeyAccessControlAllowMethods))
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// proxyHeaderTimeout 读取PROXY协议头的超时时间
+	proxyHeaderTimeout = time.Second * 5
+	// proxyV1MaxLen PROXY协议v1头的最大长度，包括结尾的\r\n
+	proxyV1MaxLen = 107
+)
+
+// proxyV2Signature PROXY协议v2头的签名
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errNoProxyHeader = errors.New("proxy protocol header not found")
+
+// proxyListener 解析PROXY协议头的监听器，trusted 不为空时只解析来自可信代理的连接
+type proxyListener struct {
+	net.Listener
+	trusted []*net.IPNet
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if len(l.trusted) > 0 {
+		if addr, ok := conn.RemoteAddr().(*net.TCPAddr); !ok || !containsIP(l.trusted, addr.IP) {
+			return conn, nil
+		}
+	}
+	return &proxyConn{Conn: conn}, nil
+}
+
+// proxyConn 在第一次读取或者获取对端地址时解析PROXY协议头，不阻塞监听器的Accept
+// 没有PROXY协议头或者格式错误时读取返回错误，http服务响应400并关闭该连接
+type proxyConn struct {
+	net.Conn
+	once       sync.Once
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+	err        error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.reader = bufio.NewReader(c.Conn)
+		_ = c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		c.remoteAddr, c.err = readProxyHeader(c.reader)
+		_ = c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr PROXY协议头中的源地址，LOCAL命令或者UNKNOWN协议使用连接的对端地址
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader 读取PROXY协议头，返回源地址
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	//合法的v1和v2头都不少于16个字节
+	prefix, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(prefix, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if bytes.HasPrefix(prefix, []byte("PROXY ")) {
+		return readProxyV1(r)
+	}
+	return nil, errNoProxyHeader
+}
+
+// readProxyV1 读取文本格式的头，例如：PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLen {
+			return nil, errors.New("proxy protocol v1 header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("invalid proxy protocol v1 header")
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid proxy protocol v1 header:%s", line)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid proxy protocol v1 source address:%s %s", fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyV2 读取二进制格式的头，跳过TLV扩展
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, len(proxyV2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	verCmd, family := header[12], header[13]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("unsupported proxy protocol version:%d", verCmd>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	//LOCAL命令，例如代理的健康检查，使用连接的对端地址
+	if cmd := verCmd & 0x0f; cmd == 0x00 {
+		return nil, nil
+	} else if cmd != 0x01 {
+		return nil, fmt.Errorf("unsupported proxy protocol command:%d", cmd)
+	}
+	switch family >> 4 {
+	case 0x01:
+		if len(payload) < 12 {
+			return nil, errors.New("invalid proxy protocol v2 ipv4 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x02:
+		if len(payload) < 36 {
+			return nil, errors.New("invalid proxy protocol v2 ipv6 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		//unix等其他地址族使用连接的对端地址
+		return nil, nil
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestProxyProtocol(t *testing.T) {
+	start := func(configuration types.Configuration) *Endpoint {
+		var ep = &Endpoint{}
+		assert.Nil(t, ep.Init(types.NewConfig(), configuration))
+		router := impl.NewRouter().From("/api/ip").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			exchange.Out.SetBody([]byte(exchange.In.GetMsg().Metadata.GetValue(KeyRemoteIp)))
+			return true
+		}).End()
+		_, err := ep.AddRouter(router, "GET")
+		assert.Nil(t, err)
+		assert.Nil(t, ep.Start())
+		time.Sleep(time.Millisecond * 200)
+		return ep
+	}
+	//发送PROXY协议头和http请求，返回响应体
+	send := func(addr string, header []byte) (string, error) {
+		conn, err := net.Dial("tcp", addr)
+		assert.Nil(t, err)
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(time.Second * 5))
+		_, _ = conn.Write(header)
+		_, _ = conn.Write([]byte("GET /api/ip HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+	v2 := func(cmd, family byte, addr []byte) []byte {
+		header := append([]byte(nil), proxyV2Signature...)
+		header = append(header, 0x20|cmd, family, 0, 0)
+		binary.BigEndian.PutUint16(header[14:], uint16(len(addr)))
+		return append(header, addr...)
+	}
+
+	ep := start(types.Configuration{"server": "127.0.0.1:9140", "proxyProtocol": true})
+	defer ep.Destroy()
+	body, err := send("127.0.0.1:9140", []byte("PROXY TCP4 203.0.113.7 127.0.0.1 56324 9140\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "203.0.113.7", body)
+	body, err = send("127.0.0.1:9140", []byte("PROXY TCP6 2001:db8::7 ::1 56324 9140\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2001:db8::7", body)
+	//UNKNOWN使用连接地址
+	body, err = send("127.0.0.1:9140", []byte("PROXY UNKNOWN\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1", body)
+	//v2，带TLV扩展
+	addr := []byte{198, 51, 100, 9, 127, 0, 0, 1, 0x1f, 0x90, 0x23, 0xc4, 0x04, 0x00, 0x01, 0x00}
+	body, err = send("127.0.0.1:9140", v2(0x01, 0x11, addr))
+	assert.Nil(t, err)
+	assert.Equal(t, "198.51.100.9", body)
+	//LOCAL命令使用连接地址
+	body, err = send("127.0.0.1:9140", v2(0x00, 0x00, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1", body)
+	//没有PROXY协议头或者格式错误的连接响应400并关闭
+	body, err = send("127.0.0.1:9140", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "400 Bad Request", body)
+	body, err = send("127.0.0.1:9140", []byte("PROXY TCP4 bad 127.0.0.1 1 2\r\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "400 Bad Request", body)
+
+	//只解析可信代理的连接
+	untrusted := start(types.Configuration{"server": "127.0.0.1:9141", "proxyProtocol": true, "trustedProxies": []string{"10.0.0.0/8"}})
+	defer untrusted.Destroy()
+	body, err = send("127.0.0.1:9141", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1", body)
+
+	//不支持的版本
+	_, err = readProxyHeader(bufio.NewReader(strings.NewReader("\r\n\r\n\x00\r\nQUIT\n\x31\x11\x00\x00")))
+	assert.NotNil(t, err)
+	_, err = readProxyHeader(bufio.NewReader(strings.NewReader("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n")))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// putQueryMetadata 把url?参数放到msg元数据中，skipKey 不放到元数据中，例如令牌参数
+// 单个值直接使用参数值，重复的参数使用JSON数组字符串，例如：?tag=a&tag=b 的元数据 tag 为 ["a","b"]
+func putQueryMetadata(metadata *types.Metadata, query url.Values, skipKey string) {
+	for key, values := range query {
+		if skipKey != "" && key == skipKey {
+			continue
+		}
+		metadata.PutValue(key, queryValue(values))
+	}
+}
+
+// queryValue 参数值转换成元数据的值，重复的参数使用JSON数组字符串
+func queryValue(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+// queryData GET请求或者表单请求的消息负荷，所有参数值都使用数组的JSON对象，例如：{"tag":["a","b"],"id":["1"]}
+func queryData(query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	b, _ := json.Marshal(query)
+	return string(b)
+}
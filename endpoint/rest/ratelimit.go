@@ -0,0 +1,178 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+const (
+	// KeyRateLimit 路由from配置：限流，配置见 RateLimitConfig
+	KeyRateLimit = "rateLimit"
+	// HeaderKeyRetryAfter 限流响应头，建议客户端重试的秒数
+	HeaderKeyRetryAfter = "Retry-After"
+	// RateLimitKeyByIP 按客户端IP限流
+	RateLimitKeyByIP = "ip"
+	// rateLimitSweepSize 限流key的数量超过该值时清理空闲的令牌桶
+	rateLimitSweepSize = 1024
+)
+
+// RateLimitConfig 路由限流配置，超过限制响应429和 Retry-After 响应头，不执行路由处理
+type RateLimitConfig struct {
+	// MaxQPS 每秒允许的请求数，0不限制
+	MaxQPS float64 `json:"maxQPS"`
+	// Burst 允许的突发请求数，0使用 MaxQPS 向上取整
+	Burst int `json:"burst"`
+	// KeyBy 限流的key：为空整个路由共享一个限额，ip按客户端IP，其他值按同名的路径参数或者url参数，例如：deviceId
+	KeyBy string `json:"keyBy"`
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter 令牌桶限流器，每个key一个令牌桶
+type rateLimiter struct {
+	qps   float64
+	burst float64
+	keyBy string
+	mu    sync.Mutex
+	//key->令牌桶
+	buckets map[string]*tokenBucket
+	//下次清理空闲令牌桶的key数量
+	sweepSize int
+}
+
+func newRateLimiter(config RateLimitConfig) (*rateLimiter, error) {
+	if config.MaxQPS < 0 || config.Burst < 0 {
+		return nil, fmt.Errorf("maxQPS and burst must be >= 0")
+	}
+	if config.MaxQPS == 0 {
+		return nil, nil
+	}
+	burst := float64(config.Burst)
+	if burst == 0 {
+		burst = math.Ceil(config.MaxQPS)
+	}
+	return &rateLimiter{
+		qps:       config.MaxQPS,
+		burst:     burst,
+		keyBy:     config.KeyBy,
+		buckets:   make(map[string]*tokenBucket),
+		sweepSize: rateLimitSweepSize,
+	}, nil
+}
+
+// allow 获取一个令牌，没有令牌时返回需要等待的时间
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.sweepSize {
+			l.sweep(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed.Seconds()*l.qps)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.qps * float64(time.Second))
+}
+
+// sweep 删除已经填满的令牌桶，填满的令牌桶和新建的没有区别，调用方需要持有锁
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.qps >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	//活跃的key过多时，避免每次新建令牌桶都清理
+	l.sweepSize = rateLimitSweepSize
+	if n := len(l.buckets) * 2; n > l.sweepSize {
+		l.sweepSize = n
+	}
+}
+
+// key 获取请求的限流key，ip为客户端IP
+func (l *rateLimiter) key(ip string, r *http.Request, params httprouter.Params) string {
+	switch l.keyBy {
+	case "":
+		return ""
+	case RateLimitKeyByIP:
+		return ip
+	}
+	if v := params.ByName(l.keyBy); v != "" {
+		return v
+	}
+	return r.URL.Query().Get(l.keyBy)
+}
+
+// rateLimited 依次检查限流器，超过限制时响应429，返回true
+func rateLimited(w http.ResponseWriter, r *http.Request, params httprouter.Params, ip string, limiters ...*rateLimiter) bool {
+	now := time.Now()
+	for _, l := range limiters {
+		if l == nil {
+			continue
+		}
+		if ok, wait := l.allow(l.key(ip, r, params), now); !ok {
+			seconds := int(math.Ceil(wait.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set(HeaderKeyRetryAfter, strconv.Itoa(seconds))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return true
+		}
+	}
+	return false
+}
+
+// routerRateLimit 获取路由的限流器，没有配置返回nil
+func (rest *Rest) routerRateLimit(router endpoint.Router) (*rateLimiter, error) {
+	if from, ok := router.GetFrom().(*impl.From); ok && from != nil {
+		if v, ok := from.Config[KeyRateLimit]; ok && v != nil {
+			var config RateLimitConfig
+			if err := maps.Map2Struct(v, &config); err != nil {
+				return nil, fmt.Errorf("router %s rateLimit config error: %w", router.GetId(), err)
+			}
+			limiter, err := newRateLimiter(config)
+			if err != nil {
+				return nil, fmt.Errorf("router %s rateLimit config error: %w", router.GetId(), err)
+			}
+			return limiter, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l, err := newRateLimiter(RateLimitConfig{MaxQPS: 2, Burst: 2})
+	assert.Nil(t, err)
+	now := time.Now()
+	ok, _ := l.allow("", now)
+	assert.True(t, ok)
+	ok, _ = l.allow("", now)
+	assert.True(t, ok)
+	ok, wait := l.allow("", now)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+	//其他key使用独立的令牌桶
+	ok, _ = l.allow("device02", now)
+	assert.True(t, ok)
+	//按MaxQPS补充令牌
+	ok, _ = l.allow("", now.Add(500*time.Millisecond))
+	assert.True(t, ok)
+	ok, _ = l.allow("", now.Add(500*time.Millisecond))
+	assert.False(t, ok)
+
+	//key的数量达到阈值时清理已经填满的令牌桶
+	for i := len(l.buckets); i < rateLimitSweepSize; i++ {
+		l.allow(strconv.Itoa(i), now)
+	}
+	assert.Equal(t, rateLimitSweepSize, len(l.buckets))
+	l.allow("new", now.Add(time.Minute))
+	assert.Equal(t, 1, len(l.buckets))
+
+	l, err = newRateLimiter(RateLimitConfig{})
+	assert.Nil(t, err)
+	assert.Nil(t, l)
+	_, err = newRateLimiter(RateLimitConfig{MaxQPS: -1})
+	assert.NotNil(t, err)
+}
+
+func TestRateLimit(t *testing.T) {
+	var processed int
+	newRouter := func(path string, configuration types.Configuration) endpoint.Router {
+		return impl.NewRouter().From(path, configuration).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			processed++
+			return true
+		}).End()
+	}
+	get := func(ep *Endpoint, url, remoteAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		if remoteAddr != "" {
+			r.RemoteAddr = remoteAddr
+		}
+		ep.Router().ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("Global", func(t *testing.T) {
+		processed = 0
+		var ep = &Endpoint{}
+		err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9110", "maxQPS": 1, "rateLimitKeyBy": RateLimitKeyByIP})
+		assert.Nil(t, err)
+		_, err = ep.AddRouter(newRouter("/api/a", nil), "GET")
+		assert.Nil(t, err)
+		_, err = ep.AddRouter(newRouter("/api/b", nil), "GET")
+		assert.Nil(t, err)
+
+		assert.Equal(t, http.StatusOK, get(ep, "/api/a", "10.0.0.1:1000").Code)
+		//所有路由共享端点的限额
+		w := get(ep, "/api/b", "10.0.0.1:1001")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "1", w.Header().Get(HeaderKeyRetryAfter))
+		assert.Equal(t, 1, processed)
+		//按客户端IP限流
+		assert.Equal(t, http.StatusOK, get(ep, "/api/b", "10.0.0.2:1000").Code)
+		assert.Equal(t, 2, processed)
+	})
+
+	t.Run("Router", func(t *testing.T) {
+		processed = 0
+		var ep = &Endpoint{}
+		err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9110"})
+		assert.Nil(t, err)
+		_, err = ep.AddRouter(newRouter("/api/device/:deviceId", types.Configuration{
+			KeyRateLimit: map[string]interface{}{"maxQPS": 0.5, "burst": 2, "keyBy": "deviceId"},
+		}), "GET")
+		assert.Nil(t, err)
+		_, err = ep.AddRouter(newRouter("/api/query", types.Configuration{
+			KeyRateLimit: map[string]interface{}{"maxQPS": 1, "keyBy": "deviceId"},
+		}), "GET")
+		assert.Nil(t, err)
+		_, err = ep.AddRouter(newRouter("/api/normal", nil), "GET")
+		assert.Nil(t, err)
+
+		assert.Equal(t, http.StatusOK, get(ep, "/api/device/d01", "").Code)
+		assert.Equal(t, http.StatusOK, get(ep, "/api/device/d01", "").Code)
+		w := get(ep, "/api/device/d01", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "2", w.Header().Get(HeaderKeyRetryAfter))
+		//其他设备不受影响
+		assert.Equal(t, http.StatusOK, get(ep, "/api/device/d02", "").Code)
+		assert.Equal(t, 3, processed)
+
+		//按url参数限流
+		assert.Equal(t, http.StatusOK, get(ep, "/api/query?deviceId=d01", "").Code)
+		assert.Equal(t, http.StatusTooManyRequests, get(ep, "/api/query?deviceId=d01", "").Code)
+		assert.Equal(t, http.StatusOK, get(ep, "/api/query?deviceId=d02", "").Code)
+
+		//没有配置限流的路由
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, http.StatusOK, get(ep, "/api/normal", "").Code)
+		}
+
+		_, err = ep.AddRouter(newRouter("/api/invalid", types.Configuration{
+			KeyRateLimit: map[string]interface{}{"maxQPS": -1},
+		}), "GET")
+		assert.NotNil(t, err)
+	})
+
+	//限流同样对websocket握手生效
+	t.Run("WebSocket", func(t *testing.T) {
+		var ep = &Endpoint{}
+		err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9110", "maxQPS": 1})
+		assert.Nil(t, err)
+		_, err = ep.AddRouter(newRouter("/api/ws", nil), MethodWS)
+		assert.Nil(t, err)
+		//非websocket请求握手失败，但是消耗了令牌
+		assert.Equal(t, http.StatusBadRequest, get(ep, "/api/ws", "").Code)
+		assert.Equal(t, http.StatusTooManyRequests, get(ep, "/api/ws", "").Code)
+	})
+}
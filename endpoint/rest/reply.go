@@ -0,0 +1,86 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+// Reply 把消息数据POST到消息来源的回调地址(元数据 originReplyUrl)，回调地址由请求头 Config.ReplyUrlHeader 提供
+// 响应状态码不是2xx返回错误。来自websocket路由的消息(元数据 originConnection)写回原连接
+func (rest *Rest) Reply(msg types.RuleMsg) error {
+	//来自websocket路由的消息写回原连接
+	if connId := msg.Metadata.GetValue(endpoint.OriginConnectionKey); connId != "" {
+		return rest.replyWs(connId, msg)
+	}
+	replyUrl := msg.Metadata.GetValue(endpoint.OriginReplyUrlKey)
+	if replyUrl == "" {
+		return errors.New("reply url is empty")
+	}
+	body, err := msg.GetDataReader()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	req, err := http.NewRequest(http.MethodPost, replyUrl, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(msg.GetDataSize())
+	req.Header.Set(ContentTypeKey, replyContentType(msg.DataType))
+	resp, err := rest.getReplyClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("reply to %s status code:%d", replyUrl, resp.StatusCode)
+	}
+	return nil
+}
+
+// getReplyClient 获取回复客户端，超时时间使用写入超时时间
+func (rest *Rest) getReplyClient() *http.Client {
+	rest.replyClientOnce.Do(func() {
+		timeout := rest.Config.WriteTimeout
+		if timeout <= 0 {
+			timeout = 10
+		}
+		rest.replyClient = &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	})
+	return rest.replyClient
+}
+
+// replyContentType 根据消息数据类型获取回复的Content-Type
+func replyContentType(dataType types.DataType) string {
+	switch dataType {
+	case types.JSON:
+		return JsonContextType
+	case types.BINARY:
+		return "application/octet-stream"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
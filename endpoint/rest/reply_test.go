@@ -0,0 +1,107 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestRestReply(t *testing.T) {
+	callbacks := make(chan string, 1)
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		callbacks <- r.Header.Get(ContentTypeKey) + ":" + string(body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer callbackServer.Close()
+
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{
+		"server":         ":9097",
+		"replyUrlHeader": "X-Reply-To",
+	})
+	assert.Nil(t, err)
+	msgs := make(chan types.RuleMsg, 1)
+	router := impl.NewRouter().From("/api/async").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		msgs <- *exchange.In.GetMsg()
+		exchange.Out.SetStatusCode(http.StatusAccepted)
+		return false
+	}).End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	time.Sleep(time.Millisecond * 200)
+
+	post := func(replyUrl string) types.RuleMsg {
+		req, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1:9097/api/async", strings.NewReader(`{"temperature":41}`))
+		req.Header.Set(ContentTypeKey, JsonContextType)
+		if replyUrl != "" {
+			req.Header.Set("X-Reply-To", replyUrl)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		return <-msgs
+	}
+
+	t.Run("Reply", func(t *testing.T) {
+		msg := post(callbackServer.URL + "/ok")
+		origin := endpoint.OriginFromMetadata(msg.Metadata)
+		assert.Equal(t, Type, origin.Type)
+		assert.Equal(t, ep.OriginId(), origin.Id)
+		assert.Equal(t, callbackServer.URL+"/ok", origin.ReplyUrl)
+
+		replier, ok := endpoint.GetReplier(origin.Id)
+		assert.True(t, ok)
+		msg.SetData(`{"alarm":true}`)
+		assert.Nil(t, replier.Reply(msg))
+		assert.Equal(t, JsonContextType+`:{"alarm":true}`, <-callbacks)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		msg := post(callbackServer.URL + "/fail")
+		replier, _ := endpoint.GetReplier(ep.OriginId())
+		err := replier.Reply(msg)
+		<-callbacks
+		assert.Equal(t, "reply to "+callbackServer.URL+"/fail status code:502", err.Error())
+
+		//没有回调地址
+		msg = post("")
+		assert.Equal(t, "", msg.Metadata.GetValue(endpoint.OriginReplyUrlKey))
+		assert.NotNil(t, replier.Reply(msg))
+	})
+
+	t.Run("Destroy", func(t *testing.T) {
+		originId := ep.OriginId()
+		ep.Destroy()
+		_, ok := endpoint.GetReplier(originId)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	// KeyRequestId 请求ID放到msg元数据的key
+	KeyRequestId = "requestId"
+	// maxRequestIdLen 复用请求头的请求ID的最大长度
+	maxRequestIdLen = 128
+)
+
+// requestIdHeader 请求ID的请求头，为空使用 HeaderKeyRequestId
+func (rest *Rest) requestIdHeader() string {
+	if rest.Config.RequestIdHeader == "" {
+		return HeaderKeyRequestId
+	}
+	return rest.Config.RequestIdHeader
+}
+
+// requestId 复用请求头的请求ID，没有或者不合法时生成，并设置到响应头
+func (rest *Rest) requestId(w http.ResponseWriter, r *http.Request) string {
+	header := rest.requestIdHeader()
+	requestId := r.Header.Get(header)
+	if !validRequestId(requestId) {
+		uuId, _ := uuid.NewV4()
+		requestId = uuId.String()
+	}
+	w.Header().Set(header, requestId)
+	return requestId
+}
+
+// validRequestId 请求ID不能为空、超过 maxRequestIdLen 或者包含空白和控制字符
+func validRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLen {
+		return false
+	}
+	for i := 0; i < len(requestId); i++ {
+		if c := requestId[i]; c <= ' ' || c >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestRequestId(t *testing.T) {
+	newEndpoint := func(configuration types.Configuration) *Endpoint {
+		var ep = &Endpoint{}
+		assert.Nil(t, ep.Init(types.NewConfig(), configuration))
+		var contextRequestId string
+		router := impl.NewRouter(endpoint.RouterOptions.WithContextFunc(func(ctx context.Context, exchange *endpoint.Exchange) context.Context {
+			contextRequestId, _ = endpoint.RequestIdFromContext(ctx)
+			return ctx
+		})).From("/api/msg").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			msg := exchange.In.GetMsg()
+			exchange.Out.SetBody([]byte(strings.Join([]string{msg.Id, msg.Metadata.GetValue(KeyRequestId), contextRequestId}, ",")))
+			return true
+		}).End()
+		_, err := ep.AddRouter(router, "POST")
+		assert.Nil(t, err)
+		return ep
+	}
+	serve := func(ep *Endpoint, header, requestId string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/msg?requestId=query", strings.NewReader("{}"))
+		if requestId != "" {
+			r.Header.Set(header, requestId)
+		}
+		ep.Router().ServeHTTP(w, r)
+		return w
+	}
+
+	ep := newEndpoint(types.Configuration{"server": ":9131"})
+	//复用请求头的请求ID
+	w := serve(ep, HeaderKeyRequestId, "r01")
+	assert.Equal(t, "r01,r01,r01", w.Body.String())
+	assert.Equal(t, "r01", w.Header().Get(HeaderKeyRequestId))
+	//生成请求ID
+	w = serve(ep, HeaderKeyRequestId, "")
+	requestId := w.Header().Get(HeaderKeyRequestId)
+	assert.Equal(t, 36, len(requestId))
+	assert.Equal(t, requestId+","+requestId+","+requestId, w.Body.String())
+	//不合法的请求ID重新生成
+	w = serve(ep, HeaderKeyRequestId, "r 01")
+	assert.NotEqual(t, "r 01", w.Header().Get(HeaderKeyRequestId))
+	w = serve(ep, HeaderKeyRequestId, strings.Repeat("r", maxRequestIdLen+1))
+	assert.Equal(t, 36, len(w.Header().Get(HeaderKeyRequestId)))
+
+	//自定义请求头
+	ep = newEndpoint(types.Configuration{"server": ":9132", "requestIdHeader": "X-Trace-Id"})
+	w = serve(ep, "X-Trace-Id", "t01")
+	assert.Equal(t, "t01,t01,t01", w.Body.String())
+	assert.Equal(t, "t01", w.Header().Get("X-Trace-Id"))
+	assert.Equal(t, "", w.Header().Get(HeaderKeyRequestId))
+}
@@ -39,9 +39,11 @@ import (
 	"net"
 	"net/http"
 	"net/textproto"
+	"net/url"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -62,11 +64,19 @@ const (
 	HeaderKeyAccessControlAllowHeaders  = "Access-Control-Allow-Headers"
 	HeaderKeyAccessControlAllowOrigin   = "Access-Control-Allow-Origin"
 	HeaderValueAll                      = "*"
+	HeaderKeyAuthorization              = "Authorization"
+	HeaderKeyWWWAuthenticate            = "WWW-Authenticate"
+	// DefaultTokenQueryParam 默认从该url参数读取令牌
+	DefaultTokenQueryParam = "access_token"
+	bearerPrefix           = "Bearer "
 )
 
 // Type 组件类型
 const Type = types.EndpointTypePrefix + "http"
 
+// ErrRequestBodyTooLarge 请求体超过 Config.MaxRequestBodySize
+var ErrRequestBodyTooLarge = errors.New("request body too large")
+
 // Endpoint 别名
 type Endpoint = Rest
 
@@ -83,6 +93,17 @@ type RequestMessage struct {
 	msg      *types.RuleMsg
 	err      error
 	Metadata *types.Metadata
+	//解析的表单字段
+	form       url.Values
+	formParsed bool
+	//表单请求的消息负荷转换成JSON
+	formToJson bool
+	//请求ID，不为空时作为消息ID
+	requestId string
+	//路由配置的消息数据类型
+	dataType types.DataType
+	//创建BINARY消息的内容类型
+	binaryContentTypes map[string]struct{}
 }
 
 func (r *RequestMessage) Body() []byte {
@@ -116,11 +137,17 @@ func (r *RequestMessage) GetParam(key string) string {
 	if r.request == nil {
 		return ""
 	}
-	if v := r.Params.ByName(key); v == "" {
-		return r.request.FormValue(key)
-	} else {
+	if v := r.Params.ByName(key); v != "" {
 		return v
 	}
+	if r.isForm() {
+		//从解析的表单字段读取，不会再次读取请求体
+		if values, ok := r.Form()[key]; ok && len(values) > 0 {
+			return values[0]
+		}
+		return r.request.URL.Query().Get(key)
+	}
+	return r.request.FormValue(key)
 }
 
 func (r *RequestMessage) SetMsg(msg *types.RuleMsg) {
@@ -133,17 +160,26 @@ func (r *RequestMessage) GetMsg() *types.RuleMsg {
 		var data string
 		if r.request != nil && r.request.Method == http.MethodGet {
 			dataType = types.JSON
-			data = str.ToString(r.request.URL.Query())
-		} else {
-			if contentType := r.Headers().Get(ContentTypeKey); strings.HasPrefix(contentType, JsonContextType) {
-				dataType = types.JSON
-			}
+			data = queryData(r.request.URL.Query())
+		} else if r.dataType == "" && r.formToJson && r.isForm() {
+			dataType = types.JSON
+			data = queryData(r.Form())
+		} else if dataType = r.bodyDataType(); dataType != types.BINARY {
 			data = string(r.Body())
 		}
 		if r.Metadata == nil {
 			r.Metadata = types.NewMetadata()
 		}
-		ruleMsg := types.NewMsg(0, r.From(), dataType, r.Metadata, data)
+		var ruleMsg types.RuleMsg
+		if dataType == types.BINARY {
+			//二进制请求体不转换成字符串，避免复制
+			ruleMsg = types.NewMsgFromBytes(0, r.From(), dataType, r.Metadata, r.Body())
+		} else {
+			ruleMsg = types.NewMsg(0, r.From(), dataType, r.Metadata, data)
+		}
+		if r.requestId != "" {
+			ruleMsg.Id = r.requestId
+		}
 		r.msg = &ruleMsg
 	}
 	return r.msg
@@ -181,6 +217,24 @@ type ResponseMessage struct {
 	msg      *types.RuleMsg
 	err      error
 	mu       sync.RWMutex
+	//同步路由保活器
+	keepAlive *keepAlive
+	//错误响应配置，不为空时，存在错误后写入的状态码和响应体被忽略，由端点统一写入错误响应
+	errorResponse *ErrorResponse
+	//响应后是否关闭连接
+	closeConn bool
+	//响应压缩，没有开启压缩为nil
+	compressor *compressor
+	//流式响应，见 WriteChunk
+	stream *stream
+	//从输出消息元数据设置响应头的命名空间，为空不设置，见 Config.ResponseFromMetadata
+	headerNamespace string
+	//输出消息元数据设置的状态码，在写入响应体之前提交
+	pendingStatus int
+	//是否已经写入响应头
+	written bool
+	//同步路由响应的内容协商，没有开启为nil
+	negotiation *negotiation
 }
 
 func (r *ResponseMessage) Body() []byte {
@@ -220,6 +274,7 @@ func (r *ResponseMessage) SetMsg(msg *types.RuleMsg) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.msg = msg
+	r.applyMetadataResponse(msg)
 }
 func (r *ResponseMessage) GetMsg() *types.RuleMsg {
 	r.mu.RLock()
@@ -227,11 +282,33 @@ func (r *ResponseMessage) GetMsg() *types.RuleMsg {
 	return r.msg
 }
 
+// SetStatusCode 设置响应状态码，如果已经发送过保活字节，状态码已经提交为200，忽略该设置
 func (r *ResponseMessage) SetStatusCode(statusCode int) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if r.response != nil {
+	//显式设置的状态码优先
+	r.pendingStatus = 0
+	r.setStatusCode(statusCode)
+}
+
+// setStatusCode 设置响应状态码，调用方需要持有锁
+func (r *ResponseMessage) setStatusCode(statusCode int) {
+	started := r.keepAliveStarted()
+	if r.keepAlive != nil {
+		r.keepAlive.stop()
+	}
+	if r.errorResponse != nil && r.err != nil {
+		return
+	}
+	if r.compressor != nil && !started && !r.compressor.committed {
+		//延迟到写入响应体时提交
+		r.compressor.status = statusCode
+		return
+	}
+	if r.response != nil && !started {
+		r.applyConnectionHeader()
 		r.response.WriteHeader(statusCode)
+		r.written = true
 	}
 }
 
@@ -239,8 +316,36 @@ func (r *ResponseMessage) SetBody(body []byte) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.body = body
-	if r.response != nil {
+	if r.keepAlive != nil {
+		r.keepAlive.stop()
+	}
+	if r.errorResponse != nil && r.err != nil {
+		return
+	}
+	if negotiated, ok := r.negotiate(body); ok {
+		body = negotiated
+	} else {
+		r.pendingStatus = 0
+		r.setStatusCode(http.StatusNotAcceptable)
+		body = []byte(http.StatusText(http.StatusNotAcceptable))
+	}
+	r.body = body
+	r.commitPendingStatus()
+	if r.response != nil && r.compressor != nil {
+		if !r.compressor.committed {
+			r.applyConnectionHeader()
+			if r.keepAliveStarted() {
+				//保活字节已经提交了响应头，不再压缩
+				r.compressor.committed = true
+			} else {
+				r.compressor.commit(r.response, r.request, body)
+			}
+		}
+		r.compressor.write(r.response, body)
+	} else if r.response != nil {
+		r.applyConnectionHeader()
 		_, _ = r.response.Write(body)
+		r.written = true
 	}
 }
 
@@ -265,15 +370,160 @@ func (r *ResponseMessage) Response() http.ResponseWriter {
 
 // Config Rest 服务配置
 type Config struct {
-	Server      string `json:"server"`      //服务器地址
+	Server      string `json:"server"`      //服务器地址，unix domain socket使用 unix:///var/run/rulego.sock 格式
 	CertFile    string `json:"certFile"`    //证书文件
 	CertKeyFile string `json:"certKeyFile"` //证书私钥文件
-	//是否允许跨域
-	AllowCors        bool
+	// HttpServer 同时提供纯HTTP服务的地址，例如：:80，和 Server 共享路由，Server 配置TLS时用于同时提供HTTP和HTTPS服务，为空不监听
+	HttpServer string `json:"httpServer"`
+	// RedirectToHTTPS HttpServer 的请求是否301重定向到 Server 的HTTPS服务，需要 Server 配置TLS
+	RedirectToHTTPS bool `json:"redirectToHTTPS"`
+	// CAFile 校验客户端证书的CA证书文件，TLS没有配置ca时使用
+	CAFile string `json:"caFile"`
+	// ClientAuthType 客户端证书校验方式：none、request、requireAny、verifyIfGiven、requireAndVerify
+	// 为空时配置了ca使用requireAndVerify，否则不校验。校验失败的连接在TLS握手时拒绝
+	// 校验通过的客户端证书CN和SAN写入元数据 clientCertCN、clientCertSAN
+	ClientAuthType string `json:"clientAuthType"`
+	// TLS 配置，证书支持文件路径或者PEM内容，没有配置的证书使用 CertFile、CertKeyFile、CAFile
+	// 配置了ca则校验客户端证书
+	TLS types.TLSConfig `json:"tls"`
+	//是否允许跨域，没有配置 AllowedOrigins 等跨域策略时允许所有来源(*)
+	AllowCors bool
+	// AllowedOrigins 开启跨域后允许的来源，支持通配符，例如：https://*.example.com，为空允许所有来源
+	// 只对匹配的来源回显 Access-Control-Allow-Origin，不允许的来源的预检请求响应403
+	AllowedOrigins []string `json:"allowedOrigins"`
+	// AllowedMethods 预检请求允许的方法，为空允许所有方法(*)
+	AllowedMethods []string `json:"allowedMethods"`
+	// AllowedHeaders 预检请求允许的请求头，为空允许所有请求头(*)
+	AllowedHeaders []string `json:"allowedHeaders"`
+	// AllowCredentials 是否允许携带凭证，开启后回显请求来源，不使用*
+	AllowCredentials bool `json:"allowCredentials"`
 	ReadTimeout      int  `json:"readTimeout"`      // 读取超时时间（秒），0使用默认值10秒
 	WriteTimeout     int  `json:"writeTimeout"`     // 写入超时时间（秒），0使用默认值10秒
 	IdleTimeout      int  `json:"idleTimeout"`      // 空闲超时时间（秒），0使用默认值60秒
-	DisableKeepalive bool `json:"disableKeepalive"` //  禁用keepalive
+	DisableKeepalive bool `json:"disableKeepalive"` //  禁用keepalive，只需要对某些路由关闭连接，使用路由from配置connection，见 ConnectionConfig
+	// TokenQueryParam 设置了令牌校验器后，如果请求头没有 Authorization: Bearer <token>，则从该url参数读取令牌，默认access_token
+	TokenQueryParam string `json:"tokenQueryParam"`
+	// KeepAliveInterval 同步路由(To.Wait)等待规则链处理结果期间，发送保活字节的间隔（秒），防止负载均衡器空闲超时断开连接，0不发送
+	// 发送保活字节后响应头和200状态码已经提交，之后设置的状态码和响应头不再生效
+	KeepAliveInterval int `json:"keepAliveInterval"`
+	// KeepAliveFormat 保活字节格式：space（发送空格，默认）或者 sse（发送SSE注释 ": keep-alive"）
+	// 如果响应头Content-Type不允许插入保活字节，例如二进制响应，则不发送
+	KeepAliveFormat string `json:"keepAliveFormat"`
+	// ErrorResponse 同步路由以错误结束或者发生panic时的响应，为空则保持原有行为
+	// 可以在路由from配置中通过errorResponse覆盖
+	ErrorResponse *ErrorResponse `json:"errorResponse"`
+	// ReplyUrlHeader 回调地址请求头，配置后把该请求头的值作为消息来源回调地址写入元数据 originReplyUrl，replyTo节点把回复POST到该地址
+	// 回调地址由客户端提供，只在可信的客户端中开启，为空不读取
+	ReplyUrlHeader string `json:"replyUrlHeader"`
+	// HealthCheck 是否开启存活检查 /healthz 和就绪检查 /readyz，健康状态来自 types.Config.HealthRegistry
+	// 存活检查要求服务已经启动，就绪检查还要求所有路由可用
+	HealthCheck bool `json:"healthCheck"`
+	// HealthCheckPath 存活检查路径，配置后开启健康检查，默认 /healthz
+	HealthCheckPath string `json:"healthCheckPath"`
+	// ReadinessPath 就绪检查路径，配置后开启健康检查，默认 /readyz
+	ReadinessPath string `json:"readinessPath"`
+	// ReadinessCheckChains 就绪检查是否检查路由To端的规则链已经加载，路径包含变量的路由不检查
+	ReadinessCheckChains bool `json:"readinessCheckChains"`
+	// MaxRequestBodySize 请求体最大字节数，0不限制
+	// 超过限制响应413，不执行路由处理，拦截器可以通过 exchange.In.GetError() 为 ErrRequestBodyTooLarge 观察到该请求
+	MaxRequestBodySize int64 `json:"maxRequestBodySize"`
+	// EnableCompression 是否开启响应压缩，客户端 Accept-Encoding 支持gzip或者deflate时压缩响应体
+	// 开启后 SetStatusCode 延迟到写入响应体时提交，已经压缩的响应类型和静态文件不压缩
+	EnableCompression bool `json:"enableCompression"`
+	// CompressionMinSize 压缩的最小响应体字节数，0使用默认值1024
+	CompressionMinSize int `json:"compressionMinSize"`
+	// Auth 路由认证配置，支持basic和bearer，为空不认证
+	// 认证通过的用户写入元数据 authUser，共享同一个服务的多个端点使用各自的认证配置
+	Auth *AuthConfig `json:"auth"`
+	// MaxQPS 端点所有路由每秒允许的请求数，0不限制，超过限制响应429和 Retry-After 响应头，不执行路由处理
+	// 共享同一个服务的多个端点使用服务的限额，路由可以在from配置rateLimit单独限流，见 RateLimitConfig
+	MaxQPS float64 `json:"maxQPS"`
+	// RateLimitBurst 允许的突发请求数，0使用 MaxQPS 向上取整
+	RateLimitBurst int `json:"rateLimitBurst"`
+	// RateLimitKeyBy 限流的key：为空所有请求共享一个限额，ip按客户端IP，其他值按同名的路径参数或者url参数
+	RateLimitKeyBy string `json:"rateLimitKeyBy"`
+	// AllowedIPs 允许访问的客户端IP，CIDR格式，支持IPv6，例如：192.168.1.0/24、fd00::/8，为空允许所有IP
+	AllowedIPs []string `json:"allowedIPs"`
+	// DeniedIPs 拒绝访问的客户端IP，CIDR格式，优先于 AllowedIPs。被拒绝的请求响应403，并触发 EventIPRejected 事件
+	DeniedIPs []string `json:"deniedIPs"`
+	// TrustProxyHeaders 是否从 X-Forwarded-For、X-Real-IP 请求头获取客户端IP，只在端点部署在可信的反向代理之后时开启
+	TrustProxyHeaders bool `json:"trustProxyHeaders"`
+	// TrustedProxies 可信的代理地址，CIDR格式，例如：10.0.0.0/8。配置后只有直接连接的对端在该列表中时才读取代理请求头，
+	// X-Forwarded-For 从右往左跳过可信代理，取第一个不可信的地址作为客户端IP，不需要再开启 TrustProxyHeaders
+	TrustedProxies []string `json:"trustedProxies"`
+	// ProxyProtocol 是否解析连接开头的PROXY协议头（v1和v2），用于四层负载均衡之后获取客户端地址
+	// 配置了 TrustedProxies 时只解析来自可信代理的连接，其他连接按普通连接处理
+	ProxyProtocol bool `json:"proxyProtocol"`
+	// SocketFileMode unix domain socket文件的权限，八进制，例如：0660，为空使用系统默认权限
+	SocketFileMode string `json:"socketFileMode"`
+	// ShutdownTimeout 关闭或者重启服务时等待正在处理的请求完成的时间（秒），0使用默认值2秒
+	// 等待期间新的请求响应503，超时后强制关闭连接
+	ShutdownTimeout int `json:"shutdownTimeout"`
+	// AccessLog 是否开启路由的访问日志，默认通过 RuleConfig.Logger 输出，可以通过 SetAccessLogFunc 自定义
+	AccessLog bool `json:"accessLog"`
+	// DefaultRequestTimeout 路由请求处理超时时间（毫秒），0不限制，可以在路由from配置requestTimeout覆盖
+	// 超时后取消传给规则链的上下文，同步路由响应504，异步路由只取消上下文
+	DefaultRequestTimeout int `json:"defaultRequestTimeout"`
+	// RequestIdHeader 请求ID的请求头，为空使用X-Request-Id，请求携带则复用，否则生成，
+	// 请求ID放到msg元数据 KeyRequestId、规则链上下文 endpoint.RequestIdFromContext 和响应头中，并作为消息ID
+	RequestIdHeader string `json:"requestIdHeader"`
+	// BinaryContentTypes 创建BINARY消息的请求内容类型，请求体不转换成字符串，为空使用 DefaultBinaryContentTypes，
+	// 路由可以在from配置 KeyDataType 指定消息数据类型
+	BinaryContentTypes []string `json:"binaryContentTypes"`
+	// BasePath 所有路由和静态文件的路径前缀，例如：/api/rulego，部署在反向代理的路径下时使用，
+	// 路由定义和路由id不包含前缀，健康检查和指标路由不加前缀
+	BasePath string `json:"basePath"`
+	// ContentNegotiation 同步路由是否根据Accept请求头协商响应内容类型，只转换JSON消息负荷，
+	// 默认支持：application/json、application/xml、text/plain，可以通过 RegisterResponseMarshaler 注册，
+	// 路由可以在from配置 KeyResponseContentType 指定响应内容类型
+	ContentNegotiation bool `json:"contentNegotiation"`
+	// StrictAccept 内容协商没有可以接受的内容类型时响应406，否则使用JSON
+	StrictAccept bool `json:"strictAccept"`
+	// CookieMetadataPrefix 请求cookie放到msg元数据的key前缀，为空使用 DefaultCookieMetadataPrefix
+	CookieMetadataPrefix string `json:"cookieMetadataPrefix"`
+	// DisableCookieMetadata 不把请求cookie放到msg元数据中
+	DisableCookieMetadata bool `json:"disableCookieMetadata"`
+	// DisableFormMetadata 不把 application/x-www-form-urlencoded 请求体的表单字段放到msg元数据中
+	DisableFormMetadata bool `json:"disableFormMetadata"`
+	// FormToJson 表单请求的消息负荷转换成JSON对象，所有字段值都使用数组，例如：{"tag":["a","b"]}，默认使用原始请求体的TEXT
+	FormToJson bool `json:"formToJson"`
+	// ResponseFromMetadata 同步路由是否使用输出消息的元数据设置响应，
+	// ResponseHeaderNamespace 命名空间下的元数据设置为响应头，元数据 KeyResponseStatus 设置状态码，纯DSL的规则链也可以控制http响应
+	ResponseFromMetadata bool `json:"responseFromMetadata"`
+	// ResponseHeaderNamespace 设置为响应头的元数据命名空间，为空使用 DefaultResponseHeaderNamespace，例如：httpHeader.Location
+	ResponseHeaderNamespace string `json:"responseHeaderNamespace"`
+	// EnableHTTP2 是否开启HTTP/2，TLS通过ALPN协商h2，没有配置TLS时支持h2c。协商的协议放到元数据 ProtocolKey 中
+	EnableHTTP2 bool `json:"enableHTTP2"`
+	// MaxHeaderBytes 请求头的最大字节数，0使用http.DefaultMaxHeaderBytes（1MB）
+	MaxHeaderBytes int `json:"maxHeaderBytes"`
+	// TLSMinVersion TLS最低版本：1.0、1.1、1.2、1.3，覆盖 TLS.MinVersion，为空使用crypto/tls的默认值
+	TLSMinVersion string `json:"tlsMinVersion"`
+	// TLSCipherSuites TLS 1.2及以下版本允许的加密套件名称，例如：TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256，只允许安全的加密套件，为空使用默认值
+	TLSCipherSuites []string `json:"tlsCipherSuites"`
+	// Metrics 是否统计请求数、正在处理的请求数、延迟和错误数等指标，通过 Rest.Metrics 获取
+	Metrics bool `json:"metrics"`
+	// MetricsPath 以Prometheus文本格式输出指标的路由路径，例如：/metrics，配置后开启指标统计，该路由不经过认证
+	MetricsPath string `json:"metricsPath"`
+	// OpenAPIPath 输出OpenAPI 3文档的路由路径，例如：/openapi.json，文档由当前注册的路由生成，该路由不经过认证
+	OpenAPIPath string `json:"openapiPath"`
+	// OpenAPITitle OpenAPI文档的标题，为空使用 DefaultOpenAPITitle
+	OpenAPITitle string `json:"openapiTitle"`
+	// OpenAPIVersion OpenAPI文档描述的接口版本，为空使用 DefaultOpenAPIVersion
+	OpenAPIVersion string `json:"openapiVersion"`
+	// PingInterval websocket端点向客户端发送ping的间隔（秒），0不发送
+	PingInterval int `json:"pingInterval"`
+	// PongTimeout websocket端点发送ping后等待pong的时间（秒），超时断开连接，0使用 PingInterval，只在配置了 PingInterval 时生效
+	PongTimeout int `json:"pongTimeout"`
+	// MaxIdleTime websocket连接没有收到数据帧的最长时间（秒），超时断开连接，ping/pong不计入，0不限制
+	MaxIdleTime int `json:"maxIdleTime"`
+	// ConnectRouterId websocket连接建立时接收连接消息的路由id，该路由需要已经注册到websocket端点，为空不发送
+	// 消息类型为CONNECT，元数据包括连接的路径参数、url参数和sessionId，路由的响应发送给该连接
+	ConnectRouterId string `json:"connectRouterId"`
+	// DisconnectRouterId websocket连接断开时接收断开消息的路由id，该路由需要已经注册到websocket端点，为空不发送
+	// 消息类型为DISCONNECT，元数据包括连接的路径参数、url参数、sessionId、断开原因disconnectReason和连接时长connectionDuration（毫秒）
+	DisconnectRouterId string `json:"disconnectRouterId"`
+	// BroadcastQueueSize websocket连接广播消息的发送队列长度，队列满时丢弃发送给该连接的广播消息，避免慢连接阻塞其他连接，0使用默认值64
+	BroadcastQueueSize int `json:"broadcastQueueSize"`
 }
 
 // Rest 接收端端点
@@ -284,9 +534,54 @@ type Rest struct {
 	Config     Config
 	RuleConfig types.Config
 	Server     *http.Server
+	//纯HTTP服务，见 Config.HttpServer，没有配置为nil
+	httpServer *http.Server
+	//服务的任一监听异常结束，Started 返回false，启动时重置
+	serveFailed int32
 	//http路由器
 	router  *httprouter.Router
 	started bool
+	//跨域策略，AllowCors 开启时初始化
+	cors *corsPolicy
+	//认证器，Config.Auth 为空时为nil
+	auth *authenticator
+	//没有匹配路由和方法不匹配时的处理器，重新创建路由器后恢复
+	notFoundHandler         http.Handler
+	methodNotAllowedHandler http.Handler
+	//默认路由的处理器，见 SetFallbackRouter
+	fallbackHandler http.Handler
+	//OPTIONS请求的处理器，见 GlobalOPTIONS
+	optionsHandler http.Handler
+	//访问日志处理函数，见 SetAccessLogFunc
+	accessLogFunc AccessLogFunc
+	accessLogMu   sync.RWMutex
+	//服务是否正在关闭，关闭期间新的请求响应503
+	draining int32
+	//路由使用的认证器，重启时按路由恢复
+	routerAuths map[string]*authenticator
+	//已经注册到httprouter的路由槽，key：RouterKey，重新创建路由器后清空
+	routeSlots map[string]*routeSlot
+	//端点的限流器，Config.MaxQPS 为0时为nil
+	limiter *rateLimiter
+	//客户端IP访问控制列表，没有配置时为nil
+	ipFilter *ipFilter
+	//可信的代理地址，见 Config.TrustedProxies
+	trustedProxies []*net.IPNet
+	//http服务的TLS版本和加密套件配置
+	tlsOptions serverTLSOptions
+	//创建BINARY消息的内容类型
+	binaryContentTypes map[string]struct{}
+	//响应内容类型的转换器，见 RegisterResponseMarshaler
+	marshalers *marshalerRegistry
+	//http服务的证书，支持不重启重新加载，没有开启TLS为nil
+	certReloader *types.CertReloader
+	//端点的指标，没有开启指标统计为nil，共享服务时使用服务实例的指标
+	metrics *metricsCollector
+	//websocket路由活跃的连接，连接id->*wsConnection，用于replyTo节点回复
+	wsConns sync.Map
+	//回复回调地址的客户端，见 Reply
+	replyClient     *http.Client
+	replyClientOnce sync.Once
 }
 
 // Type 组件类型
@@ -312,6 +607,43 @@ func (rest *Rest) Init(ruleConfig types.Config, configuration types.Configuratio
 		return err
 	}
 	rest.RuleConfig = ruleConfig
+	if rest.auth, err = newAuthenticator(rest.Config.Auth); err != nil {
+		return err
+	}
+	if rest.limiter, err = newRateLimiter(RateLimitConfig{
+		MaxQPS: rest.Config.MaxQPS,
+		Burst:  rest.Config.RateLimitBurst,
+		KeyBy:  rest.Config.RateLimitKeyBy,
+	}); err != nil {
+		return err
+	}
+	if rest.ipFilter, err = newIPFilter(rest.Config); err != nil {
+		return err
+	}
+	if rest.trustedProxies, err = parseCIDRs(rest.Config.TrustedProxies); err != nil {
+		return fmt.Errorf("trustedProxies error: %w", err)
+	}
+	if rest.tlsOptions, err = newServerTLSOptions(rest.Config); err != nil {
+		return err
+	}
+	if rest.Config.BasePath, err = normalizeBasePath(rest.Config.BasePath); err != nil {
+		return err
+	}
+	rest.binaryContentTypes = newBinaryContentTypes(rest.Config)
+	if rest.marshalers == nil {
+		rest.marshalers = newMarshalerRegistry()
+	}
+	if rest.metricsEnabled() && rest.metrics == nil {
+		rest.metrics = newMetricsCollector()
+	}
+	if err = rest.initUnixSocket(); err != nil {
+		return err
+	}
+	//跨域拦截器在初始化时注册，newRouter 可能在持有锁时被调用
+	if rest.Config.AllowCors && rest.cors == nil {
+		rest.cors = newCorsPolicy(rest.Config)
+		rest.AddInterceptors(rest.cors.interceptor)
+	}
 	return rest.SharedNode.Init(rest.RuleConfig, rest.Type(), rest.Config.Server, false, func() (*Rest, error) {
 		return rest.initServer()
 	})
@@ -319,14 +651,13 @@ func (rest *Rest) Init(ruleConfig types.Config, configuration types.Configuratio
 
 // Destroy 销毁
 func (rest *Rest) Destroy() {
+	rest.UnregisterOrigin()
 	_ = rest.Close()
 }
 
 func (rest *Rest) Restart() error {
 	if rest.Server != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-		_ = rest.Server.Shutdown(ctx)
+		_ = rest.shutdown()
 	}
 
 	if rest.SharedNode.InstanceId != "" {
@@ -340,11 +671,14 @@ func (rest *Rest) Restart() error {
 		rest.newRouter()
 	}
 	var oldRouter = make(map[string]endpoint.Router)
+	var oldAuths = make(map[string]*authenticator)
 
 	rest.Lock()
+	previous := rest.RouterStorage
 	for id, router := range rest.RouterStorage {
 		if !router.IsDisable() {
 			oldRouter[id] = router
+			oldAuths[id] = rest.routerAuths[id]
 		}
 	}
 	rest.Unlock()
@@ -353,6 +687,10 @@ func (rest *Rest) Restart() error {
 	rest.started = false
 
 	if err := rest.Start(); err != nil {
+		//启动失败不添加路由，保留原路由用于下次重启
+		rest.Lock()
+		rest.RouterStorage = previous
+		rest.Unlock()
 		return err
 	}
 	for _, router := range oldRouter {
@@ -360,7 +698,8 @@ func (rest *Rest) Restart() error {
 			router.SetParams("GET")
 		}
 		if !rest.HasRouter(router.GetId()) {
-			if _, err := rest.AddRouter(router, router.GetParams()...); err != nil {
+			method := strings.ToUpper(str.ToString(router.GetParams()[0]))
+			if err := rest.addRouterWithAuth(method, oldAuths[router.GetId()], router); err != nil {
 				rest.Printf("rest add router path:=%s error:%v", router.FromToString(), err)
 				continue
 			}
@@ -372,11 +711,13 @@ func (rest *Rest) Restart() error {
 
 func (rest *Rest) Close() error {
 	if rest.Server != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-		if err := rest.Server.Shutdown(ctx); err != nil {
+		if err := rest.shutdown(); err != nil {
 			return err
 		}
+		//清理unix domain socket文件
+		if path, ok := unixSocketPath(rest.Server.Addr); ok {
+			_ = removeSocketFile(path)
+		}
 	}
 	if rest.router != nil {
 		rest.newRouter()
@@ -408,23 +749,21 @@ func (rest *Rest) AddRouter(router endpoint.Router, params ...interface{}) (id s
 	} else if router == nil {
 		return "", errors.New("router can not nil")
 	} else {
-		defer func() {
-			if e := recover(); e != nil {
-				err = fmt.Errorf("addRouter err :%v", e)
-			}
-		}()
-		err2 := rest.addRouter(strings.ToUpper(str.ToString(params[0])), router)
-		return router.GetId(), err2
+		err = rest.addRouter(strings.ToUpper(str.ToString(params[0])), router)
+		return router.GetId(), err
 	}
 }
 
+// RemoveRouter 删除路由，路径不再分发到该路由，之后的请求由NotFound处理器响应，重新添加相同路径的路由不需要重启
+// params包含 RemoveRouterPurge 时同时从 RouterStorage 释放路由，否则保留已禁用的路由
 func (rest *Rest) RemoveRouter(routerId string, params ...interface{}) error {
 	routerId = strings.TrimSpace(routerId)
+	purge := isPurge(params)
 	rest.Lock()
 	defer rest.Unlock()
 	if rest.RouterStorage != nil {
-		if router, ok := rest.RouterStorage[routerId]; ok && !router.IsDisable() {
-			router.Disable(true)
+		if router, ok := rest.RouterStorage[routerId]; ok && (purge || !router.IsDisable()) {
+			rest.removeRouter(routerId, purge)
 			return nil
 		} else {
 			return fmt.Errorf("router: %s not found", routerId)
@@ -440,12 +779,14 @@ func (rest *Rest) deleteRouter(routerId string) {
 	if rest.RouterStorage != nil {
 		delete(rest.RouterStorage, routerId)
 	}
+	delete(rest.routerAuths, routerId)
 }
 
 func (rest *Rest) Start() error {
 	if err := rest.checkIsInitSharedNode(); err != nil {
 		return err
 	}
+	rest.RegisterOrigin(rest)
 	if netResource, err := rest.SharedNode.Get(); err == nil {
 		return netResource.startServer()
 	} else {
@@ -454,15 +795,27 @@ func (rest *Rest) Start() error {
 }
 
 func (rest *Rest) Listen() (net.Listener, error) {
+	if path, ok := unixSocketPath(rest.Server.Addr); ok {
+		return rest.listenUnix(path)
+	}
 	addr := rest.Server.Addr
 	if addr == "" {
-		if rest.Config.CertKeyFile != "" && rest.Config.CertFile != "" {
+		if rest.tlsConfig().HasCert() {
 			addr = ":https"
 		} else {
 			addr = ":http"
 		}
 	}
-	return net.Listen("tcp", addr)
+	return rest.listenTCP(addr)
+}
+
+// listenTCP 监听tcp地址，开启 Config.ProxyProtocol 时解析PROXY协议头
+func (rest *Rest) listenTCP(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil || !rest.Config.ProxyProtocol {
+		return ln, err
+	}
+	return &proxyListener{Listener: ln, trusted: rest.trustedProxies}, nil
 }
 
 // addRouter 注册1个或者多个路由
@@ -470,6 +823,16 @@ func (rest *Rest) Listen() (net.Listener, error) {
 // For GET, POST, PUT, PATCH and DELETE requests the respective shortcut
 // functions can be used.
 func (rest *Rest) addRouter(method string, routers ...endpoint.Router) error {
+	return rest.addRouterWithAuth(method, rest.auth, routers...)
+}
+
+// addRouterWithAuth 使用指定的认证器注册路由，共享服务时使用注册路由的端点的认证器
+func (rest *Rest) addRouterWithAuth(method string, auth *authenticator, routers ...endpoint.Router) error {
+	return rest.registerRouters(method, auth, false, routers...)
+}
+
+// registerRouters 注册路由，replace为true时替换相同方法和路径的已注册路由
+func (rest *Rest) registerRouters(method string, auth *authenticator, replace bool, routers ...endpoint.Router) error {
 	method = strings.ToUpper(method)
 
 	rest.Lock()
@@ -478,35 +841,90 @@ func (rest *Rest) addRouter(method string, routers ...endpoint.Router) error {
 	if rest.RouterStorage == nil {
 		rest.RouterStorage = make(map[string]endpoint.Router)
 	}
+	if rest.routerAuths == nil {
+		rest.routerAuths = make(map[string]*authenticator)
+	}
 	for _, item := range routers {
-		path := strings.TrimSpace(item.FromToString())
+		host, path := routerHostPath(item)
 		if id := item.GetId(); id == "" {
-			item.SetId(rest.RouterKey(method, path))
+			//路由id包含Host，不同Host的相同路径不冲突
+			item.SetId(rest.RouterKey(method, host+path))
 		}
-		//存储路由
 		item.SetParams(method)
-		rest.RouterStorage[item.GetId()] = item
 		if rest.SharedNode.InstanceId != "" {
-			if shared, err := rest.SharedNode.Get(); err == nil {
-				return shared.addRouter(method, item)
-			} else {
+			if shared, err := rest.SharedNode.Get(); err != nil {
+				return err
+			} else if err := shared.registerRouters(method, auth, replace, item); err != nil {
 				return err
 			}
 		} else {
 			if rest.router == nil {
 				rest.newRouter()
 			}
+			// 转换路径参数格式：将 {id} 格式转换为 :id 格式
+			path = rest.convertPathParams(path)
+			//共享服务的多个规则链注册了相同的路径
+			if !replace {
+				if err := rest.checkConflict(method, host, path, item); err != nil {
+					return err
+				}
+			}
 			isWait := false
 			if from := item.GetFrom(); from != nil {
 				if to := from.GetTo(); to != nil {
 					isWait = to.IsWait()
 				}
 			}
-			// 转换路径参数格式：将 {id} 格式转换为 :id 格式
-			path = rest.convertPathParams(path)
-			rest.router.Handle(method, path, rest.handler(item, isWait))
+			errorResponse, err := rest.routerErrorResponse(item)
+			if err != nil {
+				return err
+			}
+			connection, err := rest.routerConnection(item)
+			if err != nil {
+				return err
+			}
+			limiter, err := rest.routerRateLimit(item)
+			if err != nil {
+				return err
+			}
+			timeout, err := rest.routerTimeout(item)
+			if err != nil {
+				return err
+			}
+			dataType, err := rest.routerDataType(item)
+			if err != nil {
+				return err
+			}
+			//注册的路径加上路径前缀，路由id和冲突检查不包含前缀
+			if method == MethodWS {
+				if err := rest.handleRoute(method, http.MethodGet, host, path, item, rest.wsHandler(item, auth, limiter)); err != nil {
+					return err
+				}
+			} else if err := rest.handleRoute(method, method, host, path, item, rest.handler(item, isWait, errorResponse, connection, auth, limiter, timeout, dataType)); err != nil {
+				return err
+			}
+			if auth != nil {
+				rest.routerAuths[item.GetId()] = auth
+			} else {
+				delete(rest.routerAuths, item.GetId())
+			}
 		}
+		//注册成功后存储路由，移除被替换的路由
+		rest.removeReplaced(method, host, path, item)
+		rest.RouterStorage[item.GetId()] = item
+	}
+	return nil
+}
 
+// checkConflict 检查Host和路径是否已经被其他路由注册，已经删除的路由不冲突，调用方需要持有锁
+func (rest *Rest) checkConflict(method, host, path string, router endpoint.Router) error {
+	for id, item := range rest.RouterStorage {
+		if item == router || item.IsDisable() {
+			continue
+		}
+		if rest.sameRoute(item, method, host, path) {
+			return fmt.Errorf("router %s %s conflicts with registered router: %s, use UpdateRouter to replace it", method, host+path, id)
+		}
 	}
 	return nil
 }
@@ -546,8 +964,16 @@ func (rest *Rest) DELETE(routers ...endpoint.Router) endpoint.HttpEndpoint {
 	return rest
 }
 
+// GlobalOPTIONS 设置没有注册OPTIONS路由的OPTIONS请求的处理器，替换跨域预检处理，
+// 调用处理器之前已经设置Allow响应头为路径实际注册的方法，重启后保留，共享服务时设置到服务实例
 func (rest *Rest) GlobalOPTIONS(handler http.Handler) endpoint.HttpEndpoint {
-	rest.Router().GlobalOPTIONS = handler
+	if server, err := rest.serverInstance(); err != nil {
+		rest.Printf("set global options handler err :%v", err)
+	} else {
+		server.Lock()
+		defer server.Unlock()
+		server.optionsHandler = handler
+	}
 	return rest
 }
 
@@ -574,7 +1000,7 @@ func (rest *Rest) RegisterStaticFiles(resourceMapping string) endpoint.HttpEndpo
 						urlPath = basePath + "/*filepath"
 					}
 				}
-				rest.Router().ServeFiles(strings.TrimSpace(urlPath), http.Dir(strings.TrimSpace(localDir)))
+				rest.Router().ServeFiles(rest.fullPath(strings.TrimSpace(urlPath)), http.Dir(strings.TrimSpace(localDir)))
 			}
 		}
 	}
@@ -608,52 +1034,276 @@ func (rest *Rest) RouterKey(method string, from string) string {
 	return method + ":" + from
 }
 
-func (rest *Rest) handler(router endpoint.Router, isWait bool) httprouter.Handle {
+func (rest *Rest) handler(router endpoint.Router, isWait bool, errorResponse *ErrorResponse, connection *ConnectionConfig, auth *authenticator, limiter *rateLimiter, timeout time.Duration, dataType types.DataType) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		var exchange *endpoint.Exchange
+		var panicked bool
+		//访问日志和指标，在处理完成和捕捉异常之后记录
+		if rest.Config.AccessLog || rest.metrics != nil {
+			lw := &accessLogWriter{ResponseWriter: w, start: time.Now()}
+			w = lw
+			if rest.metrics != nil {
+				rest.metrics.begin()
+			}
+			defer func() {
+				if rest.metrics != nil {
+					rest.observeMetrics(router, lw, exchange, panicked)
+				}
+				if rest.Config.AccessLog {
+					rest.logAccess(router, r, lw, exchange)
+				}
+			}()
+		}
+		//请求ID，在写入响应头之前设置到响应头
+		requestId := rest.requestId(w, r)
+		//连接指令，需要在写入响应头之前设置Connection响应头
+		closeConn := shouldCloseConn(connection, r, countConnRequest(r))
+		if closeConn {
+			w.Header().Set(HeaderKeyConnection, HeaderValueClose)
+		}
+		//同步路由配置了错误响应或者超时时间，记录是否已经写入响应头
+		var rw *responseWriter
+		if isWait && (errorResponse != nil || timeout > 0) {
+			rw = &responseWriter{ResponseWriter: w}
+			w = rw
+		}
 		defer func() {
 			//捕捉异常
 			if e := recover(); e != nil {
+				if e == http.ErrAbortHandler {
+					panic(e)
+				}
+				panicked = true
 				rest.Printf("http endpoint handler err :\n%v", runtime.Stack())
+				if rw != nil && errorResponse != nil {
+					msgId := ""
+					if exchange != nil {
+						exchange.Out.(*ResponseMessage).stopKeepAlive()
+						if msg := exchange.In.GetMsg(); msg != nil {
+							msgId = msg.Id
+						}
+					}
+					writeErrorResponse(rw, r, errorResponse, ErrorCodeInternalError, fmt.Errorf("%v", e), msgId)
+				}
 			}
 		}()
 		if router.IsDisable() {
 			http.NotFound(w, r)
 			return
 		}
+		if rest.isDraining(w) {
+			return
+		}
+		//访问控制和限流在认证和读取请求体之前执行，共享服务时使用服务的配置
+		ip := rest.clientIP(r)
+		if rest.rejectIP(w, r, ip) || rateLimited(w, r, params, ip, rest.limiter, limiter) {
+			return
+		}
+		tokenParam := rest.tokenQueryParam()
+		principal, err := rest.Authenticate(BearerToken(r, tokenParam), TransportMeta("http", r))
+		if err != nil {
+			w.Header().Set(HeaderKeyWWWAuthenticate, "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		//在创建exchange之前读取并限制请求体大小
+		var body []byte
+		if limit := rest.Config.MaxRequestBodySize; limit > 0 && r.Body != nil {
+			if body, err = readBody(w, r, limit); err != nil {
+				rest.rejectBody(router, w, r, params, err)
+				return
+			}
+		}
 		metadata := types.NewMetadata()
-		exchange := &endpoint.Exchange{
+		exchange = &endpoint.Exchange{
 			In: &RequestMessage{
-				request:  r,
-				response: w,
-				Params:   params,
-				Metadata: metadata,
+				request:    r,
+				response:   w,
+				body:       body,
+				Params:     params,
+				Metadata:   metadata,
+				formToJson: rest.Config.FormToJson,
+				requestId:  requestId,
+				dataType:   dataType,
+				//共享服务时使用服务的配置
+				binaryContentTypes: rest.binaryContentTypes,
 			},
 			Out: &ResponseMessage{
-				request:  r,
-				response: w,
+				request:         r,
+				response:        w,
+				errorResponse:   errorResponse,
+				closeConn:       closeConn || r.Close || rest.Config.DisableKeepalive,
+				compressor:      newCompressor(rest.Config),
+				headerNamespace: rest.responseHeaderNamespace(isWait),
 			},
 		}
+		if isWait {
+			exchange.Out.(*ResponseMessage).negotiation = rest.newNegotiation(router, r)
+		}
 
 		//把路径参数放到msg元数据中
 		for _, param := range params {
 			metadata.PutValue(param.Key, param.Value)
 		}
 
-		//把url?参数放到msg元数据中
-		for key, value := range r.URL.Query() {
-			if len(value) > 1 {
-				metadata.PutValue(key, str.ToString(value))
-			} else {
-				metadata.PutValue(key, value[0])
+		//把url?参数放到msg元数据中，令牌不放到元数据中
+		skipKey := ""
+		if principal != nil || auth.isBearer() {
+			skipKey = tokenParam
+		}
+		putQueryMetadata(metadata, r.URL.Query(), skipKey)
+		rest.putFormMetadata(metadata, exchange.In.(*RequestMessage))
+		rest.putCookieMetadata(metadata, r)
+		metadata.PutValue(KeyRequestId, requestId)
+		metadata.PutValue(KeyRemoteIp, ip)
+		metadata.PutValue(KeyHost, normalizeHost(r.Host))
+		rest.putProtocol(metadata, r)
+		if principal != nil {
+			principal.PutToMetadata(metadata)
+		}
+		putClientCert(metadata, r)
+		origin := endpoint.Origin{Type: rest.Type(), Id: rest.OriginId()}
+		if rest.Config.ReplyUrlHeader != "" {
+			origin.ReplyUrl = r.Header.Get(rest.Config.ReplyUrlHeader)
+		}
+		origin.PutToMetadata(metadata)
+		//路由认证，在全局拦截器之前执行
+		if auth != nil {
+			if err := auth.authenticate(router, exchange, r, tokenParam); err != nil {
+				w.Header().Set(HeaderKeyWWWAuthenticate, auth.challenge())
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
 			}
-
 		}
 		var ctx = r.Context()
 		if !isWait {
 			//异步不能使用request context，否则后续执行会取消
 			ctx = context.Background()
+		} else {
+			//同步路由支持节点通过 endpoint.StreamerFromContext 流式响应
+			ctx = endpoint.WithStreamer(ctx, exchange.Out.(*ResponseMessage))
 		}
-		rest.DoProcess(ctx, router, exchange)
+		ctx = endpoint.WithRequestId(ctx, requestId)
+		if isWait && rest.Config.KeepAliveInterval > 0 {
+			//客户端断开时取消规则链上下文
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(ctx)
+			defer cancel()
+			out := exchange.Out.(*ResponseMessage)
+			out.startKeepAlive(time.Duration(rest.Config.KeepAliveInterval)*time.Second, rest.Config.KeepAliveFormat, cancel)
+			defer out.stopKeepAlive()
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = withRequestTimeout(ctx, timeout, isWait)
+			defer cancel()
+		}
+		if isWait && timeout > 0 {
+			if !rest.processWithTimeout(ctx, router, exchange, rw, errorResponse) {
+				return
+			}
+		} else {
+			rest.DoProcess(ctx, router, exchange)
+		}
+		if exchange.IsAborted() {
+			//拦截器短路，提交拦截器设置的状态码和响应体，不写入错误响应
+			out := exchange.Out.(*ResponseMessage)
+			out.stopKeepAlive()
+			out.finishCompression()
+			return
+		}
+		if rw != nil && errorResponse != nil {
+			out := exchange.Out.(*ResponseMessage)
+			out.stopKeepAlive()
+			if err := out.GetError(); err != nil {
+				msgId := ""
+				if msg := exchange.In.GetMsg(); msg != nil {
+					msgId = msg.Id
+				}
+				writeErrorResponse(rw, r, errorResponse, ErrorCodeChainError, err, msgId)
+			}
+		}
+		if isWait {
+			exchange.Out.(*ResponseMessage).flushPendingStatus()
+		}
+		//流式响应保持请求直到调用Close或者客户端断开
+		exchange.Out.(*ResponseMessage).waitStream(r.Context())
+		exchange.Out.(*ResponseMessage).finishCompression()
+	}
+}
+
+// readBody 读取不超过limit字节的请求体，超过返回 ErrRequestBodyTooLarge
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	tooLarge := fmt.Errorf("%w: limit %d bytes", ErrRequestBodyTooLarge, limit)
+	if r.ContentLength > limit {
+		//不读取请求体，响应后关闭连接
+		w.Header().Set(HeaderKeyConnection, HeaderValueClose)
+		return nil, tooLarge
+	}
+	defer func() {
+		_ = r.Body.Close()
+	}()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		//MaxBytesReader 读满limit字节后还有数据则返回错误
+		if int64(len(body)) >= limit {
+			return nil, tooLarge
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+// rejectBody 拒绝请求体超过限制或者读取失败的请求，不执行路由处理，只执行拦截器用于观察
+func (rest *Rest) rejectBody(router endpoint.Router, w http.ResponseWriter, r *http.Request, params httprouter.Params, err error) {
+	exchange := &endpoint.Exchange{
+		In: &RequestMessage{
+			request:  r,
+			response: w,
+			body:     []byte{},
+			Params:   params,
+			Metadata: types.NewMetadata(),
+			err:      err,
+		},
+		Out: &ResponseMessage{
+			request:  r,
+			response: w,
+		},
+	}
+	rest.DoInterceptors(router, exchange)
+	if errors.Is(err, ErrRequestBodyTooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	} else {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// tokenQueryParam 读取令牌的url参数
+func (rest *Rest) tokenQueryParam() string {
+	if rest.Config.TokenQueryParam != "" {
+		return rest.Config.TokenQueryParam
+	}
+	return DefaultTokenQueryParam
+}
+
+// BearerToken 从请求头 Authorization: Bearer <token> 读取令牌，如果没有则从url参数queryParam读取
+func BearerToken(r *http.Request, queryParam string) string {
+	if auth := r.Header.Get(HeaderKeyAuthorization); len(auth) > len(bearerPrefix) && strings.EqualFold(auth[:len(bearerPrefix)], bearerPrefix) {
+		return strings.TrimSpace(auth[len(bearerPrefix):])
+	}
+	if queryParam != "" {
+		return r.URL.Query().Get(queryParam)
+	}
+	return ""
+}
+
+// TransportMeta 生成令牌校验器使用的传输层信息
+func TransportMeta(transport string, r *http.Request) map[string]string {
+	return map[string]string{
+		endpoint.TransportKey:           transport,
+		endpoint.TransportRemoteAddrKey: r.RemoteAddr,
+		endpoint.TransportPathKey:       r.URL.Path,
+		endpoint.TransportMethodKey:     r.Method,
 	}
 }
 
@@ -663,9 +1313,9 @@ func (rest *Rest) Printf(format string, v ...interface{}) {
 	}
 }
 
-// Started 返回服务是否已经启动
+// Started 返回服务是否已经启动，同时监听 Config.HttpServer 时所有监听都在运行才返回true
 func (rest *Rest) Started() bool {
-	return rest.started
+	return rest.started && atomic.LoadInt32(&rest.serveFailed) == 0
 }
 
 // GetServer 获取HTTP服务
@@ -681,24 +1331,25 @@ func (rest *Rest) GetServer() *http.Server {
 }
 func (rest *Rest) newRouter() *httprouter.Router {
 	rest.router = httprouter.New()
-	//设置跨域
-	if rest.Config.AllowCors {
-		rest.GlobalOPTIONS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Header.Get(HeaderKeyAccessControlRequestMethod) != "" {
-				// 设置 CORS 相关的响应头
-				header := w.Header()
-				header.Set(HeaderKeyAccessControlAllowMethods, HeaderValueAll)
-				header.Set(HeaderKeyAccessControlAllowHeaders, HeaderValueAll)
-				header.Set(HeaderKeyAccessControlAllowOrigin, HeaderValueAll)
-			}
-			// 返回 204 状态码
-			w.WriteHeader(http.StatusNoContent)
-		}))
-		rest.AddInterceptors(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
-			exchange.Out.Headers().Set(HeaderKeyAccessControlAllowOrigin, HeaderValueAll)
-			return true
-		})
+	rest.routeSlots = nil
+	//OPTIONS请求响应路径实际注册的方法，开启跨域时处理预检请求
+	rest.router.GlobalOPTIONS = http.HandlerFunc(rest.serveOptions)
+	if rest.healthCheckEnabled() {
+		if err := rest.addHealthRouters(); err != nil {
+			rest.Printf("add health routers error:%v", err)
+		}
+	}
+	if rest.Config.MetricsPath != "" && rest.metrics != nil {
+		if err := Handle(rest.router, http.MethodGet, rest.Config.MetricsPath, rest.metricsHandler); err != nil {
+			rest.Printf("add metrics router error:%v", err)
+		}
 	}
+	if rest.Config.OpenAPIPath != "" {
+		if err := Handle(rest.router, http.MethodGet, rest.Config.OpenAPIPath, rest.openAPIHandler); err != nil {
+			rest.Printf("add openapi router error:%v", err)
+		}
+	}
+	rest.applyFallbackHandlers()
 	return rest.router
 }
 func (rest *Rest) initServer() (*Rest, error) {
@@ -708,6 +1359,11 @@ func (rest *Rest) initServer() (*Rest, error) {
 	return rest, nil
 }
 
+// tlsConfig 获取TLS配置，兼容 CertFile、CertKeyFile 配置
+func (rest *Rest) tlsConfig() types.TLSConfig {
+	return rest.Config.TLS.Fallback(rest.Config.CAFile, rest.Config.CertFile, rest.Config.CertKeyFile)
+}
+
 func (rest *Rest) startServer() error {
 	if rest.started {
 		return nil
@@ -716,8 +1372,26 @@ func (rest *Rest) startServer() error {
 
 	// 创建HTTP服务器并应用超时配置
 	rest.Server = &http.Server{
-		Addr:    rest.Config.Server,
-		Handler: rest.router,
+		Addr:           rest.Config.Server,
+		Handler:        rest.router,
+		MaxHeaderBytes: rest.Config.MaxHeaderBytes,
+	}
+	tlsConfig := rest.tlsConfig()
+	isTls := tlsConfig.HasCert()
+	if isTls {
+		if rest.Server.TLSConfig, err = tlsConfig.NewTLSConfig(); err != nil {
+			return err
+		}
+		if rest.Server.TLSConfig.ClientAuth, err = clientAuthType(rest.Config.ClientAuthType, tlsConfig.CA != ""); err != nil {
+			return err
+		}
+		rest.tlsOptions.apply(rest.Server.TLSConfig)
+		//新的握手从 certReloader 获取证书，支持不重启更新证书
+		if rest.certReloader, err = tlsConfig.NewCertReloader(rest.onCertReload); err != nil {
+			return err
+		}
+		rest.Server.TLSConfig.Certificates = nil
+		rest.Server.TLSConfig.GetCertificate = rest.certReloader.GetCertificate
 	}
 
 	// 应用读取超时配置
@@ -745,42 +1419,159 @@ func (rest *Rest) startServer() error {
 	if rest.Config.DisableKeepalive {
 		rest.Server.SetKeepAlivesEnabled(false)
 	}
+	// 统计每个连接的请求数，用于路由连接指令
+	rest.Server.ConnContext = withConnState
+	if err = rest.configureHTTP2(isTls); err != nil {
+		return err
+	}
+	if rest.httpServer, err = rest.newHttpServer(isTls); err != nil {
+		return err
+	}
 	ln, err := rest.Listen()
 	if err != nil {
 		return err
 	}
+	var httpLn net.Listener
+	if rest.httpServer != nil {
+		if httpLn, err = rest.listenTCP(rest.httpServer.Addr); err != nil {
+			_ = ln.Close()
+			return err
+		}
+	}
+	atomic.StoreInt32(&rest.draining, 0)
+	atomic.StoreInt32(&rest.serveFailed, 0)
+	ready := []<-chan error{rest.serve(rest.Server, ln, isTls)}
+	if httpLn != nil {
+		ready = append(ready, rest.serve(rest.httpServer, httpLn, false))
+	}
+	//等待服务开始接收连接，启动失败同步返回错误
+	if err = waitReady(startupTimeout, ready...); err != nil {
+		_ = rest.Server.Close()
+		if rest.httpServer != nil {
+			_ = rest.httpServer.Close()
+		}
+		return err
+	}
 	//标记已经启动
 	rest.started = true
 
-	isTls := rest.Config.CertKeyFile != "" && rest.Config.CertFile != ""
-	if rest.OnEvent != nil {
-		rest.OnEvent(endpoint.EventInitServer, rest)
-	}
 	if isTls {
 		rest.Printf("started rest server with TLS on %s", rest.Config.Server)
-		go func() {
-			defer ln.Close()
-			err = rest.Server.ServeTLS(ln, rest.Config.CertFile, rest.Config.CertKeyFile)
-			if rest.OnEvent != nil {
-				rest.OnEvent(endpoint.EventCompletedServer, err)
-			}
-		}()
 	} else {
 		rest.Printf("started rest server on %s", rest.Config.Server)
-		go func() {
-			defer ln.Close()
-			err = rest.Server.Serve(ln)
-			if rest.OnEvent != nil {
-				rest.OnEvent(endpoint.EventCompletedServer, err)
-			}
-		}()
+	}
+	if httpLn != nil {
+		rest.Printf("started rest server on %s", rest.httpServer.Addr)
+	}
+	if rest.OnEvent != nil {
+		rest.OnEvent(endpoint.EventInitServer, rest)
+	}
+	return nil
+}
+
+// serveCompleted 服务异常结束时触发 EventCompletedServer 事件，正常关闭由 shutdown 在等待请求完成后触发
+func (rest *Rest) serveCompleted(err error) {
+	if err == http.ErrServerClosed {
+		return
+	}
+	atomic.StoreInt32(&rest.serveFailed, 1)
+	if rest.OnEvent != nil {
+		rest.OnEvent(endpoint.EventCompletedServer, err)
+	}
+}
+
+// shutdown 停止接收新的请求，并在 ShutdownTimeout 内等待正在处理的请求完成，超时强制关闭连接
+// 等待结束后触发 EventCompletedServer 事件
+func (rest *Rest) shutdown() error {
+	atomic.StoreInt32(&rest.draining, 1)
+	timeout := 2 * time.Second
+	if rest.Config.ShutdownTimeout > 0 {
+		timeout = time.Duration(rest.Config.ShutdownTimeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	//纯HTTP服务和主服务同时关闭，共享等待时间
+	httpDone := make(chan struct{})
+	go func(server *http.Server) {
+		defer close(httpDone)
+		if server != nil && server.Shutdown(ctx) != nil {
+			_ = server.Close()
+		}
+	}(rest.httpServer)
+	err := rest.Server.Shutdown(ctx)
+	if err != nil {
+		//中断超时未完成的请求
+		_ = rest.Server.Close()
+	}
+	<-httpDone
+	if rest.OnEvent != nil {
+		if err != nil {
+			rest.OnEvent(endpoint.EventCompletedServer, err)
+		} else {
+			rest.OnEvent(endpoint.EventCompletedServer, http.ErrServerClosed)
+		}
 	}
 	return err
 }
 
+// isDraining 服务正在关闭时响应503，返回true
+func (rest *Rest) isDraining(w http.ResponseWriter) bool {
+	if atomic.LoadInt32(&rest.draining) == 0 {
+		return false
+	}
+	w.Header().Set(HeaderKeyConnection, HeaderValueClose)
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	return true
+}
+
+// pathParamsRegexp 匹配 {参数名} 格式的路径参数
+var pathParamsRegexp = regexp.MustCompile(`{([a-zA-Z_][a-zA-Z0-9_]*)}`)
+
 // convertPathParams 转换路径参数格式：将 {id}格式转换为 :id  格式
 func (rest *Rest) convertPathParams(path string) string {
-	// 使用正则表达式匹配 :参数名 格式并转换为 {参数名} 格式
-	re := regexp.MustCompile(`{([a-zA-Z_][a-zA-Z0-9_]*)}`)
-	return re.ReplaceAllString(path, ":$1")
+	return pathParamsRegexp.ReplaceAllString(path, ":$1")
+}
+
+// ValidatePath 校验httprouter的路径格式：必须以/开头，每段最多一个命名参数(:name或者*name)，
+// *name只能是最后一段
+func ValidatePath(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("path must begin with '/' in path '%s'", path)
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		index := strings.IndexAny(segment, ":*")
+		if index < 0 {
+			continue
+		}
+		if strings.ContainsAny(segment[index+1:], ":*") {
+			return fmt.Errorf("only one wildcard per path segment is allowed in path '%s'", path)
+		}
+		if index == len(segment)-1 {
+			return fmt.Errorf("wildcards must be named with a non-empty name in path '%s'", path)
+		}
+		if segment[index] == '*' && (index != 0 || i != len(segments)-1) {
+			return fmt.Errorf("catch-all routes are only allowed at the end of the path in path '%s'", path)
+		}
+	}
+	return nil
+}
+
+// Handle 校验路径并注册到httprouter，返回错误代替httprouter的panic
+// 与已注册路由的参数冲突只能由httprouter判断，recover该panic并保留原始错误
+func Handle(router *httprouter.Router, method, path string, handle httprouter.Handle) (err error) {
+	if err := ValidatePath(path); err != nil {
+		return err
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			if panicErr, ok := e.(error); ok {
+				err = fmt.Errorf("router %s %s: %w", method, path, panicErr)
+			} else {
+				err = fmt.Errorf("router %s %s: %v", method, path, e)
+			}
+		}
+	}()
+	router.Handle(method, path, handle)
+	return nil
 }
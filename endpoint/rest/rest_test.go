@@ -1,6 +1,8 @@
 package rest
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/api/types/endpoint"
@@ -10,9 +12,12 @@ import (
 	"github.com/rulego/rulego/test"
 	"github.com/rulego/rulego/test/assert"
 	"github.com/rulego/rulego/utils/maps"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -336,3 +341,197 @@ func startServer(t *testing.T, stop chan struct{}, wg *sync.WaitGroup) {
 	restEndpoint.Destroy()
 	wg.Done()
 }
+
+func TestRestTokenValidator(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9092"})
+	assert.Nil(t, err)
+	ep.SetTokenValidator(endpoint.TokenValidatorFunc(func(token string, transportMeta map[string]string) (endpoint.Principal, error) {
+		if token != "good" {
+			return endpoint.Principal{}, errors.New("invalid token")
+		}
+		assert.Equal(t, "http", transportMeta[endpoint.TransportKey])
+		return endpoint.Principal{Id: "u1", Tenant: "t1", Roles: []string{"admin", "dev"}}, nil
+	}))
+	var metadata *types.Metadata
+	router := impl.NewRouter().From("/api/auth").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		metadata = exchange.In.GetMsg().Metadata
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+
+	t.Run("MissingToken", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/auth", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "Bearer", w.Header().Get(HeaderKeyWWWAuthenticate))
+	})
+	t.Run("InvalidToken", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/auth", nil)
+		r.Header.Set(HeaderKeyAuthorization, "Bearer bad")
+		ep.Router().ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+	t.Run("Header", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/auth", nil)
+		r.Header.Set(HeaderKeyAuthorization, "Bearer good")
+		ep.Router().ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "u1", metadata.GetValue(endpoint.PrincipalIdKey))
+		assert.Equal(t, "t1", metadata.GetValue(endpoint.PrincipalTenantKey))
+		assert.Equal(t, "admin,dev", metadata.GetValue(endpoint.PrincipalRolesKey))
+	})
+	t.Run("QueryParam", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/auth?access_token=good&a=1", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "u1", metadata.GetValue(endpoint.PrincipalIdKey))
+		assert.Equal(t, "1", metadata.GetValue("a"))
+		assert.False(t, metadata.Has(DefaultTokenQueryParam))
+	})
+}
+
+func TestMaxRequestBodySize(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9092", "maxRequestBodySize": 8})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), ep.Config.MaxRequestBodySize)
+	var processed []string
+	var rejected []string
+	ep.AddInterceptors(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		if errors.Is(exchange.In.GetError(), ErrRequestBodyTooLarge) {
+			rejected = append(rejected, router.FromToString())
+		}
+		return true
+	})
+	router := impl.NewRouter().From("/api/upload").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		processed = append(processed, string(exchange.In.Body()))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+
+	post := func(body io.Reader) int {
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/upload", body))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, post(strings.NewReader("12345678")))
+	//Content-Length超过限制，不读取请求体
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(strings.NewReader("123456789")))
+	//未知长度的请求体，读取时超过限制
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(io.MultiReader(strings.NewReader("12345"), strings.NewReader("6789"))))
+	assert.Equal(t, http.StatusOK, post(io.MultiReader(strings.NewReader("123"))))
+	assert.Equal(t, []string{"12345678", "123"}, processed)
+	assert.Equal(t, []string{"/api/upload", "/api/upload"}, rejected)
+}
+
+// 重复的url参数在元数据中是JSON数组字符串，GET请求的消息负荷是JSON对象
+func TestQueryParams(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": testServer})
+	assert.Nil(t, err)
+	var msg types.RuleMsg
+	router := impl.NewRouter().From("/api/devices").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		msg = *exchange.In.GetMsg()
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	ep.Router().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/devices?tag=a&tag=b%22&id=1", nil))
+	assert.Equal(t, "1", msg.Metadata.GetValue("id"))
+	var tags []string
+	assert.Nil(t, json.Unmarshal([]byte(msg.Metadata.GetValue("tag")), &tags))
+	assert.Equal(t, []string{"a", `b"`}, tags)
+	assert.Equal(t, types.JSON, msg.DataType)
+	var data map[string][]string
+	assert.Nil(t, json.Unmarshal([]byte(msg.GetData()), &data))
+	assert.Equal(t, map[string][]string{"tag": {"a", `b"`}, "id": {"1"}}, data)
+}
+
+// 非法或者冲突的路径返回错误，不会panic
+func TestAddRouterInvalidPath(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": testServer})
+	assert.Nil(t, err)
+	for _, path := range []string{"", "api", "/api/:", "/api/*", "/api/:id:name", "/api/*all/info", "/api/x*all"} {
+		_, err = ep.AddRouter(impl.NewRouter().From(path).End(), "GET")
+		assert.NotNil(t, err)
+	}
+	_, err = ep.AddRouter(impl.NewRouter().From("/api/{id}/*all").End(), "GET")
+	assert.Nil(t, err)
+	//与已注册的参数冲突，由httprouter判断
+	_, err = ep.AddRouter(impl.NewRouter().From("/api/:name").End(), "GET")
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "router GET /api/:name:"))
+	//冲突的路由没有注册
+	assert.Equal(t, 1, len(ep.RouterStorage))
+}
+
+func TestRouterInterceptors(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9127"})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+	router := impl.NewRouter().From("/api/tenant").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte(exchange.In.GetMsg().Metadata.GetValue("tenant")))
+		return true
+	}).End()
+	router.AddInterceptor("auth", func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		if exchange.In.Headers().Get("X-Tenant") == "" {
+			exchange.Out.SetStatusCode(http.StatusForbidden)
+			return false
+		}
+		return true
+	}, 1).AddInterceptor("tenant", func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.In.GetMsg().Metadata.PutValue("tenant", exchange.In.Headers().Get("X-Tenant"))
+		return true
+	}, 2)
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	serve := func(tenant string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/tenant", nil)
+		if tenant != "" {
+			r.Header.Set("X-Tenant", tenant)
+		}
+		ep.Router().ServeHTTP(w, r)
+		return w
+	}
+	assert.Equal(t, http.StatusForbidden, serve("").Code)
+	assert.Equal(t, "t01", serve("t01").Body.String())
+
+	//重启后保留路由拦截器
+	assert.Nil(t, ep.Start())
+	time.Sleep(time.Millisecond * 200)
+	assert.Nil(t, ep.Restart())
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, http.StatusForbidden, serve("").Code)
+
+	//运行时删除
+	assert.True(t, router.RemoveInterceptor("auth"))
+	assert.Equal(t, http.StatusOK, serve("").Code)
+}
+
+// FuzzAddRouter 转换和注册任意路径不能panic
+func FuzzAddRouter(f *testing.F) {
+	for _, path := range []string{"/api/{id}", "/api/:id/{name}/*all", "/{a}{b}", "/:/{}/*", "{id}", "/api/" + strings.Repeat("{a}", 1000)} {
+		f.Add(path, path+"/x")
+	}
+	f.Fuzz(func(t *testing.T, path1, path2 string) {
+		var ep = &Endpoint{}
+		if err := ep.Init(types.NewConfig(), types.Configuration{"server": testServer}); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{path1, path2} {
+			if _, err := ep.AddRouter(impl.NewRouter().From(path).End(), "GET"); err == nil {
+				if _, hostPath := splitHost(path); ValidatePath(ep.convertPathParams(hostPath)) != nil {
+					t.Fatalf("invalid path registered: %s", path)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/utils/str"
+)
+
+// RemoveRouterPurge RemoveRouter 的参数，同时从 RouterStorage 释放路由
+const RemoveRouterPurge = "purge"
+
+// routeSlot 注册到httprouter的路径，请求通过路由槽分发到当前的处理函数
+// httprouter不支持重复注册和删除路径，更新路由时替换路由槽的处理函数，不需要重启服务
+// 相同路径的不同Host共用一个路由槽，见 KeyHost
+type routeSlot struct {
+	//Host->处理函数，空Host匹配所有Host，写入时复制
+	handles atomic.Value
+	//没有匹配Host时的处理器
+	notFound http.Handler
+}
+
+// routeHandle 路由和处理函数
+type routeHandle struct {
+	router endpoint.Router
+	handle httprouter.Handle
+}
+
+// serve 分发到Host相同的路由，没有或者已经删除则分发到没有配置Host的路由
+func (s *routeSlot) serve(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	handles, _ := s.handles.Load().(map[string]routeHandle)
+	item, ok := handles[normalizeHost(r.Host)]
+	if !ok || item.router.IsDisable() {
+		if fallback, hasFallback := handles[""]; hasFallback {
+			item, ok = fallback, true
+		}
+	}
+	if ok {
+		//已经删除的路由由处理函数响应404
+		item.handle(w, r, params)
+	} else if s.notFound != nil {
+		s.notFound.ServeHTTP(w, r)
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// set 设置Host的处理函数，调用方需要持有锁
+func (s *routeSlot) set(host string, router endpoint.Router, handle httprouter.Handle) {
+	old, _ := s.handles.Load().(map[string]routeHandle)
+	handles := make(map[string]routeHandle, len(old)+1)
+	for key, value := range old {
+		handles[key] = value
+	}
+	handles[host] = routeHandle{router: router, handle: handle}
+	s.handles.Store(handles)
+}
+
+// remove 删除Host的处理函数，已经被其他路由替换则忽略，调用方需要持有锁
+func (s *routeSlot) remove(host string, router endpoint.Router) {
+	old, _ := s.handles.Load().(map[string]routeHandle)
+	if item, ok := old[host]; !ok || item.router != router {
+		return
+	}
+	handles := make(map[string]routeHandle, len(old))
+	for key, value := range old {
+		if key != host {
+			handles[key] = value
+		}
+	}
+	s.handles.Store(handles)
+}
+
+// UpdateRouter 更新路由，params[0]为HTTP方法，没有指定使用路由的参数
+// 替换相同方法和路径的已注册路由，正在处理的请求不受影响，之后的请求分发到新的路由；没有已注册的路由则注册新的路由
+func (rest *Rest) UpdateRouter(router endpoint.Router, params ...interface{}) (string, error) {
+	if router == nil {
+		return "", errors.New("router can not nil")
+	}
+	if len(params) == 0 {
+		params = router.GetParams()
+	}
+	if len(params) == 0 {
+		return "", errors.New("need to specify HTTP method")
+	}
+	err := rest.registerRouters(strings.ToUpper(str.ToString(params[0])), rest.auth, true, router)
+	return router.GetId(), err
+}
+
+// handleRoute 注册路由的处理函数，路径已经注册则设置Host的处理函数，调用方需要持有锁
+// method为路由方法，例如：WS，httpMethod为注册到httprouter的方法
+func (rest *Rest) handleRoute(method, httpMethod, host, path string, router endpoint.Router, handle httprouter.Handle) error {
+	key := rest.RouterKey(method, path)
+	if slot, ok := rest.routeSlots[key]; ok {
+		slot.set(host, router, handle)
+		return nil
+	}
+	slot := &routeSlot{notFound: rest.router.NotFound}
+	slot.set(host, router, handle)
+	if err := Handle(rest.router, httpMethod, rest.withBasePath(path), slot.serve); err != nil {
+		return err
+	}
+	if rest.routeSlots == nil {
+		rest.routeSlots = make(map[string]*routeSlot)
+	}
+	rest.routeSlots[key] = slot
+	return nil
+}
+
+// sameRoute 路由是否注册了相同的方法、Host和路径，path为转换后的路径
+func (rest *Rest) sameRoute(item endpoint.Router, method, host, path string) bool {
+	params := item.GetParams()
+	if len(params) == 0 || str.ToString(params[0]) != method {
+		return false
+	}
+	itemHost, itemPath := routerHostPath(item)
+	return itemHost == host && rest.convertPathParams(itemPath) == path
+}
+
+// removeReplaced 删除被router替换的相同方法、Host和路径的其他路由，调用方需要持有锁
+func (rest *Rest) removeReplaced(method, host, path string, router endpoint.Router) {
+	path = rest.convertPathParams(path)
+	for id, item := range rest.RouterStorage {
+		if item == router || id == router.GetId() {
+			continue
+		}
+		if rest.sameRoute(item, method, host, path) {
+			delete(rest.RouterStorage, id)
+			delete(rest.routerAuths, id)
+		}
+	}
+}
+
+// removeRouter 禁用路由并从路由槽删除处理函数，purge为true时从 RouterStorage 释放路由
+// 共享服务时同时从服务实例删除，调用方需要持有锁
+func (rest *Rest) removeRouter(routerId string, purge bool) {
+	if router, ok := rest.RouterStorage[routerId]; ok {
+		router.Disable(true)
+		if params := router.GetParams(); len(params) > 0 {
+			host, path := routerHostPath(router)
+			key := rest.RouterKey(str.ToString(params[0]), rest.convertPathParams(path))
+			if slot, ok := rest.routeSlots[key]; ok {
+				slot.remove(host, router)
+			}
+		}
+		if purge {
+			delete(rest.RouterStorage, routerId)
+			delete(rest.routerAuths, routerId)
+		}
+	}
+	if rest.SharedNode.InstanceId != "" {
+		if shared, err := rest.SharedNode.Get(); err == nil && shared != rest {
+			shared.Lock()
+			shared.removeRouter(routerId, purge)
+			shared.Unlock()
+		}
+	}
+}
+
+// isPurge 删除路由的参数是否包含 RemoveRouterPurge
+func isPurge(params []interface{}) bool {
+	for _, item := range params {
+		if strings.EqualFold(str.ToString(item), RemoveRouterPurge) {
+			return true
+		}
+	}
+	return false
+}
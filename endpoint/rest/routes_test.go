@@ -0,0 +1,168 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestUpdateRouter(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9146"})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+	newRouter := func(id, path, body string) endpoint.Router {
+		return impl.NewRouter().SetId(id).From(path).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			exchange.Out.SetBody([]byte(body))
+			return true
+		}).End()
+	}
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	_, err = ep.AddRouter(newRouter("r1", "/api/device", "v1"), "GET")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", serve("/api/device").Body.String())
+
+	//重复注册返回错误
+	_, err = ep.AddRouter(newRouter("r1", "/api/device", "v2"), "GET")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "UpdateRouter"))
+	assert.Equal(t, "v1", serve("/api/device").Body.String())
+
+	//更新路由，使用路由注册时的方法
+	router := newRouter("r1", "/api/device", "v2")
+	router.SetParams("GET")
+	id, err := ep.UpdateRouter(router)
+	assert.Nil(t, err)
+	assert.Equal(t, "r1", id)
+	assert.Equal(t, "v2", serve("/api/device").Body.String())
+
+	//使用不同的路由id替换
+	_, err = ep.UpdateRouter(newRouter("r2", "/api/device", "v3"), "GET")
+	assert.Nil(t, err)
+	assert.Equal(t, "v3", serve("/api/device").Body.String())
+	assert.False(t, ep.HasRouter("r1"))
+	assert.True(t, ep.HasRouter("r2"))
+
+	//删除后重新注册，不需要重启
+	assert.Nil(t, ep.RemoveRouter("r2"))
+	assert.Equal(t, http.StatusNotFound, serve("/api/device").Code)
+	_, err = ep.AddRouter(newRouter("r3", "/api/device", "v4"), "GET")
+	assert.Nil(t, err)
+	assert.Equal(t, "v4", serve("/api/device").Body.String())
+	assert.False(t, ep.HasRouter("r2"))
+
+	//没有已注册的路由则注册新的路由
+	_, err = ep.UpdateRouter(newRouter("r4", "/api/device/:id", "v5"), "GET")
+	assert.Nil(t, err)
+	assert.Equal(t, "v5", serve("/api/device/1").Body.String())
+
+	//冲突的通配符路径返回错误
+	_, err = ep.AddRouter(newRouter("r5", "/api/device/:name", "v6"), "GET")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "router GET /api/device/:name"))
+	assert.False(t, ep.HasRouter("r5"))
+
+	//重启后保留更新后的路由
+	assert.Nil(t, ep.Restart())
+	assert.Equal(t, "v4", serve("/api/device").Body.String())
+	assert.Equal(t, "v5", serve("/api/device/1").Body.String())
+}
+
+// sharedPool 返回共享服务实例的资源池
+type sharedPool struct {
+	types.NodePool
+	server *Rest
+}
+
+func (p *sharedPool) GetInstance(id string) (interface{}, error) {
+	return p.server, nil
+}
+
+func TestRemoveRouter(t *testing.T) {
+	newRouter := func(id, path, body string) endpoint.Router {
+		return impl.NewRouter().SetId(id).From(path).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			exchange.Out.SetBody([]byte(body))
+			return true
+		}).End()
+	}
+	var ep = &Endpoint{}
+	assert.Nil(t, ep.Init(types.NewConfig(), types.Configuration{"server": ":9163"}))
+	defer ep.Destroy()
+	ep.Router().NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "custom not found", http.StatusNotFound)
+	})
+	serve := func(server *Rest, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	_, err := ep.AddRouter(newRouter("r1", "/api/device", "v1"), "GET")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", serve(ep, "/api/device").Body.String())
+
+	//删除后由NotFound处理器响应，保留已禁用的路由
+	assert.Nil(t, ep.RemoveRouter("r1"))
+	w := serve(ep, "/api/device")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "custom not found\n", w.Body.String())
+	assert.True(t, ep.HasRouter("r1"))
+	assert.NotNil(t, ep.RemoveRouter("r1"))
+
+	//释放路由
+	assert.Nil(t, ep.RemoveRouter("r1", RemoveRouterPurge))
+	assert.False(t, ep.HasRouter("r1"))
+	assert.NotNil(t, ep.RemoveRouter("r1", RemoveRouterPurge))
+
+	//重新添加相同路径和id
+	_, err = ep.AddRouter(newRouter("r1", "/api/device", "v2"), "GET")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", serve(ep, "/api/device").Body.String())
+	assert.Nil(t, ep.RemoveRouter("r1", "GET", RemoveRouterPurge))
+	assert.False(t, ep.HasRouter("r1"))
+	assert.Equal(t, http.StatusNotFound, serve(ep, "/api/device").Code)
+
+	//共享服务时同时从服务实例删除
+	var shared = &Endpoint{}
+	assert.Nil(t, shared.Init(types.NewConfig(), types.Configuration{"server": ":9164"}))
+	defer shared.Destroy()
+	config := types.NewConfig()
+	config.NetPool = &sharedPool{server: shared}
+	var ref = &Endpoint{}
+	assert.Nil(t, ref.Init(config, types.Configuration{"server": "ref://shared"}))
+	_, err = ref.AddRouter(newRouter("r2", "/api/shared", "v3"), "GET")
+	assert.Nil(t, err)
+	assert.Equal(t, "v3", serve(shared, "/api/shared").Body.String())
+	assert.Nil(t, ref.RemoveRouter("r2", RemoveRouterPurge))
+	assert.False(t, ref.HasRouter("r2"))
+	assert.False(t, shared.HasRouter("r2"))
+	assert.Equal(t, http.StatusNotFound, serve(shared, "/api/shared").Code)
+	_, err = ref.AddRouter(newRouter("r2", "/api/shared", "v4"), "GET")
+	assert.Nil(t, err)
+	assert.Equal(t, "v4", serve(shared, "/api/shared").Body.String())
+}
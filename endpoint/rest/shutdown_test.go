@@ -0,0 +1,118 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	newEndpoint := func(sleep time.Duration) *Endpoint {
+		var ep = &Endpoint{}
+		err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9112", "shutdownTimeout": 1})
+		assert.Nil(t, err)
+		ep.SetOnEvent(func(eventName string, params ...interface{}) {
+			if eventName == endpoint.EventCompletedServer {
+				record(eventName)
+			}
+		})
+		router := impl.NewRouter().From("/api/slow").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			time.Sleep(sleep)
+			exchange.Out.SetBody([]byte("done"))
+			record("done")
+			return true
+		}).End()
+		_, err = ep.AddRouter(router, "GET")
+		assert.Nil(t, err)
+		assert.Nil(t, ep.Start())
+		time.Sleep(time.Millisecond * 100)
+		return ep
+	}
+	get := func(result chan<- error) {
+		resp, err := http.Get("http://127.0.0.1:9112/api/slow")
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+		}
+		result <- err
+	}
+
+	//在等待时间内完成正在处理的请求
+	t.Run("Drain", func(t *testing.T) {
+		events = nil
+		ep := newEndpoint(time.Millisecond * 500)
+		result := make(chan error, 1)
+		go get(result)
+		time.Sleep(time.Millisecond * 100)
+
+		router := ep.Router()
+		closed := make(chan error, 1)
+		go func() {
+			closed <- ep.Close()
+		}()
+		time.Sleep(time.Millisecond * 100)
+		//关闭期间新的请求响应503
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/slow", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+		assert.Nil(t, <-result)
+		assert.Nil(t, <-closed)
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, []string{"done", endpoint.EventCompletedServer}, events)
+	})
+
+	//超过等待时间中断请求
+	t.Run("Abort", func(t *testing.T) {
+		events = nil
+		ep := newEndpoint(time.Second * 2)
+		result := make(chan error, 1)
+		go get(result)
+		time.Sleep(time.Millisecond * 100)
+
+		start := time.Now()
+		err := ep.Close()
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.True(t, time.Since(start) < time.Millisecond*1500)
+		assert.NotNil(t, <-result)
+		mu.Lock()
+		assert.Equal(t, []string{endpoint.EventCompletedServer}, events)
+		mu.Unlock()
+		//等待处理结束，避免影响其他测试
+		time.Sleep(time.Second * 2)
+		ep.Destroy()
+	})
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestStartupError(t *testing.T) {
+	blocker, err := net.Listen("tcp", ":9161")
+	assert.Nil(t, err)
+	defer blocker.Close()
+
+	var events []string
+	var ep = &Endpoint{}
+	assert.Nil(t, ep.Init(types.NewConfig(), types.Configuration{"server": ":9161"}))
+	ep.OnEvent = func(eventName string, params ...interface{}) {
+		events = append(events, eventName)
+	}
+	defer ep.Destroy()
+	//端口被占用同步返回错误
+	assert.NotNil(t, ep.Start())
+	assert.False(t, ep.Started())
+	assert.Equal(t, 0, len(events))
+
+	//端口可用
+	ep.Config.Server = ":9162"
+	router := impl.NewRouter().SetId("ok").From("/api/ok").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte("ok"))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	assert.True(t, ep.Started())
+	assert.Equal(t, []string{endpoint.EventInitServer}, events)
+	assert.Equal(t, "ok", get(t, "http://127.0.0.1:9162/api/ok"))
+
+	//重启失败不添加路由，保留原路由
+	ep.Config.Server = ":9161"
+	assert.NotNil(t, ep.Restart())
+	assert.False(t, ep.Started())
+	assert.True(t, ep.HasRouter("ok"))
+
+	ep.Config.Server = ":9162"
+	assert.Nil(t, ep.Restart())
+	assert.True(t, ep.Started())
+	assert.Equal(t, "ok", get(t, "http://127.0.0.1:9162/api/ok"))
+}
+
+func TestServeReady(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	completed := false
+	rest := &Rest{}
+	rest.OnEvent = func(eventName string, params ...interface{}) {
+		completed = true
+	}
+	//服务启动失败时通过通道返回错误，不再触发结束事件
+	server := &http.Server{}
+	_ = server.Close()
+	assert.Equal(t, http.ErrServerClosed, waitReady(startupTimeout, rest.serve(server, ln, false)))
+	assert.False(t, completed)
+
+	//没有开始接收连接时超时
+	assert.Equal(t, ErrStartupTimeout, waitReady(0, make(chan error)))
+}
+
+func get(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
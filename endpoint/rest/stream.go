@@ -0,0 +1,139 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+const HeaderKeyCacheControl = "Cache-Control"
+
+var _ endpoint.Streamer = (*ResponseMessage)(nil)
+
+// stream 流式响应，第一次写入后同步路由保持请求直到调用 Close 或者请求上下文取消
+type stream struct {
+	//响应头是否已经提交
+	started bool
+	closed  bool
+	done    chan struct{}
+}
+
+// WriteChunk 写入并flush一段响应体，开启流式响应
+func (r *ResponseMessage) WriteChunk(chunk []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.writeChunk(chunk)
+}
+
+// SetSSE 写入并flush一个Server-Sent Event，event为空不写入事件名称
+func (r *ResponseMessage) SetSSE(event, data string) error {
+	var builder strings.Builder
+	if event != "" {
+		builder.WriteString("event: ")
+		builder.WriteString(event)
+		builder.WriteString("\n")
+	}
+	for _, line := range strings.Split(data, "\n") {
+		builder.WriteString("data: ")
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+	builder.WriteString("\n")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.response != nil && (r.stream == nil || !r.stream.started) && !r.keepAliveStarted() {
+		header := r.response.Header()
+		header.Set(ContentTypeKey, ContentTypeEventStream)
+		header.Set(HeaderKeyCacheControl, "no-cache")
+	}
+	return r.writeChunk([]byte(builder.String()))
+}
+
+// Close 结束流式响应
+func (r *ResponseMessage) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stream == nil {
+		r.stream = &stream{done: make(chan struct{})}
+	}
+	r.stream.close()
+}
+
+// writeChunk 调用方需要持有锁
+func (r *ResponseMessage) writeChunk(chunk []byte) error {
+	if r.stream == nil {
+		r.stream = &stream{done: make(chan struct{})}
+	}
+	if r.stream.closed || r.response == nil {
+		return endpoint.ErrStreamClosed
+	}
+	if r.keepAlive != nil {
+		r.keepAlive.stop()
+	}
+	if !r.stream.started {
+		r.commitPendingStatus()
+		r.stream.started = true
+		r.applyConnectionHeader()
+		if r.compressor != nil && !r.compressor.committed {
+			//流式响应不压缩，只提交延迟的状态码
+			r.compressor.commit(r.response, r.request, nil)
+		}
+	}
+	if _, err := r.response.Write(chunk); err != nil {
+		return err
+	}
+	if flusher, ok := r.response.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// waitStream 如果开启了流式响应，等待调用 Close 或者上下文取消，之后的写入返回 endpoint.ErrStreamClosed
+func (r *ResponseMessage) waitStream(ctx context.Context) {
+	r.mu.Lock()
+	s := r.stream
+	if s == nil || !s.started {
+		if s == nil {
+			s = &stream{done: make(chan struct{})}
+			r.stream = s
+		}
+		//没有开启流式响应，处理结束后不再允许写入
+		s.close()
+		r.mu.Unlock()
+		return
+	}
+	r.mu.Unlock()
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+	}
+	r.mu.Lock()
+	s.close()
+	r.mu.Unlock()
+}
+
+func (s *stream) close() {
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+}
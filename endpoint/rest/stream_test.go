@@ -0,0 +1,117 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// streamNode 模拟LLM节点，规则链结束后继续推送token
+type streamNode struct {
+	close bool
+}
+
+func (n *streamNode) Type() string {
+	return "test/stream"
+}
+
+func (n *streamNode) New() types.Node {
+	return &streamNode{}
+}
+
+func (n *streamNode) Init(_ types.Config, configuration types.Configuration) error {
+	n.close, _ = configuration["close"].(bool)
+	return nil
+}
+
+func (n *streamNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	streamer, ok := endpoint.StreamerFromContext(ctx.GetContext())
+	if !ok {
+		ctx.TellFailure(msg, endpoint.ErrStreamClosed)
+		return
+	}
+	_ = streamer.SetSSE("token", "hello")
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		_ = streamer.SetSSE("", "rule\ngo")
+		if n.close {
+			_ = streamer.WriteChunk([]byte("data: [DONE]\n\n"))
+			streamer.Close()
+		}
+	}()
+	ctx.TellSuccess(msg)
+}
+
+func (n *streamNode) Destroy() {
+}
+
+func TestStream(t *testing.T) {
+	registry := new(engine.RuleComponentRegistry)
+	_ = registry.Register(&streamNode{})
+	config := engine.NewConfig(types.WithDefaultPool(), types.WithComponentsRegistry(registry))
+	for _, id := range []string{"streamClose", "streamOpen"} {
+		ruleChain := `{"ruleChain":{"id":"` + id + `"},"metadata":{"nodes":[{"id":"s1","type":"test/stream","configuration":{"close":` +
+			strconv.FormatBool(id == "streamClose") + `}}]}}`
+		ruleEngine, err := engine.New(id, []byte(ruleChain), engine.WithConfig(config))
+		assert.Nil(t, err)
+		defer engine.Del(ruleEngine.Id())
+	}
+
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9107", "enableCompression": true})
+	assert.Nil(t, err)
+	for _, id := range []string{"streamClose", "streamOpen"} {
+		router := impl.NewRouter().From("/api/" + id).To("chain:" + id).Wait().End()
+		_, err = ep.AddRouter(router, "POST")
+		assert.Nil(t, err)
+	}
+
+	//规则链结束后保持请求，直到调用Close
+	w := httptest.NewRecorder()
+	ep.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/streamClose", strings.NewReader(strings.Repeat("a", 2048))))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, w.Flushed)
+	assert.Equal(t, ContentTypeEventStream, w.Header().Get(ContentTypeKey))
+	assert.Equal(t, "", w.Header().Get(HeaderKeyContentEncoding))
+	assert.Equal(t, "event: token\ndata: hello\n\ndata: rule\ndata: go\n\ndata: [DONE]\n\n", w.Body.String())
+
+	//没有调用Close，客户端断开时结束
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*300, cancel)
+	w = httptest.NewRecorder()
+	start := time.Now()
+	ep.Router().ServeHTTP(w, httptest.NewRequest("POST", "/api/streamOpen", nil).WithContext(ctx))
+	assert.True(t, time.Since(start) >= time.Millisecond*300)
+	assert.Equal(t, "event: token\ndata: hello\n\ndata: rule\ndata: go\n\n", w.Body.String())
+
+	//处理结束后不允许写入
+	r := &ResponseMessage{request: httptest.NewRequest("GET", "/", nil), response: httptest.NewRecorder()}
+	r.waitStream(context.Background())
+	assert.Equal(t, endpoint.ErrStreamClosed, r.WriteChunk([]byte("a")))
+}
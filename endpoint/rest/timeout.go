@@ -0,0 +1,140 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/cast"
+)
+
+const (
+	// KeyRequestTimeout 路由from配置：请求处理超时时间（毫秒），覆盖 Config.DefaultRequestTimeout，小于等于0不限制
+	KeyRequestTimeout = "requestTimeout"
+	// ErrorCodeTimeout 同步路由处理超时
+	ErrorCodeTimeout = "TIMEOUT"
+)
+
+// ErrRequestTimeout 请求处理超时
+var ErrRequestTimeout = errors.New("request timeout")
+
+// routerTimeout 获取路由的请求处理超时时间，0不限制
+func (rest *Rest) routerTimeout(router endpoint.Router) (time.Duration, error) {
+	timeout := rest.Config.DefaultRequestTimeout
+	if from, ok := router.GetFrom().(*impl.From); ok && from != nil {
+		if v, ok := from.Config[KeyRequestTimeout]; ok && v != nil {
+			value, err := cast.ToIntE(v)
+			if err != nil {
+				return 0, fmt.Errorf("router %s requestTimeout config error: %w", router.GetId(), err)
+			}
+			timeout = value
+		}
+	}
+	if timeout <= 0 {
+		return 0, nil
+	}
+	return time.Duration(timeout) * time.Millisecond, nil
+}
+
+// withRequestTimeout 为规则链上下文设置超时时间
+// 异步路由的上下文不能随请求结束取消，到期后由定时器取消
+func withRequestTimeout(ctx context.Context, timeout time.Duration, isWait bool) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	if !isWait {
+		time.AfterFunc(timeout, cancel)
+		return ctx, func() {}
+	}
+	return ctx, cancel
+}
+
+// processWithTimeout 在超时时间内等待同步路由处理完成，返回false表示已经超时，处理结果不再写入响应
+// 处理过程中的panic在请求协程中重新抛出，由handler统一处理
+func (rest *Rest) processWithTimeout(ctx context.Context, router endpoint.Router, exchange *endpoint.Exchange, w *responseWriter, errorResponse *ErrorResponse) bool {
+	done := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			done <- recover()
+		}()
+		rest.DoProcess(ctx, router, exchange)
+	}()
+	select {
+	case e := <-done:
+		if e != nil {
+			panic(e)
+		}
+		return true
+	case <-ctx.Done():
+		msgId := ""
+		if msg := exchange.In.GetMsg(); msg != nil {
+			msgId = msg.Id
+		}
+		exchange.Out.(*ResponseMessage).timeout(w, errorResponse, ctx.Err(), msgId)
+		return false
+	}
+}
+
+// timeout 处理超时后写入504响应，并且丢弃之后规则链写入的响应，客户端断开时只丢弃响应
+// 如果已经写入了响应头，则中断连接
+func (r *ResponseMessage) timeout(w *responseWriter, errorResponse *ErrorResponse, err error, msgId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keepAlive != nil {
+		r.keepAlive.stop()
+	}
+	//之后的写入不再到达客户端
+	r.response = &discardResponseWriter{header: r.response.Header().Clone()}
+	r.compressor = nil
+	if r.stream == nil {
+		r.stream = &stream{done: make(chan struct{})}
+	}
+	r.stream.close()
+	if err != context.DeadlineExceeded {
+		return
+	}
+	if errorResponse != nil {
+		timeoutResponse := *errorResponse
+		timeoutResponse.StatusCode = http.StatusGatewayTimeout
+		writeErrorResponse(w, r.request, &timeoutResponse, ErrorCodeTimeout, ErrRequestTimeout, msgId)
+		return
+	}
+	if w.Committed() {
+		panic(http.ErrAbortHandler)
+	}
+	http.Error(w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+}
+
+// discardResponseWriter 超时后丢弃响应
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return 0, ErrRequestTimeout
+}
+
+func (w *discardResponseWriter) WriteHeader(statusCode int) {
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	//慢服务，记录请求是否被取消，读取完请求体后才能感知客户端断开
+	canceled := make(chan struct{}, 2)
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+			canceled <- struct{}{}
+		case <-time.After(time.Second * 3):
+		}
+	}))
+	defer slowServer.Close()
+
+	ruleChain := `{
+	  "ruleChain": {"id": "requestTimeoutTest"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "restApiCall", "configuration": {"restEndpointUrlPattern": "` + slowServer.URL + `", "requestMethod": "POST"}}
+		]
+	  }
+	}`
+	ruleEngine, err := engine.New("requestTimeoutTest", []byte(ruleChain), engine.WithConfig(engine.NewConfig(types.WithDefaultPool())))
+	assert.Nil(t, err)
+	defer engine.Del(ruleEngine.Id())
+
+	var ep = &Endpoint{}
+	err = ep.Init(types.NewConfig(), types.Configuration{"server": ":9116", "defaultRequestTimeout": 200})
+	assert.Nil(t, err)
+	router := impl.NewRouter().From("/api/wait").To("chain:requestTimeoutTest").Wait().End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+	router = impl.NewRouter().From("/api/async").To("chain:requestTimeoutTest").End()
+	_, err = ep.AddRouter(router, "POST")
+	assert.Nil(t, err)
+	var written int32
+	router = impl.NewRouter().From("/api/slow", types.Configuration{
+		KeyRequestTimeout: 100,
+		KeyErrorResponse:  map[string]interface{}{},
+	}).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		time.Sleep(time.Millisecond * 300)
+		exchange.Out.SetBody([]byte("late"))
+		atomic.AddInt32(&written, 1)
+		return false
+	}).To("chain:requestTimeoutTest").Wait().End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	router = impl.NewRouter().From("/api/fast", types.Configuration{KeyRequestTimeout: 0}).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		time.Sleep(time.Millisecond * 300)
+		exchange.Out.SetBody([]byte("ok"))
+		return false
+	}).To("chain:requestTimeoutTest").Wait().End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+
+	serve := func(method, path string) (*httptest.ResponseRecorder, time.Duration) {
+		start := time.Now()
+		w := httptest.NewRecorder()
+		ep.Router().ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader("{}")))
+		return w, time.Since(start)
+	}
+	waitCanceled := func() {
+		select {
+		case <-canceled:
+		case <-time.After(time.Second * 2):
+			t.Fatal("restApiCall request is not canceled")
+		}
+	}
+
+	//同步路由超时响应504，并且取消规则链中的http请求
+	w, elapsed := serve(http.MethodPost, "/api/wait")
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.True(t, elapsed < time.Second)
+	waitCanceled()
+
+	//异步路由到期后取消上下文
+	w, _ = serve(http.MethodPost, "/api/async")
+	assert.Equal(t, http.StatusOK, w.Code)
+	waitCanceled()
+
+	//路由配置覆盖默认超时时间，超时后写入的响应被丢弃
+	w, _ = serve(http.MethodGet, "/api/slow")
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.True(t, strings.Contains(w.Body.String(), `"code":"TIMEOUT"`))
+	time.Sleep(time.Millisecond * 300)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&written))
+	assert.False(t, strings.Contains(w.Body.String(), "late"))
+
+	//路由配置0不限制
+	w, _ = serve(http.MethodGet, "/api/fast")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+
+	router = impl.NewRouter().From("/api/invalid", types.Configuration{KeyRequestTimeout: "abc"}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.NotNil(t, err)
+}
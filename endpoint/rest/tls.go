@@ -0,0 +1,170 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+const (
+	// ClientCertCNKey 校验通过的客户端证书CN的元数据key
+	ClientCertCNKey = "clientCertCN"
+	// ClientCertSANKey 校验通过的客户端证书SAN的元数据key，多个以逗号分隔
+	ClientCertSANKey = "clientCertSAN"
+)
+
+const (
+	// EventCertReloaded 重新加载TLS证书成功事件，参数：证书文件
+	EventCertReloaded = "certReloaded"
+	// EventCertReloadFailed 重新加载TLS证书失败事件，继续使用原来的证书，参数：证书文件、错误
+	EventCertReloadFailed = "certReloadFailed"
+)
+
+// 客户端证书校验方式，见 Config.ClientAuthType
+const (
+	ClientAuthNone             = "none"
+	ClientAuthRequest          = "request"
+	ClientAuthRequireAny       = "requireAny"
+	ClientAuthVerifyIfGiven    = "verifyIfGiven"
+	ClientAuthRequireAndVerify = "requireAndVerify"
+)
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	ClientAuthNone:             tls.NoClientCert,
+	ClientAuthRequest:          tls.RequestClientCert,
+	ClientAuthRequireAny:       tls.RequireAnyClientCert,
+	ClientAuthVerifyIfGiven:    tls.VerifyClientCertIfGiven,
+	ClientAuthRequireAndVerify: tls.RequireAndVerifyClientCert,
+}
+
+// clientAuthType 解析客户端证书校验方式，为空时配置了ca则要求并校验客户端证书
+// 校验客户端证书的方式必须配置ca
+func clientAuthType(value string, hasCA bool) (tls.ClientAuthType, error) {
+	if value == "" {
+		if hasCA {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+		return tls.NoClientCert, nil
+	}
+	clientAuth, ok := clientAuthTypes[value]
+	if !ok {
+		return tls.NoClientCert, fmt.Errorf("unsupported clientAuthType:%s", value)
+	}
+	if !hasCA && (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) {
+		return tls.NoClientCert, fmt.Errorf("clientAuthType:%s requires ca", value)
+	}
+	return clientAuth, nil
+}
+
+// putClientCert 把校验通过的客户端证书CN和SAN放到元数据，没有校验的证书不放入
+func putClientCert(metadata *types.Metadata, r *http.Request) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return
+	}
+	cert := r.TLS.PeerCertificates[0]
+	metadata.PutValue(ClientCertCNKey, cert.Subject.CommonName)
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	if len(sans) > 0 {
+		metadata.PutValue(ClientCertSANKey, strings.Join(sans, ","))
+	}
+}
+
+// serverTLSOptions 解析后的 Config.TLSMinVersion 和 Config.TLSCipherSuites
+type serverTLSOptions struct {
+	minVersion   uint16
+	cipherSuites []uint16
+}
+
+// newServerTLSOptions 校验并解析http服务的安全配置，非法的配置返回错误
+func newServerTLSOptions(config Config) (serverTLSOptions, error) {
+	var options serverTLSOptions
+	if config.MaxHeaderBytes < 0 {
+		return options, fmt.Errorf("invalid maxHeaderBytes:%d", config.MaxHeaderBytes)
+	}
+	if config.TLSMinVersion != "" {
+		version, err := types.ParseTLSVersion(config.TLSMinVersion)
+		if err != nil {
+			return options, err
+		}
+		options.minVersion = version
+	}
+	if len(config.TLSCipherSuites) > 0 {
+		//只允许安全的加密套件
+		suites := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range config.TLSCipherSuites {
+			id, ok := suites[strings.TrimSpace(name)]
+			if !ok {
+				return options, fmt.Errorf("unsupported or insecure tls cipher suite:%s", name)
+			}
+			options.cipherSuites = append(options.cipherSuites, id)
+		}
+	}
+	return options, nil
+}
+
+// apply 设置到http服务的TLS配置，没有配置的保留默认值
+func (o serverTLSOptions) apply(tlsConfig *tls.Config) {
+	if o.minVersion != 0 {
+		tlsConfig.MinVersion = o.minVersion
+	}
+	if len(o.cipherSuites) > 0 {
+		tlsConfig.CipherSuites = o.cipherSuites
+	}
+}
+
+// ReloadCertificates 重新加载TLS证书，之后新的握手使用新的证书，已经建立的连接不受影响，不需要重启端点
+// 加载失败继续使用原来的证书。配置 TLS.Watch 后证书文件修改时自动重新加载
+func (rest *Rest) ReloadCertificates() error {
+	server, err := rest.serverInstance()
+	if err != nil {
+		return err
+	}
+	if server.certReloader == nil {
+		return errors.New("tls server is not started")
+	}
+	return server.certReloader.Reload()
+}
+
+// onCertReload 触发重新加载证书的事件
+func (rest *Rest) onCertReload(err error) {
+	certFile := rest.tlsConfig().Cert
+	if err != nil {
+		rest.Printf("reload tls certificate %s error:%v", certFile, err)
+		if rest.OnEvent != nil {
+			rest.OnEvent(EventCertReloadFailed, certFile, err)
+		}
+	} else if rest.OnEvent != nil {
+		rest.OnEvent(EventCertReloaded, certFile)
+	}
+}
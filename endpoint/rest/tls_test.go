@@ -0,0 +1,267 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/test/cert"
+)
+
+func TestClientAuthType(t *testing.T) {
+	clientAuth, err := clientAuthType("", true)
+	assert.Nil(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, clientAuth)
+	clientAuth, err = clientAuthType("", false)
+	assert.Nil(t, err)
+	assert.Equal(t, tls.NoClientCert, clientAuth)
+	clientAuth, err = clientAuthType(ClientAuthRequest, false)
+	assert.Nil(t, err)
+	assert.Equal(t, tls.RequestClientCert, clientAuth)
+	_, err = clientAuthType(ClientAuthVerifyIfGiven, false)
+	assert.Equal(t, "clientAuthType:verifyIfGiven requires ca", err.Error())
+	_, err = clientAuthType("always", true)
+	assert.Equal(t, "unsupported clientAuthType:always", err.Error())
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := cert.New(t, "rulego-ca", nil, x509.ExtKeyUsageAny)
+	serverCert := cert.New(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+	clientCert := cert.New(t, "device01", ca, x509.ExtKeyUsageClientAuth)
+	otherCa := cert.New(t, "other-ca", nil, x509.ExtKeyUsageAny)
+	otherClientCert := cert.New(t, "device02", otherCa, x509.ExtKeyUsageClientAuth)
+
+	dir := t.TempDir()
+	writeFile := func(name string, data []byte) string {
+		file := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(file, data, 0600))
+		return file
+	}
+
+	newClient := func(c *cert.Cert) *http.Client {
+		rootCAs := x509.NewCertPool()
+		rootCAs.AddCert(ca.Cert)
+		tlsConfig := &tls.Config{RootCAs: rootCAs}
+		if c != nil {
+			pair, err := tls.X509KeyPair(c.CertPem, c.KeyPem)
+			assert.Nil(t, err)
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: time.Second * 5}
+	}
+
+	start := func(configuration types.Configuration) *Endpoint {
+		var ep = &Endpoint{}
+		configuration["certFile"] = writeFile("server.pem", serverCert.CertPem)
+		configuration["certKeyFile"] = writeFile("server.key", serverCert.KeyPem)
+		assert.Nil(t, ep.Init(types.NewConfig(), configuration))
+		router := impl.NewRouter().From("/api/cert").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			metadata := exchange.In.GetMsg().Metadata
+			exchange.Out.SetBody([]byte(metadata.GetValue(ClientCertCNKey) + "|" + metadata.GetValue(ClientCertSANKey)))
+			return true
+		}).End()
+		_, err := ep.AddRouter(router, "GET")
+		assert.Nil(t, err)
+		assert.Nil(t, ep.Start())
+		time.Sleep(time.Millisecond * 200)
+		return ep
+	}
+	get := func(client *http.Client) (string, error) {
+		resp, err := client.Get("https://127.0.0.1:9109/api/cert")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	t.Run("RequireAndVerify", func(t *testing.T) {
+		ep := start(types.Configuration{"server": ":9109", "caFile": writeFile("ca.pem", ca.CertPem)})
+		defer ep.Destroy()
+		body, err := get(newClient(clientCert))
+		assert.Nil(t, err)
+		assert.Equal(t, "device01|localhost,127.0.0.1", body)
+		//没有客户端证书或者证书不是CA签发的，TLS握手失败
+		_, err = get(newClient(nil))
+		assert.NotNil(t, err)
+		_, err = get(newClient(otherClientCert))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("VerifyIfGiven", func(t *testing.T) {
+		ep := start(types.Configuration{"server": ":9109", "caFile": writeFile("ca.pem", ca.CertPem), "clientAuthType": ClientAuthVerifyIfGiven})
+		defer ep.Destroy()
+		body, err := get(newClient(nil))
+		assert.Nil(t, err)
+		assert.Equal(t, "|", body)
+		body, err = get(newClient(clientCert))
+		assert.Nil(t, err)
+		assert.Equal(t, "device01|localhost,127.0.0.1", body)
+	})
+
+	//没有配置ca，保持原有TLS行为
+	t.Run("PlainTLS", func(t *testing.T) {
+		ep := start(types.Configuration{"server": ":9109"})
+		defer ep.Destroy()
+		body, err := get(newClient(nil))
+		assert.Nil(t, err)
+		assert.Equal(t, "|", body)
+	})
+}
+
+func TestServerTLSOptions(t *testing.T) {
+	//非法配置初始化失败
+	for _, configuration := range []types.Configuration{
+		{"maxHeaderBytes": -1},
+		{"tlsMinVersion": "1.4"},
+		{"tlsCipherSuites": []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_RC4_128_SHA"}},
+		{"tlsCipherSuites": []string{"unknown"}},
+	} {
+		configuration["server"] = ":9123"
+		var ep = &Endpoint{}
+		assert.NotNil(t, ep.Init(types.NewConfig(), configuration))
+	}
+
+	ca := cert.New(t, "rulego-ca", nil, x509.ExtKeyUsageAny)
+	serverCert := cert.New(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server.key")
+	assert.Nil(t, os.WriteFile(certFile, serverCert.CertPem, 0600))
+	assert.Nil(t, os.WriteFile(keyFile, serverCert.KeyPem, 0600))
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{
+		"server":          ":9123",
+		"certFile":        certFile,
+		"certKeyFile":     keyFile,
+		"maxHeaderBytes":  1024,
+		"tlsMinVersion":   "1.2",
+		"tlsCipherSuites": []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	})
+	assert.Nil(t, err)
+	router := impl.NewRouter().From("/api/ping").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte("pong"))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, 1024, ep.Server.MaxHeaderBytes)
+	assert.Equal(t, uint16(tls.VersionTLS12), ep.Server.TLSConfig.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, ep.Server.TLSConfig.CipherSuites)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.Cert)
+	get := func(maxVersion uint16, header string) (int, error) {
+		client := &http.Client{Timeout: time.Second * 5, Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: rootCAs, MaxVersion: maxVersion},
+		}}
+		req, _ := http.NewRequest(http.MethodGet, "https://127.0.0.1:9123/api/ping", nil)
+		req.Header.Set("X-Test", header)
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	code, err := get(tls.VersionTLS12, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	//低于最低版本握手失败
+	_, err = get(tls.VersionTLS11, "a")
+	assert.NotNil(t, err)
+	//请求头超过限制
+	code, err = get(tls.VersionTLS12, strings.Repeat("a", 8192))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, code)
+}
+
+func TestReloadCertificates(t *testing.T) {
+	ca := cert.New(t, "rulego-ca", nil, x509.ExtKeyUsageAny)
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server.key")
+	writeCert := func(c *cert.Cert) {
+		assert.Nil(t, os.WriteFile(certFile, c.CertPem, 0600))
+		assert.Nil(t, os.WriteFile(keyFile, c.KeyPem, 0600))
+	}
+	writeCert(cert.New(t, "localhost", ca, x509.ExtKeyUsageServerAuth))
+
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9124", "certFile": certFile, "certKeyFile": keyFile})
+	assert.Nil(t, err)
+	assert.NotNil(t, ep.ReloadCertificates())
+	var events []string
+	ep.OnEvent = func(eventName string, params ...interface{}) {
+		if eventName == EventCertReloaded || eventName == EventCertReloadFailed {
+			events = append(events, eventName)
+		}
+	}
+	router := impl.NewRouter().From("/api/ping").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte("pong"))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+	time.Sleep(time.Millisecond * 200)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.Cert)
+	newClient := func() *http.Client {
+		return &http.Client{Timeout: time.Second * 5, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}}}
+	}
+	//返回握手使用的服务端证书CN
+	get := func(client *http.Client) string {
+		resp, err := client.Get("https://127.0.0.1:9124/api/ping")
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		_, _ = io.ReadAll(resp.Body)
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	client := newClient()
+	assert.Equal(t, "localhost", get(client))
+
+	writeCert(cert.New(t, "rotated", ca, x509.ExtKeyUsageServerAuth))
+	assert.Nil(t, ep.ReloadCertificates())
+	//新的连接使用新的证书，已经建立的连接不受影响
+	assert.Equal(t, "rotated", get(newClient()))
+	assert.Equal(t, "localhost", get(client))
+
+	//加载失败继续使用原来的证书
+	assert.Nil(t, os.WriteFile(certFile, []byte("invalid"), 0600))
+	assert.NotNil(t, ep.ReloadCertificates())
+	assert.Equal(t, "rotated", get(newClient()))
+	assert.Equal(t, []string{EventCertReloaded, EventCertReloadFailed}, events)
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// UnixSocketScheme unix domain socket服务地址前缀，例如：unix:///var/run/rulego.sock
+const UnixSocketScheme = "unix://"
+
+// unixSocketPath 解析unix domain socket服务地址，不是unix地址返回false
+func unixSocketPath(server string) (string, bool) {
+	if !strings.HasPrefix(server, UnixSocketScheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(server, UnixSocketScheme), true
+}
+
+// initUnixSocket 校验unix domain socket配置，并把socket文件转换为绝对路径，保证 Id() 和共享服务对每个socket文件唯一
+func (rest *Rest) initUnixSocket() error {
+	path, ok := unixSocketPath(rest.Config.Server)
+	if !ok {
+		return nil
+	}
+	if path == "" {
+		return errors.New("unix socket path can not be empty")
+	}
+	if tlsConfig := rest.tlsConfig(); !tlsConfig.IsEmpty() || rest.Config.ClientAuthType != "" {
+		return errors.New("tls is not supported on unix socket")
+	}
+	if _, err := socketFileMode(rest.Config.SocketFileMode); err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	rest.Config.Server = UnixSocketScheme + absPath
+	return nil
+}
+
+// socketFileMode 解析八进制的socket文件权限，例如：0660，为空返回0
+func socketFileMode(value string) (os.FileMode, error) {
+	if value == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket file mode:%s", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// listenUnix 监听unix domain socket，删除上次没有清理的socket文件，并设置文件权限
+func (rest *Rest) listenUnix(path string) (net.Listener, error) {
+	if err := removeSocketFile(path); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := socketFileMode(rest.Config.SocketFileMode)
+	if err == nil && mode != 0 {
+		err = os.Chmod(path, mode)
+	}
+	if err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeSocketFile 删除socket文件，不删除其他类型的文件和其他进程正在监听的socket文件
+func removeSocketFile(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s already exists and is not a unix socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("unix socket %s already in use", path)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "rulego.sock")
+
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{
+		"server":         UnixSocketScheme + dir + "/./rulego.sock",
+		"socketFileMode": "0660",
+	})
+	assert.Nil(t, err)
+	//转换为绝对路径，保证每个socket文件唯一
+	assert.Equal(t, UnixSocketScheme+socketPath, ep.Id())
+
+	router := impl.NewRouter().From("/api/unix").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte("ok"))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+
+	info, err := os.Stat(socketPath)
+	assert.Nil(t, err)
+	assert.True(t, info.Mode()&os.ModeSocket != 0)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	resp, err := client.Get("http://unix/api/unix")
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "ok", string(body))
+
+	//socket文件正在被监听
+	var ep2 = &Endpoint{}
+	assert.Nil(t, ep2.Init(types.NewConfig(), types.Configuration{"server": UnixSocketScheme + socketPath}))
+	ep2.Server = &http.Server{Addr: ep2.Config.Server}
+	_, err = ep2.Listen()
+	assert.NotNil(t, err)
+
+	//关闭后清理socket文件
+	ep.Destroy()
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err))
+
+	//删除上次没有清理的socket文件
+	ln, err := net.Listen("unix", socketPath)
+	assert.Nil(t, err)
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = ln.Close()
+	ln, err = ep2.Listen()
+	assert.Nil(t, err)
+	_ = ln.Close()
+
+	//不删除其他类型的文件
+	filePath := filepath.Join(dir, "data.txt")
+	assert.Nil(t, os.WriteFile(filePath, []byte("data"), 0644))
+	ep2.Server.Addr = UnixSocketScheme + filePath
+	_, err = ep2.Listen()
+	assert.NotNil(t, err)
+}
+
+func TestUnixSocketInvalidConfig(t *testing.T) {
+	for _, configuration := range []types.Configuration{
+		{"server": UnixSocketScheme},
+		{"server": UnixSocketScheme + "/tmp/rulego.sock", "certFile": "server.crt", "certKeyFile": "server.key"},
+		{"server": UnixSocketScheme + "/tmp/rulego.sock", "tls": types.TLSConfig{CA: "ca.pem"}},
+		{"server": UnixSocketScheme + "/tmp/rulego.sock", "socketFileMode": "rw"},
+		{"server": UnixSocketScheme + "/tmp/rulego.sock", "socketFileMode": "1777"},
+	} {
+		var ep = &Endpoint{}
+		assert.NotNil(t, ep.Init(types.NewConfig(), configuration))
+	}
+}
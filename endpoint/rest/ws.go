@@ -0,0 +1,232 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/utils/runtime"
+)
+
+const (
+	// MethodWS 升级为websocket的路由方法，使用GET注册，例如：AddRouter(router, rest.MethodWS)
+	MethodWS = "WS"
+	// KeyMessageType websocket消息类型元数据key，TextMessage=1/BinaryMessage=2
+	KeyMessageType = "messageType"
+)
+
+// WS 注册升级为websocket的路由，每个数据帧转换为一个 endpoint.Exchange，ResponseMessage.SetBody 在同一个连接写回数据帧
+// 连接建立和关闭分别触发 endpoint.EventConnect 和 endpoint.EventDisconnect 事件，参数为连接的 endpoint.Exchange，
+// 其元数据包含连接id(originConnection)，规则链可以用来清理会话状态
+func (rest *Rest) WS(routers ...endpoint.Router) endpoint.HttpEndpoint {
+	_ = rest.addRouter(MethodWS, routers...)
+	return rest
+}
+
+// wsConnection websocket连接，同一个连接的写入需要串行
+type wsConnection struct {
+	id   string
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (c *wsConnection) write(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteMessage(messageType, data)
+}
+
+// wsResponseWriter 把响应写成websocket数据帧，ResponseMessage 不需要区分http和websocket
+type wsResponseWriter struct {
+	conn        *wsConnection
+	messageType int
+	header      http.Header
+}
+
+func (w *wsResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *wsResponseWriter) Write(data []byte) (int, error) {
+	if err := w.conn.write(w.messageType, data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// WriteHeader websocket不提供设置状态码
+func (w *wsResponseWriter) WriteHeader(statusCode int) {
+}
+
+// wsUpgrader 开启跨域时允许跨域策略中的来源，否则只允许同源
+func (rest *Rest) wsUpgrader() *websocket.Upgrader {
+	upgrader := &websocket.Upgrader{}
+	if rest.cors != nil {
+		cors := rest.cors
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			_, ok := cors.allowOrigin(r.Header.Get(HeaderKeyOrigin))
+			return ok
+		}
+	}
+	return upgrader
+}
+
+func (rest *Rest) wsHandler(router endpoint.Router, auth *authenticator, limiter *rateLimiter) httprouter.Handle {
+	upgrader := rest.wsUpgrader()
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if router.IsDisable() {
+			http.NotFound(w, r)
+			return
+		}
+		if rest.isDraining(w) {
+			return
+		}
+		//访问控制和限流只对握手请求生效
+		ip := rest.clientIP(r)
+		if rest.rejectIP(w, r, ip) || rateLimited(w, r, params, ip, rest.limiter, limiter) {
+			return
+		}
+		tokenParam := rest.tokenQueryParam()
+		principal, err := rest.Authenticate(BearerToken(r, tokenParam), TransportMeta("ws", r))
+		if err != nil {
+			w.Header().Set(HeaderKeyWWWAuthenticate, "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		//连接的元数据，每个数据帧的消息元数据从该元数据复制
+		metadata := types.NewMetadata()
+		for _, param := range params {
+			metadata.PutValue(param.Key, param.Value)
+		}
+		//令牌不放到元数据中
+		skipKey := ""
+		if principal != nil || auth.isBearer() {
+			skipKey = tokenParam
+		}
+		putQueryMetadata(metadata, r.URL.Query(), skipKey)
+		rest.putCookieMetadata(metadata, r)
+		metadata.PutValue(KeyRemoteIp, ip)
+		metadata.PutValue(KeyHost, normalizeHost(r.Host))
+		if principal != nil {
+			principal.PutToMetadata(metadata)
+		}
+		putClientCert(metadata, r)
+		connectExchange := rest.newWsExchange(r, params, metadata, nil, nil, 0)
+		//握手之前认证，失败响应401
+		if auth != nil {
+			if err := auth.authenticate(router, connectExchange, r, tokenParam); err != nil {
+				w.Header().Set(HeaderKeyWWWAuthenticate, auth.challenge())
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			rest.Printf("http endpoint websocket upgrade error:%v", err)
+			return
+		}
+		connId, _ := uuid.NewV4()
+		conn := &wsConnection{id: connId.String(), conn: c}
+		rest.wsConns.Store(conn.id, conn)
+		endpoint.Origin{Type: rest.Type(), Id: rest.OriginId(), Connection: conn.id}.PutToMetadata(metadata)
+		connectExchange.Out.(*ResponseMessage).response = &wsResponseWriter{conn: conn, messageType: websocket.TextMessage, header: make(http.Header)}
+
+		defer func() {
+			rest.wsConns.Delete(conn.id)
+			_ = c.Close()
+			if e := recover(); e != nil {
+				rest.Printf("http endpoint websocket handler err :\n%v", runtime.Stack())
+			}
+			if rest.OnEvent != nil {
+				rest.OnEvent(endpoint.EventDisconnect, connectExchange)
+			}
+		}()
+		if rest.OnEvent != nil {
+			rest.OnEvent(endpoint.EventConnect, connectExchange)
+		}
+		for {
+			mt, message, err := c.ReadMessage()
+			if err != nil {
+				break
+			}
+			if router.IsDisable() {
+				_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "router disabled"), time.Now().Add(time.Second))
+				break
+			}
+			if mt != websocket.BinaryMessage && mt != websocket.TextMessage {
+				continue
+			}
+			frameMetadata := metadata.Copy()
+			frameMetadata.PutValue(KeyMessageType, strconv.Itoa(mt))
+			exchange := rest.newWsExchange(r, params, frameMetadata, message, conn, mt)
+			rest.DoProcess(r.Context(), router, exchange)
+		}
+	}
+}
+
+// newWsExchange 创建数据帧的 endpoint.Exchange，conn为空时响应不写入连接
+func (rest *Rest) newWsExchange(r *http.Request, params httprouter.Params, metadata *types.Metadata, body []byte, conn *wsConnection, messageType int) *endpoint.Exchange {
+	if body == nil {
+		body = []byte{}
+	}
+	out := &ResponseMessage{request: r}
+	if conn != nil {
+		out.response = &wsResponseWriter{conn: conn, messageType: messageType, header: make(http.Header)}
+	}
+	in := &RequestMessage{
+		request:  r,
+		body:     body,
+		Params:   params,
+		Metadata: metadata,
+	}
+	if conn != nil {
+		//与websocket端点一致，默认指定是JSON格式，如果不是该类型，请在process函数中修改
+		dataType := types.JSON
+		if messageType == websocket.BinaryMessage {
+			dataType = types.BINARY
+		}
+		ruleMsg := types.NewMsg(0, in.From(), dataType, metadata, string(body))
+		in.msg = &ruleMsg
+	}
+	return &endpoint.Exchange{In: in, Out: out}
+}
+
+// replyWs 把消息数据写入消息来源的websocket连接，连接已经关闭返回 endpoint.ErrOriginGone
+func (rest *Rest) replyWs(connId string, msg types.RuleMsg) error {
+	v, ok := rest.wsConns.Load(connId)
+	if !ok {
+		return fmt.Errorf("%w: websocket connection %s is closed", endpoint.ErrOriginGone, connId)
+	}
+	messageType, _ := strconv.Atoi(msg.Metadata.GetValue(KeyMessageType))
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		if msg.DataType == types.BINARY {
+			messageType = websocket.BinaryMessage
+		} else {
+			messageType = websocket.TextMessage
+		}
+	}
+	return v.(*wsConnection).write(messageType, msg.GetBytes())
+}
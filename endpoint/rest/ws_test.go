@@ -0,0 +1,133 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestWebsocketRouter(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9108"})
+	assert.Nil(t, err)
+	events := make(chan *endpoint.Exchange, 2)
+	ep.SetOnEvent(func(eventName string, params ...interface{}) {
+		if eventName == endpoint.EventConnect || eventName == endpoint.EventDisconnect {
+			events <- params[0].(*endpoint.Exchange)
+		}
+	})
+	var replyMsg types.RuleMsg
+	router := impl.NewRouter().From("/ws/:room").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		msg := exchange.In.GetMsg()
+		replyMsg = *msg
+		exchange.Out.SetBody([]byte(msg.Metadata.GetValue("room") + ":" + strings.ToUpper(msg.GetData())))
+		return true
+	}).End()
+	ep.WS(router)
+	//普通http路由不受影响
+	_, err = ep.AddRouter(impl.NewRouter().From("/api/ping").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte("pong"))
+		return true
+	}).End(), http.MethodGet)
+	assert.Nil(t, err)
+
+	server := httptest.NewServer(ep.Router())
+	defer server.Close()
+	wsUrl := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	resp, err := http.Get(server.URL + "/api/ping")
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	c, _, err := websocket.DefaultDialer.Dial(wsUrl+"/ws/room01?user=lala", nil)
+	assert.Nil(t, err)
+	connectExchange := <-events
+	connId := connectExchange.In.GetMsg().Metadata.GetValue(endpoint.OriginConnectionKey)
+	assert.True(t, connId != "")
+	assert.Equal(t, "lala", connectExchange.In.GetMsg().Metadata.GetValue("user"))
+
+	//每个数据帧转换为一个exchange，响应写回同一个连接
+	for _, data := range []string{"hello", "rulego"} {
+		assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(data)))
+		mt, message, err := c.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, websocket.TextMessage, mt)
+		assert.Equal(t, "room01:"+strings.ToUpper(data), string(message))
+	}
+	assert.Equal(t, connId, replyMsg.Metadata.GetValue(endpoint.OriginConnectionKey))
+	assert.Equal(t, "lala", replyMsg.Metadata.GetValue("user"))
+
+	//replyTo节点回复到原连接
+	replyMsg.SetData("reply")
+	assert.Nil(t, ep.Reply(replyMsg))
+	_, message, err := c.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "reply", string(message))
+
+	//连接关闭触发Disconnect事件
+	_ = c.Close()
+	select {
+	case disconnectExchange := <-events:
+		assert.Equal(t, connId, disconnectExchange.In.GetMsg().Metadata.GetValue(endpoint.OriginConnectionKey))
+	case <-time.After(time.Second * 2):
+		t.Fatal("disconnect event timeout")
+	}
+	assert.True(t, errors.Is(ep.Reply(replyMsg), endpoint.ErrOriginGone))
+}
+
+func TestWebsocketRouterAuth(t *testing.T) {
+	var ep = &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{
+		"server": ":9108",
+		"auth":   &AuthConfig{Type: AuthTypeBasic, Users: map[string]string{"admin": "123456"}},
+	})
+	assert.Nil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From("/ws").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte(exchange.In.GetMsg().Metadata.GetValue(AuthUserKey)))
+		return true
+	}).End(), MethodWS)
+	assert.Nil(t, err)
+	server := httptest.NewServer(ep.Router())
+	defer server.Close()
+	wsUrl := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsUrl, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	header := http.Header{}
+	header.Set(HeaderKeyAuthorization, "Basic YWRtaW46MTIzNDU2")
+	c, _, err := websocket.DefaultDialer.Dial(wsUrl, header)
+	assert.Nil(t, err)
+	defer c.Close()
+	assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte("hi")))
+	_, message, err := c.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", string(message))
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/str"
+)
+
+// 错过执行的处理策略，见 Config.MisfirePolicy
+const (
+	// MisfirePolicySkip 跳过停机期间错过的执行，默认策略
+	MisfirePolicySkip = "skip"
+	// MisfirePolicyFireOnce 启动时补发一次，计划时间为最近一次错过的时间
+	MisfirePolicyFireOnce = "fireOnce"
+	// MisfirePolicyCatchUp 启动时按计划时间顺序补发所有错过的执行，最多 Config.MaxCatchUp 次，超过时只补发最近的
+	MisfirePolicyCatchUp = "catchUp"
+)
+
+const (
+	// KeyTimezone 路由from配置：时区，例如：Asia/Shanghai，覆盖 Config.Timezone
+	KeyTimezone = "timezone"
+	// KeyMisfirePolicy 路由from配置：错过执行的处理策略，覆盖 Config.MisfirePolicy
+	KeyMisfirePolicy = "misfirePolicy"
+	// KeyScheduledTime 计划执行时间放到msg元数据的key，毫秒时间戳
+	KeyScheduledTime = "scheduledTime"
+	// KeyFireTime 实际执行时间放到msg元数据的key，毫秒时间戳
+	KeyFireTime = "fireTime"
+	// KeyMisfire 启动时补发的执行，msg元数据的值为true
+	KeyMisfire = "misfire"
+	// DefaultMaxCatchUp catchUp策略默认最多补发的次数
+	DefaultMaxCatchUp = 100
+	// lastFireKeyPrefix 记录最近一次计划执行时间的缓存key前缀
+	lastFireKeyPrefix = "rulego:schedule:lastFire:"
+)
+
+// cronParser cron表达式解析器，秒字段可选：6个字段第一个为秒，5个字段从分钟开始
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Config 定时任务端点配置
+type Config struct {
+	// Timezone cron表达式使用的时区，例如：Asia/Shanghai，为空使用本地时区
+	Timezone string `json:"timezone"`
+	// MisfirePolicy 启动时对停机期间错过的执行的处理策略：skip(默认)、fireOnce、catchUp
+	// 最近一次计划执行时间记录在 types.Config.Cache，需要使用持久化的缓存才能跨进程重启生效，
+	// 缓存key使用 AddRouter 之前设置的路由id，没有设置则使用cron表达式
+	MisfirePolicy string `json:"misfirePolicy"`
+	// MaxCatchUp catchUp策略最多补发的次数，0使用 DefaultMaxCatchUp
+	MaxCatchUp int `json:"maxCatchUp"`
+}
+
+// job 路由对应的定时任务
+type job struct {
+	schedule *Schedule
+	router   endpoint.Router
+	spec     cron.Schedule
+	id       cron.EntryID
+	policy   string
+	//记录最近一次计划执行时间的缓存key，没有开启补发时为空
+	lastFireKey string
+}
+
+func (j *job) Run() {
+	fireTime := time.Now()
+	scheduledTime := j.schedule.prevTime(j)
+	if scheduledTime.IsZero() {
+		scheduledTime = fireTime
+	}
+	j.schedule.fire(j, scheduledTime, fireTime, false)
+}
+
+// parseSpec 解析路由的cron表达式，路由from配置的时区优先于端点配置
+func (schedule *Schedule) parseSpec(router endpoint.Router) (cron.Schedule, error) {
+	spec := strings.TrimSpace(router.GetFrom().ToString())
+	timezone := schedule.Config.Timezone
+	if v := fromConfig(router, KeyTimezone); v != "" {
+		timezone = v
+	}
+	if timezone != "" && !strings.HasPrefix(spec, "TZ=") && !strings.HasPrefix(spec, "CRON_TZ=") {
+		spec = "CRON_TZ=" + timezone + " " + spec
+	}
+	return cronParser.Parse(spec)
+}
+
+// misfirePolicy 获取路由的错过执行处理策略
+func (schedule *Schedule) misfirePolicy(router endpoint.Router) (string, error) {
+	policy := schedule.Config.MisfirePolicy
+	if v := fromConfig(router, KeyMisfirePolicy); v != "" {
+		policy = v
+	}
+	switch policy {
+	case "":
+		return MisfirePolicySkip, nil
+	case MisfirePolicySkip, MisfirePolicyFireOnce, MisfirePolicyCatchUp:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unsupported misfire policy: %s", policy)
+	}
+}
+
+func fromConfig(router endpoint.Router, key string) string {
+	if from, ok := router.GetFrom().(*impl.From); ok && from != nil {
+		if v, ok := from.Config[key]; ok && v != nil {
+			return str.ToString(v)
+		}
+	}
+	return ""
+}
+
+// prevTime 获取任务本次的计划执行时间，cron在启动任务后才更新 Prev，通过快照获取
+func (schedule *Schedule) prevTime(j *job) time.Time {
+	schedule.mu.Lock()
+	c, id := schedule.cron, j.id
+	schedule.mu.Unlock()
+	if c == nil || id == 0 {
+		return time.Time{}
+	}
+	return c.Entry(id).Prev
+}
+
+// lastFireTime 获取缓存中记录的最近一次计划执行时间
+func (schedule *Schedule) lastFireTime(j *job) (time.Time, bool) {
+	if j.lastFireKey == "" || schedule.RuleConfig.Cache == nil {
+		return time.Time{}, false
+	}
+	v := schedule.RuleConfig.Cache.Get(j.lastFireKey)
+	if v == nil {
+		return time.Time{}, false
+	}
+	ms, err := strconv.ParseInt(str.ToString(v), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+// saveLastFireTime 记录最近一次计划执行时间，补发的执行不覆盖更新的记录
+func (schedule *Schedule) saveLastFireTime(j *job, scheduledTime time.Time) {
+	if j.lastFireKey == "" || schedule.RuleConfig.Cache == nil {
+		return
+	}
+	schedule.mu.Lock()
+	defer schedule.mu.Unlock()
+	if last, ok := schedule.lastFireTime(j); ok && !scheduledTime.After(last) {
+		return
+	}
+	if err := schedule.RuleConfig.Cache.Set(j.lastFireKey, strconv.FormatInt(scheduledTime.UnixMilli(), 10), ""); err != nil {
+		schedule.Printf("schedule endpoint save last fire time err :%v", err)
+	}
+}
+
+// recoverMisfire 按照路由的策略补发停机期间错过的执行，没有执行记录时不补发
+func (schedule *Schedule) recoverMisfire(j *job) {
+	if j.policy == MisfirePolicySkip {
+		return
+	}
+	last, ok := schedule.lastFireTime(j)
+	if !ok {
+		return
+	}
+	limit := 1
+	if j.policy == MisfirePolicyCatchUp {
+		limit = schedule.Config.MaxCatchUp
+		if limit <= 0 {
+			limit = DefaultMaxCatchUp
+		}
+	}
+	//只保留最近的 limit 次
+	now := time.Now()
+	var missed []time.Time
+	for t := j.spec.Next(last); !t.IsZero() && !t.After(now); t = j.spec.Next(t) {
+		missed = append(missed, t)
+		if len(missed) > limit {
+			missed = missed[1:]
+		}
+	}
+	if len(missed) == 0 {
+		return
+	}
+	go func() {
+		for _, scheduledTime := range missed {
+			schedule.fire(j, scheduledTime, time.Now(), true)
+		}
+	}()
+}
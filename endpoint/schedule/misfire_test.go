@@ -0,0 +1,129 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schedule
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/cache"
+)
+
+func TestScheduleConfig(t *testing.T) {
+	var ep = &Endpoint{}
+	assert.Nil(t, ep.Init(types.NewConfig(), types.Configuration{"timezone": "Asia/Shanghai"}))
+	defer ep.Destroy()
+	//秒字段可选，时区使用端点配置
+	spec, err := ep.parseSpec(impl.NewRouter().From("0 9 * * *").End())
+	assert.Nil(t, err)
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	next := spec.Next(time.Now()).In(shanghai)
+	assert.Equal(t, 9, next.Hour())
+	assert.Equal(t, 0, next.Minute())
+	assert.Equal(t, 0, next.Second())
+	//路由配置覆盖端点配置
+	spec, err = ep.parseSpec(impl.NewRouter().From("*/15 * * * * *", types.Configuration{KeyTimezone: "UTC"}).End())
+	assert.Nil(t, err)
+	next = spec.Next(time.Now())
+	assert.Equal(t, 0, next.Second()%15)
+	spec, err = ep.parseSpec(impl.NewRouter().From("0 0 9 * * *", types.Configuration{KeyTimezone: "UTC"}).End())
+	assert.Nil(t, err)
+	assert.Equal(t, 9, spec.Next(time.Now()).UTC().Hour())
+
+	_, err = ep.AddRouter(impl.NewRouter().From("* * * * * *", types.Configuration{KeyTimezone: "Mars/Olympus"}).End())
+	assert.NotNil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From("* * * * * *", types.Configuration{KeyMisfirePolicy: "xx"}).End())
+	assert.NotNil(t, err)
+	assert.NotNil(t, (&Endpoint{}).Init(types.NewConfig(), types.Configuration{"misfirePolicy": "xx"}))
+	assert.NotNil(t, (&Endpoint{}).Init(types.NewConfig(), types.Configuration{"timezone": "Mars/Olympus"}))
+
+	//计划执行时间和实际执行时间
+	msgs := make(chan types.RuleMsg, 4)
+	_, err = ep.AddRouter(impl.NewRouter().From("* * * * * *").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		msgs <- *exchange.In.GetMsg()
+		return true
+	}).End())
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	msg := <-msgs
+	scheduledTime, _ := strconv.ParseInt(msg.Metadata.GetValue(KeyScheduledTime), 10, 64)
+	fireTime, _ := strconv.ParseInt(msg.Metadata.GetValue(KeyFireTime), 10, 64)
+	assert.Equal(t, int64(0), scheduledTime%1000)
+	assert.True(t, fireTime >= scheduledTime && fireTime-scheduledTime < 1000)
+	assert.Equal(t, "", msg.Metadata.GetValue(KeyMisfire))
+}
+
+func TestMisfire(t *testing.T) {
+	now := time.Now()
+	//上一次执行在5个小时之前，错过了5次
+	last := strconv.FormatInt(now.Add(-5*time.Hour).UnixMilli(), 10)
+	latest := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location())
+	run := func(configuration types.Configuration, routerConfig types.Configuration, record bool) []types.RuleMsg {
+		c := cache.NewMemoryCache(time.Minute)
+		if record {
+			assert.Nil(t, c.Set(lastFireKeyPrefix+"report", last, ""))
+		}
+		var ep = &Endpoint{}
+		assert.Nil(t, ep.Init(types.NewConfig(types.WithCache(c)), configuration))
+		defer ep.Destroy()
+		msgs := make(chan types.RuleMsg, 10)
+		router := impl.NewRouter().SetId("report").From("0 0 * * * *", routerConfig).Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			msgs <- *exchange.In.GetMsg()
+			return true
+		}).End()
+		_, err := ep.AddRouter(router)
+		assert.Nil(t, err)
+		assert.Nil(t, ep.Start())
+		time.Sleep(time.Millisecond * 200)
+		var result []types.RuleMsg
+		for len(msgs) > 0 {
+			result = append(result, <-msgs)
+		}
+		//补发后记录最近一次计划执行时间
+		if len(result) > 0 {
+			assert.Equal(t, strconv.FormatInt(latest.UnixMilli(), 10), c.Get(lastFireKeyPrefix+"report"))
+		}
+		return result
+	}
+	scheduledTime := func(msg types.RuleMsg) time.Time {
+		ms, _ := strconv.ParseInt(msg.Metadata.GetValue(KeyScheduledTime), 10, 64)
+		return time.UnixMilli(ms)
+	}
+
+	msgs := run(types.Configuration{"misfirePolicy": MisfirePolicyCatchUp}, nil, true)
+	assert.Equal(t, 5, len(msgs))
+	for i, msg := range msgs {
+		assert.Equal(t, "true", msg.Metadata.GetValue(KeyMisfire))
+		assert.True(t, scheduledTime(msg).Equal(latest.Add(time.Duration(i-4)*time.Hour)))
+	}
+	//只补发最近的
+	msgs = run(types.Configuration{"misfirePolicy": MisfirePolicyCatchUp, "maxCatchUp": 2}, nil, true)
+	assert.Equal(t, 2, len(msgs))
+	assert.True(t, scheduledTime(msgs[1]).Equal(latest))
+	//路由配置覆盖端点配置
+	msgs = run(types.Configuration{"misfirePolicy": MisfirePolicyCatchUp}, types.Configuration{KeyMisfirePolicy: MisfirePolicyFireOnce}, true)
+	assert.Equal(t, 1, len(msgs))
+	assert.True(t, scheduledTime(msgs[0]).Equal(latest))
+	assert.Equal(t, 0, len(run(types.Configuration{}, nil, true)))
+	//没有执行记录不补发
+	assert.Equal(t, 0, len(run(types.Configuration{"misfirePolicy": MisfirePolicyCatchUp}, nil, false)))
+}
@@ -19,7 +19,7 @@
 //
 // Field name   | Mandatory? | Allowed values  | Allowed special characters
 // ----------   | ---------- | --------------  | --------------------------
-// Seconds      | Yes        | 0-59            | * / , -
+// Seconds      | No         | 0-59            | * / , -
 // Minutes      | Yes        | 0-59            | * / , -
 // Hours        | Yes        | 0-23            | * / , -
 // Day of month | Yes        | 1-31            | * / , - ?
@@ -34,6 +34,10 @@
 // @weekly                | Run once a week, midnight between Sat/Sun  | 0 0 0 * * 0
 // @daily (or @midnight)  | Run once a day, midnight                   | 0 0 0 * * *
 // @hourly                | Run once an hour, beginning of hour        | 0 0 * * * *
+//
+// The seconds field is optional: an expression with 5 fields starts from minutes.
+// The timezone can be set by Config.Timezone, the router's from configuration "timezone",
+// or the "CRON_TZ=Asia/Shanghai " prefix of the expression.
 package schedule
 
 import (
@@ -43,12 +47,14 @@ import (
 	"net/textproto"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/robfig/cron/v3"
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/api/types/endpoint"
 	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/maps"
 	"github.com/rulego/rulego/utils/runtime"
 )
 
@@ -183,13 +189,22 @@ type Schedule struct {
 	id string
 	impl.BaseEndpoint
 	RuleConfig types.Config
+	Config     Config
 	cron       *cron.Cron
+	//任务id->任务
+	jobs    map[cron.EntryID]*job
+	started bool
+	mu      sync.Mutex
 }
 
 // New 创建一个新的Schedule Endpoint 实例
 func New(ruleConfig types.Config) *Schedule {
 	uuId, _ := uuid.NewV4()
-	return &Schedule{RuleConfig: ruleConfig, cron: cron.New(cron.WithSeconds()), id: uuId.String()}
+	return &Schedule{RuleConfig: ruleConfig, cron: newCron(), id: uuId.String()}
+}
+
+func newCron() *cron.Cron {
+	return cron.New(cron.WithParser(cronParser))
 }
 
 // Type 组件类型
@@ -199,13 +214,26 @@ func (schedule *Schedule) Type() string {
 
 func (schedule *Schedule) New() types.Node {
 	uuId, _ := uuid.NewV4()
-	return &Schedule{cron: cron.New(cron.WithSeconds()), id: uuId.String()}
+	return &Schedule{cron: newCron(), id: uuId.String()}
 }
 
 // Init 初始化
 func (schedule *Schedule) Init(ruleConfig types.Config, configuration types.Configuration) error {
 	schedule.RuleConfig = ruleConfig
-	return nil
+	if err := maps.Map2Struct(configuration, &schedule.Config); err != nil {
+		return err
+	}
+	if schedule.Config.Timezone != "" {
+		if _, err := time.LoadLocation(schedule.Config.Timezone); err != nil {
+			return err
+		}
+	}
+	switch schedule.Config.MisfirePolicy {
+	case "", MisfirePolicySkip, MisfirePolicyFireOnce, MisfirePolicyCatchUp:
+		return nil
+	default:
+		return fmt.Errorf("unsupported misfire policy: %s", schedule.Config.MisfirePolicy)
+	}
 }
 
 // Destroy 销毁
@@ -214,9 +242,14 @@ func (schedule *Schedule) Destroy() {
 }
 
 func (schedule *Schedule) Close() error {
-	if schedule.cron != nil {
-		schedule.cron.Stop()
-		schedule.cron = nil
+	schedule.mu.Lock()
+	c := schedule.cron
+	schedule.cron = nil
+	schedule.jobs = nil
+	schedule.started = false
+	schedule.mu.Unlock()
+	if c != nil {
+		c.Stop()
 	}
 	schedule.BaseEndpoint.Destroy()
 	return nil
@@ -233,19 +266,42 @@ func (schedule *Schedule) AddRouter(router endpoint.Router, params ...interface{
 	if router.GetFrom() == nil {
 		return "", errors.New("from can not nil")
 	}
+	//解析cron表达式
+	spec, err := schedule.parseSpec(router)
+	if err != nil {
+		return "", err
+	}
+	policy, err := schedule.misfirePolicy(router)
+	if err != nil {
+		return "", err
+	}
+	j := &job{schedule: schedule, router: router, spec: spec, policy: policy}
+	if policy != MisfirePolicySkip {
+		key := router.GetId()
+		if key == "" {
+			key = router.GetFrom().ToString()
+		}
+		j.lastFireKey = lastFireKeyPrefix + key
+	}
+	schedule.mu.Lock()
 	if schedule.cron == nil {
-		schedule.cron = cron.New(cron.WithSeconds())
+		schedule.cron = newCron()
+	}
+	if schedule.jobs == nil {
+		schedule.jobs = make(map[cron.EntryID]*job)
 	}
-	//获取cron表达式
-	from := router.GetFrom().ToString()
 	//添加任务
-	id, err := schedule.cron.AddFunc(from, func() {
-		schedule.handler(router)
-	})
-	idStr := strconv.Itoa(int(id))
+	j.id = schedule.cron.Schedule(spec, j)
+	schedule.jobs[j.id] = j
+	started := schedule.started
+	schedule.mu.Unlock()
+	if started {
+		schedule.recoverMisfire(j)
+	}
+	idStr := strconv.Itoa(int(j.id))
 	router.SetId(idStr)
 	//返回任务ID，用于清除任务
-	return idStr, err
+	return idStr, nil
 }
 
 func (schedule *Schedule) RemoveRouter(routeId string, params ...interface{}) error {
@@ -253,17 +309,34 @@ func (schedule *Schedule) RemoveRouter(routeId string, params ...interface{}) er
 	if err != nil {
 		return fmt.Errorf("%s it is an illegal routing id", routeId)
 	}
+	schedule.mu.Lock()
+	defer schedule.mu.Unlock()
 	if schedule.cron != nil {
 		schedule.cron.Remove(cron.EntryID(entryID))
 	}
+	delete(schedule.jobs, cron.EntryID(entryID))
 	return nil
 }
 
+// Start 启动定时任务，并按照路由的错过执行处理策略补发停机期间错过的执行
 func (schedule *Schedule) Start() error {
+	schedule.mu.Lock()
 	if schedule.cron == nil {
+		schedule.mu.Unlock()
 		return errors.New("cron has not been initialized yet")
 	}
 	schedule.cron.Start()
+	var jobs []*job
+	if !schedule.started {
+		for _, j := range schedule.jobs {
+			jobs = append(jobs, j)
+		}
+	}
+	schedule.started = true
+	schedule.mu.Unlock()
+	for _, j := range jobs {
+		schedule.recoverMisfire(j)
+	}
 	return nil
 }
 
@@ -273,17 +346,23 @@ func (schedule *Schedule) Printf(format string, v ...interface{}) {
 	}
 }
 
-// 处理定时任务
-func (schedule *Schedule) handler(router endpoint.Router) {
+// fire 处理定时任务，msg元数据包括计划执行时间和实际执行时间
+func (schedule *Schedule) fire(j *job, scheduledTime, fireTime time.Time, misfire bool) {
 	defer func() {
 		//捕捉异常
 		if e := recover(); e != nil {
 			schedule.Printf("schedule endpoint handler err :\n%v", runtime.Stack())
 		}
 	}()
+	schedule.saveLastFireTime(j, scheduledTime)
 	exchange := &endpoint.Exchange{
 		In:  &RequestMessage{},
 		Out: &ResponseMessage{}}
-
-	schedule.DoProcess(context.Background(), router, exchange)
+	metadata := exchange.In.GetMsg().Metadata
+	metadata.PutValue(KeyScheduledTime, strconv.FormatInt(scheduledTime.UnixMilli(), 10))
+	metadata.PutValue(KeyFireTime, strconv.FormatInt(fireTime.UnixMilli(), 10))
+	if misfire {
+		metadata.PutValue(KeyMisfire, "true")
+	}
+	schedule.DoProcess(context.Background(), j.router, exchange)
 }
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+// DefaultBroadcastQueueSize 连接广播消息发送队列的默认长度，见 Config.BroadcastQueueSize
+const DefaultBroadcastQueueSize = 64
+
+var _ endpoint.Broadcaster = (*Websocket)(nil)
+
+// outbound 等待发送的广播消息
+type outbound struct {
+	messageType int
+	data        []byte
+}
+
+// session 连接的会话信息和广播发送队列
+type session struct {
+	info endpoint.SessionInfo
+	//标签，可以在拦截器中通过 ResponseMessage.SetSessionTag 设置
+	tags   map[string]string
+	tagsMu sync.RWMutex
+	//广播消息发送队列，第一次广播时创建，由单独的协程写入连接
+	outbox     chan outbound
+	outboxOnce sync.Once
+	queueSize  int
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+func newSession(info endpoint.SessionInfo, queueSize int) *session {
+	if queueSize <= 0 {
+		queueSize = DefaultBroadcastQueueSize
+	}
+	return &session{info: info, tags: make(map[string]string), queueSize: queueSize, done: make(chan struct{})}
+}
+
+// setTag 设置标签
+func (s *session) setTag(key, value string) {
+	s.tagsMu.Lock()
+	defer s.tagsMu.Unlock()
+	s.tags[key] = value
+}
+
+// snapshot 会话信息的快照
+func (s *session) snapshot() endpoint.SessionInfo {
+	info := s.info
+	s.tagsMu.RLock()
+	defer s.tagsMu.RUnlock()
+	info.Tags = make(map[string]string, len(s.tags))
+	for key, value := range s.tags {
+		info.Tags[key] = value
+	}
+	return info
+}
+
+// close 停止发送广播消息
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// enqueue 把广播消息放到发送队列，连接已经关闭或者队列已满返回false，不阻塞
+func (c *connection) enqueue(messageType int, data []byte) bool {
+	s := c.session
+	select {
+	case <-s.done:
+		return false
+	default:
+	}
+	s.outboxOnce.Do(func() {
+		s.outbox = make(chan outbound, s.queueSize)
+		go c.writeOutbox()
+	})
+	select {
+	case s.outbox <- outbound{messageType: messageType, data: data}:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeOutbox 把发送队列的消息写入连接，写入失败或者连接关闭后退出
+func (c *connection) writeOutbox() {
+	s := c.session
+	for {
+		select {
+		case <-s.done:
+			return
+		case m := <-s.outbox:
+			if err := c.write(m.messageType, m.data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// SetSessionTag 给当前websocket连接设置标签，用于广播时筛选连接，例如在拦截器中把url参数deviceId设置为标签：
+//
+//	if out, ok := exchange.Out.(*websocket.ResponseMessage); ok {
+//		out.SetSessionTag("deviceId", exchange.In.GetParam("deviceId"))
+//	}
+//
+// 连接建立时设置标签需要配置 Config.ConnectRouterId，拦截器会处理连接建立消息
+func (r *ResponseMessage) SetSessionTag(key, value string) bool {
+	if r.conn == nil || r.conn.session == nil {
+		return false
+	}
+	r.conn.session.setTag(key, value)
+	return true
+}
+
+// SessionId 当前websocket连接的id
+func (r *ResponseMessage) SessionId() string {
+	if r.conn == nil {
+		return ""
+	}
+	return r.conn.id
+}
+
+// Sessions 当前连接的会话信息
+func (ws *Websocket) Sessions() []endpoint.SessionInfo {
+	var sessions []endpoint.SessionInfo
+	ws.conns.Range(func(key, value any) bool {
+		if c := value.(*connection); c.session != nil {
+			sessions = append(sessions, c.session.snapshot())
+		}
+		return true
+	})
+	return sessions
+}
+
+// Broadcast 把数据以TextMessage推送给filter匹配的连接，filter为nil推送给所有连接，返回放到发送队列的连接数
+// 每个连接使用单独的发送队列，慢连接的队列满时丢弃发送给该连接的消息，不阻塞其他连接
+func (ws *Websocket) Broadcast(data []byte, filter func(endpoint.SessionInfo) bool) int {
+	return ws.broadcast(websocket.TextMessage, data, filter)
+}
+
+// BroadcastBinary 把数据以BinaryMessage推送给filter匹配的连接，见 Broadcast
+func (ws *Websocket) BroadcastBinary(data []byte, filter func(endpoint.SessionInfo) bool) int {
+	return ws.broadcast(websocket.BinaryMessage, data, filter)
+}
+
+func (ws *Websocket) broadcast(messageType int, data []byte, filter func(endpoint.SessionInfo) bool) int {
+	count := 0
+	ws.conns.Range(func(key, value any) bool {
+		c := value.(*connection)
+		if c.session == nil {
+			return true
+		}
+		if filter != nil && !filter(c.session.snapshot()) {
+			return true
+		}
+		if c.enqueue(messageType, data) {
+			count++
+		}
+		return true
+	})
+	return count
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestBroadcast(t *testing.T) {
+	var ep = &Endpoint{}
+	assert.Nil(t, ep.Init(engine.NewConfig(types.WithDefaultPool()), types.Configuration{
+		"server": ":9156", "allowCors": true, "connectRouterId": "connect", "broadcastQueueSize": 2}))
+	defer ep.Destroy()
+	//连接建立时把url参数deviceId设置为连接标签
+	ep.AddInterceptors(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		if out, ok := exchange.Out.(*ResponseMessage); ok && exchange.In.GetMsg().Type == MsgTypeConnect {
+			out.SetSessionTag("deviceId", exchange.In.GetParam("deviceId"))
+		}
+		return true
+	})
+	connected := make(chan struct{}, 4)
+	router := impl.NewRouter().SetId("connect").From("/api/connect").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		connected <- struct{}{}
+		return true
+	}).End()
+	_, err := ep.AddRouter(router)
+	assert.Nil(t, err)
+	router = impl.NewRouter().From("/api/device").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		return true
+	}).End()
+	_, err = ep.AddRouter(router)
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	time.Sleep(time.Millisecond * 200)
+
+	assert.Equal(t, 1, len(endpoint.GetBroadcasters(":9156")))
+	var clients []*websocket.Conn
+	for _, deviceId := range []string{"d1", "d2", "d1"} {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:9156/api/device?deviceId="+deviceId, nil)
+		assert.Nil(t, err)
+		defer conn.Close()
+		clients = append(clients, conn)
+		<-connected
+	}
+	assert.Equal(t, 3, len(ep.Sessions()))
+	receive := func(conn *websocket.Conn) (int, string) {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		mt, data, err := conn.ReadMessage()
+		assert.Nil(t, err)
+		return mt, string(data)
+	}
+
+	byDevice := func(deviceId string) func(endpoint.SessionInfo) bool {
+		return func(session endpoint.SessionInfo) bool {
+			return session.Tags["deviceId"] == deviceId
+		}
+	}
+	assert.Equal(t, 2, ep.Broadcast([]byte("to d1"), byDevice("d1")))
+	for _, conn := range []*websocket.Conn{clients[0], clients[2]} {
+		mt, data := receive(conn)
+		assert.Equal(t, websocket.TextMessage, mt)
+		assert.Equal(t, "to d1", data)
+	}
+	assert.Equal(t, 3, ep.BroadcastBinary([]byte{0x01}, nil))
+	for _, conn := range clients {
+		mt, data := receive(conn)
+		assert.Equal(t, websocket.BinaryMessage, mt)
+		assert.Equal(t, "\x01", data)
+	}
+
+	//写入阻塞的连接丢弃广播消息，不阻塞其他连接
+	var slow *connection
+	ep.conns.Range(func(key, value any) bool {
+		if c := value.(*connection); c.session.snapshot().Tags["deviceId"] == "d2" {
+			slow = c
+		}
+		return true
+	})
+	slow.mu.Lock()
+	dropped := false
+	for i := 0; i < 10 && !dropped; i++ {
+		dropped = ep.Broadcast([]byte("to d2"), byDevice("d2")) == 0
+	}
+	assert.True(t, dropped)
+	assert.Equal(t, 2, ep.Broadcast([]byte("all"), nil))
+	for _, conn := range []*websocket.Conn{clients[0], clients[2]} {
+		_, data := receive(conn)
+		assert.Equal(t, "all", data)
+	}
+	slow.mu.Unlock()
+
+	ep.Destroy()
+	assert.Equal(t, 0, len(endpoint.GetBroadcasters(":9156")))
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+const (
+	// MsgTypeConnect 连接建立消息的消息类型，见 Config.ConnectRouterId
+	MsgTypeConnect = "CONNECT"
+	// MsgTypeDisconnect 连接断开消息的消息类型，见 Config.DisconnectRouterId
+	MsgTypeDisconnect = "DISCONNECT"
+	// KeySessionId 连接id放到连接和断开消息元数据的key
+	KeySessionId = "sessionId"
+	// KeyDisconnectReason 断开原因放到断开消息元数据的key
+	KeyDisconnectReason = "disconnectReason"
+	// KeyConnectionDuration 连接时长（毫秒）放到断开消息元数据的key
+	KeyConnectionDuration = "connectionDuration"
+)
+
+// 连接断开的原因
+const (
+	// DisconnectReasonClosed 客户端关闭连接或者连接异常断开
+	DisconnectReasonClosed = "closed"
+	// DisconnectReasonPongTimeout 发送ping后没有在 Config.PongTimeout 内收到pong
+	DisconnectReasonPongTimeout = "pongTimeout"
+	// DisconnectReasonIdleTimeout 超过 Config.MaxIdleTime 没有收到数据帧
+	DisconnectReasonIdleTimeout = "idleTimeout"
+	// DisconnectReasonRouterDisabled 路由已经删除
+	DisconnectReasonRouterDisabled = "routerDisabled"
+	// DisconnectReasonError 读取连接的其他错误
+	DisconnectReasonError = "error"
+)
+
+// keepalive 连接的心跳和空闲检测，没有配置 PingInterval 和 MaxIdleTime 时为nil，不改变连接的行为
+type keepalive struct {
+	conn         *websocket.Conn
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	maxIdleTime  time.Duration
+	idleTimer    *time.Timer
+	//是否因为空闲超时关闭
+	idle     int32
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newKeepalive 开始发送ping和空闲检测，需要在连接关闭后调用 stop
+func (ws *Websocket) newKeepalive(c *websocket.Conn) *keepalive {
+	if ws.Config.PingInterval <= 0 && ws.Config.MaxIdleTime <= 0 {
+		return nil
+	}
+	k := &keepalive{
+		conn:         c,
+		pingInterval: time.Duration(ws.Config.PingInterval) * time.Second,
+		pongTimeout:  time.Duration(ws.Config.PongTimeout) * time.Second,
+		maxIdleTime:  time.Duration(ws.Config.MaxIdleTime) * time.Second,
+		done:         make(chan struct{}),
+	}
+	if k.pingInterval > 0 {
+		if k.pongTimeout <= 0 {
+			k.pongTimeout = k.pingInterval
+		}
+		k.extendReadDeadline()
+		c.SetPongHandler(func(string) error {
+			k.extendReadDeadline()
+			return nil
+		})
+		go k.ping()
+	}
+	if k.maxIdleTime > 0 {
+		k.idleTimer = time.AfterFunc(k.maxIdleTime, k.closeIdle)
+	}
+	return k
+}
+
+// extendReadDeadline 在下一次ping之后的 pongTimeout 内没有收到任何帧则读取超时
+func (k *keepalive) extendReadDeadline() {
+	_ = k.conn.SetReadDeadline(time.Now().Add(k.pingInterval + k.pongTimeout))
+}
+
+// ping 定时发送ping，WriteControl 可以和其他写入并发调用
+func (k *keepalive) ping() {
+	ticker := time.NewTicker(k.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-ticker.C:
+			if err := k.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(k.pongTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// closeIdle 空闲超时，发送关闭帧并关闭连接，读取的协程返回错误
+func (k *keepalive) closeIdle() {
+	atomic.StoreInt32(&k.idle, 1)
+	_ = k.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "idle timeout"), time.Now().Add(time.Second))
+	_ = k.conn.Close()
+}
+
+// received 收到数据帧
+func (k *keepalive) received() {
+	if k == nil {
+		return
+	}
+	if k.pingInterval > 0 {
+		k.extendReadDeadline()
+	}
+	if k.idleTimer != nil {
+		k.idleTimer.Reset(k.maxIdleTime)
+	}
+}
+
+func (k *keepalive) stop() {
+	if k == nil {
+		return
+	}
+	k.stopOnce.Do(func() {
+		close(k.done)
+		if k.idleTimer != nil {
+			k.idleTimer.Stop()
+		}
+	})
+}
+
+// reason 读取连接出错的断开原因
+func (k *keepalive) reason(err error) string {
+	var netErr net.Error
+	if k != nil && atomic.LoadInt32(&k.idle) == 1 {
+		return DisconnectReasonIdleTimeout
+	} else if k != nil && errors.As(err, &netErr) && netErr.Timeout() {
+		return DisconnectReasonPongTimeout
+	} else if _, ok := err.(*websocket.CloseError); ok {
+		return DisconnectReasonClosed
+	}
+	return DisconnectReasonError
+}
+
+// connect 把连接建立消息交给 Config.ConnectRouterId 指定的路由处理，路由的响应发送给该连接
+func (ws *Websocket) connect(r *http.Request, params httprouter.Params, principal *endpoint.Principal, conn *connection) {
+	ws.lifecycle(ws.Config.ConnectRouterId, MsgTypeConnect, r, params, principal, conn, nil)
+}
+
+// disconnect 把连接断开消息交给 Config.DisconnectRouterId 指定的路由处理
+func (ws *Websocket) disconnect(r *http.Request, params httprouter.Params, principal *endpoint.Principal, connId, reason string, duration time.Duration) {
+	ws.lifecycle(ws.Config.DisconnectRouterId, MsgTypeDisconnect, r, params, principal, &connection{id: connId}, map[string]string{
+		KeyDisconnectReason:   reason,
+		KeyConnectionDuration: strconv.FormatInt(duration.Milliseconds(), 10),
+	})
+}
+
+// lifecycle 把连接建立或者断开消息交给routerId指定的路由处理，没有配置或者路由已经删除时忽略
+func (ws *Websocket) lifecycle(routerId, msgType string, r *http.Request, params httprouter.Params, principal *endpoint.Principal, conn *connection, values map[string]string) {
+	if routerId == "" {
+		return
+	}
+	ws.RLock()
+	router, ok := ws.RouterStorage[routerId]
+	ws.RUnlock()
+	if !ok || router.IsDisable() {
+		return
+	}
+	metadata := types.NewMetadata()
+	ws.putMetadata(metadata, r, params, principal)
+	metadata.PutValue(KeySessionId, conn.id)
+	for key, value := range values {
+		metadata.PutValue(key, value)
+	}
+	endpoint.Origin{Type: Type, Id: ws.OriginId(), Connection: conn.id}.PutToMetadata(metadata)
+	msg := types.NewMsg(0, msgType, types.JSON, metadata, "{}")
+	out := &ResponseMessage{
+		log: func(format string, v ...interface{}) {
+			ws.Printf(format, v...)
+		},
+		request: r,
+	}
+	if conn.conn != nil {
+		out.conn = conn
+	}
+	exchange := &endpoint.Exchange{
+		In:  &RequestMessage{request: r, Params: params, msg: &msg},
+		Out: out,
+	}
+	//连接已经关闭，请求的上下文可能已经取消
+	ws.DoProcess(context.Background(), router, exchange)
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestKeepalive(t *testing.T) {
+	start := func(configuration types.Configuration) (*Endpoint, chan types.RuleMsg) {
+		var ep = &Endpoint{}
+		configuration["allowCors"] = true
+		configuration["disconnectRouterId"] = "disconnect"
+		assert.Nil(t, ep.Init(engine.NewConfig(types.WithDefaultPool()), configuration))
+		router := impl.NewRouter().From("/api/device").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			exchange.Out.SetBody(exchange.In.Body())
+			return true
+		}).End()
+		_, err := ep.AddRouter(router)
+		assert.Nil(t, err)
+		msgs := make(chan types.RuleMsg, 4)
+		router = impl.NewRouter().SetId("disconnect").From("/api/disconnect").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			msgs <- *exchange.In.GetMsg()
+			return true
+		}).End()
+		_, err = ep.AddRouter(router)
+		assert.Nil(t, err)
+		assert.Nil(t, ep.Start())
+		time.Sleep(time.Millisecond * 200)
+		return ep, msgs
+	}
+	receive := func(msgs chan types.RuleMsg) types.RuleMsg {
+		select {
+		case msg := <-msgs:
+			return msg
+		case <-time.After(time.Second * 5):
+			t.Fatal("disconnect message timeout")
+			return types.RuleMsg{}
+		}
+	}
+
+	ep, msgs := start(types.Configuration{"server": ":9144", "pingInterval": 1, "pongTimeout": 1})
+	defer ep.Destroy()
+	//读取连接时自动回复pong，连接保持
+	var pings int32
+	alive, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:9144/api/device?deviceId=d1", nil)
+	assert.Nil(t, err)
+	alive.SetPingHandler(func(appData string) error {
+		atomic.AddInt32(&pings, 1)
+		return alive.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	//不读取连接，不回复pong
+	silent, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:9144/api/device?deviceId=d2", nil)
+	assert.Nil(t, err)
+	defer silent.Close()
+
+	msg := receive(msgs)
+	assert.Equal(t, MsgTypeDisconnect, msg.Type)
+	assert.Equal(t, "d2", msg.Metadata.GetValue("deviceId"))
+	assert.Equal(t, DisconnectReasonPongTimeout, msg.Metadata.GetValue(KeyDisconnectReason))
+	assert.True(t, msg.Metadata.GetValue(KeySessionId) != "")
+	assert.Equal(t, msg.Metadata.GetValue(KeySessionId), endpoint.OriginFromMetadata(msg.Metadata).Connection)
+	assert.True(t, atomic.LoadInt32(&pings) >= 1)
+
+	assert.Nil(t, alive.WriteMessage(websocket.TextMessage, []byte("online")))
+	_ = alive.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	msg = receive(msgs)
+	assert.Equal(t, "d1", msg.Metadata.GetValue("deviceId"))
+	assert.Equal(t, DisconnectReasonClosed, msg.Metadata.GetValue(KeyDisconnectReason))
+	_ = alive.Close()
+
+	//空闲超时
+	idleEp, idleMsgs := start(types.Configuration{"server": ":9145", "maxIdleTime": 1})
+	defer idleEp.Destroy()
+	idle, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:9145/api/device?deviceId=d3", nil)
+	assert.Nil(t, err)
+	defer idle.Close()
+	_, _, err = idle.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+	msg = receive(idleMsgs)
+	assert.Equal(t, "d3", msg.Metadata.GetValue("deviceId"))
+	assert.Equal(t, DisconnectReasonIdleTimeout, msg.Metadata.GetValue(KeyDisconnectReason))
+}
+
+func TestConnectionLifecycle(t *testing.T) {
+	var ep = &Endpoint{}
+	assert.Nil(t, ep.Init(engine.NewConfig(types.WithDefaultPool()), types.Configuration{
+		"server": ":9149", "allowCors": true, "connectRouterId": "connect", "disconnectRouterId": "disconnect"}))
+	defer ep.Destroy()
+	router := impl.NewRouter().From("/api/device").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		return true
+	}).End()
+	_, err := ep.AddRouter(router)
+	assert.Nil(t, err)
+	msgs := make(chan types.RuleMsg, 4)
+	router = impl.NewRouter().SetId("connect").From("/api/connect").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		msgs <- *exchange.In.GetMsg()
+		//连接消息的响应发送给该连接
+		exchange.Out.SetBody([]byte("welcome"))
+		return true
+	}).End()
+	_, err = ep.AddRouter(router)
+	assert.Nil(t, err)
+	router = impl.NewRouter().SetId("disconnect").From("/api/disconnect").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		msgs <- *exchange.In.GetMsg()
+		return true
+	}).End()
+	_, err = ep.AddRouter(router)
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	time.Sleep(time.Millisecond * 200)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:9149/api/device?deviceId=d1", nil)
+	assert.Nil(t, err)
+	connectMsg := <-msgs
+	assert.Equal(t, MsgTypeConnect, connectMsg.Type)
+	assert.Equal(t, "d1", connectMsg.Metadata.GetValue("deviceId"))
+	_, data, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "welcome", string(data))
+
+	//没有发送关闭帧直接断开连接
+	time.Sleep(time.Millisecond * 100)
+	_ = conn.UnderlyingConn().Close()
+	select {
+	case msg := <-msgs:
+		assert.Equal(t, MsgTypeDisconnect, msg.Type)
+		assert.Equal(t, connectMsg.Metadata.GetValue(KeySessionId), msg.Metadata.GetValue(KeySessionId))
+		duration, err := strconv.Atoi(msg.Metadata.GetValue(KeyConnectionDuration))
+		assert.Nil(t, err)
+		assert.True(t, duration >= 100)
+	case <-time.After(time.Second * 5):
+		t.Fatal("disconnect message timeout")
+	}
+}
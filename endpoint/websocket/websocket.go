@@ -39,7 +39,9 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/gofrs/uuid/v5"
 	"github.com/gorilla/websocket"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rulego/rulego/api/types"
@@ -140,7 +142,7 @@ type ResponseMessage struct {
 	messageType int
 	log         func(format string, v ...interface{})
 	request     *http.Request
-	conn        *websocket.Conn
+	conn        *connection
 	body        []byte
 	to          string
 	msg         *types.RuleMsg
@@ -202,7 +204,7 @@ func (r *ResponseMessage) SetBody(body []byte) {
 			r.messageType = websocket.TextMessage
 		}
 
-		if err := r.conn.WriteMessage(r.messageType, body); err != nil {
+		if err := r.conn.write(r.messageType, body); err != nil {
 			r.SetError(err)
 		}
 	}
@@ -220,6 +222,22 @@ func (r *ResponseMessage) GetError() error {
 	return r.err
 }
 
+// connection websocket连接，同一个连接的写入需要串行
+type connection struct {
+	id   string
+	conn *websocket.Conn
+	mu   sync.Mutex
+	//会话信息、标签和广播发送队列
+	session *session
+}
+
+// write 写入消息
+func (c *connection) write(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteMessage(messageType, data)
+}
+
 // Config Websocket 服务配置
 type Config = rest.Config
 
@@ -229,6 +247,8 @@ type Websocket struct {
 	//配置
 	Config   Config
 	Upgrader websocket.Upgrader
+	//活跃的连接，连接id->*connection，用于replyTo节点回复和广播
+	conns sync.Map
 }
 
 // Type 组件类型
@@ -251,9 +271,7 @@ func (ws *Websocket) Init(ruleConfig types.Config, configuration types.Configura
 	if err != nil {
 		return err
 	}
-	ws.Upgrader.CheckOrigin = func(r *http.Request) bool {
-		return ws.Config.AllowCors // 允许所有跨域请求
-	}
+	ws.Upgrader.CheckOrigin = ws.checkOrigin
 	ws.Rest = &rest.Rest{}
 	if err = ws.Rest.Init(ruleConfig, configuration); err != nil {
 		return err
@@ -261,6 +279,14 @@ func (ws *Websocket) Init(ruleConfig types.Config, configuration types.Configura
 	return err
 }
 
+// checkOrigin 开启跨域时允许 AllowedOrigins 中的来源，没有配置则允许所有来源
+func (ws *Websocket) checkOrigin(r *http.Request) bool {
+	if !ws.Config.AllowCors {
+		return false
+	}
+	return len(ws.Config.AllowedOrigins) == 0 || rest.MatchOrigin(ws.Config.AllowedOrigins, r.Header.Get(rest.HeaderKeyOrigin))
+}
+
 func (ws *Websocket) Id() string {
 	return ws.Config.Server
 }
@@ -269,12 +295,7 @@ func (ws *Websocket) AddRouter(router endpoint.Router, params ...interface{}) (i
 	if router == nil {
 		return "", errors.New("router can not nil")
 	} else {
-		defer func() {
-			if e := recover(); e != nil {
-				err = fmt.Errorf("addRouter err :%v", e)
-			}
-		}()
-		ws.addRouter(router)
+		err = ws.addRouter(router)
 		return router.GetId(), err
 	}
 }
@@ -300,12 +321,14 @@ func (ws *Websocket) Printf(format string, v ...interface{}) {
 }
 
 func (ws *Websocket) Start() error {
+	//先注册，避免内部的rest端点注册为回复器
+	ws.RegisterOrigin(ws)
 	if ws.OnEvent != nil {
 		ws.OnEvent(endpoint.EventInitServer, ws.Rest.Server)
 	}
-	ws.Upgrader.CheckOrigin = func(r *http.Request) bool {
-		return ws.Config.AllowCors // 允许所有跨域请求
-	}
+	ws.Upgrader.CheckOrigin = ws.checkOrigin
+	//使用服务地址注册广播器，wsPush节点通过服务地址找到该端点
+	endpoint.RegisterBroadcaster(ws.Id(), ws)
 	if ws.Rest.Started() {
 		return nil
 	}
@@ -315,8 +338,24 @@ func (ws *Websocket) Start() error {
 	return nil
 }
 
+// Destroy 销毁
+func (ws *Websocket) Destroy() {
+	endpoint.UnregisterBroadcaster(ws.Id(), ws)
+	if ws.Rest != nil {
+		ws.Rest.Destroy()
+	}
+}
+
+// tokenQueryParam 读取令牌的url参数
+func (ws *Websocket) tokenQueryParam() string {
+	if ws.Config.TokenQueryParam != "" {
+		return ws.Config.TokenQueryParam
+	}
+	return rest.DefaultTokenQueryParam
+}
+
 // addRouter 注册1个或者多个路由
-func (ws *Websocket) addRouter(routers ...endpoint.Router) *Websocket {
+func (ws *Websocket) addRouter(routers ...endpoint.Router) error {
 	ws.Lock()
 	defer ws.Unlock()
 
@@ -326,13 +365,14 @@ func (ws *Websocket) addRouter(routers ...endpoint.Router) *Websocket {
 	for _, item := range routers {
 		item.SetParams("GET")
 		ws.CheckAndSetRouterId(item)
-		//存储路由
-		ws.RouterStorage[item.GetId()] = item
 		//添加到http路由器
-		ws.Router().Handle("GET", item.FromToString(), ws.handler(item))
+		if err := rest.Handle(ws.Router(), "GET", item.FromToString(), ws.handler(item)); err != nil {
+			return err
+		}
+		//注册成功后存储路由
+		ws.RouterStorage[item.GetId()] = item
 	}
-
-	return ws
+	return nil
 }
 
 func (ws *Websocket) handler(router endpoint.Router) httprouter.Handle {
@@ -346,6 +386,25 @@ func (ws *Websocket) handler(router endpoint.Router) httprouter.Handle {
 			ws.Printf("Websocket handler upgrade:", err)
 			return
 		}
+		tokenParam := ws.tokenQueryParam()
+		principal, err := ws.Authenticate(rest.BearerToken(r, tokenParam), rest.TransportMeta("ws", r))
+		if err != nil {
+			//校验失败，发送关闭帧
+			_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()), time.Now().Add(time.Second))
+			_ = c.Close()
+			return
+		}
+		connId, _ := uuid.NewV4()
+		connectedAt := time.Now()
+		conn := &connection{id: connId.String(), conn: c, session: newSession(endpoint.SessionInfo{
+			Id:          connId.String(),
+			RemoteAddr:  r.RemoteAddr,
+			Path:        r.URL.Path,
+			ConnectedAt: connectedAt,
+		}, ws.Config.BroadcastQueueSize)}
+		ws.conns.Store(conn.id, conn)
+		defer ws.conns.Delete(conn.id)
+		defer conn.session.close()
 		connectExchange := &endpoint.Exchange{
 			In: &RequestMessage{
 				request: r,
@@ -357,7 +416,7 @@ func (ws *Websocket) handler(router endpoint.Router) httprouter.Handle {
 					ws.Printf(format, v...)
 				},
 				request: r,
-				conn:    c,
+				conn:    conn,
 			}}
 		if ws.OnEvent != nil {
 			ws.OnEvent(endpoint.EventConnect, connectExchange)
@@ -373,20 +432,27 @@ func (ws *Websocket) handler(router endpoint.Router) httprouter.Handle {
 			}
 		}()
 
+		ws.connect(r, params, principal, conn)
+		ka := ws.newKeepalive(c)
+		defer ka.stop()
+		var reason string
 		for {
 			mt, message, err := c.ReadMessage()
 			if err != nil {
 				if ws.OnEvent != nil {
 					ws.OnEvent(endpoint.EventDisconnect, connectExchange, w, r, params)
 				}
+				reason = ka.reason(err)
 				break
 			}
+			ka.received()
 
 			if router.IsDisable() {
 				if ws.OnEvent != nil {
 					ws.OnEvent(endpoint.EventDisconnect, connectExchange, w, r, params)
 				}
 				http.NotFound(w, r)
+				reason = DisconnectReasonRouterDisabled
 				break
 			}
 			if mt != websocket.BinaryMessage && mt != websocket.TextMessage {
@@ -405,28 +471,57 @@ func (ws *Websocket) handler(router endpoint.Router) httprouter.Handle {
 						ws.Printf(format, v...)
 					},
 					request:     r,
-					conn:        c,
+					conn:        conn,
 					messageType: mt,
 				}}
 
 			msg := exchange.In.GetMsg()
-			//把路径参数放到msg元数据中
-			for _, param := range params {
-				msg.Metadata.PutValue(param.Key, param.Value)
-			}
-
+			ws.putMetadata(msg.Metadata, r, params, principal)
 			msg.Metadata.PutValue("messageType", strconv.Itoa(mt))
+			endpoint.Origin{Type: Type, Id: ws.OriginId(), Connection: conn.id}.PutToMetadata(msg.Metadata)
+			ws.DoProcess(r.Context(), router, exchange)
+		}
+		ka.stop()
+		ws.disconnect(r, params, principal, conn.id, reason, time.Since(connectedAt))
+	}
+}
 
-			//把url?参数放到msg元数据中
-			for key, value := range r.URL.Query() {
-				if len(value) > 1 {
-					msg.Metadata.PutValue(key, str.ToString(value))
-				} else {
-					msg.Metadata.PutValue(key, value[0])
-				}
+// putMetadata 把路径参数、url参数和认证主体放到msg元数据中，令牌不放到元数据中
+func (ws *Websocket) putMetadata(metadata *types.Metadata, r *http.Request, params httprouter.Params, principal *endpoint.Principal) {
+	for _, param := range params {
+		metadata.PutValue(param.Key, param.Value)
+	}
+	tokenParam := ws.tokenQueryParam()
+	for key, value := range r.URL.Query() {
+		if principal != nil && key == tokenParam {
+			continue
+		}
+		if len(value) > 1 {
+			metadata.PutValue(key, str.ToString(value))
+		} else {
+			metadata.PutValue(key, value[0])
+		}
+	}
+	if principal != nil {
+		principal.PutToMetadata(metadata)
+	}
+}
 
-			}
-			ws.DoProcess(r.Context(), router, exchange)
+// Reply 把消息数据写入消息来源的websocket连接(元数据 originConnection)，连接已经关闭返回 endpoint.ErrOriginGone
+// 消息类型使用元数据 messageType，没有则二进制数据使用BinaryMessage，其他使用TextMessage
+func (ws *Websocket) Reply(msg types.RuleMsg) error {
+	connId := msg.Metadata.GetValue(endpoint.OriginConnectionKey)
+	v, ok := ws.conns.Load(connId)
+	if !ok {
+		return fmt.Errorf("%w: websocket connection %s is closed", endpoint.ErrOriginGone, connId)
+	}
+	messageType, _ := strconv.Atoi(msg.Metadata.GetValue("messageType"))
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		if msg.DataType == types.BINARY {
+			messageType = websocket.BinaryMessage
+		} else {
+			messageType = websocket.TextMessage
 		}
 	}
+	return v.(*connection).write(messageType, msg.GetBytes())
 }
@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -303,3 +304,61 @@ func newWebsocketServe(t *testing.T, restEndpoint *rest.Rest) endpoint.Endpoint
 	assert.NotNil(t, wsEndpoint.Router())
 	return wsEndpoint
 }
+
+func TestWsReply(t *testing.T) {
+	ruleChain := `{
+	  "ruleChain": {"id": "wsReply"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':'reply:'+msg,'metadata':metadata,'msgType':msgType};"}},
+		  {"id": "s2", "type": "replyTo"}
+		],
+		"connections": [{"fromId": "s1", "toId": "s2", "type": "Success"}]
+	  }
+	}`
+	config := engine.NewConfig(types.WithDefaultPool())
+	ruleEngine, err := engine.New("wsReply", []byte(ruleChain), engine.WithConfig(config))
+	assert.Nil(t, err)
+	defer engine.Del("wsReply")
+
+	var wsEndpoint = &Endpoint{}
+	err = wsEndpoint.Init(config, types.Configuration{"server": ":9101", "allowCors": true})
+	assert.Nil(t, err)
+	defer wsEndpoint.Destroy()
+	msgs := make(chan types.RuleMsg, 1)
+	//异步路由，通过replyTo节点回复
+	router := impl.NewRouter().From("/api/reply").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		msgs <- *exchange.In.GetMsg()
+		return true
+	}).To("chain:wsReply").End()
+	assert.Nil(t, wsEndpoint.Start())
+	_, err = wsEndpoint.AddRouter(router, "GET")
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 200)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://127.0.0.1:9101/api/reply", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte("hello")))
+	_, p, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "reply:hello", string(p))
+
+	msg := <-msgs
+	origin := endpoint.OriginFromMetadata(msg.Metadata)
+	assert.Equal(t, Type, origin.Type)
+	assert.Equal(t, wsEndpoint.OriginId(), origin.Id)
+	assert.True(t, origin.Connection != "")
+
+	t.Run("ExpiredConnection", func(t *testing.T) {
+		_ = conn.Close()
+		time.Sleep(time.Millisecond * 200)
+		var endErr error
+		var endRelationType string
+		ruleEngine.OnMsgAndWait(msg, types.WithStartNode("s2"), types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			endErr = err
+			endRelationType = relationType
+		}))
+		assert.Equal(t, types.Failure, endRelationType)
+		assert.True(t, errors.Is(endErr, endpoint.ErrOriginGone))
+	})
+}
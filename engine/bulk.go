@@ -0,0 +1,456 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/str"
+)
+
+// AdditionalInfoKeyTags is the additionalInfo key of the rule chain tags, used by BulkSelector.Tags.
+// The value is an array of strings, or a string of tags separated by ",".
+const AdditionalInfoKeyTags = "tags"
+
+// DefaultBulkWorkers is the default number of rule chains processed concurrently by a bulk job.
+const DefaultBulkWorkers = 4
+
+// MaxBulkJobs is the number of bulk jobs kept for polling, the oldest completed jobs are removed first.
+const MaxBulkJobs = 100
+
+// Bulk operations.
+const (
+	BulkOpReload    = "reload"
+	BulkOpPatchNode = "patchNode"
+	BulkOpEnable    = "enable"
+	BulkOpDisable   = "disable"
+)
+
+// Results of a rule chain in a bulk job.
+const (
+	// BulkResultUpdated the rule chain is updated.
+	BulkResultUpdated = "updated"
+	// BulkResultUnchanged the rule chain is already in the target state, such as a job run again.
+	BulkResultUnchanged = "unchanged"
+	// BulkResultSkipped the rule chain is not processed, because it is disabled or the job is aborted by FailFast.
+	BulkResultSkipped = "skipped"
+	// BulkResultFailed the operation failed, the error is in BulkJobStatus.Errors.
+	BulkResultFailed = "failed"
+)
+
+// ErrEmptyBulkSelector is returned when a bulk selector selects nothing, use BulkSelector.All to select all rule chains.
+var ErrEmptyBulkSelector = errors.New("bulk selector is empty")
+
+// BulkSelector selects the rule chains of a bulk job.
+// A rule chain is selected if it is in Ids, or Ids is empty, and it has all the Tags.
+type BulkSelector struct {
+	// Ids are the rule chain ids. Ids not in the pool fail with an error.
+	Ids []string `json:"ids,omitempty"`
+	// Tags selects the rule chains having all the tags, see AdditionalInfoKeyTags.
+	Tags []string `json:"tags,omitempty"`
+	// All selects all rule chains in the pool when Ids and Tags are empty.
+	All bool `json:"all,omitempty"`
+}
+
+// BulkOptions are the options of a bulk job.
+type BulkOptions struct {
+	// Workers is the number of rule chains processed concurrently, default DefaultBulkWorkers.
+	Workers int `json:"workers,omitempty"`
+	// FailFast aborts the job on the first failure, the rule chains not yet processed are skipped.
+	// By default a failure does not abort the job.
+	FailFast bool `json:"failFast,omitempty"`
+}
+
+// BulkJobStatus is the progress of a bulk job.
+type BulkJobStatus struct {
+	JobId string `json:"jobId"`
+	Op    string `json:"op"`
+	// Total is the number of selected rule chains.
+	Total int `json:"total"`
+	// Done is the number of processed rule chains, including failed, skipped and unchanged.
+	Done int `json:"done"`
+	// Failed is the number of failed rule chains.
+	Failed int `json:"failed"`
+	// Skipped is the number of skipped rule chains.
+	Skipped int `json:"skipped"`
+	// Unchanged is the number of rule chains already in the target state.
+	Unchanged int `json:"unchanged"`
+	// Errors are the errors of the failed rule chains, keyed by rule chain id.
+	Errors map[string]string `json:"errors,omitempty"`
+	// Aborted is whether the job is aborted by FailFast.
+	Aborted bool `json:"aborted"`
+	// Completed is whether all rule chains are processed.
+	Completed bool `json:"completed"`
+}
+
+// BulkJob is a bulk operation running on the rule chains of a pool, see Pool.BulkReload.
+type BulkJob struct {
+	chainIds []string
+	mu       sync.Mutex
+	status   BulkJobStatus
+	done     chan struct{}
+}
+
+func newBulkJob(op string, chainIds []string) *BulkJob {
+	id, _ := uuid.NewV4()
+	return &BulkJob{
+		chainIds: chainIds,
+		status:   BulkJobStatus{JobId: id.String(), Op: op, Total: len(chainIds)},
+		done:     make(chan struct{}),
+	}
+}
+
+// Id returns the job id.
+func (j *BulkJob) Id() string {
+	return j.status.JobId
+}
+
+// Status returns a snapshot of the job progress.
+func (j *BulkJob) Status() BulkJobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := j.status
+	if j.status.Errors != nil {
+		status.Errors = make(map[string]string, len(j.status.Errors))
+		for k, v := range j.status.Errors {
+			status.Errors[k] = v
+		}
+	}
+	return status
+}
+
+// Wait waits until the job completes and returns its final status.
+func (j *BulkJob) Wait() BulkJobStatus {
+	<-j.done
+	return j.Status()
+}
+
+// Completed returns whether the job is completed.
+func (j *BulkJob) Completed() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// record records the result of a rule chain and returns the progress event data.
+func (j *BulkJob) record(chainId, result string, err error) map[string]interface{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Done++
+	data := map[string]interface{}{"op": j.status.Op, "chainId": chainId, "result": result}
+	switch result {
+	case BulkResultFailed:
+		j.status.Failed++
+		if j.status.Errors == nil {
+			j.status.Errors = make(map[string]string)
+		}
+		j.status.Errors[chainId] = err.Error()
+		data["error"] = err.Error()
+	case BulkResultSkipped:
+		j.status.Skipped++
+	case BulkResultUnchanged:
+		j.status.Unchanged++
+	}
+	j.putCounts(data)
+	return data
+}
+
+// complete marks the job completed and returns the completed event data.
+func (j *BulkJob) complete(aborted bool) map[string]interface{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Aborted = aborted
+	j.status.Completed = true
+	close(j.done)
+	data := map[string]interface{}{"op": j.status.Op, "aborted": aborted}
+	j.putCounts(data)
+	return data
+}
+
+func (j *BulkJob) putCounts(data map[string]interface{}) {
+	data["total"] = j.status.Total
+	data["done"] = j.status.Done
+	data["failed"] = j.status.Failed
+	data["skipped"] = j.status.Skipped
+	data["unchanged"] = j.status.Unchanged
+}
+
+// bulkApply applies a bulk operation to a rule engine and returns the result.
+type bulkApply func(ruleEngine *RuleEngine) (string, error)
+
+// BulkReload reloads the selected rule chains. Disabled rule chains are skipped.
+// It returns immediately, poll the job with BulkJob.Status or Pool.GetBulkJob, or subscribe to EventBulkProgress.
+func (g *Pool) BulkReload(selector BulkSelector, opts BulkOptions) (*BulkJob, error) {
+	return g.startBulkJob(BulkOpReload, selector, opts, func(ruleEngine *RuleEngine) (string, error) {
+		if ruleEngine.Disabled() {
+			return BulkResultSkipped, nil
+		}
+		if err := ruleEngine.Reload(); err != nil {
+			return BulkResultFailed, err
+		}
+		return BulkResultUpdated, nil
+	})
+}
+
+// BulkPatchNode merges patch into the configuration of every node of nodeType in the root of the selected rule chains,
+// and reloads the changed rule chains. Keys not in patch are kept.
+// Rule chains without such nodes, or already patched, are unchanged and not reloaded. Disabled rule chains are skipped.
+func (g *Pool) BulkPatchNode(selector BulkSelector, nodeType string, patch types.Configuration, opts BulkOptions) (*BulkJob, error) {
+	if nodeType == "" {
+		return nil, errors.New("node type can not empty")
+	}
+	if len(patch) == 0 {
+		return nil, errors.New("patch can not empty")
+	}
+	return g.startBulkJob(BulkOpPatchNode, selector, opts, func(ruleEngine *RuleEngine) (string, error) {
+		if ruleEngine.Disabled() {
+			return BulkResultSkipped, nil
+		}
+		return patchNodeConfig(ruleEngine, nodeType, patch)
+	})
+}
+
+// BulkSetDisabled disables or enables the selected rule chains, see RuleEngine.Disable and RuleEngine.Enable.
+// Rule chains already in the target state are unchanged.
+func (g *Pool) BulkSetDisabled(selector BulkSelector, disabled bool, opts BulkOptions) (*BulkJob, error) {
+	op := BulkOpEnable
+	if disabled {
+		op = BulkOpDisable
+	}
+	return g.startBulkJob(op, selector, opts, func(ruleEngine *RuleEngine) (string, error) {
+		if ruleEngine.Disabled() == disabled {
+			return BulkResultUnchanged, nil
+		}
+		var err error
+		if disabled {
+			err = ruleEngine.Disable()
+		} else {
+			err = ruleEngine.Enable()
+		}
+		if err != nil {
+			return BulkResultFailed, err
+		}
+		return BulkResultUpdated, nil
+	})
+}
+
+// GetBulkJob returns a bulk job by id, the last MaxBulkJobs jobs are kept.
+func (g *Pool) GetBulkJob(jobId string) (*BulkJob, bool) {
+	g.bulkJobsLock.Lock()
+	defer g.bulkJobsLock.Unlock()
+	job, ok := g.bulkJobs[jobId]
+	return job, ok
+}
+
+// SetEventBus sets the event bus receiving the bulk job events, EventBulkProgress and EventBulkCompleted.
+func (g *Pool) SetEventBus(eventBus types.EventBus) {
+	g.EventBus = eventBus
+}
+
+func (g *Pool) startBulkJob(op string, selector BulkSelector, opts BulkOptions, apply bulkApply) (*BulkJob, error) {
+	chainIds, err := g.selectChains(selector)
+	if err != nil {
+		return nil, err
+	}
+	job := newBulkJob(op, chainIds)
+	g.addBulkJob(job)
+	go g.runBulkJob(job, opts, apply)
+	return job, nil
+}
+
+// selectChains returns the sorted ids of the rule chains selected by selector.
+func (g *Pool) selectChains(selector BulkSelector) ([]string, error) {
+	if len(selector.Ids) == 0 && len(selector.Tags) == 0 && !selector.All {
+		return nil, ErrEmptyBulkSelector
+	}
+	var chainIds []string
+	if len(selector.Ids) > 0 {
+		seen := make(map[string]bool, len(selector.Ids))
+		for _, id := range selector.Ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			// Ids not in the pool are kept and fail when processed.
+			if v, ok := g.entries.Load(id); !ok || hasTags(v.(*RuleEngine), selector.Tags) {
+				chainIds = append(chainIds, id)
+			}
+		}
+	} else {
+		g.entries.Range(func(key, value any) bool {
+			if item, ok := value.(*RuleEngine); ok && hasTags(item, selector.Tags) {
+				chainIds = append(chainIds, str.ToString(key))
+			}
+			return true
+		})
+	}
+	sort.Strings(chainIds)
+	return chainIds, nil
+}
+
+func (g *Pool) runBulkJob(job *BulkJob, opts BulkOptions, apply bulkApply) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultBulkWorkers
+	}
+	var aborted int32
+	ids := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(job.chainIds); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				result, err := BulkResultSkipped, error(nil)
+				if atomic.LoadInt32(&aborted) == 0 {
+					result, err = g.applyBulk(id, apply)
+				}
+				if result == BulkResultFailed && opts.FailFast {
+					atomic.StoreInt32(&aborted, 1)
+				}
+				g.publishBulkEvent(types.EventBulkProgress, job.Id(), job.record(id, result, err))
+			}
+		}()
+	}
+	for _, id := range job.chainIds {
+		if atomic.LoadInt32(&aborted) == 1 {
+			g.publishBulkEvent(types.EventBulkProgress, job.Id(), job.record(id, BulkResultSkipped, nil))
+		} else {
+			ids <- id
+		}
+	}
+	close(ids)
+	wg.Wait()
+	g.publishBulkEvent(types.EventBulkCompleted, job.Id(), job.complete(atomic.LoadInt32(&aborted) == 1))
+}
+
+// applyBulk applies the operation to a rule chain, recovering from panics so that a bad rule chain does not break the job.
+func (g *Pool) applyBulk(chainId string, apply bulkApply) (result string, err error) {
+	v, ok := g.entries.Load(chainId)
+	if !ok {
+		return BulkResultFailed, fmt.Errorf("rule chain %s not found", chainId)
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			result, err = BulkResultFailed, fmt.Errorf("%v", e)
+		}
+	}()
+	return apply(v.(*RuleEngine))
+}
+
+func (g *Pool) publishBulkEvent(eventType, jobId string, data map[string]interface{}) {
+	if g.EventBus != nil {
+		g.EventBus.Publish(types.NewEvent(eventType, jobId, data))
+	}
+}
+
+// addBulkJob keeps the job for polling, removing the oldest completed jobs beyond MaxBulkJobs.
+func (g *Pool) addBulkJob(job *BulkJob) {
+	g.bulkJobsLock.Lock()
+	defer g.bulkJobsLock.Unlock()
+	if g.bulkJobs == nil {
+		g.bulkJobs = make(map[string]*BulkJob)
+	}
+	g.bulkJobs[job.Id()] = job
+	g.bulkJobIds = append(g.bulkJobIds, job.Id())
+	for i := 0; i < len(g.bulkJobIds) && len(g.bulkJobIds) > MaxBulkJobs; {
+		id := g.bulkJobIds[i]
+		if g.bulkJobs[id].Completed() {
+			delete(g.bulkJobs, id)
+			g.bulkJobIds = append(g.bulkJobIds[:i], g.bulkJobIds[i+1:]...)
+		} else {
+			i++
+		}
+	}
+}
+
+// hasTags returns whether the rule chain has all the tags.
+func hasTags(ruleEngine *RuleEngine, tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	chainTags := make(map[string]bool)
+	if v, ok := ruleEngine.Definition().RuleChain.GetAdditionalInfo(AdditionalInfoKeyTags); ok {
+		switch items := v.(type) {
+		case []interface{}:
+			for _, item := range items {
+				chainTags[str.ToString(item)] = true
+			}
+		case []string:
+			for _, item := range items {
+				chainTags[item] = true
+			}
+		case string:
+			for _, item := range strings.Split(items, ",") {
+				chainTags[strings.TrimSpace(item)] = true
+			}
+		}
+	}
+	for _, tag := range tags {
+		if !chainTags[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+// patchNodeConfig merges patch into the configuration of the root nodes of nodeType and reloads the rule chain if changed.
+func patchNodeConfig(ruleEngine *RuleEngine, nodeType string, patch types.Configuration) (string, error) {
+	parser := ruleEngine.Config.Parser
+	// Decode a copy of the definition, the running definition is not modified.
+	def, err := parser.DecodeRuleChain(ruleEngine.DSL())
+	if err != nil {
+		return BulkResultFailed, err
+	}
+	before, err := parser.EncodeRuleChain(def)
+	if err != nil {
+		return BulkResultFailed, err
+	}
+	for _, node := range def.Metadata.Nodes {
+		if node == nil || node.Type != nodeType {
+			continue
+		}
+		if node.Configuration == nil {
+			node.Configuration = make(types.Configuration)
+		}
+		for k, v := range patch {
+			node.Configuration[k] = v
+		}
+	}
+	after, err := parser.EncodeRuleChain(def)
+	if err != nil {
+		return BulkResultFailed, err
+	}
+	if bytes.Equal(before, after) {
+		return BulkResultUnchanged, nil
+	}
+	if err = ruleEngine.ReloadSelf(after); err != nil {
+		return BulkResultFailed, err
+	}
+	return BulkResultUpdated, nil
+}
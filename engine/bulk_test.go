@@ -0,0 +1,161 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+const bulkChain = `{"ruleChain":{"id":"%s","additionalInfo":{"tags":%s}},"metadata":{"nodes":[{"id":"s1","type":"jsTransform","configuration":{"jsScript":"msg.v=1; return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}]}}`
+
+// runBulkChain 执行规则链，返回输出消息的v字段和错误
+func runBulkChain(pool *Pool, id string) (string, error) {
+	e, _ := pool.Get(id)
+	var data string
+	var endErr error
+	e.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"), types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		v, _ := msg.GetDataPath("v")
+		data, endErr = fmt.Sprint(v), err
+	}))
+	return data, endErr
+}
+
+func TestBulkJob(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	bus := NewEventBus()
+	pool.SetEventBus(bus)
+	config := NewConfig(types.WithDefaultPool())
+	tags := map[string]string{"c1": `["scoring"]`, "c2": `["scoring"]`, "c3": `"scoring"`, "c4": `["scoring","beta"]`, "c5": `[]`}
+	for id, tag := range tags {
+		_, err := pool.New(id, []byte(fmt.Sprintf(bulkChain, id, tag)), WithConfig(config))
+		assert.Nil(t, err)
+	}
+	scoring := BulkSelector{Tags: []string{"scoring"}}
+	patch := types.Configuration{"jsScript": "msg.v=2; return {'msg':msg,'metadata':metadata,'msgType':msgType};"}
+
+	t.Run("Selector", func(t *testing.T) {
+		_, err := pool.BulkReload(BulkSelector{}, BulkOptions{})
+		assert.Equal(t, ErrEmptyBulkSelector, err)
+		_, err = pool.BulkPatchNode(scoring, "", patch, BulkOptions{})
+		assert.NotNil(t, err)
+		ids, _ := pool.selectChains(scoring)
+		assert.Equal(t, []string{"c1", "c2", "c3", "c4"}, ids)
+		ids, _ = pool.selectChains(BulkSelector{Ids: []string{"c4", "c5", "c4"}, Tags: []string{"beta"}})
+		assert.Equal(t, []string{"c4"}, ids)
+		ids, _ = pool.selectChains(BulkSelector{All: true})
+		assert.Equal(t, 5, len(ids))
+	})
+
+	t.Run("PatchNode", func(t *testing.T) {
+		sub, err := bus.Subscribe("bulk.*", 0)
+		assert.Nil(t, err)
+		defer sub.Unsubscribe()
+		job, err := pool.BulkPatchNode(scoring, "jsTransform", patch, BulkOptions{Workers: 2})
+		assert.Nil(t, err)
+		status := job.Wait()
+		assert.Equal(t, 4, status.Total)
+		assert.Equal(t, 4, status.Done)
+		assert.Equal(t, 0, status.Failed)
+		assert.Equal(t, 0, status.Unchanged)
+		assert.True(t, status.Completed)
+		for _, id := range []string{"c1", "c2", "c3", "c4"} {
+			v, _ := runBulkChain(pool, id)
+			assert.Equal(t, "2", v)
+		}
+		v, _ := runBulkChain(pool, "c5")
+		assert.Equal(t, "1", v)
+
+		var progress int
+		for event := range sub.C() {
+			assert.Equal(t, job.Id(), event.Subject)
+			if event.Type == types.EventBulkCompleted {
+				assert.Equal(t, 4, event.Data["done"])
+				break
+			}
+			progress++
+		}
+		assert.Equal(t, 4, progress)
+		polled, ok := pool.GetBulkJob(job.Id())
+		assert.True(t, ok)
+		assert.Equal(t, status, polled.Status())
+
+		//再次执行，已经更新的规则链不变
+		job, err = pool.BulkPatchNode(scoring, "jsTransform", patch, BulkOptions{})
+		assert.Nil(t, err)
+		status = job.Wait()
+		assert.Equal(t, 4, status.Done)
+		assert.Equal(t, 4, status.Unchanged)
+	})
+
+	t.Run("PartialFailure", func(t *testing.T) {
+		job, err := pool.BulkReload(BulkSelector{Ids: []string{"c1", "notFound", "c2"}}, BulkOptions{})
+		assert.Nil(t, err)
+		status := job.Wait()
+		assert.Equal(t, 3, status.Done)
+		assert.Equal(t, 1, status.Failed)
+		assert.Equal(t, "rule chain notFound not found", status.Errors["notFound"])
+		assert.False(t, status.Aborted)
+
+		badPatch := types.Configuration{"jsScript": "return {"}
+		job, err = pool.BulkPatchNode(BulkSelector{Ids: []string{"c1", "c2"}}, "jsTransform", badPatch, BulkOptions{})
+		assert.Nil(t, err)
+		status = job.Wait()
+		assert.Equal(t, 2, status.Failed)
+		assert.False(t, status.Aborted)
+		//更新失败的规则链使用原来的配置运行
+		v, _ := runBulkChain(pool, "c1")
+		assert.Equal(t, "2", v)
+
+		job, err = pool.BulkPatchNode(BulkSelector{All: true}, "jsTransform", badPatch, BulkOptions{Workers: 1, FailFast: true})
+		assert.Nil(t, err)
+		status = job.Wait()
+		assert.Equal(t, 5, status.Done)
+		assert.Equal(t, 1, status.Failed)
+		assert.Equal(t, 4, status.Skipped)
+		assert.True(t, status.Aborted)
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		beta := BulkSelector{Tags: []string{"beta"}}
+		job, err := pool.BulkSetDisabled(beta, true, BulkOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, job.Wait().Unchanged)
+		_, err = runBulkChain(pool, "c4")
+		assert.True(t, errors.Is(err, ErrDisabled))
+		e, _ := pool.Get("c4")
+		assert.True(t, e.(*RuleEngine).Definition().RuleChain.Disabled)
+
+		job, _ = pool.BulkSetDisabled(beta, true, BulkOptions{})
+		assert.Equal(t, 1, job.Wait().Unchanged)
+		//禁用的规则链不重新加载
+		job, _ = pool.BulkReload(scoring, BulkOptions{})
+		assert.Equal(t, 1, job.Wait().Skipped)
+
+		job, _ = pool.BulkSetDisabled(beta, false, BulkOptions{})
+		assert.Equal(t, 0, job.Wait().Failed)
+		v, err := runBulkChain(pool, "c4")
+		assert.Nil(t, err)
+		assert.Equal(t, "2", v)
+		assert.False(t, e.(*RuleEngine).Definition().RuleChain.Disabled)
+	})
+}
@@ -18,11 +18,15 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/utils/aes"
+	"github.com/rulego/rulego/utils/cast"
+	"github.com/rulego/rulego/utils/dsl"
 	"github.com/rulego/rulego/utils/str"
 )
 
@@ -53,11 +57,16 @@ type RuleChainCtx struct {
 	vars               map[string]string                             // Map of variables
 	decryptSecrets     map[string]string                             // Map of decrypted secrets
 	isEmpty            bool                                          // Indicates whether the rule chain has no nodes
+	guardrails         types.Guardrails                              // Execution guardrails of the rule chain
+	watchdog           watchdogConfig                                // Watchdog of the stuck messages
 	sync.RWMutex                                                     // Read/write mutex lock
 }
 
 // InitRuleChainCtx initializes a RuleChainCtx with the given configuration, aspects, and rule chain definition.
 func InitRuleChainCtx(config types.Config, aspects types.AspectList, ruleChainDef *types.RuleChain) (*RuleChainCtx, error) {
+	if ruleChainDef == nil {
+		return nil, errors.New("rule chain definition is nil")
+	}
 	// Retrieve aspects for the engine
 	chainBeforeInitAspects, _, _, afterReloadAspects, destroyAspects := aspects.GetEngineAspects()
 	for _, aspect := range chainBeforeInitAspects {
@@ -66,6 +75,16 @@ func InitRuleChainCtx(config types.Config, aspects types.AspectList, ruleChainDe
 		}
 	}
 
+	if err := checkRuleChainDef(ruleChainDef); err != nil {
+		return nil, err
+	}
+	// Lint warnings do not fail the initialization
+	if config.Logger != nil {
+		for _, warning := range dsl.Lint(*ruleChainDef, config.DocRequiredNodeCount) {
+			config.Logger.Printf("rule chain lint warning: %s", warning)
+		}
+	}
+
 	// Initialize a new RuleChainCtx with the provided configuration and aspects
 	var ruleChainCtx = &RuleChainCtx{
 		config:             config,
@@ -85,12 +104,22 @@ func InitRuleChainCtx(config types.Config, aspects types.AspectList, ruleChainDe
 		ruleChainCtx.Id = types.RuleNodeId{Id: ruleChainDef.RuleChain.ID, Type: types.CHAIN}
 	}
 	// Process the rule chain configuration's vars and secrets
-	if ruleChainDef != nil && ruleChainDef.RuleChain.Configuration != nil {
+	if ruleChainDef.RuleChain.Configuration != nil {
 		varsConfig := ruleChainDef.RuleChain.Configuration[types.Vars]
 		ruleChainCtx.vars = str.ToStringMapString(varsConfig)
 		envConfig := ruleChainDef.RuleChain.Configuration[types.Secrets]
 		secrets := str.ToStringMapString(envConfig)
 		ruleChainCtx.decryptSecrets = decryptSecret(secrets, []byte(config.SecretKey))
+		ruleChainCtx.guardrails = types.Guardrails{
+			MaxMsgBytes:        cast.ToInt(ruleChainDef.RuleChain.Configuration[types.MaxMsgBytesKey]),
+			MaxMetadataEntries: cast.ToInt(ruleChainDef.RuleChain.Configuration[types.MaxMetadataEntriesKey]),
+			MaxMetadataBytes:   cast.ToInt(ruleChainDef.RuleChain.Configuration[types.MaxMetadataBytesKey]),
+		}
+		watchdog, err := parseWatchdogConfig(ruleChainDef.RuleChain.Configuration)
+		if err != nil {
+			return nil, err
+		}
+		ruleChainCtx.watchdog = watchdog
 	}
 	nodeLen := len(ruleChainDef.Metadata.Nodes)
 	ruleChainCtx.nodeIds = make([]types.RuleNodeId, nodeLen)
@@ -100,9 +129,19 @@ func InitRuleChainCtx(config types.Config, aspects types.AspectList, ruleChainDe
 			item.Id = fmt.Sprintf(defaultNodeIdPrefix+"%d", index)
 		}
 		ruleNodeId := types.RuleNodeId{Id: item.Id, Type: types.NODE}
+		if _, ok := ruleChainCtx.nodes[ruleNodeId]; ok {
+			for _, nodeCtx := range ruleChainCtx.nodes {
+				nodeCtx.Destroy()
+			}
+			return nil, fmt.Errorf("duplicate node id:%s", item.Id)
+		}
 		ruleChainCtx.nodeIds[index] = ruleNodeId
 		ruleNodeCtx, err := InitRuleNodeCtx(config, ruleChainCtx, aspects, item)
 		if err != nil {
+			// Release the resources of the nodes that have been initialized
+			for _, nodeCtx := range ruleChainCtx.nodes {
+				nodeCtx.Destroy()
+			}
 			return nil, err
 		}
 		ruleChainCtx.nodes[ruleNodeId] = ruleNodeCtx
@@ -176,6 +215,35 @@ func InitRuleChainCtx(config types.Config, aspects types.AspectList, ruleChainDe
 	return ruleChainCtx, nil
 }
 
+// checkRuleChainDef rejects the definitions that can not run:
+// null nodes, and sub-chain references to the rule chain itself, which recurse until the stack overflows.
+func checkRuleChainDef(def *types.RuleChain) error {
+	for index, node := range def.Metadata.Nodes {
+		if node == nil {
+			return fmt.Errorf("node %d is null", index)
+		}
+		if def.RuleChain.ID != "" && node.Type == flowNodeType && flowTargetId(node) == def.RuleChain.ID {
+			return fmt.Errorf("node %s references its own rule chain:%s", node.Id, def.RuleChain.ID)
+		}
+	}
+	for _, item := range def.Metadata.RuleChainConnections {
+		if def.RuleChain.ID != "" && item.ToId == def.RuleChain.ID {
+			return fmt.Errorf("node %s connects to its own rule chain:%s", item.FromId, def.RuleChain.ID)
+		}
+	}
+	return nil
+}
+
+// flowTargetId returns the sub-rule chain id of the flow node, the configuration keys are case-insensitive as in node initialization.
+func flowTargetId(node *types.RuleNode) string {
+	for key, value := range node.Configuration {
+		if strings.EqualFold(key, flowNodeTargetIdKey) {
+			return str.ToString(value)
+		}
+	}
+	return ""
+}
+
 // Config returns the configuration of the rule chain context
 func (rc *RuleChainCtx) Config() types.Config {
 	rc.RLock()
@@ -203,7 +271,7 @@ func (rc *RuleChainCtx) GetNodeById(id types.RuleNodeId) (types.NodeCtx, bool) {
 // GetNodeByIndex retrieves a node context by its index
 func (rc *RuleChainCtx) GetNodeByIndex(index int) (types.NodeCtx, bool) {
 	rc.RLock()
-	if index >= len(rc.nodeIds) {
+	if index < 0 || index >= len(rc.nodeIds) {
 		rc.RUnlock()
 		return &RuleNodeCtx{}, false
 	}
@@ -332,6 +400,36 @@ func (rc *RuleChainCtx) Destroy() {
 	}
 }
 
+// NodeQueueStats returns the input queue stats of the nodes that have an input queue, keyed by node id.
+func (rc *RuleChainCtx) NodeQueueStats() map[string]NodeQueueStats {
+	rc.RLock()
+	defer rc.RUnlock()
+	stats := make(map[string]NodeQueueStats)
+	for id, nodeCtx := range rc.nodes {
+		if ruleNodeCtx, ok := nodeCtx.(*RuleNodeCtx); ok {
+			if item, ok := ruleNodeCtx.QueueStats(); ok {
+				stats[id.Id] = item
+			}
+		}
+	}
+	return stats
+}
+
+// NodeStats returns the runtime counters of the nodes that implement types.StatsGetter, keyed by node id.
+func (rc *RuleChainCtx) NodeStats() map[string]map[string]int64 {
+	rc.RLock()
+	defer rc.RUnlock()
+	stats := make(map[string]map[string]int64)
+	for id, nodeCtx := range rc.nodes {
+		if ruleNodeCtx, ok := nodeCtx.(*RuleNodeCtx); ok {
+			if item := ruleNodeCtx.Stats(); item != nil {
+				stats[id.Id] = item
+			}
+		}
+	}
+	return stats
+}
+
 // IsDebugMode checks if debug mode is enabled
 func (rc *RuleChainCtx) IsDebugMode() bool {
 	rc.RLock()
@@ -339,6 +437,20 @@ func (rc *RuleChainCtx) IsDebugMode() bool {
 	return rc.SelfDefinition.RuleChain.DebugMode
 }
 
+// Guardrails returns the execution guardrails of the rule chain
+func (rc *RuleChainCtx) Guardrails() types.Guardrails {
+	rc.RLock()
+	defer rc.RUnlock()
+	return rc.guardrails
+}
+
+// watchdogConfig returns the watchdog configuration of the rule chain
+func (rc *RuleChainCtx) watchdogConfig() watchdogConfig {
+	rc.RLock()
+	defer rc.RUnlock()
+	return rc.watchdog
+}
+
 // GetNodeId returns the node ID
 func (rc *RuleChainCtx) GetNodeId() types.RuleNodeId {
 	rc.RLock()
@@ -385,8 +497,9 @@ func (rc *RuleChainCtx) ReloadSelfFromDef(def types.RuleChain) error {
 
 		// Create a wrapper to avoid GetNodeId() calls in OnDestroy
 		wrapper := &nodeCtxWrapper{
-			nodeId:   nodeId,
-			original: rc,
+			nodeId:    nodeId,
+			original:  rc,
+			reloading: true,
 		}
 
 		// Execute destroy aspects without holding locks
@@ -428,6 +541,8 @@ func (rc *RuleChainCtx) copyUnsafe(newCtx *RuleChainCtx) {
 	rc.destroyAspects = newCtx.destroyAspects
 	rc.vars = newCtx.vars
 	rc.decryptSecrets = newCtx.decryptSecrets
+	rc.guardrails = newCtx.guardrails
+	rc.watchdog = newCtx.watchdog
 	// Clear cache
 	rc.relationCache = make(map[RelationCache][]types.NodeCtx)
 }
@@ -481,6 +596,8 @@ func (rc *RuleChainCtx) Copy(newCtx *RuleChainCtx) {
 	rc.destroyAspects = newCtx.destroyAspects
 	rc.vars = newCtx.vars
 	rc.decryptSecrets = newCtx.decryptSecrets
+	rc.guardrails = newCtx.guardrails
+	rc.watchdog = newCtx.watchdog
 	// Clear cache
 	rc.relationCache = make(map[RelationCache][]types.NodeCtx)
 }
@@ -533,12 +650,19 @@ func decryptSecret(inputMap map[string]string, secretKey []byte) map[string]stri
 type nodeCtxWrapper struct {
 	nodeId   types.RuleNodeId
 	original *RuleChainCtx
+	// reloading whether the destroy aspects are triggered by reloading the rule chain
+	reloading bool
 }
 
 func (w *nodeCtxWrapper) GetNodeId() types.RuleNodeId {
 	return w.nodeId // Return cached value without locking
 }
 
+// Reloading implements types.ReloadingCtx
+func (w *nodeCtxWrapper) Reloading() bool {
+	return w.reloading
+}
+
 // Delegate all other methods to the original context
 func (w *nodeCtxWrapper) Config() types.Config        { return w.original.Config() }
 func (w *nodeCtxWrapper) IsDebugMode() bool           { return w.original.IsDebugMode() }
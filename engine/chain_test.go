@@ -147,3 +147,96 @@ func TestChainCtx(t *testing.T) {
 	})
 
 }
+
+// lintLogger 记录日志
+type lintLogger struct {
+	logs []string
+}
+
+func (l *lintLogger) Printf(format string, v ...interface{}) {
+	l.logs = append(l.logs, fmt.Sprintf(format, v...))
+}
+
+func TestChainDocumentation(t *testing.T) {
+	documentation := "# Alarm\n\n* owner: <ops@example.com>\n*   keep   spacing  \n"
+	def := types.RuleChain{
+		RuleChain: types.RuleChainBaseInfo{ID: "docChain", Documentation: documentation},
+		Metadata: types.RuleMetadata{
+			Nodes: []*types.RuleNode{
+				{Id: "s1", Type: "log", AdditionalInfo: map[string]interface{}{"description": "logs **all** msgs"}, Configuration: types.Configuration{}},
+				{Id: "s2", Type: "log", Configuration: types.Configuration{}},
+			},
+		},
+	}
+	logger := &lintLogger{}
+	config := NewConfig(types.WithLogger(logger))
+	config.DocRequiredNodeCount = 1
+	dsl, err := config.Parser.EncodeRuleChain(def)
+	assert.Nil(t, err)
+	ruleEngine, err := New("docChain", dsl, WithConfig(config))
+	assert.Nil(t, err)
+	defer Del("docChain")
+	assert.Equal(t, 0, len(logger.logs))
+
+	//规则链文档和节点描述原样返回
+	decoded, err := config.Parser.DecodeRuleChain(ruleEngine.DSL())
+	assert.Nil(t, err)
+	assert.Equal(t, documentation, decoded.RuleChain.Documentation)
+	assert.Equal(t, "logs **all** msgs", decoded.Metadata.Nodes[0].Description())
+	assert.Equal(t, documentation, ruleEngine.Definition().RuleChain.Documentation)
+
+	//节点数量超过阈值并且没有文档，输出警告
+	def.RuleChain.Documentation = ""
+	dsl, _ = config.Parser.EncodeRuleChain(def)
+	err = ruleEngine.ReloadSelf(dsl)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(logger.logs))
+	assert.True(t, strings.Contains(logger.logs[0], "missingDocumentation"))
+}
+
+// 不能运行的规则链定义返回错误
+func TestChainCtxInvalidDef(t *testing.T) {
+	config := NewConfig()
+	_, err := InitRuleChainCtx(config, nil, nil)
+	assert.NotNil(t, err)
+
+	tests := []struct {
+		name   string
+		nodes  []*types.RuleNode
+		expect string
+	}{
+		{"NullNode", []*types.RuleNode{{Id: "s1", Type: "log"}, nil}, "node 1 is null"},
+		{"DuplicateId", []*types.RuleNode{{Id: "s1", Type: "log"}, {Id: "s1", Type: "log"}}, "duplicate node id:s1"},
+		{"DuplicateDefaultId", []*types.RuleNode{{Id: "node1", Type: "log"}, {Type: "log"}}, "duplicate node id:node1"},
+		{"SelfFlow", []*types.RuleNode{{Id: "s1", Type: "flow", Configuration: types.Configuration{"TargetId": "chain1"}}},
+			"node s1 references its own rule chain:chain1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := types.RuleChain{RuleChain: types.RuleChainBaseInfo{ID: "chain1"}, Metadata: types.RuleMetadata{Nodes: tt.nodes}}
+			_, err := InitRuleChainCtx(config, nil, &def)
+			assert.NotNil(t, err)
+			assert.Equal(t, tt.expect, err.Error())
+		})
+	}
+
+	t.Run("SelfRuleChainConnection", func(t *testing.T) {
+		def := types.RuleChain{RuleChain: types.RuleChainBaseInfo{ID: "chain1"}, Metadata: types.RuleMetadata{
+			Nodes:                []*types.RuleNode{{Id: "s1", Type: "log"}},
+			RuleChainConnections: []types.RuleChainConnection{{FromId: "s1", ToId: "chain1", Type: types.Success}},
+		}}
+		_, err := InitRuleChainCtx(config, nil, &def)
+		assert.Equal(t, "node s1 connects to its own rule chain:chain1", err.Error())
+	})
+
+	t.Run("FirstNodeIndexOutOfRange", func(t *testing.T) {
+		def := types.RuleChain{RuleChain: types.RuleChainBaseInfo{ID: "chain1"}, Metadata: types.RuleMetadata{
+			FirstNodeIndex: -1,
+			Nodes:          []*types.RuleNode{{Id: "s1", Type: "log"}},
+		}}
+		ruleChainCtx, err := InitRuleChainCtx(config, nil, &def)
+		assert.Nil(t, err)
+		_, ok := ruleChainCtx.GetFirstNode()
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,311 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/dsl"
+)
+
+// CoverageReport is the coverage of the root rule chain nodes and connections exercised by a corpus of messages,
+// see RuleEngine.Coverage.
+type CoverageReport struct {
+	// RuleChainId is the id of the rule chain.
+	RuleChainId string `json:"ruleChainId"`
+	// Messages is the number of messages run.
+	Messages int `json:"messages"`
+	// Nodes is the coverage of each node, in the order of the DSL.
+	Nodes []NodeCoverage `json:"nodes"`
+	// Connections is the coverage of each connection, in the order of the DSL.
+	Connections []ConnectionCoverage `json:"connections"`
+	// NodeCoverage is the ratio of visited nodes.
+	NodeCoverage float64 `json:"nodeCoverage"`
+	// ConnectionCoverage is the ratio of taken connections.
+	ConnectionCoverage float64 `json:"connectionCoverage"`
+	// Coverage is the ratio of visited nodes and taken connections to all nodes and connections.
+	Coverage float64 `json:"coverage"`
+	// UntakenFailures are the Failure connections never taken.
+	UntakenFailures []ConnectionCoverage `json:"untakenFailures,omitempty"`
+	// Unvisited are the ids of the nodes never visited.
+	Unvisited []string `json:"unvisited,omitempty"`
+	// Unreachable are the ids of the nodes that have no path from the first node, no message can visit them.
+	Unreachable []string `json:"unreachable,omitempty"`
+
+	definition types.RuleChain
+}
+
+// NodeCoverage is the coverage of a node.
+type NodeCoverage struct {
+	// Id is the node id.
+	Id string `json:"id"`
+	// Type is the node type.
+	Type string `json:"type"`
+	// Hits is the number of times the node is visited.
+	Hits int `json:"hits"`
+	// Relations is the number of times each relation type is taken by the node, including relations without connections.
+	Relations map[string]int `json:"relations,omitempty"`
+}
+
+// ConnectionCoverage is the coverage of a connection.
+type ConnectionCoverage struct {
+	FromId string `json:"fromId"`
+	ToId   string `json:"toId"`
+	Type   string `json:"type"`
+	// Hits is the number of times the connection is taken.
+	Hits int `json:"hits"`
+}
+
+// Mermaid returns the rule chain as a Mermaid flowchart annotated with the hit counts,
+// with unvisited nodes and untaken Failure connections highlighted.
+func (r CoverageReport) Mermaid() string {
+	nodeHits := make(map[string]int, len(r.Nodes))
+	for _, node := range r.Nodes {
+		nodeHits[node.Id] = node.Hits
+	}
+	connectionHits := make([]int, len(r.Connections))
+	for i, conn := range r.Connections {
+		connectionHits[i] = conn.Hits
+	}
+	return dsl.ToCoverageMermaid(r.definition, nodeHits, connectionHits)
+}
+
+// ExpectCoverageAbove returns an error if Coverage is below min, used to gate rule chain changes in tests:
+//
+//	if err := report.ExpectCoverageAbove(0.9); err != nil {
+//		t.Fatal(err)
+//	}
+func (r CoverageReport) ExpectCoverageAbove(min float64) error {
+	if r.Coverage >= min {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("rule chain %s coverage %.2f is below %.2f", r.RuleChainId, r.Coverage, min))
+	if len(r.Unvisited) > 0 {
+		b.WriteString(", unvisited nodes:")
+		b.WriteString(strings.Join(r.Unvisited, ","))
+	}
+	var untaken []string
+	for _, conn := range r.Connections {
+		if conn.Hits == 0 {
+			untaken = append(untaken, conn.FromId+"-"+conn.Type+"->"+conn.ToId)
+		}
+	}
+	if len(untaken) > 0 {
+		b.WriteString(", untaken connections:")
+		b.WriteString(strings.Join(untaken, ","))
+	}
+	return errors.New(b.String())
+}
+
+// coverageCollector collects the coverage from the run snapshot callbacks.
+type coverageCollector struct {
+	mu        sync.Mutex
+	nodeHits  map[string]int
+	relations map[string]map[string]int
+}
+
+// onNodeCompleted counts the relation taken by a node, called for each relation.
+func (c *coverageCollector) onNodeCompleted(ctx types.RuleContext, nodeRunLog types.RuleNodeRunLog) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	relations, ok := c.relations[nodeRunLog.Id]
+	if !ok {
+		relations = make(map[string]int)
+		c.relations[nodeRunLog.Id] = relations
+	}
+	relations[nodeRunLog.RelationType]++
+}
+
+// onRuleChainCompleted counts the visited nodes, including the nodes that end without a relation.
+func (c *coverageCollector) onRuleChainCompleted(ctx types.RuleContext, snapshot types.RuleChainRunSnapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, log := range snapshot.Logs {
+		c.nodeHits[log.Id]++
+	}
+}
+
+// Coverage runs the messages through the root rule chain one by one, waiting for each to complete,
+// and reports the nodes visited and the connections taken.
+// The coverage is collected by the run snapshot, the same as WithOnNodeCompleted and WithOnRuleChainCompleted.
+// The messages really run through the nodes, use test components or a test configuration for nodes with side effects.
+func (e *RuleEngine) Coverage(msgs []types.RuleMsg) CoverageReport {
+	if e.rootRuleChainCtx == nil || e.rootRuleChainCtx.SelfDefinition == nil {
+		return CoverageReport{RuleChainId: e.id}
+	}
+	collector := &coverageCollector{
+		nodeHits:  make(map[string]int),
+		relations: make(map[string]map[string]int),
+	}
+	for _, msg := range msgs {
+		e.OnMsgAndWait(msg, types.WithOnNodeCompleted(collector.onNodeCompleted),
+			types.WithOnRuleChainCompleted(collector.onRuleChainCompleted))
+	}
+	return newCoverageReport(*e.rootRuleChainCtx.SelfDefinition, len(msgs), collector)
+}
+
+func newCoverageReport(def types.RuleChain, messages int, collector *coverageCollector) CoverageReport {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	report := CoverageReport{
+		RuleChainId: def.RuleChain.ID,
+		Messages:    messages,
+		definition:  def,
+	}
+	visited := 0
+	for _, node := range def.Metadata.Nodes {
+		if node == nil {
+			continue
+		}
+		hits := collector.nodeHits[node.Id]
+		report.Nodes = append(report.Nodes, NodeCoverage{
+			Id:        node.Id,
+			Type:      node.Type,
+			Hits:      hits,
+			Relations: collector.relations[node.Id],
+		})
+		if hits > 0 {
+			visited++
+		} else {
+			report.Unvisited = append(report.Unvisited, node.Id)
+		}
+	}
+	taken := 0
+	for _, conn := range def.Metadata.Connections {
+		item := ConnectionCoverage{
+			FromId: conn.FromId,
+			ToId:   conn.ToId,
+			Type:   conn.Type,
+			Hits:   collector.relations[conn.FromId][conn.Type],
+		}
+		report.Connections = append(report.Connections, item)
+		if item.Hits > 0 {
+			taken++
+		} else if conn.Type == types.Failure {
+			report.UntakenFailures = append(report.UntakenFailures, item)
+		}
+	}
+	report.Unreachable = unreachableNodes(def)
+	report.NodeCoverage = ratio(visited, len(report.Nodes))
+	report.ConnectionCoverage = ratio(taken, len(report.Connections))
+	report.Coverage = ratio(visited+taken, len(report.Nodes)+len(report.Connections))
+	return report
+}
+
+// unreachableNodes returns the ids of the nodes that have no path from the first node.
+func unreachableNodes(def types.RuleChain) []string {
+	nodes := def.Metadata.Nodes
+	if def.Metadata.FirstNodeIndex < 0 || def.Metadata.FirstNodeIndex >= len(nodes) || nodes[def.Metadata.FirstNodeIndex] == nil {
+		return nil
+	}
+	next := make(map[string][]string)
+	for _, conn := range def.Metadata.Connections {
+		next[conn.FromId] = append(next[conn.FromId], conn.ToId)
+	}
+	reached := map[string]bool{nodes[def.Metadata.FirstNodeIndex].Id: true}
+	queue := []string{nodes[def.Metadata.FirstNodeIndex].Id}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, toId := range next[id] {
+			if !reached[toId] {
+				reached[toId] = true
+				queue = append(queue, toId)
+			}
+		}
+	}
+	var unreachable []string
+	for _, node := range nodes {
+		if node != nil && !reached[node.Id] {
+			unreachable = append(unreachable, node.Id)
+		}
+	}
+	return unreachable
+}
+
+func ratio(count, total int) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(count) / float64(total)
+}
+
+// corpusMsg is a message of a corpus file. Data is a string, or any JSON value used as JSON data.
+type corpusMsg struct {
+	Type     string            `json:"type"`
+	DataType types.DataType    `json:"dataType"`
+	Metadata map[string]string `json:"metadata"`
+	Data     json.RawMessage   `json:"data"`
+}
+
+// LoadCorpus loads the messages of the *.json files in dir, in the order of the file names, used as the corpus of Coverage.
+// Each file contains a message or an array of messages:
+//
+//	{"type":"TELEMETRY","metadata":{"deviceId":"d1"},"data":{"temperature":41}}
+//
+// data is a string, or any JSON value used as JSON data. dataType defaults to JSON.
+func LoadCorpus(dir string) ([]types.RuleMsg, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var msgs []types.RuleMsg
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var items []corpusMsg
+		if trimmed := strings.TrimSpace(string(content)); strings.HasPrefix(trimmed, "[") {
+			err = json.Unmarshal(content, &items)
+		} else {
+			var item corpusMsg
+			err = json.Unmarshal(content, &item)
+			items = append(items, item)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("load corpus file %s error:%w", filepath.Base(file), err)
+		}
+		for _, item := range items {
+			msgs = append(msgs, item.toMsg())
+		}
+	}
+	return msgs, nil
+}
+
+func (m corpusMsg) toMsg() types.RuleMsg {
+	dataType := m.DataType
+	if dataType == "" {
+		dataType = types.JSON
+	}
+	data := string(m.Data)
+	var s string
+	if json.Unmarshal(m.Data, &s) == nil {
+		data = s
+	}
+	return types.NewMsg(0, m.Type, dataType, types.BuildMetadata(m.Metadata), data)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/json"
+)
+
+var coverageChain = `{
+  "ruleChain": {"id": "coverageChain"},
+  "metadata": {
+    "nodes": [
+      {"id": "s1", "type": "jsFilter", "configuration": {"jsScript": "return msg.temperature > 50;"}},
+      {"id": "s2", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':'ALARM'};"}},
+      {"id": "s3", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"}},
+      {"id": "s4", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':'ERROR'};"}},
+      {"id": "s5", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}
+    ],
+    "connections": [
+      {"fromId": "s1", "toId": "s2", "type": "True"},
+      {"fromId": "s1", "toId": "s3", "type": "False"},
+      {"fromId": "s1", "toId": "s4", "type": "Failure"}
+    ]
+  }
+}`
+
+func TestCoverage(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "01_alarm.json"), []byte(`{"type":"TELEMETRY","metadata":{"deviceId":"d1"},"data":{"temperature":60}}`), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "02_normal.json"), []byte(`[{"type":"TELEMETRY","data":"{\"temperature\":20}"},{"type":"TELEMETRY","data":{"temperature":30}}]`), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("ignored"), 0600))
+	msgs, err := LoadCorpus(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(msgs))
+	assert.Equal(t, "d1", msgs[0].Metadata.GetValue("deviceId"))
+	assert.Equal(t, `{"temperature":20}`, msgs[1].GetData())
+	assert.Equal(t, types.JSON, msgs[2].DataType)
+
+	ruleEngine, err := New("coverageChain", []byte(coverageChain), WithConfig(NewConfig()))
+	assert.Nil(t, err)
+	defer ruleEngine.Stop()
+	report := ruleEngine.(*RuleEngine).Coverage(msgs)
+
+	assert.Equal(t, 3, report.Messages)
+	assert.Equal(t, 5, len(report.Nodes))
+	assert.Equal(t, 3, report.Nodes[0].Hits)
+	assert.Equal(t, map[string]int{types.True: 1, types.False: 2}, report.Nodes[0].Relations)
+	assert.Equal(t, 1, report.Nodes[1].Hits)
+	assert.Equal(t, 2, report.Nodes[2].Hits)
+	assert.Equal(t, []int{1, 2, 0}, []int{report.Connections[0].Hits, report.Connections[1].Hits, report.Connections[2].Hits})
+	assert.Equal(t, []string{"s4", "s5"}, report.Unvisited)
+	assert.Equal(t, []string{"s5"}, report.Unreachable)
+	assert.Equal(t, 1, len(report.UntakenFailures))
+	assert.Equal(t, "s4", report.UntakenFailures[0].ToId)
+	assert.Equal(t, 0.6, report.NodeCoverage)
+	assert.Equal(t, 5.0/8, report.Coverage)
+
+	t.Run("Gate", func(t *testing.T) {
+		assert.Nil(t, report.ExpectCoverageAbove(0.6))
+		err := report.ExpectCoverageAbove(0.9)
+		assert.Equal(t, "rule chain coverageChain coverage 0.62 is below 0.90, unvisited nodes:s4,s5, untaken connections:s1-Failure->s4", err.Error())
+	})
+
+	t.Run("Output", func(t *testing.T) {
+		data, err := json.Marshal(report)
+		assert.Nil(t, err)
+		var decoded CoverageReport
+		assert.Nil(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, report.Connections, decoded.Connections)
+
+		graph := report.Mermaid()
+		assert.True(t, strings.Contains(graph, `n0["s1 (jsFilter)<br/>hits: 3"]`))
+		assert.True(t, strings.Contains(graph, `n3["s4 (jsTransform)<br/>hits: 0"]:::uncovered`))
+		assert.True(t, strings.Contains(graph, `n0 -->|"False (2)"| n2`))
+		assert.True(t, strings.Contains(graph, "linkStyle 2 stroke:#c00"))
+	})
+}
@@ -78,6 +78,12 @@ type RuleEngine struct {
 	// Aspects is a list of AOP (Aspect-Oriented Programming) aspects.
 	Aspects   types.AspectList
 	OnUpdated func(chainId, nodeId string, dsl []byte)
+	// partitionId is the partition specified by WithPartition.
+	partitionId string
+	// partition enforces the quotas of the partition in the pool, *Partition, nil if not tracked.
+	partition atomic.Value
+	// disabled is 1 if the rule chain is disabled by Disable.
+	disabled int32
 }
 
 // NewRuleEngine creates a new RuleEngine instance with the given ID and definition.
@@ -93,6 +99,8 @@ func NewRuleEngine(id string, def []byte, opts ...types.RuleEngineOption) (*Rule
 		ruleChainPool: DefaultPool,
 	}
 	err := ruleEngine.ReloadSelf(def, opts...)
+	// Delete the spill files left by crashed processes.
+	sweepSpillDir(ruleEngine.Config)
 	if err == nil && ruleEngine.rootRuleChainCtx != nil {
 		if id != "" {
 			ruleEngine.rootRuleChainCtx.Id = types.RuleNodeId{Id: id, Type: types.CHAIN}
@@ -179,6 +187,9 @@ func (e *RuleEngine) initChain(def types.RuleChain) error {
 		_, _, createdAspects, _, _ := e.Aspects.GetEngineAspects()
 		for _, aop := range createdAspects {
 			if err := aop.OnCreated(e.rootRuleChainCtx); err != nil {
+				//释放已经初始化的节点和切面资源，防止泄露
+				e.rootRuleChainCtx.Destroy()
+				e.rootRuleChainCtx = nil
 				return err
 			}
 		}
@@ -207,8 +218,11 @@ func (e *RuleEngine) ReloadSelf(dsl []byte, opts ...types.RuleEngineOption) erro
 		err = e.rootRuleChainCtx.ReloadSelf(dsl)
 		//设置子规则链池
 		e.rootRuleChainCtx.SetRuleEnginePool(e.ruleChainPool)
-		if err == nil && e.OnUpdated != nil {
-			e.OnUpdated(e.id, e.id, dsl)
+		if err == nil {
+			if e.OnUpdated != nil {
+				e.OnUpdated(e.id, e.id, dsl)
+			}
+			e.Config.PublishEvent(types.EventChainReloaded, e.chainId(), map[string]interface{}{"nodeId": ""})
 		}
 	} else {
 		//初始化内置切面
@@ -216,7 +230,9 @@ func (e *RuleEngine) ReloadSelf(dsl []byte, opts ...types.RuleEngineOption) erro
 		var rootRuleChainDef types.RuleChain
 		//初始化
 		if rootRuleChainDef, err = e.Config.Parser.DecodeRuleChain(dsl); err == nil {
-			err = e.initChain(rootRuleChainDef)
+			if err = e.initChain(rootRuleChainDef); err == nil {
+				e.Config.PublishEvent(types.EventChainLoaded, e.chainId(), nil)
+			}
 		} else {
 			return err
 		}
@@ -242,8 +258,11 @@ func (e *RuleEngine) ReloadChild(ruleNodeId string, dsl []byte) error {
 	} else {
 		//更新根规则链子节点
 		err := e.rootRuleChainCtx.ReloadChild(types.RuleNodeId{Id: ruleNodeId}, dsl)
-		if err == nil && e.OnUpdated != nil {
-			e.OnUpdated(e.id, ruleNodeId, e.DSL())
+		if err == nil {
+			if e.OnUpdated != nil {
+				e.OnUpdated(e.id, ruleNodeId, e.DSL())
+			}
+			e.Config.PublishEvent(types.EventChainReloaded, e.chainId(), map[string]interface{}{"nodeId": ruleNodeId})
 		}
 		return err
 	}
@@ -294,6 +313,7 @@ func (e *RuleEngine) RootRuleChainCtx() types.ChainCtx {
 }
 
 func (e *RuleEngine) Stop() {
+	initialized := e.Initialized()
 	if e.rootRuleChainCtx != nil {
 		e.rootRuleChainCtx.Destroy()
 	}
@@ -302,6 +322,66 @@ func (e *RuleEngine) Stop() {
 		_ = e.Config.Cache.DeleteByPrefix(e.rootRuleChainCtx.GetNodeId().Id + types.NamespaceSeparator)
 	}
 	e.initialized = false
+	if initialized {
+		e.Config.RemoveHealth(types.HealthChainPrefix + e.chainId())
+		e.Config.PublishEvent(types.EventChainRemoved, e.chainId(), nil)
+	}
+}
+
+// Disable stops the rule chain and marks its definition disabled, the rule chain is reported unhealthy.
+// The rule engine stays in the pool and rejects messages with ErrDisabled until Enable is called.
+// Disabling a disabled rule chain does nothing.
+func (e *RuleEngine) Disable() error {
+	if e.rootRuleChainCtx == nil {
+		return errors.New("rule engine not initialized")
+	}
+	if !atomic.CompareAndSwapInt32(&e.disabled, 0, 1) {
+		return nil
+	}
+	e.setDefinitionDisabled(true)
+	e.Stop()
+	e.Config.ReportHealth(types.HealthChainPrefix+e.chainId(), types.HealthUnhealthy, ErrDisabled.Error())
+	return nil
+}
+
+// Enable restarts a rule chain disabled by Disable. Enabling an enabled rule chain does nothing.
+func (e *RuleEngine) Enable() error {
+	if e.rootRuleChainCtx == nil {
+		return errors.New("rule engine not initialized")
+	}
+	if !e.Disabled() {
+		return nil
+	}
+	e.setDefinitionDisabled(false)
+	if err := e.ReloadSelf(e.DSL()); err != nil {
+		e.setDefinitionDisabled(true)
+		return err
+	}
+	atomic.StoreInt32(&e.disabled, 0)
+	e.Config.ReportHealth(types.HealthChainPrefix+e.chainId(), types.HealthHealthy, "")
+	return nil
+}
+
+// Disabled returns whether the rule chain is disabled by Disable.
+func (e *RuleEngine) Disabled() bool {
+	return atomic.LoadInt32(&e.disabled) == 1
+}
+
+func (e *RuleEngine) setDefinitionDisabled(disabled bool) {
+	e.rootRuleChainCtx.Lock()
+	defer e.rootRuleChainCtx.Unlock()
+	e.rootRuleChainCtx.SelfDefinition.RuleChain.Disabled = disabled
+}
+
+// chainId 获取规则链ID，用于生命周期事件
+func (e *RuleEngine) chainId() string {
+	if e.id != "" {
+		return e.id
+	}
+	if e.rootRuleChainCtx != nil {
+		return e.rootRuleChainCtx.Id.Id
+	}
+	return ""
 }
 
 // OnMsg asynchronously processes a message using the rule engine.
@@ -332,6 +412,23 @@ func (e *RuleEngine) GetMetrics() *metrics.EngineMetrics {
 	return nil
 }
 
+// NodeQueueStats returns the input queue stats of the root rule chain nodes that have an input queue, keyed by node id.
+func (e *RuleEngine) NodeQueueStats() map[string]NodeQueueStats {
+	if e.rootRuleChainCtx == nil {
+		return nil
+	}
+	return e.rootRuleChainCtx.NodeQueueStats()
+}
+
+// NodeStats returns the runtime counters of the root rule chain nodes that implement types.StatsGetter, keyed by node id.
+// For example, the number of messages routed to each branch of the trafficSplit node.
+func (e *RuleEngine) NodeStats() map[string]map[string]int64 {
+	if e.rootRuleChainCtx == nil {
+		return nil
+	}
+	return e.rootRuleChainCtx.NodeStats()
+}
+
 // OnMsgWithEndFunc is a deprecated method that asynchronously processes a message using the rule engine.
 // The endFunc callback is used to obtain the results after the rule chain execution is complete.
 // Note: If the rule chain has multiple endpoints, the callback function will be executed multiple times.
@@ -364,11 +461,17 @@ func (e *RuleEngine) doOnAllNodeCompleted(rootCtxCopy *DefaultRuleContext, msg t
 	if customFunc != nil {
 		customFunc()
 	}
+	// Delete the spill files after the execution completes.
+	if rootCtxCopy.spills != nil {
+		rootCtxCopy.spills.release()
+	}
 }
 
 // onErrHandler handles the scenario where the rule chain has no nodes or fails to process the message.
 // It logs an error and triggers the end-of-chain callbacks.
 func (e *RuleEngine) onErrHandler(msg types.RuleMsg, rootCtxCopy *DefaultRuleContext, err error) {
+	// The spill files are deleted below, so callbacks get the data in memory.
+	loadSpilled(rootCtxCopy.config, msg)
 	// Trigger the configured OnEnd callback with the error.
 	if rootCtxCopy.config.OnEnd != nil {
 		rootCtxCopy.config.OnEnd(msg, err)
@@ -381,6 +484,9 @@ func (e *RuleEngine) onErrHandler(msg types.RuleMsg, rootCtxCopy *DefaultRuleCon
 	if rootCtxCopy.onAllNodeCompleted != nil {
 		rootCtxCopy.onAllNodeCompleted()
 	}
+	if rootCtxCopy.spills != nil {
+		rootCtxCopy.spills.release()
+	}
 }
 
 // onMsgAndWait processes a message through the rule engine, optionally waiting for all nodes to complete.
@@ -396,6 +502,24 @@ func (e *RuleEngine) onMsgAndWait(msg types.RuleMsg, wait bool, opts ...types.Ru
 		for _, opt := range opts {
 			opt(rootCtxCopy)
 		}
+		if e.Disabled() {
+			e.onErrHandler(msg, rootCtxCopy, ErrDisabled)
+			return
+		}
+		// Admit the message into the partition, and release the in-flight slot after all nodes have completed.
+		if partition := e.getPartition(); partition != nil {
+			if err := partition.admit(); err != nil {
+				e.onErrHandler(msg, rootCtxCopy, err)
+				return
+			}
+			customCompleted := rootCtxCopy.onAllNodeCompleted
+			rootCtxCopy.onAllNodeCompleted = func() {
+				partition.release()
+				if customCompleted != nil {
+					customCompleted()
+				}
+			}
+		}
 		// Handle the case where the rule chain has no nodes.
 		if rootCtxCopy.ruleChainCtx.isEmpty {
 			e.onErrHandler(msg, rootCtxCopy, errors.New("the rule chain has no nodes"))
@@ -405,6 +529,15 @@ func (e *RuleEngine) onMsgAndWait(msg types.RuleMsg, wait bool, opts ...types.Ru
 			e.onErrHandler(msg, rootCtxCopy, rootCtxCopy.err)
 			return
 		}
+		// Track the spill files of the execution, spilling the message data if it is too large.
+		if rootCtxCopy.config.SpillThreshold > 0 || msg.IsSpilled() {
+			rootCtxCopy.spills = &spillTracker{}
+			if !msg.IsSpilled() && msg.GetDataSize() > rootCtxCopy.config.SpillThreshold {
+				//不修改调用方的消息
+				msg = msg.Copy()
+			}
+			rootCtxCopy.spillIfNeeded(msg)
+		}
 		var err error
 		// Execute start aspects and update the message accordingly.
 		msg, err = e.onStart(rootCtxCopy, msg)
@@ -433,6 +566,8 @@ func (e *RuleEngine) onMsgAndWait(msg types.RuleMsg, wait bool, opts ...types.Ru
 				// Execute the completion handling function.
 				e.doOnAllNodeCompleted(rootCtxCopy, msg, customFunc)
 			}
+			// Watch the execution if maxProcessingTime is configured.
+			e.startWatch(rootCtxCopy, msg)
 			// Process the message through the rule chain.
 			rootCtxCopy.TellNext(msg, rootCtxCopy.relationTypes...)
 			// Block until all nodes have completed.
@@ -442,6 +577,7 @@ func (e *RuleEngine) onMsgAndWait(msg types.RuleMsg, wait bool, opts ...types.Ru
 			rootCtxCopy.onAllNodeCompleted = func() {
 				e.doOnAllNodeCompleted(rootCtxCopy, msg, customFunc)
 			}
+			e.startWatch(rootCtxCopy, msg)
 			// Process the message through the rule chain.
 			rootCtxCopy.TellNext(msg, rootCtxCopy.relationTypes...)
 		}
@@ -751,6 +751,39 @@ func TestExecuteNode(t *testing.T) {
 	wg.Wait()
 }
 
+// TestFlowNodeChainNotFound 子规则链不存在时，flow节点通过Failure关系输出
+func TestFlowNodeChainNotFound(t *testing.T) {
+	ruleChain := `{
+	  "ruleChain": {"id": "%s"},
+	  "metadata": {
+	    "nodes": [{"id": "s1", "type": "flow", "configuration": {"targetId": "notfound", "extend": %v}}]
+	  }
+	}`
+	msg := types.NewMsg(0, "TEST_MSG_TYPE1", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+
+	//不合并结果，输出原消息
+	ruleEngine, err := New(str.RandomStr(10), []byte(fmt.Sprintf(ruleChain, "flowNotFound01", true)))
+	assert.Nil(t, err)
+	ruleEngine.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		assert.Equal(t, types.Failure, relationType)
+		assert.Equal(t, "ruleChain id=notfound not found", err.Error())
+		assert.Equal(t, "{\"temperature\":41}", msg.GetData())
+	}))
+
+	//合并结果，输出包含错误信息的合并消息
+	ruleEngine, err = New(str.RandomStr(10), []byte(fmt.Sprintf(ruleChain, "flowNotFound02", false)))
+	assert.Nil(t, err)
+	ruleEngine.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		assert.Equal(t, types.Failure, relationType)
+		assert.Equal(t, "ruleChain id=notfound not found", err.Error())
+		var wrapperMsgs []types.WrapperMsg
+		assert.Nil(t, json.Unmarshal([]byte(msg.GetData()), &wrapperMsgs))
+		assert.Equal(t, 1, len(wrapperMsgs))
+		assert.Equal(t, "ruleChain id=notfound not found", wrapperMsgs[0].Err)
+		assert.Equal(t, "{\"temperature\":41}", wrapperMsgs[0].Msg.GetData())
+	}))
+}
+
 func TestBatchOnMsgAndWait(t *testing.T) {
 	config := NewConfig()
 	ruleEngine, err := New(str.RandomStr(10), []byte(ruleChainFile), WithConfig(config))
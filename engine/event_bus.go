@@ -0,0 +1,158 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"path"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/json"
+)
+
+// KeyEventSubject is the metadata key of the event subject when events are bridged to a rule chain.
+const KeyEventSubject = "subject"
+
+// Ensuring EventBus implements types.EventBus interface.
+var _ types.EventBus = (*EventBus)(nil)
+
+// EventBus is the in-memory implementation of types.EventBus.
+// Publish holds a lock while it hands the event to each subscription without blocking,
+// so events of the same subject are delivered to each subscriber in publication order.
+type EventBus struct {
+	mu            sync.Mutex
+	subscriptions map[*eventSubscription]struct{}
+}
+
+// NewEventBus creates a new event bus.
+func NewEventBus() *EventBus {
+	return &EventBus{subscriptions: make(map[*eventSubscription]struct{})}
+}
+
+// Publish publishes an event to all matching subscriptions, the event is dropped for subscriptions whose buffer is full.
+func (b *EventBus) Publish(event types.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscriptions {
+		if !sub.match(event.Type) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			atomic.AddInt64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Subscribe subscribes to events whose type matches pattern.
+func (b *EventBus) Subscribe(pattern string, bufferSize int) (types.EventSubscription, error) {
+	return b.subscribe(pattern, bufferSize)
+}
+
+// SubscribeFunc subscribes to events whose type matches pattern, handler is called sequentially in a dedicated goroutine.
+func (b *EventBus) SubscribeFunc(pattern string, bufferSize int, handler func(event types.Event)) (types.EventSubscription, error) {
+	if handler == nil {
+		return nil, errors.New("handler can not nil")
+	}
+	sub, err := b.subscribe(pattern, bufferSize)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for event := range sub.ch {
+			handler(event)
+		}
+	}()
+	return sub, nil
+}
+
+func (b *EventBus) subscribe(pattern string, bufferSize int) (*eventSubscription, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+	// 检查表达式是否合法
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if bufferSize <= 0 {
+		bufferSize = types.DefaultEventBufferSize
+	}
+	sub := &eventSubscription{bus: b, pattern: pattern, ch: make(chan types.Event, bufferSize)}
+	b.mu.Lock()
+	b.subscriptions[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub, nil
+}
+
+// eventSubscription is a subscription of EventBus.
+type eventSubscription struct {
+	bus     *EventBus
+	pattern string
+	ch      chan types.Event
+	dropped int64
+}
+
+func (s *eventSubscription) C() <-chan types.Event {
+	return s.ch
+}
+
+func (s *eventSubscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Unsubscribe removes the subscription and closes the channel, it is safe to call multiple times.
+func (s *eventSubscription) Unsubscribe() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subscriptions[s]; ok {
+		delete(s.bus.subscriptions, s)
+		close(s.ch)
+	}
+}
+
+func (s *eventSubscription) match(eventType string) bool {
+	if s.pattern == "*" {
+		return true
+	}
+	ok, _ := path.Match(s.pattern, eventType)
+	return ok
+}
+
+// BridgeEvents republishes events whose type matches pattern onto a rule chain, so that users can build self-monitoring flows.
+// Each event is sent as a JSON msg, the msg type is the event type and metadata.subject is the event subject.
+// Each event waits until the rule chain completes, so events are processed in publication order.
+// Use Unsubscribe of the returned subscription to stop the bridge.
+func BridgeEvents(bus types.EventBus, pattern string, ruleEngine types.RuleEngine, opts ...types.RuleContextOption) (types.EventSubscription, error) {
+	if bus == nil {
+		return nil, errors.New("event bus can not nil")
+	}
+	if ruleEngine == nil {
+		return nil, errors.New("rule engine can not nil")
+	}
+	return bus.SubscribeFunc(pattern, 0, func(event types.Event) {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		metadata := types.NewMetadata()
+		metadata.PutValue(KeyEventSubject, event.Subject)
+		ruleEngine.OnMsgAndWait(types.NewMsg(event.Ts, event.Type, types.JSON, metadata, string(data)), opts...)
+	})
+}
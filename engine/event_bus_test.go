@@ -0,0 +1,183 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/json"
+)
+
+func TestEventBus(t *testing.T) {
+	t.Run("Pattern", func(t *testing.T) {
+		bus := NewEventBus()
+		chainSub, err := bus.Subscribe("chain.*", 10)
+		assert.Nil(t, err)
+		allSub, err := bus.Subscribe("", 10)
+		assert.Nil(t, err)
+		_, err = bus.Subscribe("[", 10)
+		assert.NotNil(t, err)
+
+		bus.Publish(types.NewEvent(types.EventChainLoaded, "c1", nil))
+		bus.Publish(types.NewEvent(types.EventEndpointStarted, "e1", nil))
+		assert.Equal(t, 1, len(chainSub.C()))
+		assert.Equal(t, 2, len(allSub.C()))
+		event := <-chainSub.C()
+		assert.Equal(t, types.EventChainLoaded, event.Type)
+		assert.Equal(t, "c1", event.Subject)
+		assert.True(t, event.Ts > 0)
+
+		chainSub.Unsubscribe()
+		chainSub.Unsubscribe()
+		_, ok := <-chainSub.C()
+		assert.False(t, ok)
+		bus.Publish(types.NewEvent(types.EventChainLoaded, "c1", nil))
+		assert.Equal(t, 3, len(allSub.C()))
+	})
+
+	t.Run("SlowSubscriber", func(t *testing.T) {
+		bus := NewEventBus()
+		var mu sync.Mutex
+		received := make(map[string][]int)
+		release := make(chan struct{})
+		slowSub, err := bus.SubscribeFunc("*", 16, func(event types.Event) {
+			<-release
+			seq, _ := strconv.Atoi(fmt.Sprint(event.Data["seq"]))
+			mu.Lock()
+			received[event.Subject] = append(received[event.Subject], seq)
+			mu.Unlock()
+		})
+		assert.Nil(t, err)
+		fastSub, err := bus.Subscribe("*", 1000)
+		assert.Nil(t, err)
+
+		// 慢订阅者不阻塞发布
+		start := time.Now()
+		var wg sync.WaitGroup
+		for s := 0; s < 4; s++ {
+			wg.Add(1)
+			go func(subject string) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					bus.Publish(types.NewEvent("test", subject, map[string]interface{}{"seq": i}))
+				}
+			}("s" + strconv.Itoa(s))
+		}
+		wg.Wait()
+		assert.True(t, time.Since(start) < time.Second)
+		assert.True(t, slowSub.Dropped() > 0)
+		assert.Equal(t, int64(0), fastSub.Dropped())
+		close(release)
+
+		// 每个主题内按照发布顺序投递
+		lastSeq := make(map[string]int)
+		for i := 0; i < 400; i++ {
+			event := <-fastSub.C()
+			seq := event.Data["seq"].(int)
+			if last, ok := lastSeq[event.Subject]; ok {
+				assert.True(t, seq > last)
+			}
+			lastSeq[event.Subject] = seq
+		}
+		time.Sleep(time.Millisecond * 50)
+		mu.Lock()
+		total := 0
+		for _, seqs := range received {
+			total += len(seqs)
+			for i := 1; i < len(seqs); i++ {
+				assert.True(t, seqs[i] > seqs[i-1])
+			}
+		}
+		mu.Unlock()
+		assert.Equal(t, int64(400), int64(total)+slowSub.Dropped())
+		slowSub.Unsubscribe()
+	})
+}
+
+func TestEngineLifecycleEvents(t *testing.T) {
+	bus := NewEventBus()
+	sub, err := bus.Subscribe("chain.*", 10)
+	assert.Nil(t, err)
+	config := NewConfig(types.WithEventBus(bus))
+	pool := NewPool()
+	ruleEngine, err := pool.New("eventTest01", []byte(ruleChainFile), WithConfig(config))
+	assert.Nil(t, err)
+	assert.Nil(t, ruleEngine.ReloadChild("s1", []byte(`{"id":"s1","type":"jsFilter","configuration":{"jsScript":"return true;"}}`)))
+	assert.Nil(t, ruleEngine.Reload())
+	pool.Del("eventTest01")
+
+	var events []types.Event
+	for i := 0; i < 4; i++ {
+		select {
+		case event := <-sub.C():
+			events = append(events, event)
+		case <-time.After(time.Second):
+			t.Fatal("event timeout")
+		}
+	}
+	assert.Equal(t, types.EventChainLoaded, events[0].Type)
+	assert.Equal(t, types.EventChainReloaded, events[1].Type)
+	assert.Equal(t, "s1", events[1].Data["nodeId"])
+	assert.Equal(t, types.EventChainReloaded, events[2].Type)
+	assert.Equal(t, types.EventChainRemoved, events[3].Type)
+	for _, event := range events {
+		assert.Equal(t, "eventTest01", event.Subject)
+	}
+}
+
+func TestBridgeEvents(t *testing.T) {
+	bus := NewEventBus()
+	monitorChain := `{
+	  "ruleChain": {"id": "eventMonitor"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}
+		]
+	  }
+	}`
+	monitor, err := NewRuleEngine("eventMonitor", []byte(monitorChain), WithConfig(NewConfig()))
+	assert.Nil(t, err)
+	received := make(chan types.RuleMsg, 10)
+	sub, err := BridgeEvents(bus, "chain.*", monitor, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		received <- msg
+	}))
+	assert.Nil(t, err)
+	defer sub.Unsubscribe()
+
+	ruleEngine, err := NewRuleEngine("bridged01", []byte(ruleChainFile), WithConfig(NewConfig(types.WithEventBus(bus))))
+	assert.Nil(t, err)
+	ruleEngine.Stop()
+
+	for _, expected := range []string{types.EventChainLoaded, types.EventChainRemoved} {
+		select {
+		case msg := <-received:
+			assert.Equal(t, expected, msg.Type)
+			assert.Equal(t, "bridged01", msg.Metadata.GetValue(KeyEventSubject))
+			var event types.Event
+			assert.Nil(t, json.Unmarshal([]byte(msg.GetData()), &event))
+			assert.Equal(t, expected, event.Type)
+		case <-time.After(time.Second):
+			t.Fatal("bridge timeout")
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// Ensuring HealthRegistry implements types.HealthRegistry interface.
+var _ types.HealthRegistry = (*HealthRegistry)(nil)
+
+// HealthRegistry is the in-memory implementation of types.HealthRegistry.
+type HealthRegistry struct {
+	policy   types.HealthPolicy
+	mu       sync.RWMutex
+	checks   map[string]types.HealthCheck
+	checkers map[string]types.HealthChecker
+}
+
+// NewHealthRegistry creates a new health registry with the aggregation policy.
+func NewHealthRegistry(policy types.HealthPolicy) *HealthRegistry {
+	return &HealthRegistry{
+		policy:   policy,
+		checks:   make(map[string]types.HealthCheck),
+		checkers: make(map[string]types.HealthChecker),
+	}
+}
+
+// Report reports the health status of a component.
+func (r *HealthRegistry) Report(name string, status types.HealthStatus, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checkers, name)
+	r.checks[name] = types.HealthCheck{Name: name, Status: status, Reason: reason, CheckedAt: time.Now()}
+}
+
+// Register registers a checker called each time the health is queried.
+func (r *HealthRegistry) Register(name string, checker types.HealthChecker) {
+	if checker == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checks, name)
+	r.checkers[name] = checker
+}
+
+// Remove removes a component.
+func (r *HealthRegistry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checks, name)
+	delete(r.checkers, name)
+}
+
+// Health returns the aggregated health, the checkers are called without holding the lock.
+func (r *HealthRegistry) Health() types.HealthReport {
+	r.mu.RLock()
+	checks := make([]types.HealthCheck, 0, len(r.checks)+len(r.checkers))
+	for _, check := range r.checks {
+		checks = append(checks, check)
+	}
+	checkers := make(map[string]types.HealthChecker, len(r.checkers))
+	for name, checker := range r.checkers {
+		checkers[name] = checker
+	}
+	r.mu.RUnlock()
+
+	for name, checker := range checkers {
+		status, reason := checker()
+		checks = append(checks, types.HealthCheck{Name: name, Status: status, Reason: reason, CheckedAt: time.Now()})
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].Name < checks[j].Name
+	})
+
+	report := types.HealthReport{Status: types.HealthHealthy, Live: true, Ready: true, Checks: checks}
+	for i := range checks {
+		check := &checks[i]
+		check.Required = !matchHealthPattern(r.policy.Optional, check.Name)
+		if check.Status == types.HealthHealthy {
+			continue
+		}
+		report.Status = types.HealthDegraded
+		if check.Status != types.HealthUnhealthy {
+			continue
+		}
+		if check.Required {
+			report.Ready = false
+		}
+		if matchHealthPattern(r.policy.Liveness, check.Name) {
+			report.Live = false
+		}
+	}
+	if !report.Ready || !report.Live {
+		report.Status = types.HealthUnhealthy
+	}
+	return report
+}
+
+// matchHealthPattern returns whether the name matches one of the patterns,
+// a pattern ending with * matches the names with its prefix, other patterns use the path.Match syntax.
+func matchHealthPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestHealthRegistry(t *testing.T) {
+	registry := NewHealthRegistry(types.HealthPolicy{
+		Optional: []string{types.HealthChainPrefix + "*"},
+		Liveness: []string{"engine:deadlock"},
+	})
+	report := registry.Health()
+	assert.Equal(t, types.HealthHealthy, report.Status)
+	assert.True(t, report.Live)
+	assert.True(t, report.Ready)
+
+	//模拟broker连接
+	var connected int32 = 1
+	broker := types.HealthResourcePrefix + "tcp://127.0.0.1:1883"
+	registry.Register(broker, func() (types.HealthStatus, string) {
+		if atomic.LoadInt32(&connected) == 1 {
+			return types.HealthHealthy, ""
+		}
+		return types.HealthUnhealthy, "mqtt broker disconnected"
+	})
+	registry.Report(types.HealthEndpointPrefix+"api", types.HealthHealthy, "")
+	report = registry.Health()
+	assert.Equal(t, types.HealthHealthy, report.Status)
+	assert.Equal(t, 2, len(report.Checks))
+	assert.Equal(t, types.HealthEndpointPrefix+"api", report.Checks[0].Name)
+	assert.True(t, report.Checks[0].Required)
+	assert.False(t, report.Checks[0].CheckedAt.IsZero())
+
+	t.Run("BrokerOutage", func(t *testing.T) {
+		atomic.StoreInt32(&connected, 0)
+		report := registry.Health()
+		assert.Equal(t, types.HealthUnhealthy, report.Status)
+		assert.False(t, report.Ready)
+		//broker不可用不影响存活
+		assert.True(t, report.Live)
+		assert.Equal(t, "mqtt broker disconnected", report.Checks[1].Reason)
+
+		atomic.StoreInt32(&connected, 1)
+		report = registry.Health()
+		assert.Equal(t, types.HealthHealthy, report.Status)
+		assert.True(t, report.Ready)
+	})
+
+	t.Run("Optional", func(t *testing.T) {
+		registry.Report(types.HealthChainPrefix+"rule01", types.HealthUnhealthy, ErrDisabled.Error())
+		report := registry.Health()
+		assert.Equal(t, types.HealthDegraded, report.Status)
+		assert.True(t, report.Ready)
+		registry.Remove(types.HealthChainPrefix + "rule01")
+		assert.Equal(t, types.HealthHealthy, registry.Health().Status)
+	})
+
+	t.Run("Degraded", func(t *testing.T) {
+		registry.Report(types.HealthEndpointPrefix+"api", types.HealthDegraded, "slow")
+		report := registry.Health()
+		assert.Equal(t, types.HealthDegraded, report.Status)
+		assert.True(t, report.Ready)
+		registry.Report(types.HealthEndpointPrefix+"api", types.HealthHealthy, "")
+	})
+
+	t.Run("Liveness", func(t *testing.T) {
+		registry.Report("engine:deadlock", types.HealthUnhealthy, "deadlock detected")
+		report := registry.Health()
+		assert.False(t, report.Live)
+		assert.False(t, report.Ready)
+		registry.Remove("engine:deadlock")
+		assert.True(t, registry.Health().Live)
+	})
+}
+
+func TestChainHealth(t *testing.T) {
+	healthRegistry := NewHealthRegistry(types.HealthPolicy{})
+	config := NewConfig(types.WithHealthRegistry(healthRegistry))
+	chain, err := New("testChainHealth", []byte(`{"ruleChain":{"id":"testChainHealth"},"metadata":{"nodes":[{"id":"s1","type":"log","configuration":{"jsScript":"return msg;"}}]}}`), WithConfig(config))
+	assert.Nil(t, err)
+	ruleEngine := chain.(*RuleEngine)
+	assert.Equal(t, 0, len(healthRegistry.Health().Checks))
+
+	assert.Nil(t, ruleEngine.Disable())
+	report := healthRegistry.Health()
+	assert.False(t, report.Ready)
+	assert.Equal(t, types.HealthChainPrefix+"testChainHealth", report.Checks[0].Name)
+	assert.Equal(t, ErrDisabled.Error(), report.Checks[0].Reason)
+
+	assert.Nil(t, ruleEngine.Enable())
+	assert.True(t, healthRegistry.Health().Ready)
+
+	Del(ruleEngine.Id())
+	assert.Equal(t, 0, len(healthRegistry.Health().Checks))
+}
+
+func TestResourceHealth(t *testing.T) {
+	dependency := &slowDependency{}
+	dependency.readyAt.Store(time.Now().Add(time.Millisecond * 300))
+	registry := new(RuleComponentRegistry)
+	_ = registry.Register(&initPolicyNode{dependency: dependency})
+	healthRegistry := NewHealthRegistry(types.HealthPolicy{})
+	config := NewConfig(types.WithComponentsRegistry(registry), types.WithHealthRegistry(healthRegistry))
+
+	e, err := New("testResourceHealth", initPolicyChain("testResourceHealth", types.InitPolicyBackground), WithConfig(config))
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 100)
+	report := healthRegistry.Health()
+	assert.False(t, report.Ready)
+	assert.Equal(t, types.HealthResourcePrefix+"slow-dependency", report.Checks[0].Name)
+	assert.Equal(t, errDependencyDown.Error(), report.Checks[0].Reason)
+
+	//依赖服务恢复，第3次重试在600ms
+	time.Sleep(time.Millisecond * 800)
+	assert.True(t, healthRegistry.Health().Ready)
+
+	Del(e.Id())
+	assert.Equal(t, 0, len(healthRegistry.Health().Checks))
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/test/assert"
+)
+
+var errDependencyDown = errors.New("dependency down")
+
+// slowDependency 模拟在readyAt之后才可用的依赖服务
+type slowDependency struct {
+	readyAt  atomic.Value
+	attempts int32
+}
+
+func (d *slowDependency) connect() (*slowDependency, error) {
+	atomic.AddInt32(&d.attempts, 1)
+	if time.Now().Before(d.readyAt.Load().(time.Time)) {
+		return nil, errDependencyDown
+	}
+	return d, nil
+}
+
+// initPolicyNode 使用共享资源的测试节点
+type initPolicyNode struct {
+	base.SharedNode[*slowDependency]
+	dependency *slowDependency
+}
+
+func (n *initPolicyNode) Type() string {
+	return "test/initPolicy"
+}
+
+func (n *initPolicyNode) New() types.Node {
+	return &initPolicyNode{dependency: n.dependency}
+}
+
+func (n *initPolicyNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	n.InitRetryInterval = time.Millisecond * 200
+	n.InitMaxRetryInterval = time.Second
+	return n.SharedNode.Init(ruleConfig, n.Type(), "slow-dependency", ruleConfig.NodeClientInitNow, n.dependency.connect)
+}
+
+func (n *initPolicyNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	if _, err := n.SharedNode.Get(); err != nil {
+		ctx.TellFailure(msg, err)
+	} else {
+		ctx.TellSuccess(msg)
+	}
+}
+
+func (n *initPolicyNode) Destroy() {
+	n.SharedNode.StopBackgroundInit()
+}
+
+func initPolicyChain(id string, policy string) []byte {
+	return []byte(fmt.Sprintf(`{"ruleChain":{"id":"%s"},"metadata":{"nodes":[{"id":"s1","type":"test/initPolicy","configuration":{"initPolicy":"%s"}}]}}`, id, policy))
+}
+
+func TestInitPolicy(t *testing.T) {
+	dependency := &slowDependency{}
+	dependency.readyAt.Store(time.Now().Add(time.Hour))
+	registry := new(RuleComponentRegistry)
+	_ = registry.Register(&initPolicyNode{dependency: dependency})
+	eventBus := NewEventBus()
+	config := NewConfig(types.WithComponentsRegistry(registry), types.WithEventBus(eventBus))
+	//全局配置立即初始化，由节点配置覆盖
+	config.NodeClientInitNow = true
+
+	sendMsg := func(e types.RuleEngine) error {
+		var result error
+		e.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"), types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			result = err
+		}))
+		return result
+	}
+
+	t.Run("Eager", func(t *testing.T) {
+		_, err := New("eager", initPolicyChain("eager", ""), WithConfig(config))
+		assert.NotNil(t, err)
+		assert.True(t, strings.Contains(err.Error(), "id:s1"))
+		_, err = New("eager", initPolicyChain("eager", types.InitPolicyEager), WithConfig(config))
+		assert.True(t, strings.Contains(err.Error(), errDependencyDown.Error()))
+	})
+
+	t.Run("UnknownPolicy", func(t *testing.T) {
+		_, err := New("unknown", initPolicyChain("unknown", "never"), WithConfig(config))
+		assert.True(t, strings.Contains(err.Error(), "unknown initPolicy"))
+	})
+
+	t.Run("Lazy", func(t *testing.T) {
+		e, err := New("lazy", initPolicyChain("lazy", types.InitPolicyLazy), WithConfig(config))
+		assert.Nil(t, err)
+		defer e.Stop()
+		assert.Equal(t, errDependencyDown, sendMsg(e))
+	})
+
+	t.Run("Background", func(t *testing.T) {
+		sub, err := eventBus.Subscribe("resource.*", 0)
+		assert.Nil(t, err)
+		defer sub.Unsubscribe()
+		//依赖服务在规则链加载10秒后才可用
+		dependency.readyAt.Store(time.Now().Add(time.Second * 10))
+		start := time.Now()
+		e, err := New("background", initPolicyChain("background", types.InitPolicyBackground), WithConfig(config))
+		assert.Nil(t, err)
+		defer e.Stop()
+		assert.True(t, time.Since(start) < time.Second)
+		//就绪前立即失败
+		assert.Equal(t, base.ErrResourceInitializing, sendMsg(e))
+
+		event := <-sub.C()
+		assert.Equal(t, types.EventResourceUnhealthy, event.Type)
+		assert.Equal(t, "slow-dependency", event.Subject)
+		assert.Equal(t, errDependencyDown.Error(), event.Data["error"])
+		assert.Equal(t, 1, event.Data["attempt"])
+
+		var recovered types.Event
+		timeout := time.After(time.Second * 15)
+		for recovered.Type == "" {
+			select {
+			case event = <-sub.C():
+				if event.Type == types.EventResourceRecovered {
+					recovered = event
+				}
+			case <-timeout:
+				t.Fatal("resource not recovered")
+			}
+		}
+		assert.True(t, time.Since(start) >= time.Second*10)
+		assert.Equal(t, "test/initPolicy", recovered.Data["type"])
+		assert.Nil(t, sendMsg(e))
+	})
+
+	t.Run("StopBackgroundInit", func(t *testing.T) {
+		dependency.readyAt.Store(time.Now().Add(time.Hour))
+		e, err := New("stopped", initPolicyChain("stopped", types.InitPolicyBackground), WithConfig(config))
+		assert.Nil(t, err)
+		time.Sleep(time.Millisecond * 300)
+		e.Stop()
+		attempts := atomic.LoadInt32(&dependency.attempts)
+		time.Sleep(time.Millisecond * 800)
+		assert.Equal(t, attempts, atomic.LoadInt32(&dependency.attempts))
+	})
+
+	t.Run("ConcurrentGet", func(t *testing.T) {
+		var node initPolicyNode
+		node.dependency = dependency
+		dependency.readyAt.Store(time.Now())
+		assert.Nil(t, node.Init(types.Config{NodeClientInitPolicy: types.InitPolicyBackground}, nil))
+		defer node.Destroy()
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					if _, err := node.Get(); err != nil && err != base.ErrResourceInitializing {
+						t.Error(err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
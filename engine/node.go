@@ -27,6 +27,10 @@ import (
 
 const (
 	defaultNodeIdPrefix = "node"
+	// flowNodeType is the type of the sub-rule chain node, see flow.ChainNode
+	flowNodeType = "flow"
+	// flowNodeTargetIdKey is the configuration key of the sub-rule chain id of the flow node
+	flowNodeTargetIdKey = "targetId"
 )
 
 // RuleNodeCtx represents an instance of a node component within the rule engine.
@@ -37,6 +41,7 @@ type RuleNodeCtx struct {
 	config            types.Config     // Configuration of the rule engine
 	aspects           types.AspectList // List of AOP (Aspect-Oriented Programming) aspects
 	isInitNetResource bool             // Indicates if network resources should be initialized
+	queue             *nodeQueue       // Optional input queue, nil if RuleNode.QueueSize is not set
 	sync.RWMutex                       // Add mutex for thread safety
 }
 
@@ -79,6 +84,19 @@ func initRuleNodeCtx(config types.Config, chainCtx *RuleChainCtx, aspects types.
 		if err != nil {
 			return &RuleNodeCtx{}, fmt.Errorf("nodeType:%s for id:%s process variables error:%s", selfDefinition.Type, selfDefinition.Id, err.Error())
 		}
+		// Apply the per-node shared resource initialization policy.
+		if v, ok := configuration[types.NodeConfigurationKeyInitPolicy]; ok {
+			policy := str.ToString(v)
+			switch policy {
+			case "", types.InitPolicyEager, types.InitPolicyLazy, types.InitPolicyBackground:
+				config.NodeClientInitPolicy = policy
+			default:
+				return &RuleNodeCtx{}, fmt.Errorf("nodeType:%s for id:%s unknown initPolicy:%s", selfDefinition.Type, selfDefinition.Id, policy)
+			}
+		}
+		if err = checkOverflowPolicy(selfDefinition.OverflowPolicy); err != nil {
+			return &RuleNodeCtx{}, fmt.Errorf("nodeType:%s for id:%s %s", selfDefinition.Type, selfDefinition.Id, err.Error())
+		}
 		if isInitNetResource {
 			configuration[types.NodeConfigurationKeyIsInitNetResource] = true
 		}
@@ -90,14 +108,19 @@ func initRuleNodeCtx(config types.Config, chainCtx *RuleChainCtx, aspects types.
 			return &RuleNodeCtx{}, fmt.Errorf("nodeType:%s for id:%s init error:%s", selfDefinition.Type, selfDefinition.Id, err.Error())
 		} else {
 			// Return a RuleNodeCtx with the initialized node and provided context and definition.
-			return &RuleNodeCtx{
+			nodeCtx := &RuleNodeCtx{
 				Node:              node,
 				ChainCtx:          chainCtx,
 				SelfDefinition:    selfDefinition,
 				config:            config,
 				aspects:           aspects,
 				isInitNetResource: isInitNetResource,
-			}, nil
+			}
+			// The queue is bound to the node instance, so the messages queued before a reload are processed by the old node.
+			if selfDefinition.QueueSize > 0 {
+				nodeCtx.queue = newNodeQueue(selfDefinition.QueueSize, selfDefinition.OverflowPolicy, node.OnMsg)
+			}
+			return nodeCtx, nil
 		}
 	}
 }
@@ -146,13 +169,19 @@ func (rn *RuleNodeCtx) ReloadSelfFromDef(def types.RuleNode) error {
 		rn.Lock()
 		// Store old node for destruction after unlocking
 		oldNode := rn.Node
+		oldQueue := rn.queue
 		// Copy the new context (direct assignment to avoid additional Copy() call)
 		rn.Node = ctx.Node
 		rn.config = ctx.config
 		rn.aspects = ctx.aspects
 		rn.SelfDefinition = ctx.SelfDefinition
+		rn.queue = ctx.queue
 		rn.Unlock()
 
+		// Drain the old queue before destroying the old node
+		if oldQueue != nil {
+			oldQueue.close(rn.config.NodeQueueShutdownPolicy, rn.config.NodeQueueDrainTimeout)
+		}
 		// Destroy the old node after releasing the lock to avoid race conditions
 		if oldNode != nil {
 			oldNode.Destroy()
@@ -187,6 +216,54 @@ func (rn *RuleNodeCtx) Copy(newCtx *RuleNodeCtx) {
 	rn.config = newCtx.config
 	rn.aspects = newCtx.aspects
 	rn.SelfDefinition = newCtx.SelfDefinition
+	rn.queue = newCtx.queue
+}
+
+// OnMsg processes the message. If the node has an input queue, the message is queued and processed by the queue worker.
+func (rn *RuleNodeCtx) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	rn.RLock()
+	node, queue := rn.Node, rn.queue
+	rn.RUnlock()
+	if queue != nil {
+		queue.offer(ctx, msg)
+	} else {
+		node.OnMsg(ctx, msg)
+	}
+}
+
+// Destroy closes the input queue according to Config.NodeQueueShutdownPolicy, then destroys the node.
+func (rn *RuleNodeCtx) Destroy() {
+	rn.RLock()
+	node, queue, config := rn.Node, rn.queue, rn.config
+	rn.RUnlock()
+	if queue != nil {
+		queue.close(config.NodeQueueShutdownPolicy, config.NodeQueueDrainTimeout)
+	}
+	if node != nil {
+		node.Destroy()
+	}
+}
+
+// QueueStats returns the stats of the node input queue, false if the node has no input queue.
+func (rn *RuleNodeCtx) QueueStats() (NodeQueueStats, bool) {
+	rn.RLock()
+	queue := rn.queue
+	rn.RUnlock()
+	if queue == nil {
+		return NodeQueueStats{}, false
+	}
+	return queue.stats(), true
+}
+
+// Stats returns the runtime counters of the component, nil if the component does not implement types.StatsGetter.
+func (rn *RuleNodeCtx) Stats() map[string]int64 {
+	rn.RLock()
+	node := rn.Node
+	rn.RUnlock()
+	if getter, ok := node.(types.StatsGetter); ok {
+		return getter.Stats()
+	}
+	return nil
 }
 
 // processVariables replaces placeholders in the node configuration with global and chain-specific variables.
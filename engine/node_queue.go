@@ -0,0 +1,223 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+var (
+	// ErrNodeQueueFull is the error of messages rejected because the node input queue is full.
+	ErrNodeQueueFull = errors.New("node queue is full")
+	// ErrNodeQueueClosed is the error of messages rejected or left because the node input queue is closed.
+	ErrNodeQueueClosed = errors.New("node queue is closed")
+)
+
+// NodeQueueStats is a snapshot of the stats of a node input queue.
+type NodeQueueStats struct {
+	// Depth is the number of messages waiting in the queue.
+	Depth int
+	// Capacity is the capacity of the queue.
+	Capacity int
+	// Overflow is the number of messages that arrived when the queue was full.
+	Overflow int64
+}
+
+// nodeQueueItem is a message waiting in the node input queue together with its rule context.
+type nodeQueueItem struct {
+	ctx types.RuleContext
+	msg types.RuleMsg
+}
+
+// nodeQueue is a bounded input queue of a node. A single worker processes the queued messages in order.
+type nodeQueue struct {
+	capacity int
+	policy   string
+	// handler executes the node logic for a dequeued message
+	handler  func(ctx types.RuleContext, msg types.RuleMsg)
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    []nodeQueueItem
+	closed   bool
+	overflow int64
+	// done is closed when the worker exits
+	done chan struct{}
+}
+
+// newNodeQueue creates a node input queue and starts its worker.
+func newNodeQueue(capacity int, policy string, handler func(ctx types.RuleContext, msg types.RuleMsg)) *nodeQueue {
+	if policy == "" {
+		policy = types.OverflowPolicyBlock
+	}
+	q := &nodeQueue{
+		capacity: capacity,
+		policy:   policy,
+		handler:  handler,
+		done:     make(chan struct{}),
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	go q.run()
+	return q
+}
+
+// checkOverflowPolicy checks whether the overflow policy is supported.
+func checkOverflowPolicy(policy string) error {
+	switch policy {
+	case "", types.OverflowPolicyBlock, types.OverflowPolicyDropOldest, types.OverflowPolicyDropNew, types.OverflowPolicyFailure:
+		return nil
+	default:
+		return fmt.Errorf("unknown overflowPolicy:%s", policy)
+	}
+}
+
+// offer puts a message into the queue, applying the overflow policy if the queue is full.
+func (q *nodeQueue) offer(ctx types.RuleContext, msg types.RuleMsg) {
+	item := nodeQueueItem{ctx: ctx, msg: msg}
+	q.mu.Lock()
+	if !q.closed && len(q.items) >= q.capacity {
+		switch q.policy {
+		case types.OverflowPolicyDropOldest:
+			victim := q.items[0]
+			q.items[0] = nodeQueueItem{}
+			q.items = append(q.items[1:], item)
+			atomic.AddInt64(&q.overflow, 1)
+			q.mu.Unlock()
+			abortMsg(victim.ctx, victim.msg, ErrNodeQueueFull)
+			return
+		case types.OverflowPolicyDropNew:
+			atomic.AddInt64(&q.overflow, 1)
+			q.mu.Unlock()
+			abortMsg(ctx, msg, ErrNodeQueueFull)
+			return
+		case types.OverflowPolicyFailure:
+			atomic.AddInt64(&q.overflow, 1)
+			q.mu.Unlock()
+			ctx.TellFailure(msg, ErrNodeQueueFull)
+			return
+		default:
+			atomic.AddInt64(&q.overflow, 1)
+			for !q.closed && len(q.items) >= q.capacity {
+				q.notFull.Wait()
+			}
+		}
+	}
+	if q.closed {
+		q.mu.Unlock()
+		abortMsg(ctx, msg, ErrNodeQueueClosed)
+		return
+	}
+	q.items = append(q.items, item)
+	q.notEmpty.Signal()
+	q.mu.Unlock()
+}
+
+// run is the worker loop, processing the queued messages in order until the queue is closed and empty.
+func (q *nodeQueue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for !q.closed && len(q.items) == 0 {
+			q.notEmpty.Wait()
+		}
+		if len(q.items) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		item := q.items[0]
+		q.items[0] = nodeQueueItem{}
+		q.items = q.items[1:]
+		q.notFull.Signal()
+		q.mu.Unlock()
+		q.process(item)
+	}
+}
+
+// process executes the node logic for a message, routing a panic to the Failure relation.
+func (q *nodeQueue) process(item nodeQueueItem) {
+	defer func() {
+		if e := recover(); e != nil {
+			item.ctx.TellFailure(item.msg, fmt.Errorf("%v", e))
+		}
+	}()
+	q.handler(item.ctx, item.msg)
+}
+
+// close stops accepting messages and waits for the worker to exit, at most drainTimeout (0 means no limit).
+// With NodeQueueShutdownDrain the queued messages are processed first, otherwise they are passed to the dead letter callback,
+// and so are the messages left after the timeout.
+func (q *nodeQueue) close(policy string, drainTimeout time.Duration) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	var left []nodeQueueItem
+	if policy == types.NodeQueueShutdownDeadLetter {
+		left, q.items = q.items, nil
+	}
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+
+	for _, item := range left {
+		abortMsg(item.ctx, item.msg, ErrNodeQueueClosed)
+	}
+	if drainTimeout <= 0 {
+		<-q.done
+		return
+	}
+	select {
+	case <-q.done:
+	case <-time.After(drainTimeout):
+		q.mu.Lock()
+		left, q.items = q.items, nil
+		q.mu.Unlock()
+		for _, item := range left {
+			abortMsg(item.ctx, item.msg, ErrNodeQueueClosed)
+		}
+	}
+}
+
+// stats returns a snapshot of the queue stats.
+func (q *nodeQueue) stats() NodeQueueStats {
+	q.mu.Lock()
+	depth := len(q.items)
+	q.mu.Unlock()
+	return NodeQueueStats{
+		Depth:    depth,
+		Capacity: q.capacity,
+		Overflow: atomic.LoadInt64(&q.overflow),
+	}
+}
+
+// abortMsg terminates a message dropped by the node input queue, passing it to the dead letter and end callbacks.
+func abortMsg(ctx types.RuleContext, msg types.RuleMsg, err error) {
+	if defaultCtx, ok := ctx.(*DefaultRuleContext); ok {
+		defaultCtx.abort(msg, err)
+	} else {
+		ctx.TellFailure(msg, err)
+	}
+}
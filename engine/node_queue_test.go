@@ -0,0 +1,208 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// gateNode 阻塞直到gate关闭的测试节点，记录处理过的消息
+type gateNode struct {
+	gate      chan struct{}
+	mu        sync.Mutex
+	processed []string
+}
+
+func (n *gateNode) Type() string {
+	return "test/gate"
+}
+
+func (n *gateNode) New() types.Node {
+	return n
+}
+
+func (n *gateNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return nil
+}
+
+func (n *gateNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	<-n.gate
+	n.mu.Lock()
+	n.processed = append(n.processed, msg.GetData())
+	n.mu.Unlock()
+	ctx.TellSuccess(msg)
+}
+
+func (n *gateNode) Destroy() {
+}
+
+func (n *gateNode) getProcessed() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.processed...)
+}
+
+func queueChain(policy string) []byte {
+	return []byte(fmt.Sprintf(`{"ruleChain":{"id":"queue"},"metadata":{"nodes":[{"id":"s1","type":"test/gate","queueSize":1,"overflowPolicy":"%s"}]}}`, policy))
+}
+
+func TestNodeQueueOrder(t *testing.T) {
+	var mu sync.Mutex
+	var processed []string
+	q := newNodeQueue(2, types.OverflowPolicyBlock, func(ctx types.RuleContext, msg types.RuleMsg) {
+		mu.Lock()
+		processed = append(processed, msg.GetData())
+		mu.Unlock()
+	})
+	var expected []string
+	for i := 0; i < 100; i++ {
+		data := fmt.Sprintf("%d", i)
+		expected = append(expected, data)
+		q.offer(nil, types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), data))
+	}
+	q.close(types.NodeQueueShutdownDrain, 0)
+	assert.Equal(t, strings.Join(expected, ","), strings.Join(processed, ","))
+	assert.Equal(t, 0, q.stats().Depth)
+}
+
+func TestNodeQueue(t *testing.T) {
+	type deadLetter struct {
+		nodeId string
+		data   string
+		err    error
+	}
+	type end struct {
+		data         string
+		err          error
+		relationType string
+	}
+	newEngine := func(t *testing.T, policy string, opts ...types.Option) (*gateNode, *RuleEngine, chan deadLetter, chan end) {
+		node := &gateNode{gate: make(chan struct{})}
+		registry := new(RuleComponentRegistry)
+		_ = registry.Register(node)
+		deadLetters := make(chan deadLetter, 10)
+		opts = append(opts, types.WithComponentsRegistry(registry), types.WithOnDeadLetter(func(ruleChainId string, nodeId string, msg types.RuleMsg, err error) {
+			deadLetters <- deadLetter{nodeId: nodeId, data: msg.GetData(), err: err}
+		}))
+		config := NewConfig(opts...)
+		e, err := New(fmt.Sprintf("queue-%s-%d", policy, time.Now().UnixNano()), queueChain(policy), WithConfig(config))
+		assert.Nil(t, err)
+		ends := make(chan end, 10)
+		for i := 1; i <= 3; i++ {
+			e.OnMsg(types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), fmt.Sprintf("%d", i)), types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+				ends <- end{data: msg.GetData(), err: err, relationType: relationType}
+			}))
+			//保证消息按顺序到达节点
+			time.Sleep(time.Millisecond * 50)
+		}
+		return node, e.(*RuleEngine), deadLetters, ends
+	}
+
+	t.Run("UnknownPolicy", func(t *testing.T) {
+		registry := new(RuleComponentRegistry)
+		_ = registry.Register(&gateNode{})
+		_, err := New("queue-unknown", queueChain("never"), WithConfig(NewConfig(types.WithComponentsRegistry(registry))))
+		assert.Equal(t, "nodeType:test/gate for id:s1 unknown overflowPolicy:never", err.Error())
+	})
+
+	t.Run("DropNew", func(t *testing.T) {
+		node, e, deadLetters, ends := newEngine(t, types.OverflowPolicyDropNew)
+		defer e.Stop()
+		//1 在处理中，2 在队列中，3 被丢弃
+		assert.Equal(t, NodeQueueStats{Depth: 1, Capacity: 1, Overflow: 1}, e.NodeQueueStats()["s1"])
+		item := <-deadLetters
+		assert.Equal(t, deadLetter{nodeId: "s1", data: "3", err: ErrNodeQueueFull}, item)
+		assert.Equal(t, end{data: "3", err: ErrNodeQueueFull, relationType: types.Failure}, <-ends)
+		close(node.gate)
+		assert.Equal(t, types.Success, (<-ends).relationType)
+		assert.Equal(t, types.Success, (<-ends).relationType)
+		assert.Equal(t, "1,2", strings.Join(node.getProcessed(), ","))
+	})
+
+	t.Run("DropOldest", func(t *testing.T) {
+		node, e, deadLetters, ends := newEngine(t, types.OverflowPolicyDropOldest)
+		defer e.Stop()
+		assert.Equal(t, deadLetter{nodeId: "s1", data: "2", err: ErrNodeQueueFull}, <-deadLetters)
+		assert.Equal(t, end{data: "2", err: ErrNodeQueueFull, relationType: types.Failure}, <-ends)
+		close(node.gate)
+		assert.Equal(t, types.Success, (<-ends).relationType)
+		assert.Equal(t, types.Success, (<-ends).relationType)
+		assert.Equal(t, "1,3", strings.Join(node.getProcessed(), ","))
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		node, e, deadLetters, ends := newEngine(t, types.OverflowPolicyFailure)
+		defer e.Stop()
+		assert.Equal(t, end{data: "3", err: ErrNodeQueueFull, relationType: types.Failure}, <-ends)
+		assert.Equal(t, 0, len(deadLetters))
+		assert.Equal(t, int64(1), e.NodeQueueStats()["s1"].Overflow)
+		close(node.gate)
+		assert.Equal(t, types.Success, (<-ends).relationType)
+		assert.Equal(t, types.Success, (<-ends).relationType)
+		assert.Equal(t, "1,2", strings.Join(node.getProcessed(), ","))
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		node, e, _, ends := newEngine(t, types.OverflowPolicyBlock)
+		defer e.Stop()
+		assert.Equal(t, 0, len(ends))
+		close(node.gate)
+		for i := 1; i <= 3; i++ {
+			assert.Equal(t, types.Success, (<-ends).relationType)
+		}
+		assert.Equal(t, 3, len(node.getProcessed()))
+	})
+
+	t.Run("ShutdownDrain", func(t *testing.T) {
+		node, e, deadLetters, ends := newEngine(t, types.OverflowPolicyDropNew)
+		<-deadLetters
+		<-ends
+		time.AfterFunc(time.Millisecond*100, func() {
+			close(node.gate)
+		})
+		e.Stop()
+		assert.Equal(t, "1,2", strings.Join(node.getProcessed(), ","))
+	})
+
+	t.Run("ShutdownDeadLetter", func(t *testing.T) {
+		node, e, deadLetters, ends := newEngine(t, types.OverflowPolicyDropNew, types.WithNodeQueueShutdown(types.NodeQueueShutdownDeadLetter, 0))
+		<-deadLetters
+		<-ends
+		time.AfterFunc(time.Millisecond*100, func() {
+			close(node.gate)
+		})
+		e.Stop()
+		assert.Equal(t, deadLetter{nodeId: "s1", data: "2", err: ErrNodeQueueClosed}, <-deadLetters)
+		assert.Equal(t, "1", strings.Join(node.getProcessed(), ","))
+	})
+
+	t.Run("ShutdownDrainTimeout", func(t *testing.T) {
+		node, e, deadLetters, ends := newEngine(t, types.OverflowPolicyDropNew, types.WithNodeQueueShutdown(types.NodeQueueShutdownDrain, time.Millisecond*100))
+		<-deadLetters
+		<-ends
+		e.Stop()
+		assert.Equal(t, deadLetter{nodeId: "s1", data: "2", err: ErrNodeQueueClosed}, <-deadLetters)
+		close(node.gate)
+	})
+}
@@ -121,3 +121,36 @@ func TestNodeCtx(t *testing.T) {
 	})
 
 }
+
+func TestNodeStats(t *testing.T) {
+	ruleChain := `{
+	  "ruleChain": {"id": "trafficSplitStats"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "trafficSplit", "configuration": {"branches": [{"relation": "Canary", "weight": 100}, {"relation": "Stable", "weight": 0}]}},
+		  {"id": "s2", "type": "log"}
+		]
+	  }
+	}`
+	//相同规则链ID的不同引擎实例，计数互不影响
+	e1, err := NewRuleEngine("trafficSplitStats", []byte(ruleChain))
+	assert.Nil(t, err)
+	defer e1.Stop()
+	e2, err := NewRuleEngine("trafficSplitStats", []byte(ruleChain))
+	assert.Nil(t, err)
+	defer e2.Stop()
+
+	for i := 0; i < 3; i++ {
+		e1.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"))
+	}
+	e2.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"))
+	assert.Equal(t, map[string]map[string]int64{"s1": {"Canary": 3}}, e1.NodeStats())
+	assert.Equal(t, map[string]map[string]int64{"s1": {"Canary": 1}}, e2.NodeStats())
+
+	//重新加载节点配置，计数保留
+	err = e1.ReloadChild("s1", []byte(`{"id": "s1", "type": "trafficSplit", "configuration": {"branches": [{"relation": "Canary", "weight": 0}, {"relation": "Stable", "weight": 100}]}}`))
+	assert.Nil(t, err)
+	e1.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"))
+	assert.Equal(t, map[string]int64{"Canary": 3, "Stable": 1}, e1.NodeStats()["s1"])
+	assert.Equal(t, map[string]int64{"Canary": 1}, e2.NodeStats()["s1"])
+}
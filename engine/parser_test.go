@@ -19,6 +19,9 @@ package engine
 import (
 	"context"
 	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/filter"
+	"github.com/rulego/rulego/components/flow"
+	"github.com/rulego/rulego/components/transform"
 	"github.com/rulego/rulego/test/assert"
 	"github.com/rulego/rulego/utils/json"
 	"strings"
@@ -90,3 +93,68 @@ func TestParser(t *testing.T) {
 	_, err = jsonParser.EncodeRuleNode(map[interface{}]interface{}{})
 	assert.NotNil(t, err)
 }
+
+// fuzzRegistry 模糊测试使用的组件注册器，只包含没有外部连接的组件
+func fuzzRegistry() *RuleComponentRegistry {
+	registry := &RuleComponentRegistry{}
+	for _, node := range []types.Node{&transform.MetadataTransformNode{}, &filter.SwitchNode{},
+		&filter.ExprFilterNode{}, &filter.ForkNode{}, &flow.ChainNode{}} {
+		_ = registry.Register(node)
+	}
+	return registry
+}
+
+// FuzzDecodeRuleChain 解析和初始化任意规则链DSL不能panic
+func FuzzDecodeRuleChain(f *testing.F) {
+	f.Add([]byte(ruleChainFile))
+	f.Add([]byte(`{"ruleChain":{"id":"fuzz"},"metadata":{"nodes":[null]}}`))
+	f.Add([]byte(`{"ruleChain":{"id":"fuzz"},"metadata":{"firstNodeIndex":-1,"nodes":[{"id":"s1","type":"exprFilter"}]}}`))
+	f.Add([]byte(`{"ruleChain":{"id":"fuzz"},"metadata":{"nodes":[{"id":"s1","type":"fork"},{"id":"s1","type":"fork"}]}}`))
+	f.Add([]byte(`{"ruleChain":{"id":"fuzz"},"metadata":{"nodes":[{"id":"s1","type":"flow","configuration":{"targetId":"fuzz"}}]}}`))
+	f.Add([]byte(`{"ruleChain":{"id":"fuzz"},"metadata":{"nodes":[{"id":"s1","type":"fork"}],"ruleChainConnections":[{"fromId":"s1","toId":"fuzz","type":"Success"}]}}`))
+	f.Add([]byte(`{"ruleChain":{"id":"fuzz"},"metadata":{"nodes":[{"id":"s1","type":"fork"}],"connections":[{"fromId":"s1","toId":"s1","type":"Success"},{"fromId":"s9","toId":"s8"}]}}`))
+	f.Add([]byte(strings.Repeat(`{"ruleChain":`, 1000)))
+	config := NewConfig(types.WithComponentsRegistry(fuzzRegistry()))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		def, err := config.Parser.DecodeRuleChain(data)
+		if err != nil {
+			return
+		}
+		ruleChainCtx, err := InitRuleChainCtx(config, nil, &def)
+		if err != nil {
+			return
+		}
+		_, _ = config.Parser.EncodeRuleChain(ruleChainCtx.SelfDefinition)
+		_, _ = ruleChainCtx.GetFirstNode()
+		ruleChainCtx.Destroy()
+	})
+}
+
+// FuzzDecodeRuleNode 解析和初始化任意节点DSL不能panic
+func FuzzDecodeRuleNode(f *testing.F) {
+	f.Add([]byte(modifyMetadataAndMsgNode))
+	f.Add([]byte(`{"id":"s1","type":"switch","configuration":{"cases":[null,{"case":"","then":1}]}}`))
+	f.Add([]byte(`{"id":"s1","type":"flow","configuration":{"targetId":null}}`))
+	f.Add([]byte(`{"id":"` + strings.Repeat("s", 1<<16) + `","type":"fork"}`))
+	config := NewConfig(types.WithComponentsRegistry(fuzzRegistry()))
+	def, err := config.Parser.DecodeRuleChain([]byte(`{"ruleChain":{"id":"fuzz"},"metadata":{"nodes":[]}}`))
+	if err != nil {
+		f.Fatal(err)
+	}
+	ruleChainCtx, err := InitRuleChainCtx(config, nil, &def)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		node, err := config.Parser.DecodeRuleNode(data)
+		if err != nil {
+			return
+		}
+		nodeCtx, err := InitRuleNodeCtx(config, ruleChainCtx, nil, &node)
+		if err != nil {
+			return
+		}
+		_, _ = config.Parser.EncodeRuleNode(nodeCtx.SelfDefinition)
+		nodeCtx.Destroy()
+	})
+}
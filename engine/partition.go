@@ -0,0 +1,214 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/str"
+)
+
+// DefaultPartition is the partition of rule chains that do not specify one.
+const DefaultPartition = ""
+
+// AdditionalInfoKeyPartition is the ruleChain.additionalInfo key used to derive the partition of a rule chain
+// when it is not specified by WithPartition.
+const AdditionalInfoKeyPartition = "partition"
+
+var (
+	// ErrChainQuotaExceeded is returned when registering a rule chain into a partition that reached its MaxChains.
+	// Management APIs usually surface it as 409 Conflict.
+	ErrChainQuotaExceeded = errors.New("partition chain quota exceeded")
+	// ErrInFlightQuotaExceeded is passed to the OnEnd callbacks when a message is rejected because the partition
+	// reached its MaxInFlight. Management APIs usually surface it as 429 Too Many Requests.
+	ErrInFlightQuotaExceeded = errors.New("partition in-flight message quota exceeded")
+)
+
+// QuotaError is returned when a partition quota is exceeded.
+// Use errors.Is with ErrChainQuotaExceeded or ErrInFlightQuotaExceeded to check the kind of violation.
+type QuotaError struct {
+	// Partition is the partition id.
+	Partition string
+	// Limit is the configured quota.
+	Limit int64
+	// Err is ErrChainQuotaExceeded or ErrInFlightQuotaExceeded.
+	Err error
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: partition=%s, limit=%d", e.Err.Error(), e.Partition, e.Limit)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return e.Err
+}
+
+// PartitionQuota is the quota of a partition. Zero means unlimited.
+type PartitionQuota struct {
+	// MaxChains is the maximum number of rule chains in the partition, checked at registration.
+	MaxChains int `json:"maxChains"`
+	// MaxInFlight is the maximum number of messages being processed by the rule chains of the partition,
+	// checked when a message is admitted.
+	MaxInFlight int64 `json:"maxInFlight"`
+}
+
+// PartitionStats is a snapshot of the aggregate stats of a partition.
+type PartitionStats struct {
+	// Id is the partition id.
+	Id string `json:"id"`
+	// Quota is the configured quota.
+	Quota PartitionQuota `json:"quota"`
+	// Chains are the ids of the rule chains in the partition, sorted.
+	Chains []string `json:"chains"`
+	// InFlight is the number of messages being processed.
+	InFlight int64 `json:"inFlight"`
+	// Admitted is the number of messages admitted.
+	Admitted int64 `json:"admitted"`
+	// Rejected is the number of messages rejected by MaxInFlight.
+	Rejected int64 `json:"rejected"`
+	// Completed is the number of admitted messages that completed processing.
+	Completed int64 `json:"completed"`
+}
+
+// Partition groups the rule chains of a tenant in a pool, enforcing quotas and collecting aggregate stats.
+type Partition struct {
+	id string
+	sync.Mutex
+	quota  PartitionQuota
+	chains map[string]struct{}
+	// maxInFlight mirrors quota.MaxInFlight for lock-free admission.
+	maxInFlight int64
+	inFlight    int64
+	admitted    int64
+	rejected    int64
+	completed   int64
+}
+
+func newPartition(id string) *Partition {
+	return &Partition{id: id, chains: make(map[string]struct{})}
+}
+
+// Id returns the partition id.
+func (p *Partition) Id() string {
+	return p.id
+}
+
+// setQuota updates the quota. Existing rule chains are kept when MaxChains is lowered.
+func (p *Partition) setQuota(quota PartitionQuota) {
+	p.Lock()
+	defer p.Unlock()
+	p.quota = quota
+	atomic.StoreInt64(&p.maxInFlight, quota.MaxInFlight)
+}
+
+// addChain reserves a slot for the rule chain.
+func (p *Partition) addChain(chainId string) error {
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.chains[chainId]; ok {
+		return nil
+	}
+	if p.quota.MaxChains > 0 && len(p.chains) >= p.quota.MaxChains {
+		return &QuotaError{Partition: p.id, Limit: int64(p.quota.MaxChains), Err: ErrChainQuotaExceeded}
+	}
+	p.chains[chainId] = struct{}{}
+	return nil
+}
+
+// removeChain releases the slot of the rule chain.
+func (p *Partition) removeChain(chainId string) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.chains, chainId)
+}
+
+// admit reserves an in-flight slot for a message.
+func (p *Partition) admit() error {
+	n := atomic.AddInt64(&p.inFlight, 1)
+	if max := atomic.LoadInt64(&p.maxInFlight); max > 0 && n > max {
+		atomic.AddInt64(&p.inFlight, -1)
+		atomic.AddInt64(&p.rejected, 1)
+		return &QuotaError{Partition: p.id, Limit: max, Err: ErrInFlightQuotaExceeded}
+	}
+	atomic.AddInt64(&p.admitted, 1)
+	return nil
+}
+
+// release frees the in-flight slot of a completed message.
+func (p *Partition) release() {
+	atomic.AddInt64(&p.inFlight, -1)
+	atomic.AddInt64(&p.completed, 1)
+}
+
+// Stats returns a snapshot of the aggregate stats.
+func (p *Partition) Stats() PartitionStats {
+	p.Lock()
+	chains := make([]string, 0, len(p.chains))
+	for id := range p.chains {
+		chains = append(chains, id)
+	}
+	quota := p.quota
+	p.Unlock()
+	sort.Strings(chains)
+	return PartitionStats{
+		Id:        p.id,
+		Quota:     quota,
+		Chains:    chains,
+		InFlight:  atomic.LoadInt64(&p.inFlight),
+		Admitted:  atomic.LoadInt64(&p.admitted),
+		Rejected:  atomic.LoadInt64(&p.rejected),
+		Completed: atomic.LoadInt64(&p.completed),
+	}
+}
+
+// WithPartition is an option that assigns the rule engine to a partition of the pool.
+// It takes precedence over ruleChain.additionalInfo.partition, and only takes effect when the rule engine is registered.
+func WithPartition(partition string) types.RuleEngineOption {
+	return func(re types.RuleEngine) error {
+		if e, ok := re.(*RuleEngine); ok {
+			e.partitionId = partition
+		}
+		return nil
+	}
+}
+
+// resolvePartitionId returns the partition id specified by WithPartition or ruleChain.additionalInfo.partition.
+func (e *RuleEngine) resolvePartitionId() string {
+	if e.partitionId != "" {
+		return e.partitionId
+	}
+	if v, ok := e.Definition().RuleChain.GetAdditionalInfo(AdditionalInfoKeyPartition); ok && v != nil {
+		return str.ToString(v)
+	}
+	return DefaultPartition
+}
+
+// PartitionId returns the partition of the rule engine.
+func (e *RuleEngine) PartitionId() string {
+	return e.resolvePartitionId()
+}
+
+// getPartition returns the partition that enforces quotas for the rule engine, nil if not tracked.
+func (e *RuleEngine) getPartition() *Partition {
+	p, _ := e.partition.Load().(*Partition)
+	return p
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// blockNode 阻塞直到release关闭，用于保持消息处理中
+type blockNode struct {
+	release chan struct{}
+}
+
+func (n *blockNode) Type() string {
+	return "test/partitionBlock"
+}
+
+func (n *blockNode) New() types.Node {
+	return n
+}
+
+func (n *blockNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return nil
+}
+
+func (n *blockNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	<-n.release
+	ctx.TellSuccess(msg)
+}
+
+func (n *blockNode) Destroy() {
+}
+
+func partitionChain(id string, partition string) []byte {
+	additionalInfo := ""
+	if partition != "" {
+		additionalInfo = fmt.Sprintf(`,"additionalInfo":{"partition":"%s"}`, partition)
+	}
+	return []byte(fmt.Sprintf(`{"ruleChain":{"id":"%s"%s},"metadata":{"nodes":[{"id":"s1","type":"test/partitionBlock"}]}}`, id, additionalInfo))
+}
+
+func TestPartition(t *testing.T) {
+	node := &blockNode{release: make(chan struct{})}
+	registry := new(RuleComponentRegistry)
+	_ = registry.Register(node)
+	config := NewConfig(types.WithComponentsRegistry(registry))
+
+	pool := NewPool()
+	defer pool.Stop()
+	pool.SetPartitionQuota("tenantA", PartitionQuota{MaxChains: 2, MaxInFlight: 2})
+
+	t.Run("ChainQuota", func(t *testing.T) {
+		_, err := pool.New("a1", partitionChain("a1", "tenantA"), WithConfig(config))
+		assert.Nil(t, err)
+		//显式指定分区优先
+		_, err = pool.New("a2", partitionChain("a2", "tenantB"), WithConfig(config), WithPartition("tenantA"))
+		assert.Nil(t, err)
+		_, err = pool.New("a3", partitionChain("a3", "tenantA"), WithConfig(config))
+		assert.True(t, errors.Is(err, ErrChainQuotaExceeded))
+		var quotaErr *QuotaError
+		assert.True(t, errors.As(err, &quotaErr))
+		assert.Equal(t, "tenantA", quotaErr.Partition)
+		assert.Equal(t, int64(2), quotaErr.Limit)
+		_, ok := pool.Get("a3")
+		assert.False(t, ok)
+
+		//没有配置配额的分区和默认分区不受限制
+		_, err = pool.New("b1", partitionChain("b1", "tenantB"), WithConfig(config))
+		assert.Nil(t, err)
+		_, err = pool.New("d1", partitionChain("d1", ""), WithConfig(config))
+		assert.Nil(t, err)
+		_, ok = pool.Partition(DefaultPartition)
+		assert.False(t, ok)
+
+		assert.Equal(t, map[string][]string{
+			"tenantA": {"a1", "a2"},
+			"tenantB": {"b1"},
+			"":        {"d1"},
+		}, pool.ListByPartition())
+
+		//删除后释放配额
+		pool.Del("a2")
+		_, err = pool.New("a3", partitionChain("a3", "tenantA"), WithConfig(config))
+		assert.Nil(t, err)
+	})
+
+	t.Run("InFlightQuota", func(t *testing.T) {
+		a1, _ := pool.Get("a1")
+		a3, _ := pool.Get("a3")
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		var errs []error
+		onEnd := types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			lock.Lock()
+			defer lock.Unlock()
+			errs = append(errs, err)
+		})
+		for _, e := range []types.RuleEngine{a1, a3} {
+			wg.Add(1)
+			go func(e types.RuleEngine) {
+				defer wg.Done()
+				e.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"), onEnd)
+			}(e)
+		}
+		time.Sleep(time.Millisecond * 100)
+		p, _ := pool.Partition("tenantA")
+		assert.Equal(t, int64(2), p.Stats().InFlight)
+
+		//超过处理中消息配额，直接拒绝
+		a1.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"), onEnd)
+		lock.Lock()
+		assert.Equal(t, 1, len(errs))
+		assert.True(t, errors.Is(errs[0], ErrInFlightQuotaExceeded))
+		lock.Unlock()
+
+		//其他分区不受影响
+		b1, _ := pool.Get("b1")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b1.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"), onEnd)
+		}()
+		close(node.release)
+		wg.Wait()
+		assert.Equal(t, 4, len(errs))
+
+		stats := pool.PartitionStats()
+		assert.Equal(t, 2, len(stats))
+		assert.Equal(t, PartitionStats{
+			Id:        "tenantA",
+			Quota:     PartitionQuota{MaxChains: 2, MaxInFlight: 2},
+			Chains:    []string{"a1", "a3"},
+			InFlight:  0,
+			Admitted:  2,
+			Rejected:  1,
+			Completed: 2,
+		}, stats[0])
+		assert.Equal(t, "tenantB", stats[1].Id)
+		assert.Equal(t, int64(1), stats[1].Completed)
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		pool.Stop()
+		p, _ := pool.Partition("tenantA")
+		assert.Equal(t, 0, len(p.Stats().Chains))
+		assert.Equal(t, 0, len(pool.ListByPartition()))
+	})
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/rulego/rulego/utils/fs"
 	"github.com/rulego/rulego/utils/str"
 	"log"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -34,6 +35,15 @@ type Pool struct {
 	// A concurrent map to store rule engine instances.
 	entries   sync.Map
 	Callbacks types.Callbacks
+	// partitions are the tenant partitions, keyed by partition id.
+	partitions     map[string]*Partition
+	partitionsLock sync.Mutex
+	// EventBus receives the bulk job events, see SetEventBus.
+	EventBus types.EventBus
+	// bulkJobs are the bulk jobs kept for polling, keyed by job id, bulkJobIds in creation order.
+	bulkJobs     map[string]*BulkJob
+	bulkJobIds   []string
+	bulkJobsLock sync.Mutex
 }
 
 // NewPool creates a new instance of a rule engine pool.
@@ -89,6 +99,10 @@ func (g *Pool) New(id string, rootRuleChainSrc []byte, opts ...types.RuleEngineO
 		} else {
 			// Store the new rule engine instance in the pool.
 			if ruleEngine.Id() != "" {
+				if err := g.joinPartition(ruleEngine); err != nil {
+					ruleEngine.Stop()
+					return nil, err
+				}
 				g.entries.Store(ruleEngine.Id(), ruleEngine)
 			}
 			if g.Callbacks.OnUpdated != nil {
@@ -118,6 +132,7 @@ func (g *Pool) Del(id string) {
 	v, ok := g.entries.Load(id)
 	if ok {
 		v.(*RuleEngine).Stop()
+		g.leavePartition(v.(*RuleEngine))
 		g.entries.Delete(id)
 		if g.Callbacks.OnDeleted != nil {
 			g.Callbacks.OnDeleted(id)
@@ -130,6 +145,7 @@ func (g *Pool) Stop() {
 	g.entries.Range(func(key, value any) bool {
 		if item, ok := value.(*RuleEngine); ok {
 			item.Stop()
+			g.leavePartition(item)
 		}
 		g.entries.Delete(key)
 		if g.Callbacks.OnDeleted != nil {
@@ -167,6 +183,97 @@ func (g *Pool) SetCallbacks(callbacks types.Callbacks) {
 	g.Callbacks = callbacks
 }
 
+// SetPartitionQuota sets the quota of a partition, creating the partition if it does not exist.
+// Rule chains without a partition belong to DefaultPartition, which is only tracked after its quota is set,
+// and only the rule chains registered afterwards are counted.
+func (g *Pool) SetPartitionQuota(partition string, quota PartitionQuota) {
+	g.getOrCreatePartition(partition, true).setQuota(quota)
+}
+
+// Partition returns the partition by id.
+func (g *Pool) Partition(partition string) (*Partition, bool) {
+	g.partitionsLock.Lock()
+	defer g.partitionsLock.Unlock()
+	p, ok := g.partitions[partition]
+	return p, ok
+}
+
+// PartitionStats returns the aggregate stats of all tracked partitions, sorted by partition id.
+func (g *Pool) PartitionStats() []PartitionStats {
+	g.partitionsLock.Lock()
+	partitions := make([]*Partition, 0, len(g.partitions))
+	for _, p := range g.partitions {
+		partitions = append(partitions, p)
+	}
+	g.partitionsLock.Unlock()
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].id < partitions[j].id
+	})
+	stats := make([]PartitionStats, 0, len(partitions))
+	for _, p := range partitions {
+		stats = append(stats, p.Stats())
+	}
+	return stats
+}
+
+// ListByPartition returns the ids of all rule engine instances grouped by partition, sorted.
+func (g *Pool) ListByPartition() map[string][]string {
+	result := make(map[string][]string)
+	g.entries.Range(func(key, value any) bool {
+		if item, ok := value.(*RuleEngine); ok {
+			partition := item.PartitionId()
+			result[partition] = append(result[partition], item.Id())
+		}
+		return true
+	})
+	for _, ids := range result {
+		sort.Strings(ids)
+	}
+	return result
+}
+
+// getOrCreatePartition returns the partition by id, creating it if create is true.
+func (g *Pool) getOrCreatePartition(partition string, create bool) *Partition {
+	g.partitionsLock.Lock()
+	defer g.partitionsLock.Unlock()
+	if p, ok := g.partitions[partition]; ok {
+		return p
+	}
+	if !create {
+		return nil
+	}
+	if g.partitions == nil {
+		g.partitions = make(map[string]*Partition)
+	}
+	p := newPartition(partition)
+	g.partitions[partition] = p
+	return p
+}
+
+// joinPartition reserves a slot in the partition of the rule engine.
+// Rule engines in an untracked DefaultPartition are not affected.
+func (g *Pool) joinPartition(ruleEngine *RuleEngine) error {
+	partitionId := ruleEngine.resolvePartitionId()
+	// The partition is fixed at registration.
+	ruleEngine.partitionId = partitionId
+	p := g.getOrCreatePartition(partitionId, partitionId != DefaultPartition)
+	if p == nil {
+		return nil
+	}
+	if err := p.addChain(ruleEngine.Id()); err != nil {
+		return err
+	}
+	ruleEngine.partition.Store(p)
+	return nil
+}
+
+// leavePartition releases the slot of the rule engine in its partition.
+func (g *Pool) leavePartition(ruleEngine *RuleEngine) {
+	if p := ruleEngine.getPartition(); p != nil {
+		p.removeChain(ruleEngine.Id())
+	}
+}
+
 // Load loads all rule chain configurations from the specified folder and its subfolders into the default rule engine instance pool.
 // The rule chain ID is taken from the configuration file's ruleChain.id.
 func Load(folderPath string, opts ...types.RuleEngineOption) error {
@@ -170,6 +170,21 @@ func (r *RuleComponentRegistry) GetComponentForms() types.ComponentFormList {
 	return components
 }
 
+// Describe returns the configuration schema of the component, used to generate the configuration form.
+// The schema is derived from the component Config struct, see reflect.GetComponentForm.
+func (r *RuleComponentRegistry) Describe(componentType string) (types.ComponentForm, bool) {
+	node, err := r.NewNode(componentType)
+	if err != nil {
+		return types.ComponentForm{}, false
+	}
+	return reflect.GetComponentForm(node), true
+}
+
+// DescribeAll returns the configuration schemas of all registered components, sorted by category and type.
+func (r *RuleComponentRegistry) DescribeAll() []types.ComponentForm {
+	return r.GetComponentForms().Values()
+}
+
 // PluginComponentRegistry is an initializer for Go plugin components.
 type PluginComponentRegistry struct {
 	name     string
@@ -103,6 +103,16 @@ func (r *CustomComponentRegistry) GetComponentForms() types.ComponentFormList {
 	return components
 }
 
+// Describe returns the configuration schema of the component, custom components take precedence.
+func (r *CustomComponentRegistry) Describe(componentType string) (types.ComponentForm, bool) {
+	return r.GetComponentForms().GetComponent(componentType)
+}
+
+// DescribeAll returns the configuration schemas of all default and custom components, sorted by category and type.
+func (r *CustomComponentRegistry) DescribeAll() []types.ComponentForm {
+	return r.GetComponentForms().Values()
+}
+
 func (r *CustomComponentRegistry) DefaultComponents() types.ComponentRegistry {
 	return r.defaultComponents
 }
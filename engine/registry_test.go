@@ -19,6 +19,7 @@ package engine
 import (
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/test/assert"
+	"strings"
 	"testing"
 )
 
@@ -124,6 +125,60 @@ func TestCustomComponentRegistry(t *testing.T) {
 	}()
 }
 
+func TestDescribe(t *testing.T) {
+	form, ok := Registry.Describe("restApiCall")
+	assert.True(t, ok)
+	field, _ := form.Fields.GetField("requestMethod")
+	assert.Equal(t, []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}, field.Enum)
+	field, _ = form.Fields.GetField("proxyPassword")
+	assert.True(t, field.Secret)
+	_, ok = Registry.Describe("notFound")
+	assert.False(t, ok)
+
+	//用户必须填写的必填字段
+	requiredInputs := map[string]map[string]interface{}{
+		"exprFilter": {"expr": "true"},
+		"mapReduce":  {"targetId": "sub"},
+		"sendEmail":  {"to": "test@rulego.cc"},
+	}
+	//ssh初始化时连接服务器，sftp需要配置认证方式和服务端公钥校验，geoFence需要配置zones或者zonesFile其中之一
+	skips := map[string]bool{"ssh": true, "sftp": true, "geoFence": true}
+	config := NewConfig()
+	for _, form := range Registry.DescribeAll() {
+		if skips[form.Type] || strings.HasPrefix(form.Type, "test/") {
+			continue
+		}
+		node, err := Registry.NewNode(form.Type)
+		assert.Nil(t, err)
+		//跳过其他测试注册的动态组件
+		if _, ok := node.(*DynamicNode); ok {
+			continue
+		}
+		//使用表单的默认值生成的配置可以初始化组件
+		configuration := form.Fields.DefaultConfiguration()
+		fillRequired(t, form.Type, form.Fields, configuration, requiredInputs[form.Type])
+		if err = node.Init(config, configuration); err != nil {
+			t.Errorf("%s init with default configuration error:%v", form.Type, err)
+		}
+		node.Destroy()
+	}
+}
+
+// fillRequired 填写没有默认值的必填字段
+func fillRequired(t *testing.T, componentType string, fields types.ComponentFormFieldList, configuration types.Configuration, inputs map[string]interface{}) {
+	for _, field := range fields {
+		if len(field.Fields) > 0 {
+			fillRequired(t, componentType, field.Fields, configuration[field.Name].(types.Configuration), inputs)
+		} else if field.Required && (field.DefaultValue == nil || field.DefaultValue == "") {
+			if v, ok := inputs[field.Name]; ok {
+				configuration[field.Name] = v
+			} else {
+				t.Errorf("%s required field %s has no input", componentType, field.Name)
+			}
+		}
+	}
+}
+
 //以下是测试组件
 
 type BaseNode struct {
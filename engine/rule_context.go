@@ -19,6 +19,7 @@ package engine
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -33,7 +34,7 @@ var _ types.RuleContext = (*DefaultRuleContext)(nil)
 // GetEnv 获取环境变量和元数据
 func (ctx *DefaultRuleContext) GetEnv(msg types.RuleMsg, useMetadata bool) map[string]interface{} {
 	// 预分配合适大小的map，减少扩容开销
-	capacity := 7 // 基础字段数量：id, ts, data, msgType, dataType, msg, metadata
+	capacity := 9 // 基础字段数量：id, ts, eventTs, ingestTs, data, msgType, dataType, msg, metadata
 
 	// 预先获取metadata，避免重复调用Values()
 	var metadataValues map[string]string
@@ -49,6 +50,8 @@ func (ctx *DefaultRuleContext) GetEnv(msg types.RuleMsg, useMetadata bool) map[s
 	// 设置基础字段
 	evn[types.IdKey] = msg.Id
 	evn[types.TsKey] = msg.Ts
+	evn[types.EventTsKey] = msg.GetEventTs()
+	evn[types.IngestTsKey] = msg.GetIngestTs()
 	evn[types.DataKey] = msg.GetData()
 	evn[types.MsgTypeKey] = msg.Type
 	evn[types.DataTypeKey] = msg.DataType
@@ -226,6 +229,10 @@ type DefaultRuleContext struct {
 	// IN or OUT err
 	err        error
 	chainCache types.Cache
+	// Spill files of the message execution, nil if spilling is disabled.
+	spills *spillTracker
+	// Watchdog of the message execution, nil if the watchdog is disabled.
+	watch *msgWatch
 }
 
 func (ctx *DefaultRuleContext) GlobalCache() types.Cache {
@@ -412,6 +419,8 @@ func (ctx *DefaultRuleContext) NewNextNodeRuleContext(nextNode types.NodeCtx) *D
 	nextCtx.afterAspects = ctx.afterAspects
 	nextCtx.runSnapshot = ctx.runSnapshot
 	nextCtx.observer = ctx.observer
+	nextCtx.spills = ctx.spills
+	nextCtx.watch = ctx.watch
 	nextCtx.err = ctx.err
 	nextCtx.chainCache = ctx.ChainCache()
 
@@ -548,10 +557,19 @@ func (ctx *DefaultRuleContext) SubmitTask(task func()) {
 // TellFlow 执行子规则链，ruleChainId 规则链ID
 // onEndFunc 子规则链链分支执行完的回调，并返回该链执行结果，如果同时触发多个分支链，则会调用多次
 // onAllNodeCompleted 所以节点执行完触发，无结果返回
-// 如果找不到规则链，并把消息通过`Failure`关系发送到下一个节点
+// 如果找不到规则链：指定了 onEndFunc 或 onAllNodeCompleted 时，以 `Failure` 关系和错误回调 onEndFunc，再回调 onAllNodeCompleted，
+// 和 TellNode 找不到节点的处理一致，否则把消息通过`Failure`关系发送到下一个节点
 func (ctx *DefaultRuleContext) TellFlow(chanCtx context.Context, ruleChainId string, msg types.RuleMsg, onEndFunc types.OnEndFunc, onAllNodeCompleted func()) {
 	if e, ok := ctx.GetRuleChainPool().Get(ruleChainId); ok {
 		e.OnMsg(msg, types.WithOnEnd(onEndFunc), types.WithContext(chanCtx), types.WithOnAllNodeCompleted(onAllNodeCompleted))
+	} else if onEndFunc != nil || onAllNodeCompleted != nil {
+		//通知调用方，否则等待子规则链执行结束的调用方会一直阻塞
+		if onEndFunc != nil {
+			onEndFunc(ctx, msg, fmt.Errorf("ruleChain id=%s not found", ruleChainId), types.Failure)
+		}
+		if onAllNodeCompleted != nil {
+			onAllNodeCompleted()
+		}
 	} else {
 		ctx.TellFailure(msg, fmt.Errorf("ruleChain id=%s not found", ruleChainId))
 	}
@@ -631,8 +649,14 @@ func (ctx *DefaultRuleContext) SetOnAllNodeCompleted(onAllNodeCompleted func())
 
 // DoOnEnd  结束规则链分支执行，触发 OnEnd 回调函数
 func (ctx *DefaultRuleContext) DoOnEnd(msg types.RuleMsg, err error, relationType string) {
+	//消息已经被看门狗终止，不再触发结束回调
+	if ctx.watch.failed() {
+		ctx.childDone()
+		return
+	}
 	// 拷贝msg
 	safeMsgCopy := msg.Copy()
+	loadSpilled(ctx.config, safeMsgCopy)
 	// 确保Metadata不为nil，避免空指针异常
 	if safeMsgCopy.Metadata == nil {
 		safeMsgCopy.SetMetadata(types.NewMetadata())
@@ -698,6 +722,15 @@ func (ctx *DefaultRuleContext) GetCallbackFunc(functionName string) interface{}
 
 func (ctx *DefaultRuleContext) OnDebug(ruleChainId string, flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
 	msgCopy := msg.Copy()
+	if ctx.IsDebugMode() || ctx.runSnapshot != nil {
+		loadSpilled(ctx.config, msgCopy)
+	}
+	//开启了规则链限制，记录当前消息大小
+	if ctx.ruleChainCtx != nil && ctx.ruleChainCtx.Guardrails().Enabled() {
+		msgCopy.Metadata.PutValue(types.DebugMsgBytesKey, strconv.Itoa(msgCopy.GetDataSize()))
+		msgCopy.Metadata.PutValue(types.DebugMetadataEntriesKey, strconv.Itoa(msgCopy.Metadata.Len()))
+		msgCopy.Metadata.PutValue(types.DebugMetadataBytesKey, strconv.Itoa(msgCopy.Metadata.Bytes()))
+	}
 	if ctx.IsDebugMode() {
 		// 在提交异步任务前捕获需要的值，避免并发访问
 		onDebugFunc := ctx.config.OnDebug
@@ -825,6 +858,16 @@ func (ctx *DefaultRuleContext) tell(msg types.RuleMsg, err error, relationTypes
 func (ctx *DefaultRuleContext) tellOrElse(msg types.RuleMsg, err error, defaultRelationType string, relationTypes ...string) {
 	ctx.out = msg
 	ctx.err = err
+	//节点执行完成后检查消息是否超出规则链限制
+	if !ctx.isFirst && ctx.self != nil && ctx.ruleChainCtx != nil {
+		if guardrails := ctx.ruleChainCtx.Guardrails(); guardrails.Enabled() {
+			if limitErr := guardrails.Check(ctx.ruleChainCtx.GetNodeId().Id, ctx.self.GetNodeId().Id, msg); limitErr != nil {
+				ctx.abort(msg, limitErr)
+				return
+			}
+		}
+		ctx.spillIfNeeded(msg)
+	}
 	//msgCopy := msg.Copy()
 	if ctx.isFirst {
 		ctx.tellSelf(msg, err, relationTypes...)
@@ -865,6 +908,26 @@ func (ctx *DefaultRuleContext) tellOrElse(msg types.RuleMsg, err error, defaultR
 	}
 }
 
+// abort 终止消息执行，不再通知子节点，消息交给死信回调和结束回调处理
+func (ctx *DefaultRuleContext) abort(msg types.RuleMsg, err error) {
+	ctx.err = err
+	if ctx.watch.failed() {
+		ctx.childDone()
+		return
+	}
+	msg = ctx.executeAfterAop(msg, err, types.Failure)
+	if onDeadLetter := ctx.config.OnDeadLetter; onDeadLetter != nil {
+		ruleChainId := ctx.ruleChainCtx.GetNodeId().Id
+		nodeId := ctx.GetSelfId()
+		msgCopy := msg.Copy()
+		loadSpilled(ctx.config, msgCopy)
+		ctx.SubmitTask(func() {
+			onDeadLetter(ruleChainId, nodeId, msgCopy, err)
+		})
+	}
+	ctx.DoOnEnd(msg, err, types.Failure)
+}
+
 // 执行环绕aop
 // 返回值true: 继续执行下一个节点，否则不执行
 func (ctx *DefaultRuleContext) executeAroundAop(msg types.RuleMsg, relationType string) bool {
@@ -913,6 +976,15 @@ func (ctx *DefaultRuleContext) tellNext(msg types.RuleMsg, nextNode types.NodeCt
 		}
 	}()
 
+	if ctx.watch != nil {
+		//消息已经被看门狗终止，不再执行后续节点
+		if ctx.watch.failed() {
+			ctx.childDone()
+			return
+		}
+		ctx.watch.reach(nextNode.GetNodeId().Id)
+	}
+
 	nextCtx := ctx.NewNextNodeRuleContext(nextNode)
 
 	//环绕aop
@@ -18,8 +18,10 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -627,3 +629,126 @@ func TestRuleContext(t *testing.T) {
 		assert.Equal(t, int32(0), atomic.LoadInt32(&count))
 	})
 }
+
+// TestGuardrails 测试规则链消息大小限制
+func TestGuardrails(t *testing.T) {
+	ruleChainDsl := `{
+	  "ruleChain": {
+		"id": "guardrails01",
+		"debugMode": true,
+		"configuration": {
+		  "maxMsgBytes": 15,
+		  "maxMetadataEntries": 3
+		}
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id": "s1",
+			"type": "jsTransform",
+			"configuration": {
+			  "jsScript": "metadata['n']=metadata['n']+'1'; return {'msg':msg+'1234567890','metadata':metadata,'msgType':msgType};"
+			}
+		  },
+		  {
+			"id": "s2",
+			"type": "jsTransform",
+			"configuration": {
+			  "jsScript": "metadata['m']='1'; return {'msg':msg+'1234567890','metadata':metadata,'msgType':msgType};"
+			}
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s2",
+			"type": "Success"
+		  }
+		]
+	  }
+	}`
+	var deadLetterCount int32
+	var deadLetterNodeId atomic.Value
+	var debugMsgBytes sync.Map
+	config := NewConfig(types.WithOnDeadLetter(func(ruleChainId string, nodeId string, msg types.RuleMsg, err error) {
+		atomic.AddInt32(&deadLetterCount, 1)
+		deadLetterNodeId.Store(nodeId)
+	}), types.WithOnDebug(func(ruleChainId string, flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
+		if flowType == types.Out {
+			debugMsgBytes.Store(nodeId, msg.Metadata.GetValue(types.DebugMsgBytesKey))
+		}
+	}))
+	ruleEngine, err := New(str.RandomStr(10), []byte(ruleChainDsl), WithConfig(config))
+	assert.Nil(t, err)
+	defer ruleEngine.Stop()
+
+	t.Run("MaxMsgBytes", func(t *testing.T) {
+		var endErr error
+		var endNodeId string
+		msg := types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), "abc")
+		ruleEngine.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			endErr = err
+			endNodeId = ctx.GetSelfId()
+			assert.Equal(t, types.Failure, relationType)
+		}))
+		assert.Equal(t, "s2", endNodeId)
+		var limitErr *types.GuardrailError
+		assert.True(t, errors.As(endErr, &limitErr))
+		assert.True(t, errors.Is(endErr, types.ErrGuardrailExceeded))
+		assert.Equal(t, "s2", limitErr.NodeId)
+		assert.Equal(t, types.MaxMsgBytesKey, limitErr.Limit)
+		assert.Equal(t, 23, limitErr.Actual)
+		time.Sleep(time.Millisecond * 100)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&deadLetterCount))
+		assert.Equal(t, "s2", deadLetterNodeId.Load())
+		v, _ := debugMsgBytes.Load("s1")
+		assert.Equal(t, "13", v)
+	})
+
+	t.Run("MaxMetadataEntries", func(t *testing.T) {
+		var endErr error
+		msg := types.NewMsg(0, "TEST", types.TEXT, types.BuildMetadata(map[string]string{"a": "1", "b": "2", "c": "3"}), "")
+		ruleEngine.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			endErr = err
+		}))
+		var limitErr *types.GuardrailError
+		assert.True(t, errors.As(endErr, &limitErr))
+		assert.Equal(t, "s1", limitErr.NodeId)
+		assert.Equal(t, types.MaxMetadataEntriesKey, limitErr.Limit)
+		assert.Equal(t, 4, limitErr.Actual)
+	})
+
+	t.Run("NoLimit", func(t *testing.T) {
+		var endErr error
+		msg := types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), "")
+		ruleEngine.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			endErr = err
+			assert.Equal(t, "12345678901234567890", msg.GetData())
+		}))
+		//数据长度20超过限制
+		assert.NotNil(t, endErr)
+
+		err := ruleEngine.ReloadSelf([]byte(strings.Replace(ruleChainDsl, `"maxMsgBytes": 15`, `"maxMsgBytes": 0`, 1)))
+		assert.Nil(t, err)
+		endErr = nil
+		ruleEngine.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			endErr = err
+		}))
+		assert.Nil(t, endErr)
+	})
+}
+
+func TestMetadataBytes(t *testing.T) {
+	md := types.BuildMetadata(map[string]string{"ab": "123"})
+	assert.Equal(t, 5, md.Bytes())
+	md.PutValue("ab", "1")
+	assert.Equal(t, 3, md.Bytes())
+	copyMd := md.Copy()
+	copyMd.PutValue("c", "12")
+	assert.Equal(t, 3, md.Bytes())
+	assert.Equal(t, 6, copyMd.Bytes())
+	md.ReplaceAll(map[string]string{"x": "y"})
+	assert.Equal(t, 2, md.Bytes())
+	md.Clear()
+	assert.Equal(t, 0, md.Bytes())
+}
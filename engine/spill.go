@@ -0,0 +1,101 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"sync"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// sweptSpillDirs records the spill directories already swept for orphan spill files.
+var sweptSpillDirs sync.Map
+
+// sweepSpillDir deletes the spill files left by crashed processes, once per directory.
+func sweepSpillDir(config types.Config) {
+	if config.SpillThreshold <= 0 {
+		return
+	}
+	if _, loaded := sweptSpillDirs.LoadOrStore(config.SpillDir, true); loaded {
+		return
+	}
+	if count, err := types.SweepSpillFiles(config.SpillDir); err != nil {
+		if config.Logger != nil {
+			config.Logger.Printf("sweep spill files error:%s", err.Error())
+		}
+	} else if count > 0 && config.Logger != nil {
+		config.Logger.Printf("deleted %d orphan spill files", count)
+	}
+}
+
+// spillTracker holds the spill files of a message execution, shared by all contexts of the execution,
+// and releases them when the execution completes.
+type spillTracker struct {
+	mu    sync.Mutex
+	files []*types.SpillFile
+}
+
+// track retains the spill file until the execution completes.
+func (t *spillTracker) track(file *types.SpillFile) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, item := range t.files {
+		if item == file {
+			return
+		}
+	}
+	file.Retain()
+	t.files = append(t.files, file)
+}
+
+// release releases all spill files, the files are deleted if no other execution holds them.
+func (t *spillTracker) release() {
+	t.mu.Lock()
+	files := t.files
+	t.files = nil
+	t.mu.Unlock()
+	for _, file := range files {
+		file.Release()
+	}
+}
+
+// spillIfNeeded spills the msg data to disk if it exceeds Config.SpillThreshold, and tracks spilled data for cleanup.
+func (ctx *DefaultRuleContext) spillIfNeeded(msg types.RuleMsg) {
+	if ctx.spills == nil || msg.Data == nil {
+		return
+	}
+	if file := msg.Data.SpillFile(); file != nil {
+		ctx.spills.track(file)
+	} else if threshold := ctx.config.SpillThreshold; threshold > 0 && msg.GetDataSize() > threshold {
+		if file, err := msg.Data.Spill(ctx.config.SpillDir); err == nil {
+			ctx.spills.track(file)
+		} else if ctx.config.Logger != nil {
+			ctx.config.Logger.Printf("spill msg data error:%s", err.Error())
+		}
+	}
+}
+
+// loadSpilled reads spilled data of a msg handed over outside the execution back into memory,
+// because the spill file is deleted when the execution completes.
+func loadSpilled(config types.Config, msg types.RuleMsg) {
+	if !msg.IsSpilled() {
+		return
+	}
+	if err := msg.Data.Load(); err != nil && config.Logger != nil {
+		config.Logger.Printf("load spilled msg data error:%s", err.Error())
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// spillProbeNode 记录收到的消息是否落盘，配置了output则把消息负荷替换为output
+type spillProbeNode struct {
+	Output string
+	mu     *sync.Mutex
+	seen   *[]string
+}
+
+func (n *spillProbeNode) Type() string {
+	return "test/spillProbe"
+}
+
+func (n *spillProbeNode) New() types.Node {
+	return &spillProbeNode{mu: n.mu, seen: n.seen}
+}
+
+func (n *spillProbeNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	n.Output, _ = configuration["output"].(string)
+	return nil
+}
+
+func (n *spillProbeNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	n.mu.Lock()
+	*n.seen = append(*n.seen, fmt.Sprintf("%s:%t:%s", ctx.GetSelfId(), msg.IsSpilled(), msg.GetData()))
+	n.mu.Unlock()
+	if n.Output != "" {
+		msg.SetData(n.Output)
+	}
+	ctx.TellSuccess(msg)
+}
+
+func (n *spillProbeNode) Destroy() {
+}
+
+func spillFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	var files []string
+	for _, entry := range entries {
+		files = append(files, entry.Name())
+	}
+	return files
+}
+
+func TestSpill(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	registry := new(RuleComponentRegistry)
+	_ = registry.Register(&spillProbeNode{mu: &mu, seen: &seen})
+	dir := t.TempDir()
+	deadLetters := make(chan types.RuleMsg, 1)
+	config := NewConfig(types.WithComponentsRegistry(registry), types.WithSpill(10, dir),
+		types.WithOnDeadLetter(func(ruleChainId string, nodeId string, msg types.RuleMsg, err error) {
+			deadLetters <- msg
+		}))
+	payload := strings.Repeat("a", 20)
+
+	t.Run("SpillOnEnter", func(t *testing.T) {
+		seen = nil
+		//s1分叉到s2和s3
+		chain := `{"ruleChain":{"id":"spillEnter"},"metadata":{"nodes":[{"id":"s1","type":"test/spillProbe"},{"id":"s2","type":"test/spillProbe"},{"id":"s3","type":"test/spillProbe"}],
+			"connections":[{"fromId":"s1","toId":"s2","type":"Success"},{"fromId":"s1","toId":"s3","type":"Success"}]}}`
+		e, err := New("spillEnter", []byte(chain), WithConfig(config))
+		assert.Nil(t, err)
+		defer e.Stop()
+		msg := types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), payload)
+		var ends []string
+		var endMu sync.Mutex
+		e.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			endMu.Lock()
+			ends = append(ends, fmt.Sprintf("%t:%s", msg.IsSpilled(), msg.GetData()))
+			endMu.Unlock()
+		}))
+		//调用方的消息不落盘
+		assert.False(t, msg.IsSpilled())
+		assert.Equal(t, 3, len(seen))
+		for _, item := range seen {
+			assert.True(t, strings.HasSuffix(item, ":true:"+payload))
+		}
+		assert.Equal(t, []string{"false:" + payload, "false:" + payload}, ends)
+		assert.Equal(t, 0, len(spillFiles(t, dir)))
+	})
+
+	t.Run("SpillAfterNode", func(t *testing.T) {
+		seen = nil
+		chain := fmt.Sprintf(`{"ruleChain":{"id":"spillAfter"},"metadata":{"nodes":[{"id":"s1","type":"test/spillProbe","configuration":{"output":"%s"}},{"id":"s2","type":"test/spillProbe"}],
+			"connections":[{"fromId":"s1","toId":"s2","type":"Success"}]}}`, payload)
+		e, err := New("spillAfter", []byte(chain), WithConfig(config))
+		assert.Nil(t, err)
+		defer e.Stop()
+		e.OnMsgAndWait(types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), "small"))
+		assert.Equal(t, []string{"s1:false:small", "s2:true:" + payload}, seen)
+		assert.Equal(t, 0, len(spillFiles(t, dir)))
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		chain := fmt.Sprintf(`{"ruleChain":{"id":"spillDeadLetter","configuration":{"maxMsgBytes":15}},"metadata":{"nodes":[{"id":"s1","type":"test/spillProbe","configuration":{"output":"%s"}}]}}`, payload)
+		e, err := New("spillDeadLetter", []byte(chain), WithConfig(config))
+		assert.Nil(t, err)
+		defer e.Stop()
+		var endErr error
+		e.OnMsgAndWait(types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), "small"), types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			endErr = err
+		}))
+		assert.True(t, errors.Is(endErr, types.ErrGuardrailExceeded))
+		msg := <-deadLetters
+		assert.Equal(t, payload, msg.GetData())
+		assert.Equal(t, 0, len(spillFiles(t, dir)))
+	})
+
+	t.Run("SubChain", func(t *testing.T) {
+		seen = nil
+		subChain := `{"ruleChain":{"id":"spillSub"},"metadata":{"nodes":[{"id":"sub1","type":"test/spillProbe"}]}}`
+		sub, err := New("spillSub", []byte(subChain), WithConfig(config))
+		assert.Nil(t, err)
+		defer sub.Stop()
+		chain := `{"ruleChain":{"id":"spillMain"},"metadata":{"nodes":[{"id":"s1","type":"flow","configuration":{"targetId":"spillSub"}},{"id":"s2","type":"test/spillProbe"}],
+			"connections":[{"fromId":"s1","toId":"s2","type":"Success"}]}}`
+		registry.Register(&flowNodeStub{})
+		e, err := New("spillMain", []byte(chain), WithConfig(config))
+		assert.Nil(t, err)
+		defer e.Stop()
+		e.OnMsgAndWait(types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), payload))
+		assert.Equal(t, []string{"sub1:true:" + payload, "s2:true:" + payload}, seen)
+		assert.Equal(t, 0, len(spillFiles(t, dir)))
+	})
+
+	t.Run("SweepOrphans", func(t *testing.T) {
+		sweepDir := t.TempDir()
+		orphan := filepath.Join(sweepDir, types.SpillFilePrefix+"2147483646-1")
+		own := filepath.Join(sweepDir, fmt.Sprintf("%s%d-1", types.SpillFilePrefix, os.Getpid()))
+		other := filepath.Join(sweepDir, "other")
+		for _, file := range []string{orphan, own, other} {
+			assert.Nil(t, os.WriteFile(file, []byte("x"), 0600))
+		}
+		e, err := New("spillSweep", []byte(`{"ruleChain":{"id":"spillSweep"},"metadata":{"nodes":[{"id":"s1","type":"test/spillProbe"}]}}`),
+			WithConfig(NewConfig(types.WithComponentsRegistry(registry), types.WithSpill(10, sweepDir))))
+		assert.Nil(t, err)
+		defer e.Stop()
+		assert.Equal(t, []string{"other", filepath.Base(own)}, spillFiles(t, sweepDir))
+	})
+}
+
+// flowNodeStub 调用子规则链，子规则链的结果发送到Success链
+type flowNodeStub struct {
+	TargetId string
+}
+
+func (n *flowNodeStub) Type() string {
+	return "flow"
+}
+
+func (n *flowNodeStub) New() types.Node {
+	return &flowNodeStub{}
+}
+
+func (n *flowNodeStub) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	n.TargetId, _ = configuration["targetId"].(string)
+	return nil
+}
+
+func (n *flowNodeStub) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	var result types.RuleMsg
+	var resultErr error
+	ctx.TellFlow(ctx.GetContext(), n.TargetId, msg, func(subCtx types.RuleContext, subMsg types.RuleMsg, err error, relationType string) {
+		result, resultErr = subMsg, err
+	}, func() {
+		if resultErr != nil {
+			ctx.TellFailure(result, resultErr)
+		} else {
+			ctx.TellSuccess(result)
+		}
+	})
+}
+
+func (n *flowNodeStub) Destroy() {
+}
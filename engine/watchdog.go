@@ -0,0 +1,354 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/cast"
+)
+
+var (
+	// watchdogTick is the tick of the timing wheel, the precision of the watchdog.
+	watchdogTick = 100 * time.Millisecond
+	// watchdogSlots is the number of slots of the timing wheel.
+	watchdogSlots = 512
+	// defaultWatchdog is shared by all rule engines, its sweeper goroutine only runs while messages are watched.
+	defaultWatchdog = newWatchdog(watchdogTick, watchdogSlots)
+)
+
+// States of a watched message execution.
+const (
+	watchRunning int32 = iota
+	watchCompleted
+	watchFailed
+)
+
+// watchdogConfig is the watchdog configuration of a rule chain.
+type watchdogConfig struct {
+	maxProcessingTime time.Duration
+	action            string
+}
+
+// enabled returns whether the watchdog is enabled.
+func (c watchdogConfig) enabled() bool {
+	return c.maxProcessingTime > 0
+}
+
+// parseWatchdogConfig parses the watchdog configuration from the rule chain configuration.
+// maxProcessingTime is a duration string such as 30s, or a number of milliseconds.
+func parseWatchdogConfig(configuration types.Configuration) (watchdogConfig, error) {
+	var config watchdogConfig
+	if configuration == nil {
+		return config, nil
+	}
+	switch v := configuration[types.MaxProcessingTimeKey].(type) {
+	case nil:
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			break
+		}
+		if ms, err := cast.ToFloat64E(v); err == nil {
+			config.maxProcessingTime = time.Duration(ms * float64(time.Millisecond))
+		} else if d, err := time.ParseDuration(v); err == nil {
+			config.maxProcessingTime = d
+		} else {
+			return config, fmt.Errorf("invalid %s:%s", types.MaxProcessingTimeKey, v)
+		}
+	default:
+		ms, err := cast.ToFloat64E(v)
+		if err != nil {
+			return config, fmt.Errorf("invalid %s:%v", types.MaxProcessingTimeKey, v)
+		}
+		config.maxProcessingTime = time.Duration(ms * float64(time.Millisecond))
+	}
+	if config.maxProcessingTime < 0 {
+		return config, fmt.Errorf("invalid %s:%s", types.MaxProcessingTimeKey, config.maxProcessingTime)
+	}
+	config.action = strings.ToLower(strings.TrimSpace(cast.ToString(configuration[types.WatchdogActionKey])))
+	switch config.action {
+	case "":
+		config.action = types.WatchdogActionLog
+	case types.WatchdogActionLog, types.WatchdogActionFail, types.WatchdogActionCancel:
+	default:
+		return config, fmt.Errorf("unknown %s:%s", types.WatchdogActionKey, config.action)
+	}
+	return config, nil
+}
+
+// msgWatch is a watched message execution.
+type msgWatch struct {
+	watchdog *watchdog
+	config   watchdogConfig
+	start    time.Time
+	// state is one of watchRunning, watchCompleted and watchFailed
+	state int32
+	// lastNodeId is the id of the last node reached by the message
+	lastNodeId atomic.Value
+	// onExpired is called once when the deadline is exceeded
+	onExpired func(w *msgWatch, elapsed time.Duration)
+
+	// The following fields are guarded by watchdog.mu
+	deadline  time.Time
+	slot      int
+	rounds    int
+	scheduled bool
+}
+
+// reach records the last node reached by the message.
+func (w *msgWatch) reach(nodeId string) {
+	w.lastNodeId.Store(nodeId)
+}
+
+// lastNode returns the id of the last node reached by the message.
+func (w *msgWatch) lastNode() string {
+	nodeId, _ := w.lastNodeId.Load().(string)
+	return nodeId
+}
+
+// complete marks the execution completed and stops watching it, returns false if it has been failed by the watchdog.
+func (w *msgWatch) complete() bool {
+	if !atomic.CompareAndSwapInt32(&w.state, watchRunning, watchCompleted) {
+		return false
+	}
+	w.watchdog.remove(w)
+	return true
+}
+
+// fail marks the execution failed by the watchdog, returns false if it has completed.
+func (w *msgWatch) fail() bool {
+	return atomic.CompareAndSwapInt32(&w.state, watchRunning, watchFailed)
+}
+
+// failed returns whether the execution has been failed by the watchdog, the remaining nodes are not executed.
+func (w *msgWatch) failed() bool {
+	return w != nil && atomic.LoadInt32(&w.state) == watchFailed
+}
+
+// ExtendDeadline extends the deadline by d, implements types.DeadlineExtender.
+func (w *msgWatch) ExtendDeadline(d time.Duration) {
+	if d > 0 {
+		w.watchdog.extend(w, d)
+	}
+}
+
+// watchdog detects the message executions exceeding their deadline with a timing wheel,
+// adding, removing and extending a watch are O(1), a single sweeper goroutine checks one slot per tick.
+type watchdog struct {
+	tick    time.Duration
+	slots   []map[*msgWatch]struct{}
+	cursor  int
+	count   int
+	running bool
+	mu      sync.Mutex
+}
+
+// newWatchdog creates a watchdog with the given tick and number of slots.
+func newWatchdog(tick time.Duration, slots int) *watchdog {
+	w := &watchdog{tick: tick, slots: make([]map[*msgWatch]struct{}, slots)}
+	for i := range w.slots {
+		w.slots[i] = make(map[*msgWatch]struct{})
+	}
+	return w
+}
+
+// watch starts watching a message execution, onExpired is called once in a new goroutine if the deadline is exceeded.
+func (wd *watchdog) watch(config watchdogConfig, onExpired func(w *msgWatch, elapsed time.Duration)) *msgWatch {
+	now := time.Now()
+	w := &msgWatch{watchdog: wd, config: config, start: now, deadline: now.Add(config.maxProcessingTime), onExpired: onExpired}
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	wd.schedule(w, now)
+	wd.count++
+	if !wd.running {
+		wd.running = true
+		go wd.run()
+	}
+	return w
+}
+
+// schedule puts the watch into the slot of its deadline, the caller must hold the lock.
+func (wd *watchdog) schedule(w *msgWatch, now time.Time) {
+	ticks := int((w.deadline.Sub(now) + wd.tick - 1) / wd.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	n := len(wd.slots)
+	w.slot = (wd.cursor + ticks) % n
+	w.rounds = (ticks - 1) / n
+	w.scheduled = true
+	wd.slots[w.slot][w] = struct{}{}
+}
+
+// remove stops watching the execution.
+func (wd *watchdog) remove(w *msgWatch) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	if w.scheduled {
+		delete(wd.slots[w.slot], w)
+		w.scheduled = false
+		wd.count--
+	}
+}
+
+// extend extends the deadline of the execution, the watch is rescheduled lazily when its slot is reached.
+func (wd *watchdog) extend(w *msgWatch, d time.Duration) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	if w.scheduled {
+		w.deadline = w.deadline.Add(d)
+	}
+}
+
+// run advances the wheel every tick, it exits when no execution is watched.
+func (wd *watchdog) run() {
+	ticker := time.NewTicker(wd.tick)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		expired, stop := wd.advance(now)
+		for _, w := range expired {
+			go w.onExpired(w, now.Sub(w.start))
+		}
+		if stop {
+			return
+		}
+	}
+}
+
+// advance moves the cursor to the next slot and returns the expired executions of the slot.
+func (wd *watchdog) advance(now time.Time) (expired []*msgWatch, stop bool) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	wd.cursor = (wd.cursor + 1) % len(wd.slots)
+	var extended []*msgWatch
+	slot := wd.slots[wd.cursor]
+	for w := range slot {
+		if w.rounds > 0 {
+			w.rounds--
+			continue
+		}
+		delete(slot, w)
+		if now.Before(w.deadline) {
+			extended = append(extended, w)
+		} else {
+			w.scheduled = false
+			wd.count--
+			expired = append(expired, w)
+		}
+	}
+	for _, w := range extended {
+		wd.schedule(w, now)
+	}
+	if wd.count <= 0 {
+		wd.running = false
+		stop = true
+	}
+	return expired, stop
+}
+
+// startWatch watches the message execution of the root context if the watchdog of the rule chain is enabled.
+// It must be called after onAllNodeCompleted of the root context has been set.
+func (e *RuleEngine) startWatch(rootCtxCopy *DefaultRuleContext, msg types.RuleMsg) {
+	config := rootCtxCopy.ruleChainCtx.watchdogConfig()
+	if !config.enabled() {
+		return
+	}
+	c := rootCtxCopy.GetContext()
+	if c == nil {
+		c = context.Background()
+	}
+	var cancel context.CancelFunc
+	if config.action == types.WatchdogActionCancel {
+		c, cancel = context.WithCancel(c)
+	}
+	onAllNodeCompleted := rootCtxCopy.onAllNodeCompleted
+	onEnd := rootCtxCopy.onEnd
+	w := defaultWatchdog.watch(config, func(w *msgWatch, elapsed time.Duration) {
+		e.onWatchExpired(rootCtxCopy, w, msg, elapsed, cancel, onEnd, onAllNodeCompleted)
+	})
+	rootCtxCopy.watch = w
+	rootCtxCopy.context = types.WithDeadlineExtender(c, w)
+	rootCtxCopy.onAllNodeCompleted = func() {
+		if !w.complete() {
+			//已经被看门狗终止
+			return
+		}
+		if cancel != nil {
+			cancel()
+		}
+		if onAllNodeCompleted != nil {
+			onAllNodeCompleted()
+		}
+	}
+}
+
+// onWatchExpired reports the stuck message and applies the watchdog action.
+func (e *RuleEngine) onWatchExpired(rootCtxCopy *DefaultRuleContext, w *msgWatch, msg types.RuleMsg, elapsed time.Duration,
+	cancel context.CancelFunc, onEnd types.OnEndFunc, onAllNodeCompleted func()) {
+	if atomic.LoadInt32(&w.state) != watchRunning {
+		return
+	}
+	ruleChainId := rootCtxCopy.ruleChainCtx.GetNodeId().Id
+	nodeId := w.lastNode()
+	//包含延长的时间
+	w.watchdog.mu.Lock()
+	maxProcessingTime := w.deadline.Sub(w.start)
+	w.watchdog.mu.Unlock()
+	config := rootCtxCopy.config
+	config.PublishEvent(types.EventMsgStuck, ruleChainId, map[string]interface{}{
+		"msgId":             msg.Id,
+		"nodeId":            nodeId,
+		"elapsed":           elapsed.Milliseconds(),
+		"maxProcessingTime": maxProcessingTime.Milliseconds(),
+		"action":            w.config.action,
+	})
+	if config.Logger != nil {
+		config.Logger.Printf("watchdog: message stuck chain=%s node=%s msgId=%s elapsed=%s action=%s", ruleChainId, nodeId, msg.Id, elapsed, w.config.action)
+	}
+	switch w.config.action {
+	case types.WatchdogActionCancel:
+		if cancel != nil {
+			cancel()
+		}
+	case types.WatchdogActionFail:
+		if !w.fail() {
+			return
+		}
+		err := &types.ProcessingTimeoutError{RuleChainId: ruleChainId, NodeId: nodeId, Elapsed: elapsed, MaxProcessingTime: maxProcessingTime}
+		msgCopy := msg.Copy()
+		loadSpilled(config, msgCopy)
+		if config.OnDeadLetter != nil {
+			config.OnDeadLetter(ruleChainId, nodeId, msgCopy, err)
+		}
+		if config.OnEnd != nil {
+			config.OnEnd(msgCopy, err)
+		}
+		if onEnd != nil {
+			onEnd(rootCtxCopy, msgCopy, err, types.Failure)
+		}
+		if onAllNodeCompleted != nil {
+			onAllNodeCompleted()
+		}
+	}
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/action"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/cast"
+)
+
+// sleepNode 休眠指定时间或者直到context被取消，用于模拟卡住的消息
+type sleepNode struct {
+	sleep time.Duration
+	//执行次数，所有实例共享
+	calls *int32
+}
+
+func (n *sleepNode) Type() string {
+	return "test/watchdogSleep"
+}
+
+func (n *sleepNode) New() types.Node {
+	return &sleepNode{calls: n.calls}
+}
+
+func (n *sleepNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	n.sleep = time.Duration(cast.ToInt(configuration["sleep"])) * time.Millisecond
+	return nil
+}
+
+func (n *sleepNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	atomic.AddInt32(n.calls, 1)
+	select {
+	case <-time.After(n.sleep):
+		ctx.TellSuccess(msg)
+	case <-ctx.GetContext().Done():
+		ctx.TellFailure(msg, ctx.GetContext().Err())
+	}
+}
+
+func (n *sleepNode) Destroy() {
+}
+
+func TestParseWatchdogConfig(t *testing.T) {
+	tests := []struct {
+		configuration types.Configuration
+		max           time.Duration
+		action        string
+		hasErr        bool
+	}{
+		{nil, 0, "", false},
+		{types.Configuration{}, 0, types.WatchdogActionLog, false},
+		{types.Configuration{types.MaxProcessingTimeKey: "30s"}, 30 * time.Second, types.WatchdogActionLog, false},
+		{types.Configuration{types.MaxProcessingTimeKey: "1500"}, 1500 * time.Millisecond, types.WatchdogActionLog, false},
+		{types.Configuration{types.MaxProcessingTimeKey: float64(200), types.WatchdogActionKey: " FAIL "}, 200 * time.Millisecond, types.WatchdogActionFail, false},
+		{types.Configuration{types.MaxProcessingTimeKey: 100, types.WatchdogActionKey: "cancel"}, 100 * time.Millisecond, types.WatchdogActionCancel, false},
+		{types.Configuration{types.MaxProcessingTimeKey: "abc"}, 0, "", true},
+		{types.Configuration{types.MaxProcessingTimeKey: "-1s"}, 0, "", true},
+		{types.Configuration{types.MaxProcessingTimeKey: true}, 0, "", true},
+		{types.Configuration{types.MaxProcessingTimeKey: "1s", types.WatchdogActionKey: "retry"}, 0, "", true},
+	}
+	for _, tt := range tests {
+		config, err := parseWatchdogConfig(tt.configuration)
+		assert.Equal(t, tt.hasErr, err != nil)
+		if !tt.hasErr {
+			assert.Equal(t, tt.max, config.maxProcessingTime)
+			assert.Equal(t, tt.action, config.action)
+		}
+	}
+
+	_, err := New("testWatchdogInvalid", []byte(`{"ruleChain":{"id":"testWatchdogInvalid","configuration":{"maxProcessingTime":"abc"}},"metadata":{"nodes":[]}}`))
+	assert.NotNil(t, err)
+}
+
+func TestWatchdogWheel(t *testing.T) {
+	wd := newWatchdog(10*time.Millisecond, 8)
+	expired := make(chan string, 3)
+	onExpired := func(name string) func(w *msgWatch, elapsed time.Duration) {
+		return func(w *msgWatch, elapsed time.Duration) {
+			expired <- fmt.Sprintf("%s:%t", name, elapsed >= w.config.maxProcessingTime)
+		}
+	}
+	start := time.Now()
+	//超过一圈
+	wd.watch(watchdogConfig{maxProcessingTime: 150 * time.Millisecond}, onExpired("long"))
+	removed := wd.watch(watchdogConfig{maxProcessingTime: 50 * time.Millisecond}, onExpired("removed"))
+	extended := wd.watch(watchdogConfig{maxProcessingTime: 30 * time.Millisecond}, onExpired("extended"))
+	extended.ExtendDeadline(200 * time.Millisecond)
+	assert.True(t, removed.complete())
+	assert.False(t, removed.fail())
+
+	assert.Equal(t, "long:true", <-expired)
+	assert.Equal(t, "extended:true", <-expired)
+	assert.True(t, time.Since(start) >= 230*time.Millisecond)
+	select {
+	case name := <-expired:
+		t.Errorf("unexpected expired:%s", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+	//没有监视的消息后，扫描协程退出
+	wd.mu.Lock()
+	assert.Equal(t, 0, wd.count)
+	assert.False(t, wd.running)
+	wd.mu.Unlock()
+}
+
+func TestWatchdog(t *testing.T) {
+	registry := new(RuleComponentRegistry)
+	node := &sleepNode{calls: new(int32)}
+	_ = registry.Register(node)
+	_ = registry.Register(&action.DelayNode{})
+	eventBus := NewEventBus()
+	events, _ := eventBus.Subscribe(types.EventMsgStuck, 10)
+	defer events.Unsubscribe()
+
+	var deadLetters int32
+	var deadLetterErr atomic.Value
+	config := NewConfig(types.WithComponentsRegistry(registry), types.WithEventBus(eventBus),
+		types.WithOnDeadLetter(func(ruleChainId string, nodeId string, msg types.RuleMsg, err error) {
+			atomic.AddInt32(&deadLetters, 1)
+			deadLetterErr.Store(err)
+		}))
+
+	newChain := func(id, action string) types.RuleEngine {
+		dsl := fmt.Sprintf(`{"ruleChain":{"id":"%s","configuration":{"maxProcessingTime":"200ms","watchdogAction":"%s"}},
+			"metadata":{"nodes":[{"id":"s1","type":"test/watchdogSleep","configuration":{"sleep":600}},{"id":"s2","type":"test/watchdogSleep"}],
+			"connections":[{"fromId":"s1","toId":"s2","type":"Success"}]}}`, id, action)
+		ruleEngine, err := New(id, []byte(dsl), WithConfig(config))
+		assert.Nil(t, err)
+		return ruleEngine
+	}
+	run := func(ruleEngine types.RuleEngine) (time.Duration, []error, int32) {
+		var lock sync.Mutex
+		var errs []error
+		atomic.StoreInt32(node.calls, 0)
+		start := time.Now()
+		ruleEngine.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"), types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			lock.Lock()
+			defer lock.Unlock()
+			errs = append(errs, err)
+		}))
+		lock.Lock()
+		defer lock.Unlock()
+		return time.Since(start), errs, atomic.LoadInt32(node.calls)
+	}
+	nextEvent := func() types.Event {
+		select {
+		case event := <-events.C():
+			return event
+		case <-time.After(time.Second):
+			t.Fatal("msg.stuck event not published")
+			return types.Event{}
+		}
+	}
+
+	t.Run("Log", func(t *testing.T) {
+		ruleEngine := newChain("testWatchdogLog", types.WatchdogActionLog)
+		defer Del(ruleEngine.Id())
+		elapsed, errs, calls := run(ruleEngine)
+		assert.True(t, elapsed >= 600*time.Millisecond)
+		assert.Equal(t, []error{nil}, errs)
+		assert.Equal(t, int32(2), calls)
+		event := nextEvent()
+		assert.Equal(t, "testWatchdogLog", event.Subject)
+		assert.Equal(t, "s1", event.Data["nodeId"])
+		assert.Equal(t, types.WatchdogActionLog, event.Data["action"])
+		assert.True(t, event.Data["elapsed"].(int64) >= 200)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&deadLetters))
+	})
+
+	t.Run("Fail", func(t *testing.T) {
+		ruleEngine := newChain("testWatchdogFail", types.WatchdogActionFail)
+		defer Del(ruleEngine.Id())
+		elapsed, errs, _ := run(ruleEngine)
+		assert.True(t, elapsed < 600*time.Millisecond)
+		assert.Equal(t, 1, len(errs))
+		assert.True(t, errors.Is(errs[0], types.ErrProcessingTimeout))
+		var timeoutErr *types.ProcessingTimeoutError
+		assert.True(t, errors.As(errs[0], &timeoutErr))
+		assert.Equal(t, "s1", timeoutErr.NodeId)
+		assert.Equal(t, 200*time.Millisecond, timeoutErr.MaxProcessingTime)
+		assert.Equal(t, types.WatchdogActionFail, nextEvent().Data["action"])
+		assert.Equal(t, int32(1), atomic.LoadInt32(&deadLetters))
+		assert.True(t, errors.Is(deadLetterErr.Load().(error), types.ErrProcessingTimeout))
+		//卡住的节点结束后，不再执行后续节点，也不再触发结束回调
+		time.Sleep(600 * time.Millisecond)
+		assert.Equal(t, int32(1), atomic.LoadInt32(node.calls))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&deadLetters))
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		ruleEngine := newChain("testWatchdogCancel", types.WatchdogActionCancel)
+		defer Del(ruleEngine.Id())
+		elapsed, errs, calls := run(ruleEngine)
+		assert.True(t, elapsed < 600*time.Millisecond)
+		assert.Equal(t, []error{context.Canceled}, errs)
+		assert.Equal(t, int32(1), calls)
+		assert.Equal(t, types.WatchdogActionCancel, nextEvent().Data["action"])
+	})
+
+	t.Run("ExtendDeadline", func(t *testing.T) {
+		dsl := `{"ruleChain":{"id":"testWatchdogDelay","configuration":{"maxProcessingTime":"500ms","watchdogAction":"fail"}},
+			"metadata":{"nodes":[{"id":"s1","type":"delay","configuration":{"periodInSeconds":1,"maxPendingMsgs":10}}]}}`
+		ruleEngine, err := New("testWatchdogDelay", []byte(dsl), WithConfig(config))
+		assert.Nil(t, err)
+		defer Del(ruleEngine.Id())
+		deadLettersBefore := atomic.LoadInt32(&deadLetters)
+		elapsed, errs, _ := run(ruleEngine)
+		assert.True(t, elapsed >= time.Second)
+		assert.Equal(t, []error{nil}, errs)
+		assert.Equal(t, deadLettersBefore, atomic.LoadInt32(&deadLetters))
+	})
+}
@@ -67,6 +67,35 @@ func (c *node) Components(url string) endpointApi.Router {
 	}).End()
 }
 
+// ComponentSchema 创建获取单个endpoint或者节点组件配置表单路由，用于生成组件配置表单
+func (c *node) ComponentSchema(url string) endpointApi.Router {
+	return endpoint.NewRouter().From(url).Process(AuthProcess).Process(func(router endpointApi.Router, exchange *endpointApi.Exchange) bool {
+		msg := exchange.In.GetMsg()
+		username := msg.Metadata.GetValue(constants.KeyUsername)
+		componentType := msg.Metadata.GetValue(constants.KeyType)
+		if s, ok := service.UserRuleEngineServiceImpl.Get(username); ok {
+			form, ok := s.GetRuleConfig().ComponentsRegistry.GetComponentForms().GetComponent(componentType)
+			if !ok {
+				form, ok = endpoint.Registry.GetComponentForms().GetComponent(componentType)
+			}
+			if !ok {
+				exchange.Out.SetStatusCode(http.StatusNotFound)
+				exchange.Out.SetBody([]byte("component not found:" + componentType))
+				return true
+			}
+			if v, err := json.Marshal(form); err != nil {
+				exchange.Out.SetStatusCode(http.StatusInternalServerError)
+				exchange.Out.SetBody([]byte(err.Error()))
+			} else {
+				exchange.Out.SetBody(v)
+			}
+		} else {
+			return userNotFound(username, exchange)
+		}
+		return true
+	}).End()
+}
+
 // ListNodePool 获取所有共享组件
 func (c *node) ListNodePool(url string) endpointApi.Router {
 	return endpoint.NewRouter().From(url).Process(AuthProcess).Process(func(router endpointApi.Router, exchange *endpointApi.Exchange) bool {
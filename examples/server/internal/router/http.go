@@ -90,6 +90,8 @@ func NewRestServe(config config.Config) (endpointApi.HttpEndpoint, error) {
 	}).End())
 	//创建获取所有规则引擎组件列表路由
 	restEndpoint.GET(controller.Node.Components(apiBasePath + "/components"))
+	//获取组件配置表单，通过参数type指定组件类型，例如：/components/schema?type=endpoint/http
+	restEndpoint.GET(controller.Node.ComponentSchema(apiBasePath + "/components/schema"))
 
 	//获取所有共享组件
 	restEndpoint.GET(controller.Node.ListNodePool(apiBasePath + "/" + moduleSharedNodes))
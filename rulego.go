@@ -264,3 +264,8 @@ func NewConfig(opts ...types.Option) types.Config {
 func WithConfig(config types.Config) types.RuleEngineOption {
 	return engine.WithConfig(config)
 }
+
+// WithPartition is an option that assigns the RuleEngine to a tenant partition of the pool.
+func WithPartition(partition string) types.RuleEngineOption {
+	return engine.WithPartition(partition)
+}
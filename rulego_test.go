@@ -17,7 +17,12 @@
 package rulego
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"math"
+	"net"
+	"net/http"
 	"os"
 	"reflect"
 	"strings"
@@ -205,6 +210,67 @@ func TestHttpEndpointAspect(t *testing.T) {
 	Del(id)
 }
 
+func TestHttpEndpointAspectReload(t *testing.T) {
+	ruleDsl, err := os.ReadFile("testdata/rule/with_http_endpoint.json")
+	assert.Nil(t, err)
+	id := "withHttpEndpointReload"
+	ruleDsl = []byte(strings.NewReplacer("9090", "9151", `"withHttpEndpoint"`, `"`+id+`"`).Replace(string(ruleDsl)))
+
+	bus := engine.NewEventBus()
+	sub, err := bus.Subscribe(types.EventEndpointReloaded, 10)
+	assert.Nil(t, err)
+	ruleEngine, err := New(id, ruleDsl, types.WithConfig(engine.NewConfig(types.WithDefaultPool(), types.WithEventBus(bus))))
+	assert.Nil(t, err)
+	defer Del(id)
+	time.Sleep(time.Millisecond * 200)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:9151")
+	assert.Nil(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	post := func() *http.Response {
+		body := `{"temperature":41}`
+		_, err := fmt.Fprintf(conn, "POST /api/v1/test/%s HTTP/1.1\r\nHost: 127.0.0.1\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", id, len(body), body)
+		assert.Nil(t, err)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		resp, err := http.ReadResponse(reader, nil)
+		assert.Nil(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return resp
+	}
+	assert.Equal(t, http.StatusOK, post().StatusCode)
+
+	//只修改节点，保留监听和已有连接
+	err = ruleEngine.ReloadSelf([]byte(strings.Replace(string(ruleDsl), "msg.temperature>10", "msg.temperature>20", -1)))
+	assert.Nil(t, err)
+	select {
+	case event := <-sub.C():
+		assert.Equal(t, "e1", event.Subject)
+		assert.Equal(t, false, event.Data["restart"])
+	case <-time.After(time.Second):
+		t.Fatal("event timeout")
+	}
+	assert.Equal(t, http.StatusOK, post().StatusCode)
+
+	//修改监听地址，重启服务
+	err = ruleEngine.ReloadSelf([]byte(strings.Replace(string(ruleDsl), "9151", "9152", -1)))
+	assert.Nil(t, err)
+	select {
+	case event := <-sub.C():
+		assert.Equal(t, "e1", event.Subject)
+		assert.Equal(t, true, event.Data["restart"])
+	case <-time.After(time.Second):
+		t.Fatal("event timeout")
+	}
+	time.Sleep(time.Millisecond * 200)
+	_, err = net.DialTimeout("tcp", "127.0.0.1:9151", time.Second)
+	assert.NotNil(t, err)
+	conn2, err := net.DialTimeout("tcp", "127.0.0.1:9152", time.Second)
+	assert.Nil(t, err)
+	_ = conn2.Close()
+}
+
 func TestScheduleEndpointAspect(t *testing.T) {
 	var count = int64(0)
 
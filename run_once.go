@@ -0,0 +1,262 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rulego
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/engine"
+)
+
+// RunOnceEnd is one terminal output of a RunOnce execution,
+// produced when a branch of the rule chain has no further node to flow to.
+type RunOnceEnd struct {
+	// Msg is the message at the end of the branch.
+	Msg types.RuleMsg
+	// RelationType is the relation type of the last node output.
+	RelationType string
+	// Err is the error of the last node, if any.
+	Err error
+}
+
+// RunOnceResult is the result of a RunOnce execution.
+type RunOnceResult struct {
+	// Ends are the terminal outputs of all branches, in completion order.
+	Ends []RunOnceEnd
+	// Snapshot is the execution trace of every node.
+	Snapshot types.RuleChainRunSnapshot
+}
+
+// Msg returns the message of the last terminal output.
+func (r *RunOnceResult) Msg() types.RuleMsg {
+	if len(r.Ends) == 0 {
+		return types.RuleMsg{}
+	}
+	return r.Ends[len(r.Ends)-1].Msg
+}
+
+// RelationType returns the relation type of the last terminal output.
+func (r *RunOnceResult) RelationType() string {
+	if len(r.Ends) == 0 {
+		return ""
+	}
+	return r.Ends[len(r.Ends)-1].RelationType
+}
+
+// Err returns the first error among the terminal outputs.
+func (r *RunOnceResult) Err() error {
+	for _, end := range r.Ends {
+		if end.Err != nil {
+			return end.Err
+		}
+	}
+	return nil
+}
+
+// RunOnceOption is an option for RunOnce.
+type RunOnceOption func(*runOnceOptions)
+
+type runOnceOptions struct {
+	config          types.Config
+	hasConfig       bool
+	properties      map[string]string
+	registry        types.ComponentRegistry
+	mocks           map[string]types.Node
+	disabled        map[string]bool
+	endpointEnabled bool
+	engineOpts      []types.RuleEngineOption
+}
+
+// WithRunConfig sets the base Config of the throwaway rule engine. Defaults to NewConfig().
+func WithRunConfig(config types.Config) RunOnceOption {
+	return func(o *runOnceOptions) {
+		o.config = config
+		o.hasConfig = true
+	}
+}
+
+// WithRunProperties injects global properties, which can be referenced in the DSL by ${global.xx}.
+func WithRunProperties(properties map[string]string) RunOnceOption {
+	return func(o *runOnceOptions) {
+		for k, v := range properties {
+			o.properties[k] = v
+		}
+	}
+}
+
+// WithRunRegistry sets the component registry used to create nodes.
+func WithRunRegistry(registry types.ComponentRegistry) RunOnceOption {
+	return func(o *runOnceOptions) {
+		o.registry = registry
+	}
+}
+
+// WithRunMockComponents replaces the components of the same type with the given nodes.
+func WithRunMockComponents(nodes ...types.Node) RunOnceOption {
+	return func(o *runOnceOptions) {
+		for _, node := range nodes {
+			o.mocks[node.Type()] = node
+		}
+	}
+}
+
+// WithRunDisabledComponents replaces the components of the given types with passthrough nodes,
+// which neither initialize nor produce side effects and forward the message to the Success relation.
+func WithRunDisabledComponents(componentTypes ...string) RunOnceOption {
+	return func(o *runOnceOptions) {
+		for _, componentType := range componentTypes {
+			o.disabled[componentType] = true
+		}
+	}
+}
+
+// WithRunEndpointEnabled enables the endpoints declared in the DSL. Disabled by default.
+func WithRunEndpointEnabled(enabled bool) RunOnceOption {
+	return func(o *runOnceOptions) {
+		o.endpointEnabled = enabled
+	}
+}
+
+// WithRunEngineOptions appends rule engine options, such as aspects.
+func WithRunEngineOptions(opts ...types.RuleEngineOption) RunOnceOption {
+	return func(o *runOnceOptions) {
+		o.engineOpts = append(o.engineOpts, opts...)
+	}
+}
+
+// RunOnce builds a throwaway rule engine from the DSL, processes a single message, waits for the rule chain
+// to complete and returns the terminal outputs with the execution trace.
+// The rule engine is not registered in any pool, and it is always stopped before returning, including
+// the resources of shared nodes, so it is suitable for CLI tools, tests and dry runs.
+// The returned error only reports build failures and context cancellation, node errors are in the result.
+func RunOnce(ctx context.Context, dsl []byte, msg types.RuleMsg, opts ...RunOnceOption) (*RunOnceResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	o := &runOnceOptions{
+		properties: make(map[string]string),
+		mocks:      make(map[string]types.Node),
+		disabled:   make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	config := o.config
+	if !o.hasConfig {
+		config = NewConfig()
+	}
+	config.EndpointEnabled = o.endpointEnabled
+	// Copy the properties to avoid modifying the caller's config.
+	properties := types.NewProperties()
+	for k, v := range config.Properties {
+		properties[k] = v
+	}
+	for k, v := range o.properties {
+		properties[k] = v
+	}
+	config.Properties = properties
+	registry := o.registry
+	if registry == nil {
+		registry = config.ComponentsRegistry
+	}
+	if registry == nil {
+		registry = Registry
+	}
+	if len(o.mocks) > 0 || len(o.disabled) > 0 {
+		registry = &runOnceRegistry{ComponentRegistry: registry, mocks: o.mocks, disabled: o.disabled}
+	}
+	config.ComponentsRegistry = registry
+
+	engineOpts := append([]types.RuleEngineOption{engine.WithConfig(config)}, o.engineOpts...)
+	ruleEngine, err := engine.NewRuleEngine("", dsl, engineOpts...)
+	if ruleEngine != nil {
+		defer ruleEngine.Stop()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RunOnceResult{}
+	var lock sync.Mutex
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ruleEngine.OnMsgAndWait(msg, types.WithContext(ctx),
+			types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+				lock.Lock()
+				defer lock.Unlock()
+				result.Ends = append(result.Ends, RunOnceEnd{Msg: msg, RelationType: relationType, Err: err})
+			}),
+			types.WithOnRuleChainCompleted(func(ctx types.RuleContext, snapshot types.RuleChainRunSnapshot) {
+				lock.Lock()
+				defer lock.Unlock()
+				result.Snapshot = snapshot
+			}),
+		)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	return result, nil
+}
+
+// runOnceRegistry overlays mocked and disabled components on a component registry.
+type runOnceRegistry struct {
+	types.ComponentRegistry
+	mocks    map[string]types.Node
+	disabled map[string]bool
+}
+
+func (r *runOnceRegistry) NewNode(nodeType string) (types.Node, error) {
+	if node, ok := r.mocks[nodeType]; ok {
+		return node.New(), nil
+	}
+	if r.disabled[nodeType] {
+		return &passthroughNode{nodeType: nodeType}, nil
+	}
+	return r.ComponentRegistry.NewNode(nodeType)
+}
+
+// passthroughNode replaces a disabled component and forwards the message to the Success relation.
+type passthroughNode struct {
+	nodeType string
+}
+
+func (n *passthroughNode) Type() string {
+	return n.nodeType
+}
+
+func (n *passthroughNode) New() types.Node {
+	return &passthroughNode{nodeType: n.nodeType}
+}
+
+func (n *passthroughNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return nil
+}
+
+func (n *passthroughNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	ctx.TellSuccess(msg)
+}
+
+func (n *passthroughNode) Destroy() {
+}
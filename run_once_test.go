@@ -0,0 +1,186 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rulego
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+var runOnceChain = `
+{
+  "ruleChain": {
+    "id": "runOnce"
+  },
+  "metadata": {
+    "nodes": [
+      {
+        "id": "s1",
+        "type": "jsTransform",
+        "configuration": {
+          "jsScript": "metadata['name']='${global.name}';msg.temperature=msg.temperature+1;return {'msg':msg,'metadata':metadata,'msgType':msgType};"
+        }
+      },
+      {
+        "id": "s2",
+        "type": "restApiCall",
+        "configuration": {
+          "restEndpointUrlPattern": "http://127.0.0.1:1/api/msg",
+          "requestMethod": "POST"
+        }
+      }
+    ],
+    "connections": [
+      {
+        "fromId": "s1",
+        "toId": "s2",
+        "type": "Success"
+      }
+    ]
+  }
+}
+`
+
+var runOnceTrackedChain = `
+{
+  "ruleChain": {
+    "id": "runOnceTracked"
+  },
+  "metadata": {
+    "nodes": [
+      {
+        "id": "s1",
+        "type": "test/tracked",
+        "configuration": {}
+      },
+      {
+        "id": "s2",
+        "type": "test/tracked",
+        "configuration": {
+          "fail": true
+        }
+      }
+    ],
+    "connections": [
+      {
+        "fromId": "s1",
+        "toId": "s2",
+        "type": "Success"
+      }
+    ]
+  }
+}
+`
+
+// trackedNode 记录初始化和销毁次数
+type trackedNode struct {
+	inits    *int32
+	destroys *int32
+}
+
+func (n *trackedNode) Type() string {
+	return "test/tracked"
+}
+
+func (n *trackedNode) New() types.Node {
+	return &trackedNode{inits: n.inits, destroys: n.destroys}
+}
+
+func (n *trackedNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	if configuration["fail"] == true {
+		return errors.New("init fail")
+	}
+	atomic.AddInt32(n.inits, 1)
+	return nil
+}
+
+func (n *trackedNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	ctx.TellSuccess(msg)
+}
+
+func (n *trackedNode) Destroy() {
+	atomic.AddInt32(n.destroys, 1)
+}
+
+func TestRunOnce(t *testing.T) {
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), `{"temperature":35}`)
+
+	t.Run("DisabledComponents", func(t *testing.T) {
+		result, err := RunOnce(context.Background(), []byte(runOnceChain), msg,
+			WithRunProperties(map[string]string{"name": "cli"}),
+			WithRunDisabledComponents("restApiCall"),
+		)
+		assert.Nil(t, err)
+		assert.Nil(t, result.Err())
+		assert.Equal(t, 1, len(result.Ends))
+		assert.Equal(t, types.Success, result.RelationType())
+		out := result.Msg()
+		assert.Equal(t, `{"temperature":36}`, out.GetData())
+		assert.Equal(t, "cli", out.Metadata.GetValue("name"))
+		assert.Equal(t, 2, len(result.Snapshot.Logs))
+		//没有注册到规则引擎池
+		_, ok := Get("runOnce")
+		assert.False(t, ok)
+	})
+
+	t.Run("NodeError", func(t *testing.T) {
+		result, err := RunOnce(context.Background(), []byte(runOnceChain), msg)
+		assert.Nil(t, err)
+		assert.NotNil(t, result.Err())
+		assert.Equal(t, types.Failure, result.RelationType())
+	})
+
+	t.Run("InitFail", func(t *testing.T) {
+		var inits, destroys int32
+		_, err := RunOnce(context.Background(), []byte(runOnceTrackedChain), msg,
+			WithRunMockComponents(&trackedNode{inits: &inits, destroys: &destroys}),
+		)
+		assert.NotNil(t, err)
+		//已经初始化的节点被销毁
+		assert.Equal(t, int32(1), atomic.LoadInt32(&inits))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&destroys))
+	})
+
+	t.Run("Teardown", func(t *testing.T) {
+		var inits, destroys int32
+		result, err := RunOnce(context.Background(), []byte(`{"ruleChain":{"id":"runOnceTeardown"},"metadata":{"nodes":[{"id":"s1","type":"test/tracked"}]}}`), msg,
+			WithRunMockComponents(&trackedNode{inits: &inits, destroys: &destroys}),
+		)
+		assert.Nil(t, err)
+		assert.Equal(t, types.Success, result.RelationType())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&inits))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&destroys))
+	})
+
+	t.Run("ContextCanceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+		_, err := RunOnce(ctx, []byte(`{"ruleChain":{"id":"runOnceDelay"},"metadata":{"nodes":[{"id":"s1","type":"delay","configuration":{"periodInSeconds":2}}]}}`), msg)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("InvalidDsl", func(t *testing.T) {
+		_, err := RunOnce(context.Background(), []byte(`{`), msg)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cert generates certificates for TLS tests.
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/test/assert"
+)
+
+// Cert is a test certificate and its private key.
+type Cert struct {
+	Cert    *x509.Certificate
+	Key     *ecdsa.PrivateKey
+	CertPem []byte
+	KeyPem  []byte
+}
+
+// New generates a certificate for localhost and 127.0.0.1, valid from one hour ago to one hour later.
+// The certificate is signed by parent, or is a self-signed CA certificate if parent is nil.
+func New(t *testing.T, commonName string, parent *Cert, extKeyUsage x509.ExtKeyUsage) *Cert {
+	now := time.Now()
+	return NewWithValidity(t, commonName, parent, extKeyUsage, now.Add(-time.Hour), now.Add(time.Hour))
+}
+
+// NewWithValidity generates a certificate like New with the given validity period.
+func NewWithValidity(t *testing.T, commonName string, parent *Cert, extKeyUsage x509.ExtKeyUsage, notBefore, notAfter time.Time) *Cert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{extKeyUsage},
+	}
+	signerCert, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signerCert, signerKey = parent.Cert, parent.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	return &Cert{
+		Cert:    cert,
+		Key:     key,
+		CertPem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPem:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
@@ -298,6 +298,8 @@ func (ctx *NodeTestRuleContext) GetEnv(msg types.RuleMsg, useMetadata bool) map[
 	// 设置基础环境变量
 	envVars["id"] = msg.GetId()
 	envVars["ts"] = msg.GetTs()
+	envVars[types.EventTsKey] = msg.GetEventTs()
+	envVars[types.IngestTsKey] = msg.GetIngestTs()
 	envVars["data"] = msg.GetData()
 	envVars["msgType"] = msg.GetType()
 	envVars["type"] = msg.GetType()
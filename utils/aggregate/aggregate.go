@@ -0,0 +1,332 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package aggregate provides numeric aggregation over message fields,
+// shared by the components that aggregate the results of several messages, such as groupAction and groupFilter.
+//
+// Key features:
+// - ToNumber: Extracts a finite number from JSON values, Go numbers and numeric strings
+// - Aggregator: Computes min, max, avg, sum, count, first and last, counting non-numeric values separately
+// - Aggregation: The component configuration that aggregates a data path of messages into metadata
+//
+// Integers are summed exactly until the sum overflows int64, then the sum falls back to float64.
+// NaN and Inf are not numbers and are counted as invalid.
+package aggregate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// Aggregate functions
+const (
+	Min   = "min"
+	Max   = "max"
+	Avg   = "avg"
+	Sum   = "sum"
+	Count = "count"
+	First = "first"
+	Last  = "last"
+)
+
+// InvalidSuffix is the metadata key suffix of the number of non-numeric or missing values.
+const InvalidSuffix = "invalid"
+
+// maxExactFloat is the largest integer that float64 represents exactly.
+const maxExactFloat = 1 << 53
+
+// Number is a finite number, either an exact integer or a float.
+type Number struct {
+	Int   int64
+	Float float64
+	IsInt bool
+}
+
+// IntNumber returns an integer Number.
+func IntNumber(v int64) Number {
+	return Number{Int: v, Float: float64(v), IsInt: true}
+}
+
+// FloatNumber returns a float Number, integral floats in the exact range of float64 are integers.
+func FloatNumber(v float64) Number {
+	if v == math.Trunc(v) && math.Abs(v) <= maxExactFloat {
+		return IntNumber(int64(v))
+	}
+	return Number{Float: v}
+}
+
+// String formats the number, integers without a decimal point.
+func (n Number) String() string {
+	if n.IsInt {
+		return strconv.FormatInt(n.Int, 10)
+	}
+	return strconv.FormatFloat(n.Float, 'f', -1, 64)
+}
+
+// ToNumber extracts a finite number from v.
+// It supports Go integers and floats, json.Number and numeric strings.
+// It returns false for nil, bool, NaN, Inf and any other value.
+func ToNumber(v interface{}) (Number, bool) {
+	switch n := v.(type) {
+	case int:
+		return IntNumber(int64(n)), true
+	case int8:
+		return IntNumber(int64(n)), true
+	case int16:
+		return IntNumber(int64(n)), true
+	case int32:
+		return IntNumber(int64(n)), true
+	case int64:
+		return IntNumber(n), true
+	case uint:
+		return uintNumber(uint64(n)), true
+	case uint8:
+		return IntNumber(int64(n)), true
+	case uint16:
+		return IntNumber(int64(n)), true
+	case uint32:
+		return IntNumber(int64(n)), true
+	case uint64:
+		return uintNumber(n), true
+	case float32:
+		return floatNumber(float64(n))
+	case float64:
+		return floatNumber(n)
+	case json.Number:
+		return parseNumber(string(n))
+	case string:
+		return parseNumber(strings.TrimSpace(n))
+	default:
+		return Number{}, false
+	}
+}
+
+func uintNumber(v uint64) Number {
+	if v > math.MaxInt64 {
+		return Number{Float: float64(v)}
+	}
+	return IntNumber(int64(v))
+}
+
+func floatNumber(v float64) (Number, bool) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return Number{}, false
+	}
+	return FloatNumber(v), true
+}
+
+func parseNumber(s string) (Number, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return IntNumber(i), true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Number{}, false
+	}
+	return floatNumber(f)
+}
+
+// Aggregator aggregates numbers, the zero value is ready to use. It is not safe for concurrent use.
+type Aggregator struct {
+	count   int
+	invalid int
+	first   Number
+	last    Number
+	min     Number
+	max     Number
+	//整数精确求和，溢出后使用floatSum
+	intSum   int64
+	floatSum float64
+	inexact  bool
+}
+
+// Add adds a value, non-numeric values are counted as invalid. It returns whether the value is a number.
+func (a *Aggregator) Add(v interface{}) bool {
+	n, ok := ToNumber(v)
+	if !ok {
+		a.invalid++
+		return false
+	}
+	a.AddNumber(n)
+	return true
+}
+
+// AddNumber adds a number.
+func (a *Aggregator) AddNumber(n Number) {
+	if a.count == 0 {
+		a.first, a.min, a.max = n, n, n
+	} else {
+		if n.Float < a.min.Float {
+			a.min = n
+		}
+		if n.Float > a.max.Float {
+			a.max = n
+		}
+	}
+	a.last = n
+	a.count++
+	a.floatSum += n.Float
+	if !a.inexact {
+		if sum, ok := addInt(a.intSum, n); ok {
+			a.intSum = sum
+		} else {
+			a.inexact = true
+		}
+	}
+}
+
+// addInt adds an integer number to sum, it returns false if n is not an integer or the sum overflows.
+func addInt(sum int64, n Number) (int64, bool) {
+	if !n.IsInt {
+		return 0, false
+	}
+	result := sum + n.Int
+	if (n.Int > 0 && result < sum) || (n.Int < 0 && result > sum) {
+		return 0, false
+	}
+	return result, true
+}
+
+// Count returns the number of numeric values.
+func (a *Aggregator) Count() int {
+	return a.count
+}
+
+// Invalid returns the number of non-numeric values.
+func (a *Aggregator) Invalid() int {
+	return a.invalid
+}
+
+// Result returns the result of the aggregate function.
+// It returns false if there is no numeric value, except for count, or the function is unknown.
+func (a *Aggregator) Result(fn string) (Number, bool) {
+	if fn == Count {
+		return IntNumber(int64(a.count)), true
+	}
+	if a.count == 0 {
+		return Number{}, false
+	}
+	switch fn {
+	case Min:
+		return a.min, true
+	case Max:
+		return a.max, true
+	case First:
+		return a.first, true
+	case Last:
+		return a.last, true
+	case Sum:
+		if a.inexact {
+			return Number{Float: a.floatSum}, true
+		}
+		return IntNumber(a.intSum), true
+	case Avg:
+		if a.inexact {
+			return Number{Float: a.floatSum / float64(a.count)}, true
+		}
+		return Number{Float: float64(a.intSum) / float64(a.count)}, true
+	default:
+		return Number{}, false
+	}
+}
+
+// IsFunc returns whether fn is an aggregate function.
+func IsFunc(fn string) bool {
+	switch fn {
+	case Min, Max, Avg, Sum, Count, First, Last:
+		return true
+	default:
+		return false
+	}
+}
+
+// Aggregation 聚合配置，聚合多条消息数据中 Path 字段的数值，结果写入元数据
+type Aggregation struct {
+	//Path 消息数据中的数值字段路径，例如：score、result.score，详见 json.Path
+	Path string
+	//Funcs 聚合函数列表，支持：min、max、avg、sum、count、first、last，多个与`,`隔开
+	Funcs []string
+	//As 元数据key前缀，结果写入元数据 ${As}_${func}，非数值或者缺失的数量写入 ${As}_invalid，默认使用 Path
+	As string
+}
+
+// Init 校验并规范化配置
+func (a *Aggregation) Init() error {
+	a.Path = strings.TrimSpace(a.Path)
+	if a.Path == "" {
+		return fmt.Errorf("aggregation path is empty")
+	}
+	var funcs []string
+	for _, item := range a.Funcs {
+		for _, fn := range strings.Split(item, ",") {
+			fn = strings.ToLower(strings.TrimSpace(fn))
+			if fn == "" {
+				continue
+			}
+			if !IsFunc(fn) {
+				return fmt.Errorf("aggregation %s unknown func:%s", a.Path, fn)
+			}
+			funcs = append(funcs, fn)
+		}
+	}
+	if len(funcs) == 0 {
+		return fmt.Errorf("aggregation %s funcs is empty", a.Path)
+	}
+	a.Funcs = funcs
+	a.As = strings.TrimSpace(a.As)
+	if a.As == "" {
+		a.As = a.Path
+	}
+	return nil
+}
+
+// Apply 聚合消息列表数据中的 Path 字段，结果写入metadata，没有数值的聚合函数(count除外)不写入
+// 消息数据不是JSON、字段缺失或者不是数值，计入 ${As}_invalid
+func (a *Aggregation) Apply(msgs []types.RuleMsg, metadata *types.Metadata) {
+	var aggregator Aggregator
+	for i := range msgs {
+		v, _ := msgs[i].GetDataPath(a.Path)
+		aggregator.Add(v)
+	}
+	for _, fn := range a.Funcs {
+		if n, ok := aggregator.Result(fn); ok {
+			metadata.PutValue(a.As+"_"+fn, n.String())
+		}
+	}
+	metadata.PutValue(a.As+"_"+InvalidSuffix, strconv.Itoa(aggregator.Invalid()))
+}
+
+// InitAll 校验并规范化配置列表
+func InitAll(aggregations []Aggregation) error {
+	for i := range aggregations {
+		if err := aggregations[i].Init(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyAll 依次执行配置列表的聚合
+func ApplyAll(aggregations []Aggregation, msgs []types.RuleMsg, metadata *types.Metadata) {
+	for i := range aggregations {
+		aggregations[i].Apply(msgs, metadata)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregate
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestToNumber(t *testing.T) {
+	tests := []struct {
+		input  interface{}
+		expect string
+		ok     bool
+	}{
+		{1, "1", true},
+		{int8(-2), "-2", true},
+		{uint32(3), "3", true},
+		{uint64(math.MaxUint64), "18446744073709552000", true},
+		{1.5, "1.5", true},
+		{float32(0.5), "0.5", true},
+		{2.0, "2", true},
+		{1e20, "100000000000000000000", true},
+		{json.Number("42"), "42", true},
+		{json.Number("4.2"), "4.2", true},
+		{" 7 ", "7", true},
+		{"-0.25", "-0.25", true},
+		{math.NaN(), "", false},
+		{math.Inf(1), "", false},
+		{"NaN", "", false},
+		{"-Inf", "", false},
+		{"abc", "", false},
+		{true, "", false},
+		{nil, "", false},
+		{map[string]interface{}{}, "", false},
+	}
+	for _, tt := range tests {
+		n, ok := ToNumber(tt.input)
+		assert.Equal(t, tt.ok, ok)
+		if ok {
+			assert.Equal(t, tt.expect, n.String())
+		}
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	t.Run("Funcs", func(t *testing.T) {
+		var a Aggregator
+		for _, v := range []interface{}{3, "x", 1.5, nil, 5, math.NaN()} {
+			a.Add(v)
+		}
+		assert.Equal(t, 3, a.Count())
+		assert.Equal(t, 3, a.Invalid())
+		expects := map[string]string{
+			Min: "1.5", Max: "5", Sum: "9.5", Avg: "3.1666666666666665", Count: "3", First: "3", Last: "5",
+		}
+		for fn, expect := range expects {
+			n, ok := a.Result(fn)
+			assert.True(t, ok)
+			assert.Equal(t, expect, n.String())
+		}
+		_, ok := a.Result("median")
+		assert.False(t, ok)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		var a Aggregator
+		a.Add("x")
+		n, ok := a.Result(Count)
+		assert.True(t, ok)
+		assert.Equal(t, "0", n.String())
+		_, ok = a.Result(Avg)
+		assert.False(t, ok)
+	})
+
+	t.Run("IntOverflow", func(t *testing.T) {
+		var a Aggregator
+		a.Add(int64(math.MaxInt64 - 1))
+		a.Add(1)
+		n, _ := a.Result(Sum)
+		assert.True(t, n.IsInt)
+		assert.Equal(t, "9223372036854775807", n.String())
+		//溢出后使用float64求和
+		a.Add(1)
+		n, _ = a.Result(Sum)
+		assert.False(t, n.IsInt)
+		assert.Equal(t, float64(math.MaxInt64)+1, n.Float)
+
+		var b Aggregator
+		b.Add(int64(math.MinInt64))
+		b.Add(-1)
+		n, _ = b.Result(Sum)
+		assert.False(t, n.IsInt)
+		n, _ = b.Result(Min)
+		assert.Equal(t, "-9223372036854775808", n.String())
+	})
+}
+
+func TestAggregation(t *testing.T) {
+	assert.NotNil(t, (&Aggregation{Funcs: []string{Min}}).Init())
+	assert.NotNil(t, (&Aggregation{Path: "score"}).Init())
+	assert.NotNil(t, (&Aggregation{Path: "score", Funcs: []string{"median"}}).Init())
+
+	aggregation := Aggregation{Path: "result.score", Funcs: []string{"MIN, max", "avg"}, As: "score"}
+	assert.Nil(t, aggregation.Init())
+	assert.Equal(t, []string{Min, Max, Avg}, aggregation.Funcs)
+
+	var msgs []types.RuleMsg
+	for _, data := range []string{`{"result":{"score":80}}`, `{"result":{"score":"90"}}`, `{"result":{}}`, `not json`} {
+		msgs = append(msgs, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), data))
+	}
+	metadata := types.NewMetadata()
+	aggregation.Apply(msgs, metadata)
+	assert.Equal(t, map[string]string{
+		"score_min":     "80",
+		"score_max":     "90",
+		"score_avg":     "85",
+		"score_invalid": "2",
+	}, metadata.Values())
+
+	metadata = types.NewMetadata()
+	aggregation.Apply(nil, metadata)
+	assert.Equal(t, map[string]string{"score_invalid": "0"}, metadata.Values())
+}
@@ -29,7 +29,7 @@ func ParseVars(varPrefix string, def types.RuleChain, includeNodeId ...string) [
 	var mergeVars = make(map[string]struct{})
 	includeNodeIdLen := len(includeNodeId)
 	for _, node := range def.Metadata.Nodes {
-		if includeNodeIdLen > 0 && !str.Contains(includeNodeId, node.Id) {
+		if node == nil || includeNodeIdLen > 0 && !str.Contains(includeNodeId, node.Id) {
 			continue
 		}
 		for fieldName, fieldValue := range node.Configuration {
@@ -58,7 +58,7 @@ func ParseVars(varPrefix string, def types.RuleChain, includeNodeId ...string) [
 // IsFlowNode 判断是否是子规则链
 func IsFlowNode(def types.RuleChain, nodeId string) bool {
 	for _, node := range def.Metadata.Nodes {
-		if node.Id == nodeId && node.Type == "flow" {
+		if node != nil && node.Id == nodeId && node.Type == "flow" {
 			return true
 		}
 	}
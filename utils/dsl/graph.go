@@ -0,0 +1,214 @@
+/*
+ * Copyright 2025 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// ToDot 把规则链导出为Graphviz DOT格式
+// 规则链文档渲染为图的tooltip，节点描述渲染为节点的tooltip，连线标签为关系类型
+// markdown文本逐行保留，只转义DOT字符串需要转义的字符
+func ToDot(def types.RuleChain) string {
+	var b strings.Builder
+	b.WriteString("digraph ")
+	b.WriteString(dotQuote(chainTitle(def)))
+	b.WriteString(" {\n")
+	if def.RuleChain.Documentation != "" {
+		b.WriteString("  tooltip=")
+		b.WriteString(dotQuote(def.RuleChain.Documentation))
+		b.WriteString(";\n")
+	}
+	b.WriteString("  node [shape=box];\n")
+	for _, node := range def.Metadata.Nodes {
+		if node == nil {
+			continue
+		}
+		b.WriteString("  ")
+		b.WriteString(dotQuote(node.Id))
+		b.WriteString(" [label=")
+		b.WriteString(dotQuote(nodeLabel(node)))
+		if description := node.Description(); description != "" {
+			b.WriteString(", tooltip=")
+			b.WriteString(dotQuote(description))
+		}
+		b.WriteString("];\n")
+	}
+	for _, conn := range def.Metadata.Connections {
+		b.WriteString("  ")
+		b.WriteString(dotQuote(conn.FromId))
+		b.WriteString(" -> ")
+		b.WriteString(dotQuote(conn.ToId))
+		b.WriteString(" [label=")
+		b.WriteString(dotQuote(connectionLabel(conn)))
+		b.WriteString("];\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ToMermaid 把规则链导出为Mermaid flowchart格式
+// 规则链文档逐行渲染为 %% 注释，节点描述渲染为节点标签的第二部分
+func ToMermaid(def types.RuleChain) string {
+	return toMermaid(def, nil, nil)
+}
+
+// ToCoverageMermaid 把规则链导出为标注了覆盖率的Mermaid flowchart格式
+// nodeHits 为节点访问次数，connectionHits 为连线命中次数，与 def.Metadata.Connections 按下标对应
+// 未访问的节点标红，从未命中的Failure连线标红，其他未命中的连线显示为虚线
+func ToCoverageMermaid(def types.RuleChain, nodeHits map[string]int, connectionHits []int) string {
+	if nodeHits == nil {
+		nodeHits = make(map[string]int)
+	}
+	if connectionHits == nil {
+		connectionHits = make([]int, len(def.Metadata.Connections))
+	}
+	return toMermaid(def, nodeHits, connectionHits)
+}
+
+func toMermaid(def types.RuleChain, nodeHits map[string]int, connectionHits []int) string {
+	coverage := nodeHits != nil
+	var b strings.Builder
+	if def.RuleChain.Documentation != "" {
+		for _, line := range strings.Split(def.RuleChain.Documentation, "\n") {
+			b.WriteString("%%")
+			if line = strings.TrimRight(line, "\r"); line != "" {
+				b.WriteString(" ")
+				b.WriteString(line)
+			}
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("flowchart LR\n")
+	if coverage {
+		b.WriteString("  classDef uncovered fill:#fdd,stroke:#c00\n")
+	}
+	ids := make(map[string]string)
+	for i, node := range def.Metadata.Nodes {
+		if node == nil {
+			continue
+		}
+		//节点ID可能包含Mermaid不支持的字符，使用序号作为ID
+		id := fmt.Sprintf("n%d", i)
+		ids[node.Id] = id
+		label := nodeLabel(node)
+		if description := node.Description(); description != "" {
+			label += "\n" + description
+		}
+		if coverage {
+			label += fmt.Sprintf("\nhits: %d", nodeHits[node.Id])
+		}
+		b.WriteString("  ")
+		b.WriteString(id)
+		b.WriteString("[\"")
+		b.WriteString(mermaidEscape(label))
+		b.WriteString("\"]")
+		if coverage && nodeHits[node.Id] == 0 {
+			b.WriteString(":::uncovered")
+		}
+		b.WriteString("\n")
+	}
+	var linkStyles []string
+	linkIndex := 0
+	for i, conn := range def.Metadata.Connections {
+		fromId, ok := ids[conn.FromId]
+		if !ok {
+			continue
+		}
+		toId, ok := ids[conn.ToId]
+		if !ok {
+			continue
+		}
+		label := connectionLabel(conn)
+		if coverage {
+			hits := 0
+			if i < len(connectionHits) {
+				hits = connectionHits[i]
+			}
+			label += fmt.Sprintf(" (%d)", hits)
+			if hits == 0 && conn.Type == types.Failure {
+				linkStyles = append(linkStyles, fmt.Sprintf("  linkStyle %d stroke:#c00,stroke-width:2px\n", linkIndex))
+			} else if hits == 0 {
+				linkStyles = append(linkStyles, fmt.Sprintf("  linkStyle %d stroke-dasharray:4\n", linkIndex))
+			}
+		}
+		b.WriteString("  ")
+		b.WriteString(fromId)
+		b.WriteString(" -->|\"")
+		b.WriteString(mermaidEscape(label))
+		b.WriteString("\"| ")
+		b.WriteString(toId)
+		b.WriteString("\n")
+		linkIndex++
+	}
+	for _, style := range linkStyles {
+		b.WriteString(style)
+	}
+	return b.String()
+}
+
+func chainTitle(def types.RuleChain) string {
+	if def.RuleChain.Name != "" {
+		return def.RuleChain.Name
+	}
+	return def.RuleChain.ID
+}
+
+func nodeLabel(node *types.RuleNode) string {
+	if node.Name != "" {
+		return node.Name + " (" + node.Type + ")"
+	}
+	return node.Id + " (" + node.Type + ")"
+}
+
+func connectionLabel(conn types.NodeConnection) string {
+	if conn.Label != "" {
+		return conn.Label
+	}
+	return conn.Type
+}
+
+// dotQuote DOT双引号字符串，换行转义为\n，保留原始行
+func dotQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// mermaidEscape Mermaid双引号标签，使用实体转义引号，换行转换为<br/>
+func mermaidEscape(s string) string {
+	s = strings.ReplaceAll(s, "\r", "")
+	s = strings.ReplaceAll(s, "\"", "#quot;")
+	return strings.ReplaceAll(s, "\n", "<br/>")
+}
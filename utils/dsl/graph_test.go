@@ -0,0 +1,100 @@
+/*
+ * Copyright 2025 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsl
+
+import (
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/json"
+)
+
+const documentedChain = `{
+  "ruleChain": {
+    "id": "docChain",
+    "name": "Alarm \"pipeline\"",
+    "documentation": "# Alarm pipeline\n\nOwners: @iot-team\n\n* input: {\"temperature\": 42}\n* runbook: <https://example.com/runbook?a=1&b=2>"
+  },
+  "metadata": {
+    "nodes": [
+      {"id": "s1", "type": "jsFilter", "name": "filter", "additionalInfo": {"description": "Drops **noise**\nbelow 10"}, "configuration": {}},
+      {"id": "s2", "type": "log", "configuration": {}}
+    ],
+    "connections": [
+      {"fromId": "s1", "toId": "s2", "type": "True"}
+    ]
+  }
+}`
+
+func TestDocumentation(t *testing.T) {
+	var def types.RuleChain
+	err := json.Unmarshal([]byte(documentedChain), &def)
+	assert.Nil(t, err)
+	documentation := "# Alarm pipeline\n\nOwners: @iot-team\n\n* input: {\"temperature\": 42}\n* runbook: <https://example.com/runbook?a=1&b=2>"
+	assert.Equal(t, documentation, def.RuleChain.Documentation)
+	assert.Equal(t, "Drops **noise**\nbelow 10", def.Metadata.Nodes[0].Description())
+	assert.Equal(t, "", def.Metadata.Nodes[1].Description())
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		//编码后markdown不被转义或者改写
+		data, err := json.Marshal(def)
+		assert.Nil(t, err)
+		var decoded types.RuleChain
+		err = json.Unmarshal(data, &decoded)
+		assert.Nil(t, err)
+		assert.Equal(t, documentation, decoded.RuleChain.Documentation)
+		assert.Equal(t, "Drops **noise**\nbelow 10", decoded.Metadata.Nodes[0].Description())
+	})
+
+	t.Run("Dot", func(t *testing.T) {
+		expected := `digraph "Alarm \"pipeline\"" {
+  tooltip="# Alarm pipeline\n\nOwners: @iot-team\n\n* input: {\"temperature\": 42}\n* runbook: <https://example.com/runbook?a=1&b=2>";
+  node [shape=box];
+  "s1" [label="filter (jsFilter)", tooltip="Drops **noise**\nbelow 10"];
+  "s2" [label="s2 (log)"];
+  "s1" -> "s2" [label="True"];
+}
+`
+		assert.Equal(t, expected, ToDot(def))
+	})
+
+	t.Run("Mermaid", func(t *testing.T) {
+		expected := `%% # Alarm pipeline
+%%
+%% Owners: @iot-team
+%%
+%% * input: {"temperature": 42}
+%% * runbook: <https://example.com/runbook?a=1&b=2>
+flowchart LR
+  n0["filter (jsFilter)<br/>Drops **noise**<br/>below 10"]
+  n1["s2 (log)"]
+  n0 -->|"True"| n1
+`
+		assert.Equal(t, expected, ToMermaid(def))
+	})
+
+	t.Run("Lint", func(t *testing.T) {
+		assert.Equal(t, 0, len(Lint(def, 1)))
+		def.RuleChain.Documentation = " "
+		assert.Equal(t, 0, len(Lint(def, 0)))
+		assert.Equal(t, 0, len(Lint(def, 2)))
+		warnings := Lint(def, 1)
+		assert.Equal(t, 1, len(warnings))
+		assert.Equal(t, "missingDocumentation: rule chain docChain has 2 nodes but no documentation", warnings[0].String())
+	})
+}
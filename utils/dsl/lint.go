@@ -0,0 +1,53 @@
+/*
+ * Copyright 2025 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// LintCodeMissingDocumentation 规则链缺少文档
+const LintCodeMissingDocumentation = "missingDocumentation"
+
+// LintWarning 规则链检查警告，不影响规则链加载
+type LintWarning struct {
+	// Code 警告类型
+	Code string `json:"code"`
+	// Message 警告信息
+	Message string `json:"message"`
+}
+
+func (w LintWarning) String() string {
+	return w.Code + ": " + w.Message
+}
+
+// Lint 检查规则链定义
+// docRequiredNodeCount 节点数量超过该值的规则链必须有文档，0不检查
+func Lint(def types.RuleChain, docRequiredNodeCount int) []LintWarning {
+	var warnings []LintWarning
+	if docRequiredNodeCount > 0 && len(def.Metadata.Nodes) > docRequiredNodeCount &&
+		strings.TrimSpace(def.RuleChain.Documentation) == "" {
+		warnings = append(warnings, LintWarning{
+			Code:    LintCodeMissingDocumentation,
+			Message: fmt.Sprintf("rule chain %s has %d nodes but no documentation", def.RuleChain.ID, len(def.Metadata.Nodes)),
+		})
+	}
+	return warnings
+}
@@ -3,6 +3,7 @@ package el
 import (
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/vm"
+	"github.com/rulego/rulego/utils/maps"
 	"github.com/rulego/rulego/utils/str"
 	"regexp"
 	"strings"
@@ -38,11 +39,37 @@ func NewTemplate(tmpl any, params ...any) (Template, error) {
 type ExprTemplate struct {
 	Tmpl    string
 	Program *vm.Program
+	//如果模板是字段路径，例如 metadata.respHeader.Location，expr计算结果为空时，按照路径获取带"."的key
+	path string
 }
 
 // 定义正则表达式，用于匹配形如 ${...} 的占位符
 var re = regexp.MustCompile(`\$\{([^}]*)\}`)
 
+// 匹配字段路径，例如 metadata.respHeader.Location
+var pathRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*(\.[A-Za-z0-9_-]+)+$`)
+
+// fieldPath 如果表达式是多级字段路径，则返回路径，否则返回空
+func fieldPath(expression string) string {
+	expression = strings.TrimSpace(expression)
+	if pathRe.MatchString(expression) {
+		return expression
+	}
+	return ""
+}
+
+// runProgram 执行表达式，如果结果为空且表达式是字段路径，则支持读取带"."的key，例如metadata中的命名空间key
+func runProgram(program *vm.Program, path string, data map[string]any) (interface{}, error) {
+	var v vm.VM
+	out, err := v.Run(program, data)
+	if out == nil && path != "" {
+		if val := maps.Get(data, path); val != nil {
+			return val, nil
+		}
+	}
+	return out, err
+}
+
 func NewExprTemplate(tmpl string) (*ExprTemplate, error) {
 	// 使用字符串构建器来处理模板字符串
 	var sb strings.Builder
@@ -83,7 +110,7 @@ func NewExprTemplate(tmpl string) (*ExprTemplate, error) {
 	tmpl = sb.String()
 
 	// 创建 ExprTemplate 实例
-	t := &ExprTemplate{Tmpl: tmpl}
+	t := &ExprTemplate{Tmpl: tmpl, path: fieldPath(tmpl)}
 
 	// 调用 Parse 方法解析模板
 	if err := t.Parse(); err != nil {
@@ -103,8 +130,7 @@ func (t *ExprTemplate) Parse() error {
 
 func (t *ExprTemplate) Execute(data map[string]any) (interface{}, error) {
 	if t.Program != nil {
-		var vm vm.VM
-		return vm.Run(t.Program, data)
+		return runProgram(t.Program, t.path, data)
 	}
 	return nil, nil
 }
@@ -173,6 +199,7 @@ type MixedTemplate struct {
 		start int
 		end   int
 		expr  *vm.Program
+		path  string
 	}
 	hasVars bool // 是否包含变量
 }
@@ -215,10 +242,12 @@ func (t *MixedTemplate) Parse() error {
 			start int
 			end   int
 			expr  *vm.Program
+			path  string
 		}{
 			start: strings.Index(t.Tmpl, "${"+varName+"}"),
 			end:   strings.Index(t.Tmpl, "${"+varName+"}") + len("${"+varName+"}"),
 			expr:  program,
+			path:  fieldPath(varName),
 		})
 	}
 	return nil
@@ -236,10 +265,9 @@ func (t *MixedTemplate) Execute(data map[string]any) (interface{}, error) {
 
 	var sb strings.Builder
 	lastPos := 0
-	vm := vm.VM{}
 	for _, v := range t.variables {
 		sb.WriteString(t.Tmpl[lastPos:v.start])
-		val, err := vm.Run(v.expr, data)
+		val, err := runProgram(v.expr, v.path, data)
 		if err != nil {
 			return nil, err
 		}
@@ -109,6 +109,15 @@ func TestMixedTemplate(t *testing.T) {
 		expected string
 		wantErr  bool
 	}{
+		{
+			name: "namespaced metadata key",
+			tmpl: "location: ${metadata.respHeader.Location}",
+			data: map[string]interface{}{
+				"metadata": map[string]string{"respHeader.Location": "/items/1"},
+			},
+			expected: "location: /items/1",
+			wantErr:  false,
+		},
 		{
 			name: "simple path template",
 			tmpl: "user/${user.id}/profile",
@@ -715,3 +724,17 @@ func BenchmarkMapExpression(b *testing.B) {
 		_, _ = vm.Run(mapProgram, data)
 	}
 }
+
+func TestExprTemplateNamespacedKey(t *testing.T) {
+	tmpl, err := NewTemplate("${metadata.respHeader.Location}")
+	if err != nil {
+		t.Fatalf("NewTemplate() error = %v", err)
+	}
+	data := map[string]any{"metadata": map[string]string{"respHeader.Location": "/items/1"}}
+	if got, err := tmpl.Execute(data); err != nil || got != "/items/1" {
+		t.Errorf("Execute() = %v, %v, want /items/1", got, err)
+	}
+	if _, err := tmpl.Execute(map[string]any{"metadata": map[string]string{}}); err == nil {
+		t.Error("Execute() expected error for missing key")
+	}
+}
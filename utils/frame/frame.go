@@ -0,0 +1,290 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package frame provides message framing for stream protocols such as TCP.
+//
+// Supported framing types:
+//   - delimiter: each frame ends with a delimiter, such as "\n" (default)
+//   - length: each frame is prefixed with its length, a 1, 2 or 4 byte unsigned integer, big-endian by default
+//   - fixedLength: each frame has the same fixed length
+//   - none: no framing, data is written as is and a read returns the bytes received by one read call
+package frame
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// TypeDelimiter each frame ends with a delimiter
+	TypeDelimiter = "delimiter"
+	// TypeLength each frame is prefixed with its length
+	TypeLength = "length"
+	// TypeFixedLength each frame has the same fixed length
+	TypeFixedLength = "fixedLength"
+	// TypeNone no framing
+	TypeNone = "none"
+)
+
+const (
+	// DefaultDelimiter the default delimiter
+	DefaultDelimiter = "\n"
+	// DefaultLengthFieldSize the default size of the length prefix in bytes
+	DefaultLengthFieldSize = 4
+	// DefaultMaxFrameSize the default maximum size of a frame read
+	DefaultMaxFrameSize = 1024 * 1024
+	// readChunkSize the number of bytes read from the stream at a time
+	readChunkSize = 4096
+)
+
+// ErrFrameTooLarge is returned when a frame exceeds the maximum size
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// Config framing configuration
+type Config struct {
+	// Type framing type: delimiter, length, fixedLength or none. Default delimiter
+	Type string
+	// Delimiter the frame delimiter, used when Type is delimiter. Default "\n"
+	// Escape sequences such as \n, \r\n, \x03 and hex such as 0x03 are supported
+	Delimiter string
+	// LengthFieldSize the size of the length prefix in bytes: 1, 2 or 4, used when Type is length. Default 4
+	// The length does not include the length prefix itself
+	LengthFieldSize int
+	// LittleEndian the length prefix is little-endian, used when Type is length. Default big-endian
+	LittleEndian bool
+	// FixedLength the length of each frame, used when Type is fixedLength
+	FixedLength int
+	// MaxFrameSize the maximum size of a frame read, <=0 means DefaultMaxFrameSize
+	MaxFrameSize int
+}
+
+// Codec encodes and decodes frames
+type Codec struct {
+	config    Config
+	delimiter []byte
+	order     binary.ByteOrder
+}
+
+// NewCodec creates a codec, the default values of config are applied
+func NewCodec(config Config) (*Codec, error) {
+	if config.Type == "" {
+		config.Type = TypeDelimiter
+	}
+	if config.MaxFrameSize <= 0 {
+		config.MaxFrameSize = DefaultMaxFrameSize
+	}
+	c := &Codec{config: config, order: binary.BigEndian}
+	switch config.Type {
+	case TypeDelimiter:
+		if config.Delimiter == "" {
+			config.Delimiter = DefaultDelimiter
+		}
+		delimiter, err := ParseDelimiter(config.Delimiter)
+		if err != nil {
+			return nil, err
+		}
+		if len(delimiter) == 0 {
+			return nil, errors.New("delimiter is empty")
+		}
+		c.delimiter = delimiter
+	case TypeLength:
+		if config.LengthFieldSize <= 0 {
+			config.LengthFieldSize = DefaultLengthFieldSize
+		}
+		if config.LengthFieldSize != 1 && config.LengthFieldSize != 2 && config.LengthFieldSize != 4 {
+			return nil, fmt.Errorf("unsupported length field size: %d", config.LengthFieldSize)
+		}
+		if config.LittleEndian {
+			c.order = binary.LittleEndian
+		}
+	case TypeFixedLength:
+		if config.FixedLength <= 0 {
+			return nil, errors.New("fixed length must be greater than 0")
+		}
+		if config.FixedLength > config.MaxFrameSize {
+			return nil, fmt.Errorf("%w: fixed length %d > %d", ErrFrameTooLarge, config.FixedLength, config.MaxFrameSize)
+		}
+	case TypeNone:
+	default:
+		return nil, fmt.Errorf("unsupported frame type: %s", config.Type)
+	}
+	c.config = config
+	return c, nil
+}
+
+// Config returns the configuration with default values applied
+func (c *Codec) Config() Config {
+	return c.config
+}
+
+// Encode frames the data
+func (c *Codec) Encode(data []byte) ([]byte, error) {
+	switch c.config.Type {
+	case TypeDelimiter:
+		out := make([]byte, 0, len(data)+len(c.delimiter))
+		out = append(out, data...)
+		return append(out, c.delimiter...), nil
+	case TypeLength:
+		size := c.config.LengthFieldSize
+		if uint64(len(data)) > uint64(1)<<(8*uint(size))-1 {
+			return nil, fmt.Errorf("%w: %d bytes exceeds the %d byte length field", ErrFrameTooLarge, len(data), size)
+		}
+		out := make([]byte, size, size+len(data))
+		switch size {
+		case 1:
+			out[0] = byte(len(data))
+		case 2:
+			c.order.PutUint16(out, uint16(len(data)))
+		default:
+			c.order.PutUint32(out, uint32(len(data)))
+		}
+		return append(out, data...), nil
+	case TypeFixedLength:
+		if len(data) != c.config.FixedLength {
+			return nil, fmt.Errorf("data length %d does not match the fixed length %d", len(data), c.config.FixedLength)
+		}
+		return data, nil
+	default:
+		return data, nil
+	}
+}
+
+// split splits the first frame from buf, returns the frame and the number of bytes consumed.
+// advance is 0 if buf does not contain a complete frame.
+func (c *Codec) split(buf []byte) (frame []byte, advance int, err error) {
+	maxFrameSize := c.config.MaxFrameSize
+	switch c.config.Type {
+	case TypeDelimiter:
+		if i := bytes.Index(buf, c.delimiter); i >= 0 {
+			if i > maxFrameSize {
+				return nil, 0, fmt.Errorf("%w: %d > %d", ErrFrameTooLarge, i, maxFrameSize)
+			}
+			return buf[:i], i + len(c.delimiter), nil
+		}
+		if len(buf) > maxFrameSize+len(c.delimiter) {
+			return nil, 0, fmt.Errorf("%w: %d > %d", ErrFrameTooLarge, len(buf), maxFrameSize)
+		}
+		return nil, 0, nil
+	case TypeLength:
+		size := c.config.LengthFieldSize
+		if len(buf) < size {
+			return nil, 0, nil
+		}
+		var length uint64
+		switch size {
+		case 1:
+			length = uint64(buf[0])
+		case 2:
+			length = uint64(c.order.Uint16(buf))
+		default:
+			length = uint64(c.order.Uint32(buf))
+		}
+		//check the length before the frame data is read, so that oversized frames are not buffered
+		if length > uint64(maxFrameSize) {
+			return nil, 0, fmt.Errorf("%w: %d > %d", ErrFrameTooLarge, length, maxFrameSize)
+		}
+		end := size + int(length)
+		if len(buf) < end {
+			return nil, 0, nil
+		}
+		return buf[size:end], end, nil
+	case TypeFixedLength:
+		if len(buf) < c.config.FixedLength {
+			return nil, 0, nil
+		}
+		return buf[:c.config.FixedLength], c.config.FixedLength, nil
+	default:
+		if len(buf) == 0 {
+			return nil, 0, nil
+		}
+		return buf, len(buf), nil
+	}
+}
+
+// Reader reads frames from a stream. A frame split across several reads, such as TCP segments, is reassembled.
+// If a read fails, e.g. on a read timeout, the bytes of the incomplete frame are kept and the next ReadFrame continues it.
+type Reader struct {
+	codec  *Codec
+	reader io.Reader
+	//bytes not yet returned as a frame
+	buf   []byte
+	chunk []byte
+	//error returned by the read together with data, returned after the frames already read
+	err error
+}
+
+// NewReader creates a frame reader
+func (c *Codec) NewReader(r io.Reader) *Reader {
+	return &Reader{codec: c, reader: r}
+}
+
+// ReadFrame reads the next frame, the framing bytes are removed.
+// The returned frame is not modified by later reads.
+func (r *Reader) ReadFrame() ([]byte, error) {
+	for {
+		frame, advance, err := r.codec.split(r.buf)
+		if err != nil {
+			return nil, err
+		}
+		if advance > 0 {
+			frame = append([]byte(nil), frame...)
+			r.buf = r.buf[advance:]
+			return frame, nil
+		}
+		if r.err != nil {
+			err = r.err
+			r.err = nil
+			return nil, err
+		}
+		if r.chunk == nil {
+			size := readChunkSize
+			if r.codec.config.Type == TypeNone {
+				size = r.codec.config.MaxFrameSize
+			}
+			r.chunk = make([]byte, size)
+		}
+		n, err := r.reader.Read(r.chunk)
+		if n > 0 {
+			r.buf = append(r.buf, r.chunk[:n]...)
+		}
+		r.err = err
+	}
+}
+
+// ParseDelimiter parses the delimiter configuration.
+// Escape sequences such as \n, \r\n, \x03 and hex with 0x prefix such as 0x0d0a are supported.
+func ParseDelimiter(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errors.New("delimiter is empty")
+	}
+	if len(s) > 2 && (strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X")) {
+		return hex.DecodeString(s[2:])
+	}
+	if strings.Contains(s, "\\") {
+		unquoted, err := strconv.Unquote(`"` + strings.ReplaceAll(s, `"`, `\"`) + `"`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delimiter: %s", s)
+		}
+		return []byte(unquoted), nil
+	}
+	return []byte(s), nil
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package frame
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestParseDelimiter(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected []byte
+	}{
+		{"\n", []byte("\n")},
+		{`\n`, []byte("\n")},
+		{`\r\n`, []byte("\r\n")},
+		{`\x03`, []byte{3}},
+		{"0x0d0a", []byte("\r\n")},
+		{"END", []byte("END")},
+	}
+	for _, tt := range tests {
+		v, err := ParseDelimiter(tt.input)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, v)
+	}
+	_, err := ParseDelimiter("")
+	assert.NotNil(t, err)
+	_, err = ParseDelimiter("0xzz")
+	assert.NotNil(t, err)
+}
+
+func TestCodec(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		codec, err := NewCodec(Config{})
+		assert.Nil(t, err)
+		assert.Equal(t, TypeDelimiter, codec.Config().Type)
+		data, _ := codec.Encode([]byte("aa"))
+		assert.Equal(t, "aa\n", string(data))
+	})
+	t.Run("Delimiter", func(t *testing.T) {
+		codec, err := NewCodec(Config{Type: TypeDelimiter, Delimiter: `\r\n`})
+		assert.Nil(t, err)
+		var buf bytes.Buffer
+		for _, item := range []string{"a", "b\rc", ""} {
+			data, _ := codec.Encode([]byte(item))
+			buf.Write(data)
+		}
+		reader := codec.NewReader(&buf)
+		for _, item := range []string{"a", "b\rc", ""} {
+			data, err := reader.ReadFrame()
+			assert.Nil(t, err)
+			assert.Equal(t, item, string(data))
+		}
+		_, err = reader.ReadFrame()
+		assert.Equal(t, io.EOF, err)
+	})
+	t.Run("DelimiterTooLarge", func(t *testing.T) {
+		codec, _ := NewCodec(Config{MaxFrameSize: 8})
+		_, err := codec.NewReader(strings.NewReader("0123456789abcdef\n")).ReadFrame()
+		assert.True(t, errors.Is(err, ErrFrameTooLarge))
+	})
+	t.Run("Length", func(t *testing.T) {
+		for _, size := range []int{1, 2, 4} {
+			codec, err := NewCodec(Config{Type: TypeLength, LengthFieldSize: size})
+			assert.Nil(t, err)
+			var buf bytes.Buffer
+			for _, item := range []string{"hello", "", "a\nb"} {
+				data, _ := codec.Encode([]byte(item))
+				assert.Equal(t, size+len(item), len(data))
+				buf.Write(data)
+			}
+			reader := codec.NewReader(&buf)
+			for _, item := range []string{"hello", "", "a\nb"} {
+				data, err := reader.ReadFrame()
+				assert.Nil(t, err)
+				assert.Equal(t, item, string(data))
+			}
+		}
+		codec, _ := NewCodec(Config{Type: TypeLength, LengthFieldSize: 2})
+		data, _ := codec.Encode([]byte("hi"))
+		assert.Equal(t, []byte{0, 2, 'h', 'i'}, data)
+		codec, _ = NewCodec(Config{Type: TypeLength, LengthFieldSize: 1})
+		_, err := codec.Encode(make([]byte, 256))
+		assert.True(t, errors.Is(err, ErrFrameTooLarge))
+		codec, _ = NewCodec(Config{Type: TypeLength, MaxFrameSize: 4})
+		_, err = codec.NewReader(bytes.NewReader([]byte{0, 0, 0, 5, 1, 2, 3, 4, 5})).ReadFrame()
+		assert.True(t, errors.Is(err, ErrFrameTooLarge))
+	})
+	t.Run("LittleEndian", func(t *testing.T) {
+		codec, _ := NewCodec(Config{Type: TypeLength, LengthFieldSize: 2, LittleEndian: true})
+		data, _ := codec.Encode([]byte("hi"))
+		assert.Equal(t, []byte{2, 0, 'h', 'i'}, data)
+		data, err := codec.NewReader(bytes.NewReader(data)).ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, "hi", string(data))
+	})
+	t.Run("FixedLength", func(t *testing.T) {
+		codec, err := NewCodec(Config{Type: TypeFixedLength, FixedLength: 3})
+		assert.Nil(t, err)
+		data, err := codec.Encode([]byte("abc"))
+		assert.Nil(t, err)
+		assert.Equal(t, "abc", string(data))
+		_, err = codec.Encode([]byte("ab"))
+		assert.NotNil(t, err)
+		reader := codec.NewReader(strings.NewReader("abcdefgh"))
+		for _, item := range []string{"abc", "def"} {
+			data, err := reader.ReadFrame()
+			assert.Nil(t, err)
+			assert.Equal(t, item, string(data))
+		}
+		//不完整的帧
+		_, err = reader.ReadFrame()
+		assert.Equal(t, io.EOF, err)
+	})
+	t.Run("Reassemble", func(t *testing.T) {
+		//每次只读取一个字节，帧跨多次读取
+		codec, _ := NewCodec(Config{Type: TypeLength, LengthFieldSize: 2})
+		var buf bytes.Buffer
+		for _, item := range []string{"hello", "world"} {
+			data, _ := codec.Encode([]byte(item))
+			buf.Write(data)
+		}
+		reader := codec.NewReader(iotest.OneByteReader(&buf))
+		for _, item := range []string{"hello", "world"} {
+			data, err := reader.ReadFrame()
+			assert.Nil(t, err)
+			assert.Equal(t, item, string(data))
+		}
+
+		//读取超时后保留不完整的帧，下次读取继续
+		codec, _ = NewCodec(Config{})
+		timeout := errors.New("timeout")
+		reader = codec.NewReader(&errReader{chunks: []string{"hel", "lo\nwor", "ld\n"}, err: timeout})
+		_, err := reader.ReadFrame()
+		assert.Equal(t, timeout, err)
+		for _, item := range []string{"hello", "world"} {
+			data, err := reader.ReadFrame()
+			assert.Nil(t, err)
+			assert.Equal(t, item, string(data))
+		}
+	})
+	t.Run("None", func(t *testing.T) {
+		codec, err := NewCodec(Config{Type: TypeNone})
+		assert.Nil(t, err)
+		data, _ := codec.Encode([]byte("raw"))
+		assert.Equal(t, "raw", string(data))
+		data, err = codec.NewReader(strings.NewReader("raw")).ReadFrame()
+		assert.Nil(t, err)
+		assert.Equal(t, "raw", string(data))
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := NewCodec(Config{Type: "xx"})
+		assert.NotNil(t, err)
+		_, err = NewCodec(Config{Type: TypeLength, LengthFieldSize: 3})
+		assert.NotNil(t, err)
+		_, err = NewCodec(Config{Type: TypeFixedLength})
+		assert.NotNil(t, err)
+		_, err = NewCodec(Config{Type: TypeFixedLength, FixedLength: 16, MaxFrameSize: 8})
+		assert.True(t, errors.Is(err, ErrFrameTooLarge))
+	})
+}
+
+// errReader 第一次读取返回数据和错误，模拟读取超时
+type errReader struct {
+	chunks []string
+	err    error
+	count  int
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	r.count++
+	if r.count == 1 {
+		return n, r.err
+	}
+	return n, nil
+}
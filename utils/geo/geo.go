@@ -0,0 +1,443 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package geo provides geofence utilities: GeoJSON zone parsing, point-in-zone tests,
+// distance to zones and a grid spatial index.
+//
+// Coordinates follow GeoJSON order: [longitude, latitude] in degrees.
+// Polygons crossing the antimeridian (an edge spanning more than 180 degrees of longitude)
+// are unwrapped to the [0, 360) longitude range.
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// EarthRadius the mean earth radius in meters
+const EarthRadius = 6371008.8
+
+// epsilon tolerance in degrees for points on polygon edges, about 1cm
+const epsilon = 1e-7
+
+// Point a coordinate in degrees
+type Point struct {
+	Lon float64
+	Lat float64
+}
+
+// Valid whether the coordinate is within the valid range
+func (p Point) Valid() bool {
+	return !math.IsNaN(p.Lat) && !math.IsNaN(p.Lon) && p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 360
+}
+
+// BBox a bounding box in degrees
+type BBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+// polygon a polygon with optional holes, rings[0] is the outer ring
+type polygon struct {
+	rings [][]Point
+	// unwrapped whether the longitudes are unwrapped to [0, 360) because the polygon crosses the antimeridian
+	unwrapped bool
+	bbox      BBox
+}
+
+// Zone a named geofence: one or more polygons, or a circle
+type Zone struct {
+	// Name the zone name
+	Name string
+	// Properties the GeoJSON feature properties
+	Properties map[string]interface{}
+	polygons   []polygon
+	// circle center and radius in meters, used when radius>0
+	center Point
+	radius float64
+	bboxes []BBox
+}
+
+// IsCircle whether the zone is a circle
+func (z *Zone) IsCircle() bool {
+	return z.radius > 0
+}
+
+// Contains whether the point is inside the zone, points on the boundary are inside
+func (z *Zone) Contains(p Point) bool {
+	if z.IsCircle() {
+		return Distance(z.center, p) <= z.radius
+	}
+	for i := range z.polygons {
+		if z.polygons[i].contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Distance returns the distance in meters from the point to the zone boundary, 0 if the point is inside
+func (z *Zone) Distance(p Point) float64 {
+	if z.Contains(p) {
+		return 0
+	}
+	if z.IsCircle() {
+		return Distance(z.center, p) - z.radius
+	}
+	min := math.MaxFloat64
+	for i := range z.polygons {
+		if d := z.polygons[i].distance(p); d < min {
+			min = d
+		}
+	}
+	return min
+}
+
+// BBoxes returns the bounding boxes of the zone, the longitudes of polygons crossing the antimeridian are split
+func (z *Zone) BBoxes() []BBox {
+	return z.bboxes
+}
+
+// normalizeLon returns the longitude in the coordinate space of the polygon
+func (pg *polygon) normalizeLon(lon float64) float64 {
+	if pg.unwrapped && lon < 0 {
+		return lon + 360
+	}
+	return lon
+}
+
+func (pg *polygon) contains(p Point) bool {
+	p.Lon = pg.normalizeLon(p.Lon)
+	if p.Lon < pg.bbox.MinLon-epsilon || p.Lon > pg.bbox.MaxLon+epsilon || p.Lat < pg.bbox.MinLat-epsilon || p.Lat > pg.bbox.MaxLat+epsilon {
+		return false
+	}
+	for i, ring := range pg.rings {
+		inside, onEdge := ringContains(ring, p)
+		if i == 0 {
+			if onEdge {
+				return true
+			}
+			if !inside {
+				return false
+			}
+		} else if inside && !onEdge {
+			//在洞内，洞的边界属于多边形
+			return false
+		}
+	}
+	return true
+}
+
+// distance returns the distance in meters from the point to the nearest polygon edge
+func (pg *polygon) distance(p Point) float64 {
+	p.Lon = pg.normalizeLon(p.Lon)
+	min := math.MaxFloat64
+	cosLat := math.Cos(p.Lat * math.Pi / 180)
+	//以p为原点的局部等距投影
+	project := func(q Point) (float64, float64) {
+		dLon := q.Lon - p.Lon
+		if dLon > 180 {
+			dLon -= 360
+		} else if dLon < -180 {
+			dLon += 360
+		}
+		return dLon * cosLat * math.Pi / 180 * EarthRadius, (q.Lat - p.Lat) * math.Pi / 180 * EarthRadius
+	}
+	for _, ring := range pg.rings {
+		for i := 0; i < len(ring); i++ {
+			ax, ay := project(ring[i])
+			bx, by := project(ring[(i+1)%len(ring)])
+			if d := segmentDistance(ax, ay, bx, by); d < min {
+				min = d
+			}
+		}
+	}
+	return min
+}
+
+// segmentDistance distance from the origin to the segment ab
+func segmentDistance(ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	lengthSquared := dx*dx + dy*dy
+	t := 0.0
+	if lengthSquared > 0 {
+		t = -(ax*dx + ay*dy) / lengthSquared
+		if t < 0 {
+			t = 0
+		} else if t > 1 {
+			t = 1
+		}
+	}
+	x, y := ax+t*dx, ay+t*dy
+	return math.Sqrt(x*x + y*y)
+}
+
+// ringContains ray casting test, returns whether the point is inside the ring and whether it is on an edge
+func ringContains(ring []Point, p Point) (inside bool, onEdge bool) {
+	n := len(ring)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if onSegment(a, b, p) {
+			return true, true
+		}
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) {
+			x := (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat) + a.Lon
+			if p.Lon < x {
+				inside = !inside
+			}
+		}
+	}
+	return inside, false
+}
+
+// onSegment whether p is on the segment ab
+func onSegment(a, b, p Point) bool {
+	if p.Lon < math.Min(a.Lon, b.Lon)-epsilon || p.Lon > math.Max(a.Lon, b.Lon)+epsilon ||
+		p.Lat < math.Min(a.Lat, b.Lat)-epsilon || p.Lat > math.Max(a.Lat, b.Lat)+epsilon {
+		return false
+	}
+	cross := (b.Lon-a.Lon)*(p.Lat-a.Lat) - (b.Lat-a.Lat)*(p.Lon-a.Lon)
+	length := math.Hypot(b.Lon-a.Lon, b.Lat-a.Lat)
+	if length == 0 {
+		return math.Hypot(p.Lon-a.Lon, p.Lat-a.Lat) <= epsilon
+	}
+	return math.Abs(cross)/length <= epsilon
+}
+
+// Distance haversine distance in meters
+func Distance(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// newPolygon creates a polygon from GeoJSON rings
+func newPolygon(rings [][]Point) (polygon, error) {
+	if len(rings) == 0 {
+		return polygon{}, errors.New("polygon has no rings")
+	}
+	pg := polygon{}
+	for _, ring := range rings {
+		//去掉闭合点
+		if len(ring) > 1 && ring[0] == ring[len(ring)-1] {
+			ring = ring[:len(ring)-1]
+		}
+		if len(ring) < 3 {
+			return polygon{}, errors.New("polygon ring must have at least 3 positions")
+		}
+		for i := range ring {
+			if !ring[i].Valid() {
+				return polygon{}, fmt.Errorf("invalid position: [%v,%v]", ring[i].Lon, ring[i].Lat)
+			}
+			if math.Abs(ring[(i+1)%len(ring)].Lon-ring[i].Lon) > 180 {
+				pg.unwrapped = true
+			}
+		}
+		pg.rings = append(pg.rings, ring)
+	}
+	pg.bbox = BBox{MinLon: math.MaxFloat64, MinLat: math.MaxFloat64, MaxLon: -math.MaxFloat64, MaxLat: -math.MaxFloat64}
+	for _, ring := range pg.rings {
+		for i := range ring {
+			ring[i].Lon = pg.normalizeLon(ring[i].Lon)
+			pg.bbox.MinLon = math.Min(pg.bbox.MinLon, ring[i].Lon)
+			pg.bbox.MaxLon = math.Max(pg.bbox.MaxLon, ring[i].Lon)
+			pg.bbox.MinLat = math.Min(pg.bbox.MinLat, ring[i].Lat)
+			pg.bbox.MaxLat = math.Max(pg.bbox.MaxLat, ring[i].Lat)
+		}
+	}
+	return pg, nil
+}
+
+// splitBBox splits a bounding box with longitudes beyond 180 into boxes within [-180, 180]
+func splitBBox(b BBox) []BBox {
+	if b.MaxLon <= 180 {
+		return []BBox{b}
+	}
+	if b.MinLon >= 180 {
+		return []BBox{{MinLon: b.MinLon - 360, MinLat: b.MinLat, MaxLon: b.MaxLon - 360, MaxLat: b.MaxLat}}
+	}
+	return []BBox{
+		{MinLon: b.MinLon, MinLat: b.MinLat, MaxLon: 180, MaxLat: b.MaxLat},
+		{MinLon: -180, MinLat: b.MinLat, MaxLon: b.MaxLon - 360, MaxLat: b.MaxLat},
+	}
+}
+
+// NewCircle creates a circle zone, radius is in meters
+func NewCircle(name string, center Point, radius float64) (*Zone, error) {
+	if !center.Valid() {
+		return nil, fmt.Errorf("invalid position: [%v,%v]", center.Lon, center.Lat)
+	}
+	if radius <= 0 {
+		return nil, errors.New("radius must be greater than 0")
+	}
+	z := &Zone{Name: name, center: center, radius: radius}
+	dLat := radius / EarthRadius * 180 / math.Pi
+	minLat, maxLat := math.Max(-90, center.Lat-dLat), math.Min(90, center.Lat+dLat)
+	cosLat := math.Cos(math.Max(math.Abs(minLat), math.Abs(maxLat)) * math.Pi / 180)
+	if cosLat < 1e-6 || dLat*2 >= 180 {
+		//包含极点的圆覆盖所有经度
+		z.bboxes = []BBox{{MinLon: -180, MinLat: minLat, MaxLon: 180, MaxLat: maxLat}}
+		return z, nil
+	}
+	dLon := math.Min(180, dLat/cosLat)
+	b := BBox{MinLon: center.Lon - dLon, MinLat: minLat, MaxLon: center.Lon + dLon, MaxLat: maxLat}
+	if b.MinLon < -180 {
+		z.bboxes = []BBox{{MinLon: b.MinLon + 360, MinLat: b.MinLat, MaxLon: 180, MaxLat: b.MaxLat}, {MinLon: -180, MinLat: b.MinLat, MaxLon: b.MaxLon, MaxLat: b.MaxLat}}
+	} else {
+		z.bboxes = splitBBox(b)
+	}
+	return z, nil
+}
+
+// NewPolygon creates a polygon zone, each element of polygons is a list of rings: the outer ring followed by holes
+func NewPolygon(name string, polygons ...[][]Point) (*Zone, error) {
+	if len(polygons) == 0 {
+		return nil, errors.New("zone has no polygons")
+	}
+	z := &Zone{Name: name}
+	for _, rings := range polygons {
+		pg, err := newPolygon(rings)
+		if err != nil {
+			return nil, err
+		}
+		z.polygons = append(z.polygons, pg)
+		z.bboxes = append(z.bboxes, splitBBox(pg.bbox)...)
+	}
+	return z, nil
+}
+
+// geoJson GeoJSON object: FeatureCollection, Feature or geometry
+type geoJson struct {
+	Type        string                 `json:"type"`
+	Id          interface{}            `json:"id"`
+	Features    []geoJson              `json:"features"`
+	Geometry    *geoJson               `json:"geometry"`
+	Geometries  []geoJson              `json:"geometries"`
+	Properties  map[string]interface{} `json:"properties"`
+	Coordinates json.RawMessage        `json:"coordinates"`
+}
+
+// ParseGeoJSON parses zones from GeoJSON: a FeatureCollection, a Feature or a geometry.
+// Supported geometries: Polygon, MultiPolygon and Point with properties.radius (meters) as a circle.
+// The zone name is properties.name, or the feature id, or "zone" + index.
+func ParseGeoJSON(data []byte) ([]*Zone, error) {
+	var root geoJson
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	var features []geoJson
+	switch root.Type {
+	case "FeatureCollection":
+		features = root.Features
+	case "Feature":
+		features = []geoJson{root}
+	default:
+		features = []geoJson{{Type: "Feature", Geometry: &root, Properties: root.Properties}}
+	}
+	var zones []*Zone
+	for index, feature := range features {
+		name := zoneName(feature, index)
+		if feature.Geometry == nil {
+			return nil, fmt.Errorf("zone %s: geometry is empty", name)
+		}
+		zone, err := newZone(name, *feature.Geometry, feature.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: %w", name, err)
+		}
+		zone.Properties = feature.Properties
+		zones = append(zones, zone)
+	}
+	return zones, nil
+}
+
+func zoneName(feature geoJson, index int) string {
+	if v, ok := feature.Properties["name"]; ok && v != nil && fmt.Sprint(v) != "" {
+		return fmt.Sprint(v)
+	}
+	if feature.Id != nil {
+		return fmt.Sprint(feature.Id)
+	}
+	return "zone" + strconv.Itoa(index)
+}
+
+func newZone(name string, geometry geoJson, properties map[string]interface{}) (*Zone, error) {
+	switch geometry.Type {
+	case "Polygon":
+		var coordinates [][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &coordinates); err != nil {
+			return nil, err
+		}
+		rings, err := toRings(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		return NewPolygon(name, rings)
+	case "MultiPolygon":
+		var coordinates [][][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &coordinates); err != nil {
+			return nil, err
+		}
+		var polygons [][][]Point
+		for _, item := range coordinates {
+			rings, err := toRings(item)
+			if err != nil {
+				return nil, err
+			}
+			polygons = append(polygons, rings)
+		}
+		return NewPolygon(name, polygons...)
+	case "Point":
+		var coordinates []float64
+		if err := json.Unmarshal(geometry.Coordinates, &coordinates); err != nil {
+			return nil, err
+		}
+		center, err := toPoint(coordinates)
+		if err != nil {
+			return nil, err
+		}
+		radius, _ := properties["radius"].(float64)
+		return NewCircle(name, center, radius)
+	default:
+		return nil, fmt.Errorf("unsupported geometry type: %s", geometry.Type)
+	}
+}
+
+func toRings(coordinates [][][]float64) ([][]Point, error) {
+	var rings [][]Point
+	for _, ring := range coordinates {
+		var points []Point
+		for _, position := range ring {
+			p, err := toPoint(position)
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, p)
+		}
+		rings = append(rings, points)
+	}
+	return rings, nil
+}
+
+func toPoint(position []float64) (Point, error) {
+	if len(position) < 2 {
+		return Point{}, errors.New("position must have longitude and latitude")
+	}
+	return Point{Lon: position[0], Lat: position[1]}, nil
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/rulego/rulego/test/assert"
+)
+
+func square(minLon, minLat, maxLon, maxLat float64) []Point {
+	return []Point{{minLon, minLat}, {maxLon, minLat}, {maxLon, maxLat}, {minLon, maxLat}, {minLon, minLat}}
+}
+
+func TestPolygonWithHole(t *testing.T) {
+	zone, err := NewPolygon("z", [][]Point{square(0, 0, 10, 10), square(4, 4, 6, 6)})
+	assert.Nil(t, err)
+	var tests = []struct {
+		point  Point
+		inside bool
+	}{
+		{Point{2, 2}, true},
+		{Point{5, 5}, false},
+		//外环边界和顶点
+		{Point{0, 5}, true},
+		{Point{10, 10}, true},
+		{Point{5, 0}, true},
+		//洞的边界属于多边形
+		{Point{4, 5}, true},
+		{Point{6, 6}, true},
+		{Point{10.0001, 5}, false},
+		{Point{-0.0001, 0}, false},
+		{Point{11, 5}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.inside, zone.Contains(tt.point), fmt.Sprint(tt.point))
+	}
+}
+
+func TestAntimeridian(t *testing.T) {
+	zone, err := NewPolygon("fiji", [][]Point{{{170, -10}, {-170, -10}, {-170, 10}, {170, 10}, {170, -10}}})
+	assert.Nil(t, err)
+	assert.True(t, zone.Contains(Point{180, 0}))
+	assert.True(t, zone.Contains(Point{-180, 0}))
+	assert.True(t, zone.Contains(Point{-175, 0}))
+	assert.True(t, zone.Contains(Point{175, 5}))
+	assert.True(t, zone.Contains(Point{-170, 10}))
+	assert.False(t, zone.Contains(Point{0, 0}))
+	assert.False(t, zone.Contains(Point{-160, 0}))
+	assert.False(t, zone.Contains(Point{160, 0}))
+	assert.Equal(t, 2, len(zone.BBoxes()))
+	//跨越180度经线计算距离
+	d := zone.Distance(Point{-169, 0})
+	assert.True(t, math.Abs(d-111195) < 1000, fmt.Sprint(d))
+
+	idx := NewIndex([]*Zone{zone}, 0)
+	assert.Equal(t, 1, len(idx.Contains(Point{-175, 0})))
+	assert.Equal(t, 1, len(idx.Contains(Point{175, 0})))
+	assert.Equal(t, 0, len(idx.Contains(Point{0, 0})))
+}
+
+func TestCircle(t *testing.T) {
+	zone, err := NewCircle("c", Point{0, 0}, 1000)
+	assert.Nil(t, err)
+	assert.True(t, zone.Contains(Point{0, 0.008}))
+	assert.False(t, zone.Contains(Point{0, 0.01}))
+	d := zone.Distance(Point{0, 0.01})
+	assert.True(t, math.Abs(d-111.95) < 1, fmt.Sprint(d))
+	_, err = NewCircle("c", Point{0, 0}, 0)
+	assert.NotNil(t, err)
+
+	//跨越180度经线的圆
+	zone, err = NewCircle("c", Point{179.999, 0}, 1000)
+	assert.Nil(t, err)
+	idx := NewIndex([]*Zone{zone}, 0)
+	assert.Equal(t, 1, len(idx.Contains(Point{-179.9995, 0})))
+}
+
+func TestPolygonDistance(t *testing.T) {
+	zone, _ := NewPolygon("z", [][]Point{square(0, 0, 10, 10)})
+	assert.Equal(t, 0.0, zone.Distance(Point{5, 5}))
+	d := zone.Distance(Point{5, 11})
+	assert.True(t, math.Abs(d-111195) < 500, fmt.Sprint(d))
+}
+
+func TestParseGeoJSON(t *testing.T) {
+	zones, err := ParseGeoJSON([]byte(`{
+	  "type": "FeatureCollection",
+	  "features": [
+		{"type": "Feature", "properties": {"name": "square"}, "geometry": {"type": "Polygon", "coordinates": [[[0,0],[10,0],[10,10],[0,10],[0,0]],[[4,4],[6,4],[6,6],[4,6],[4,4]]]}},
+		{"type": "Feature", "id": "multi", "geometry": {"type": "MultiPolygon", "coordinates": [[[[20,20],[21,20],[21,21],[20,20]]],[[[30,30],[31,30],[31,31],[30,30]]]]}},
+		{"type": "Feature", "properties": {"radius": 500}, "geometry": {"type": "Point", "coordinates": [113.32,23.13]}}
+	  ]
+	}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(zones))
+	assert.Equal(t, "square", zones[0].Name)
+	assert.Equal(t, "multi", zones[1].Name)
+	assert.Equal(t, "zone2", zones[2].Name)
+	assert.True(t, zones[1].Contains(Point{30.9, 30.5}))
+	assert.True(t, zones[2].IsCircle())
+
+	zones, err = ParseGeoJSON([]byte(`{"type": "Polygon", "coordinates": [[[0,0],[1,0],[1,1],[0,0]]]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(zones))
+
+	_, err = ParseGeoJSON([]byte(`{"type": "LineString", "coordinates": [[0,0],[1,1]]}`))
+	assert.NotNil(t, err)
+	_, err = ParseGeoJSON([]byte(`{"type": "Point", "coordinates": [0,0]}`))
+	assert.NotNil(t, err)
+	_, err = ParseGeoJSON([]byte(`{"type": "Polygon", "coordinates": [[[0,0],[1,0],[0,0]]]}`))
+	assert.NotNil(t, err)
+	_, err = ParseGeoJSON([]byte(`{"type": "Polygon", "coordinates": [[[0,0],[1,100],[1,1],[0,0]]]}`))
+	assert.NotNil(t, err)
+}
+
+func TestIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var zones []*Zone
+	for i := 0; i < 500; i++ {
+		lon, lat := r.Float64()*300-150, r.Float64()*140-70
+		if i%2 == 0 {
+			zone, _ := NewCircle(fmt.Sprint(i), Point{lon, lat}, r.Float64()*200000+1000)
+			zones = append(zones, zone)
+		} else {
+			size := r.Float64()*5 + 0.1
+			zone, _ := NewPolygon(fmt.Sprint(i), [][]Point{square(lon, lat, lon+size, lat+size)})
+			zones = append(zones, zone)
+		}
+	}
+	//覆盖全球的区域不进入网格索引
+	world, _ := NewPolygon("world", [][]Point{{{-179, -80}, {0, -80}, {179, -80}, {179, 80}, {0, 80}, {-179, 80}}})
+	zones = append(zones, world)
+	idx := NewIndex(zones, 0)
+	assert.Equal(t, 1, len(idx.large))
+	for i := 0; i < 2000; i++ {
+		p := Point{r.Float64()*360 - 180, r.Float64()*180 - 90}
+		var expected []*Zone
+		for _, zone := range zones {
+			if zone.Contains(p) {
+				expected = append(expected, zone)
+			}
+		}
+		assert.Equal(t, expected, idx.Contains(p))
+	}
+	nearest := idx.Nearest(Point{0, 89})
+	assert.NotNil(t, nearest)
+	assert.Nil(t, NewIndex(nil, 0).Nearest(Point{0, 0}))
+}
+
+func BenchmarkIndexContains(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	var zones []*Zone
+	for i := 0; i < 500; i++ {
+		lon, lat := r.Float64()*300-150, r.Float64()*140-70
+		zone, _ := NewPolygon(fmt.Sprint(i), [][]Point{square(lon, lat, lon+1, lat+1)})
+		zones = append(zones, zone)
+	}
+	idx := NewIndex(zones, 0)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Contains(Point{r.Float64()*360 - 180, r.Float64()*180 - 90})
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultCellSize the default grid cell size of Index in degrees
+const DefaultCellSize = 1.0
+
+// maxCellsPerZone zones covering more cells are not indexed and checked for every point
+const maxCellsPerZone = 4096
+
+// Index grid spatial index of zones, each point only checks the zones whose bounding box covers its grid cell.
+// Index is immutable after creation and safe for concurrent use.
+type Index struct {
+	zones    []*Zone
+	cellSize float64
+	cells    map[[2]int][]int
+	// large zones that are not indexed
+	large []int
+}
+
+// Match a zone matched by a point
+type Match struct {
+	Zone *Zone
+	// Distance in meters from the point to the zone, 0 if inside
+	Distance float64
+}
+
+// NewIndex creates an index of the zones, cellSize<=0 means DefaultCellSize
+func NewIndex(zones []*Zone, cellSize float64) *Index {
+	if cellSize <= 0 {
+		cellSize = DefaultCellSize
+	}
+	idx := &Index{zones: zones, cellSize: cellSize, cells: make(map[[2]int][]int)}
+	for i, zone := range zones {
+		var cells [][2]int
+		count := 0
+		for _, b := range zone.BBoxes() {
+			minX, minY := idx.cell(b.MinLon, b.MinLat)
+			maxX, maxY := idx.cell(b.MaxLon, b.MaxLat)
+			count += (maxX - minX + 1) * (maxY - minY + 1)
+			if count > maxCellsPerZone {
+				break
+			}
+			for x := minX; x <= maxX; x++ {
+				for y := minY; y <= maxY; y++ {
+					cells = append(cells, [2]int{x, y})
+				}
+			}
+		}
+		if count > maxCellsPerZone {
+			idx.large = append(idx.large, i)
+			continue
+		}
+		for _, c := range cells {
+			if list := idx.cells[c]; len(list) == 0 || list[len(list)-1] != i {
+				idx.cells[c] = append(list, i)
+			}
+		}
+	}
+	return idx
+}
+
+// Zones returns all zones of the index
+func (idx *Index) Zones() []*Zone {
+	return idx.zones
+}
+
+func (idx *Index) cell(lon, lat float64) (int, int) {
+	return int(math.Floor(lon / idx.cellSize)), int(math.Floor(lat / idx.cellSize))
+}
+
+// Contains returns the zones containing the point in zone definition order
+func (idx *Index) Contains(p Point) []*Zone {
+	if p.Lon > 180 {
+		p.Lon -= 360
+	}
+	x, y := idx.cell(p.Lon, p.Lat)
+	candidates := make(map[int]struct{})
+	//边界上的点可能落在相邻的格子
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			for _, i := range idx.cells[[2]int{x + dx, y + dy}] {
+				candidates[i] = struct{}{}
+			}
+		}
+	}
+	for _, i := range idx.large {
+		candidates[i] = struct{}{}
+	}
+	indexes := make([]int, 0, len(candidates))
+	for i := range candidates {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	var result []*Zone
+	for _, i := range indexes {
+		if zone := idx.zones[i]; zone.Contains(p) {
+			result = append(result, zone)
+		}
+	}
+	return result
+}
+
+// Nearest returns the nearest zone and the distance in meters, 0 if the point is inside a zone.
+// It checks all zones, returns nil if there are no zones.
+func (idx *Index) Nearest(p Point) *Match {
+	var nearest *Match
+	for _, zone := range idx.zones {
+		d := zone.Distance(p)
+		if nearest == nil || d < nearest.Distance {
+			nearest = &Match{Zone: zone, Distance: d}
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return nearest
+}
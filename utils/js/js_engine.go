@@ -26,6 +26,7 @@
 // - GojaJsEngine: The main struct representing the JavaScript engine.
 // - NewGojaJsEngine: Function to create a new instance of the JavaScript engine.
 // - PreCompileJs: Method to precompile user-defined JavaScript functions.
+// - ProgramCache: Process-wide cache of compiled programs shared across rule chain reloads.
 //
 // The package supports features such as:
 // - Pooling of JavaScript VMs for efficient reuse
@@ -63,8 +64,9 @@ type GojaJsEngine struct {
 }
 
 // NewGojaJsEngine Create a new instance of the JavaScript engine
+// The compiled program is cached in DefaultProgramCache, unchanged scripts are not recompiled when the rule chain is reloaded.
 func NewGojaJsEngine(config types.Config, jsScript string, fromVars map[string]interface{}) (*GojaJsEngine, error) {
-	program, err := goja.Compile("", jsScript, true)
+	program, err := DefaultProgramCache.Compile("", jsScript, true)
 	if err != nil {
 		return nil, err
 	}
@@ -88,7 +90,7 @@ func (g *GojaJsEngine) PreCompileJs(config types.Config) error {
 	var jsUdfProgramCache = make(map[string]*goja.Program)
 	for k, v := range config.Udf {
 		if jsFuncStr, ok := v.(string); ok {
-			if p, err := goja.Compile(k, jsFuncStr, true); err != nil {
+			if p, err := DefaultProgramCache.Compile(k, jsFuncStr, true); err != nil {
 				return err
 			} else {
 				jsUdfProgramCache[k] = p
@@ -96,7 +98,7 @@ func (g *GojaJsEngine) PreCompileJs(config types.Config) error {
 		} else if script, scriptOk := v.(types.Script); scriptOk {
 			if script.Type == types.Js || script.Type == "" {
 				if c, ok := script.Content.(string); ok {
-					if p, err := goja.Compile(k, c, true); err != nil {
+					if p, err := DefaultProgramCache.Compile(k, c, true); err != nil {
 						return err
 					} else {
 						jsUdfProgramCache[k] = p
@@ -210,6 +212,23 @@ func (g *GojaJsEngine) Execute(ctx types.RuleContext, functionName string, argum
 func (g *GojaJsEngine) Stop() {
 }
 
+// Program returns the compiled main script program
+func (g *GojaJsEngine) Program() *goja.Program {
+	return g.jsScript
+}
+
+// WarmUp runs the function once with the given synthetic arguments if config.ScriptWarmUp is enabled,
+// so that a VM is created and pooled before the first message arrives.
+// Errors are logged and not returned.
+func WarmUp(config types.Config, jsEngine types.JsEngine, functionName string, argumentList ...interface{}) {
+	if !config.ScriptWarmUp || jsEngine == nil {
+		return
+	}
+	if _, err := jsEngine.Execute(nil, functionName, argumentList...); err != nil && config.Logger != nil {
+		config.Logger.Printf("js warm-up function=%s error,err:%s", functionName, err.Error())
+	}
+}
+
 // setTimeout if timeout interrupt the js script execution
 func (g *GojaJsEngine) setTimeout(vm *goja.Runtime) chan int {
 	state := make(chan int, 1)
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package js
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// DefaultProgramCacheSize the default maximum number of compiled programs kept by DefaultProgramCache
+const DefaultProgramCacheSize = 1024
+
+// DefaultProgramCache process-wide cache of compiled js programs.
+// Unchanged scripts reuse their compiled program across rule chain reloads and across rule chains.
+var DefaultProgramCache = NewProgramCache(DefaultProgramCacheSize)
+
+// ProgramCacheStats program cache metrics
+type ProgramCacheStats struct {
+	// Size the number of cached programs
+	Size int `json:"size"`
+	// Hits the number of compilations served from the cache
+	Hits int64 `json:"hits"`
+	// Misses the number of compilations not found in the cache
+	Misses int64 `json:"misses"`
+	// Evictions the number of programs evicted because the cache is full
+	Evictions int64 `json:"evictions"`
+}
+
+// ProgramCache bounded LRU cache of compiled goja programs keyed by the script hash.
+// A goja.Program is immutable and can be run by multiple runtimes concurrently.
+type ProgramCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	lru      *list.List
+	stats    ProgramCacheStats
+}
+
+type programCacheItem struct {
+	key     string
+	program *goja.Program
+}
+
+// NewProgramCache creates a program cache holding at most capacity programs, capacity<=0 disables caching.
+func NewProgramCache(capacity int) *ProgramCache {
+	return &ProgramCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Compile returns the cached program of the script, compiles and caches it if not found.
+// name is the script name used in error stack traces, it is part of the cache key.
+func (c *ProgramCache) Compile(name, src string, strict bool) (*goja.Program, error) {
+	if c == nil || c.capacity <= 0 {
+		return goja.Compile(name, src, strict)
+	}
+	key := programKey(name, src, strict)
+	c.mu.Lock()
+	if element, ok := c.items[key]; ok {
+		c.lru.MoveToFront(element)
+		c.stats.Hits++
+		c.mu.Unlock()
+		return element.Value.(*programCacheItem).program, nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	// compile without holding the lock
+	program, err := goja.Compile(name, src, strict)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// another goroutine compiled the same script concurrently, use the cached one
+	if element, ok := c.items[key]; ok {
+		c.lru.MoveToFront(element)
+		return element.Value.(*programCacheItem).program, nil
+	}
+	c.items[key] = c.lru.PushFront(&programCacheItem{key: key, program: program})
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*programCacheItem).key)
+		c.stats.Evictions++
+	}
+	return program, nil
+}
+
+// Stats returns the cache metrics
+func (c *ProgramCache) Stats() ProgramCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
+
+// Clear removes all cached programs, metrics are kept
+func (c *ProgramCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// programKey cache key of the script
+func programKey(name, src string, strict bool) string {
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	if strict {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(src))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package js
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestProgramCache(t *testing.T) {
+	cache := NewProgramCache(2)
+	p1, err := cache.Compile("", "function A(){return 1}", true)
+	assert.Nil(t, err)
+	p1Again, err := cache.Compile("", "function A(){return 1}", true)
+	assert.Nil(t, err)
+	assert.True(t, p1 == p1Again)
+
+	//名称不同，不共用
+	p1Named, _ := cache.Compile("a", "function A(){return 1}", true)
+	assert.True(t, p1 != p1Named)
+
+	_, err = cache.Compile("", "function (", true)
+	assert.NotNil(t, err)
+
+	//超过容量，淘汰最久未使用的
+	_, _ = cache.Compile("", "function B(){return 2}", true)
+	stats := cache.Stats()
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(4), stats.Misses)
+	assert.Equal(t, int64(1), stats.Evictions)
+	p1New, _ := cache.Compile("", "function A(){return 1}", true)
+	assert.True(t, p1 != p1New)
+
+	cache.Clear()
+	assert.Equal(t, 0, cache.Stats().Size)
+
+	//容量为0，不缓存
+	noCache := NewProgramCache(0)
+	a, _ := noCache.Compile("", "function A(){return 1}", true)
+	b, _ := noCache.Compile("", "function A(){return 1}", true)
+	assert.True(t, a != b)
+}
+
+func TestProgramCacheConcurrent(t *testing.T) {
+	cache := NewProgramCache(10)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := cache.Compile("", "function A(){return 1}", true)
+			assert.Nil(t, err)
+			assert.NotNil(t, p)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, cache.Stats().Size)
+}
+
+func TestJsEngineProgramReuse(t *testing.T) {
+	config := types.NewConfig()
+	script := "function Transform(msg, metadata, msgType) { return msg; }"
+	engine1, err := NewGojaJsEngine(config, script, nil)
+	assert.Nil(t, err)
+	engine2, err := NewGojaJsEngine(config, script, nil)
+	assert.Nil(t, err)
+	assert.True(t, engine1.Program() == engine2.Program())
+
+	engine3, err := NewGojaJsEngine(config, "function Transform(msg, metadata, msgType) { return 1; }", nil)
+	assert.Nil(t, err)
+	assert.True(t, engine1.Program() != engine3.Program())
+}
+
+func TestWarmUp(t *testing.T) {
+	var logs []string
+	config := types.NewConfig(types.WithScriptWarmUp(true), types.WithLogger(&testLogger{logs: &logs}))
+	jsEngine, err := NewGojaJsEngine(config, "function Transform(msg, metadata, msgType) { return msg.a.b; }", nil)
+	assert.Nil(t, err)
+	//错误只记录日志
+	WarmUp(config, jsEngine, "Transform", map[string]interface{}{}, map[string]string{}, "")
+	assert.Equal(t, 1, len(logs))
+
+	config.ScriptWarmUp = false
+	WarmUp(config, jsEngine, "Transform", map[string]interface{}{}, map[string]string{}, "")
+	assert.Equal(t, 1, len(logs))
+}
+
+type testLogger struct {
+	logs *[]string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	*l.logs = append(*l.logs, format)
+}
@@ -0,0 +1,429 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package json
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPath is returned when a path cannot be parsed.
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrIndexOutOfRange is returned when an array index is outside the array.
+	ErrIndexOutOfRange = errors.New("index out of range")
+)
+
+// AppendToken is the array token that refers to the position after the last element.
+// Setting it appends the value, e.g. "items[-]" or "/items/-".
+const AppendToken = "-"
+
+// pathToken is one step of a path.
+type pathToken struct {
+	key string
+	// index is true for bracket tokens such as [0] or [-], which only match arrays
+	index bool
+}
+
+// Path is a compiled path into a decoded JSON value, made of
+// map[string]interface{} objects and []interface{} arrays.
+//
+// Two syntaxes are supported:
+//   - RFC 6901 JSON pointer, starting with "/": "/a/b~1c/0". "~1" is "/" and "~0" is "~".
+//     The empty string refers to the whole document.
+//   - Dotted path: "a.b[0].c". A "\" escapes the next character, so "a\.b" is the key "a.b".
+//     If a key is not found, the remaining segments joined with "." are tried as one key,
+//     so "metadata.respHeader.Location" also matches the key "respHeader.Location".
+//
+// In both syntaxes a numeric key addresses an array element and "-" addresses
+// the position after the last element, which appends on Set.
+type Path struct {
+	raw    string
+	dotted bool
+	tokens []pathToken
+}
+
+// CompilePath parses the path once so that it can be reused.
+func CompilePath(path string) (*Path, error) {
+	p := &Path{raw: path}
+	var err error
+	if path == "" || path[0] == '/' {
+		p.tokens, err = parsePointer(path)
+	} else {
+		p.dotted = true
+		p.tokens, err = parseDotted(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MustCompilePath is like CompilePath but panics if the path cannot be parsed.
+func MustCompilePath(path string) *Path {
+	p, err := CompilePath(path)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source of the path.
+func (p *Path) String() string {
+	return p.raw
+}
+
+// EscapePointer escapes a key for use as a JSON pointer token.
+func EscapePointer(key string) string {
+	if !strings.ContainsAny(key, "~/") {
+		return key
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// EscapeDotted escapes a key for use as a dotted path segment.
+func EscapeDotted(key string) string {
+	if !strings.ContainsAny(key, `\.[]`) {
+		return key
+	}
+	var sb strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch key[i] {
+		case '\\', '.', '[', ']':
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(key[i])
+	}
+	return sb.String()
+}
+
+// Get returns the value at path and whether it exists.
+func Get(root interface{}, path string) (interface{}, bool) {
+	p, err := CompilePath(path)
+	if err != nil {
+		return nil, false
+	}
+	return p.Get(root)
+}
+
+// Set sets the value at path, creating missing intermediate objects and arrays,
+// and returns the new root. The root changes when it is nil or an array that is appended to.
+func Set(root interface{}, path string, value interface{}) (interface{}, error) {
+	p, err := CompilePath(path)
+	if err != nil {
+		return root, err
+	}
+	return p.Set(root, value)
+}
+
+// Delete removes the value at path and returns the new root.
+// Deleting a path that does not exist is not an error.
+func Delete(root interface{}, path string) (interface{}, error) {
+	p, err := CompilePath(path)
+	if err != nil {
+		return root, err
+	}
+	return p.Delete(root)
+}
+
+// Get returns the value at the path and whether it exists.
+func (p *Path) Get(root interface{}) (interface{}, bool) {
+	current := root
+	for i := 0; i < len(p.tokens); i++ {
+		token := p.tokens[i]
+		switch v := current.(type) {
+		case map[string]interface{}:
+			if token.index {
+				return nil, false
+			}
+			val, next, ok := p.lookup(i, func(key string) (interface{}, bool) {
+				val, ok := v[key]
+				return val, ok
+			})
+			if !ok {
+				return nil, false
+			}
+			current, i = val, next
+		case map[string]string:
+			if token.index {
+				return nil, false
+			}
+			val, next, ok := p.lookup(i, func(key string) (interface{}, bool) {
+				val, ok := v[key]
+				return val, ok
+			})
+			if !ok {
+				return nil, false
+			}
+			current, i = val, next
+		case []interface{}:
+			index, ok := arrayIndex(token.key, len(v))
+			if !ok || index >= len(v) {
+				return nil, false
+			}
+			current = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// Set sets the value at the path and returns the new root.
+func (p *Path) Set(root interface{}, value interface{}) (interface{}, error) {
+	return p.set(root, 0, value)
+}
+
+// Delete removes the value at the path and returns the new root.
+func (p *Path) Delete(root interface{}) (interface{}, error) {
+	if len(p.tokens) == 0 {
+		return nil, nil
+	}
+	return p.delete(root, 0)
+}
+
+// lookup finds tokens[i] by get. For dotted paths, if the key is not found, the following
+// name tokens are joined with "." and tried as one key. It returns the value and the last token used.
+func (p *Path) lookup(i int, get func(key string) (interface{}, bool)) (interface{}, int, bool) {
+	key := p.tokens[i].key
+	if val, ok := get(key); ok {
+		return val, i, true
+	}
+	if !p.dotted {
+		return nil, i, false
+	}
+	for j := i + 1; j < len(p.tokens) && !p.tokens[j].index; j++ {
+		key = key + "." + p.tokens[j].key
+		if val, ok := get(key); ok {
+			return val, j, true
+		}
+	}
+	return nil, i, false
+}
+
+func (p *Path) set(current interface{}, i int, value interface{}) (interface{}, error) {
+	if i == len(p.tokens) {
+		return value, nil
+	}
+	token := p.tokens[i]
+	if current == nil {
+		//创建缺失的中间节点，下一个是数组下标则创建数组，否则创建对象
+		if token.index || token.key == AppendToken {
+			current = []interface{}{}
+		} else {
+			current = map[string]interface{}{}
+		}
+	}
+	switch v := current.(type) {
+	case map[string]interface{}:
+		if token.index {
+			return current, p.typeError(i, current)
+		}
+		child, err := p.set(v[token.key], i+1, value)
+		if err != nil {
+			return current, err
+		}
+		v[token.key] = child
+		return v, nil
+	case []interface{}:
+		index, ok := arrayIndex(token.key, len(v))
+		if !ok {
+			return current, p.typeError(i, current)
+		}
+		if index > len(v) {
+			return current, fmt.Errorf("path %s: %w: %d", p.raw, ErrIndexOutOfRange, index)
+		}
+		if index == len(v) {
+			child, err := p.set(nil, i+1, value)
+			if err != nil {
+				return current, err
+			}
+			return append(v, child), nil
+		}
+		child, err := p.set(v[index], i+1, value)
+		if err != nil {
+			return current, err
+		}
+		v[index] = child
+		return v, nil
+	default:
+		return current, p.typeError(i, current)
+	}
+}
+
+func (p *Path) delete(current interface{}, i int) (interface{}, error) {
+	token := p.tokens[i]
+	last := i == len(p.tokens)-1
+	switch v := current.(type) {
+	case map[string]interface{}:
+		if token.index {
+			return current, nil
+		}
+		child, ok := v[token.key]
+		if !ok {
+			return current, nil
+		}
+		if last {
+			delete(v, token.key)
+			return v, nil
+		}
+		child, err := p.delete(child, i+1)
+		if err != nil {
+			return current, err
+		}
+		v[token.key] = child
+		return v, nil
+	case []interface{}:
+		index, ok := arrayIndex(token.key, len(v))
+		if !ok || index >= len(v) {
+			return current, nil
+		}
+		if last {
+			return append(v[:index:index], v[index+1:]...), nil
+		}
+		child, err := p.delete(v[index], i+1)
+		if err != nil {
+			return current, err
+		}
+		v[index] = child
+		return v, nil
+	default:
+		return current, nil
+	}
+}
+
+func (p *Path) typeError(i int, current interface{}) error {
+	return fmt.Errorf("path %s: cannot use %q on %T", p.raw, p.tokens[i].key, current)
+}
+
+// arrayIndex converts the token to an array index, "-" is the length of the array.
+func arrayIndex(key string, length int) (int, bool) {
+	if key == AppendToken {
+		return length, true
+	}
+	if key == "" || (len(key) > 1 && key[0] == '0') {
+		return 0, false
+	}
+	index, err := strconv.Atoi(key)
+	if err != nil || index < 0 {
+		return 0, false
+	}
+	return index, true
+}
+
+// parsePointer parses a RFC 6901 JSON pointer.
+func parsePointer(path string) ([]pathToken, error) {
+	if path == "" {
+		return nil, nil
+	}
+	parts := strings.Split(path[1:], "/")
+	tokens := make([]pathToken, 0, len(parts))
+	for _, part := range parts {
+		if strings.Contains(part, "~") {
+			var sb strings.Builder
+			for j := 0; j < len(part); j++ {
+				if part[j] != '~' {
+					sb.WriteByte(part[j])
+					continue
+				}
+				if j+1 >= len(part) || (part[j+1] != '0' && part[j+1] != '1') {
+					return nil, fmt.Errorf("%w: %s: '~' must be followed by '0' or '1'", ErrInvalidPath, path)
+				}
+				j++
+				if part[j] == '0' {
+					sb.WriteByte('~')
+				} else {
+					sb.WriteByte('/')
+				}
+			}
+			part = sb.String()
+		}
+		tokens = append(tokens, pathToken{key: part})
+	}
+	return tokens, nil
+}
+
+// parseDotted parses a dotted path such as a.b[0].c
+func parseDotted(path string) ([]pathToken, error) {
+	var tokens []pathToken
+	var sb strings.Builder
+	//是否正在读取字段名
+	started := false
+	//是否需要字段名，开始或者"."之后
+	needName := true
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidPath, path, reason)
+	}
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch c {
+		case '\\':
+			if i+1 >= len(path) {
+				return nil, invalid("trailing '\\'")
+			}
+			if !started && !needName {
+				return nil, invalid("missing '.' after ']'")
+			}
+			i++
+			sb.WriteByte(path[i])
+			started = true
+		case '.':
+			if !started && needName {
+				return nil, invalid("empty segment")
+			}
+			if started {
+				tokens = append(tokens, pathToken{key: sb.String()})
+				sb.Reset()
+				started = false
+			}
+			needName = true
+		case '[':
+			if started {
+				tokens = append(tokens, pathToken{key: sb.String()})
+				sb.Reset()
+				started = false
+			} else if needName && len(tokens) > 0 {
+				return nil, invalid("empty segment")
+			}
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, invalid("missing ']'")
+			}
+			key := path[i+1 : i+end]
+			if _, ok := arrayIndex(key, 0); !ok {
+				return nil, invalid("array index must be a number or '-'")
+			}
+			tokens = append(tokens, pathToken{key: key, index: true})
+			i += end
+			needName = false
+		default:
+			if !started && !needName {
+				return nil, invalid("missing '.' after ']'")
+			}
+			sb.WriteByte(c)
+			started = true
+		}
+	}
+	if started {
+		tokens = append(tokens, pathToken{key: sb.String()})
+	} else if needName {
+		return nil, invalid("empty segment")
+	}
+	return tokens, nil
+}
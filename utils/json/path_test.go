@@ -0,0 +1,258 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package json
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rulego/rulego/test/assert"
+)
+
+func newDoc(t *testing.T) map[string]interface{} {
+	var doc map[string]interface{}
+	err := Unmarshal([]byte(`{
+		"a": {"b": 1, "c.d": 2},
+		"a.b": 3,
+		"m~n": 4,
+		"x/y": 5,
+		"~01": 6,
+		"~1": 7,
+		"": 8,
+		" ": 9,
+		"items": [{"name": "n0"}, {"name": "n1"}],
+		"-": 10,
+		"0": 11,
+		"back\\slash": 12,
+		"br[0]": 13
+	}`), &doc)
+	assert.Nil(t, err)
+	return doc
+}
+
+func TestPathGet(t *testing.T) {
+	doc := newDoc(t)
+	cases := []struct {
+		path     string
+		expected interface{}
+		found    bool
+	}{
+		//RFC 6901 JSON pointer
+		{"/a/b", float64(1), true},
+		{"/a/c.d", float64(2), true},
+		{"/a.b", float64(3), true},
+		{"/m~0n", float64(4), true},
+		{"/x~1y", float64(5), true},
+		//~01 是 ~1，不是 /
+		{"/~001", float64(6), true},
+		{"/~01", float64(7), true},
+		{"/", float64(8), true},
+		{"/ ", float64(9), true},
+		{"/items/1/name", "n1", true},
+		{"/items/2/name", nil, false},
+		{"/items/-", nil, false},
+		{"/items/01", nil, false},
+		{"/-", float64(10), true},
+		{"/0", float64(11), true},
+		{"/back\\slash", float64(12), true},
+		{"/br[0]", float64(13), true},
+		{"/a/b/c", nil, false},
+		{"/missing", nil, false},
+		//点号路径
+		{"a.b", float64(1), true},
+		{"a.c.d", float64(2), true},
+		{`a.c\.d`, float64(2), true},
+		{`a\.b`, float64(3), true},
+		{"m~n", float64(4), true},
+		{"x/y", float64(5), true},
+		{"items[0].name", "n0", true},
+		{"items.1.name", "n1", true},
+		{"items[2]", nil, false},
+		{"items[-]", nil, false},
+		{`back\\slash`, float64(12), true},
+		{`br\[0\]`, float64(13), true},
+		{"a.b.c", nil, false},
+		{"a[0]", nil, false},
+	}
+	for _, c := range cases {
+		val, ok := Get(doc, c.path)
+		assert.Equal(t, c.found, ok, c.path)
+		assert.Equal(t, c.expected, val, c.path)
+	}
+
+	//空pointer指向整个文档
+	val, ok := Get(doc, "")
+	assert.True(t, ok)
+	assert.Equal(t, doc, val)
+
+	//map[string]string 和带"."的key
+	metadata := map[string]interface{}{"metadata": map[string]string{"respHeader.Location": "/items/1"}}
+	val, ok = Get(metadata, "metadata.respHeader.Location")
+	assert.True(t, ok)
+	assert.Equal(t, "/items/1", val)
+	val, ok = Get(metadata, "/metadata/respHeader.Location")
+	assert.True(t, ok)
+	assert.Equal(t, "/items/1", val)
+	_, ok = Get(metadata, "/metadata/respHeader/Location")
+	assert.False(t, ok)
+}
+
+func TestPathSet(t *testing.T) {
+	doc := newDoc(t)
+	var err error
+	var root interface{} = doc
+
+	root, err = Set(root, "/m~0n", "tilde")
+	assert.Nil(t, err)
+	assert.Equal(t, "tilde", doc["m~n"])
+
+	root, err = Set(root, "/x~1y", "slash")
+	assert.Nil(t, err)
+	assert.Equal(t, "slash", doc["x/y"])
+
+	root, err = Set(root, `a\.b`, "dotted")
+	assert.Nil(t, err)
+	assert.Equal(t, "dotted", doc["a.b"])
+	assert.Equal(t, float64(1), doc["a"].(map[string]interface{})["b"])
+
+	//自动创建中间对象
+	root, err = Set(root, "new.sub.key", true)
+	assert.Nil(t, err)
+	assert.Equal(t, true, doc["new"].(map[string]interface{})["sub"].(map[string]interface{})["key"])
+
+	//追加数组元素
+	root, err = Set(root, "items[-].name", "n2")
+	assert.Nil(t, err)
+	root, err = Set(root, "/items/-", "n3")
+	assert.Nil(t, err)
+	items := doc["items"].([]interface{})
+	assert.Equal(t, 4, len(items))
+	assert.Equal(t, "n2", items[2].(map[string]interface{})["name"])
+	assert.Equal(t, "n3", items[3])
+
+	//下标等于长度时追加，超出长度报错
+	root, err = Set(root, "items[4]", "n4")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(doc["items"].([]interface{})))
+	_, err = Set(root, "items[9]", "n9")
+	assert.True(t, errors.Is(err, ErrIndexOutOfRange))
+
+	//缺失的数组自动创建
+	root, err = Set(root, "tags[-]", "t1")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"t1"}, doc["tags"])
+
+	//修改已有数组元素
+	root, err = Set(root, "/items/0/name", "first")
+	assert.Nil(t, err)
+	val, _ := Get(root, "items[0].name")
+	assert.Equal(t, "first", val)
+
+	//不能在非容器上设置字段
+	_, err = Set(root, "a.b.c", 1)
+	assert.NotNil(t, err)
+	_, err = Set(root, "a[0]", 1)
+	assert.NotNil(t, err)
+
+	//根节点为nil时创建
+	newRoot, err := Set(nil, "a.b", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"b": 1}}, newRoot)
+	newRoot, err = Set(nil, "[-]", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{1}, newRoot)
+
+	//空pointer替换整个文档
+	newRoot, err = Set(root, "", "replaced")
+	assert.Nil(t, err)
+	assert.Equal(t, "replaced", newRoot)
+}
+
+func TestPathDelete(t *testing.T) {
+	doc := newDoc(t)
+	var root interface{} = doc
+	var err error
+
+	root, err = Delete(root, "/~01")
+	assert.Nil(t, err)
+	_, ok := doc["~1"]
+	assert.False(t, ok)
+	assert.Equal(t, float64(6), doc["~01"])
+
+	root, err = Delete(root, `a\.b`)
+	assert.Nil(t, err)
+	_, ok = doc["a.b"]
+	assert.False(t, ok)
+	assert.Equal(t, float64(1), doc["a"].(map[string]interface{})["b"])
+
+	root, err = Delete(root, "items[0]")
+	assert.Nil(t, err)
+	items := doc["items"].([]interface{})
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, "n1", items[0].(map[string]interface{})["name"])
+
+	root, err = Delete(root, "/items/0/name")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(doc["items"].([]interface{})[0].(map[string]interface{})))
+
+	//不存在的路径不报错
+	_, err = Delete(root, "missing.key")
+	assert.Nil(t, err)
+	_, err = Delete(root, "items[5]")
+	assert.Nil(t, err)
+}
+
+func TestPathInvalid(t *testing.T) {
+	for _, path := range []string{
+		"/a~",
+		"/a~2",
+		"a..b",
+		".a",
+		"a.",
+		"a[",
+		"a[x]",
+		"a[-1]",
+		"a[0]b",
+		"a.[0]",
+		`a\`,
+	} {
+		_, err := CompilePath(path)
+		assert.True(t, errors.Is(err, ErrInvalidPath), path)
+		_, ok := Get(map[string]interface{}{}, path)
+		assert.False(t, ok)
+		_, err = Set(map[string]interface{}{}, path, 1)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	keys := []string{"plain", "a.b", "a/b", "a~b", "~01", "~1", "a[0]", `back\slash`, "", "-", "0"}
+	for _, key := range keys {
+		doc := map[string]interface{}{key: key}
+		val, ok := Get(doc, "/"+EscapePointer(key))
+		assert.True(t, ok, key)
+		assert.Equal(t, key, val)
+		if key != "" {
+			val, ok = Get(doc, EscapeDotted(key))
+			assert.True(t, ok, key)
+			assert.Equal(t, key, val)
+		}
+	}
+	assert.Equal(t, "~001", EscapePointer("~01"))
+	assert.Equal(t, "a~1b~0c", EscapePointer("a/b~c"))
+	assert.Equal(t, `a\.b\[0\]\\`, EscapeDotted(`a.b[0]\`))
+}
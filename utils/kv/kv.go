@@ -0,0 +1,476 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kv provides a small embedded key/value store persisted to a single file.
+//
+// The file is an append-only log of put and delete records. On Open the log is
+// replayed into an in-memory index; a torn or corrupt record at the tail, left by
+// a process that was killed while writing, is truncated away. Keys are grouped in
+// buckets and may carry a TTL. Expired keys are hidden from reads immediately and
+// removed from the index lazily on later writes. The log is compacted when the
+// dead records outnumber the live ones.
+package kv
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the key does not exist or has expired.
+	ErrNotFound = errors.New("key not found")
+	// ErrClosed is returned when the store has been closed.
+	ErrClosed = errors.New("kv store closed")
+	// ErrEmptyKey is returned when the bucket or the key is empty.
+	ErrEmptyKey = errors.New("bucket and key can not be empty")
+)
+
+const (
+	opPut    byte = 1
+	opDelete byte = 2
+	// headerSize is crc32 + payload length
+	headerSize = 8
+	// maxRecordSize guards against a corrupt length field
+	maxRecordSize = 64 << 20
+	// DefaultCompactMinDead is the minimum number of dead records before an automatic compaction.
+	DefaultCompactMinDead = 1000
+)
+
+// Options are the options of the store.
+type Options struct {
+	// SyncWrites calls fsync after every write, so that written records survive an OS crash.
+	// Without it, records survive a process crash but may be lost on power failure.
+	SyncWrites bool
+	// CompactMinDead is the minimum number of dead records before the log is compacted automatically.
+	// Default is DefaultCompactMinDead, a negative value disables automatic compaction.
+	CompactMinDead int
+}
+
+// Entry is a key/value pair returned by Scan.
+type Entry struct {
+	Key   string
+	Value []byte
+	// ExpireAt is the expiry time in unix milliseconds, 0 means never.
+	ExpireAt int64
+}
+
+type record struct {
+	value    []byte
+	expireAt int64
+}
+
+func (r *record) expired(now int64) bool {
+	return r.expireAt > 0 && r.expireAt <= now
+}
+
+// DB is an embedded key/value store. It is safe for concurrent use.
+type DB struct {
+	mu      sync.RWMutex
+	path    string
+	options Options
+	file    *os.File
+	buckets map[string]map[string]*record
+	expiry  expiryHeap
+	// live is the number of records in the index, dead is the number of records in the log that are overwritten, deleted or expired
+	live   int
+	dead   int
+	closed bool
+}
+
+// Open opens the store at path, creating it if it does not exist.
+func Open(path string) (*DB, error) {
+	return OpenWithOptions(path, Options{})
+}
+
+// OpenWithOptions opens the store at path with options, creating it if it does not exist.
+func OpenWithOptions(path string, options Options) (*DB, error) {
+	if options.CompactMinDead == 0 {
+		options.CompactMinDead = DefaultCompactMinDead
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	db := &DB{
+		path:    path,
+		options: options,
+		buckets: make(map[string]map[string]*record),
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.replay(file); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	db.file = file
+	return db, nil
+}
+
+// Path returns the file path of the store.
+func (db *DB) Path() string {
+	return db.path
+}
+
+// Put stores value under bucket/key. A ttl greater than 0 makes the key expire after ttl.
+func (db *DB) Put(bucket, key string, value []byte, ttl time.Duration) error {
+	if bucket == "" || key == "" {
+		return ErrEmptyKey
+	}
+	var expireAt int64
+	if ttl > 0 {
+		//向上取整到毫秒
+		expireAt = nowMilli() + int64((ttl+time.Millisecond-1)/time.Millisecond)
+	}
+	v := make([]byte, len(value))
+	copy(v, value)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if err := db.write(encodeRecord(opPut, expireAt, bucket, key, v)); err != nil {
+		return err
+	}
+	db.apply(opPut, expireAt, bucket, key, v)
+	if expireAt > 0 {
+		heap.Push(&db.expiry, expiryItem{expireAt: expireAt, bucket: bucket, key: key})
+	}
+	return db.afterWrite()
+}
+
+// Get returns the value of bucket/key, or ErrNotFound if it does not exist or has expired.
+func (db *DB) Get(bucket, key string) ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	r, ok := db.buckets[bucket][key]
+	if !ok || r.expired(nowMilli()) {
+		return nil, ErrNotFound
+	}
+	v := make([]byte, len(r.value))
+	copy(v, r.value)
+	return v, nil
+}
+
+// Delete removes bucket/key. Deleting a key that does not exist is not an error.
+func (db *DB) Delete(bucket, key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	if _, ok := db.buckets[bucket][key]; !ok {
+		return nil
+	}
+	if err := db.write(encodeRecord(opDelete, 0, bucket, key, nil)); err != nil {
+		return err
+	}
+	db.apply(opDelete, 0, bucket, key, nil)
+	//删除记录本身也是无效记录
+	db.dead++
+	return db.afterWrite()
+}
+
+// Scan returns the entries of bucket whose key starts with prefix, sorted by key.
+// A limit greater than 0 limits the number of entries returned.
+func (db *DB) Scan(bucket, prefix string, limit int) ([]Entry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	now := nowMilli()
+	keys := make([]string, 0)
+	for k, r := range db.buckets[bucket] {
+		if strings.HasPrefix(k, prefix) && !r.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	entries := make([]Entry, 0, len(keys))
+	for _, k := range keys {
+		r := db.buckets[bucket][k]
+		v := make([]byte, len(r.value))
+		copy(v, r.value)
+		entries = append(entries, Entry{Key: k, Value: v, ExpireAt: r.expireAt})
+	}
+	return entries, nil
+}
+
+// Buckets returns the names of the buckets that have keys, sorted.
+func (db *DB) Buckets() []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var names []string
+	for name, b := range db.buckets {
+		if len(b) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Compact rewrites the log with only the live records.
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	return db.compact()
+}
+
+// Close closes the store. Further operations return ErrClosed.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	return db.file.Close()
+}
+
+func (db *DB) write(b []byte) error {
+	if _, err := db.file.Write(b); err != nil {
+		return err
+	}
+	if db.options.SyncWrites {
+		return db.file.Sync()
+	}
+	return nil
+}
+
+// apply updates the in-memory index.
+func (db *DB) apply(op byte, expireAt int64, bucket, key string, value []byte) {
+	b, ok := db.buckets[bucket]
+	if !ok {
+		if op == opDelete {
+			return
+		}
+		b = make(map[string]*record)
+		db.buckets[bucket] = b
+	}
+	if _, ok := b[key]; ok {
+		db.live--
+		db.dead++
+		delete(b, key)
+	}
+	if op == opPut {
+		b[key] = &record{value: value, expireAt: expireAt}
+		db.live++
+	}
+	if len(b) == 0 {
+		delete(db.buckets, bucket)
+	}
+}
+
+// afterWrite removes expired keys from the index and compacts the log if needed.
+func (db *DB) afterWrite() error {
+	db.removeExpired(nowMilli())
+	if db.options.CompactMinDead >= 0 && db.dead >= db.options.CompactMinDead && db.dead > db.live {
+		return db.compact()
+	}
+	return nil
+}
+
+func (db *DB) removeExpired(now int64) {
+	for db.expiry.Len() > 0 && db.expiry[0].expireAt <= now {
+		item := heap.Pop(&db.expiry).(expiryItem)
+		//key 可能已经被覆盖或者删除，只有过期时间一致才删除
+		if r, ok := db.buckets[item.bucket][item.key]; ok && r.expireAt == item.expireAt {
+			db.apply(opDelete, 0, item.bucket, item.key, nil)
+		}
+	}
+}
+
+func (db *DB) compact() error {
+	tmpPath := db.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	db.removeExpired(nowMilli())
+	var buf []byte
+	for bucket, b := range db.buckets {
+		for key, r := range b {
+			buf = append(buf, encodeRecord(opPut, r.expireAt, bucket, key, r.value)...)
+		}
+	}
+	if _, err = tmp.Write(buf); err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err = os.Rename(tmpPath, db.path); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	_ = db.file.Close()
+	if _, err = tmp.Seek(0, io.SeekEnd); err != nil {
+		_ = tmp.Close()
+		db.closed = true
+		return err
+	}
+	db.file = tmp
+	db.dead = 0
+	return nil
+}
+
+// replay loads the log into the index and truncates the torn or corrupt tail.
+func (db *DB) replay(file *os.File) error {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	now := nowMilli()
+	offset := 0
+	for offset < len(data) {
+		op, expireAt, bucket, key, value, n, ok := decodeRecord(data[offset:])
+		if !ok {
+			break
+		}
+		offset += n
+		if op == opDelete {
+			db.dead++
+		}
+		if op == opPut && expireAt > 0 && expireAt <= now {
+			//已经过期的记录，删除旧值
+			db.apply(opDelete, 0, bucket, key, nil)
+			db.dead++
+			continue
+		}
+		db.apply(op, expireAt, bucket, key, value)
+		if op == opPut && expireAt > 0 {
+			heap.Push(&db.expiry, expiryItem{expireAt: expireAt, bucket: bucket, key: key})
+		}
+	}
+	if offset < len(data) {
+		if err = file.Truncate(int64(offset)); err != nil {
+			return err
+		}
+	}
+	_, err = file.Seek(int64(offset), io.SeekStart)
+	return err
+}
+
+// encodeRecord encodes a record: crc32(4) | payload length(4) | payload
+// payload: op(1) | expireAt(8) | uvarint bucket length | bucket | uvarint key length | key | value
+func encodeRecord(op byte, expireAt int64, bucket, key string, value []byte) []byte {
+	var lenBuf [binary.MaxVarintLen64]byte
+	payloadLen := 1 + 8 + binary.MaxVarintLen64*2 + len(bucket) + len(key) + len(value)
+	b := make([]byte, headerSize, headerSize+payloadLen)
+	b = append(b, op)
+	var expireBuf [8]byte
+	binary.LittleEndian.PutUint64(expireBuf[:], uint64(expireAt))
+	b = append(b, expireBuf[:]...)
+	n := binary.PutUvarint(lenBuf[:], uint64(len(bucket)))
+	b = append(b, lenBuf[:n]...)
+	b = append(b, bucket...)
+	n = binary.PutUvarint(lenBuf[:], uint64(len(key)))
+	b = append(b, lenBuf[:n]...)
+	b = append(b, key...)
+	b = append(b, value...)
+	payload := b[headerSize:]
+	binary.LittleEndian.PutUint32(b[0:4], crc32.ChecksumIEEE(payload))
+	binary.LittleEndian.PutUint32(b[4:8], uint32(len(payload)))
+	return b
+}
+
+// decodeRecord decodes the record at the start of data, ok is false if the record is incomplete or corrupt.
+func decodeRecord(data []byte) (op byte, expireAt int64, bucket, key string, value []byte, n int, ok bool) {
+	if len(data) < headerSize {
+		return
+	}
+	checksum := binary.LittleEndian.Uint32(data[0:4])
+	length := int(binary.LittleEndian.Uint32(data[4:8]))
+	if length < 9 || length > maxRecordSize || len(data) < headerSize+length {
+		return
+	}
+	payload := data[headerSize : headerSize+length]
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return
+	}
+	op = payload[0]
+	if op != opPut && op != opDelete {
+		return
+	}
+	expireAt = int64(binary.LittleEndian.Uint64(payload[1:9]))
+	rest := payload[9:]
+	bucketLen, m := binary.Uvarint(rest)
+	if m <= 0 || uint64(len(rest)-m) < bucketLen {
+		return
+	}
+	rest = rest[m:]
+	bucket = string(rest[:bucketLen])
+	rest = rest[bucketLen:]
+	keyLen, m := binary.Uvarint(rest)
+	if m <= 0 || uint64(len(rest)-m) < keyLen {
+		return
+	}
+	rest = rest[m:]
+	key = string(rest[:keyLen])
+	value = append([]byte(nil), rest[keyLen:]...)
+	return op, expireAt, bucket, key, value, headerSize + length, true
+}
+
+func nowMilli() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+type expiryItem struct {
+	expireAt int64
+	bucket   string
+	key      string
+}
+
+// expiryHeap is a min-heap of expiry times.
+type expiryHeap []expiryItem
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].expireAt < h[j].expireAt }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiryItem)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestPutGetScan(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "data", "test.kv"))
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.Put("devices", "dev-2", []byte(`{"name":"b"}`), 0))
+	assert.Nil(t, db.Put("devices", "dev-1", []byte(`{"name":"a"}`), 0))
+	assert.Nil(t, db.Put("devices", "gw-1", []byte(`{"name":"gw"}`), 0))
+	assert.Nil(t, db.Put("thresholds", "dev-1", []byte("30"), 0))
+	assert.Equal(t, ErrEmptyKey, db.Put("devices", "", nil, 0))
+
+	v, err := db.Get("devices", "dev-1")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name":"a"}`, string(v))
+	_, err = db.Get("devices", "notFound")
+	assert.Equal(t, ErrNotFound, err)
+
+	entries, err := db.Scan("devices", "dev-", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "dev-1", entries[0].Key)
+	assert.Equal(t, "dev-2", entries[1].Key)
+
+	entries, _ = db.Scan("devices", "", 1)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "dev-1", entries[0].Key)
+
+	assert.Nil(t, db.Delete("devices", "dev-1"))
+	assert.Nil(t, db.Delete("devices", "notFound"))
+	_, err = db.Get("devices", "dev-1")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, []string{"devices", "thresholds"}, db.Buckets())
+
+	assert.Nil(t, db.Close())
+	_, err = db.Get("devices", "dev-2")
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ttl.kv")
+	db, err := Open(path)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Put("b", "short", []byte("1"), time.Millisecond*20))
+	assert.Nil(t, db.Put("b", "long", []byte("2"), time.Hour))
+	//覆盖后不再过期
+	assert.Nil(t, db.Put("b", "overwritten", []byte("3"), time.Millisecond*20))
+	assert.Nil(t, db.Put("b", "overwritten", []byte("4"), 0))
+
+	time.Sleep(time.Millisecond * 30)
+	_, err = db.Get("b", "short")
+	assert.Equal(t, ErrNotFound, err)
+	entries, _ := db.Scan("b", "", 0)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "long", entries[0].Key)
+	assert.True(t, entries[0].ExpireAt > 0)
+	assert.Equal(t, "overwritten", entries[1].Key)
+
+	//写入时清理过期的key
+	assert.Nil(t, db.Put("b", "other", []byte("5"), 0))
+	_, ok := db.buckets["b"]["short"]
+	assert.False(t, ok)
+	assert.Nil(t, db.Close())
+
+	//重新打开时不加载过期的key
+	db, err = Open(path)
+	assert.Nil(t, err)
+	defer db.Close()
+	_, ok = db.buckets["b"]["short"]
+	assert.False(t, ok)
+	v, err := db.Get("b", "overwritten")
+	assert.Nil(t, err)
+	assert.Equal(t, "4", string(v))
+}
+
+func TestCrashRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crash.kv")
+	db, err := Open(path)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put("b", fmt.Sprintf("k%d", i), []byte(fmt.Sprintf("v%d", i)), 0))
+	}
+	assert.Nil(t, db.Delete("b", "k0"))
+	//模拟进程被杀死：不调用Close，最后一条记录只写入了一半
+	torn := encodeRecord(opPut, 0, "b", "torn", []byte("value"))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = f.Write(torn[:len(torn)-3])
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+	info, _ := os.Stat(path)
+	tornSize := info.Size()
+
+	db, err = Open(path)
+	assert.Nil(t, err)
+	_, err = db.Get("b", "torn")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = db.Get("b", "k0")
+	assert.Equal(t, ErrNotFound, err)
+	entries, _ := db.Scan("b", "", 0)
+	assert.Equal(t, 9, len(entries))
+	//损坏的尾部被截断，新的写入追加在有效记录之后
+	info, _ = os.Stat(path)
+	assert.Equal(t, tornSize-int64(len(torn)-3), info.Size())
+	assert.Nil(t, db.Put("b", "after", []byte("ok"), 0))
+	assert.Nil(t, db.Close())
+
+	//校验和错误的记录同样被截断
+	data, _ := os.ReadFile(path)
+	corrupt := encodeRecord(opPut, 0, "b", "corrupt", []byte("value"))
+	corrupt[len(corrupt)-1] ^= 0xff
+	assert.Nil(t, os.WriteFile(path, append(data, corrupt...), 0644))
+
+	db, err = Open(path)
+	assert.Nil(t, err)
+	defer db.Close()
+	v, err := db.Get("b", "after")
+	assert.Nil(t, err)
+	assert.Equal(t, "ok", string(v))
+	_, err = db.Get("b", "corrupt")
+	assert.Equal(t, ErrNotFound, err)
+	info, _ = os.Stat(path)
+	assert.Equal(t, int64(len(data)), info.Size())
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compact.kv")
+	db, err := OpenWithOptions(path, Options{CompactMinDead: 50})
+	assert.Nil(t, err)
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, db.Put("b", fmt.Sprintf("k%d", i%10), []byte(fmt.Sprintf("v%d", i)), 0))
+	}
+	//自动压缩
+	assert.True(t, db.dead < 50)
+	assert.Nil(t, db.Compact())
+	info, _ := os.Stat(path)
+	size := info.Size()
+	assert.Nil(t, db.Close())
+
+	db, err = Open(path)
+	assert.Nil(t, err)
+	defer db.Close()
+	entries, _ := db.Scan("b", "", 0)
+	assert.Equal(t, 10, len(entries))
+	assert.Equal(t, "v190", string(entries[0].Value))
+	assert.Equal(t, 0, db.dead)
+	info, _ = os.Stat(path)
+	assert.Equal(t, size, info.Size())
+}
+
+func TestConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "concurrent.kv")
+	db, err := OpenWithOptions(path, Options{CompactMinDead: 100})
+	assert.Nil(t, err)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			bucket := fmt.Sprintf("chain%d", g)
+			for i := 0; i < 100; i++ {
+				_ = db.Put(bucket, fmt.Sprintf("k%d", i%20), []byte(fmt.Sprintf("%d", i)), 0)
+				_, _ = db.Get(bucket, "k0")
+				_, _ = db.Scan(bucket, "k1", 5)
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Nil(t, db.Close())
+
+	db, err = Open(path)
+	assert.Nil(t, err)
+	defer db.Close()
+	for g := 0; g < 8; g++ {
+		entries, _ := db.Scan(fmt.Sprintf("chain%d", g), "", 0)
+		assert.Equal(t, 20, len(entries))
+	}
+}
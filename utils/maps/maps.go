@@ -59,6 +59,7 @@ import (
 	"strings"
 
 	"github.com/mitchellh/mapstructure"
+	"github.com/rulego/rulego/utils/json"
 )
 
 // Map2Struct Decode takes an input structure and uses reflection to translate it to
@@ -83,31 +84,56 @@ func Map2Struct(input interface{}, output interface{}) error {
 
 // Get 获取map中的字段，支持嵌套结构获取，例如fieldName.subFieldName.xx
 // 嵌套类型必须是map[string]interface{}
+// 如果子字段不存在，则尝试把剩余的字段作为带"."的key获取，例如metadata中的命名空间key：metadata.respHeader.Location
+// 也支持数组下标和转义，例如items[0].name、a\.b，以及以"/"开头的JSON pointer，详见 json.Path
 // 如果字段不存在，返回nil
 func Get(input interface{}, fieldName string) interface{} {
+	if fieldName != "" {
+		if path, err := json.CompilePath(fieldName); err == nil {
+			val, _ := path.Get(input)
+			return val
+		}
+	}
+	//无法解析的路径按照"."分割获取
 	// 按照"."分割fieldName
 	fields := strings.Split(fieldName, ".")
 	var result interface{}
 	result = input
 
 	// 遍历每个子字段
-	for _, field := range fields {
+	for i := 0; i < len(fields); i++ {
+		var ok bool
+		var val interface{}
 		switch v := result.(type) {
 		case map[string]interface{}:
-			if val, ok := v[field]; ok {
-				result = val
-			} else {
-				return nil
-			}
+			val, i, ok = getDottedKey(fields, i, func(key string) (interface{}, bool) {
+				val, ok := v[key]
+				return val, ok
+			})
 		case map[string]string:
-			if val, ok := v[field]; ok {
-				result = val
-			} else {
-				return nil
-			}
-		default:
+			val, i, ok = getDottedKey(fields, i, func(key string) (interface{}, bool) {
+				val, ok := v[key]
+				return val, ok
+			})
+		}
+		if !ok {
 			return nil
 		}
+		result = val
 	}
 	return result
 }
+
+// getDottedKey 从fields[i]开始依次尝试fields[i]、fields[i].fields[i+1]...作为key获取值，返回值和使用的最后一个字段下标
+func getDottedKey(fields []string, i int, get func(key string) (interface{}, bool)) (interface{}, int, bool) {
+	key := fields[i]
+	for j := i; j < len(fields); j++ {
+		if j > i {
+			key = key + "." + fields[j]
+		}
+		if val, ok := get(key); ok {
+			return val, j, true
+		}
+	}
+	return nil, i, false
+}
@@ -97,6 +97,10 @@ func TestGet(t *testing.T) {
 			"detail":  nil,
 		},
 		"friends": []string{"Bob", "Charlie"},
+		"metadata": map[string]string{
+			"respHeader.Location": "/items/1",
+			"a.b.c":               "abc",
+		},
 	}
 	// 定义一些测试用例，包含字段名和期望的值
 	cases := []struct {
@@ -112,6 +116,9 @@ func TestGet(t *testing.T) {
 		{"friends", []string{"Bob", "Charlie"}},
 		{"hobbies", nil},
 		{"address.zipcode", nil},
+		{"metadata.respHeader.Location", "/items/1"},
+		{"metadata.respHeader", nil},
+		{"metadata.a.b.c", "abc"},
 	}
 	// 遍历每个测试用例，调用GetFieldValue函数，断言结果是否与期望的值相等
 	for _, c := range cases {
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"sync"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// AckQueue 手动确认队列，一个连接对应一个队列
+// MQTT 3.1.1 §4.6 要求按照收到PUBLISH报文的顺序发送PUBACK，消息并发处理时，
+// 只有在之前收到的消息都处理完成后才发送该消息的PUBACK
+//
+// 队首消息不确认时，后面的消息都不能确认，调用 onNack 重发未确认的消息，例如：断开重连，
+// 持久会话(CleanSession=false)下broker在重连后重发所有未确认的消息
+type AckQueue struct {
+	mu sync.Mutex
+	//按顺序发送PUBACK，不阻塞 Push
+	ackMu   sync.Mutex
+	pending []*PendingAck
+	//连接断开后递增，旧连接上的消息不再确认
+	generation int
+	//队首消息不确认时调用，每个连接只调用一次
+	onNack func()
+	nacked bool
+}
+
+// PendingAck 等待确认的消息
+type PendingAck struct {
+	queue      *AckQueue
+	msg        paho.Message
+	generation int
+	done       bool
+	ack        bool
+}
+
+// NewAckQueue 创建手动确认队列，onNack 队首消息不确认时调用
+func NewAckQueue(onNack func()) *AckQueue {
+	return &AckQueue{onNack: onNack}
+}
+
+// Push 按照收到的顺序把消息加入队列，需要在订阅回调中同步调用
+// QoS 0 的消息不需要确认，不加入队列
+func (q *AckQueue) Push(msg paho.Message) *PendingAck {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	p := &PendingAck{queue: q, msg: msg, generation: q.generation}
+	if msg.Qos() > 0 {
+		q.pending = append(q.pending, p)
+	}
+	return p
+}
+
+// Len 等待确认的消息数量
+func (q *AckQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Reset 连接断开时清空队列，旧连接上未确认的消息由broker重发
+func (q *AckQueue) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = nil
+	q.generation++
+	q.nacked = false
+}
+
+// Done 消息处理完成，ack=false 不确认
+// 按照收到的顺序确认之前已经处理完成的消息，遇到没有处理完成的消息停止
+func (p *PendingAck) Done(ack bool) {
+	q := p.queue
+	q.ackMu.Lock()
+	defer q.ackMu.Unlock()
+	q.mu.Lock()
+	if p.generation != q.generation || p.done {
+		q.mu.Unlock()
+		return
+	}
+	p.done = true
+	p.ack = ack
+	var acked []paho.Message
+	var nack bool
+	for len(q.pending) > 0 && q.pending[0].done {
+		head := q.pending[0]
+		if !head.ack {
+			//队首消息不确认，后面的消息等待重发
+			if !q.nacked {
+				q.nacked = true
+				nack = true
+			}
+			break
+		}
+		acked = append(acked, head.msg)
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+	}
+	q.mu.Unlock()
+	for _, msg := range acked {
+		msg.Ack()
+	}
+	if nack && q.onNack != nil {
+		q.onNack()
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"sync"
+	"testing"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// testMessage 记录确认顺序
+type testMessage struct {
+	paho.Message
+	id    uint16
+	qos   byte
+	mu    *sync.Mutex
+	acked *[]uint16
+}
+
+func (m *testMessage) Qos() byte { return m.qos }
+func (m *testMessage) Ack() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	*m.acked = append(*m.acked, m.id)
+}
+
+func TestAckQueue(t *testing.T) {
+	var mu sync.Mutex
+	var acked []uint16
+	newMsg := func(id uint16, qos byte) *testMessage {
+		return &testMessage{id: id, qos: qos, mu: &mu, acked: &acked}
+	}
+	getAcked := func() []uint16 {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]uint16(nil), acked...)
+	}
+	var nacks int
+	queue := NewAckQueue(func() {
+		nacks++
+	})
+
+	//按照入队顺序确认
+	p1 := queue.Push(newMsg(1, 1))
+	p2 := queue.Push(newMsg(2, 1))
+	p3 := queue.Push(newMsg(3, 2))
+	p3.Done(true)
+	p2.Done(true)
+	assert.Equal(t, 0, len(getAcked()))
+	p1.Done(true)
+	assert.Equal(t, []uint16{1, 2, 3}, getAcked())
+	assert.Equal(t, 0, queue.Len())
+
+	//QoS 0 不需要确认
+	p0 := queue.Push(newMsg(4, 0))
+	assert.Equal(t, 0, queue.Len())
+	p0.Done(true)
+	assert.Equal(t, 3, len(getAcked()))
+
+	//队首消息不确认，后面的消息等待重发，只通知一次
+	p5 := queue.Push(newMsg(5, 1))
+	p6 := queue.Push(newMsg(6, 1))
+	p6.Done(true)
+	p5.Done(false)
+	assert.Equal(t, 1, nacks)
+	p7 := queue.Push(newMsg(7, 1))
+	p7.Done(false)
+	assert.Equal(t, 1, nacks)
+	assert.Equal(t, 3, len(getAcked()))
+	assert.Equal(t, 3, queue.Len())
+
+	//连接断开后，旧连接的消息不再确认
+	p8 := queue.Push(newMsg(8, 1))
+	queue.Reset()
+	assert.Equal(t, 0, queue.Len())
+	p8.Done(true)
+	p9 := queue.Push(newMsg(9, 1))
+	p9.Done(true)
+	assert.Equal(t, []uint16{1, 2, 3, 9}, getAcked())
+}
@@ -38,18 +38,25 @@ package mqtt
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
+	"errors"
 	"fmt"
+	"math/rand"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rulego/rulego/api/types"
 	string2 "github.com/rulego/rulego/utils/str"
 
-	"io/ioutil"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrNotConnected 客户端没有连接到broker，例如：正在重连
+var ErrNotConnected = errors.New("mqtt client not connected")
+
+// ErrPublishTimeout 超时时间内没有完成发布，QoS 1/2没有收到broker的确认
+var ErrPublishTimeout = errors.New("mqtt publish timeout")
+
 // Handler 订阅数据处理器
 type Handler struct {
 	//订阅主题
@@ -67,70 +74,176 @@ type Config struct {
 	//用户名
 	Username string
 	//密码
-	Password string
+	Password string `secret:"true"`
 	//重连重试间隔
 	MaxReconnectInterval time.Duration
 	QOS                  uint8
 	CleanSession         bool
 	//client Id
-	ClientID    string
+	ClientID string
+	//证书文件，兼容旧配置，推荐使用 TLS
 	CAFile      string
 	CertFile    string
 	CertKeyFile string
+	//TLS 配置，没有配置的证书使用 CAFile、CertFile、CertKeyFile
+	TLS types.TLSConfig
+	//手动确认，开启后收到的QoS 1/2消息不会自动发送PUBACK，需要调用 paho.Message.Ack()
+	//开启手动确认的连接不能和自动确认的订阅共享
+	ManualAck bool
+	//首次重连间隔，之后每次失败翻倍直到 MaxReconnectInterval，为0时默认1秒
+	InitialReconnectInterval time.Duration
+	//重连间隔的随机抖动比例，取值0~1，例如：0.2表示在间隔的80%~120%之间随机，避免大量客户端同时重连
+	ReconnectJitter float64
+	//心跳间隔，为0时使用paho默认的30秒
+	KeepAlive time.Duration
+	//遗嘱消息主题，为空不设置遗嘱消息，客户端异常断开时broker发布遗嘱消息
+	WillTopic string
+	//遗嘱消息内容
+	WillPayload string
+	//遗嘱消息QoS
+	WillQos uint8
+	//遗嘱消息是否保留
+	WillRetained bool
+	//协议版本：3（MQTT 3.1）、4（MQTT 3.1.1），为0时先使用3.1.1连接，失败再使用3.1
+	//不支持MQTT 5，paho.mqtt.golang 客户端没有实现v5的用户属性、响应主题等特性，配置5返回 ErrProtocolVersionNotSupported
+	ProtocolVersion uint
 }
 
-// Client mqtt客户端
-type Client struct {
-	sync.RWMutex
-	wg     sync.WaitGroup
-	client paho.Client
-	//订阅主题和处理器映射
-	msgHandlerMap map[string]Handler
-}
+// ErrProtocolVersionNotSupported 不支持的mqtt协议版本
+var ErrProtocolVersionNotSupported = errors.New("mqtt protocolVersion not supported, only 3 (MQTT 3.1) and 4 (MQTT 3.1.1) are supported")
 
-// NewClient 创建一个MQTT客户端实例
-func NewClient(ctx context.Context, conf Config) (*Client, error) {
-	var err error
-
-	b := Client{
-		msgHandlerMap: make(map[string]Handler),
+// CheckProtocolVersion 检查协议版本，只支持0、3、4
+func CheckProtocolVersion(version uint) error {
+	switch version {
+	case 0, 3, 4:
+		return nil
+	default:
+		return fmt.Errorf("%w: %d", ErrProtocolVersionNotSupported, version)
 	}
+}
 
+// NewClientOptions 根据配置创建paho客户端选项，不包括连接和断开的回调
+// 遗嘱消息保存在选项中，自动重连时重新发送给broker
+func NewClientOptions(conf Config) (*paho.ClientOptions, error) {
 	opts := paho.NewClientOptions()
 	opts.AddBroker(conf.Server)
 	opts.SetUsername(conf.Username)
 	opts.SetPassword(conf.Password)
 	opts.SetCleanSession(conf.CleanSession)
+	opts.SetAutoAckDisabled(conf.ManualAck)
 	if conf.ClientID == "" {
 		//随机clientId
 		opts.SetClientID("rulego/" + string2.RandomStr(8))
 	} else {
 		opts.SetClientID(conf.ClientID)
 	}
-	opts.SetOnConnectHandler(b.onConnected)
-	opts.SetConnectionLostHandler(b.onConnectionLost)
 	if conf.MaxReconnectInterval <= 0 {
 		conf.MaxReconnectInterval = time.Second * 60
 	}
 	opts.SetMaxReconnectInterval(conf.MaxReconnectInterval)
+	if conf.KeepAlive > 0 {
+		opts.SetKeepAlive(conf.KeepAlive)
+	}
+	if err := CheckProtocolVersion(conf.ProtocolVersion); err != nil {
+		return nil, err
+	}
+	if conf.ProtocolVersion > 0 {
+		opts.SetProtocolVersion(conf.ProtocolVersion)
+	}
+	if conf.WillTopic != "" {
+		opts.SetWill(conf.WillTopic, conf.WillPayload, conf.WillQos, conf.WillRetained)
+	}
 
-	tlsconfig, err := newTLSConfig(conf.CAFile, conf.CertFile, conf.CertKeyFile)
+	tlsconfig, err := conf.TLS.Fallback(conf.CAFile, conf.CertFile, conf.CertKeyFile).NewTLSConfig()
 	if err != nil {
-		return nil, fmt.Errorf("error loading mqtt certificate files,ca_cert=%s,tls_cert=%s,tls_key=%s", conf.CAFile, conf.CertFile, conf.CertKeyFile)
+		return nil, fmt.Errorf("error loading mqtt tls config:%s", err.Error())
 	}
 	//tls
 	if tlsconfig != nil {
 		opts.SetTLSConfig(tlsconfig)
 	}
+	return opts, nil
+}
+
+// ReconnectDelay 第attempt次重连前的等待时间，从 InitialReconnectInterval 开始每次翻倍，
+// 最大为 MaxReconnectInterval，并按照 ReconnectJitter 随机抖动
+func (conf Config) ReconnectDelay(attempt int) time.Duration {
+	interval := conf.InitialReconnectInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	maxInterval := conf.MaxReconnectInterval
+	if maxInterval <= 0 {
+		maxInterval = time.Second * 60
+	}
+	for i := 1; i < attempt && interval < maxInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	if jitter := conf.ReconnectJitter; jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		interval = time.Duration(float64(interval) * (1 + jitter*(2*rand.Float64()-1)))
+	}
+	return interval
+}
+
+// Client mqtt客户端
+type Client struct {
+	sync.RWMutex
+	wg     sync.WaitGroup
+	client paho.Client
+	//订阅主题和处理器映射
+	msgHandlerMap map[string]Handler
+	//最近一次连接断开的原因
+	lostReason atomic.Value
+	conf       Config
+	//连接状态监听器
+	listenerMu     sync.Mutex
+	listeners      map[int]func(connected bool, err error)
+	nextListenerId int
+	//是否正在重连
+	reconnecting int32
+	//连接是否断开过，重连成功后通知监听器
+	lost int32
+	//客户端关闭后停止重连
+	done      chan struct{}
+	closeOnce sync.Once
+	//手动确认队列，开启手动确认时有效
+	acks *AckQueue
+}
+
+// NewClient 创建一个MQTT客户端实例
+func NewClient(ctx context.Context, conf Config) (*Client, error) {
+	b := Client{
+		msgHandlerMap: make(map[string]Handler),
+		conf:          conf,
+		listeners:     make(map[int]func(connected bool, err error)),
+		done:          make(chan struct{}),
+	}
+	if conf.ManualAck {
+		b.acks = NewAckQueue(b.Redeliver)
+	}
+	opts, err := NewClientOptions(conf)
+	if err != nil {
+		return nil, err
+	}
+	opts.SetOnConnectHandler(b.onConnected)
+	opts.SetConnectionLostHandler(b.onConnectionLost)
+	//断开后由 reconnect 按照指数退避重连
+	opts.SetAutoReconnect(false)
 	b.client = paho.NewClient(opts)
 
-	for {
+	for attempt := 1; ; attempt++ {
 		if token := b.client.Connect(); token.Wait() && token.Error() != nil {
 			select {
 			case <-ctx.Done():
 				//context被取消或超时，返回错误
 				return nil, token.Error()
-			case <-time.After(2 * time.Second):
+			case <-time.After(conf.ReconnectDelay(attempt)):
 				//定时器到期，继续重试
 			}
 		} else {
@@ -175,6 +288,9 @@ func (b *Client) GetHandlerByUpTopic(topic string) Handler {
 }
 
 func (b *Client) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
 	b.RLock()
 	// Create a copy to avoid holding lock during unsubscribe operations
 	handlers := make([]Handler, 0, len(b.msgHandlerMap))
@@ -193,15 +309,93 @@ func (b *Client) Close() error {
 
 // Publish 发布数据
 func (b *Client) Publish(topic string, qos byte, data []byte) error {
-	if token := b.client.Publish(topic, qos, false, data); token.Wait() && token.Error() != nil {
-		return token.Error()
+	return b.PublishWithRetained(topic, qos, false, data)
+}
+
+// PublishWithRetained 发布数据，retained为true时broker保留该主题的最后一条消息，发送给之后订阅的客户端
+func (b *Client) PublishWithRetained(topic string, qos byte, retained bool, data []byte) error {
+	_, _, err := b.PublishAndWait(topic, qos, retained, data, 0)
+	return err
+}
+
+// PublishAndWait 发布数据并等待完成，QoS 1等待PUBACK，QoS 2等待PUBCOMP，timeout<=0时一直等待
+// 返回报文标识符和发布耗时，QoS 0的报文标识符为0
+func (b *Client) PublishAndWait(topic string, qos byte, retained bool, data []byte, timeout time.Duration) (uint16, time.Duration, error) {
+	start := time.Now()
+	token := b.client.Publish(topic, qos, retained, data)
+	if timeout > 0 {
+		if !token.WaitTimeout(timeout) {
+			return packetId(token), time.Since(start), ErrPublishTimeout
+		}
 	} else {
-		return nil
+		token.Wait()
 	}
+	return packetId(token), time.Since(start), token.Error()
+}
+
+// packetId 发布报文的标识符
+func packetId(token paho.Token) uint16 {
+	if publishToken, ok := token.(*paho.PublishToken); ok {
+		return publishToken.MessageID()
+	}
+	return 0
 }
 
 func (b *Client) onConnected(c paho.Client) {
 	b.subscribe()
+	if atomic.CompareAndSwapInt32(&b.lost, 1, 0) {
+		b.notifyState(true, nil)
+	}
+}
+
+// AddStateListener 添加连接状态监听器，连接断开和重连成功时调用，断开时err为断开的原因，返回删除监听器的函数
+func (b *Client) AddStateListener(listener func(connected bool, err error)) (remove func()) {
+	b.listenerMu.Lock()
+	defer b.listenerMu.Unlock()
+	id := b.nextListenerId
+	b.nextListenerId++
+	b.listeners[id] = listener
+	return func() {
+		b.listenerMu.Lock()
+		defer b.listenerMu.Unlock()
+		delete(b.listeners, id)
+	}
+}
+
+func (b *Client) notifyState(connected bool, err error) {
+	b.listenerMu.Lock()
+	listeners := make([]func(connected bool, err error), 0, len(b.listeners))
+	for _, listener := range b.listeners {
+		listeners = append(listeners, listener)
+	}
+	b.listenerMu.Unlock()
+	for _, listener := range listeners {
+		listener(connected, err)
+	}
+}
+
+// reconnect 按照指数退避重连，直到连接成功或者客户端关闭
+func (b *Client) reconnect() {
+	if !atomic.CompareAndSwapInt32(&b.reconnecting, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&b.reconnecting, 0)
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-b.done:
+			return
+		case <-time.After(b.conf.ReconnectDelay(attempt)):
+		}
+		if token := b.client.Connect(); token.Wait() && token.Error() == nil {
+			select {
+			case <-b.done:
+				//重连期间客户端已经关闭
+				b.client.Disconnect(0)
+			default:
+			}
+			return
+		}
+	}
 }
 
 func (b *Client) subscribe() {
@@ -237,34 +431,53 @@ func is128Err(token *paho.SubscribeToken, topic string) bool {
 }
 
 func (b *Client) onConnectionLost(c paho.Client, reason error) {
+	if b.acks != nil {
+		b.acks.Reset()
+	}
+	if reason != nil {
+		b.lostReason.Store(reason.Error())
+	}
+	atomic.StoreInt32(&b.lost, 1)
+	b.notifyState(false, reason)
+	go b.reconnect()
 }
 
-func newTLSConfig(CAFile, certFile, certKeyFile string) (*tls.Config, error) {
-	if CAFile == "" && certFile == "" && certKeyFile == "" {
-		return nil, nil
-	}
+// ManualAck 是否开启手动确认
+func (b *Client) ManualAck() bool {
+	return b.conf.ManualAck
+}
 
-	tlsConfig := &tls.Config{}
+// AckQueue 手动确认队列，没有开启手动确认返回nil
+func (b *Client) AckQueue() *AckQueue {
+	return b.acks
+}
 
-	// Import trusted certificates from CAFile.pem.
-	if CAFile != "" {
-		caCert, err := ioutil.ReadFile(CAFile)
-		if err != nil {
-			return nil, err
+// Redeliver 断开连接，然后按照重连间隔重新连接，持久会话(CleanSession=false)下broker在重连后重发未确认的消息
+// 手动确认模式下，等待确认的队首消息不确认时调用
+func (b *Client) Redeliver() {
+	go func() {
+		b.client.Disconnect(250)
+		//断开后再清空队列，断开前队首消息之后的消息都不会被确认
+		if b.acks != nil {
+			b.acks.Reset()
 		}
-		certPool := x509.NewCertPool()
-		certPool.AppendCertsFromPEM(caCert)
+		b.reconnect()
+	}()
+}
 
-		tlsConfig.RootCAs = certPool // RootCAs = certs used to verify server cert.
-	}
+// IsConnected 是否已经连接到broker，自动重连期间返回false
+func (b *Client) IsConnected() bool {
+	return b.client.IsConnectionOpen()
+}
 
-	// Import certificate and the key
-	if certFile != "" && certKeyFile != "" {
-		kp, err := tls.LoadX509KeyPair(certFile, certKeyFile)
-		if err != nil {
-			return nil, err
-		}
-		tlsConfig.Certificates = []tls.Certificate{kp}
+// Health 连接健康状态，用于 types.HealthChecker
+func (b *Client) Health() (types.HealthStatus, string) {
+	if b.IsConnected() {
+		return types.HealthHealthy, ""
+	}
+	reason := "mqtt broker disconnected"
+	if lost, ok := b.lostReason.Load().(string); ok {
+		reason += ":" + lost
 	}
-	return tlsConfig, nil
+	return types.HealthUnhealthy, reason
 }
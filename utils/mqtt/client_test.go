@@ -0,0 +1,79 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqtt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestNewClientOptions(t *testing.T) {
+	opts, err := NewClientOptions(Config{
+		Server:       "127.0.0.1:1883",
+		ClientID:     "gateway01",
+		KeepAlive:    15 * time.Second,
+		WillTopic:    "/gateway/gateway01/status",
+		WillPayload:  "offline",
+		WillQos:      1,
+		WillRetained: true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "gateway01", opts.ClientID)
+	assert.Equal(t, int64(15), opts.KeepAlive)
+	assert.True(t, opts.WillEnabled)
+	assert.Equal(t, "/gateway/gateway01/status", opts.WillTopic)
+	assert.Equal(t, "offline", string(opts.WillPayload))
+	assert.Equal(t, byte(1), opts.WillQos)
+	assert.True(t, opts.WillRetained)
+	assert.Equal(t, time.Second*60, opts.MaxReconnectInterval)
+
+	//默认不设置遗嘱消息，使用paho默认的心跳间隔
+	opts, err = NewClientOptions(Config{Server: "127.0.0.1:1883"})
+	assert.Nil(t, err)
+	assert.False(t, opts.WillEnabled)
+	assert.Equal(t, int64(30), opts.KeepAlive)
+	assert.Equal(t, uint(0), opts.ProtocolVersion)
+
+	opts, err = NewClientOptions(Config{Server: "127.0.0.1:1883", ProtocolVersion: 4})
+	assert.Nil(t, err)
+	assert.Equal(t, uint(4), opts.ProtocolVersion)
+	//不支持MQTT 5
+	_, err = NewClientOptions(Config{Server: "127.0.0.1:1883", ProtocolVersion: 5})
+	assert.True(t, errors.Is(err, ErrProtocolVersionNotSupported))
+}
+
+func TestReconnectDelay(t *testing.T) {
+	conf := Config{InitialReconnectInterval: time.Second, MaxReconnectInterval: 10 * time.Second}
+	assert.Equal(t, time.Second, conf.ReconnectDelay(1))
+	assert.Equal(t, 2*time.Second, conf.ReconnectDelay(2))
+	assert.Equal(t, 8*time.Second, conf.ReconnectDelay(4))
+	assert.Equal(t, 10*time.Second, conf.ReconnectDelay(5))
+	assert.Equal(t, 10*time.Second, conf.ReconnectDelay(100))
+
+	//默认首次间隔1秒，最大间隔60秒
+	assert.Equal(t, time.Second, Config{}.ReconnectDelay(1))
+	assert.Equal(t, 60*time.Second, Config{}.ReconnectDelay(10))
+
+	conf.ReconnectJitter = 0.2
+	for i := 0; i < 100; i++ {
+		delay := conf.ReconnectDelay(2)
+		assert.True(t, delay >= 1600*time.Millisecond && delay <= 2400*time.Millisecond)
+	}
+}
@@ -23,7 +23,7 @@
 // form generation based on the structure of component types.
 //
 // Key features:
-// - GetComponentForm: Generates a form structure for a given component
+// - GetComponentForm: Generates a form structure for a given component, with enum (tag:enum) and secret (tag:secret) fields
 // - GetComponentConfig: Extracts configuration information from a component
 // - GetFields: Retrieves field information from struct types
 // - SetField: Sets field values in structs using reflection
@@ -76,6 +76,9 @@ func GetComponentForm(component types.Node) types.ComponentForm {
 	if descGetter, ok := component.(types.DescGetter); ok {
 		componentForm.Desc = descGetter.Desc()
 	}
+	if fieldsCustomizer, ok := component.(types.ComponentFormFieldsCustomizer); ok {
+		componentForm.Fields = fieldsCustomizer.CustomizeFields(componentForm.Fields)
+	}
 	return componentForm
 }
 
@@ -154,6 +157,13 @@ func GetFields(configField reflect.StructField, configValue reflect.Value) []typ
 			desc := field.Tag.Get("desc")
 			validate := field.Tag.Get("validate")
 			required, _ := strconv.ParseBool(field.Tag.Get("required"))
+			secret, _ := strconv.ParseBool(field.Tag.Get("secret"))
+			var enum []string
+			for _, item := range strings.Split(field.Tag.Get("enum"), ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					enum = append(enum, item)
+				}
+			}
 			typeName := field.Type.Name()
 			var subFields []types.ComponentFormField
 			if field.Type.Kind() == reflect.Map {
@@ -193,6 +203,9 @@ func GetFields(configField reflect.StructField, configValue reflect.Value) []typ
 					Rules:        rules,
 					Validate:     validate,
 					Fields:       subFields,
+					Required:     required,
+					Enum:         enum,
+					Secret:       secret,
 				})
 		}
 	}
@@ -151,3 +151,60 @@ func TestGetFieldsWithJSONTag(t *testing.T) {
 	assert.Equal(t, "空JSON标签", fieldWithEmpty.Label)
 	assert.Equal(t, "JSON标签为空字符串", fieldWithEmpty.Desc)
 }
+
+// SchemaConfiguration 测试可选值、敏感字段和嵌套字段的配置
+type SchemaConfiguration struct {
+	Method   string `enum:"GET, POST"`
+	Password string `secret:"true"`
+	Timeout  int
+	Tls      struct {
+		Enable bool
+	}
+}
+
+// SchemaNode 测试自定义字段的节点
+type SchemaNode struct {
+	Config SchemaConfiguration
+}
+
+func (x *SchemaNode) Type() string {
+	return "testSchema"
+}
+
+func (x *SchemaNode) New() types.Node {
+	return &SchemaNode{Config: SchemaConfiguration{Method: "GET", Timeout: 10}}
+}
+
+func (x *SchemaNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return nil
+}
+
+func (x *SchemaNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {}
+
+func (x *SchemaNode) Destroy() {}
+
+func (x *SchemaNode) CustomizeFields(fields types.ComponentFormFieldList) types.ComponentFormFieldList {
+	return append(fields, types.ComponentFormField{Name: "dynamic", Type: "string", DefaultValue: "x"})
+}
+
+func TestGetComponentSchema(t *testing.T) {
+	form := GetComponentForm((&SchemaNode{}).New())
+	assert.Equal(t, 5, len(form.Fields))
+
+	method, _ := form.Fields.GetField("method")
+	assert.Equal(t, []string{"GET", "POST"}, method.Enum)
+	assert.False(t, method.Secret)
+	password, _ := form.Fields.GetField("password")
+	assert.True(t, password.Secret)
+	assert.Nil(t, password.Enum)
+	_, ok := form.Fields.GetField("dynamic")
+	assert.True(t, ok)
+
+	assert.Equal(t, types.Configuration{
+		"method":   "GET",
+		"password": "",
+		"timeout":  10,
+		"tls":      types.Configuration{"enable": false},
+		"dynamic":  "x",
+	}, form.Fields.DefaultConfiguration())
+}
@@ -0,0 +1,551 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package sftp provides a minimal SFTP client for the RuleGo rule engine.
+//
+// This package implements version 3 of the SSH File Transfer Protocol on top of
+// an established golang.org/x/crypto/ssh connection, which is the version
+// supported by OpenSSH. It covers the operations needed by the sftp component:
+// reading and writing files, listing directories, stat and removing files.
+//
+// Requests are sent one at a time, so a Client can be shared by multiple
+// goroutines but does not pipeline reads and writes.
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 协议版本
+const protocolVersion = 3
+
+// 报文类型
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpRemove   = 13
+	fxpStat     = 17
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+	fxfRead     = 0x01
+	fxfWrite    = 0x02
+	fxfCreat    = 0x08
+	fxfTrunc    = 0x10
+	attrSize    = 0x01
+	attrUidGid  = 0x02
+	attrPerm    = 0x04
+	attrTime    = 0x08
+	attrExtend  = 0x80000000
+	modeTypeDir = 0040000
+	modeType    = 0170000
+)
+
+// 状态码
+const (
+	StatusOk               = 0
+	StatusEOF              = 1
+	StatusNoSuchFile       = 2
+	StatusPermissionDenied = 3
+	StatusFailure          = 4
+)
+
+// maxPacket 读写数据块的最大长度，OpenSSH 支持的最大值
+const maxPacket = 32768
+
+// ErrClosed 客户端已经关闭
+var ErrClosed = errors.New("sftp client closed")
+
+// StatusError 服务端返回的错误状态
+type StatusError struct {
+	Code uint32
+	Msg  string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("sftp: %s (code %d)", e.Msg, e.Code)
+}
+
+// Is 支持 errors.Is(err, os.ErrNotExist) 和 errors.Is(err, os.ErrPermission)
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case os.ErrNotExist:
+		return e.Code == StatusNoSuchFile
+	case os.ErrPermission:
+		return e.Code == StatusPermissionDenied
+	}
+	return false
+}
+
+// FileInfo 文件信息
+type FileInfo struct {
+	Name    string      `json:"name"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	IsDir   bool        `json:"isDir"`
+}
+
+// Client sftp 客户端
+type Client struct {
+	session *ssh.Session
+	w       io.WriteCloser
+	r       io.Reader
+	mu      sync.Mutex
+	nextId  uint32
+	closed  bool
+}
+
+// NewClient 在 ssh 连接上打开 sftp 子系统，并完成版本协商
+func NewClient(conn *ssh.Client) (*Client, error) {
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	if err = session.RequestSubsystem("sftp"); err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	c := &Client{session: session, w: w, r: r}
+	if err = c.init(); err != nil {
+		_ = session.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) init() error {
+	if err := writePacket(c.w, fxpInit, appendUint32(nil, protocolVersion)); err != nil {
+		return err
+	}
+	typ, data, err := readPacket(c.r)
+	if err != nil {
+		return err
+	}
+	if typ != fxpVersion || len(data) < 4 {
+		return fmt.Errorf("sftp: unexpected packet type %d, expect version", typ)
+	}
+	if version := binary.BigEndian.Uint32(data); version < protocolVersion {
+		return fmt.Errorf("sftp: unsupported protocol version %d", version)
+	}
+	return nil
+}
+
+// Close 关闭 sftp 会话，不关闭 ssh 连接
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.session.Close()
+}
+
+// request 发送请求并等待响应，返回响应类型和去掉请求id的数据
+func (c *Client) request(typ byte, payload []byte) (byte, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, nil, ErrClosed
+	}
+	c.nextId++
+	id := c.nextId
+	if err := writePacket(c.w, typ, append(appendUint32(nil, id), payload...)); err != nil {
+		return 0, nil, c.fail(err)
+	}
+	respType, data, err := readPacket(c.r)
+	if err != nil {
+		return 0, nil, c.fail(err)
+	}
+	if len(data) < 4 || binary.BigEndian.Uint32(data) != id {
+		return 0, nil, c.fail(fmt.Errorf("sftp: unexpected response id for request %d", id))
+	}
+	return respType, data[4:], nil
+}
+
+// fail 读写会话失败，例如：连接已经断开，关闭客户端，调用方需要持有锁
+func (c *Client) fail(err error) error {
+	c.closed = true
+	_ = c.session.Close()
+	return err
+}
+
+// Closed 客户端是否已经关闭，读写会话失败后自动关闭，需要重新创建客户端
+func (c *Client) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// status 处理 fxpStatus 响应，状态码 StatusOk 返回 nil
+func status(typ byte, data []byte) error {
+	if typ != fxpStatus {
+		return fmt.Errorf("sftp: unexpected packet type %d", typ)
+	}
+	code, data, ok := readUint32(data)
+	if !ok {
+		return errors.New("sftp: invalid status packet")
+	}
+	if code == StatusOk {
+		return nil
+	}
+	msg, _, _ := readString(data)
+	if msg == "" {
+		msg = "failure"
+	}
+	return &StatusError{Code: code, Msg: msg}
+}
+
+func (c *Client) handle(typ byte, payload []byte) (string, error) {
+	respType, data, err := c.request(typ, payload)
+	if err != nil {
+		return "", err
+	}
+	if respType != fxpHandle {
+		return "", status(respType, data)
+	}
+	handle, _, ok := readString(data)
+	if !ok {
+		return "", errors.New("sftp: invalid handle packet")
+	}
+	return handle, nil
+}
+
+func (c *Client) closeHandle(handle string) error {
+	typ, data, err := c.request(fxpClose, appendString(nil, handle))
+	if err != nil {
+		return err
+	}
+	return status(typ, data)
+}
+
+// Stat 获取文件信息，跟随符号链接
+func (c *Client) Stat(path string) (FileInfo, error) {
+	typ, data, err := c.request(fxpStat, appendString(nil, path))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if typ != fxpAttrs {
+		return FileInfo{}, status(typ, data)
+	}
+	info, _, ok := readAttrs(data)
+	if !ok {
+		return FileInfo{}, errors.New("sftp: invalid attrs packet")
+	}
+	info.Name = baseName(path)
+	return info, nil
+}
+
+// ReadDir 列出目录下的文件，不包括 . 和 ..
+func (c *Client) ReadDir(path string) ([]FileInfo, error) {
+	handle, err := c.handle(fxpOpendir, appendString(nil, path))
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeHandle(handle)
+	var list []FileInfo
+	for {
+		typ, data, err := c.request(fxpReaddir, appendString(nil, handle))
+		if err != nil {
+			return nil, err
+		}
+		if typ != fxpName {
+			if err = status(typ, data); err == nil || isEOF(err) {
+				return list, nil
+			}
+			return nil, err
+		}
+		count, data, ok := readUint32(data)
+		for i := uint32(0); ok && i < count; i++ {
+			var name string
+			var info FileInfo
+			if name, data, ok = readString(data); !ok {
+				break
+			}
+			//长格式名称，忽略
+			if _, data, ok = readString(data); !ok {
+				break
+			}
+			if info, data, ok = readAttrs(data); !ok {
+				break
+			}
+			if name != "." && name != ".." {
+				info.Name = name
+				list = append(list, info)
+			}
+		}
+		if !ok {
+			return nil, errors.New("sftp: invalid name packet")
+		}
+	}
+}
+
+// Remove 删除文件
+func (c *Client) Remove(path string) error {
+	typ, data, err := c.request(fxpRemove, appendString(nil, path))
+	if err != nil {
+		return err
+	}
+	return status(typ, data)
+}
+
+// Open 打开文件用于读取
+func (c *Client) Open(path string) (*File, error) {
+	return c.open(path, fxfRead)
+}
+
+// Create 创建文件用于写入，文件已经存在则清空
+func (c *Client) Create(path string) (*File, error) {
+	return c.open(path, fxfWrite|fxfCreat|fxfTrunc)
+}
+
+func (c *Client) open(path string, flags uint32) (*File, error) {
+	payload := appendString(nil, path)
+	payload = appendUint32(payload, flags)
+	//不设置属性
+	payload = appendUint32(payload, 0)
+	handle, err := c.handle(fxpOpen, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &File{client: c, path: path, handle: handle}, nil
+}
+
+// File 远程文件，实现 io.Reader、io.Writer 和 io.Closer
+type File struct {
+	client *Client
+	path   string
+	handle string
+	offset uint64
+}
+
+// Read 读取文件内容，读取到文件末尾返回 io.EOF
+func (f *File) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(p) > maxPacket {
+		p = p[:maxPacket]
+	}
+	payload := appendString(nil, f.handle)
+	payload = appendUint64(payload, f.offset)
+	payload = appendUint32(payload, uint32(len(p)))
+	typ, data, err := f.client.request(fxpRead, payload)
+	if err != nil {
+		return 0, err
+	}
+	if typ != fxpData {
+		if err = status(typ, data); err == nil || isEOF(err) {
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+	content, _, ok := readString(data)
+	if !ok {
+		return 0, errors.New("sftp: invalid data packet")
+	}
+	n := copy(p, content)
+	f.offset += uint64(n)
+	return n, nil
+}
+
+// Write 写入文件内容
+func (f *File) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := p[written:]
+		if len(chunk) > maxPacket {
+			chunk = chunk[:maxPacket]
+		}
+		payload := appendString(nil, f.handle)
+		payload = appendUint64(payload, f.offset)
+		payload = appendString(payload, string(chunk))
+		typ, data, err := f.client.request(fxpWrite, payload)
+		if err == nil {
+			err = status(typ, data)
+		}
+		if err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		f.offset += uint64(len(chunk))
+	}
+	return written, nil
+}
+
+// Stat 获取文件信息
+func (f *File) Stat() (FileInfo, error) {
+	return f.client.Stat(f.path)
+}
+
+// Close 关闭文件
+func (f *File) Close() error {
+	return f.client.closeHandle(f.handle)
+}
+
+func isEOF(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == StatusEOF
+}
+
+func baseName(path string) string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == '/' && i < len(path)-1 {
+			return path[i+1:]
+		}
+	}
+	return path
+}
+
+// writePacket 报文格式：uint32 长度 + byte 类型 + 数据
+func writePacket(w io.Writer, typ byte, payload []byte) error {
+	packet := appendUint32(make([]byte, 0, 5+len(payload)), uint32(len(payload)+1))
+	packet = append(packet, typ)
+	_, err := w.Write(append(packet, payload...))
+	return err
+}
+
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length == 0 || length > maxPacket*8 {
+		return 0, nil, fmt.Errorf("sftp: invalid packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return 0, nil, err
+	}
+	return packet[0], packet[1:], nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	return append(appendUint32(b, uint32(len(s))), s...)
+}
+
+func readUint32(b []byte) (uint32, []byte, bool) {
+	if len(b) < 4 {
+		return 0, b, false
+	}
+	return binary.BigEndian.Uint32(b), b[4:], true
+}
+
+func readUint64(b []byte) (uint64, []byte, bool) {
+	if len(b) < 8 {
+		return 0, b, false
+	}
+	return binary.BigEndian.Uint64(b), b[8:], true
+}
+
+func readString(b []byte) (string, []byte, bool) {
+	length, b, ok := readUint32(b)
+	if !ok || uint32(len(b)) < length {
+		return "", b, false
+	}
+	return string(b[:length]), b[length:], true
+}
+
+// readAttrs 解析文件属性，只保留大小、权限和修改时间
+func readAttrs(b []byte) (FileInfo, []byte, bool) {
+	var info FileInfo
+	flags, b, ok := readUint32(b)
+	if !ok {
+		return info, b, false
+	}
+	if flags&attrSize != 0 {
+		var size uint64
+		if size, b, ok = readUint64(b); !ok {
+			return info, b, false
+		}
+		info.Size = int64(size)
+	}
+	if flags&attrUidGid != 0 {
+		if _, b, ok = readUint64(b); !ok {
+			return info, b, false
+		}
+	}
+	if flags&attrPerm != 0 {
+		var perm uint32
+		if perm, b, ok = readUint32(b); !ok {
+			return info, b, false
+		}
+		info.IsDir = perm&modeType == modeTypeDir
+		info.Mode = os.FileMode(perm & 0777)
+		if info.IsDir {
+			info.Mode |= os.ModeDir
+		}
+	}
+	if flags&attrTime != 0 {
+		var mtime uint32
+		//访问时间，忽略
+		if _, b, ok = readUint32(b); !ok {
+			return info, b, false
+		}
+		if mtime, b, ok = readUint32(b); !ok {
+			return info, b, false
+		}
+		info.ModTime = time.Unix(int64(mtime), 0)
+	}
+	if flags&attrExtend != 0 {
+		var count uint32
+		if count, b, ok = readUint32(b); !ok {
+			return info, b, false
+		}
+		for i := uint32(0); i < count*2; i++ {
+			if _, b, ok = readString(b); !ok {
+				return info, b, false
+			}
+		}
+	}
+	return info, b, true
+}
@@ -84,6 +84,32 @@ func ExecuteTemplate(original string, dict map[string]interface{}) string {
 	})
 }
 
+// ExecuteTemplateStrict 替换字符串模板中的${}变量，和 ExecuteTemplate 不同，变量不存在或者转换成字符串失败时返回错误，
+// 错误中包含出错位置之前已经替换的内容
+func ExecuteTemplateStrict(original string, dict map[string]interface{}) (string, error) {
+	if !strings.Contains(original, "${") {
+		return original, nil
+	}
+	var builder strings.Builder
+	last := 0
+	for _, loc := range tplVarRegex.FindAllStringSubmatchIndex(original, -1) {
+		builder.WriteString(original[last:loc[0]])
+		key := strings.TrimSpace(original[loc[2]:loc[3]])
+		v := maps.Get(dict, key)
+		if v == nil {
+			return "", fmt.Errorf("template variable ${%s} not found, rendered: %s", key, builder.String())
+		}
+		value, err := ToStringMaybeErr(v)
+		if err != nil {
+			return "", fmt.Errorf("template variable ${%s} error: %w, rendered: %s", key, err, builder.String())
+		}
+		builder.WriteString(value)
+		last = loc[1]
+	}
+	builder.WriteString(original[last:])
+	return builder.String(), nil
+}
+
 // SprintfDict 根据pattern和dict格式化字符串。
 // SprintfDict 替换字符串模板中的${}变量
 // original是一个字符串，包含${key}形式的变量占位符。不支持多级变量。
@@ -58,6 +58,23 @@ func TestExecuteTemplate(t *testing.T) {
 	assert.Equal(t, "Hello, Alice.", s)
 }
 
+func TestExecuteTemplateStrict(t *testing.T) {
+	dict := map[string]interface{}{
+		"deviceId": "d01",
+		"msg":      map[string]interface{}{"temperature": 60},
+	}
+	s, err := ExecuteTemplateStrict(`{"deviceId":"${deviceId}","payload":${ msg }}`, dict)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"deviceId":"d01","payload":{"temperature":60}}`, s)
+
+	s, err = ExecuteTemplateStrict("Hello, Alice.", dict)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello, Alice.", s)
+
+	_, err = ExecuteTemplateStrict(`{"deviceId":"${deviceId}","name":"${name}"}`, dict)
+	assert.Equal(t, `template variable ${name} not found, rendered: {"deviceId":"d01","name":"`, err.Error())
+}
+
 type Stringer struct {
 	Value string
 }